@@ -3,6 +3,7 @@ package build
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/werf/werf/pkg/git_repo/gitdata"
 	"github.com/werf/werf/pkg/giterminism_manager"
@@ -10,10 +11,10 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/werf/logboek"
+	"github.com/werf/logboek/pkg/level"
 
 	"github.com/werf/werf/cmd/werf/common"
 	"github.com/werf/werf/pkg/build"
-	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/docker"
 	"github.com/werf/werf/pkg/git_repo"
 	"github.com/werf/werf/pkg/image"
@@ -27,6 +28,11 @@ import (
 	"github.com/werf/werf/pkg/werf/global_warnings"
 )
 
+var cmdData struct {
+	Graph        string
+	GraphOffline bool
+}
+
 var commonCmdData common.CmdData
 
 func NewCmd() *cobra.Command {
@@ -43,7 +49,10 @@ func NewCmd() *cobra.Command {
   $ werf build --introspect-error
 
   # Build images and store/use stages from repo
-  $ werf build --repo harbor.company.io/werf`,
+  $ werf build --repo harbor.company.io/werf
+
+  # Print the images dependency graph with the stages to be built in the DOT format
+  $ werf build --repo harbor.company.io/werf --graph=dot | dot -Tsvg > graph.svg`,
 		Long: common.GetLongCommandDescription(`Build images that are described in werf.yaml.
 
 The result of build command is built images pushed into the specified repo (or locally if repo is not specified).
@@ -63,6 +72,12 @@ If one or more IMAGE_NAME parameters specified, werf will build only these image
 				return err
 			}
 
+			// the graph is printed to stdout
+			if cmdData.Graph != "" && !*commonCmdData.LogVerbose && !*commonCmdData.LogDebug {
+				logboek.Streams().Mute()
+				logboek.SetAcceptedLevel(level.Error)
+			}
+
 			common.LogVersion()
 
 			return common.LogRunningTime(func() error {
@@ -84,13 +99,16 @@ If one or more IMAGE_NAME parameters specified, werf will build only these image
 	common.SetupSSHKey(&commonCmdData, cmd)
 
 	common.SetupSecondaryStagesStorageOptions(&commonCmdData, cmd)
+	common.SetupCacheStagesStorageOptions(&commonCmdData, cmd)
 	common.SetupStagesStorageOptions(&commonCmdData, cmd)
 
 	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read, pull and push images into the specified repo, to pull base images")
+	common.SetupContainerRuntime(&commonCmdData, cmd)
 	common.SetupInsecureRegistry(&commonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
 
 	common.SetupIntrospectAfterError(&commonCmdData, cmd)
+	common.SetupStageRetryOptions(&commonCmdData, cmd)
 	common.SetupIntrospectBeforeError(&commonCmdData, cmd)
 	common.SetupIntrospectStage(&commonCmdData, cmd)
 
@@ -104,6 +122,7 @@ If one or more IMAGE_NAME parameters specified, werf will build only these image
 
 	common.SetupReportPath(&commonCmdData, cmd)
 	common.SetupReportFormat(&commonCmdData, cmd)
+	common.SetupTracePath(&commonCmdData, cmd)
 
 	common.SetupVirtualMerge(&commonCmdData, cmd)
 	common.SetupVirtualMergeFromCommit(&commonCmdData, cmd)
@@ -119,10 +138,23 @@ If one or more IMAGE_NAME parameters specified, werf will build only these image
 	common.SetupAllowedLocalCacheVolumeUsageMargin(&commonCmdData, cmd)
 	common.SetupDockerServerStoragePath(&commonCmdData, cmd)
 
+	cmd.Flags().StringVarP(&cmdData.Graph, "graph", "", os.Getenv("WERF_GRAPH"), fmt.Sprintf(`Print the images dependency graph with the stage digests and statuses (cached, to-build, empty or unknown) in the specified format instead of building: %s or %s (default $WERF_GRAPH)`, build.GraphDot, build.GraphJSON))
+	cmd.Flags().BoolVarP(&cmdData.GraphOffline, "graph-offline", "", common.GetBoolEnvironmentDefaultFalse("WERF_GRAPH_OFFLINE"), "Print the graph using werf.yaml only, without access to the repo and container registries, all stage digests are unknown (default $WERF_GRAPH_OFFLINE)")
+
 	return cmd
 }
 
 func runMain(ctx context.Context, args []string) error {
+	switch build.GraphFormat(cmdData.Graph) {
+	case "", build.GraphDot, build.GraphJSON:
+	default:
+		return fmt.Errorf("bad --graph given %q, expected: \"%s\", \"%s\"", cmdData.Graph, build.GraphDot, build.GraphJSON)
+	}
+
+	if cmdData.GraphOffline && cmdData.Graph == "" {
+		return fmt.Errorf("--graph-offline can only be used with --graph")
+	}
+
 	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
 		return fmt.Errorf("initialization error: %s", err)
 	}
@@ -215,7 +247,20 @@ func run(ctx context.Context, giterminismManager giterminism_manager.Interface,
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	containerRuntime := &container_runtime.LocalDockerServerRuntime{} // TODO
+	containerRuntime, err := common.GetContainerRuntime(ctx, &commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	if cmdData.GraphOffline {
+		conveyorOptions := common.GetConveyorOptions(&commonCmdData)
+		conveyorOptions.Offline = true
+
+		conveyorWithRetry := build.NewConveyorWithRetryWrapper(werfConfig, giterminismManager, imagesToProcess, giterminismManager.ProjectDir(), projectTmpDir, ssh_agent.SSHAuthSock, containerRuntime, nil, nil, conveyorOptions)
+		defer conveyorWithRetry.Terminate()
+
+		return printGraph(ctx, conveyorWithRetry)
+	}
 
 	stagesStorageAddress := common.GetOptionalStagesStorageAddress(&commonCmdData)
 	stagesStorage, err := common.GetStagesStorage(stagesStorageAddress, containerRuntime, &commonCmdData)
@@ -239,8 +284,13 @@ func run(ctx context.Context, giterminismManager giterminism_manager.Interface,
 	if err != nil {
 		return err
 	}
+	cacheStagesStorageList, err := common.GetCacheStagesStorageList(stagesStorage, containerRuntime, &commonCmdData)
+	if err != nil {
+		return err
+	}
 
 	storageManager := manager.NewStorageManager(projectName, stagesStorage, secondaryStagesStorageList, storageLockManager, stagesStorageCache)
+	storageManager.CacheStagesStorageList = cacheStagesStorageList
 
 	buildOptions, err := common.GetBuildOptions(&commonCmdData, werfConfig)
 	if err != nil {
@@ -257,6 +307,10 @@ func run(ctx context.Context, giterminismManager giterminism_manager.Interface,
 	conveyorWithRetry := build.NewConveyorWithRetryWrapper(werfConfig, giterminismManager, imagesToProcess, giterminismManager.ProjectDir(), projectTmpDir, ssh_agent.SSHAuthSock, containerRuntime, storageManager, storageLockManager, conveyorOptions)
 	defer conveyorWithRetry.Terminate()
 
+	if cmdData.Graph != "" {
+		return printGraph(ctx, conveyorWithRetry)
+	}
+
 	if err := conveyorWithRetry.WithRetryBlock(ctx, func(c *build.Conveyor) error {
 		return c.Build(ctx, buildOptions)
 	}); err != nil {
@@ -265,3 +319,27 @@ func run(ctx context.Context, giterminismManager giterminism_manager.Interface,
 
 	return nil
 }
+
+func printGraph(ctx context.Context, conveyorWithRetry *build.ConveyorWithRetryWrapper) error {
+	var graph *build.Graph
+	if err := conveyorWithRetry.WithRetryBlock(ctx, func(c *build.Conveyor) error {
+		var err error
+		graph, err = c.Graph(ctx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	switch build.GraphFormat(cmdData.Graph) {
+	case build.GraphJSON:
+		data, err := graph.ToJsonData()
+		if err != nil {
+			return fmt.Errorf("unable to prepare graph json: %s", err)
+		}
+		fmt.Print(string(data))
+	case build.GraphDot:
+		fmt.Print(string(graph.ToDotData()))
+	}
+
+	return nil
+}
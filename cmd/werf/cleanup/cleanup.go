@@ -3,6 +3,7 @@ package cleanup
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 
@@ -23,6 +24,13 @@ import (
 	"github.com/werf/werf/pkg/werf/global_warnings"
 )
 
+var cmdData struct {
+	ReportPath            string
+	ReportFormat          string
+	CompactMetadataIndex  bool
+	SkipArtifactsDeletion bool
+}
+
 var commonCmdData common.CmdData
 
 func NewCmd() *cobra.Command {
@@ -73,8 +81,18 @@ It is safe to run this command periodically (daily is enough) by automated clean
 	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
 
 	common.SetupScanContextNamespaceOnly(&commonCmdData, cmd)
+	common.SetupScanResourceImages(&commonCmdData, cmd)
 	common.SetupDryRun(&commonCmdData, cmd)
 
+	cmd.Flags().StringVarP(&cmdData.ReportPath, "report-path", "", os.Getenv("WERF_CLEANUP_REPORT_PATH"), "Report save path ($WERF_CLEANUP_REPORT_PATH by default)")
+	cmd.Flags().StringVarP(&cmdData.ReportFormat, "report-format", "", os.Getenv("WERF_CLEANUP_REPORT_FORMAT"), fmt.Sprintf(`Report format: %[1]s or %[2]s (%[1]s or $WERF_CLEANUP_REPORT_FORMAT by default).
+The report lists every stage considered by the cleanup, the reasons why the stage has been kept (deployed in Kubernetes, used according to the used images sources, reached by git history-based policies, a relative of the kept stage, built within last N hours),
+the commits of the related images metadata and the reclaimed bytes. The report is also produced with --dry-run option`, string(cleaning.ReportJSON), string(cleaning.ReportYAML)))
+
+	cmd.Flags().BoolVarP(&cmdData.CompactMetadataIndex, "compact-metadata-index", "", common.GetBoolEnvironmentDefaultFalse("WERF_COMPACT_METADATA_INDEX"), `Rebuild the compacted metadata index in the container registry after cleanup (default $WERF_COMPACT_METADATA_INDEX).
+The index is only a hint: werf lists the metadata records by tags as usual and reads the import metadata from the index instead of inspecting separate tags, the records missing in the index are inspected by tags`)
+	cmd.Flags().BoolVarP(&cmdData.SkipArtifactsDeletion, "skip-artifacts-deletion", "", common.GetBoolEnvironmentDefaultFalse("WERF_SKIP_ARTIFACTS_DELETION"), "Do not look up and delete OCI artifacts (signatures, SBOMs, etc.) attached to the deleted stages, which saves requests to the container registry (default $WERF_SKIP_ARTIFACTS_DELETION)")
+
 	common.SetupLogOptions(&commonCmdData, cmd)
 	common.SetupLogProjectDir(&commonCmdData, cmd)
 
@@ -83,6 +101,7 @@ It is safe to run this command periodically (daily is enough) by automated clean
 	common.SetupKubeConfigBase64(&commonCmdData, cmd)
 	common.SetupKubeContext(&commonCmdData, cmd)
 	common.SetupWithoutKube(&commonCmdData, cmd)
+	common.SetupUsedImagesSources(&commonCmdData, cmd)
 	common.SetupKeepStagesBuiltWithinLastNHours(&commonCmdData, cmd)
 
 	common.SetupDisableAutoHostCleanup(&commonCmdData, cmd)
@@ -235,15 +254,41 @@ It is worth noting that auto-cleaning is enabled by default, and manual use is u
 		return fmt.Errorf("unable to get Kubernetes clusters connections: %s", err)
 	}
 
+	kubernetesDynamicClientByContext, err := common.GetKubernetesContextDynamicClients(&commonCmdData, kubernetesContextClients)
+	if err != nil {
+		return fmt.Errorf("unable to get Kubernetes clusters connections: %s", err)
+	}
+
+	scanResourceImagesPaths, err := common.GetScanResourceImagesPaths(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	reportFormat := cleaning.ReportFormat(cmdData.ReportFormat)
+	switch reportFormat {
+	case "":
+		reportFormat = cleaning.ReportJSON
+	case cleaning.ReportJSON, cleaning.ReportYAML:
+	default:
+		return fmt.Errorf("bad --report-format given %q, expected: \"%s\", \"%s\"", reportFormat, cleaning.ReportJSON, cleaning.ReportYAML)
+	}
+
 	cleanupOptions := cleaning.CleanupOptions{
 		ImageNameList:                           imagesNames,
 		LocalGit:                                giterminismManager.LocalGitRepo(),
 		KubernetesContextClients:                kubernetesContextClients,
 		KubernetesNamespaceRestrictionByContext: common.GetKubernetesNamespaceRestrictionByContext(&commonCmdData, kubernetesContextClients),
+		KubernetesDynamicClientByContext:        kubernetesDynamicClientByContext,
+		ScanResourceImagesPaths:                 scanResourceImagesPaths,
 		WithoutKube:                             *commonCmdData.WithoutKube,
+		UsedImagesSources:                       common.GetUsedImagesSources(&commonCmdData),
 		GitHistoryBasedCleanupOptions:           werfConfig.Meta.Cleanup,
 		KeepStagesBuiltWithinLastNHours:         *commonCmdData.KeepStagesBuiltWithinLastNHours,
 		DryRun:                                  *commonCmdData.DryRun,
+		ReportPath:                              cmdData.ReportPath,
+		ReportFormat:                            reportFormat,
+		CompactMetadataIndex:                    cmdData.CompactMetadataIndex,
+		SkipArtifactsDeletion:                   cmdData.SkipArtifactsDeletion,
 	}
 
 	logboek.LogOptionalLn()
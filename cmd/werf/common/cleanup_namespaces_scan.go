@@ -2,10 +2,14 @@ package common
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/werf/kubedog/pkg/kube"
 	"github.com/werf/logboek"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/werf/werf/pkg/cleaning/allow_list"
 )
 
 func SetupScanContextNamespaceOnly(cmdData *CmdData, cmd *cobra.Command) {
@@ -13,6 +17,53 @@ func SetupScanContextNamespaceOnly(cmdData *CmdData, cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(cmdData.ScanContextNamespaceOnly, "scan-context-namespace-only", "", GetBoolEnvironmentDefaultFalse("WERF_SCAN_CONTEXT_NAMESPACE_ONLY"), "Scan for used images only in namespace linked with context for each available context in kube-config (or only for the context specified with option --kube-context). When disabled will scan all namespaces in all contexts (or only for the context specified with option --kube-context). (Default $WERF_SCAN_CONTEXT_NAMESPACE_ONLY)")
 }
 
+func SetupScanResourceImages(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ScanResourceImages = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.ScanResourceImages, "scan-resource-images", "", []string{}, fmt.Sprintf(`Scan for used images in the resources of the specified kind using JSONPath expression: APIVERSION/KIND=JSONPATH (e.g. mycompany.io/v1/App={.spec.components[*].image}).
+The resources of the kinds not served by the cluster are skipped. Argo Rollouts, Knative Services and KubeVirt VirtualMachines are scanned by default (skipped with a warning if the kind cannot be discovered or listed): %s.
+Also, can be specified with $WERF_SCAN_RESOURCE_IMAGES_* (e.g. $WERF_SCAN_RESOURCE_IMAGES_1=..., $WERF_SCAN_RESOURCE_IMAGES_2=...)`, defaultScanResourceImagesKinds()))
+}
+
+func defaultScanResourceImagesKinds() string {
+	var kinds []string
+	for _, paths := range allow_list.DefaultResourceImagesPaths {
+		kinds = append(kinds, fmt.Sprintf("%s/%s", paths.GroupVersionKind.GroupVersion().String(), paths.GroupVersionKind.Kind))
+	}
+
+	return strings.Join(kinds, ", ")
+}
+
+func GetScanResourceImagesPaths(cmdData *CmdData) ([]*allow_list.ResourceImagesPaths, error) {
+	resourcesImagesPaths, err := allow_list.ParseResourceImagesPaths(append(predefinedValuesByEnvNamePrefix("WERF_SCAN_RESOURCE_IMAGES_"), *cmdData.ScanResourceImages...))
+	if err != nil {
+		return nil, fmt.Errorf("bad --scan-resource-images given: %s", err)
+	}
+
+	return append(allow_list.DefaultResourceImagesPaths, resourcesImagesPaths...), nil
+}
+
+// GetKubernetesContextDynamicClients returns the dynamic clients for the contexts to scan for used images in the arbitrary resources
+func GetKubernetesContextDynamicClients(cmdData *CmdData, contextClients []*kube.ContextClient) (map[string]dynamic.Interface, error) {
+	res := map[string]dynamic.Interface{}
+	for _, contextClient := range contextClients {
+		kubeConfig, err := kube.GetKubeConfig(kube.KubeConfigOptions{Context: contextClient.ContextName, ConfigPath: *cmdData.KubeConfig})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get kube config for context %q: %s", contextClient.ContextName, err)
+		} else if kubeConfig == nil {
+			continue
+		}
+
+		dynamicClient, err := dynamic.NewForConfig(kubeConfig.Config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create dynamic client for context %q: %s", contextClient.ContextName, err)
+		}
+
+		res[contextClient.ContextName] = dynamicClient
+	}
+
+	return res, nil
+}
+
 func GetKubernetesContextClients(cmdData *CmdData) ([]*kube.ContextClient, error) {
 	var res []*kube.ContextClient
 	if contextClients, err := kube.GetAllContextsClients(kube.GetAllContextsClientsOptions{KubeConfig: *cmdData.KubeConfig}); err != nil {
@@ -19,6 +19,7 @@ import (
 
 	"github.com/werf/werf/pkg/build"
 	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/cleaning/allow_list"
 	"github.com/werf/werf/pkg/config"
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/docker_registry"
@@ -65,21 +66,29 @@ type CmdData struct {
 	CommonRepoData         *RepoData
 	StagesStorage          *string
 	SecondaryStagesStorage *[]string
+	CacheStagesStorage     *[]string
 
 	SkipBuild *bool
 	StubTags  *bool
 
-	Synchronization    *string
-	Parallel           *bool
-	ParallelTasksLimit *int64
+	Synchronization      *string
+	SynchronizationToken *string
+	Parallel             *bool
+	ParallelTasksLimit   *int64
 
 	DockerConfig                    *string
+	ContainerRuntime                *string
 	InsecureRegistry                *bool
 	SkipTlsVerifyRegistry           *bool
 	DryRun                          *bool
 	KeepStagesBuiltWithinLastNHours *uint64
 	WithoutKube                     *bool
 
+	UsedImagesManifestsDir  *[]string
+	UsedImagesList          *[]string
+	UsedImagesGitRepo       *[]string
+	UsedImagesGitRepoStrict *bool
+
 	LooseGiterminism *bool
 	Dev              *bool
 	DevMode          *string
@@ -88,6 +97,10 @@ type CmdData struct {
 	IntrospectAfterError  *bool
 	StagesToIntrospect    *[]string
 
+	StageFetchAttempts *int64
+	StageBuildAttempts *int64
+	StageStoreAttempts *int64
+
 	Follow *bool
 
 	LogDebug         *bool
@@ -100,12 +113,14 @@ type CmdData struct {
 
 	ReportPath   *string
 	ReportFormat *string
+	TracePath    *string
 
 	VirtualMerge           *bool
 	VirtualMergeFromCommit *string
 	VirtualMergeIntoCommit *string
 
 	ScanContextNamespaceOnly *bool
+	ScanResourceImages       *[]string
 
 	Tag *string
 
@@ -116,6 +131,9 @@ type CmdData struct {
 	AllowedDockerStorageVolumeUsageMargin *uint
 	AllowedLocalCacheVolumeUsage          *uint
 	AllowedLocalCacheVolumeUsageMargin    *uint
+	AllowedLocalCacheSize                 *string
+	ProjectQuota                          *[]string
+	DefaultProjectQuota                   *string
 }
 
 const (
@@ -228,14 +246,35 @@ func SetupReportFormat(cmdData *CmdData, cmd *cobra.Command) {
 			"DockerImageID": "<SHA256>",
 		},
 		...
-	  }
+	  },
+	  "Stages": [
+		{
+			"ImageName": "<WERF_IMAGE_NAME>",
+			"StageName": "<STAGE_NAME>",
+			"Digest": "<DIGEST>",
+			"Status": "cached|copied|built",
+			"Size": <BYTES>,
+			"SizeDelta": <BYTES>,
+			"Timings": [
+				{"Name": "<STEP>", "Start": "<TIME>", "DurationSeconds": <SECONDS>},
+				...
+			]
+		},
+		...
+	  ]
 	}
 %[2]s:
 	WERF_<FORMATTED_WERF_IMAGE_NAME>_DOCKER_IMAGE_NAME=<REPO>:<TAG>
 	...
 <FORMATTED_WERF_IMAGE_NAME> is werf image name from werf.yaml modified according to the following rules:
 - all characters are uppercase (app -> APP);
-- charset /- is replaced with _ (DEV/APP-FRONTEND -> DEV_APP_FRONTEND)`, string(build.ReportJSON), string(build.ReportEnvFile)))
+- charset /- is replaced with _ (DEV/APP-FRONTEND -> DEV_APP_FRONTEND)
+<STEP> is digest, lock, lookup, fetch, run, commit, docker-build or store.`, string(build.ReportJSON), string(build.ReportEnvFile)))
+}
+
+func SetupTracePath(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.TracePath = new(string)
+	cmd.Flags().StringVarP(cmdData.TracePath, "trace-path", "", os.Getenv("WERF_TRACE_PATH"), "Save the stage timings in the Chrome trace event format (chrome://tracing or Perfetto) to the specified path ($WERF_TRACE_PATH by default)")
 }
 
 func GetReportFormat(cmdData *CmdData) (build.ReportFormat, error) {
@@ -252,6 +291,23 @@ func SetupWithoutKube(cmdData *CmdData, cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(cmdData.WithoutKube, "without-kube", "", GetBoolEnvironmentDefaultFalse("WERF_WITHOUT_KUBE"), "Do not skip deployed Kubernetes images (default $WERF_WITHOUT_KUBE)")
 }
 
+func SetupUsedImagesSources(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.UsedImagesManifestsDir = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.UsedImagesManifestsDir, "used-images-manifests-dir", "", []string{}, `Do not delete images used in the manifests from the specified directory: rendered manifests or Helm release secrets exported from the clusters, which are not reachable by werf.
+Also, can be specified with $WERF_USED_IMAGES_MANIFESTS_DIR_* (e.g. $WERF_USED_IMAGES_MANIFESTS_DIR_1=..., $WERF_USED_IMAGES_MANIFESTS_DIR_2=...)`)
+
+	cmdData.UsedImagesList = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.UsedImagesList, "used-images-list", "", []string{}, `Do not delete images listed in the specified file or http(s) endpoint: JSON array or one image reference per line.
+Also, can be specified with $WERF_USED_IMAGES_LIST_* (e.g. $WERF_USED_IMAGES_LIST_1=..., $WERF_USED_IMAGES_LIST_2=...)`)
+
+	cmdData.UsedImagesGitRepo = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.UsedImagesGitRepo, "used-images-git-repo", "", []string{}, `Do not delete images used in Argo CD Applications, Flux HelmReleases and Kustomizations or plain manifests from the specified git repo: URL or local path with optional reference URL[#REF] (HEAD by default).
+Also, can be specified with $WERF_USED_IMAGES_GIT_REPO_* (e.g. $WERF_USED_IMAGES_GIT_REPO_1=..., $WERF_USED_IMAGES_GIT_REPO_2=...)`)
+
+	cmdData.UsedImagesGitRepoStrict = new(bool)
+	cmd.Flags().BoolVarP(cmdData.UsedImagesGitRepoStrict, "used-images-git-repo-strict", "", GetBoolEnvironmentDefaultFalse("WERF_USED_IMAGES_GIT_REPO_STRICT"), "Fail if a yaml or json file of --used-images-git-repo cannot be parsed instead of skipping it with a warning (default $WERF_USED_IMAGES_GIT_REPO_STRICT)")
+}
+
 func SetupKeepStagesBuiltWithinLastNHours(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.KeepStagesBuiltWithinLastNHours = new(uint64)
 
@@ -359,6 +415,13 @@ func SetupCommonRepoData(cmdData *CmdData, cmd *cobra.Command) {
 	SetupHarborUsernameForRepoData(cmdData.CommonRepoData, cmd, "repo-harbor-username", []string{"WERF_REPO_HARBOR_USERNAME"})
 	SetupHarborPasswordForRepoData(cmdData.CommonRepoData, cmd, "repo-harbor-password", []string{"WERF_REPO_HARBOR_PASSWORD"})
 	SetupQuayTokenForRepoData(cmdData.CommonRepoData, cmd, "repo-quay-token", []string{"WERF_REPO_QUAY_TOKEN"})
+	SetupArtifactoryUsernameForRepoData(cmdData.CommonRepoData, cmd, "repo-artifactory-username", []string{"WERF_REPO_ARTIFACTORY_USERNAME"})
+	SetupArtifactoryPasswordForRepoData(cmdData.CommonRepoData, cmd, "repo-artifactory-password", []string{"WERF_REPO_ARTIFACTORY_PASSWORD"})
+	SetupNexusUsernameForRepoData(cmdData.CommonRepoData, cmd, "repo-nexus-username", []string{"WERF_REPO_NEXUS_USERNAME"})
+	SetupNexusPasswordForRepoData(cmdData.CommonRepoData, cmd, "repo-nexus-password", []string{"WERF_REPO_NEXUS_PASSWORD"})
+	SetupYandexCrTokenForRepoData(cmdData.CommonRepoData, cmd, "repo-yandex-token", []string{"WERF_REPO_YANDEX_TOKEN"})
+	SetupS3EndpointForRepoData(cmdData.CommonRepoData, cmd, "repo-s3-endpoint", []string{"WERF_REPO_S3_ENDPOINT"})
+	SetupS3RegionForRepoData(cmdData.CommonRepoData, cmd, "repo-s3-region", []string{"WERF_REPO_S3_REGION", "AWS_REGION"})
 }
 
 func SetupSecondaryStagesStorageOptions(cmdData *CmdData, cmd *cobra.Command) {
@@ -367,6 +430,13 @@ func SetupSecondaryStagesStorageOptions(cmdData *CmdData, cmd *cobra.Command) {
 Also, can be specified with $WERF_SECONDARY_REPO_* (e.g. $WERF_SECONDARY_REPO_1=..., $WERF_SECONDARY_REPO_2=...)`)
 }
 
+func SetupCacheStagesStorageOptions(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.CacheStagesStorage = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.CacheStagesStorage, "cache-from-repo", "", []string{}, `Specify one or multiple read-only repos with images that will be used as a cache for the local stages storage (--repo=:local).
+The stages found in these repos are pulled only when needed: to build the following stages, to import files or as the final images.
+Also, can be specified with $WERF_CACHE_FROM_REPO_* (e.g. $WERF_CACHE_FROM_REPO_1=..., $WERF_CACHE_FROM_REPO_2=...)`)
+}
+
 func SetupStagesStorageOptions(cmdData *CmdData, cmd *cobra.Command) {
 	SetupInsecureRegistry(cmdData, cmd)
 	SetupSkipTlsVerifyRegistry(cmdData, cmd)
@@ -718,6 +788,25 @@ func SetupIntrospectAfterError(cmdData *CmdData, cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(cmdData.IntrospectAfterError, "introspect-error", "", false, "Introspect failed stage in the state, right after running failed assembly instruction")
 }
 
+func SetupStageRetryOptions(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.StageFetchAttempts = new(int64)
+	cmd.Flags().Int64VarP(cmdData.StageFetchAttempts, "stage-fetch-attempts", "", stageAttemptsDefaultValue("WERF_STAGE_FETCH_ATTEMPTS", 3), "Max attempts to pull the base image of the stage on transient errors: registry 5xx, docker daemon unavailability, network errors (default $WERF_STAGE_FETCH_ATTEMPTS or 3)")
+
+	cmdData.StageBuildAttempts = new(int64)
+	cmd.Flags().Int64VarP(cmdData.StageBuildAttempts, "stage-build-attempts", "", stageAttemptsDefaultValue("WERF_STAGE_BUILD_ATTEMPTS", 1), "Max attempts to build the stage on transient errors: docker daemon unavailability, network errors. Failed assembly instructions are never retried (default $WERF_STAGE_BUILD_ATTEMPTS or 1)")
+
+	cmdData.StageStoreAttempts = new(int64)
+	cmd.Flags().Int64VarP(cmdData.StageStoreAttempts, "stage-store-attempts", "", stageAttemptsDefaultValue("WERF_STAGE_STORE_ATTEMPTS", 3), "Max attempts to lock and push the built stage into the repo on transient errors: registry 5xx, network errors, lost lock lease. The built but not stored stage is reused by the next run (default $WERF_STAGE_STORE_ATTEMPTS or 3)")
+}
+
+func stageAttemptsDefaultValue(envName string, defaultValue int64) int64 {
+	if v := GetIntEnvVarStrict(envName); v != nil {
+		return *v
+	}
+
+	return defaultValue
+}
+
 func SetupIntrospectBeforeError(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.IntrospectBeforeError = new(bool)
 	cmd.Flags().BoolVarP(cmdData.IntrospectBeforeError, "introspect-before-error", "", false, "Introspect failed stage in the clean state, before running all assembly instructions of the stage")
@@ -895,7 +984,11 @@ func GetLocalStagesStorage(containerRuntime container_runtime.ContainerRuntime)
 }
 
 func GetStagesStorage(stagesStorageAddress string, containerRuntime container_runtime.ContainerRuntime, cmdData *CmdData) (storage.StagesStorage, error) {
-	if err := ValidateRepoContainerRegistry(cmdData.CommonRepoData.GetContainerRegistry()); err != nil {
+	return GetStagesStorageWithRepoData(stagesStorageAddress, containerRuntime, cmdData, cmdData.CommonRepoData)
+}
+
+func GetStagesStorageWithRepoData(stagesStorageAddress string, containerRuntime container_runtime.ContainerRuntime, cmdData *CmdData, repoData *RepoData) (storage.StagesStorage, error) {
+	if err := ValidateRepoContainerRegistry(repoData.GetContainerRegistry()); err != nil {
 		return nil, err
 	}
 
@@ -904,26 +997,36 @@ func GetStagesStorage(stagesStorageAddress string, containerRuntime container_ru
 		containerRuntime,
 		storage.StagesStorageOptions{
 			RepoStagesStorageOptions: storage.RepoStagesStorageOptions{
-				ContainerRegistry: cmdData.CommonRepoData.GetContainerRegistry(),
+				ContainerRegistry: repoData.GetContainerRegistry(),
 				DockerRegistryOptions: docker_registry.DockerRegistryOptions{
 					InsecureRegistry:      *cmdData.InsecureRegistry,
 					SkipTlsVerifyRegistry: *cmdData.SkipTlsVerifyRegistry,
-					DockerHubUsername:     *cmdData.CommonRepoData.DockerHubUsername,
-					DockerHubPassword:     *cmdData.CommonRepoData.DockerHubPassword,
-					DockerHubToken:        *cmdData.CommonRepoData.DockerHubToken,
-					GitHubToken:           *cmdData.CommonRepoData.GitHubToken,
-					HarborUsername:        *cmdData.CommonRepoData.HarborUsername,
-					HarborPassword:        *cmdData.CommonRepoData.HarborPassword,
-					QuayToken:             *cmdData.CommonRepoData.QuayToken,
+					DockerHubUsername:     *repoData.DockerHubUsername,
+					DockerHubPassword:     *repoData.DockerHubPassword,
+					DockerHubToken:        *repoData.DockerHubToken,
+					GitHubToken:           *repoData.GitHubToken,
+					HarborUsername:        *repoData.HarborUsername,
+					HarborPassword:        *repoData.HarborPassword,
+					QuayToken:             *repoData.QuayToken,
+					ArtifactoryUsername:   *repoData.ArtifactoryUsername,
+					ArtifactoryPassword:   *repoData.ArtifactoryPassword,
+					NexusUsername:         *repoData.NexusUsername,
+					NexusPassword:         *repoData.NexusPassword,
+					YandexCrToken:         *repoData.YandexCrToken,
 				},
 			},
+			S3StagesStorageOptions: storage.S3StagesStorageOptions{
+				Endpoint: *repoData.S3Endpoint,
+				Region:   *repoData.S3Region,
+			},
 		},
 	)
 }
 
 func GetSecondaryStagesStorageList(stagesStorage storage.StagesStorage, containerRuntime container_runtime.ContainerRuntime, cmdData *CmdData) ([]storage.StagesStorage, error) {
 	var res []storage.StagesStorage
-	if stagesStorage.Address() != storage.LocalStorageAddress {
+	// the local stages storage is only available with the local docker server
+	if _, ok := containerRuntime.(*container_runtime.LocalDockerServerRuntime); ok && stagesStorage.Address() != storage.LocalStorageAddress {
 		localStagesStorage, err := storage.NewStagesStorage(storage.LocalStorageAddress, containerRuntime, storage.StagesStorageOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("unable to create local secondary stages storage: %s", err)
@@ -942,6 +1045,35 @@ func GetSecondaryStagesStorageList(stagesStorage storage.StagesStorage, containe
 	return res, nil
 }
 
+func GetCacheStagesStorageList(stagesStorage storage.StagesStorage, containerRuntime container_runtime.ContainerRuntime, cmdData *CmdData) ([]storage.StagesStorage, error) {
+	addresses := GetCacheStagesStorage(cmdData)
+	if len(addresses) == 0 {
+		return nil, nil
+	}
+
+	if stagesStorage.Address() != storage.LocalStorageAddress {
+		return nil, fmt.Errorf("--cache-from-repo can be used only with the local stages storage (--repo=%s), use --secondary-repo for the %s", storage.LocalStorageAddress, stagesStorage.String())
+	}
+
+	var res []storage.StagesStorage
+	for _, address := range addresses {
+		repoStagesStorage, err := storage.NewStagesStorage(address, containerRuntime, storage.StagesStorageOptions{
+			RepoStagesStorageOptions: storage.RepoStagesStorageOptions{
+				DockerRegistryOptions: docker_registry.DockerRegistryOptions{
+					InsecureRegistry:      *cmdData.InsecureRegistry,
+					SkipTlsVerifyRegistry: *cmdData.SkipTlsVerifyRegistry,
+				},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create cache stages storage at %s: %s", address, err)
+		}
+		res = append(res, repoStagesStorage)
+	}
+
+	return res, nil
+}
+
 func GetOptionalWerfConfig(ctx context.Context, cmdData *CmdData, giterminismManager giterminism_manager.Interface, opts config.WerfConfigOptions) (*config.WerfConfig, error) {
 	customWerfConfigRelPath, err := GetCustomWerfConfigRelPath(giterminismManager, cmdData)
 	if err != nil {
@@ -1020,6 +1152,15 @@ func GetWerfConfigOptions(cmdData *CmdData, LogRenderedFilePath bool) config.Wer
 }
 
 func GetGiterminismManager(cmdData *CmdData) (giterminism_manager.Interface, error) {
+	return getGiterminismManager(cmdData, "")
+}
+
+// GetGiterminismManagerForCommit returns the giterminism manager for the specified revision of the project git repo instead of HEAD, the dev mode is not applicable
+func GetGiterminismManagerForCommit(cmdData *CmdData, rev string) (giterminism_manager.Interface, error) {
+	return getGiterminismManager(cmdData, rev)
+}
+
+func getGiterminismManager(cmdData *CmdData, rev string) (giterminism_manager.Interface, error) {
 	workingDir := GetWorkingDir(cmdData)
 
 	gitWorkTree, err := GetGitWorkTree(cmdData, workingDir)
@@ -1038,8 +1179,10 @@ func GetGiterminismManager(cmdData *CmdData) (giterminism_manager.Interface, err
 		return nil, err
 	}
 
+	isDev := *cmdData.Dev && rev == ""
+
 	var openLocalRepoOptions git_repo.OpenLocalRepoOptions
-	if *cmdData.Dev {
+	if isDev {
 		openLocalRepoOptions.WithServiceHeadCommit = true
 		openLocalRepoOptions.ServiceHeadCommitOptions.WithStagedChangesOnly = devMode == "strict"
 	}
@@ -1049,14 +1192,19 @@ func GetGiterminismManager(cmdData *CmdData) (giterminism_manager.Interface, err
 		return nil, err
 	}
 
-	headCommit, err := localGitRepo.HeadCommit(BackgroundContext())
+	var headCommit string
+	if rev == "" {
+		headCommit, err = localGitRepo.HeadCommit(BackgroundContext())
+	} else {
+		headCommit, err = localGitRepo.ResolveCommit(BackgroundContext(), rev)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return giterminism_manager.NewManager(BackgroundContext(), workingDir, localGitRepo, headCommit, giterminism_manager.NewManagerOptions{
 		LooseGiterminism: *cmdData.LooseGiterminism,
-		Dev:              *cmdData.Dev,
+		Dev:              isDev,
 		DevMode:          devMode,
 	})
 }
@@ -1132,6 +1280,25 @@ func GetSecondaryStagesStorage(cmdData *CmdData) []string {
 	return append(predefinedValuesByEnvNamePrefix("WERF_SECONDARY_REPO_"), *cmdData.SecondaryStagesStorage...)
 }
 
+func GetCacheStagesStorage(cmdData *CmdData) []string {
+	return append(predefinedValuesByEnvNamePrefix("WERF_CACHE_FROM_REPO_"), *cmdData.CacheStagesStorage...)
+}
+
+func GetUsedImagesSources(cmdData *CmdData) []allow_list.UsedImagesSource {
+	var sources []allow_list.UsedImagesSource
+	for _, dir := range append(predefinedValuesByEnvNamePrefix("WERF_USED_IMAGES_MANIFESTS_DIR_"), *cmdData.UsedImagesManifestsDir...) {
+		sources = append(sources, allow_list.NewManifestsDirSource(dir))
+	}
+	for _, address := range append(predefinedValuesByEnvNamePrefix("WERF_USED_IMAGES_LIST_"), *cmdData.UsedImagesList...) {
+		sources = append(sources, allow_list.NewImageListSource(address))
+	}
+	for _, address := range append(predefinedValuesByEnvNamePrefix("WERF_USED_IMAGES_GIT_REPO_"), *cmdData.UsedImagesGitRepo...) {
+		sources = append(sources, allow_list.NewGitRepoSource(address, *cmdData.UsedImagesGitRepoStrict))
+	}
+
+	return sources
+}
+
 func GetSet(cmdData *CmdData) []string {
 	return append(predefinedValuesByEnvNamePrefix("WERF_SET_", "WERF_SET_STRING_", "WERF_SET_FILE_"), *cmdData.Set...)
 }
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/werf/werf/pkg/buildah"
+	"github.com/werf/werf/pkg/container_runtime"
+)
+
+const (
+	ContainerRuntimeDocker  = "docker"
+	ContainerRuntimeBuildah = "buildah"
+)
+
+func SetupContainerRuntime(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ContainerRuntime = new(string)
+	cmd.Flags().StringVarP(cmdData.ContainerRuntime, "container-runtime", "", os.Getenv("WERF_CONTAINER_RUNTIME"), fmt.Sprintf(`Container runtime to build, fetch and store stage images: %q or %q. The %s runtime builds dockerfile and stapel images without docker daemon (in the rootless containers-storage) and requires --repo (default %s or $WERF_CONTAINER_RUNTIME)`, ContainerRuntimeDocker, ContainerRuntimeBuildah, ContainerRuntimeBuildah, ContainerRuntimeDocker))
+}
+
+func IsBuildahContainerRuntime(cmdData *CmdData) bool {
+	return cmdData.ContainerRuntime != nil && *cmdData.ContainerRuntime == ContainerRuntimeBuildah
+}
+
+// GetContainerRuntime initializes the selected container runtime, docker is used by default
+func GetContainerRuntime(ctx context.Context, cmdData *CmdData) (container_runtime.ContainerRuntime, error) {
+	var containerRuntime string
+	if cmdData.ContainerRuntime != nil {
+		containerRuntime = *cmdData.ContainerRuntime
+	}
+
+	switch containerRuntime {
+	case "", ContainerRuntimeDocker:
+		return &container_runtime.LocalDockerServerRuntime{}, nil
+	case ContainerRuntimeBuildah:
+		if err := buildah.Init(ctx, buildah.Options{Verbose: *cmdData.LogVerbose, Debug: *cmdData.LogDebug}); err != nil {
+			return nil, fmt.Errorf("unable to init buildah container runtime: %s", err)
+		}
+		return &container_runtime.BuildahRuntime{}, nil
+	default:
+		return nil, fmt.Errorf("bad --container-runtime given %q, expected: %q or %q", containerRuntime, ContainerRuntimeDocker, ContainerRuntimeBuildah)
+	}
+}
@@ -50,8 +50,14 @@ func GetBuildOptions(commonCmdData *CmdData, werfConfig *config.WerfConfig) (bui
 			IntrospectBeforeError: *commonCmdData.IntrospectBeforeError,
 		},
 		IntrospectOptions: introspectOptions,
-		ReportPath:        *commonCmdData.ReportPath,
-		ReportFormat:      reportFormat,
+		StageRetryOptions: build.StageRetryOptions{
+			FetchAttempts: int(*commonCmdData.StageFetchAttempts),
+			BuildAttempts: int(*commonCmdData.StageBuildAttempts),
+			StoreAttempts: int(*commonCmdData.StageStoreAttempts),
+		},
+		ReportPath:   *commonCmdData.ReportPath,
+		ReportFormat: reportFormat,
+		TracePath:    *commonCmdData.TracePath,
 	}
 
 	return buildOptions, nil
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 	"github.com/werf/werf/pkg/host_cleaning"
 )
@@ -30,6 +31,7 @@ func RunAutoHostCleanup(ctx context.Context, cmdData *CmdData) error {
 		AllowedLocalCacheVolumeUsagePercentage:          cmdData.AllowedLocalCacheVolumeUsage,
 		AllowedLocalCacheVolumeUsageMarginPercentage:    cmdData.AllowedLocalCacheVolumeUsageMargin,
 		DockerServerStoragePath:                         *cmdData.DockerServerStoragePath,
+		SkipLocalDockerServer:                           IsBuildahContainerRuntime(cmdData),
 	})
 }
 
@@ -110,3 +112,40 @@ func SetupAllowedLocalCacheVolumeUsageMargin(cmdData *CmdData, cmd *cobra.Comman
 	cmdData.AllowedLocalCacheVolumeUsageMargin = new(uint)
 	cmd.Flags().UintVarP(cmdData.AllowedLocalCacheVolumeUsageMargin, "allowed-local-cache-volume-usage-margin", "", defaultVal, fmt.Sprintf("During cleanup of least recently used local docker images werf would delete images until volume usage becomes below \"allowed-docker-storage-volume-usage - allowed-docker-storage-volume-usage-margin\" level (default %d%% or $%s)", uint(host_cleaning.DefaultAllowedLocalCacheVolumeUsageMarginPercentage), envVarName))
 }
+
+func SetupAllowedLocalCacheSize(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.AllowedLocalCacheSize = new(string)
+	cmd.Flags().StringVarP(cmdData.AllowedLocalCacheSize, "allowed-local-cache-size", "", os.Getenv("WERF_ALLOWED_LOCAL_CACHE_SIZE"), "Set allowed total size of git data, manifests and helm chart dependencies in the local cache (e.g. 50GB): least recently used entries are deleted until the size becomes below the allowed size (no limit by default or $WERF_ALLOWED_LOCAL_CACHE_SIZE)")
+}
+
+func GetAllowedLocalCacheSize(cmdData *CmdData) (uint64, error) {
+	if *cmdData.AllowedLocalCacheSize == "" {
+		return 0, nil
+	}
+
+	size, err := humanize.ParseBytes(*cmdData.AllowedLocalCacheSize)
+	if err != nil {
+		return 0, fmt.Errorf("bad --allowed-local-cache-size=%s given: %s", *cmdData.AllowedLocalCacheSize, err)
+	}
+
+	return size, nil
+}
+
+func SetupProjectQuotas(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ProjectQuota = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.ProjectQuota, "project-quota", "", []string{}, `Set quota for the docker images and the local cache entries of the project: PROJECT=SIZE (e.g. myproject=20GB).
+Least recently used images and local cache entries of the project are deleted until the project usage becomes below the quota.
+Also, can be specified with $WERF_PROJECT_QUOTA_* (e.g. $WERF_PROJECT_QUOTA_1=..., $WERF_PROJECT_QUOTA_2=...)`)
+
+	cmdData.DefaultProjectQuota = new(string)
+	cmd.Flags().StringVarP(cmdData.DefaultProjectQuota, "default-project-quota", "", os.Getenv("WERF_DEFAULT_PROJECT_QUOTA"), "Set quota for the docker images and the local cache entries of each project not specified with --project-quota (e.g. 10GB, no quota by default or $WERF_DEFAULT_PROJECT_QUOTA)")
+}
+
+func GetProjectQuotas(cmdData *CmdData) (host_cleaning.ProjectQuotas, error) {
+	projectQuotas, err := host_cleaning.ParseProjectQuotas(*cmdData.DefaultProjectQuota, append(predefinedValuesByEnvNamePrefix("WERF_PROJECT_QUOTA_"), *cmdData.ProjectQuota...))
+	if err != nil {
+		return host_cleaning.ProjectQuotas{}, fmt.Errorf("bad project quotas given: %s", err)
+	}
+
+	return projectQuotas, nil
+}
@@ -16,15 +16,22 @@ type RepoData struct {
 	IsCommon               bool
 	DesignationStorageName string
 
-	Implementation    *string // legacy
-	ContainerRegistry *string
-	DockerHubUsername *string
-	DockerHubPassword *string
-	DockerHubToken    *string
-	GitHubToken       *string
-	HarborUsername    *string
-	HarborPassword    *string
-	QuayToken         *string
+	Implementation      *string // legacy
+	ContainerRegistry   *string
+	DockerHubUsername   *string
+	DockerHubPassword   *string
+	DockerHubToken      *string
+	GitHubToken         *string
+	HarborUsername      *string
+	HarborPassword      *string
+	QuayToken           *string
+	ArtifactoryUsername *string
+	ArtifactoryPassword *string
+	NexusUsername       *string
+	NexusPassword       *string
+	YandexCrToken       *string
+	S3Endpoint          *string
+	S3Region            *string
 }
 
 func (d *RepoData) GetContainerRegistry() string {
@@ -67,11 +74,54 @@ func MergeRepoData(repoDataArr ...*RepoData) *RepoData {
 		if res.QuayToken == nil || *res.QuayToken == "" {
 			res.QuayToken = repoData.QuayToken
 		}
+		if res.ArtifactoryUsername == nil || *res.ArtifactoryUsername == "" {
+			res.ArtifactoryUsername = repoData.ArtifactoryUsername
+		}
+		if res.ArtifactoryPassword == nil || *res.ArtifactoryPassword == "" {
+			res.ArtifactoryPassword = repoData.ArtifactoryPassword
+		}
+		if res.NexusUsername == nil || *res.NexusUsername == "" {
+			res.NexusUsername = repoData.NexusUsername
+		}
+		if res.NexusPassword == nil || *res.NexusPassword == "" {
+			res.NexusPassword = repoData.NexusPassword
+		}
+		if res.YandexCrToken == nil || *res.YandexCrToken == "" {
+			res.YandexCrToken = repoData.YandexCrToken
+		}
+		if res.S3Endpoint == nil || *res.S3Endpoint == "" {
+			res.S3Endpoint = repoData.S3Endpoint
+		}
+		if res.S3Region == nil || *res.S3Region == "" {
+			res.S3Region = repoData.S3Region
+		}
 	}
 
 	return res
 }
 
+// SetupRepoData sets up the options of the non-common repo with the specified prefixes,
+// e.g. --from-repo-container-registry ($WERF_FROM_REPO_CONTAINER_REGISTRY) for the "from-repo" param name prefix.
+func SetupRepoData(repoData *RepoData, cmd *cobra.Command, paramNamePrefix, envNamePrefix string) {
+	repoData.Implementation = new(string)
+
+	SetupContainerRegistryForRepoData(repoData, cmd, paramNamePrefix+"-container-registry", []string{envNamePrefix + "_CONTAINER_REGISTRY"})
+	SetupDockerHubUsernameForRepoData(repoData, cmd, paramNamePrefix+"-docker-hub-username", []string{envNamePrefix + "_DOCKER_HUB_USERNAME"})
+	SetupDockerHubPasswordForRepoData(repoData, cmd, paramNamePrefix+"-docker-hub-password", []string{envNamePrefix + "_DOCKER_HUB_PASSWORD"})
+	SetupDockerHubTokenForRepoData(repoData, cmd, paramNamePrefix+"-docker-hub-token", []string{envNamePrefix + "_DOCKER_HUB_TOKEN"})
+	SetupGithubTokenForRepoData(repoData, cmd, paramNamePrefix+"-github-token", []string{envNamePrefix + "_GITHUB_TOKEN"})
+	SetupHarborUsernameForRepoData(repoData, cmd, paramNamePrefix+"-harbor-username", []string{envNamePrefix + "_HARBOR_USERNAME"})
+	SetupHarborPasswordForRepoData(repoData, cmd, paramNamePrefix+"-harbor-password", []string{envNamePrefix + "_HARBOR_PASSWORD"})
+	SetupQuayTokenForRepoData(repoData, cmd, paramNamePrefix+"-quay-token", []string{envNamePrefix + "_QUAY_TOKEN"})
+	SetupArtifactoryUsernameForRepoData(repoData, cmd, paramNamePrefix+"-artifactory-username", []string{envNamePrefix + "_ARTIFACTORY_USERNAME"})
+	SetupArtifactoryPasswordForRepoData(repoData, cmd, paramNamePrefix+"-artifactory-password", []string{envNamePrefix + "_ARTIFACTORY_PASSWORD"})
+	SetupNexusUsernameForRepoData(repoData, cmd, paramNamePrefix+"-nexus-username", []string{envNamePrefix + "_NEXUS_USERNAME"})
+	SetupNexusPasswordForRepoData(repoData, cmd, paramNamePrefix+"-nexus-password", []string{envNamePrefix + "_NEXUS_PASSWORD"})
+	SetupYandexCrTokenForRepoData(repoData, cmd, paramNamePrefix+"-yandex-token", []string{envNamePrefix + "_YANDEX_TOKEN"})
+	SetupS3EndpointForRepoData(repoData, cmd, paramNamePrefix+"-s3-endpoint", []string{envNamePrefix + "_S3_ENDPOINT"})
+	SetupS3RegionForRepoData(repoData, cmd, paramNamePrefix+"-s3-region", []string{envNamePrefix + "_S3_REGION"})
+}
+
 // legacy
 func SetupImplementationForRepoData(repoData *RepoData, cmd *cobra.Command, paramName string, paramEnvNames []string) {
 	repoData.Implementation = new(string)
@@ -235,6 +285,132 @@ func SetupQuayTokenForRepoData(repoData *RepoData, cmd *cobra.Command, paramName
 	)
 }
 
+func SetupArtifactoryUsernameForRepoData(repoData *RepoData, cmd *cobra.Command, paramName string, paramEnvNames []string) {
+	var usage string
+	if repoData.IsCommon {
+		usage = fmt.Sprintf("JFrog Artifactory username (default %s)", strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	} else {
+		usage = fmt.Sprintf("JFrog Artifactory username for %s (default %s)", repoData.DesignationStorageName, strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	}
+
+	repoData.ArtifactoryUsername = new(string)
+	cmd.Flags().StringVarP(
+		repoData.ArtifactoryUsername,
+		paramName,
+		"",
+		getDefaultValueByParamEnvNames(paramEnvNames),
+		usage,
+	)
+}
+
+func SetupArtifactoryPasswordForRepoData(repoData *RepoData, cmd *cobra.Command, paramName string, paramEnvNames []string) {
+	var usage string
+	if repoData.IsCommon {
+		usage = fmt.Sprintf("JFrog Artifactory password or API key (default %s)", strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	} else {
+		usage = fmt.Sprintf("JFrog Artifactory password or API key for %s (default %s)", repoData.DesignationStorageName, strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	}
+
+	repoData.ArtifactoryPassword = new(string)
+	cmd.Flags().StringVarP(
+		repoData.ArtifactoryPassword,
+		paramName,
+		"",
+		getDefaultValueByParamEnvNames(paramEnvNames),
+		usage,
+	)
+}
+
+func SetupNexusUsernameForRepoData(repoData *RepoData, cmd *cobra.Command, paramName string, paramEnvNames []string) {
+	var usage string
+	if repoData.IsCommon {
+		usage = fmt.Sprintf("Sonatype Nexus username (default %s)", strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	} else {
+		usage = fmt.Sprintf("Sonatype Nexus username for %s (default %s)", repoData.DesignationStorageName, strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	}
+
+	repoData.NexusUsername = new(string)
+	cmd.Flags().StringVarP(
+		repoData.NexusUsername,
+		paramName,
+		"",
+		getDefaultValueByParamEnvNames(paramEnvNames),
+		usage,
+	)
+}
+
+func SetupNexusPasswordForRepoData(repoData *RepoData, cmd *cobra.Command, paramName string, paramEnvNames []string) {
+	var usage string
+	if repoData.IsCommon {
+		usage = fmt.Sprintf("Sonatype Nexus password (default %s)", strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	} else {
+		usage = fmt.Sprintf("Sonatype Nexus password for %s (default %s)", repoData.DesignationStorageName, strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	}
+
+	repoData.NexusPassword = new(string)
+	cmd.Flags().StringVarP(
+		repoData.NexusPassword,
+		paramName,
+		"",
+		getDefaultValueByParamEnvNames(paramEnvNames),
+		usage,
+	)
+}
+
+func SetupYandexCrTokenForRepoData(repoData *RepoData, cmd *cobra.Command, paramName string, paramEnvNames []string) {
+	var usage string
+	if repoData.IsCommon {
+		usage = fmt.Sprintf("Yandex Cloud IAM token (default %s)", strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	} else {
+		usage = fmt.Sprintf("Yandex Cloud IAM token for %s (default %s)", repoData.DesignationStorageName, strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	}
+
+	repoData.YandexCrToken = new(string)
+	cmd.Flags().StringVarP(
+		repoData.YandexCrToken,
+		paramName,
+		"",
+		getDefaultValueByParamEnvNames(paramEnvNames),
+		usage,
+	)
+}
+
+func SetupS3EndpointForRepoData(repoData *RepoData, cmd *cobra.Command, paramName string, paramEnvNames []string) {
+	var usage string
+	if repoData.IsCommon {
+		usage = fmt.Sprintf("S3-compatible storage endpoint for s3://BUCKET[/PREFIX] repo, e.g. http://minio:9000 (default %s)", strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	} else {
+		usage = fmt.Sprintf("S3-compatible storage endpoint for %s (default %s)", repoData.DesignationStorageName, strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	}
+
+	repoData.S3Endpoint = new(string)
+	cmd.Flags().StringVarP(
+		repoData.S3Endpoint,
+		paramName,
+		"",
+		getDefaultValueByParamEnvNames(paramEnvNames),
+		usage,
+	)
+}
+
+func SetupS3RegionForRepoData(repoData *RepoData, cmd *cobra.Command, paramName string, paramEnvNames []string) {
+	var usage string
+	if repoData.IsCommon {
+		usage = fmt.Sprintf("S3 region for s3://BUCKET[/PREFIX] repo (default %s or us-east-1)", strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	} else {
+		usage = fmt.Sprintf("S3 region for %s (default %s or us-east-1)", repoData.DesignationStorageName, strings.Join(getParamEnvNamesForUsageDescription(paramEnvNames), ", "))
+	}
+
+	repoData.S3Region = new(string)
+	cmd.Flags().StringVarP(
+		repoData.S3Region,
+		paramName,
+		"",
+		getDefaultValueByParamEnvNames(paramEnvNames),
+		usage,
+	)
+}
+
 func getDefaultValueByParamEnvNames(paramEnvNames []string) string {
 	var defaultValue string
 	for _, paramEnvName := range paramEnvNames {
@@ -6,6 +6,8 @@ import (
 	"os"
 	"strings"
 
+	"github.com/go-redis/redis/v7"
+
 	"github.com/werf/werf/pkg/werf/global_warnings"
 
 	"github.com/werf/werf/pkg/werf/locker_with_retry"
@@ -39,7 +41,11 @@ Default:
  - :local if --repo is not specified, or
  - %s if --repo has been specified.
 
-The same address should be specified for all werf processes that work with a single repo. :local address allows execution of werf processes from a single host only`, storage.DefaultHttpSynchronizationServer))
+The same address should be specified for all werf processes that work with a single repo. :local address allows execution of werf processes from a single host only.
+redis[s]://[:PASSWORD@]HOST[:PORT][/DB] address allows using own redis server for the synchronization`, storage.DefaultHttpSynchronizationServer))
+
+	cmdData.SynchronizationToken = new(string)
+	cmd.Flags().StringVarP(cmdData.SynchronizationToken, "synchronization-token", "", os.Getenv("WERF_SYNCHRONIZATION_TOKEN"), "Bearer token for the http synchronization server with enabled auth (default $WERF_SYNCHRONIZATION_TOKEN)")
 }
 
 type SynchronizationType string
@@ -48,12 +54,15 @@ const (
 	LocalSynchronization      SynchronizationType = "LocalSynchronization"
 	KubernetesSynchronization SynchronizationType = "KubernetesSynchronization"
 	HttpSynchronization       SynchronizationType = "HttpSynchronization"
+	RedisSynchronization      SynchronizationType = "RedisSynchronization"
 )
 
 type SynchronizationParams struct {
 	Address             string
+	Token               string
 	SynchronizationType SynchronizationType
 	KubeParams          *storage.KubernetesSynchronizationParams
+	RedisOptions        *redis.Options
 }
 
 func checkSynchronizationKubernetesParamsForWarnings(cmdData *CmdData) {
@@ -125,7 +134,7 @@ func GetSynchronization(ctx context.Context, cmdData *CmdData, projectName strin
 		var address string
 		if err := logboek.Default().LogProcess(fmt.Sprintf("Getting client id for the http synchronization server")).
 			DoError(func() error {
-				if clientID, err := synchronization_server.GetOrCreateClientID(ctx, projectName, synchronization_server.NewSynchronizationClient(synchronization), stagesStorage); err != nil {
+				if clientID, err := synchronization_server.GetOrCreateClientID(ctx, projectName, synchronization_server.NewSynchronizationClient(synchronization, *cmdData.SynchronizationToken), stagesStorage); err != nil {
 					return fmt.Errorf("unable to get synchronization client id: %s", err)
 				} else {
 					address = fmt.Sprintf("%s/%s", synchronization, clientID)
@@ -136,7 +145,7 @@ func GetSynchronization(ctx context.Context, cmdData *CmdData, projectName strin
 			return nil, err
 		}
 
-		return &SynchronizationParams{Address: address, SynchronizationType: HttpSynchronization}, nil
+		return &SynchronizationParams{Address: address, Token: *cmdData.SynchronizationToken, SynchronizationType: HttpSynchronization}, nil
 	}
 
 	if *cmdData.Synchronization == "" {
@@ -152,8 +161,14 @@ func GetSynchronization(ctx context.Context, cmdData *CmdData, projectName strin
 		return getKubeParamsFunc(*cmdData.Synchronization)
 	} else if strings.HasPrefix(*cmdData.Synchronization, "http://") || strings.HasPrefix(*cmdData.Synchronization, "https://") {
 		return getHttpParamsFunc(*cmdData.Synchronization, stagesStorage)
+	} else if storage.IsRedisSynchronization(*cmdData.Synchronization) {
+		if options, err := storage.ParseRedisSynchronization(*cmdData.Synchronization); err != nil {
+			return nil, fmt.Errorf("unable to parse synchronization address %s: %s", *cmdData.Synchronization, err)
+		} else {
+			return &SynchronizationParams{Address: *cmdData.Synchronization, SynchronizationType: RedisSynchronization, RedisOptions: options}, nil
+		}
 	} else {
-		return nil, fmt.Errorf("only --synchronization=%s or --synchronization=kubernetes://NAMESPACE or --synchronization=http[s]://HOST:PORT/CLIENT_ID is supported, got %q", storage.LocalStorageAddress, *cmdData.Synchronization)
+		return nil, fmt.Errorf("only --synchronization=%s or --synchronization=kubernetes://NAMESPACE or --synchronization=http[s]://HOST:PORT/CLIENT_ID or --synchronization=redis[s]://HOST:PORT[/DB] is supported, got %q", storage.LocalStorageAddress, *cmdData.Synchronization)
 	}
 }
 
@@ -176,7 +191,9 @@ func GetStagesStorageCache(synchronization *SynchronizationParams) (storage.Stag
 			}), nil
 		}
 	case HttpSynchronization:
-		return synchronization_server.NewStagesStorageCacheHttpClient(fmt.Sprintf("%s/stages-storage-cache", synchronization.Address)), nil
+		return synchronization_server.NewStagesStorageCacheHttpClient(fmt.Sprintf("%s/stages-storage-cache", synchronization.Address), synchronization.Token), nil
+	case RedisSynchronization:
+		return storage.NewRedisStagesStorageCache(redis.NewClient(synchronization.RedisOptions)), nil
 	default:
 		panic(fmt.Sprintf("unsupported synchronization address %q", synchronization.Address))
 	}
@@ -203,9 +220,13 @@ func GetStorageLockManager(ctx context.Context, synchronization *Synchronization
 			}), nil
 		}
 	case HttpSynchronization:
-		locker := distributed_locker.NewHttpLocker(fmt.Sprintf("%s/locker", synchronization.Address))
+		backend := distributed_locker.NewHttpBackend(fmt.Sprintf("%s/locker", synchronization.Address))
+		backend.HttpClient = synchronization_server.NewHttpClient(synchronization.Token)
+		locker := distributed_locker.NewDistributedLocker(backend)
 		lockerWithRetry := locker_with_retry.NewLockerWithRetry(ctx, locker, locker_with_retry.LockerWithRetryOptions{MaxAcquireAttempts: 10, MaxReleaseAttempts: 10})
 		return storage.NewGenericLockManager(lockerWithRetry), nil
+	case RedisSynchronization:
+		return storage.NewRedisLockManager(ctx, redis.NewClient(synchronization.RedisOptions)), nil
 	default:
 		panic(fmt.Sprintf("unsupported synchronization address %q", synchronization.Address))
 	}
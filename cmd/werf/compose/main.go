@@ -168,6 +168,7 @@ Image environment name format: $WERF_<FORMATTED_WERF_IMAGE_NAME>_DOCKER_IMAGE_NA
 	common.SetupSSHKey(&commonCmdData, cmd)
 
 	common.SetupSecondaryStagesStorageOptions(&commonCmdData, cmd)
+	common.SetupCacheStagesStorageOptions(&commonCmdData, cmd)
 	common.SetupStagesStorageOptions(&commonCmdData, cmd)
 
 	common.SetupSkipBuild(&commonCmdData, cmd)
@@ -353,8 +354,13 @@ func run(ctx context.Context, giterminismManager giterminism_manager.Interface,
 	if err != nil {
 		return err
 	}
+	cacheStagesStorageList, err := common.GetCacheStagesStorageList(stagesStorage, containerRuntime, &commonCmdData)
+	if err != nil {
+		return err
+	}
 
 	storageManager := manager.NewStorageManager(projectName, stagesStorage, secondaryStagesStorageList, storageLockManager, stagesStorageCache)
+	storageManager.CacheStagesStorageList = cacheStagesStorageList
 
 	logboek.Context(ctx).Info().LogOptionalLn()
 
@@ -161,7 +161,7 @@ permalink: reference/cli/%s.html
 	}
 
 	for _, command := range cmd.Commands() {
-		if cmd.Hidden {
+		if command.Hidden {
 			continue
 		}
 
@@ -241,7 +241,7 @@ func genCliSidebar(cmd *cobra.Command, indent int, buf *bytes.Buffer) error {
 
 		indent += 1
 		for _, command := range cmd.Commands() {
-			if cmd.Hidden {
+			if command.Hidden {
 				continue
 			}
 
@@ -276,11 +276,14 @@ toc: false
 				continue
 			}
 
-			var fullCommandName string
-			if len(cmd.Commands()) == 0 {
-				fullCommandName = fullCommandFilesystemPath(cmd.CommandPath())
-			} else {
-				fullCommandName = fullCommandFilesystemPath(cmd.Commands()[0].CommandPath())
+			fullCommandName := fullCommandFilesystemPath(cmd.CommandPath())
+			for _, command := range cmd.Commands() {
+				if command.Hidden {
+					continue
+				}
+
+				fullCommandName = fullCommandFilesystemPath(command.CommandPath())
+				break
 			}
 
 			indexPage += fmt.Sprintf(" - [werf %s]({{ \"/reference/cli/%s.html\" | true_relative_url }}) — {%% include /reference/cli/%s.short.md %%}.\n", cmd.Name(), fullCommandName, fullCommandName)
@@ -299,7 +302,7 @@ toc: false
 
 func GenCliPartials(cmd *cobra.Command, dir string) error {
 	for _, c := range cmd.Commands() {
-		if cmd.Hidden {
+		if c.Hidden {
 			continue
 		}
 
@@ -2,6 +2,8 @@ package cleanup
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -23,6 +25,10 @@ var commonCmdData common.CmdData
 
 var cmdData struct {
 	Force bool
+
+	Daemon         bool
+	DaemonInterval time.Duration
+	DecisionsLog   string
 }
 
 func NewCmd() *cobra.Command {
@@ -37,8 +43,15 @@ The data include:
 * Local cache:
   * Remote git clones cache.
   * Git worktree cache.
+  * Git archives and patches cache.
+  * Images manifests cache.
+  * Helm chart dependencies cache.
+
+It is safe to run this command periodically by automated cleanup job in parallel with other werf commands such as build, converge and cleanup.
 
-It is safe to run this command periodically by automated cleanup job in parallel with other werf commands such as build, converge and cleanup.`),
+With --daemon option the command monitors docker storage and local cache continuously and runs cleanup with the specified interval.
+Per-project quotas (--project-quota, --default-project-quota) limit docker storage and local cache used by each project: least recently used images and local cache entries of the project exceeding its quota are deleted first.
+The total size of the local cache can be limited with --allowed-local-cache-size: least recently used local cache entries are deleted until the size becomes below the limit.`),
 		DisableFlagsInUseLine: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			defer global_warnings.PrintGlobalWarnings(common.BackgroundContext())
@@ -69,13 +82,33 @@ It is safe to run this command periodically by automated cleanup job in parallel
 	common.SetupAllowedDockerStorageVolumeUsageMargin(&commonCmdData, cmd)
 	common.SetupAllowedLocalCacheVolumeUsage(&commonCmdData, cmd)
 	common.SetupAllowedLocalCacheVolumeUsageMargin(&commonCmdData, cmd)
+	common.SetupAllowedLocalCacheSize(&commonCmdData, cmd)
 	common.SetupDockerServerStoragePath(&commonCmdData, cmd)
 
 	cmd.Flags().BoolVarP(&cmdData.Force, "force", "", common.GetBoolEnvironmentDefaultFalse("WERF_FORCE"), "Force deletion of images which are being used by some containers (default $WERF_FORCE)")
 
+	cmd.Flags().BoolVarP(&cmdData.Daemon, "daemon", "", common.GetBoolEnvironmentDefaultFalse("WERF_DAEMON"), "Run cleanup continuously with the interval specified by --daemon-interval until SIGINT or SIGTERM is received (default $WERF_DAEMON)")
+	cmd.Flags().DurationVarP(&cmdData.DaemonInterval, "daemon-interval", "", getDaemonIntervalDefault(), fmt.Sprintf("Interval between cleanups in daemon mode (default %s or $WERF_DAEMON_INTERVAL)", host_cleaning.DefaultDaemonInterval))
+	common.SetupProjectQuotas(&commonCmdData, cmd)
+	cmd.Flags().StringVarP(&cmdData.DecisionsLog, "decisions-log", "", os.Getenv("WERF_DECISIONS_LOG"), "Append cleanup decisions (deleted and skipped images and local cache entries, project usage and quota) to the specified file as JSON lines (default $WERF_DECISIONS_LOG)")
+
 	return cmd
 }
 
+func getDaemonIntervalDefault() time.Duration {
+	envVarName := "WERF_DAEMON_INTERVAL"
+
+	if v := os.Getenv(envVarName); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			common.TerminateWithError(fmt.Sprintf("bad %s value %q: %s", envVarName, v, err), 1)
+		}
+		return interval
+	}
+
+	return host_cleaning.DefaultDaemonInterval
+}
+
 func runGC() error {
 	ctx := common.BackgroundContext()
 
@@ -121,6 +154,27 @@ func runGC() error {
 
 	logboek.LogOptionalLn()
 
+	projectQuotas, err := common.GetProjectQuotas(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	allowedLocalCacheSize, err := common.GetAllowedLocalCacheSize(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	var decisionsLog *host_cleaning.DecisionsLog
+	if cmdData.DecisionsLog != "" {
+		f, err := os.OpenFile(cmdData.DecisionsLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to open decisions log %q: %s", cmdData.DecisionsLog, err)
+		}
+		defer f.Close()
+
+		decisionsLog = host_cleaning.NewDecisionsLog(f)
+	}
+
 	hostCleanupOptions := host_cleaning.HostCleanupOptions{
 		DryRun: *commonCmdData.DryRun,
 		Force:  cmdData.Force,
@@ -128,7 +182,17 @@ func runGC() error {
 		AllowedDockerStorageVolumeUsageMarginPercentage: commonCmdData.AllowedDockerStorageVolumeUsageMargin,
 		AllowedLocalCacheVolumeUsagePercentage:          commonCmdData.AllowedLocalCacheVolumeUsage,
 		AllowedLocalCacheVolumeUsageMarginPercentage:    commonCmdData.AllowedLocalCacheVolumeUsageMargin,
+		AllowedLocalCacheSize:                           allowedLocalCacheSize,
 		DockerServerStoragePath:                         *commonCmdData.DockerServerStoragePath,
+		ProjectQuotas:                                   projectQuotas,
+		DecisionsLog:                                    decisionsLog,
+	}
+
+	if cmdData.Daemon {
+		// the daemon stops gracefully between the cleanups
+		return common.WithoutTerminationSignalsTrap(func() error {
+			return host_cleaning.RunHostCleanupDaemon(ctx, hostCleanupOptions, cmdData.DaemonInterval)
+		})
 	}
 
 	return host_cleaning.RunHostCleanup(ctx, hostCleanupOptions)
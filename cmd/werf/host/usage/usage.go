@@ -0,0 +1,124 @@
+package usage
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/cmd/werf/common"
+	"github.com/werf/werf/pkg/docker"
+	"github.com/werf/werf/pkg/git_repo"
+	"github.com/werf/werf/pkg/git_repo/gitdata"
+	"github.com/werf/werf/pkg/host_cleaning"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage/lrumeta"
+	"github.com/werf/werf/pkg/werf"
+	"github.com/werf/werf/pkg/werf/global_warnings"
+)
+
+var commonCmdData common.CmdData
+
+var cmdData struct {
+	JSON bool
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show disk usage of werf images, cache and other data of all projects on host machine",
+		Long: common.GetLongCommandDescription(`Show disk usage of werf images, cache and other data of all projects on host machine broken down by the type and the project.
+
+The report includes:
+* Werf images in the local docker server (skipped if the docker server is not available).
+* Local cache:
+  * Remote git clones cache.
+  * Git worktree cache.
+  * Git archives and patches cache.
+  * Images manifests cache.
+  * Helm chart dependencies cache.
+* Shared context:
+  * Mounts which persists between several builds (mounts from build_dir).
+
+The data shared between the projects (e.g. git cache of the repo used by several projects) is reported without the project.`),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer global_warnings.PrintGlobalWarnings(common.BackgroundContext())
+
+			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+
+			return runUsage()
+		},
+	}
+
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+	common.SetupDockerConfig(&commonCmdData, cmd, "")
+
+	common.SetupLogOptions(&commonCmdData, cmd)
+
+	cmd.Flags().BoolVarP(&cmdData.JSON, "json", "", common.GetBoolEnvironmentDefaultFalse("WERF_JSON"), "Print the usage report in the JSON format (default $WERF_JSON)")
+
+	return cmd
+}
+
+func runUsage() error {
+	ctx := common.BackgroundContext()
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	gitDataManager, err := gitdata.GetHostGitDataManager(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting host git data manager: %s", err)
+	}
+
+	if err := git_repo.Init(gitDataManager); err != nil {
+		return err
+	}
+
+	if err := image.Init(); err != nil {
+		return err
+	}
+
+	if err := lrumeta.Init(); err != nil {
+		return err
+	}
+
+	var skipDockerImages bool
+	if err := docker.Init(ctx, *commonCmdData.DockerConfig, *commonCmdData.LogVerbose, *commonCmdData.LogDebug); err != nil {
+		return err
+	}
+
+	if ctxWithDockerCli, err := docker.NewContext(ctx); err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: local docker server is not available, docker images usage is skipped: %s\n", err)
+		skipDockerImages = true
+	} else if _, err := docker.Info(ctxWithDockerCli); err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: local docker server is not available, docker images usage is skipped: %s\n", err)
+		skipDockerImages = true
+	} else {
+		ctx = ctxWithDockerCli
+	}
+
+	report, err := host_cleaning.GetHostUsageReport(ctx, host_cleaning.HostUsageOptions{SkipDockerImages: skipDockerImages})
+	if err != nil {
+		return err
+	}
+
+	if cmdData.JSON {
+		data, err := report.ToJsonData()
+		if err != nil {
+			return fmt.Errorf("unable to prepare usage report json: %s", err)
+		}
+		fmt.Print(string(data))
+	} else {
+		fmt.Print(string(report.ToTextData()))
+	}
+
+	return nil
+}
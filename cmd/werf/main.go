@@ -29,6 +29,7 @@ import (
 
 	host_cleanup "github.com/werf/werf/cmd/werf/host/cleanup"
 	host_purge "github.com/werf/werf/cmd/werf/host/purge"
+	host_usage "github.com/werf/werf/cmd/werf/host/usage"
 
 	bundle_apply "github.com/werf/werf/cmd/werf/bundle/apply"
 	bundle_download "github.com/werf/werf/cmd/werf/bundle/download"
@@ -43,7 +44,10 @@ import (
 	"github.com/werf/werf/cmd/werf/docs"
 	"github.com/werf/werf/cmd/werf/version"
 
+	stage_diff_digest "github.com/werf/werf/cmd/werf/stage/diff_digest"
+	stage_digest "github.com/werf/werf/cmd/werf/stage/digest"
 	stage_image "github.com/werf/werf/cmd/werf/stage/image"
+	stages_migrate "github.com/werf/werf/cmd/werf/stages/migrate"
 
 	"github.com/werf/werf/cmd/werf/common"
 	"github.com/werf/werf/cmd/werf/common/templates"
@@ -114,6 +118,8 @@ Find more information at https://werf.io`),
 			Commands: []*cobra.Command{
 				configCmd(),
 				managedImagesCmd(),
+				stagesCmd(),
+				stageCmd(),
 				hostCmd(),
 				helm.NewCmd(),
 			},
@@ -125,7 +131,6 @@ Find more information at https://werf.io`),
 				completion.NewCmd(rootCmd),
 				version.NewCmd(),
 				docs.NewCmd(groups),
-				stageCmd(),
 			},
 		},
 	}...)
@@ -195,11 +200,25 @@ func managedImagesCmd() *cobra.Command {
 
 func stageCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:    "stage",
-		Hidden: true,
+		Use:   "stage",
+		Short: "Work with stages of the current project commit",
 	}
 	cmd.AddCommand(
 		stage_image.NewCmd(),
+		stage_diff_digest.NewCmd(),
+		stage_digest.NewCmd(),
+	)
+
+	return cmd
+}
+
+func stagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stages",
+		Short: "Work with stages of the project in the repo",
+	}
+	cmd.AddCommand(
+		stages_migrate.NewCmd(),
 	)
 
 	return cmd
@@ -214,6 +233,7 @@ func hostCmd() *cobra.Command {
 	hostCmd.AddCommand(
 		host_cleanup.NewCmd(),
 		host_purge.NewCmd(),
+		host_usage.NewCmd(),
 	)
 
 	return hostCmd
@@ -0,0 +1,284 @@
+package diff_digest
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/werf/logboek"
+	"github.com/werf/logboek/pkg/level"
+
+	"github.com/werf/werf/cmd/werf/common"
+	"github.com/werf/werf/pkg/build"
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/docker"
+	"github.com/werf/werf/pkg/git_repo"
+	"github.com/werf/werf/pkg/git_repo/gitdata"
+	"github.com/werf/werf/pkg/giterminism_manager"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/logging"
+	"github.com/werf/werf/pkg/ssh_agent"
+	"github.com/werf/werf/pkg/storage/lrumeta"
+	"github.com/werf/werf/pkg/storage/manager"
+	"github.com/werf/werf/pkg/tmp_manager"
+	"github.com/werf/werf/pkg/true_git"
+	"github.com/werf/werf/pkg/werf"
+)
+
+var cmdData struct {
+	Save       string
+	Base       string
+	BaseCommit string
+	JSON       bool
+}
+
+var commonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff-digest [options] [IMAGE_NAME...]",
+		Short: "Explain why stage digests changed",
+		Long: common.GetLongCommandDescription(`Calculate the stage digests of the current commit, record the inputs of each digest (stage dependencies, git mapping patches, Dockerfile instructions, build args, mounts, previous stage digest, etc.) and print which inputs changed compared to the base.
+
+The base is the run saved earlier with the --save option or the other commit of the project git repo.
+
+The stages following the first stage, which is not found in the repo, cannot be calculated without building and are not compared`),
+		Example: `  # Compare the stage digests with the previous commit
+  $ werf stage diff-digest --repo harbor.company.io/werf --base-commit HEAD~1
+
+  # Save the stage digest inputs of the current run and compare with it later
+  $ werf stage diff-digest --repo harbor.company.io/werf --save digest-inputs.json
+  $ werf stage diff-digest --repo harbor.company.io/werf --base digest-inputs.json`,
+		DisableFlagsInUseLine: true,
+		Hidden:                true,
+		Annotations: map[string]string{
+			common.DisableOptionsInUseLineAnno: "1",
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logboek.SetAcceptedLevel(level.Error)
+
+			if cmdData.Base != "" && cmdData.BaseCommit != "" {
+				common.PrintHelp(cmd)
+				return fmt.Errorf("only one of --base and --base-commit can be specified")
+			}
+
+			if cmdData.Base == "" && cmdData.BaseCommit == "" && cmdData.Save == "" {
+				common.PrintHelp(cmd)
+				return fmt.Errorf("--base, --base-commit or --save should be specified")
+			}
+
+			return run(args)
+		},
+	}
+
+	common.SetupDir(&commonCmdData, cmd)
+	common.SetupGitWorkTree(&commonCmdData, cmd)
+	common.SetupConfigTemplatesDir(&commonCmdData, cmd)
+	common.SetupConfigPath(&commonCmdData, cmd)
+	common.SetupEnvironment(&commonCmdData, cmd)
+
+	common.SetupGiterminismOptions(&commonCmdData, cmd)
+
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+	common.SetupSSHKey(&commonCmdData, cmd)
+
+	common.SetupSecondaryStagesStorageOptions(&commonCmdData, cmd)
+	common.SetupStagesStorageOptions(&commonCmdData, cmd)
+
+	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read and pull images from the specified stages storage")
+	common.SetupInsecureRegistry(&commonCmdData, cmd)
+	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
+
+	common.SetupLogProjectDir(&commonCmdData, cmd)
+	common.SetupLogOptions(&commonCmdData, cmd)
+
+	common.SetupSynchronization(&commonCmdData, cmd)
+	common.SetupKubeConfig(&commonCmdData, cmd)
+	common.SetupKubeConfigBase64(&commonCmdData, cmd)
+	common.SetupKubeContext(&commonCmdData, cmd)
+
+	common.SetupVirtualMerge(&commonCmdData, cmd)
+	common.SetupVirtualMergeFromCommit(&commonCmdData, cmd)
+	common.SetupVirtualMergeIntoCommit(&commonCmdData, cmd)
+
+	cmd.Flags().StringVarP(&cmdData.Save, "save", "", os.Getenv("WERF_SAVE"), "Save the stage digest inputs of the current run into the specified file to use it as the --base later (default $WERF_SAVE)")
+	cmd.Flags().StringVarP(&cmdData.Base, "base", "", os.Getenv("WERF_BASE"), "Compare with the stage digest inputs saved by the --save option (default $WERF_BASE)")
+	cmd.Flags().StringVarP(&cmdData.BaseCommit, "base-commit", "", os.Getenv("WERF_BASE_COMMIT"), "Compare with the stage digest inputs of the specified commit, branch or tag of the project git repo (default $WERF_BASE_COMMIT)")
+	cmd.Flags().BoolVarP(&cmdData.JSON, "json", "", common.GetBoolEnvironmentDefaultFalse("WERF_JSON"), "Print the difference in the JSON format (default $WERF_JSON)")
+
+	return cmd
+}
+
+func run(imagesToProcess []string) error {
+	ctx := common.BackgroundContext()
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	gitDataManager, err := gitdata.GetHostGitDataManager(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting host git data manager: %s", err)
+	}
+
+	if err := git_repo.Init(gitDataManager); err != nil {
+		return err
+	}
+
+	if err := image.Init(); err != nil {
+		return err
+	}
+
+	if err := lrumeta.Init(); err != nil {
+		return err
+	}
+
+	if err := true_git.Init(true_git.Options{LiveGitOutput: *commonCmdData.LogVerbose || *commonCmdData.LogDebug}); err != nil {
+		return err
+	}
+
+	if err := common.DockerRegistryInit(&commonCmdData); err != nil {
+		return err
+	}
+
+	if err := docker.Init(ctx, *commonCmdData.DockerConfig, *commonCmdData.LogVerbose, *commonCmdData.LogDebug); err != nil {
+		return err
+	}
+
+	ctxWithDockerCli, err := docker.NewContext(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = ctxWithDockerCli
+
+	giterminismManager, err := common.GetGiterminismManager(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	common.ProcessLogProjectDir(&commonCmdData, giterminismManager.ProjectDir())
+
+	if err := ssh_agent.Init(ctx, common.GetSSHKey(&commonCmdData)); err != nil {
+		return fmt.Errorf("cannot initialize ssh agent: %s", err)
+	}
+	defer func() {
+		err := ssh_agent.Terminate()
+		if err != nil {
+			logboek.Warn().LogF("WARNING: ssh agent termination failed: %s\n", err)
+		}
+	}()
+
+	var baseReport *build.DigestInputsReport
+	switch {
+	case cmdData.Base != "":
+		baseReport, err = build.LoadDigestInputsReport(cmdData.Base)
+		if err != nil {
+			return err
+		}
+	case cmdData.BaseCommit != "":
+		baseGiterminismManager, err := common.GetGiterminismManagerForCommit(&commonCmdData, cmdData.BaseCommit)
+		if err != nil {
+			return fmt.Errorf("unable to init base commit %q: %s", cmdData.BaseCommit, err)
+		}
+
+		baseReport, err = recordDigestInputs(ctx, baseGiterminismManager, imagesToProcess, baseGiterminismManager.HeadCommit())
+		if err != nil {
+			return fmt.Errorf("unable to record base commit %q stage digest inputs: %s", cmdData.BaseCommit, err)
+		}
+	}
+
+	report, err := recordDigestInputs(ctx, giterminismManager, imagesToProcess, "")
+	if err != nil {
+		return err
+	}
+
+	if cmdData.Save != "" {
+		if err := report.Save(cmdData.Save); err != nil {
+			return err
+		}
+	}
+
+	if baseReport == nil {
+		return nil
+	}
+
+	diff := build.DiffDigestInputs(baseReport, report)
+	if cmdData.JSON {
+		data, err := diff.ToJsonData()
+		if err != nil {
+			return fmt.Errorf("unable to prepare diff json: %s", err)
+		}
+		fmt.Print(string(data))
+	} else {
+		fmt.Print(string(diff.ToTextData()))
+	}
+
+	return nil
+}
+
+func recordDigestInputs(ctx context.Context, giterminismManager giterminism_manager.Interface, imagesToProcess []string, localGitRepoHeadCommit string) (*build.DigestInputsReport, error) {
+	werfConfig, err := common.GetRequiredWerfConfig(ctx, &commonCmdData, giterminismManager, common.GetWerfConfigOptions(&commonCmdData, false))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load werf config: %s", err)
+	}
+
+	projectName := werfConfig.Meta.Project
+
+	for _, imageToProcess := range imagesToProcess {
+		if !werfConfig.HasImageOrArtifact(imageToProcess) {
+			return nil, fmt.Errorf("specified image %s is not defined in werf.yaml", logging.ImageLogName(imageToProcess, false))
+		}
+	}
+
+	projectTmpDir, err := tmp_manager.CreateProjectDir(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting project tmp dir failed: %s", err)
+	}
+	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
+
+	containerRuntime := &container_runtime.LocalDockerServerRuntime{} // TODO
+
+	stagesStorageAddress := common.GetOptionalStagesStorageAddress(&commonCmdData)
+	stagesStorage, err := common.GetStagesStorage(stagesStorageAddress, containerRuntime, &commonCmdData)
+	if err != nil {
+		return nil, err
+	}
+
+	synchronization, err := common.GetSynchronization(ctx, &commonCmdData, projectName, stagesStorage)
+	if err != nil {
+		return nil, err
+	}
+	stagesStorageCache, err := common.GetStagesStorageCache(synchronization)
+	if err != nil {
+		return nil, err
+	}
+	storageLockManager, err := common.GetStorageLockManager(ctx, synchronization)
+	if err != nil {
+		return nil, err
+	}
+	secondaryStagesStorageList, err := common.GetSecondaryStagesStorageList(stagesStorage, containerRuntime, &commonCmdData)
+	if err != nil {
+		return nil, err
+	}
+
+	storageManager := manager.NewStorageManager(projectName, stagesStorage, secondaryStagesStorageList, storageLockManager, stagesStorageCache)
+
+	conveyorOptions := common.GetConveyorOptions(&commonCmdData)
+	conveyorOptions.LocalGitRepoHeadCommit = localGitRepoHeadCommit
+
+	conveyorWithRetry := build.NewConveyorWithRetryWrapper(werfConfig, giterminismManager, imagesToProcess, giterminismManager.ProjectDir(), projectTmpDir, ssh_agent.SSHAuthSock, containerRuntime, storageManager, storageLockManager, conveyorOptions)
+	defer conveyorWithRetry.Terminate()
+
+	var report *build.DigestInputsReport
+	if err := conveyorWithRetry.WithRetryBlock(ctx, func(c *build.Conveyor) error {
+		report, err = c.RecordDigestInputs(ctx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,161 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/werf/werf/cmd/werf/common"
+	"github.com/werf/werf/pkg/git_repo"
+	"github.com/werf/werf/pkg/git_repo/gitdata"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage"
+	"github.com/werf/werf/pkg/storage/migration"
+	"github.com/werf/werf/pkg/true_git"
+	"github.com/werf/werf/pkg/werf"
+)
+
+var cmdData struct {
+	From string
+	To   string
+
+	FromRepoData *common.RepoData
+	ToRepoData   *common.RepoData
+}
+
+var commonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "migrate",
+		DisableFlagsInUseLine: true,
+		Short:                 "Copy stages and werf metadata of the project from one repo into another",
+		Long: common.GetLongCommandDescription(`Copy stages, managed images, images metadata, imports metadata and client ID records of the project from one repo into another.
+
+The command works without the local docker server: images are copied directly between the storages, so any of the supported repos can be used on both sides (container registry, s3://BUCKET[/PREFIX] or oci-layout:///PATH).
+Already migrated stages and records are skipped, so an interrupted migration can be continued by running the command again.`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+
+			return run()
+		},
+	}
+
+	common.SetupDir(&commonCmdData, cmd)
+	common.SetupGitWorkTree(&commonCmdData, cmd)
+	common.SetupConfigTemplatesDir(&commonCmdData, cmd)
+	common.SetupConfigPath(&commonCmdData, cmd)
+	common.SetupEnvironment(&commonCmdData, cmd)
+
+	common.SetupGiterminismOptions(&commonCmdData, cmd)
+
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+
+	cmd.Flags().StringVarP(&cmdData.From, "from", "", os.Getenv("WERF_FROM_REPO"), "Source repo to copy stages from (default $WERF_FROM_REPO)")
+	cmd.Flags().StringVarP(&cmdData.To, "to", "", os.Getenv("WERF_TO_REPO"), "Destination repo to copy stages into (default $WERF_TO_REPO)")
+
+	cmdData.FromRepoData = &common.RepoData{DesignationStorageName: "source repo"}
+	common.SetupRepoData(cmdData.FromRepoData, cmd, "from-repo", "WERF_FROM_REPO")
+
+	cmdData.ToRepoData = &common.RepoData{DesignationStorageName: "destination repo"}
+	common.SetupRepoData(cmdData.ToRepoData, cmd, "to-repo", "WERF_TO_REPO")
+
+	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read images from the source repo and write images to the destination repo")
+	common.SetupInsecureRegistry(&commonCmdData, cmd)
+	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
+
+	common.SetupLogOptions(&commonCmdData, cmd)
+	common.SetupLogProjectDir(&commonCmdData, cmd)
+
+	common.SetupParallelOptions(&commonCmdData, cmd, common.DefaultCleanupParallelTasksLimit)
+
+	return cmd
+}
+
+func run() error {
+	ctx := common.BackgroundContext()
+
+	if cmdData.From == "" || cmdData.To == "" {
+		return fmt.Errorf("--from=ADDRESS and --to=ADDRESS params required")
+	}
+
+	if cmdData.From == cmdData.To {
+		return fmt.Errorf("--from and --to params should specify different repos")
+	}
+
+	for _, address := range []string{cmdData.From, cmdData.To} {
+		if address == storage.LocalStorageAddress {
+			return fmt.Errorf("%s stages storage is not supported by the migration", storage.LocalStorageAddress)
+		}
+	}
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	gitDataManager, err := gitdata.GetHostGitDataManager(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting host git data manager: %s", err)
+	}
+
+	if err := git_repo.Init(gitDataManager); err != nil {
+		return err
+	}
+
+	if err := true_git.Init(true_git.Options{LiveGitOutput: *commonCmdData.LogVerbose || *commonCmdData.LogDebug}); err != nil {
+		return err
+	}
+
+	if err := image.Init(); err != nil {
+		return err
+	}
+
+	if err := common.DockerRegistryInit(&commonCmdData); err != nil {
+		return err
+	}
+
+	// docker server is not used, registry credentials are read from the docker config directly
+	if *commonCmdData.DockerConfig != "" {
+		if err := os.Setenv("DOCKER_CONFIG", *commonCmdData.DockerConfig); err != nil {
+			return fmt.Errorf("cannot set DOCKER_CONFIG to %s: %s", *commonCmdData.DockerConfig, err)
+		}
+	}
+
+	giterminismManager, err := common.GetGiterminismManager(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	common.ProcessLogProjectDir(&commonCmdData, giterminismManager.ProjectDir())
+
+	werfConfig, err := common.GetRequiredWerfConfig(ctx, &commonCmdData, giterminismManager, common.GetWerfConfigOptions(&commonCmdData, false))
+	if err != nil {
+		return fmt.Errorf("unable to load werf config: %s", err)
+	}
+
+	projectName := werfConfig.Meta.Project
+
+	fromStagesStorage, err := common.GetStagesStorageWithRepoData(cmdData.From, nil, &commonCmdData, cmdData.FromRepoData)
+	if err != nil {
+		return err
+	}
+
+	toStagesStorage, err := common.GetStagesStorageWithRepoData(cmdData.To, nil, &commonCmdData, cmdData.ToRepoData)
+	if err != nil {
+		return err
+	}
+
+	maxNumberOfWorkers := 1
+	if *commonCmdData.Parallel && *commonCmdData.ParallelTasksLimit > 0 {
+		maxNumberOfWorkers = int(*commonCmdData.ParallelTasksLimit)
+	}
+
+	return migration.Migrate(ctx, projectName, fromStagesStorage, toStagesStorage, migration.MigrateOptions{
+		MaxNumberOfWorkers: maxNumberOfWorkers,
+	})
+}
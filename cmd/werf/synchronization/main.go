@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
+	bolt "go.etcd.io/bbolt"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/werf/kubedog/pkg/kube"
@@ -29,6 +31,9 @@ var cmdData struct {
 	LocalLockManagerBaseDir        string
 	LocalStagesStorageCacheBaseDir string
 
+	DatabasePath   string
+	AuthTokensFile string
+
 	TTL  string
 	Host string
 	Port string
@@ -66,9 +71,14 @@ func NewCmd() *cobra.Command {
 	common.SetupKubeConfigBase64(&commonCmdData, cmd)
 	common.SetupKubeContext(&commonCmdData, cmd)
 
-	cmd.Flags().BoolVarP(&cmdData.Local, "local", "", common.GetBoolEnvironmentDefaultTrue("WERF_LOCAL"), "Use file lock-manager and file stages-storage-cache (true by default or $WERF_LOCAL)")
+	cmd.Flags().BoolVarP(&cmdData.Local, "local", "", common.GetBoolEnvironmentDefaultTrue("WERF_LOCAL"), "Use lock-manager and stages-storage-cache persisted in the local database (true by default or $WERF_LOCAL)")
 	cmd.Flags().StringVarP(&cmdData.LocalLockManagerBaseDir, "local-lock-manager-base-dir", "", os.Getenv("WERF_LOCAL_LOCK_MANAGER_BASE_DIR"), "Use specified directory as base for file lock-manager (~/.werf/synchronization_server/lock_manager by default or $WERF_LOCAL_LOCK_MANAGER_BASE_DIR)")
-	cmd.Flags().StringVarP(&cmdData.LocalStagesStorageCacheBaseDir, "local-stages-storage-cache-base-dir", "", os.Getenv("WERF_LOCAL_STAGES_STORAGE_CACHE_BASE_DIR"), "Use specified directory as base for file stages-storage-cache (~/.werf/synchronization_server/stages_storage_cache by default or $WERF_LOCAL_STAGES_STORAGE_CACHE_BASE_DIR)")
+	cmd.Flags().StringVarP(&cmdData.LocalStagesStorageCacheBaseDir, "local-stages-storage-cache-base-dir", "", os.Getenv("WERF_LOCAL_STAGES_STORAGE_CACHE_BASE_DIR"), "Use file stages-storage-cache in the specified directory instead of the local database (default $WERF_LOCAL_STAGES_STORAGE_CACHE_BASE_DIR)")
+	cmd.Flags().StringVarP(&cmdData.DatabasePath, "database-path", "", os.Getenv("WERF_DATABASE_PATH"), "Path to the local database file with locks, stages-storage-cache records (~/.werf/synchronization_server/database.db by default or $WERF_DATABASE_PATH)")
+
+	cmd.Flags().StringVarP(&cmdData.AuthTokensFile, "auth-tokens-file", "", os.Getenv("WERF_AUTH_TOKENS_FILE"), `Require one of the bearer tokens from the specified file for all requests (default $WERF_AUTH_TOKENS_FILE).
+Each line of the file contains the token followed by the space separated client IDs the token may be used with (* allows any client ID),
+werf commands pass the token with the --synchronization-token option`)
 
 	cmd.Flags().BoolVarP(&cmdData.Kubernetes, "kubernetes", "", common.GetBoolEnvironmentDefaultFalse("WERF_KUBERNETES"), "Use kubernetes lock-manager stages-storage-cache (default $WERF_KUBERNETES)")
 	cmd.Flags().StringVarP(&cmdData.KubernetesNamespacePrefix, "kubernetes-namespace-prefix", "", os.Getenv("WERF_KUBERNETES_NAMESPACE_PREFIX"), "Use specified prefix for namespaces created for lock-manager and stages-storage-cache (defaults to 'werf-synchronization-' when --kubernetes option is used or $WERF_KUBERNETES_NAMESPACE_PREFIX)")
@@ -104,6 +114,33 @@ func runSynchronization() error {
 		port = "55581"
 	}
 
+	databasePath := cmdData.DatabasePath
+	if databasePath == "" {
+		databasePath = filepath.Join(werf.GetHomeDir(), "synchronization_server", "database.db")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(databasePath), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create dir %s: %s", filepath.Dir(databasePath), err)
+	}
+
+	db, err := bolt.Open(databasePath, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return fmt.Errorf("unable to open database %s: %s", databasePath, err)
+	}
+	defer db.Close()
+
+	var options synchronization_server.SynchronizationServerOptions
+	if cmdData.AuthTokensFile != "" {
+		tokens, err := synchronization_server.ReadAuthTokensFile(cmdData.AuthTokensFile)
+		if err != nil {
+			return err
+		}
+
+		if options.Authenticator, err = synchronization_server.NewTokenAuthenticator(tokens); err != nil {
+			return fmt.Errorf("unable to init auth: %s: check %s", err, cmdData.AuthTokensFile)
+		}
+	}
+
 	var distributedLockerBackendFactoryFunc func(clientID string) (distributed_locker.DistributedLockerBackend, error)
 	var stagesStorageCacheFactoryFunc func(clientID string) (storage.StagesStorageCache, error)
 
@@ -144,20 +181,24 @@ func runSynchronization() error {
 			}), nil
 		}
 	} else {
-		stagesStorageCacheBaseDir := cmdData.LocalStagesStorageCacheBaseDir
-		if stagesStorageCacheBaseDir == "" {
-			stagesStorageCacheBaseDir = filepath.Join(werf.GetHomeDir(), "synchronization_server", "stages_storage_cache")
-		}
-
 		distributedLockerBackendFactoryFunc = func(clientID string) (distributed_locker.DistributedLockerBackend, error) {
-			store := optimistic_locking_store.NewInMemoryStore()
+			store, err := synchronization_server.NewBoltOptimisticLockingStore(db, clientID)
+			if err != nil {
+				return nil, err
+			}
 			return distributed_locker.NewOptimisticLockingStorageBasedBackend(store), nil
 		}
 
-		stagesStorageCacheFactoryFunc = func(clientID string) (storage.StagesStorageCache, error) {
-			return storage.NewFileStagesStorageCache(filepath.Join(stagesStorageCacheBaseDir, clientID)), nil
+		if stagesStorageCacheBaseDir := cmdData.LocalStagesStorageCacheBaseDir; stagesStorageCacheBaseDir != "" {
+			stagesStorageCacheFactoryFunc = func(clientID string) (storage.StagesStorageCache, error) {
+				return storage.NewFileStagesStorageCache(filepath.Join(stagesStorageCacheBaseDir, clientID)), nil
+			}
+		} else {
+			stagesStorageCacheFactoryFunc = func(clientID string) (storage.StagesStorageCache, error) {
+				return storage.NewBoltStagesStorageCache(db, clientID), nil
+			}
 		}
 	}
 
-	return synchronization_server.RunSynchronizationServer(ctx, host, port, distributedLockerBackendFactoryFunc, stagesStorageCacheFactoryFunc)
+	return synchronization_server.RunSynchronizationServer(ctx, host, port, distributedLockerBackendFactoryFunc, stagesStorageCacheFactoryFunc, options)
 }
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -20,11 +21,11 @@ import (
 	"github.com/werf/logboek/pkg/style"
 	"github.com/werf/logboek/pkg/types"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/build/stage"
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/image"
 	imagePkg "github.com/werf/werf/pkg/image"
-	"github.com/werf/werf/pkg/stapel"
 	"github.com/werf/werf/pkg/storage"
 	"github.com/werf/werf/pkg/util"
 	"github.com/werf/werf/pkg/werf"
@@ -33,14 +34,19 @@ import (
 type BuildPhaseOptions struct {
 	BuildOptions
 	ShouldBeBuiltMode bool
+
+	// DigestInputsReport enables the recording of the stage digest inputs
+	DigestInputsReport *DigestInputsReport
 }
 
 type BuildOptions struct {
 	ImageBuildOptions container_runtime.BuildOptions
 	IntrospectOptions
+	StageRetryOptions
 
 	ReportPath   string
 	ReportFormat ReportFormat
+	TracePath    string
 
 	DryRun bool
 }
@@ -92,6 +98,7 @@ type ReportFormat string
 type ImagesReport struct {
 	mux    sync.Mutex
 	Images map[string]ReportImageRecord
+	Stages []*ReportStageRecord `json:",omitempty"`
 }
 
 func (report *ImagesReport) SetImageRecord(name string, imageRecord ReportImageRecord) {
@@ -148,6 +155,13 @@ type ReportImageRecord struct {
 	DockerTag       string
 	DockerImageID   string
 	DockerImageName string
+	Platforms       map[string]ReportPlatformImageRecord `json:",omitempty"`
+}
+
+type ReportPlatformImageRecord struct {
+	DockerImageID     string
+	DockerImageDigest string
+	DockerImageName   string
 }
 
 func (phase *BuildPhase) Name() string {
@@ -159,12 +173,140 @@ func (phase *BuildPhase) BeforeImages(_ context.Context) error {
 }
 
 func (phase *BuildPhase) AfterImages(ctx context.Context) error {
+	if err := phase.createManifestLists(ctx); err != nil {
+		return err
+	}
+
 	return phase.createReport(ctx)
 }
 
-func (phase *BuildPhase) createReport(ctx context.Context) error {
+// getMultiPlatformImages returns the platform-specific images of the multi-platform images by image name
+func (phase *BuildPhase) getMultiPlatformImages() (map[string][]*Image, []string) {
+	res := map[string][]*Image{}
+	var names []string
+
 	for _, img := range phase.Conveyor.images {
-		if img.isArtifact {
+		if img.isArtifact || img.platform == "" {
+			continue
+		}
+
+		if _, hasKey := res[img.GetName()]; !hasKey {
+			names = append(names, img.GetName())
+		}
+		res[img.GetName()] = append(res[img.GetName()], img)
+	}
+
+	for _, images := range res {
+		sort.Slice(images, func(i, j int) bool {
+			return images[i].platform < images[j].platform
+		})
+	}
+
+	return res, names
+}
+
+func (phase *BuildPhase) createManifestLists(ctx context.Context) error {
+	multiPlatformImages, names := phase.getMultiPlatformImages()
+
+	for _, imageName := range names {
+		if err := phase.createManifestList(ctx, imageName, multiPlatformImages[imageName]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (phase *BuildPhase) createManifestList(ctx context.Context, imageName string, images []*Image) error {
+	checksumArgs := []string{imagePkg.BuildCacheVersion, "manifest-list"}
+	for _, img := range images {
+		checksumArgs = append(checksumArgs, img.platform, img.GetLastNonEmptyStage().GetImage().Name())
+	}
+	digest := util.Sha3_224Hash(checksumArgs...)
+
+	logName := fmt.Sprintf("%s manifest list", imageName)
+
+	stages, err := phase.Conveyor.StorageManager.GetStagesByDigest(ctx, logName, digest)
+	if err != nil {
+		return err
+	}
+
+	if len(stages) == 0 {
+		if phase.ShouldBeBuiltMode {
+			return fmt.Errorf("manifest list of image %s with digest %s is not exist in repo", imageName, digest)
+		}
+
+		if err := logboek.Context(ctx).Default().LogProcess("Storing manifest list of image %s", imageName).DoError(func() error {
+			if lock, err := phase.Conveyor.StorageLockManager.LockStage(ctx, phase.Conveyor.projectName(), digest); err != nil {
+				return fmt.Errorf("unable to lock project %s digest %s: %s", phase.Conveyor.projectName(), digest, err)
+			} else {
+				defer phase.Conveyor.StorageLockManager.Unlock(ctx, lock)
+			}
+
+			if stages, err = phase.Conveyor.StorageManager.GetStagesByDigest(ctx, logName, digest); err != nil {
+				return err
+			} else if len(stages) != 0 {
+				return nil
+			}
+
+			manifestListName, uniqueID := phase.Conveyor.StorageManager.GenerateStageUniqueID(digest, stages)
+
+			manifestList := &container_runtime.ManifestListImage{Name: manifestListName}
+			for _, img := range images {
+				manifestList.Manifests = append(manifestList.Manifests, container_runtime.ManifestListImageEntry{
+					Platform:  img.platform,
+					ImageName: img.GetLastNonEmptyStage().GetImage().Name(),
+				})
+			}
+
+			if err := phase.Conveyor.StorageManager.StagesStorage.StoreImage(ctx, manifestList); err != nil {
+				return fmt.Errorf("unable to store manifest list %s into repo %s: %s", manifestListName, phase.Conveyor.StorageManager.StagesStorage.String(), err)
+			}
+
+			desc, err := phase.Conveyor.StorageManager.StagesStorage.GetStageDescription(ctx, phase.Conveyor.projectName(), digest, uniqueID)
+			if err != nil {
+				return fmt.Errorf("unable to get manifest list %s description from repo %s: %s", manifestListName, phase.Conveyor.StorageManager.StagesStorage.String(), err)
+			}
+			stages = append(stages, desc)
+
+			return phase.Conveyor.StorageManager.AtomicStoreStagesByDigestToCache(ctx, "manifest-list", digest, []image.StageID{*desc.StageID})
+		}); err != nil {
+			return err
+		}
+	}
+
+	desc := stages[0]
+	phase.Conveyor.SetImageManifestList(imageName, desc)
+
+	logboek.Context(ctx).Default().LogFDetails("Use manifest list %s for image %s\n", desc.Info.Name, imageName)
+
+	return phase.publishImageMetadata(ctx, imageName, desc.Info.Tag)
+}
+
+func (phase *BuildPhase) createReport(ctx context.Context) error {
+	multiPlatformImages, _ := phase.getMultiPlatformImages()
+
+	for _, img := range phase.Conveyor.getExportedImages() {
+		if manifestListDesc := phase.Conveyor.GetImageManifestList(img.GetName()); manifestListDesc != nil {
+			record := ReportImageRecord{
+				WerfImageName:   img.GetName(),
+				DockerRepo:      manifestListDesc.Info.Repository,
+				DockerTag:       manifestListDesc.Info.Tag,
+				DockerImageID:   manifestListDesc.Info.ID,
+				DockerImageName: manifestListDesc.Info.Name,
+				Platforms:       map[string]ReportPlatformImageRecord{},
+			}
+
+			for _, platformImg := range multiPlatformImages[img.GetName()] {
+				desc := platformImg.GetLastNonEmptyStage().GetImage().GetStageDescription()
+				record.Platforms[platformImg.platform] = ReportPlatformImageRecord{
+					DockerImageID:     desc.Info.ID,
+					DockerImageDigest: desc.Info.RepoDigest,
+					DockerImageName:   desc.Info.Name,
+				}
+			}
+
+			phase.ImagesReport.SetImageRecord(img.GetName(), record)
 			continue
 		}
 
@@ -202,6 +344,18 @@ func (phase *BuildPhase) createReport(ctx context.Context) error {
 		}
 	}
 
+	if phase.TracePath != "" {
+		data, err := phase.ImagesReport.ToTraceData()
+		if err != nil {
+			return fmt.Errorf("unable to prepare trace: %s", err)
+		}
+		logboek.Context(ctx).Debug().LogF("Writing trace to the %q:\n%s", phase.TracePath, data)
+
+		if err := ioutil.WriteFile(phase.TracePath, data, 0644); err != nil {
+			return fmt.Errorf("unable to write trace to %s: %s", phase.TracePath, err)
+		}
+	}
+
 	return nil
 }
 
@@ -225,11 +379,21 @@ func (phase *BuildPhase) AfterImageStages(ctx context.Context, img *Image) error
 		return nil
 	}
 
+	// the last image stage found in the cache stages storage should be available in the primary stages storage
+	if err := phase.Conveyor.copyStageFromCacheStagesStorage(ctx, img.GetLastNonEmptyStage()); err != nil {
+		return err
+	}
+
 	if err := phase.addManagedImage(ctx, img); err != nil {
 		return err
 	}
 
-	if err := phase.publishImageMetadata(ctx, img); err != nil {
+	// the metadata of the multi-platform image is published for the manifest list
+	if img.platform != "" {
+		return nil
+	}
+
+	if err := phase.publishImageMetadata(ctx, img.GetName(), img.GetStageID()); err != nil {
 		return err
 	}
 
@@ -246,8 +410,8 @@ func (phase *BuildPhase) addManagedImage(ctx context.Context, img *Image) error
 	return nil
 }
 
-func (phase *BuildPhase) publishImageMetadata(ctx context.Context, img *Image) error {
-	return logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Processing image %s git metadata", img.GetName())).
+func (phase *BuildPhase) publishImageMetadata(ctx context.Context, imageName, stageID string) error {
+	return logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Processing image %s git metadata", imageName)).
 		DoError(func() error {
 			var commits []string
 
@@ -260,14 +424,14 @@ func (phase *BuildPhase) publishImageMetadata(ctx context.Context, img *Image) e
 			}
 
 			for _, commit := range commits {
-				exists, err := phase.Conveyor.StorageManager.StagesStorage.IsImageMetadataExist(ctx, phase.Conveyor.projectName(), img.GetName(), commit, img.GetStageID())
+				exists, err := phase.Conveyor.StorageManager.StagesStorage.IsImageMetadataExist(ctx, phase.Conveyor.projectName(), imageName, commit, stageID)
 				if err != nil {
-					return fmt.Errorf("unable to get image %s metadata by commit %s and stage ID %s: %s", img.GetName(), commit, img.GetStageID(), err)
+					return fmt.Errorf("unable to get image %s metadata by commit %s and stage ID %s: %s", imageName, commit, stageID, err)
 				}
 
 				if !exists {
-					if err := phase.Conveyor.StorageManager.StagesStorage.PutImageMetadata(ctx, phase.Conveyor.projectName(), img.GetName(), commit, img.GetStageID()); err != nil {
-						return fmt.Errorf("unable to put image %s metadata by commit %s and stage ID %s: %s", img.GetName(), commit, img.GetStageID(), err)
+					if err := phase.Conveyor.StorageManager.StagesStorage.PutImageMetadata(ctx, phase.Conveyor.projectName(), imageName, commit, stageID); err != nil {
+						return fmt.Errorf("unable to put image %s metadata by commit %s and stage ID %s: %s", imageName, commit, stageID, err)
 					}
 				}
 			}
@@ -300,7 +464,7 @@ func (phase *BuildPhase) onImageStage(ctx context.Context, img *Image, stg stage
 		return fmt.Errorf("unable to fetch dependencies for stage %s: %s", stg.LogDetailedName(), err)
 	}
 
-	if stg.Name() != "from" && stg.Name() != "dockerfile" {
+	if stg.Name() != "from" && !isFirstDockerfileStage(img, stg) {
 		if phase.StagesIterator.PrevNonEmptyStage == nil {
 			panic(fmt.Sprintf("expected PrevNonEmptyStage to be set for image %q stage %s", img.GetName(), stg.Name()))
 		}
@@ -322,6 +486,8 @@ func (phase *BuildPhase) onImageStage(ctx context.Context, img *Image, stg stage
 
 	// Stage is cached in the stages storage
 	if foundSuitableStage {
+		phase.ImagesReport.setStageResult(img, stg, ReportStageCached, phase.getPrevNonEmptyStageImageSize())
+
 		logboek.Context(ctx).Default().LogFHighlight("Use cache image for %s\n", stg.LogDetailedName())
 		logImageInfo(ctx, stg.GetImage(), phase.getPrevNonEmptyStageImageSize(), true)
 
@@ -336,12 +502,16 @@ func (phase *BuildPhase) onImageStage(ctx context.Context, img *Image, stg stage
 		return nil
 	}
 
+	stopFetchTiming := phase.trackStageTiming(img, stg, stageTimingFetch)
 	foundSuitableSecondaryStage, err := phase.findAndFetchStageFromSecondaryStagesStorage(ctx, img, stg)
 	if err != nil {
 		return err
 	}
 
-	if !foundSuitableSecondaryStage {
+	if foundSuitableSecondaryStage {
+		stopFetchTiming()
+		phase.ImagesReport.setStageResult(img, stg, ReportStageCopied, phase.getPrevNonEmptyStageImageSize())
+	} else {
 		if phase.ShouldBeBuiltMode {
 			phase.printShouldBeBuiltError(ctx, img, stg)
 			return fmt.Errorf("stages required")
@@ -351,15 +521,31 @@ func (phase *BuildPhase) onImageStage(ctx context.Context, img *Image, stg stage
 		i := phase.Conveyor.GetOrCreateStageImage(castToStageImage(phase.StagesIterator.GetPrevImage(img, stg)), uuid.New().String())
 		stg.SetImage(i)
 
-		if err := phase.fetchBaseImageForStage(ctx, img, stg); err != nil {
-			return err
-		}
-		if err := phase.prepareStageInstructions(ctx, img, stg); err != nil {
-			return err
-		}
-		if err := phase.buildStage(ctx, img, stg); err != nil {
+		if resumed, err := phase.resumeUnstoredStage(ctx, stg); err != nil {
 			return err
+		} else if resumed {
+			if err := phase.atomicStoreStageImage(ctx, img, stg); err != nil {
+				return err
+			}
+			logImageInfo(ctx, stg.GetImage(), phase.getPrevNonEmptyStageImageSize(), false)
+		} else {
+			stopFetchTiming = phase.trackStageTiming(img, stg, stageTimingFetch)
+			if err := phase.doWithStageRetry(ctx, stg, stageRetryFetch, func() error {
+				return phase.fetchBaseImageForStage(ctx, img, stg)
+			}, nil); err != nil {
+				return err
+			}
+			stopFetchTiming()
+
+			if err := phase.prepareStageInstructions(ctx, img, stg); err != nil {
+				return err
+			}
+			if err := phase.buildStage(ctx, img, stg); err != nil {
+				return err
+			}
 		}
+
+		phase.ImagesReport.setStageResult(img, stg, ReportStageBuilt, phase.getPrevNonEmptyStageImageSize())
 	}
 
 	if stg.GetImage().GetStageDescription() == nil {
@@ -455,10 +641,15 @@ func (phase *BuildPhase) fetchBaseImageForStage(ctx context.Context, img *Image,
 		if err := img.FetchBaseImage(ctx, phase.Conveyor); err != nil {
 			return fmt.Errorf("unable to fetch base image %s for stage %s: %s", img.GetBaseImage().Name(), stg.LogDetailedName(), err)
 		}
-	} else if stg.Name() == "dockerfile" {
-		return nil
+	} else if dockerfileStage, ok := stg.(*stage.DockerfileStage); ok {
+		// the images of the dependency Dockerfile stages are used as the build cache
+		for _, dependencyStage := range dockerfileStage.GetDependencyStages() {
+			if err := phase.Conveyor.FetchStage(ctx, dependencyStage); err != nil {
+				return fmt.Errorf("unable to fetch %s for stage %s: %s", dependencyStage.LogDetailedName(), stg.LogDetailedName(), err)
+			}
+		}
 	} else {
-		return phase.Conveyor.StorageManager.FetchStage(ctx, phase.StagesIterator.PrevBuiltStage)
+		return phase.Conveyor.FetchStage(ctx, phase.StagesIterator.PrevBuiltStage)
 	}
 
 	return nil
@@ -471,18 +662,63 @@ func castToStageImage(img container_runtime.ImageInterface) *container_runtime.S
 	return img.(*container_runtime.StageImage)
 }
 
+func (phase *BuildPhase) stagedDockerfileStageDependencies(ctx context.Context, stg *stage.DockerfileStage, stageDependencies string) string {
+	if len(stg.GetDependencyStages()) == 0 {
+		return stageDependencies
+	}
+
+	args := []string{stageDependencies}
+	for _, dependencyStage := range stg.GetDependencyStages() {
+		dependencyStageDigest := dependencyStage.GetDigest()
+		if phase.Conveyor.isContentDigestMode() {
+			dependencyStageDigest = dependencyStage.GetContentDigest()
+		}
+
+		args = append(args, dependencyStageDigest)
+		digest_inputs.Record(ctx, fmt.Sprintf("dependency stage %s digest", dependencyStage.Name()), dependencyStageDigest)
+	}
+
+	return util.Sha256Hash(args...)
+}
+
 func (phase *BuildPhase) calculateStage(ctx context.Context, img *Image, stg stage.Interface) (bool, func(), error) {
-	stageDependencies, err := stg.GetDependencies(ctx, phase.Conveyor, phase.StagesIterator.GetPrevImage(img, stg), phase.StagesIterator.GetPrevBuiltImage(img, stg))
-	if err != nil {
-		return false, nil, err
+	digestCtx := ctx
+	var inputs *digest_inputs.Inputs
+	if phase.DigestInputsReport != nil {
+		inputs = &digest_inputs.Inputs{}
+		digestCtx = digest_inputs.NewContext(ctx, inputs)
 	}
 
-	stageDigest, err := calculateDigest(ctx, string(stg.Name()), stageDependencies, phase.StagesIterator.PrevNonEmptyStage, phase.Conveyor)
+	stopDigestTiming := phase.trackStageTiming(img, stg, stageTimingDigest)
+	stageDependencies, err := stg.GetDependencies(digestCtx, phase.Conveyor, phase.StagesIterator.GetPrevImage(img, stg), phase.StagesIterator.GetPrevBuiltImage(img, stg))
 	if err != nil {
 		return false, nil, err
 	}
+
+	prevNonEmptyStage := phase.StagesIterator.PrevNonEmptyStage
+	if dockerfileStage, ok := stg.(*stage.DockerfileStage); ok && dockerfileStage.IsStaged() {
+		// the staged Dockerfile stage does not depend on the previous stage of the image, only on its dependency stages
+		prevNonEmptyStage = nil
+		stageDependencies = phase.stagedDockerfileStageDependencies(digestCtx, dockerfileStage, stageDependencies)
+	}
+
+	var stageDigest string
+	if phase.Conveyor.isContentDigestMode() {
+		stageDigest = calculateContentModeDigest(digestCtx, string(stg.Name()), stageDependencies, img.GetPlatform(), prevNonEmptyStage)
+	} else {
+		stageDigest, err = calculateDigest(digestCtx, string(stg.Name()), stageDependencies, img.GetPlatform(), prevNonEmptyStage, phase.Conveyor)
+		if err != nil {
+			return false, nil, err
+		}
+	}
 	stg.SetDigest(stageDigest)
+	stopDigestTiming()
+
+	if inputs != nil {
+		phase.DigestInputsReport.addStage(img, stg, inputs)
+	}
 
+	stopLockTiming := phase.trackStageTiming(img, stg, stageTimingLock)
 	logboek.Context(ctx).Info().LogProcessInline("Locking stage %s handling", stg.LogDetailedName()).
 		Options(func(options types.LogProcessInlineOptionsInterface) {
 			if !phase.Conveyor.Parallel {
@@ -490,22 +726,21 @@ func (phase *BuildPhase) calculateStage(ctx context.Context, img *Image, stg sta
 			}
 		}).
 		Do(phase.Conveyor.GetStageDigestMutex(stg.GetDigest()).Lock)
+	stopLockTiming()
 
-	foundSuitableStage := false
-	if stages, err := phase.Conveyor.StorageManager.GetStagesByDigest(ctx, stg.LogDetailedName(), stageDigest); err != nil {
+	stopLookupTiming := phase.trackStageTiming(img, stg, stageTimingLookup)
+	foundSuitableStage, err := phase.findSuitableStage(ctx, img, stg)
+	if err != nil {
 		return false, phase.Conveyor.GetStageDigestMutex(stg.GetDigest()).Unlock, err
-	} else {
-		if stageDesc, err := phase.Conveyor.StorageManager.SelectSuitableStage(ctx, phase.Conveyor, stg, stages); err != nil {
-			return false, phase.Conveyor.GetStageDigestMutex(stg.GetDigest()).Unlock, err
-		} else if stageDesc != nil {
-			i := phase.Conveyor.GetOrCreateStageImage(castToStageImage(phase.StagesIterator.GetPrevImage(img, stg)), stageDesc.Info.Name)
-			i.SetStageDescription(stageDesc)
-			stg.SetImage(i)
-			foundSuitableStage = true
-		}
 	}
+	stopLookupTiming()
 
-	stageContentSig, err := calculateDigest(ctx, fmt.Sprintf("%s-content", stg.Name()), "", stg, phase.Conveyor)
+	var stageContentSig string
+	if phase.Conveyor.isContentDigestMode() {
+		stageContentSig, err = calculateContentModeContentDigest(ctx, stg, phase.Conveyor)
+	} else {
+		stageContentSig, err = calculateDigest(ctx, fmt.Sprintf("%s-content", stg.Name()), "", "", stg, phase.Conveyor)
+	}
 	if err != nil {
 		return false, phase.Conveyor.GetStageDigestMutex(stg.GetDigest()).Unlock, fmt.Errorf("unable to calculate stage %s content digest: %s", stg.Name(), err)
 	}
@@ -539,6 +774,10 @@ func (phase *BuildPhase) prepareStageInstructions(ctx context.Context, img *Imag
 			buildArgs = append(buildArgs, fmt.Sprintf("--label=%s=%s", key, value))
 		}
 
+		if img.GetPlatform() != "" {
+			buildArgs = append(buildArgs, fmt.Sprintf("--platform=%s", img.GetPlatform()))
+		}
+
 		stageImage.DockerfileImageBuilder().AppendBuildArgs(buildArgs...)
 
 		phase.Conveyor.AppendOnTerminateFunc(func() error {
@@ -572,9 +811,8 @@ func (phase *BuildPhase) prepareStageInstructions(ctx context.Context, img *Imag
 
 func (phase *BuildPhase) buildStage(ctx context.Context, img *Image, stg stage.Interface) error {
 	if !img.isDockerfileImage {
-		_, err := stapel.GetOrCreateContainer(ctx)
-		if err != nil {
-			return fmt.Errorf("get or create stapel container failed: %s", err)
+		if err := phase.Conveyor.ContainerRuntime.PrepareStapel(ctx); err != nil {
+			return fmt.Errorf("unable to prepare stapel: %s", err)
 		}
 	}
 
@@ -622,11 +860,20 @@ func (phase *BuildPhase) atomicBuildStageImage(ctx context.Context, img *Image,
 		time.Sleep(time.Duration(seconds) * time.Second)
 	}
 
-	if err := logboek.Context(ctx).Streams().DoErrorWithTag(fmt.Sprintf("%s/%s", img.LogName(), stg.Name()), img.LogTagStyle(), func() error {
-		return stageImage.Build(ctx, phase.ImageBuildOptions)
+	if err := phase.doWithStageRetry(ctx, stg, stageRetryBuild, func() error {
+		return logboek.Context(ctx).Streams().DoErrorWithTag(fmt.Sprintf("%s/%s", img.LogName(), stg.Name()), img.LogTagStyle(), func() error {
+			return stageImage.Build(ctx, phase.ImageBuildOptions)
+		})
+	}, func(_ error) error {
+		return castToStageImage(stageImage).CleanupFailedBuild(ctx)
 	}); err != nil {
 		return fmt.Errorf("failed to build image for stage %s with digest %s: %s", stg.Name(), stg.GetDigest(), err)
 	}
+	phase.addStageBuildStepTimings(img, stg)
+
+	if err := phase.markStageUnstored(ctx, stg); err != nil {
+		return err
+	}
 
 	if v := os.Getenv("WERF_TEST_ATOMIC_STAGE_BUILD__SLEEP_SECONDS_BEFORE_STAGE_SAVE"); v != "" {
 		seconds := 0
@@ -635,11 +882,38 @@ func (phase *BuildPhase) atomicBuildStageImage(ctx context.Context, img *Image,
 		time.Sleep(time.Duration(seconds) * time.Second)
 	}
 
-	if lock, err := phase.Conveyor.StorageLockManager.LockStage(ctx, phase.Conveyor.projectName(), stg.GetDigest()); err != nil {
+	return phase.atomicStoreStageImage(ctx, img, stg)
+}
+
+// atomicStoreStageImage stores the built stage image into the stages storage or discards it if the suitable stage has been stored by another process
+func (phase *BuildPhase) atomicStoreStageImage(ctx context.Context, img *Image, stg stage.Interface) error {
+	if err := phase.storeStageImage(ctx, img, stg); err != nil {
+		return err
+	}
+
+	phase.unmarkStageUnstored(ctx, stg)
+
+	return nil
+}
+
+func (phase *BuildPhase) storeStageImage(ctx context.Context, img *Image, stg stage.Interface) error {
+	stageImage := stg.GetImage()
+
+	stopLockTiming := phase.trackStageTiming(img, stg, stageTimingLock)
+	var lock storage.LockHandle
+	lockStageFunc := func() error {
+		return phase.doWithStageRetry(ctx, stg, stageRetryStore, func() error {
+			var err error
+			lock, err = phase.Conveyor.StorageLockManager.LockStage(ctx, phase.Conveyor.projectName(), stg.GetDigest())
+			return err
+		}, nil)
+	}
+	if err := lockStageFunc(); err != nil {
 		return fmt.Errorf("unable to lock project %s digest %s: %s", phase.Conveyor.projectName(), stg.GetDigest(), err)
-	} else {
-		defer phase.Conveyor.StorageLockManager.Unlock(ctx, lock)
 	}
+	// the lock is reacquired if the lease has been lost
+	defer func() { phase.Conveyor.StorageLockManager.Unlock(ctx, lock) }()
+	stopLockTiming()
 
 	if stages, err := phase.Conveyor.StorageManager.GetStagesByDigest(ctx, stg.LogDetailedName(), stg.GetDigest()); err != nil {
 		return err
@@ -663,8 +937,23 @@ func (phase *BuildPhase) atomicBuildStageImage(ctx context.Context, img *Image,
 			stageImageObj.SetName(newStageImageName)
 			phase.Conveyor.SetStageImage(stageImageObj)
 
+			stopStoreTiming := phase.trackStageTiming(img, stg, stageTimingStore)
 			if err := logboek.Context(ctx).Info().LogProcess("Store stage").DoError(func() error {
-				if err := phase.Conveyor.StorageManager.StagesStorage.StoreImage(ctx, &container_runtime.DockerImage{Image: stageImage}); err != nil {
+				if err := phase.doWithStageRetry(ctx, stg, stageRetryStore, func() error {
+					return phase.Conveyor.StorageManager.StagesStorage.StoreImage(ctx, &container_runtime.DockerImage{Image: stageImage})
+				}, func(err error) error {
+					if !isLockLeaseLostError(err) {
+						return nil
+					}
+
+					logboek.Context(ctx).Warn().LogF("WARNING: the lock of stage %s has been lost, reacquiring the lock\n", stg.LogDetailedName())
+					phase.Conveyor.StorageLockManager.Unlock(ctx, lock)
+					if err := lockStageFunc(); err != nil {
+						return fmt.Errorf("unable to lock project %s digest %s: %s", phase.Conveyor.projectName(), stg.GetDigest(), err)
+					}
+
+					return nil
+				}); err != nil {
 					return fmt.Errorf("unable to store stage %s digest %s image %s into repo %s: %s", stg.LogDetailedName(), stg.GetDigest(), stageImage.Name(), phase.Conveyor.StorageManager.StagesStorage.String(), err)
 				}
 				if desc, err := phase.Conveyor.StorageManager.StagesStorage.GetStageDescription(ctx, phase.Conveyor.projectName(), stg.GetDigest(), uniqueID); err != nil {
@@ -676,6 +965,7 @@ func (phase *BuildPhase) atomicBuildStageImage(ctx context.Context, img *Image,
 			}); err != nil {
 				return err
 			}
+			stopStoreTiming()
 
 			var stageIDs []image.StageID
 			for _, stageDesc := range stages {
@@ -755,8 +1045,14 @@ func byteCountBinary(b int64) string {
 	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
-func calculateDigest(ctx context.Context, stageName, stageDependencies string, prevNonEmptyStage stage.Interface, conveyor *Conveyor) (string, error) {
+func calculateDigest(ctx context.Context, stageName, stageDependencies, platform string, prevNonEmptyStage stage.Interface, conveyor *Conveyor) (string, error) {
 	checksumArgs := []string{image.BuildCacheVersion, stageName, stageDependencies}
+	checksumArgsNames := []string{
+		"BuildCacheVersion",
+		"stageName",
+		"stageDependencies",
+	}
+
 	if prevNonEmptyStage != nil {
 		prevStageDependencies, err := prevNonEmptyStage.GetNextStageDependencies(ctx, conveyor)
 		if err != nil {
@@ -764,19 +1060,23 @@ func calculateDigest(ctx context.Context, stageName, stageDependencies string, p
 		}
 
 		checksumArgs = append(checksumArgs, prevNonEmptyStage.GetDigest(), prevStageDependencies)
+		checksumArgsNames = append(checksumArgsNames, "prevNonEmptyStage digest", "prevNonEmptyStage dependencies for next stage")
+	}
+
+	// the platform is not taken into account for single-platform images to keep the existing digests
+	if platform != "" {
+		checksumArgs = append(checksumArgs, platform)
+		checksumArgsNames = append(checksumArgsNames, "platform")
+	}
+
+	for ind, checksumArg := range checksumArgs {
+		digest_inputs.Record(ctx, checksumArgsNames[ind], checksumArg)
 	}
 
 	digest := util.Sha3_224Hash(checksumArgs...)
 
 	blockMsg := fmt.Sprintf("Stage %s digest %s", stageName, digest)
 	logboek.Context(ctx).Debug().LogBlock(blockMsg).Do(func() {
-		checksumArgsNames := []string{
-			"BuildCacheVersion",
-			"stageName",
-			"stageDependencies",
-			"prevNonEmptyStage digest",
-			"prevNonEmptyStage dependencies for next stage",
-		}
 		for ind, checksumArg := range checksumArgs {
 			logboek.Context(ctx).Debug().LogF("%s => %q\n", checksumArgsNames[ind], checksumArg)
 		}
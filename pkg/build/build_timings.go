@@ -0,0 +1,178 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/werf/werf/pkg/build/stage"
+)
+
+type ReportStageStatus string
+
+const (
+	ReportStageCached ReportStageStatus = "cached"
+	ReportStageCopied ReportStageStatus = "copied"
+	ReportStageBuilt  ReportStageStatus = "built"
+)
+
+const (
+	stageTimingDigest = "digest"
+	stageTimingLock   = "lock"
+	stageTimingLookup = "lookup"
+	stageTimingFetch  = "fetch"
+	stageTimingStore  = "store"
+)
+
+// ReportStageRecord is the stage processed by the build with the timings of the stage handling steps
+type ReportStageRecord struct {
+	ImageName string
+	Platform  string `json:",omitempty"`
+	StageName string
+	Digest    string
+	Status    ReportStageStatus
+	Size      int64
+	SizeDelta int64
+	Timings   []*ReportStageTiming
+
+	img *Image
+}
+
+// ReportStageTiming is the stage handling step: digest calculation, lock wait, stages lookup, fetch, container run, commit or store into the repo
+type ReportStageTiming struct {
+	Name            string
+	Start           time.Time
+	DurationSeconds float64
+}
+
+func (record *ReportStageRecord) traceThreadName() string {
+	if record.Platform != "" {
+		return fmt.Sprintf("%s [%s]", record.ImageName, record.Platform)
+	}
+	return record.ImageName
+}
+
+func (report *ImagesReport) getOrCreateStageRecord(img *Image, stageName string) *ReportStageRecord {
+	for _, record := range report.Stages {
+		if record.img == img && record.StageName == stageName {
+			return record
+		}
+	}
+
+	record := &ReportStageRecord{ImageName: img.GetName(), Platform: img.GetPlatform(), StageName: stageName, img: img}
+	report.Stages = append(report.Stages, record)
+
+	return record
+}
+
+func (report *ImagesReport) addStageTiming(img *Image, stg stage.Interface, name string, start time.Time, duration time.Duration) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	record := report.getOrCreateStageRecord(img, string(stg.Name()))
+	record.Timings = append(record.Timings, &ReportStageTiming{Name: name, Start: start, DurationSeconds: duration.Seconds()})
+}
+
+func (report *ImagesReport) setStageResult(img *Image, stg stage.Interface, status ReportStageStatus, prevStageImageSize int64) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	record := report.getOrCreateStageRecord(img, string(stg.Name()))
+	record.Digest = stg.GetDigest()
+	record.Status = status
+	if desc := stg.GetImage().GetStageDescription(); desc != nil {
+		record.Size = desc.Info.Size
+		record.SizeDelta = desc.Info.Size - prevStageImageSize
+	}
+}
+
+// trackStageTiming starts the timing of the stage handling step, the returned func stops it and adds the timing into the report
+func (phase *BuildPhase) trackStageTiming(img *Image, stg stage.Interface, name string) func() {
+	start := time.Now()
+	return func() {
+		phase.ImagesReport.addStageTiming(img, stg, name, start, time.Since(start))
+	}
+}
+
+func (phase *BuildPhase) addStageBuildStepTimings(img *Image, stg stage.Interface) {
+	for _, step := range castToStageImage(stg.GetImage()).GetBuildStepTimings() {
+		phase.ImagesReport.addStageTiming(img, stg, step.Name, step.Start, step.Duration)
+	}
+}
+
+type traceEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat,omitempty"`
+	Phase     string            `json:"ph"`
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur,omitempty"`
+	Pid       int               `json:"pid"`
+	Tid       int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// ToTraceData returns the stage timings in the Chrome trace event format (chrome://tracing, Perfetto), each image is a separate thread
+func (report *ImagesReport) ToTraceData() ([]byte, error) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	var startTime time.Time
+	for _, record := range report.Stages {
+		for _, timing := range record.Timings {
+			if startTime.IsZero() || timing.Start.Before(startTime) {
+				startTime = timing.Start
+			}
+		}
+	}
+
+	tids := map[string]int{}
+	var threadNames []string
+	for _, record := range report.Stages {
+		threadName := record.traceThreadName()
+		if _, hasKey := tids[threadName]; !hasKey {
+			tids[threadName] = len(tids) + 1
+			threadNames = append(threadNames, threadName)
+		}
+	}
+
+	events := []*traceEvent{}
+	for _, threadName := range threadNames {
+		events = append(events, &traceEvent{Name: "thread_name", Phase: "M", Pid: 1, Tid: tids[threadName], Args: map[string]string{"name": threadName}})
+	}
+
+	var durationEvents []*traceEvent
+	for _, record := range report.Stages {
+		threadName := record.traceThreadName()
+		for _, timing := range record.Timings {
+			durationEvents = append(durationEvents, &traceEvent{
+				Name:      fmt.Sprintf("%s %s", record.StageName, timing.Name),
+				Category:  timing.Name,
+				Phase:     "X",
+				Timestamp: timing.Start.Sub(startTime).Microseconds(),
+				Duration:  int64(timing.DurationSeconds * float64(time.Second/time.Microsecond)),
+				Pid:       1,
+				Tid:       tids[threadName],
+				Args: map[string]string{
+					"image":  record.ImageName,
+					"stage":  record.StageName,
+					"digest": record.Digest,
+					"status": string(record.Status),
+				},
+			})
+		}
+	}
+
+	sort.SliceStable(durationEvents, func(i, j int) bool {
+		return durationEvents[i].Timestamp < durationEvents[j].Timestamp
+	})
+	events = append(events, durationEvents...)
+
+	data, err := json.MarshalIndent(map[string]interface{}{"traceEvents": events, "displayTimeUnit": "ms"}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, []byte("\n")...)
+
+	return data, nil
+}
@@ -0,0 +1,100 @@
+package build
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type testTraceData struct {
+	TraceEvents     []*traceEvent `json:"traceEvents"`
+	DisplayTimeUnit string        `json:"displayTimeUnit"`
+}
+
+func parseTestTraceData(t *testing.T, report *ImagesReport) *testTraceData {
+	data, err := report.ToTraceData()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	traceData := &testTraceData{}
+	if err := json.Unmarshal(data, traceData); err != nil {
+		t.Fatalf("unable to unmarshal trace data: %s\n%s", err, data)
+	}
+
+	return traceData
+}
+
+func TestToTraceDataEmpty(t *testing.T) {
+	traceData := parseTestTraceData(t, &ImagesReport{Images: map[string]ReportImageRecord{}})
+
+	if traceData.TraceEvents == nil || len(traceData.TraceEvents) != 0 {
+		t.Errorf("expected empty list of events, got %v", traceData.TraceEvents)
+	}
+
+	if traceData.DisplayTimeUnit != "ms" {
+		t.Errorf("expected display time unit ms, got %q", traceData.DisplayTimeUnit)
+	}
+}
+
+func TestToTraceData(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	report := &ImagesReport{
+		Images: map[string]ReportImageRecord{},
+		Stages: []*ReportStageRecord{
+			{
+				ImageName: "backend",
+				StageName: "install",
+				Digest:    "digest-install",
+				Status:    ReportStageBuilt,
+				Timings: []*ReportStageTiming{
+					{Name: stageTimingDigest, Start: start.Add(2 * time.Second), DurationSeconds: 0.5},
+					{Name: "run", Start: start.Add(3 * time.Second), DurationSeconds: 10},
+				},
+			},
+			{
+				ImageName: "frontend",
+				Platform:  "linux/arm64",
+				StageName: "from",
+				Digest:    "digest-from",
+				Status:    ReportStageCached,
+				Timings: []*ReportStageTiming{
+					{Name: stageTimingLookup, Start: start.Add(time.Second), DurationSeconds: 0.25},
+				},
+			},
+			{
+				ImageName: "backend",
+				StageName: "from",
+				Digest:    "digest-from",
+				Status:    ReportStageCopied,
+				Timings: []*ReportStageTiming{
+					{Name: stageTimingFetch, Start: start, DurationSeconds: 1},
+				},
+			},
+		},
+	}
+
+	traceData := parseTestTraceData(t, report)
+
+	expected := []*traceEvent{
+		{Name: "thread_name", Phase: "M", Pid: 1, Tid: 1, Args: map[string]string{"name": "backend"}},
+		{Name: "thread_name", Phase: "M", Pid: 1, Tid: 2, Args: map[string]string{"name": "frontend [linux/arm64]"}},
+		{Name: "from fetch", Category: stageTimingFetch, Phase: "X", Timestamp: 0, Duration: 1000000, Pid: 1, Tid: 1, Args: map[string]string{"image": "backend", "stage": "from", "digest": "digest-from", "status": "copied"}},
+		{Name: "from lookup", Category: stageTimingLookup, Phase: "X", Timestamp: 1000000, Duration: 250000, Pid: 1, Tid: 2, Args: map[string]string{"image": "frontend", "stage": "from", "digest": "digest-from", "status": "cached"}},
+		{Name: "install digest", Category: stageTimingDigest, Phase: "X", Timestamp: 2000000, Duration: 500000, Pid: 1, Tid: 1, Args: map[string]string{"image": "backend", "stage": "install", "digest": "digest-install", "status": "built"}},
+		{Name: "install run", Category: "run", Phase: "X", Timestamp: 3000000, Duration: 10000000, Pid: 1, Tid: 1, Args: map[string]string{"image": "backend", "stage": "install", "digest": "digest-install", "status": "built"}},
+	}
+
+	if len(traceData.TraceEvents) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(traceData.TraceEvents))
+	}
+
+	for ind, event := range traceData.TraceEvents {
+		expectedData, _ := json.Marshal(expected[ind])
+		eventData, _ := json.Marshal(event)
+		if string(expectedData) != string(eventData) {
+			t.Errorf("event %d:\nexpected %s\ngot      %s", ind, expectedData, eventData)
+		}
+	}
+}
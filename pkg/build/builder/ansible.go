@@ -16,6 +16,7 @@ import (
 
 	"github.com/werf/logboek"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/config"
 	"github.com/werf/werf/pkg/stapel"
 	"github.com/werf/werf/pkg/util"
@@ -29,6 +30,7 @@ type Ansible struct {
 type Extra struct {
 	ContainerWerfPath string
 	TmpPath           string
+	Secrets           []*BuildSecret
 }
 
 func NewAnsibleBuilder(config *config.Ansible, extra *Extra) *Ansible {
@@ -110,12 +112,11 @@ func (b *Ansible) stage(ctx context.Context, userStageName string, container Con
 		fmt.Sprintf("%s:%s:ro", stageHostWorkDir, b.containerWorkDir()),
 		fmt.Sprintf("%s:%s:rw", stageHostTmpDir, b.containerTmpDir()),
 	)
-
-	containerName, err := stapel.GetOrCreateContainer(ctx)
-	if err != nil {
+	if err := addSecretsVolumes(container, b.extra.Secrets); err != nil {
 		return err
 	}
-	container.AddVolumeFrom(fmt.Sprintf("%s:ro", containerName))
+
+	container.AddVolumeFrom(fmt.Sprintf("%s:ro", stapel.ContainerName()))
 
 	commandParts := []string{
 		path.Join(b.containerWorkDir(), "ansible-playbook"),
@@ -145,7 +146,7 @@ func (b *Ansible) stageChecksum(ctx context.Context, userStageName string) strin
 		if err != nil {
 			panic(fmt.Sprintf("runtime err: %s", err))
 		}
-		checksumArgs = append(checksumArgs, string(jsonOutput))
+		checksumArgs = digest_inputs.Append(ctx, checksumArgs, fmt.Sprintf("ansible %s task", userStageName), string(jsonOutput))
 	}
 
 	if debugUserStageChecksum() {
@@ -157,7 +158,14 @@ func (b *Ansible) stageChecksum(ctx context.Context, userStageName string) strin
 			logboek.Context(ctx).Debug().LogFHighlight("DEBUG: %s stage version checksum %v\n", userStageName, stageVersionChecksum)
 		}
 
-		checksumArgs = append(checksumArgs, stageVersionChecksum)
+		checksumArgs = digest_inputs.Append(ctx, checksumArgs, fmt.Sprintf("ansible %s cacheVersion checksum", userStageName), stageVersionChecksum)
+	}
+
+	// the secrets version is taken into account only for the non-empty stage
+	if len(checksumArgs) != 0 {
+		if secretsVersion := secretsVersionChecksum(b.extra.Secrets); secretsVersion != "" {
+			checksumArgs = digest_inputs.Append(ctx, checksumArgs, fmt.Sprintf("ansible %s secrets version", userStageName), secretsVersion)
+		}
 	}
 
 	if len(checksumArgs) != 0 {
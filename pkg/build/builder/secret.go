@@ -0,0 +1,66 @@
+package builder
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ContainerSecretsDir is the directory of the build secrets in the build container
+const ContainerSecretsDir = "/run/secrets"
+
+// BuildSecret is the build secret written into the host file, which is mounted into the build container read-only.
+// The secret value never lands in the image layers or the stage digest, only the Version does if set.
+type BuildSecret struct {
+	Id      string
+	Version string
+
+	writeHostFileFunc func() (string, error)
+	hostPath          string
+	hostPathErr       error
+	hostPathOnce      sync.Once
+}
+
+// NewBuildSecret returns the secret, which value is read and written into the host file by writeHostFileFunc only when the stage using the secret is being built
+func NewBuildSecret(id, version string, writeHostFileFunc func() (string, error)) *BuildSecret {
+	return &BuildSecret{Id: id, Version: version, writeHostFileFunc: writeHostFileFunc}
+}
+
+// GetHostPath writes the secret into the host file on the first call and returns the path of the file
+func (s *BuildSecret) GetHostPath() (string, error) {
+	s.hostPathOnce.Do(func() {
+		s.hostPath, s.hostPathErr = s.writeHostFileFunc()
+	})
+
+	return s.hostPath, s.hostPathErr
+}
+
+func addSecretsVolumes(container Container, secrets []*BuildSecret) error {
+	for _, secret := range secrets {
+		hostPath, err := secret.GetHostPath()
+		if err != nil {
+			return err
+		}
+
+		container.AddVolume(fmt.Sprintf("%s:%s:ro", hostPath, path.Join(ContainerSecretsDir, secret.Id)))
+	}
+
+	return nil
+}
+
+// secretsVersionChecksum returns the checksum of the secret versions or empty string if there are no versions
+func secretsVersionChecksum(secrets []*BuildSecret) string {
+	var versions []string
+	for _, secret := range secrets {
+		if secret.Version != "" {
+			versions = append(versions, fmt.Sprintf("%s=%s", secret.Id, secret.Version))
+		}
+	}
+
+	if len(versions) == 0 {
+		return ""
+	}
+
+	return strings.Join(versions, " ")
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/werf/logboek"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/config"
 	"github.com/werf/werf/pkg/stapel"
 	"github.com/werf/werf/pkg/util"
@@ -71,6 +72,9 @@ func (b *Shell) stage(userStageName string, container Container) error {
 	container.AddVolume(
 		fmt.Sprintf("%s:%s:rw", stageHostTmpDir, b.containerTmpDir()),
 	)
+	if err := addSecretsVolumes(container, b.extra.Secrets); err != nil {
+		return err
+	}
 
 	stageHostTmpScriptFilePath := filepath.Join(stageHostTmpDir, scriptFileName)
 	containerTmpScriptFilePath := path.Join(b.containerTmpDir(), scriptFileName)
@@ -86,7 +90,9 @@ func (b *Shell) stage(userStageName string, container Container) error {
 func (b *Shell) stageChecksum(ctx context.Context, userStageName string) string {
 	var checksumArgs []string
 
-	checksumArgs = append(checksumArgs, b.stageCommands(userStageName)...)
+	for _, command := range b.stageCommands(userStageName) {
+		checksumArgs = digest_inputs.Append(ctx, checksumArgs, fmt.Sprintf("shell %s command", userStageName), command)
+	}
 
 	if debugUserStageChecksum() {
 		logboek.Context(ctx).Debug().LogFHighlight("DEBUG: %s stage tasks checksum dependencies %v\n", userStageName, checksumArgs)
@@ -96,7 +102,14 @@ func (b *Shell) stageChecksum(ctx context.Context, userStageName string) string
 		if debugUserStageChecksum() {
 			logboek.Context(ctx).Debug().LogFHighlight("DEBUG: %s stage version checksum %v\n", userStageName, stageVersionChecksum)
 		}
-		checksumArgs = append(checksumArgs, stageVersionChecksum)
+		checksumArgs = digest_inputs.Append(ctx, checksumArgs, fmt.Sprintf("shell %s cacheVersion checksum", userStageName), stageVersionChecksum)
+	}
+
+	// the secrets version is taken into account only for the non-empty stage
+	if len(checksumArgs) != 0 {
+		if secretsVersion := secretsVersionChecksum(b.extra.Secrets); secretsVersion != "" {
+			checksumArgs = digest_inputs.Append(ctx, checksumArgs, fmt.Sprintf("shell %s secrets version", userStageName), secretsVersion)
+		}
 	}
 
 	if len(checksumArgs) != 0 {
@@ -0,0 +1,30 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	"github.com/werf/werf/pkg/build/digest_inputs"
+	"github.com/werf/werf/pkg/config"
+	"github.com/werf/werf/pkg/util"
+)
+
+func TestShellStageChecksumDigestInputs(t *testing.T) {
+	b := NewShellBuilder(&config.Shell{
+		Install:             []string{"apt-get update", "apt-get install -y curl"},
+		InstallCacheVersion: "2",
+		CacheVersion:        "1",
+	}, &Extra{Secrets: []*BuildSecret{{Id: "npmrc", Version: "3"}, {Id: "token"}}})
+
+	inputs := &digest_inputs.Inputs{}
+	checksum := b.stageChecksum(digest_inputs.NewContext(context.Background(), inputs), "Install")
+
+	expected := util.Sha256Hash("apt-get update", "apt-get install -y curl", util.Sha256Hash("2", "1"), "npmrc=3")
+	if checksum != expected {
+		t.Errorf("expected checksum %s, got %s", expected, checksum)
+	}
+
+	if recorded := util.Sha256Hash(inputs.Args()...); recorded != checksum {
+		t.Errorf("expected recorded inputs %v to reproduce checksum %s, got %s", inputs.Args(), checksum, recorded)
+	}
+}
@@ -0,0 +1,151 @@
+package build
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage"
+)
+
+// findSuitableStage selects the suitable stage by the stage digest in the primary stages storage first and then in the cache stages storages
+func (phase *BuildPhase) findSuitableStage(ctx context.Context, img *Image, stg stage.Interface) (bool, error) {
+	stages, err := phase.Conveyor.StorageManager.GetStagesByDigest(ctx, stg.LogDetailedName(), stg.GetDigest())
+	if err != nil {
+		return false, err
+	}
+
+	stageDesc, err := phase.Conveyor.StorageManager.SelectSuitableStage(ctx, phase.Conveyor, stg, stages)
+	if err != nil {
+		return false, err
+	} else if stageDesc != nil {
+		i := phase.Conveyor.GetOrCreateStageImage(castToStageImage(phase.StagesIterator.GetPrevImage(img, stg)), stageDesc.Info.Name)
+		i.SetStageDescription(stageDesc)
+		stg.SetImage(i)
+		return true, nil
+	}
+
+	return phase.findStageInCacheStagesStorageList(ctx, img, stg)
+}
+
+// findStageInCacheStagesStorageList selects the suitable stage in the read-only cache stages storages (--cache-from-repo).
+// The found stage is not fetched: the stage image is copied into the primary stages storage only when it is needed (see Conveyor.FetchStage)
+func (phase *BuildPhase) findStageInCacheStagesStorageList(ctx context.Context, img *Image, stg stage.Interface) (bool, error) {
+	for _, cacheStagesStorage := range phase.Conveyor.StorageManager.CacheStagesStorageList {
+		stages, err := phase.Conveyor.StorageManager.GetStagesByDigestFromStagesStorage(ctx, stg.LogDetailedName(), stg.GetDigest(), cacheStagesStorage)
+		if err != nil {
+			return false, err
+		}
+
+		stageDesc, err := phase.Conveyor.StorageManager.SelectSuitableStage(ctx, phase.Conveyor, stg, stages)
+		if err != nil {
+			return false, err
+		} else if stageDesc == nil {
+			continue
+		}
+
+		i := phase.Conveyor.GetOrCreateStageImage(castToStageImage(phase.StagesIterator.GetPrevImage(img, stg)), stageDesc.Info.Name)
+		i.SetStageDescription(stageDesc)
+		stg.SetImage(i)
+
+		phase.Conveyor.setCacheStagesStorage(stageDesc.Info.Name, cacheStagesStorage)
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// FetchStage fetches the stage image from the primary stages storage.
+// The stage found in the cache stages storage is copied into the primary stages storage first.
+func (c *Conveyor) FetchStage(ctx context.Context, stg stage.Interface) error {
+	if err := c.copyStageFromCacheStagesStorage(ctx, stg); err != nil {
+		return err
+	}
+
+	return c.StorageManager.FetchStage(ctx, stg)
+}
+
+func (c *Conveyor) setCacheStagesStorage(stageImageName string, cacheStagesStorage storage.StagesStorage) {
+	c.getServiceRWMutex("CacheStagesStorage").Lock()
+	defer c.getServiceRWMutex("CacheStagesStorage").Unlock()
+
+	c.cacheStagesStorageByStageImageName[stageImageName] = cacheStagesStorage
+}
+
+func (c *Conveyor) getCacheStagesStorage(stageImageName string) storage.StagesStorage {
+	c.getServiceRWMutex("CacheStagesStorage").RLock()
+	defer c.getServiceRWMutex("CacheStagesStorage").RUnlock()
+
+	return c.cacheStagesStorageByStageImageName[stageImageName]
+}
+
+func (c *Conveyor) unsetCacheStagesStorage(stageImageName string) {
+	c.getServiceRWMutex("CacheStagesStorage").Lock()
+	defer c.getServiceRWMutex("CacheStagesStorage").Unlock()
+
+	delete(c.cacheStagesStorageByStageImageName, stageImageName)
+}
+
+// copyStageFromCacheStagesStorage copies the stage image from the cache stages storage into the primary stages storage and renames the stage image, which is shared by all stages with the same digest
+func (c *Conveyor) copyStageFromCacheStagesStorage(ctx context.Context, stg stage.Interface) error {
+	cacheStageImageName := stg.GetImage().Name()
+
+	c.getServiceRWMutex("CacheStage" + cacheStageImageName).Lock()
+	defer c.getServiceRWMutex("CacheStage" + cacheStageImageName).Unlock()
+
+	cacheStagesStorage := c.getCacheStagesStorage(cacheStageImageName)
+	if cacheStagesStorage == nil {
+		return nil
+	}
+
+	stageImage := c.GetStageImage(cacheStageImageName)
+	cacheStageDesc := stageImage.GetStageDescription()
+
+	if lock, err := c.StorageLockManager.LockStage(ctx, c.projectName(), cacheStageDesc.StageID.Digest); err != nil {
+		return fmt.Errorf("unable to lock project %s digest %s: %s", c.projectName(), cacheStageDesc.StageID.Digest, err)
+	} else {
+		defer c.StorageLockManager.Unlock(ctx, lock)
+	}
+
+	stages, err := c.StorageManager.GetStagesByDigest(ctx, stg.LogDetailedName(), cacheStageDesc.StageID.Digest)
+	if err != nil {
+		return err
+	}
+
+	var stageIDs []image.StageID
+	var copiedStageDesc *image.StageDescription
+	for _, stageDesc := range stages {
+		stageIDs = append(stageIDs, *stageDesc.StageID)
+		if stageDesc.StageID.UniqueID == cacheStageDesc.StageID.UniqueID {
+			copiedStageDesc = stageDesc
+		}
+	}
+
+	// the stage can be copied by another werf process
+	if copiedStageDesc == nil {
+		if err := logboek.Context(ctx).Default().LogProcess("Copy stage %s from %s", stg.LogDetailedName(), cacheStagesStorage.String()).DoError(func() error {
+			copiedStageDesc, err = c.StorageManager.CopySuitableByDigestStage(ctx, cacheStageDesc, cacheStagesStorage, c.StorageManager.StagesStorage, c.ContainerRuntime)
+			return err
+		}); err != nil {
+			return fmt.Errorf("unable to copy stage %s from %s to %s: %s", cacheStageDesc.StageID.String(), cacheStagesStorage.String(), c.StorageManager.StagesStorage.String(), err)
+		}
+
+		stageIDs = append(stageIDs, *copiedStageDesc.StageID)
+		if err := c.StorageManager.AtomicStoreStagesByDigestToCache(ctx, string(stg.Name()), cacheStageDesc.StageID.Digest, stageIDs); err != nil {
+			return err
+		}
+	}
+
+	c.UnsetStageImage(stageImage.Name())
+	stageImage.SetName(copiedStageDesc.Info.Name)
+	stageImage.SetStageDescription(copiedStageDesc)
+	c.SetStageImage(stageImage)
+
+	c.unsetCacheStagesStorage(cacheStageImageName)
+
+	return nil
+}
@@ -0,0 +1,388 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/config"
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage"
+	"github.com/werf/werf/pkg/storage/lrumeta"
+	"github.com/werf/werf/pkg/storage/manager"
+	"github.com/werf/werf/pkg/werf"
+)
+
+const cacheTestDigest = "c3b1b7e0d9b5a8b1b4e4c0f0f1e0d9b5a8b1b4e4c0f0f1e0d9b5a8b1"
+
+// cacheTestStagesStorage keeps the stage descriptions in memory and records the calls of the stages storage methods
+type cacheTestStagesStorage struct {
+	storage.StagesStorage
+
+	name     string
+	fetchErr error
+
+	mux    sync.Mutex
+	stages map[image.StageID]*image.StageDescription
+	calls  []string
+}
+
+func newCacheTestStagesStorage(name string, uniqueIDs ...int64) *cacheTestStagesStorage {
+	s := &cacheTestStagesStorage{name: name, stages: map[image.StageID]*image.StageDescription{}}
+	for _, uniqueID := range uniqueIDs {
+		s.addStage(image.StageID{Digest: cacheTestDigest, UniqueID: uniqueID})
+	}
+	return s
+}
+
+func (s *cacheTestStagesStorage) addStage(stageID image.StageID) {
+	s.stages[stageID] = &image.StageDescription{
+		StageID: &image.StageID{Digest: stageID.Digest, UniqueID: stageID.UniqueID},
+		Info:    &image.Info{Name: s.ConstructStageImageName("", stageID.Digest, stageID.UniqueID), ID: "sha256:" + stageID.String()},
+	}
+}
+
+func (s *cacheTestStagesStorage) recordCall(format string, a ...interface{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.calls = append(s.calls, fmt.Sprintf(format, a...))
+}
+
+func (s *cacheTestStagesStorage) getCalls() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *cacheTestStagesStorage) GetStagesIDsByDigest(_ context.Context, _, digest string) ([]image.StageID, error) {
+	s.recordCall("get stages %s", digest)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var ids []image.StageID
+	for id := range s.stages {
+		if id.Digest == digest {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *cacheTestStagesStorage) GetStageDescription(_ context.Context, _, digest string, uniqueID int64) (*image.StageDescription, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.stages[image.StageID{Digest: digest, UniqueID: uniqueID}], nil
+}
+
+func (s *cacheTestStagesStorage) ConstructStageImageName(_, digest string, uniqueID int64) string {
+	return fmt.Sprintf("%s:%s-%d", s.name, digest, uniqueID)
+}
+
+func (s *cacheTestStagesStorage) FetchImage(_ context.Context, img container_runtime.Image) error {
+	s.recordCall("fetch %s", img.(*container_runtime.DockerImage).Image.Name())
+	return s.fetchErr
+}
+
+func (s *cacheTestStagesStorage) ShouldFetchImage(_ context.Context, _ container_runtime.Image) (bool, error) {
+	return false, nil
+}
+
+func (s *cacheTestStagesStorage) StoreImage(_ context.Context, img container_runtime.Image) error {
+	name := img.(*container_runtime.DockerImage).Image.Name()
+	s.recordCall("store %s", name)
+
+	tag := name[strings.LastIndex(name, ":")+1:]
+	uniqueID, err := strconv.ParseInt(tag[strings.LastIndex(tag, "-")+1:], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.addStage(image.StageID{Digest: tag[:strings.LastIndex(tag, "-")], UniqueID: uniqueID})
+
+	return nil
+}
+
+func (s *cacheTestStagesStorage) RejectStage(_ context.Context, _, digest string, uniqueID int64) error {
+	s.recordCall("reject %s-%d", digest, uniqueID)
+	return nil
+}
+
+func (s *cacheTestStagesStorage) String() string {
+	return s.name
+}
+
+func (s *cacheTestStagesStorage) Address() string {
+	return storage.LocalStorageAddress
+}
+
+// cacheTestRuntime records the renamed images
+type cacheTestRuntime struct {
+	container_runtime.ContainerRuntime
+
+	renames []string
+}
+
+func (runtime *cacheTestRuntime) RenameImage(_ context.Context, img container_runtime.Image, newImageName string, _ bool) error {
+	dockerImage := img.(*container_runtime.DockerImage)
+	runtime.renames = append(runtime.renames, fmt.Sprintf("%s %s", dockerImage.Image.Name(), newImageName))
+	dockerImage.Image.SetName(newImageName)
+	return nil
+}
+
+// cacheTestStage selects the stage with the highest unique id
+type cacheTestStage struct {
+	stage.Interface
+
+	image container_runtime.ImageInterface
+}
+
+func (s *cacheTestStage) Name() stage.StageName {
+	return stage.Install
+}
+
+func (s *cacheTestStage) LogDetailedName() string {
+	return string(s.Name())
+}
+
+func (s *cacheTestStage) GetDigest() string {
+	return cacheTestDigest
+}
+
+func (s *cacheTestStage) SelectSuitableStage(_ context.Context, _ stage.Conveyor, stages []*image.StageDescription) (*image.StageDescription, error) {
+	var res *image.StageDescription
+	for _, stageDesc := range stages {
+		if res == nil || stageDesc.StageID.UniqueID > res.StageID.UniqueID {
+			res = stageDesc
+		}
+	}
+	return res, nil
+}
+
+func (s *cacheTestStage) SetImage(img container_runtime.ImageInterface) {
+	s.image = img
+}
+
+func (s *cacheTestStage) GetImage() container_runtime.ImageInterface {
+	return s.image
+}
+
+func newCacheTestBuildPhase(t *testing.T, primary, cache *cacheTestStagesStorage) (*BuildPhase, *cacheTestRuntime) {
+	if err := werf.Init(t.TempDir(), t.TempDir()); err != nil {
+		t.Fatalf("unable to init werf: %s", err)
+	}
+
+	if err := lrumeta.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	storageLockManager := storage.NewGenericLockManager(werf.GetHostLocker())
+	storageManager := manager.NewStorageManager("myproject", primary, nil, storageLockManager, storage.NewFileStagesStorageCache(t.TempDir()))
+	storageManager.CacheStagesStorageList = []storage.StagesStorage{cache}
+
+	runtime := &cacheTestRuntime{}
+	werfConfig := &config.WerfConfig{Meta: &config.Meta{Project: "myproject"}}
+	c := NewConveyor(werfConfig, nil, nil, t.TempDir(), t.TempDir(), "", runtime, storageManager, storageLockManager, ConveyorOptions{})
+
+	phase := NewBuildPhase(c, BuildPhaseOptions{})
+	phase.StagesIterator = NewStagesIterator(c)
+
+	return phase, runtime
+}
+
+func TestFindSuitableStageConsultsPrimaryStagesStorageFirst(t *testing.T) {
+	ctx := context.Background()
+	primary, cache := newCacheTestStagesStorage("primary", 1), newCacheTestStagesStorage("cache", 2)
+	phase, _ := newCacheTestBuildPhase(t, primary, cache)
+
+	stg := &cacheTestStage{}
+	if found, err := phase.findSuitableStage(ctx, &Image{}, stg); err != nil {
+		t.Fatal(err)
+	} else if !found {
+		t.Fatalf("expected stage to be found")
+	}
+
+	if name := stg.GetImage().Name(); name != primary.ConstructStageImageName("", cacheTestDigest, 1) {
+		t.Errorf("expected stage of the primary stages storage to be selected, got %s", name)
+	}
+
+	if calls := cache.getCalls(); len(calls) != 0 {
+		t.Errorf("expected cache stages storage not to be consulted, got calls %v", calls)
+	}
+
+	if phase.Conveyor.getCacheStagesStorage(stg.GetImage().Name()) != nil {
+		t.Errorf("expected stage of the primary stages storage not to be copied")
+	}
+}
+
+func TestFindSuitableStageNotFound(t *testing.T) {
+	ctx := context.Background()
+	primary, cache := newCacheTestStagesStorage("primary"), newCacheTestStagesStorage("cache")
+	phase, _ := newCacheTestBuildPhase(t, primary, cache)
+
+	stg := &cacheTestStage{}
+	if found, err := phase.findSuitableStage(ctx, &Image{}, stg); err != nil {
+		t.Fatal(err)
+	} else if found {
+		t.Errorf("expected stage not to be found")
+	}
+
+	if stg.GetImage() != nil {
+		t.Errorf("expected stage image not to be set, got %s", stg.GetImage().Name())
+	}
+
+	expectedCacheCalls := []string{"get stages " + cacheTestDigest}
+	if calls := cache.getCalls(); !reflect.DeepEqual(calls, expectedCacheCalls) {
+		t.Errorf("expected cache stages storage calls %v, got %v", expectedCacheCalls, calls)
+	}
+}
+
+func TestFetchStageCopiesStageFromCacheStagesStorage(t *testing.T) {
+	ctx := context.Background()
+	primary, cache := newCacheTestStagesStorage("primary"), newCacheTestStagesStorage("cache", 2)
+	phase, runtime := newCacheTestBuildPhase(t, primary, cache)
+
+	stg := &cacheTestStage{}
+	if found, err := phase.findSuitableStage(ctx, &Image{}, stg); err != nil {
+		t.Fatal(err)
+	} else if !found {
+		t.Fatalf("expected stage to be found in the cache stages storage")
+	}
+
+	cacheStageImageName := cache.ConstructStageImageName("", cacheTestDigest, 2)
+	primaryStageImageName := primary.ConstructStageImageName("", cacheTestDigest, 2)
+
+	if name := stg.GetImage().Name(); name != cacheStageImageName {
+		t.Errorf("expected stage of the cache stages storage to be selected, got %s", name)
+	}
+
+	// the found stage is not fetched until it is needed
+	if calls := cache.getCalls(); len(calls) != 1 {
+		t.Errorf("expected stage not to be fetched from the cache stages storage, got calls %v", calls)
+	}
+	if calls := primary.getCalls(); len(calls) != 1 {
+		t.Errorf("expected stage not to be stored into the primary stages storage, got calls %v", calls)
+	}
+
+	if err := phase.Conveyor.FetchStage(ctx, stg); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCacheCalls := []string{"get stages " + cacheTestDigest, "fetch " + cacheStageImageName}
+	if calls := cache.getCalls(); !reflect.DeepEqual(calls, expectedCacheCalls) {
+		t.Errorf("expected read-only cache stages storage calls %v, got %v", expectedCacheCalls, calls)
+	}
+
+	if calls := primary.getCalls(); calls[len(calls)-1] != "store "+primaryStageImageName {
+		t.Errorf("expected stage to be stored into the primary stages storage, got calls %v", calls)
+	}
+
+	if expectedRenames := []string{cacheStageImageName + " " + primaryStageImageName}; !reflect.DeepEqual(runtime.renames, expectedRenames) {
+		t.Errorf("expected renames %v, got %v", expectedRenames, runtime.renames)
+	}
+
+	if name := stg.GetImage().Name(); name != primaryStageImageName {
+		t.Errorf("expected stage image to be renamed into %s, got %s", primaryStageImageName, name)
+	}
+
+	if desc := stg.GetImage().GetStageDescription(); desc.Info.Name != primaryStageImageName {
+		t.Errorf("expected stage description of the primary stages storage, got %s", desc.Info.Name)
+	}
+
+	if phase.Conveyor.GetStageImage(cacheStageImageName) != nil || phase.Conveyor.GetStageImage(primaryStageImageName) != stg.GetImage() {
+		t.Errorf("expected stage image to be registered by the new name only")
+	}
+
+	if phase.Conveyor.getCacheStagesStorage(cacheStageImageName) != nil {
+		t.Errorf("expected copied stage not to refer the cache stages storage")
+	}
+
+	// the stage is copied only once
+	if err := phase.Conveyor.FetchStage(ctx, stg); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := cache.getCalls(); len(calls) != len(expectedCacheCalls) {
+		t.Errorf("expected stage not to be copied again, got cache stages storage calls %v", calls)
+	}
+}
+
+func TestFetchStageFromCacheStagesStorageCopiedByAnotherProcess(t *testing.T) {
+	ctx := context.Background()
+	primary, cache := newCacheTestStagesStorage("primary"), newCacheTestStagesStorage("cache", 2)
+	phase, runtime := newCacheTestBuildPhase(t, primary, cache)
+
+	stg := &cacheTestStage{}
+	if _, err := phase.findSuitableStage(ctx, &Image{}, stg); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process stores the copied stage and updates the stages storage cache
+	copiedStageID := image.StageID{Digest: cacheTestDigest, UniqueID: 2}
+	primary.addStage(copiedStageID)
+	if err := phase.Conveyor.StorageManager.AtomicStoreStagesByDigestToCache(ctx, string(stg.Name()), cacheTestDigest, []image.StageID{copiedStageID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := phase.Conveyor.FetchStage(ctx, stg); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := cache.getCalls(); len(calls) != 1 {
+		t.Errorf("expected stage not to be fetched from the cache stages storage, got calls %v", calls)
+	}
+
+	if len(runtime.renames) != 0 {
+		t.Errorf("expected no renames, got %v", runtime.renames)
+	}
+
+	if name := stg.GetImage().Name(); name != primary.ConstructStageImageName("", cacheTestDigest, 2) {
+		t.Errorf("expected stage of the primary stages storage to be used, got %s", name)
+	}
+}
+
+func TestFetchStageFromCacheStagesStoragePullError(t *testing.T) {
+	ctx := context.Background()
+	primary, cache := newCacheTestStagesStorage("primary"), newCacheTestStagesStorage("cache", 2)
+	cache.fetchErr = errors.New("pull failed")
+	phase, runtime := newCacheTestBuildPhase(t, primary, cache)
+
+	stg := &cacheTestStage{}
+	if _, err := phase.findSuitableStage(ctx, &Image{}, stg); err != nil {
+		t.Fatal(err)
+	}
+
+	err := phase.Conveyor.FetchStage(ctx, stg)
+	if err == nil || !strings.Contains(err.Error(), "unable to copy stage") || !strings.Contains(err.Error(), "pull failed") {
+		t.Fatalf("expected copy stage error, got: %v", err)
+	}
+
+	for _, call := range primary.getCalls() {
+		if strings.HasPrefix(call, "store ") {
+			t.Errorf("expected stage not to be stored into the primary stages storage, got call %q", call)
+		}
+	}
+
+	if len(runtime.renames) != 0 {
+		t.Errorf("expected no renames, got %v", runtime.renames)
+	}
+
+	cacheStageImageName := cache.ConstructStageImageName("", cacheTestDigest, 2)
+	if name := stg.GetImage().Name(); name != cacheStageImageName {
+		t.Errorf("expected stage image name not to be changed, got %s", name)
+	}
+
+	// the failed copy can be retried
+	if phase.Conveyor.getCacheStagesStorage(cacheStageImageName) != cache {
+		t.Errorf("expected stage to still refer the cache stages storage")
+	}
+}
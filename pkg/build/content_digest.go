@@ -0,0 +1,101 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/build/digest_inputs"
+	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/config"
+	"github.com/werf/werf/pkg/util"
+)
+
+// The canonical input of the stage digest in the content digest mode (meta.build.digestMode: content).
+// The input is the header line followed by the fields in the fixed order, one "name: value" line per field, each line ends with "\n".
+// The values are quoted as Go string literals (strconv.Quote), the empty value is "".
+//
+//	werf-stage-digest/v1
+//	stage: "<stage name>"
+//	platform: "<os/arch, empty for single-platform images>"
+//	parent: "<content digest of the previous non-empty stage, empty for the first stage>"
+//	dependencies: "<stage dependencies>"
+//
+// The content digest of the stage is calculated the same way:
+//
+//	werf-stage-content-digest/v1
+//	digest: "<stage digest>"
+//	next-stage-dependencies: "<dependencies which the stage passes to the next stage, e.g. git commit>"
+//
+// The digest is the hex-encoded SHA3-224 of the canonical input.
+// Neither werf version, nor build cache version, nor stage position are the part of the input.
+const (
+	contentModeStageDigestHeader   = "werf-stage-digest/v1"
+	contentModeContentDigestHeader = "werf-stage-content-digest/v1"
+)
+
+const digestInputParentContentDigest = "parent content digest"
+
+type canonicalDigestInputField struct {
+	Name  string
+	Value string
+}
+
+func serializeCanonicalDigestInput(header string, fields []canonicalDigestInputField) string {
+	var b strings.Builder
+	b.WriteString(header + "\n")
+	for _, field := range fields {
+		b.WriteString(fmt.Sprintf("%s: %s\n", field.Name, strconv.Quote(field.Value)))
+	}
+
+	return b.String()
+}
+
+func (c *Conveyor) isContentDigestMode() bool {
+	return c.werfConfig.Meta.Build.GetDigestMode() == config.DigestModeContent
+}
+
+func calculateContentModeDigest(ctx context.Context, stageName, stageDependencies, platform string, prevNonEmptyStage stage.Interface) string {
+	var parentContentDigest string
+	if prevNonEmptyStage != nil {
+		parentContentDigest = prevNonEmptyStage.GetContentDigest()
+	}
+
+	digest_inputs.Record(ctx, "stageName", stageName)
+	digest_inputs.Record(ctx, "stageDependencies", stageDependencies)
+	digest_inputs.Record(ctx, digestInputParentContentDigest, parentContentDigest)
+	if platform != "" {
+		digest_inputs.Record(ctx, "platform", platform)
+	}
+
+	canonicalInput := serializeCanonicalDigestInput(contentModeStageDigestHeader, []canonicalDigestInputField{
+		{Name: "stage", Value: stageName},
+		{Name: "platform", Value: platform},
+		{Name: "parent", Value: parentContentDigest},
+		{Name: "dependencies", Value: stageDependencies},
+	})
+	digest_inputs.RecordCanonical(ctx, canonicalInput)
+
+	digest := util.Sha3_224Hash(canonicalInput)
+
+	logboek.Context(ctx).Debug().LogBlock(fmt.Sprintf("Stage %s digest %s", stageName, digest)).Do(func() {
+		logboek.Context(ctx).Debug().LogF("%s", canonicalInput)
+	})
+
+	return digest
+}
+
+func calculateContentModeContentDigest(ctx context.Context, stg stage.Interface, conveyor *Conveyor) (string, error) {
+	nextStageDependencies, err := stg.GetNextStageDependencies(ctx, conveyor)
+	if err != nil {
+		return "", fmt.Errorf("unable to get stage %s dependencies for the next stage: %s", stg.Name(), err)
+	}
+
+	return util.Sha3_224Hash(serializeCanonicalDigestInput(contentModeContentDigestHeader, []canonicalDigestInputField{
+		{Name: "digest", Value: stg.GetDigest()},
+		{Name: "next-stage-dependencies", Value: nextStageDependencies},
+	})), nil
+}
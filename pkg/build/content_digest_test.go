@@ -0,0 +1,165 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/build/digest_inputs"
+	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/config"
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/giterminism_manager"
+)
+
+// contentDigestTestConveyor provides the content digests of the images used as the base images
+type contentDigestTestConveyor struct {
+	stage.Conveyor
+	images map[string]*Image
+}
+
+func (c *contentDigestTestConveyor) GetImageContentDigest(imageName string) string {
+	return c.images[imageName].GetContentDigest()
+}
+
+func (c *contentDigestTestConveyor) GiterminismManager() giterminism_manager.Interface {
+	return nil
+}
+
+// contentDigestTestGitStage is the git stage with the fixed commit, which is passed to the next stage
+type contentDigestTestGitStage struct {
+	stage.Interface
+	name                  stage.StageName
+	commit                string
+	digest, contentDigest string
+}
+
+func (s *contentDigestTestGitStage) Name() stage.StageName { return s.name }
+
+func (s *contentDigestTestGitStage) GetDependencies(_ context.Context, _ stage.Conveyor, _, _ container_runtime.ImageInterface) (string, error) {
+	return s.commit, nil
+}
+
+func (s *contentDigestTestGitStage) GetNextStageDependencies(_ context.Context, _ stage.Conveyor) (string, error) {
+	return s.commit, nil
+}
+
+func (s *contentDigestTestGitStage) SetDigest(digest string)        { s.digest = digest }
+func (s *contentDigestTestGitStage) GetDigest() string              { return s.digest }
+func (s *contentDigestTestGitStage) SetContentDigest(digest string) { s.contentDigest = digest }
+func (s *contentDigestTestGitStage) GetContentDigest() string       { return s.contentDigest }
+
+func newContentDigestTestDockerfileStage(t *testing.T, dockerfile string) *stage.DockerfileStage {
+	p, err := parser.Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerStages, _, err := instructions.Parse(p.AST)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := stage.NewDockerStages(dockerStages, map[string]string{}, nil, len(dockerStages)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stage.GenerateDockerfileStage(stage.NewDockerRunArgs("Dockerfile", "", ".", nil, nil, nil, "", ""), ds, stage.NewContextChecksum(nil), &stage.NewBaseStageOptions{})
+}
+
+func sha3_224Hex(data string) string {
+	return fmt.Sprintf("%x", sha3.Sum224([]byte(data)))
+}
+
+// TestContentModeDigests pins the canonical inputs and the digests of the content digest mode (werf-stage-digest/v1).
+// The golden file must not change unless the format version is bumped: the digests of the existing stages would change.
+func TestContentModeDigests(t *testing.T) {
+	ctx := logboek.NewContext(context.Background(), logboek.DefaultLogger())
+	conveyor := &contentDigestTestConveyor{images: map[string]*Image{}}
+	out := &bytes.Buffer{}
+
+	calculateImage := func(imageName, platform string, baseImage container_runtime.ImageInterface, stages ...stage.Interface) *Image {
+		img := &Image{name: imageName, platform: platform}
+
+		var prevNonEmptyStage stage.Interface
+		for _, stg := range stages {
+			inputs := &digest_inputs.Inputs{}
+			digestCtx := digest_inputs.NewContext(ctx, inputs)
+
+			stageDependencies, err := stg.GetDependencies(digestCtx, conveyor, baseImage, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			digest := calculateContentModeDigest(digestCtx, string(stg.Name()), stageDependencies, platform, prevNonEmptyStage)
+			if expected := sha3_224Hex(inputs.Canonical); digest != expected {
+				t.Errorf("image %s stage %s: expected digest %s (SHA3-224 of the canonical input), got %s", imageName, stg.Name(), expected, digest)
+			}
+			stg.SetDigest(digest)
+
+			nextStageDependencies, err := stg.GetNextStageDependencies(ctx, conveyor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contentDigestCanonicalInput := serializeCanonicalDigestInput(contentModeContentDigestHeader, []canonicalDigestInputField{
+				{Name: "digest", Value: digest},
+				{Name: "next-stage-dependencies", Value: nextStageDependencies},
+			})
+
+			contentDigest, err := calculateContentModeContentDigest(ctx, stg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := sha3_224Hex(contentDigestCanonicalInput); contentDigest != expected {
+				t.Errorf("image %s stage %s: expected content digest %s (SHA3-224 of the canonical input), got %s", imageName, stg.Name(), expected, contentDigest)
+			}
+			stg.SetContentDigest(contentDigest)
+
+			fmt.Fprintf(out, "### image %s stage %s\n", imageName, stg.Name())
+			for _, input := range inputs.List {
+				fmt.Fprintf(out, "# %s: %q\n", input.Name, input.Value)
+			}
+			fmt.Fprintf(out, "%s=> %s\n", inputs.Canonical, digest)
+			fmt.Fprintf(out, "%s=> %s\n\n", contentDigestCanonicalInput, contentDigest)
+
+			prevNonEmptyStage = stg
+		}
+
+		img.SetContentDigest(prevNonEmptyStage.GetContentDigest())
+		conveyor.images[imageName] = img
+
+		return img
+	}
+
+	shellConfig := &config.StapelImageBase{Shell: &config.Shell{Install: []string{"apk add curl"}}}
+	newInstallStage := func() stage.Interface {
+		return stage.GenerateInstallStage(ctx, shellConfig, &stage.NewGitPatchStageOptions{}, &stage.NewBaseStageOptions{})
+	}
+
+	calculateImage("backend", "", container_runtime.NewStageImage(nil, "alpine:3.13", nil),
+		stage.GenerateFromStage(&config.StapelImageBase{From: "alpine:3.13"}, "", &stage.NewBaseStageOptions{}),
+		&contentDigestTestGitStage{name: stage.GitArchive, commit: "0123456789abcdef0123456789abcdef01234567"},
+		newInstallStage(),
+	)
+
+	// the first stage has no parent, the content digest of the base image is the part of the from stage dependencies
+	calculateImage("app", "linux/arm64", nil,
+		stage.GenerateFromStage(&config.StapelImageBase{FromImageName: "backend"}, "", &stage.NewBaseStageOptions{}),
+		newInstallStage(),
+	)
+
+	calculateImage("dockerfile", "", nil,
+		newContentDigestTestDockerfileStage(t, "FROM alpine:3.13\nRUN echo hello\n"),
+	)
+
+	checkGolden(t, "content_digest.golden", out.Bytes())
+}
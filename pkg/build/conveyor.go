@@ -23,11 +23,14 @@ import (
 	stylePkg "github.com/werf/logboek/pkg/style"
 	"github.com/werf/logboek/pkg/types"
 
+	"github.com/werf/werf/pkg/build/builder"
 	"github.com/werf/werf/pkg/build/import_server"
 	"github.com/werf/werf/pkg/build/stage"
 	"github.com/werf/werf/pkg/config"
 	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/docker_registry"
 	"github.com/werf/werf/pkg/git_repo"
+	"github.com/werf/werf/pkg/git_repo/gitdata"
 	"github.com/werf/werf/pkg/giterminism_manager"
 	imagePkg "github.com/werf/werf/pkg/image"
 	"github.com/werf/werf/pkg/logging"
@@ -54,6 +57,9 @@ type Conveyor struct {
 	images    []*Image
 	imageSets [][]*Image
 
+	// manifestLists are stored manifest lists of multi-platform images by image name
+	manifestLists map[string]*imagePkg.StageDescription
+
 	stageImages        map[string]*container_runtime.StageImage
 	giterminismManager giterminism_manager.Interface
 	remoteGitRepos     map[string]*git_repo.Remote
@@ -68,6 +74,14 @@ type Conveyor struct {
 	onTerminateFuncs []func() error
 	importServers    map[string]import_server.ImportServer
 
+	// buildSecrets are the image build secrets by image name, which are written into the buildSecretsImageDirs (inside the buildSecretsDir) on demand
+	buildSecrets          map[string][]*builder.BuildSecret
+	buildSecretsImageDirs map[string]string
+	buildSecretsDir       string
+
+	// cacheStagesStorageByStageImageName are the cache stages storages of the stages, which are found in the cache stages storages and not copied into the primary stages storage yet
+	cacheStagesStorageByStageImageName map[string]storage.StagesStorage
+
 	ConveyorOptions
 
 	mutex            sync.Mutex
@@ -79,6 +93,12 @@ type ConveyorOptions struct {
 	Parallel                        bool
 	ParallelTasksLimit              int64
 	LocalGitRepoVirtualMergeOptions stage.VirtualMergeOptions
+
+	// LocalGitRepoHeadCommit overrides the head commit of the local git mappings (used to calculate stage digests of another project commit)
+	LocalGitRepoHeadCommit string
+
+	// Offline disables access to container registries while determining stages (fromLatest and platform-specific base images are not resolved)
+	Offline bool
 }
 
 func NewConveyor(werfConfig *config.WerfConfig, giterminismManager giterminism_manager.Interface, imageNamesToProcess []string, projectDir, baseTmpDir, sshAuthSock string, containerRuntime container_runtime.ContainerRuntime, storageManager *manager.StorageManager, storageLockManager storage.LockManager, opts ConveyorOptions) *Conveyor {
@@ -99,9 +119,14 @@ func NewConveyor(werfConfig *config.WerfConfig, giterminismManager giterminism_m
 		baseImagesRepoErrCache: make(map[string]error),
 		images:                 []*Image{},
 		imageSets:              [][]*Image{},
+		manifestLists:          make(map[string]*imagePkg.StageDescription),
 		remoteGitRepos:         make(map[string]*git_repo.Remote),
 		tmpDir:                 filepath.Join(baseTmpDir, util.GenerateConsistentRandomString(10)),
 		importServers:          make(map[string]import_server.ImportServer),
+		buildSecrets:           make(map[string][]*builder.BuildSecret),
+		buildSecretsImageDirs:  make(map[string]string),
+
+		cacheStagesStorageByStageImageName: make(map[string]storage.StagesStorage),
 
 		ContainerRuntime:   containerRuntime,
 		StorageLockManager: storageLockManager,
@@ -188,6 +213,10 @@ func (c *Conveyor) GetLocalGitRepoVirtualMergeOptions() stage.VirtualMergeOption
 	return c.ConveyorOptions.LocalGitRepoVirtualMergeOptions
 }
 
+func (c *Conveyor) GetLocalGitRepoHeadCommit() string {
+	return c.ConveyorOptions.LocalGitRepoHeadCommit
+}
+
 func (c *Conveyor) GetImportServer(ctx context.Context, imageName, stageName string) (import_server.ImportServer, error) {
 	c.getServiceRWMutex("ImportServer").Lock()
 	defer c.getServiceRWMutex("ImportServer").Unlock()
@@ -200,7 +229,7 @@ func (c *Conveyor) GetImportServer(ctx context.Context, imageName, stageName str
 		return srv, nil
 	}
 
-	var srv *import_server.RsyncServer
+	var srv import_server.ImportServer
 
 	var stg stage.Interface
 
@@ -210,11 +239,11 @@ func (c *Conveyor) GetImportServer(ctx context.Context, imageName, stageName str
 		stg = c.GetImage(imageName).GetLastNonEmptyStage()
 	}
 
-	if err := c.StorageManager.FetchStage(ctx, stg); err != nil {
+	if err := c.FetchStage(ctx, stg); err != nil {
 		return nil, fmt.Errorf("unable to fetch stage %s: %s", stg.GetImage().Name(), err)
 	}
 
-	if err := logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Firing up import rsync server for image %s", imageName)).
+	if err := logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Firing up import server for image %s", imageName)).
 		DoError(func() error {
 			var tmpDir string
 			if stageName == "" {
@@ -235,17 +264,17 @@ func (c *Conveyor) GetImportServer(ctx context.Context, imageName, stageName str
 			}
 
 			var err error
-			srv, err = import_server.RunRsyncServer(ctx, dockerImageName, tmpDir)
+			srv, err = c.ContainerRuntime.RunImportServer(ctx, dockerImageName, tmpDir)
 			if srv != nil {
 				c.AppendOnTerminateFunc(func() error {
 					if err := srv.Shutdown(ctx); err != nil {
-						return fmt.Errorf("unable to shutdown import server %s: %s", srv.DockerContainerName, err)
+						return fmt.Errorf("unable to shutdown import server %s: %s", importServerName, err)
 					}
 					return nil
 				})
 			}
 			if err != nil {
-				return fmt.Errorf("unable to run rsync import server: %s", err)
+				return fmt.Errorf("unable to run import server: %s", err)
 			}
 			return nil
 		}); err != nil {
@@ -286,6 +315,10 @@ func (c *Conveyor) Terminate(ctx context.Context) error {
 	return nil
 }
 
+func (c *Conveyor) GetContainerRuntime() container_runtime.ContainerRuntime {
+	return c.ContainerRuntime
+}
+
 func (c *Conveyor) GiterminismManager() giterminism_manager.Interface {
 	return c.giterminismManager
 }
@@ -320,17 +353,40 @@ func (c *Conveyor) ShouldBeBuilt(ctx context.Context) error {
 	return nil
 }
 
+// Graph returns the image dependency graph with the stage chain of each image, the stages storage is not accessed in the offline mode
+func (c *Conveyor) Graph(ctx context.Context) (*Graph, error) {
+	if err := c.determineStages(ctx); err != nil {
+		return nil, err
+	}
+
+	graph := newGraph(c)
+	if c.Offline {
+		return graph, nil
+	}
+
+	phases := []Phase{
+		NewGraphPhase(c, graph),
+	}
+
+	if err := c.runPhases(ctx, phases, false); err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
+
 func (c *Conveyor) FetchLastImageStage(ctx context.Context, imageName string) error {
 	lastImageStage := c.GetImage(imageName).GetLastNonEmptyStage()
-	return c.StorageManager.FetchStage(ctx, lastImageStage)
+	return c.FetchStage(ctx, lastImageStage)
 }
 
 func (c *Conveyor) GetImageInfoGetters() (images []*imagePkg.InfoGetter) {
-	for _, img := range c.images {
-		if img.isArtifact {
-			continue
+	for _, img := range c.getExportedImages() {
+		if desc := c.GetImageManifestList(img.name); desc != nil {
+			images = append(images, imagePkg.NewInfoGetter(img.name, desc.Info.Name, desc.Info.Tag))
+		} else {
+			images = append(images, img.GetImageInfoGetter())
 		}
-		images = append(images, img.GetImageInfoGetter())
 	}
 
 	return images
@@ -339,11 +395,7 @@ func (c *Conveyor) GetImageInfoGetters() (images []*imagePkg.InfoGetter) {
 func (c *Conveyor) GetExportedImagesNames() []string {
 	var res []string
 
-	for _, img := range c.images {
-		if img.isArtifact {
-			continue
-		}
-
+	for _, img := range c.getExportedImages() {
 		res = append(res, img.name)
 	}
 
@@ -352,15 +404,32 @@ func (c *Conveyor) GetExportedImagesNames() []string {
 
 func (c *Conveyor) GetImagesEnvArray() []string {
 	var envArray []string
+	for _, img := range c.getExportedImages() {
+		if desc := c.GetImageManifestList(img.name); desc != nil {
+			envArray = append(envArray, generateImageEnv(img.name, desc.Info.Name))
+		} else {
+			envArray = append(envArray, generateImageEnv(img.name, c.GetImageNameForLastImageStage(img.name)))
+		}
+	}
+
+	return envArray
+}
+
+// getExportedImages returns non-artifact images, the multi-platform image is represented by the image of the first platform
+func (c *Conveyor) getExportedImages() []*Image {
+	var res []*Image
+
+	processedNames := map[string]bool{}
 	for _, img := range c.images {
-		if img.isArtifact {
+		if img.isArtifact || processedNames[img.name] {
 			continue
 		}
 
-		envArray = append(envArray, generateImageEnv(img.name, c.GetImageNameForLastImageStage(img.name)))
+		processedNames[img.name] = true
+		res = append(res, img)
 	}
 
-	return envArray
+	return res
 }
 
 func (c *Conveyor) Build(ctx context.Context, opts BuildOptions) error {
@@ -396,48 +465,59 @@ func (c *Conveyor) doDetermineStages(ctx context.Context) error {
 	imageConfigsToProcess := getImageConfigsToProcess(ctx, c)
 	configSets := c.werfConfig.ImagesWithDependenciesBySets(imageConfigsToProcess)
 
+	if err := validateImageConfigsPlatforms(configSets, c.StorageManager.StagesStorage); err != nil {
+		return err
+	}
+
 	for _, iteration := range configSets {
 		var imageSet []*Image
 
 		for _, imageInterfaceConfig := range iteration {
-			var img *Image
-			var imageLogName string
-			var style color.Style
-
-			switch imageConfig := imageInterfaceConfig.(type) {
-			case config.StapelImageInterface:
-				imageLogName = logging.ImageLogProcessName(imageConfig.ImageBaseConfig().Name, imageConfig.IsArtifact())
-				style = ImageLogProcessStyle(imageConfig.IsArtifact())
-			case *config.ImageFromDockerfile:
-				imageLogName = logging.ImageLogProcessName(imageConfig.Name, false)
-				style = ImageLogProcessStyle(false)
+			platforms := getImageConfigPlatforms(imageInterfaceConfig)
+			if len(platforms) == 0 {
+				platforms = []string{""}
 			}
 
-			err := logboek.Context(ctx).Info().LogProcess(imageLogName).
-				Options(func(options types.LogProcessOptionsInterface) {
-					options.Style(style)
-				}).
-				DoError(func() error {
-					var err error
+			for _, platform := range platforms {
+				var img *Image
+				var imageLogName string
+				var style color.Style
+
+				switch imageConfig := imageInterfaceConfig.(type) {
+				case config.StapelImageInterface:
+					imageLogName = logging.ImageLogProcessName(imageConfig.ImageBaseConfig().Name, imageConfig.IsArtifact())
+					style = ImageLogProcessStyle(imageConfig.IsArtifact())
+				case *config.ImageFromDockerfile:
+					imageLogName = logging.ImageLogProcessName(imageConfig.Name, false)
+					style = ImageLogProcessStyle(false)
+				}
 
-					switch imageConfig := imageInterfaceConfig.(type) {
-					case config.StapelImageInterface:
-						img, err = prepareImageBasedOnStapelImageConfig(ctx, imageConfig, c)
-					case *config.ImageFromDockerfile:
-						img, err = prepareImageBasedOnImageFromDockerfile(ctx, imageConfig, c)
-					}
+				err := logboek.Context(ctx).Info().LogProcess(imageLogNameWithPlatform(imageLogName, platform)).
+					Options(func(options types.LogProcessOptionsInterface) {
+						options.Style(style)
+					}).
+					DoError(func() error {
+						var err error
+
+						switch imageConfig := imageInterfaceConfig.(type) {
+						case config.StapelImageInterface:
+							img, err = prepareImageBasedOnStapelImageConfig(ctx, imageConfig, platform, c)
+						case *config.ImageFromDockerfile:
+							img, err = prepareImageBasedOnImageFromDockerfile(ctx, imageConfig, platform, c)
+						}
 
-					if err != nil {
-						return err
-					}
+						if err != nil {
+							return err
+						}
 
-					c.images = append(c.images, img)
-					imageSet = append(imageSet, img)
+						c.images = append(c.images, img)
+						imageSet = append(imageSet, img)
 
-					return nil
-				})
-			if err != nil {
-				return err
+						return nil
+					})
+				if err != nil {
+					return err
+				}
 			}
 		}
 
@@ -624,7 +704,7 @@ func (c *Conveyor) GetOrCreateStageImage(fromImage *container_runtime.StageImage
 		return img
 	}
 
-	img := container_runtime.NewStageImage(fromImage, name, c.ContainerRuntime.(*container_runtime.LocalDockerServerRuntime))
+	img := container_runtime.NewStageImage(fromImage, name, c.ContainerRuntime)
 	c.SetStageImage(img)
 	return img
 }
@@ -639,6 +719,32 @@ func (c *Conveyor) GetImage(name string) *Image {
 	panic(fmt.Sprintf("Image %q not found!", name))
 }
 
+// GetImageForPlatform returns the image built for the platform, the image without platforms is returned if there is no such platform
+func (c *Conveyor) GetImageForPlatform(name, platform string) *Image {
+	for _, img := range c.images {
+		if img.GetName() == name && img.platform == platform {
+			return img
+		}
+	}
+
+	return c.GetImage(name)
+}
+
+func (c *Conveyor) SetImageManifestList(imageName string, desc *imagePkg.StageDescription) {
+	c.getServiceRWMutex("ManifestLists").Lock()
+	defer c.getServiceRWMutex("ManifestLists").Unlock()
+
+	c.manifestLists[imageName] = desc
+}
+
+// GetImageManifestList returns nil for the image without platforms
+func (c *Conveyor) GetImageManifestList(imageName string) *imagePkg.StageDescription {
+	c.getServiceRWMutex("ManifestLists").RLock()
+	defer c.getServiceRWMutex("ManifestLists").RUnlock()
+
+	return c.manifestLists[imageName]
+}
+
 func (c *Conveyor) GetImageStageContentDigest(imageName, stageName string) string {
 	return c.getImageStage(imageName, stageName).GetContentDigest()
 }
@@ -692,7 +798,36 @@ func (c *Conveyor) RmImportMetadata(ctx context.Context, projectName, id string)
 	return c.StorageManager.StagesStorage.RmImportMetadata(ctx, projectName, id)
 }
 
-func prepareImageBasedOnStapelImageConfig(ctx context.Context, imageInterfaceConfig config.StapelImageInterface, c *Conveyor) (*Image, error) {
+// validateImageConfigsPlatforms checks that the stages storage supports the platforms of the images before any stage is built
+func validateImageConfigsPlatforms(configSets [][]config.ImageInterface, stagesStorage storage.StagesStorage) error {
+	for _, iteration := range configSets {
+		for _, imageInterfaceConfig := range iteration {
+			platforms := getImageConfigPlatforms(imageInterfaceConfig)
+			if len(platforms) == 0 {
+				continue
+			}
+
+			if err := storage.ValidateMultiPlatformImagesSupport(stagesStorage); err != nil {
+				return fmt.Errorf("unable to build image %q for platforms %v: %s", imageInterfaceConfig.GetName(), platforms, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func getImageConfigPlatforms(imageInterfaceConfig config.ImageInterface) []string {
+	switch imageConfig := imageInterfaceConfig.(type) {
+	case *config.StapelImage:
+		return imageConfig.Platform
+	case *config.ImageFromDockerfile:
+		return imageConfig.Platform
+	default:
+		return nil
+	}
+}
+
+func prepareImageBasedOnStapelImageConfig(ctx context.Context, imageInterfaceConfig config.StapelImageInterface, platform string, c *Conveyor) (*Image, error) {
 	image := &Image{}
 
 	imageBaseConfig := imageInterfaceConfig.ImageBaseConfig()
@@ -702,8 +837,18 @@ func prepareImageBasedOnStapelImageConfig(ctx context.Context, imageInterfaceCon
 	from, fromImageName, fromLatest := getFromFields(imageBaseConfig)
 
 	image.name = imageName
+	image.platform = platform
 
 	if from != "" {
+		// the base image is pinned to the platform-specific manifest, so that images of different platforms do not share the local base image
+		if platform != "" && !c.Offline {
+			platformFrom, err := getBaseImagePlatformReference(ctx, from, platform)
+			if err != nil {
+				return nil, err
+			}
+			from = platformFrom
+		}
+
 		if err := handleImageFromName(ctx, from, fromLatest, image, c); err != nil {
 			return nil, err
 		}
@@ -724,7 +869,7 @@ func prepareImageBasedOnStapelImageConfig(ctx context.Context, imageInterfaceCon
 func handleImageFromName(ctx context.Context, from string, fromLatest bool, image *Image, c *Conveyor) error {
 	image.baseImageName = from
 
-	if fromLatest {
+	if fromLatest && !c.Offline {
 		if _, err := image.getFromBaseImageIdFromRegistry(ctx, c, image.baseImageName); err != nil {
 			return err
 		}
@@ -733,6 +878,20 @@ func handleImageFromName(ctx context.Context, from string, fromLatest bool, imag
 	return nil
 }
 
+func getBaseImagePlatformReference(ctx context.Context, from, platform string) (string, error) {
+	digest, err := docker_registry.API().GetRepoImagePlatformDigest(ctx, from, platform)
+	if err != nil {
+		return "", fmt.Errorf("unable to get base image %s for platform %s: %s", from, platform, err)
+	}
+
+	repository, _ := imagePkg.ParseRepositoryAndTag(from)
+	if ind := strings.Index(repository, "@"); ind != -1 {
+		repository = repository[:ind]
+	}
+
+	return fmt.Sprintf("%s@%s", repository, digest), nil
+}
+
 func getFromFields(imageBaseConfig *config.StapelImageBase) (string, string, bool) {
 	var from string
 	var fromImageName string
@@ -779,12 +938,18 @@ func initStages(ctx context.Context, image *Image, imageInterfaceConfig config.S
 	imageName := imageBaseConfig.Name
 	imageArtifact := imageInterfaceConfig.IsArtifact()
 
+	secrets, err := c.getImageBuildSecrets(ctx, imageName, imageBaseConfig.Secrets)
+	if err != nil {
+		return err
+	}
+
 	baseStageOptions := &stage.NewBaseStageOptions{
 		ImageName:        imageName,
 		ConfigMounts:     imageBaseConfig.Mount,
 		ImageTmpDir:      c.GetImageTmpDir(imageBaseConfig.Name),
 		ContainerWerfDir: c.containerWerfDir,
 		ProjectName:      c.werfConfig.Meta.Project,
+		Secrets:          secrets,
 	}
 
 	gitArchiveStageOptions := &stage.NewGitArchiveStageOptions{
@@ -871,6 +1036,10 @@ func generateGitMappings(ctx context.Context, imageBaseConfig *config.StapelImag
 			}
 		}
 
+		if err := gitdata.RecordRepoProject(ctx, localGitRepo.GetRepoID(), c.werfConfig.Meta.Project); err != nil {
+			return nil, fmt.Errorf("unable to record project of git repo %s: %s", localGitRepo.GetName(), err)
+		}
+
 		for _, localGitMappingConfig := range imageBaseConfig.Git.Local {
 			gitMappings = append(gitMappings, gitLocalPathInit(localGitMappingConfig, imageBaseConfig.Name, c))
 		}
@@ -892,6 +1061,10 @@ func generateGitMappings(ctx context.Context, imageBaseConfig *config.StapelImag
 				return nil, err
 			}
 
+			if err := gitdata.RecordRepoProject(ctx, remoteGitRepo.GetRepoID(), c.werfConfig.Meta.Project); err != nil {
+				return nil, fmt.Errorf("unable to record project of git repo %s: %s", remoteGitMappingConfig.Name, err)
+			}
+
 			c.SetRemoteGitRepo(remoteGitMappingConfig.Name, remoteGitRepo)
 		}
 
@@ -1085,9 +1258,10 @@ func appendIfExist(ctx context.Context, stages []stage.Interface, stage stage.In
 	return stages
 }
 
-func prepareImageBasedOnImageFromDockerfile(ctx context.Context, imageFromDockerfileConfig *config.ImageFromDockerfile, c *Conveyor) (*Image, error) {
+func prepareImageBasedOnImageFromDockerfile(ctx context.Context, imageFromDockerfileConfig *config.ImageFromDockerfile, platform string, c *Conveyor) (*Image, error) {
 	img := &Image{}
 	img.name = imageFromDockerfileConfig.Name
+	img.platform = platform
 	img.isDockerfileImage = true
 
 	for _, contextAddFile := range imageFromDockerfileConfig.ContextAddFiles {
@@ -1181,34 +1355,129 @@ func prepareImageBasedOnImageFromDockerfile(ctx context.Context, imageFromDocker
 		return nil, err
 	}
 
+	if err := c.checkDockerfileImageBuildSecretsSupported(imageFromDockerfileConfig.Name, imageFromDockerfileConfig.Secrets); err != nil {
+		return nil, err
+	}
+
+	secrets, err := c.getImageBuildSecrets(ctx, imageFromDockerfileConfig.Name, imageFromDockerfileConfig.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
 	baseStageOptions := &stage.NewBaseStageOptions{
 		ImageName:   imageFromDockerfileConfig.Name,
 		ProjectName: c.werfConfig.Meta.Project,
+		Secrets:     secrets,
 	}
 
-	dockerfileStage := stage.GenerateDockerfileStage(
-		stage.NewDockerRunArgs(
-			imageFromDockerfileConfig.Dockerfile,
-			imageFromDockerfileConfig.Target,
-			imageFromDockerfileConfig.Context,
-			imageFromDockerfileConfig.ContextAddFiles,
-			imageFromDockerfileConfig.Args,
-			imageFromDockerfileConfig.AddHost,
-			imageFromDockerfileConfig.Network,
-			imageFromDockerfileConfig.SSH,
-		),
-		ds,
-		stage.NewContextChecksum(dockerignorePathMatcher),
-		baseStageOptions,
+	dockerRunArgs := stage.NewDockerRunArgs(
+		imageFromDockerfileConfig.Dockerfile,
+		imageFromDockerfileConfig.Target,
+		imageFromDockerfileConfig.Context,
+		imageFromDockerfileConfig.ContextAddFiles,
+		imageFromDockerfileConfig.Args,
+		imageFromDockerfileConfig.AddHost,
+		imageFromDockerfileConfig.Network,
+		imageFromDockerfileConfig.SSH,
 	)
+	contextChecksum := stage.NewContextChecksum(dockerignorePathMatcher)
+
+	if !imageFromDockerfileConfig.Staged {
+		dockerfileStage := stage.GenerateDockerfileStage(dockerRunArgs, ds, contextChecksum, baseStageOptions)
+		img.stages = append(img.stages, dockerfileStage)
+
+		logboek.Context(ctx).Info().LogFDetails("Using stage %s\n", dockerfileStage.Name())
 
+		return img, nil
+	}
+
+	newDockerStagesFunc := func(dockerStageIndex int) (*stage.DockerStages, error) {
+		return stage.NewDockerStages(
+			dockerStages,
+			util.MapStringInterfaceToMapStringString(imageFromDockerfileConfig.Args),
+			dockerMetaArgs,
+			dockerStageIndex,
+		)
+	}
+
+	dockerfileStageByIndex := map[int]*stage.DockerfileStage{}
+	getDependencyStagesFunc := func(dockerStageIndex int) []*stage.DockerfileStage {
+		var result []*stage.DockerfileStage
+		for _, dependencyStageIndex := range getDockerTargetDependencyStageIndexes(dockerStages, dockerStageIndex) {
+			if dependencyStage, ok := dockerfileStageByIndex[dependencyStageIndex]; ok {
+				result = append(result, dependencyStage)
+			}
+		}
+
+		return result
+	}
+
+	for _, dockerStageIndex := range getDockerTargetDependencyStageIndexes(dockerStages, dockerTargetIndex) {
+		// docker build --target cannot be used for the unnamed stage, such stage is built as the part of the dependent one
+		if dockerStages[dockerStageIndex].Name == "" {
+			continue
+		}
+
+		dockerStageDs, err := newDockerStagesFunc(dockerStageIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		dockerfileStage := stage.GenerateStagedDockerfileStage(dockerStages[dockerStageIndex].Name, getDependencyStagesFunc(dockerStageIndex), dockerRunArgs, dockerStageDs, contextChecksum, baseStageOptions)
+		img.stages = append(img.stages, dockerfileStage)
+		dockerfileStageByIndex[dockerStageIndex] = dockerfileStage
+	}
+
+	dockerfileStage := stage.GenerateStagedDockerfileStage("", getDependencyStagesFunc(dockerTargetIndex), dockerRunArgs, ds, contextChecksum, baseStageOptions)
 	img.stages = append(img.stages, dockerfileStage)
 
-	logboek.Context(ctx).Info().LogFDetails("Using stage %s\n", dockerfileStage.Name())
+	for _, s := range img.stages {
+		logboek.Context(ctx).Info().LogFDetails("Using stage %s\n", s.Name())
+	}
 
 	return img, nil
 }
 
+// getDockerTargetDependencyStageIndexes returns the ordered indexes of the stages, which the target stage depends on (FROM or COPY --from), the target is not included
+func getDockerTargetDependencyStageIndexes(dockerStages []instructions.Stage, dockerTargetIndex int) []int {
+	dependencies := map[int]bool{}
+
+	var walkFunc func(ind int)
+	walkFunc = func(ind int) {
+		var relatedStageIndexes []int
+		for relatedStageIndex, relatedStage := range dockerStages[:ind] {
+			if relatedStage.Name != "" && strings.EqualFold(dockerStages[ind].BaseName, relatedStage.Name) {
+				relatedStageIndexes = append(relatedStageIndexes, relatedStageIndex)
+			}
+		}
+
+		for _, cmd := range dockerStages[ind].Commands {
+			if c, ok := cmd.(*instructions.CopyCommand); ok && c.From != "" {
+				if relatedStageIndex, err := strconv.Atoi(c.From); err == nil && relatedStageIndex < ind {
+					relatedStageIndexes = append(relatedStageIndexes, relatedStageIndex)
+				}
+			}
+		}
+
+		for _, relatedStageIndex := range relatedStageIndexes {
+			if !dependencies[relatedStageIndex] {
+				dependencies[relatedStageIndex] = true
+				walkFunc(relatedStageIndex)
+			}
+		}
+	}
+	walkFunc(dockerTargetIndex)
+
+	var result []int
+	for ind := range dockerStages {
+		if dependencies[ind] {
+			result = append(result, ind)
+		}
+	}
+
+	return result
+}
+
 func resolveDockerStagesFromValue(stages []instructions.Stage) {
 	nameToIndex := make(map[string]string)
 	for i, s := range stages {
@@ -0,0 +1,163 @@
+package build
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+
+	"github.com/werf/werf/pkg/config"
+	"github.com/werf/werf/pkg/storage"
+)
+
+func parseTestDockerfile(t *testing.T, dockerfile string) []instructions.Stage {
+	p, err := parser.Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("unable to parse dockerfile: %s", err)
+	}
+
+	dockerStages, _, err := instructions.Parse(p.AST)
+	if err != nil {
+		t.Fatalf("unable to parse dockerfile instructions: %s", err)
+	}
+
+	resolveDockerStagesFromValue(dockerStages)
+
+	return dockerStages
+}
+
+func TestGetDockerTargetDependencyStageIndexes(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		target     string
+		expected   []int
+	}{
+		{
+			name: "single stage",
+			dockerfile: `
+FROM alpine
+RUN true
+`,
+			expected: nil,
+		},
+		{
+			name: "linear chain by FROM",
+			dockerfile: `
+FROM alpine AS base
+FROM base AS builder
+FROM builder
+`,
+			expected: []int{0, 1},
+		},
+		{
+			name: "independent stages are excluded",
+			dockerfile: `
+FROM alpine AS base
+FROM ubuntu AS unused
+FROM golang AS builder
+FROM base
+COPY --from=builder /app /app
+`,
+			expected: []int{0, 2},
+		},
+		{
+			name: "COPY --from by index",
+			dockerfile: `
+FROM golang
+FROM alpine AS other
+FROM alpine
+COPY --from=0 /app /app
+`,
+			expected: []int{0},
+		},
+		{
+			name: "transitive dependencies through COPY --from",
+			dockerfile: `
+FROM alpine AS deps
+FROM golang AS builder
+COPY --from=deps /deps /deps
+FROM alpine
+COPY --from=builder /app /app
+`,
+			expected: []int{0, 1},
+		},
+		{
+			name: "stage names are case insensitive",
+			dockerfile: `
+FROM alpine AS Base
+FROM base
+`,
+			expected: []int{0},
+		},
+		{
+			name: "COPY --from external image",
+			dockerfile: `
+FROM alpine AS base
+FROM alpine
+COPY --from=golang:1.16 /usr/local/go /usr/local/go
+`,
+			expected: nil,
+		},
+		{
+			name: "target in the middle",
+			dockerfile: `
+FROM alpine AS base
+FROM base AS builder
+FROM builder AS final
+`,
+			target:   "builder",
+			expected: []int{0},
+		},
+		{
+			name: "shared dependency is listed once",
+			dockerfile: `
+FROM alpine AS base
+FROM base AS first
+FROM base AS second
+FROM alpine
+COPY --from=first /first /first
+COPY --from=second /second /second
+`,
+			expected: []int{0, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dockerStages := parseTestDockerfile(t, tt.dockerfile)
+
+			dockerTargetIndex, err := getDockerTargetStageIndex(dockerStages, tt.target)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			result := getDockerTargetDependencyStageIndexes(dockerStages, dockerTargetIndex)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateImageConfigsPlatforms(t *testing.T) {
+	configSets := [][]config.ImageInterface{
+		{&config.ImageFromDockerfile{Name: "base"}},
+		{&config.ImageFromDockerfile{Name: "app", Platform: []string{"linux/amd64", "linux/arm64"}}},
+	}
+
+	err := validateImageConfigsPlatforms(configSets, &storage.S3StagesStorage{StorageAddress: "s3://bucket/stages"})
+	if err == nil || !strings.Contains(err.Error(), `unable to build image "app" for platforms [linux/amd64 linux/arm64]`) {
+		t.Errorf("expected unsupported platforms error, got: %v", err)
+	}
+
+	if err := validateImageConfigsPlatforms(configSets, &storage.RepoStagesStorage{RepoAddress: "registry.example.com/project"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if err := validateImageConfigsPlatforms(configSets[:1], &storage.LocalDockerServerStagesStorage{}); err != nil {
+		t.Errorf("unexpected error for the images without platforms: %s", err)
+	}
+}
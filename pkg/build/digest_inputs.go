@@ -0,0 +1,330 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/werf/werf/pkg/build/digest_inputs"
+	"github.com/werf/werf/pkg/build/stage"
+)
+
+const (
+	digestInputPrevStageDigest       = "prevNonEmptyStage digest"
+	digestInputPrevStageDependencies = "prevNonEmptyStage dependencies for next stage"
+)
+
+// DigestInputsReport is the list of the calculated stage digests with the named inputs of each digest.
+// The stages following the first stage, which should be built, are not calculated (see GraphPhase).
+type DigestInputsReport struct {
+	mux    sync.Mutex
+	Stages []*StageDigestInputs
+}
+
+type StageDigestInputs struct {
+	ImageName string
+	Platform  string `json:",omitempty"`
+	StageName string
+	Digest    string
+	Inputs    []*digest_inputs.Input
+
+	// CanonicalInput is the exact input of the digest in the content digest mode (see content_digest.go)
+	CanonicalInput string `json:",omitempty"`
+}
+
+func NewDigestInputsReport() *DigestInputsReport {
+	return &DigestInputsReport{}
+}
+
+func LoadDigestInputsReport(path string) (*DigestInputsReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read digest inputs report %q: %s", path, err)
+	}
+
+	report := NewDigestInputsReport()
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal digest inputs report %q: %s", path, err)
+	}
+
+	return report, nil
+}
+
+func (report *DigestInputsReport) Save(path string) error {
+	data, err := report.ToJsonData()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write digest inputs report %q: %s", path, err)
+	}
+
+	return nil
+}
+
+func (report *DigestInputsReport) ToJsonData() ([]byte, error) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, []byte("\n")...)
+
+	return data, nil
+}
+
+func (report *DigestInputsReport) addStage(img *Image, stg stage.Interface, inputs *digest_inputs.Inputs) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	report.Stages = append(report.Stages, &StageDigestInputs{
+		ImageName:      img.GetName(),
+		Platform:       img.GetPlatform(),
+		StageName:      string(stg.Name()),
+		Digest:         stg.GetDigest(),
+		Inputs:         inputs.List,
+		CanonicalInput: inputs.Canonical,
+	})
+}
+
+// sortedStages returns the stages ordered by the image and platform, the order of the image stages is kept
+func (report *DigestInputsReport) sortedStages() []*StageDigestInputs {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	var stages []*StageDigestInputs
+	stages = append(stages, report.Stages...)
+	sort.SliceStable(stages, func(i, j int) bool {
+		if stages[i].ImageName != stages[j].ImageName {
+			return stages[i].ImageName < stages[j].ImageName
+		}
+		return stages[i].Platform < stages[j].Platform
+	})
+
+	return stages
+}
+
+func (stg *StageDigestInputs) key() string {
+	return fmt.Sprintf("%s/%s/%s", stg.ImageName, stg.Platform, stg.StageName)
+}
+
+func (stg *StageDigestInputs) logName() string {
+	if stg.Platform != "" {
+		return fmt.Sprintf("%s [%s] %s", stg.ImageName, stg.Platform, stg.StageName)
+	}
+	return fmt.Sprintf("%s %s", stg.ImageName, stg.StageName)
+}
+
+func (stg *StageDigestInputs) getInput(name string) *digest_inputs.Input {
+	for _, input := range stg.Inputs {
+		if input.Name == name {
+			return input
+		}
+	}
+
+	return nil
+}
+
+// ToTextData prints the calculated stage digests, the canonical input and the named inputs of each digest are printed in the explain mode
+func (report *DigestInputsReport) ToTextData(explain bool) []byte {
+	buf := bytes.NewBuffer([]byte{})
+
+	for _, stg := range report.sortedStages() {
+		fmt.Fprintf(buf, "%s: %s\n", stg.logName(), stg.Digest)
+
+		if !explain {
+			continue
+		}
+
+		if stg.CanonicalInput != "" {
+			fmt.Fprintf(buf, "  canonical input (digest is sha3-224 of the input):\n")
+			for _, line := range strings.SplitAfter(stg.CanonicalInput, "\n") {
+				if line != "" {
+					fmt.Fprintf(buf, "    %s", line)
+				}
+			}
+		}
+
+		fmt.Fprintf(buf, "  inputs:\n")
+		for _, input := range stg.Inputs {
+			fmt.Fprintf(buf, "    %s: %q\n", input.Name, input.Value)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// RecordDigestInputs calculates the stage digests the same way as the Graph and records the inputs of each calculated digest
+func (c *Conveyor) RecordDigestInputs(ctx context.Context) (*DigestInputsReport, error) {
+	if err := c.determineStages(ctx); err != nil {
+		return nil, err
+	}
+
+	report := NewDigestInputsReport()
+
+	phase := NewGraphPhase(c, newGraph(c))
+	phase.DigestInputsReport = report
+
+	if err := c.runPhases(ctx, []Phase{phase}, false); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+type DigestInputChangeType string
+
+const (
+	DigestInputAdded   DigestInputChangeType = "added"
+	DigestInputRemoved DigestInputChangeType = "removed"
+	DigestInputChanged DigestInputChangeType = "changed"
+)
+
+type DigestInputChange struct {
+	Name      string
+	Type      DigestInputChangeType
+	BaseValue string `json:",omitempty"`
+	Value     string `json:",omitempty"`
+}
+
+// StageDigestDiff is the difference of the stage digest inputs, the empty BaseDigest or Digest means the stage digest is not calculated in the corresponding report
+type StageDigestDiff struct {
+	ImageName  string
+	Platform   string `json:",omitempty"`
+	StageName  string
+	BaseDigest string
+	Digest     string
+	Changes    []*DigestInputChange
+
+	// PrevStageChangedOnly is true if the digest is changed only due to the previous stage changes
+	PrevStageChangedOnly bool
+}
+
+type DigestInputsDiff struct {
+	Stages         []*StageDigestDiff
+	UnchangedCount int
+}
+
+// DiffDigestInputs compares the stage digest inputs of the base and the target reports stage by stage
+func DiffDigestInputs(base, target *DigestInputsReport) *DigestInputsDiff {
+	baseStages := map[string]*StageDigestInputs{}
+	for _, stg := range base.sortedStages() {
+		baseStages[stg.key()] = stg
+	}
+
+	diff := &DigestInputsDiff{}
+	processedKeys := map[string]bool{}
+	for _, stg := range target.sortedStages() {
+		processedKeys[stg.key()] = true
+
+		baseStg, hasBaseStg := baseStages[stg.key()]
+		if !hasBaseStg {
+			diff.Stages = append(diff.Stages, &StageDigestDiff{ImageName: stg.ImageName, Platform: stg.Platform, StageName: stg.StageName, Digest: stg.Digest})
+			continue
+		}
+
+		if baseStg.Digest == stg.Digest {
+			diff.UnchangedCount++
+			continue
+		}
+
+		diff.Stages = append(diff.Stages, diffStageDigestInputs(baseStg, stg))
+	}
+
+	for _, stg := range base.sortedStages() {
+		if !processedKeys[stg.key()] {
+			diff.Stages = append(diff.Stages, &StageDigestDiff{ImageName: stg.ImageName, Platform: stg.Platform, StageName: stg.StageName, BaseDigest: stg.Digest})
+		}
+	}
+
+	return diff
+}
+
+func diffStageDigestInputs(base, target *StageDigestInputs) *StageDigestDiff {
+	stgDiff := &StageDigestDiff{
+		ImageName:  target.ImageName,
+		Platform:   target.Platform,
+		StageName:  target.StageName,
+		BaseDigest: base.Digest,
+		Digest:     target.Digest,
+	}
+
+	for _, input := range target.Inputs {
+		if baseInput := base.getInput(input.Name); baseInput == nil {
+			stgDiff.Changes = append(stgDiff.Changes, &DigestInputChange{Name: input.Name, Type: DigestInputAdded, Value: input.Value})
+		} else if baseInput.Value != input.Value {
+			stgDiff.Changes = append(stgDiff.Changes, &DigestInputChange{Name: input.Name, Type: DigestInputChanged, BaseValue: baseInput.Value, Value: input.Value})
+		}
+	}
+
+	for _, baseInput := range base.Inputs {
+		if target.getInput(baseInput.Name) == nil {
+			stgDiff.Changes = append(stgDiff.Changes, &DigestInputChange{Name: baseInput.Name, Type: DigestInputRemoved, BaseValue: baseInput.Value})
+		}
+	}
+
+	stgDiff.PrevStageChangedOnly = len(stgDiff.Changes) > 0
+	for _, change := range stgDiff.Changes {
+		if change.Name != digestInputPrevStageDigest && change.Name != digestInputPrevStageDependencies && change.Name != digestInputParentContentDigest {
+			stgDiff.PrevStageChangedOnly = false
+			break
+		}
+	}
+
+	return stgDiff
+}
+
+func (diff *DigestInputsDiff) ToJsonData() ([]byte, error) {
+	data, err := json.MarshalIndent(diff, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, []byte("\n")...)
+
+	return data, nil
+}
+
+func (diff *DigestInputsDiff) ToTextData() []byte {
+	buf := bytes.NewBuffer([]byte{})
+
+	for _, stgDiff := range diff.Stages {
+		stg := &StageDigestInputs{ImageName: stgDiff.ImageName, Platform: stgDiff.Platform, StageName: stgDiff.StageName}
+
+		switch {
+		case stgDiff.BaseDigest == "":
+			fmt.Fprintf(buf, "%s: %s (not calculated in base)\n", stg.logName(), stgDiff.Digest)
+		case stgDiff.Digest == "":
+			fmt.Fprintf(buf, "%s: %s (not calculated in target)\n", stg.logName(), stgDiff.BaseDigest)
+		case stgDiff.PrevStageChangedOnly:
+			fmt.Fprintf(buf, "%s: %s -> %s (previous stage changed)\n", stg.logName(), stgDiff.BaseDigest, stgDiff.Digest)
+		default:
+			fmt.Fprintf(buf, "%s: %s -> %s\n", stg.logName(), stgDiff.BaseDigest, stgDiff.Digest)
+			for _, change := range stgDiff.Changes {
+				switch change.Type {
+				case DigestInputAdded:
+					fmt.Fprintf(buf, "  + %s: %q\n", change.Name, change.Value)
+				case DigestInputRemoved:
+					fmt.Fprintf(buf, "  - %s: %q\n", change.Name, change.BaseValue)
+				default:
+					fmt.Fprintf(buf, "  ~ %s: %q -> %q\n", change.Name, change.BaseValue, change.Value)
+				}
+			}
+		}
+	}
+
+	if len(diff.Stages) == 0 {
+		fmt.Fprintf(buf, "No stage digest changes (%d stages compared)\n", diff.UnchangedCount)
+	} else {
+		fmt.Fprintf(buf, "%d stages changed, %d stages unchanged\n", len(diff.Stages), diff.UnchangedCount)
+	}
+
+	return buf.Bytes()
+}
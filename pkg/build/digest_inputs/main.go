@@ -0,0 +1,108 @@
+package digest_inputs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/werf/werf/pkg/util"
+)
+
+// maxValueLength is the max length of the recorded value, longer values (e.g. patches) are recorded by checksum
+const maxValueLength = 256
+
+// Inputs is the list of the named inputs of the stage digest calculation
+type Inputs struct {
+	mux  sync.Mutex
+	List []*Input
+
+	// Canonical is the exact serialized input of the digest (content digest mode only)
+	Canonical string
+}
+
+type Input struct {
+	Name  string
+	Value string
+
+	// Args are the exact digest args of the input (recorded by Append only)
+	Args []string `json:",omitempty"`
+}
+
+type contextKey struct{}
+
+// NewContext enables the recording of the digest inputs into the specified list
+func NewContext(ctx context.Context, inputs *Inputs) context.Context {
+	return context.WithValue(ctx, contextKey{}, inputs)
+}
+
+// Record adds the input by the name, the repeated name is suffixed with the sequence number.
+// The call is no-op if the recording is not enabled in the context.
+func Record(ctx context.Context, name, value string) {
+	record(ctx, name, value, nil)
+}
+
+// Append appends the values to the digest args and records them as the named input,
+// so that the recorded input is always the same as the hashed one.
+func Append(ctx context.Context, args []string, name string, values ...string) []string {
+	record(ctx, name, strings.Join(values, " "), values)
+	return append(args, values...)
+}
+
+// Args returns the digest args of the inputs recorded by Append in the order of recording
+func (inputs *Inputs) Args() []string {
+	inputs.mux.Lock()
+	defer inputs.mux.Unlock()
+
+	var args []string
+	for _, input := range inputs.List {
+		args = append(args, input.Args...)
+	}
+
+	return args
+}
+
+func record(ctx context.Context, name, value string, args []string) {
+	inputs, ok := ctx.Value(contextKey{}).(*Inputs)
+	if !ok || inputs == nil {
+		return
+	}
+
+	inputs.mux.Lock()
+	defer inputs.mux.Unlock()
+
+	uniqName := name
+	for ind := 2; inputs.hasInput(uniqName); ind++ {
+		uniqName = fmt.Sprintf("%s (%d)", name, ind)
+	}
+
+	if len(value) > maxValueLength {
+		value = fmt.Sprintf("sha256:%s (%d bytes)", util.Sha256Hash(value), len(value))
+	}
+
+	inputs.List = append(inputs.List, &Input{Name: uniqName, Value: value, Args: append([]string(nil), args...)})
+}
+
+// RecordCanonical saves the exact serialized input of the digest.
+// The call is no-op if the recording is not enabled in the context.
+func RecordCanonical(ctx context.Context, value string) {
+	inputs, ok := ctx.Value(contextKey{}).(*Inputs)
+	if !ok || inputs == nil {
+		return
+	}
+
+	inputs.mux.Lock()
+	defer inputs.mux.Unlock()
+
+	inputs.Canonical = value
+}
+
+func (inputs *Inputs) hasInput(name string) bool {
+	for _, input := range inputs.List {
+		if input.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
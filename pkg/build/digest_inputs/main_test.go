@@ -0,0 +1,145 @@
+package digest_inputs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/werf/werf/pkg/util"
+)
+
+func TestRecordWithoutContext(t *testing.T) {
+	ctx := context.Background()
+
+	Record(ctx, "name", "value")
+	RecordCanonical(ctx, "canonical")
+
+	var inputs *Inputs
+	ctx = NewContext(context.Background(), inputs)
+	Record(ctx, "name", "value")
+	RecordCanonical(ctx, "canonical")
+}
+
+func TestRecord(t *testing.T) {
+	inputs := &Inputs{}
+	ctx := NewContext(context.Background(), inputs)
+
+	Record(ctx, "fromImage", "alpine")
+	Record(ctx, "fromImage", "ubuntu")
+	Record(ctx, "fromImage", "debian")
+	Record(ctx, "instruction", "RUN true")
+
+	expected := []Input{
+		{Name: "fromImage", Value: "alpine"},
+		{Name: "fromImage (2)", Value: "ubuntu"},
+		{Name: "fromImage (3)", Value: "debian"},
+		{Name: "instruction", Value: "RUN true"},
+	}
+
+	if len(inputs.List) != len(expected) {
+		t.Fatalf("expected %d inputs, got %d: %v", len(expected), len(inputs.List), inputs.List)
+	}
+
+	for ind, input := range inputs.List {
+		if input.Name != expected[ind].Name || input.Value != expected[ind].Value {
+			t.Errorf("input %d: expected %+v, got %+v", ind, expected[ind], *input)
+		}
+	}
+}
+
+func TestRecordLongValue(t *testing.T) {
+	inputs := &Inputs{}
+	ctx := NewContext(context.Background(), inputs)
+
+	shortValue := strings.Repeat("a", maxValueLength)
+	longValue := strings.Repeat("a", maxValueLength+1)
+
+	Record(ctx, "short", shortValue)
+	Record(ctx, "long", longValue)
+
+	if inputs.List[0].Value != shortValue {
+		t.Errorf("expected value of max length to be recorded as is, got %q", inputs.List[0].Value)
+	}
+
+	expectedLongValue := fmt.Sprintf("sha256:%s (%d bytes)", util.Sha256Hash(longValue), len(longValue))
+	if inputs.List[1].Value != expectedLongValue {
+		t.Errorf("expected %q, got %q", expectedLongValue, inputs.List[1].Value)
+	}
+}
+
+func TestRecordCanonical(t *testing.T) {
+	inputs := &Inputs{}
+	ctx := NewContext(context.Background(), inputs)
+
+	RecordCanonical(ctx, "first")
+	RecordCanonical(ctx, "second")
+
+	if inputs.Canonical != "second" {
+		t.Errorf("expected last canonical value to be saved, got %q", inputs.Canonical)
+	}
+
+	if len(inputs.List) != 0 {
+		t.Errorf("expected no inputs to be recorded, got %v", inputs.List)
+	}
+}
+
+func TestRecordConcurrent(t *testing.T) {
+	inputs := &Inputs{}
+	ctx := NewContext(context.Background(), inputs)
+
+	const count = 50
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Record(ctx, "dependency", "value")
+		}()
+	}
+	wg.Wait()
+
+	if len(inputs.List) != count {
+		t.Fatalf("expected %d inputs, got %d", count, len(inputs.List))
+	}
+
+	names := map[string]bool{}
+	for _, input := range inputs.List {
+		if names[input.Name] {
+			t.Errorf("duplicate input name %q", input.Name)
+		}
+		names[input.Name] = true
+	}
+}
+
+func TestAppend(t *testing.T) {
+	inputs := &Inputs{}
+	ctx := NewContext(context.Background(), inputs)
+
+	longValue := strings.Repeat("a", maxValueLength+1)
+
+	var args []string
+	args = Append(ctx, args, "mount", "/host", "/container", "bind")
+	args = Append(ctx, args, "command", longValue)
+	Record(ctx, "not hashed", "value")
+
+	expectedArgs := []string{"/host", "/container", "bind", longValue}
+	if strings.Join(args, "\n") != strings.Join(expectedArgs, "\n") {
+		t.Errorf("expected args %v, got %v", expectedArgs, args)
+	}
+
+	if inputs.List[0].Value != "/host /container bind" {
+		t.Errorf("unexpected recorded value %q", inputs.List[0].Value)
+	}
+
+	if util.Sha256Hash(inputs.Args()...) != util.Sha256Hash(args...) {
+		t.Errorf("expected recorded args %v to reproduce the digest of %v", inputs.Args(), args)
+	}
+
+	// the appended args are not recorded without the context
+	if args := Append(context.Background(), nil, "name", "value"); len(args) != 1 || args[0] != "value" {
+		t.Errorf("unexpected args %v", args)
+	}
+}
@@ -0,0 +1,377 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/config"
+)
+
+type GraphFormat string
+
+const (
+	GraphDot  GraphFormat = "dot"
+	GraphJSON GraphFormat = "json"
+)
+
+type GraphStageStatus string
+
+const (
+	GraphStageCached  GraphStageStatus = "cached"
+	GraphStageToBuild GraphStageStatus = "to-build"
+	GraphStageEmpty   GraphStageStatus = "empty"
+	// GraphStageUnknown is the status of the stage, which digest cannot be calculated without building of the previous stages or in the offline mode
+	GraphStageUnknown GraphStageStatus = "unknown"
+)
+
+type GraphEdgeType string
+
+const (
+	GraphEdgeFromImage    GraphEdgeType = "fromImage"
+	GraphEdgeFromArtifact GraphEdgeType = "fromArtifact"
+	GraphEdgeImport       GraphEdgeType = "import"
+)
+
+const graphUnknownDigest = "unknown"
+
+// Graph is the image dependency graph of the conveyor with the stage chain of each image
+type Graph struct {
+	mux sync.Mutex
+
+	ImageSets [][]string
+	Images    []*GraphImage
+	Edges     []*GraphEdge
+
+	incompleteImages map[string]bool
+}
+
+type GraphImage struct {
+	Name       string
+	Platform   string `json:",omitempty"`
+	IsArtifact bool
+	Stages     []*GraphStage
+}
+
+type GraphStage struct {
+	Name   string
+	Digest string
+	Status GraphStageStatus
+}
+
+// GraphEdge is the dependency of the image To on the image From
+type GraphEdge struct {
+	From string
+	To   string
+	Type GraphEdgeType
+}
+
+func newGraph(c *Conveyor) *Graph {
+	graph := &Graph{incompleteImages: map[string]bool{}}
+
+	processedNames := map[string]bool{}
+	for _, imageSet := range c.imageSets {
+		var names []string
+		for _, img := range imageSet {
+			if !processedNames[img.GetName()] {
+				processedNames[img.GetName()] = true
+				names = append(names, img.GetName())
+			}
+		}
+		sort.Strings(names)
+		graph.ImageSets = append(graph.ImageSets, names)
+
+		var images []*Image
+		images = append(images, imageSet...)
+		sort.SliceStable(images, func(i, j int) bool {
+			if images[i].GetName() != images[j].GetName() {
+				return images[i].GetName() < images[j].GetName()
+			}
+			return images[i].platform < images[j].platform
+		})
+
+		for _, img := range images {
+			graphImage := &GraphImage{Name: img.GetName(), Platform: img.platform, IsArtifact: img.isArtifact}
+			for _, stg := range img.GetStages() {
+				graphImage.Stages = append(graphImage.Stages, &GraphStage{Name: string(stg.Name()), Digest: graphUnknownDigest, Status: GraphStageUnknown})
+			}
+			graph.Images = append(graph.Images, graphImage)
+		}
+	}
+
+	for _, imageSet := range graph.ImageSets {
+		for _, name := range imageSet {
+			graph.Edges = append(graph.Edges, getImageConfigGraphEdges(c.werfConfig, name)...)
+		}
+	}
+
+	return graph
+}
+
+func getImageConfigGraphEdges(werfConfig *config.WerfConfig, name string) []*GraphEdge {
+	var imageBaseConfig *config.StapelImageBase
+	if imageConfig := werfConfig.GetStapelImage(name); imageConfig != nil {
+		imageBaseConfig = imageConfig.StapelImageBase
+	} else if artifactConfig := werfConfig.GetArtifact(name); artifactConfig != nil {
+		imageBaseConfig = artifactConfig.StapelImageBase
+	} else {
+		return nil
+	}
+
+	var edges []*GraphEdge
+	if imageBaseConfig.FromImageName != "" {
+		edges = append(edges, &GraphEdge{From: imageBaseConfig.FromImageName, To: name, Type: GraphEdgeFromImage})
+	}
+
+	if imageBaseConfig.FromArtifactName != "" {
+		edges = append(edges, &GraphEdge{From: imageBaseConfig.FromArtifactName, To: name, Type: GraphEdgeFromArtifact})
+	}
+
+	for _, imp := range imageBaseConfig.Import {
+		if imp.ImageName != "" {
+			edges = append(edges, &GraphEdge{From: imp.ImageName, To: name, Type: GraphEdgeImport})
+		} else if imp.ArtifactName != "" {
+			edges = append(edges, &GraphEdge{From: imp.ArtifactName, To: name, Type: GraphEdgeImport})
+		}
+	}
+
+	return edges
+}
+
+func (graph *Graph) getStage(img *Image, stageName string) *GraphStage {
+	for _, graphImage := range graph.Images {
+		if graphImage.Name != img.GetName() || graphImage.Platform != img.platform {
+			continue
+		}
+
+		for _, graphStage := range graphImage.Stages {
+			if graphStage.Name == stageName {
+				return graphStage
+			}
+		}
+	}
+
+	panic(fmt.Sprintf("stage %s of image %s not found in the graph", stageName, img.LogName()))
+}
+
+func (graph *Graph) setStage(img *Image, stageName, digest string, status GraphStageStatus) {
+	graph.mux.Lock()
+	defer graph.mux.Unlock()
+
+	graphStage := graph.getStage(img, stageName)
+	graphStage.Digest = digest
+	graphStage.Status = status
+}
+
+func (graph *Graph) setImageIncomplete(name string) {
+	graph.mux.Lock()
+	defer graph.mux.Unlock()
+
+	graph.incompleteImages[name] = true
+}
+
+// isImageResolvable returns false if the image depends on an image with not built stages
+func (graph *Graph) isImageResolvable(name string) bool {
+	graph.mux.Lock()
+	defer graph.mux.Unlock()
+
+	for _, edge := range graph.Edges {
+		if edge.To == name && graph.incompleteImages[edge.From] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (graph *Graph) ToJsonData() ([]byte, error) {
+	graph.mux.Lock()
+	defer graph.mux.Unlock()
+
+	data, err := json.MarshalIndent(graph, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, []byte("\n")...)
+
+	return data, nil
+}
+
+func (graph *Graph) ToDotData() []byte {
+	graph.mux.Lock()
+	defer graph.mux.Unlock()
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("digraph werf {\n")
+	buf.WriteString("\tcompound=true;\n")
+	buf.WriteString("\trankdir=LR;\n")
+	buf.WriteString("\tnode [shape=box, style=filled];\n")
+
+	firstStageNodeIDs := map[string]string{}
+	lastStageNodeIDs := map[string]string{}
+	for ind, graphImage := range graph.Images {
+		clusterName := graphImage.Name
+		if graphImage.IsArtifact {
+			clusterName = fmt.Sprintf("artifact/%s", clusterName)
+		}
+		if graphImage.Platform != "" {
+			clusterName = fmt.Sprintf("%s [%s]", clusterName, graphImage.Platform)
+		}
+
+		fmt.Fprintf(buf, "\tsubgraph \"cluster_%d\" {\n", ind)
+		fmt.Fprintf(buf, "\t\tlabel=%s;\n", dotQuote(clusterName))
+
+		var prevNodeID string
+		for _, graphStage := range graphImage.Stages {
+			nodeID := fmt.Sprintf("image_%d_%s", ind, graphStage.Name)
+			label := fmt.Sprintf("%s\\n%s", graphStage.Name, graphStage.Status)
+			if graphStage.Digest != "" {
+				label = fmt.Sprintf("%s\\ndigest: %s\\n%s", graphStage.Name, graphStage.Digest, graphStage.Status)
+			}
+			fmt.Fprintf(buf, "\t\t%s [label=%s, fillcolor=%s];\n", dotQuote(nodeID), dotQuote(label), dotStageColor(graphStage.Status))
+
+			if prevNodeID != "" {
+				fmt.Fprintf(buf, "\t\t%s -> %s;\n", dotQuote(prevNodeID), dotQuote(nodeID))
+			} else {
+				if _, hasKey := firstStageNodeIDs[graphImage.Name]; !hasKey {
+					firstStageNodeIDs[graphImage.Name] = nodeID
+				}
+			}
+			prevNodeID = nodeID
+		}
+
+		if _, hasKey := lastStageNodeIDs[graphImage.Name]; !hasKey && prevNodeID != "" {
+			lastStageNodeIDs[graphImage.Name] = prevNodeID
+		}
+
+		buf.WriteString("\t}\n")
+	}
+
+	for _, edge := range graph.Edges {
+		from, to := lastStageNodeIDs[edge.From], firstStageNodeIDs[edge.To]
+		if from == "" || to == "" {
+			continue
+		}
+
+		fmt.Fprintf(buf, "\t%s -> %s [label=%s, style=dashed];\n", dotQuote(from), dotQuote(to), dotQuote(string(edge.Type)))
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+func dotQuote(s string) string {
+	return fmt.Sprintf("\"%s\"", strings.ReplaceAll(s, "\"", "\\\""))
+}
+
+func dotStageColor(status GraphStageStatus) string {
+	switch status {
+	case GraphStageCached:
+		return "palegreen"
+	case GraphStageToBuild:
+		return "lightsalmon"
+	case GraphStageEmpty:
+		return "white"
+	default:
+		return "lightgrey"
+	}
+}
+
+// GraphPhase calculates the stage digests and checks the stages in the stages storage without building, the same way as the ShouldBeBuiltMode of the BuildPhase.
+// After the first stage, which should be built, the following stages of the image and the images depending on it are unknown.
+type GraphPhase struct {
+	*BuildPhase
+	Graph *Graph
+
+	isImageResolvable bool
+}
+
+func NewGraphPhase(c *Conveyor, graph *Graph) *GraphPhase {
+	return &GraphPhase{
+		BuildPhase: NewBuildPhase(c, BuildPhaseOptions{ShouldBeBuiltMode: true}),
+		Graph:      graph,
+	}
+}
+
+func (phase *GraphPhase) Name() string {
+	return "graph"
+}
+
+func (phase *GraphPhase) AfterImages(_ context.Context) error {
+	return nil
+}
+
+func (phase *GraphPhase) BeforeImageStages(_ context.Context, img *Image) error {
+	phase.StagesIterator = NewStagesIterator(phase.Conveyor)
+	phase.isImageResolvable = phase.Graph.isImageResolvable(img.GetName())
+
+	if phase.isImageResolvable {
+		img.SetupBaseImage(phase.Conveyor)
+	}
+
+	return nil
+}
+
+func (phase *GraphPhase) OnImageStage(ctx context.Context, img *Image, stg stage.Interface) error {
+	if !phase.isImageResolvable {
+		return nil
+	}
+
+	return phase.StagesIterator.OnImageStage(ctx, img, stg, func(img *Image, stg stage.Interface, isEmpty bool) error {
+		if isEmpty {
+			phase.Graph.setStage(img, string(stg.Name()), "", GraphStageEmpty)
+			return nil
+		}
+
+		if err := stg.FetchDependencies(ctx, phase.Conveyor, phase.Conveyor.ContainerRuntime); err != nil {
+			return fmt.Errorf("unable to fetch dependencies for stage %s: %s", stg.LogDetailedName(), err)
+		}
+
+		foundSuitableStage, cleanupFunc, err := phase.calculateStage(ctx, img, stg)
+		if cleanupFunc != nil {
+			defer cleanupFunc()
+		}
+		if err != nil {
+			return err
+		}
+
+		if foundSuitableStage {
+			phase.Graph.setStage(img, string(stg.Name()), stg.GetDigest(), GraphStageCached)
+			return nil
+		}
+
+		phase.Graph.setStage(img, string(stg.Name()), stg.GetDigest(), GraphStageToBuild)
+		phase.isImageResolvable = false
+
+		// the stage image without description is the stage to be built
+		stg.SetImage(phase.Conveyor.GetOrCreateStageImage(castToStageImage(phase.StagesIterator.GetPrevImage(img, stg)), uuid.New().String()))
+
+		return nil
+	})
+}
+
+func (phase *GraphPhase) AfterImageStages(_ context.Context, img *Image) error {
+	if !phase.isImageResolvable {
+		phase.Graph.setImageIncomplete(img.GetName())
+		return nil
+	}
+
+	img.SetLastNonEmptyStage(phase.StagesIterator.PrevNonEmptyStage)
+	img.SetContentDigest(phase.StagesIterator.PrevNonEmptyStage.GetContentDigest())
+
+	return nil
+}
+
+func (phase *GraphPhase) Clone() Phase {
+	u := *phase
+	u.BuildPhase = phase.BuildPhase.Clone().(*BuildPhase)
+	return &u
+}
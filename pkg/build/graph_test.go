@@ -0,0 +1,145 @@
+package build
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/config"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the tests")
+
+// graphTestStage is the stage, which only has the name required by the graph
+type graphTestStage struct {
+	stage.Interface
+	name stage.StageName
+}
+
+func (s *graphTestStage) Name() stage.StageName {
+	return s.name
+}
+
+func newGraphTestImage(name, platform string, isArtifact bool, stageNames ...stage.StageName) *Image {
+	img := &Image{name: name, platform: platform, isArtifact: isArtifact}
+	for _, stageName := range stageNames {
+		img.stages = append(img.stages, &graphTestStage{name: stageName})
+	}
+	return img
+}
+
+func newTestGraph() *Graph {
+	werfConfig := &config.WerfConfig{
+		StapelImages: []*config.StapelImage{
+			{StapelImageBase: &config.StapelImageBase{
+				Name:          "backend",
+				FromImageName: "base",
+				Import:        []*config.Import{{ArtifactName: "assets"}},
+			}},
+			{StapelImageBase: &config.StapelImageBase{
+				Name:             "frontend \"web\"",
+				FromArtifactName: "assets",
+			}},
+		},
+		ImagesFromDockerfile: []*config.ImageFromDockerfile{{Name: "base"}},
+		Artifacts: []*config.StapelImageArtifact{
+			{StapelImageBase: &config.StapelImageBase{Name: "assets"}},
+		},
+	}
+
+	assets := newGraphTestImage("assets", "", true, stage.From, stage.Install)
+	baseArm64 := newGraphTestImage("base", "linux/arm64", false, stage.Dockerfile)
+	baseAmd64 := newGraphTestImage("base", "linux/amd64", false, stage.Dockerfile)
+	backend := newGraphTestImage("backend", "", false, stage.From, stage.BeforeInstall, stage.Install, stage.DockerInstructions)
+	frontend := newGraphTestImage("frontend \"web\"", "", false, stage.From, stage.Setup)
+
+	c := &Conveyor{
+		werfConfig: werfConfig,
+		imageSets: [][]*Image{
+			{baseArm64, assets, baseAmd64},
+			{frontend, backend},
+		},
+	}
+
+	graph := newGraph(c)
+
+	graph.setStage(assets, string(stage.From), "assets-from-digest", GraphStageCached)
+	graph.setStage(assets, string(stage.Install), "assets-install-digest", GraphStageCached)
+	graph.setStage(baseAmd64, string(stage.Dockerfile), "base-amd64-digest", GraphStageCached)
+	graph.setStage(baseArm64, string(stage.Dockerfile), "base-arm64-digest", GraphStageToBuild)
+	graph.setStage(backend, string(stage.From), "backend-from-digest", GraphStageCached)
+	graph.setStage(backend, string(stage.BeforeInstall), "", GraphStageEmpty)
+	graph.setStage(backend, string(stage.Install), "backend-install-digest", GraphStageToBuild)
+
+	return graph
+}
+
+func checkGolden(t *testing.T, name string, data []byte) {
+	goldenPath := filepath.Join("testdata", name)
+
+	if *updateGolden {
+		if err := ioutil.WriteFile(goldenPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != string(expected) {
+		t.Errorf("output does not match %s (run the test with -update to regenerate):\n%s", goldenPath, data)
+	}
+}
+
+func TestGraphToDotData(t *testing.T) {
+	checkGolden(t, "graph.dot.golden", newTestGraph().ToDotData())
+}
+
+func TestGraphToJsonData(t *testing.T) {
+	data, err := newTestGraph().ToJsonData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, "graph.json.golden", data)
+}
+
+func TestNewGraph(t *testing.T) {
+	graph := newTestGraph()
+
+	if len(graph.ImageSets) != 2 {
+		t.Fatalf("unexpected image sets: %v", graph.ImageSets)
+	}
+
+	// the multi-platform image is listed once in the image set and once per platform in the images
+	if len(graph.ImageSets[0]) != 2 || graph.ImageSets[0][0] != "assets" || graph.ImageSets[0][1] != "base" {
+		t.Errorf("unexpected first image set: %v", graph.ImageSets[0])
+	}
+
+	var platforms []string
+	for _, graphImage := range graph.Images {
+		if graphImage.Name == "base" {
+			platforms = append(platforms, graphImage.Platform)
+		}
+	}
+	if len(platforms) != 2 || platforms[0] != "linux/amd64" || platforms[1] != "linux/arm64" {
+		t.Errorf("unexpected base image platforms: %v", platforms)
+	}
+
+	// the edges of the dockerfile images and the artifacts without dependencies are not known
+	if len(graph.Edges) != 3 {
+		t.Errorf("unexpected edges count %d", len(graph.Edges))
+	}
+
+	graph.setImageIncomplete("assets")
+	if graph.isImageResolvable("backend") {
+		t.Errorf("backend depends on the incomplete assets artifact")
+	}
+	if !graph.isImageResolvable("base") {
+		t.Errorf("base does not depend on the incomplete images")
+	}
+}
@@ -25,7 +25,8 @@ const (
 )
 
 type Image struct {
-	name string
+	name     string
+	platform string
 
 	baseImageName      string
 	baseImageImageName string
@@ -43,11 +44,19 @@ type Image struct {
 }
 
 func (i *Image) LogName() string {
-	return logging.ImageLogName(i.name, i.isArtifact)
+	return imageLogNameWithPlatform(logging.ImageLogName(i.name, i.isArtifact), i.platform)
 }
 
 func (i *Image) LogDetailedName() string {
-	return logging.ImageLogProcessName(i.name, i.isArtifact)
+	return imageLogNameWithPlatform(logging.ImageLogProcessName(i.name, i.isArtifact), i.platform)
+}
+
+func imageLogNameWithPlatform(logName, platform string) string {
+	if platform == "" {
+		return logName
+	}
+
+	return fmt.Sprintf("%s [%s]", logName, platform)
 }
 
 func (i *Image) LogProcessStyle() color.Style {
@@ -128,6 +137,11 @@ func (i *Image) GetName() string {
 	return i.name
 }
 
+// GetPlatform returns the target platform of the multi-platform image or an empty string for the image built for the host platform
+func (i *Image) GetPlatform() string {
+	return i.platform
+}
+
 func (i *Image) GetLogName() string {
 	return i.LogName()
 }
@@ -135,7 +149,7 @@ func (i *Image) GetLogName() string {
 func (i *Image) SetupBaseImage(c *Conveyor) {
 	if i.baseImageImageName != "" {
 		i.baseImageType = StageAsBaseImage
-		i.stageAsBaseImage = c.GetImage(i.baseImageImageName).GetLastNonEmptyStage()
+		i.stageAsBaseImage = c.GetImageForPlatform(i.baseImageImageName, i.platform).GetLastNonEmptyStage()
 		i.baseImage = c.GetOrCreateStageImage(nil, i.stageAsBaseImage.GetImage().Name())
 	} else {
 		i.baseImageType = ImageFromRegistryAsBaseImage
@@ -150,9 +164,7 @@ func (i *Image) GetBaseImage() *container_runtime.StageImage {
 func (i *Image) FetchBaseImage(ctx context.Context, c *Conveyor) error {
 	switch i.baseImageType {
 	case ImageFromRegistryAsBaseImage:
-		containerRuntime := c.ContainerRuntime.(*container_runtime.LocalDockerServerRuntime)
-
-		if inspect, err := containerRuntime.GetImageInspect(ctx, i.baseImage.Name()); err != nil {
+		if inspect, err := c.ContainerRuntime.GetImageInspect(ctx, i.baseImage.Name()); err != nil {
 			return fmt.Errorf("unable to inspect local image %s: %s", i.baseImage.Name(), err)
 		} else if inspect != nil {
 			// TODO: do not use container_runtime.StageImage for base image
@@ -183,7 +195,7 @@ func (i *Image) FetchBaseImage(ctx context.Context, c *Conveyor) error {
 			return err
 		}
 
-		if inspect, err := containerRuntime.GetImageInspect(ctx, i.baseImage.Name()); err != nil {
+		if inspect, err := c.ContainerRuntime.GetImageInspect(ctx, i.baseImage.Name()); err != nil {
 			return fmt.Errorf("unable to inspect local image %s: %s", i.baseImage.Name(), err)
 		} else if inspect == nil {
 			return fmt.Errorf("unable to inspect local image %s after successful pull: image is not exists", i.baseImage.Name())
@@ -197,7 +209,7 @@ func (i *Image) FetchBaseImage(ctx context.Context, c *Conveyor) error {
 		if err := c.ContainerRuntime.RefreshImageObject(ctx, &container_runtime.DockerImage{Image: i.baseImage}); err != nil {
 			return err
 		}
-		if err := c.StorageManager.FetchStage(ctx, i.stageAsBaseImage); err != nil {
+		if err := c.FetchStage(ctx, i.stageAsBaseImage); err != nil {
 			return err
 		}
 	default:
@@ -8,4 +8,7 @@ import (
 
 type ImportServer interface {
 	GetCopyCommand(ctx context.Context, importConfig *config.Import) string
+	// GetVolumes returns the volumes required by the copy command in the stage container
+	GetVolumes() []string
+	Shutdown(ctx context.Context) error
 }
@@ -0,0 +1,48 @@
+package import_server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/google/uuid"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/config"
+)
+
+// LocalDirServer serves the import source filesystem exported into the host dir,
+// the dir is mounted read-only into the stage container and files are copied by the stapel rsync without the rsync daemon.
+// It is used by the container runtimes that cannot run the daemon container with the network access from the stage container.
+type LocalDirServer struct {
+	HostDir      string
+	ContainerDir string
+}
+
+func NewLocalDirServer(hostDir string) *LocalDirServer {
+	return &LocalDirServer{
+		HostDir:      hostDir,
+		ContainerDir: path.Join("/.werf/import_server", uuid.New().String()),
+	}
+}
+
+func (srv *LocalDirServer) GetVolumes() []string {
+	return []string{fmt.Sprintf("%s:%s:ro", srv.HostDir, srv.ContainerDir)}
+}
+
+func (srv *LocalDirServer) GetCopyCommand(ctx context.Context, importConfig *config.Import) string {
+	command := getRsyncCopyCommand(path.Join(srv.ContainerDir, importConfig.Add), "", srv.ContainerDir, importConfig)
+
+	logboek.Context(ctx).Debug().LogF("Local dir server copy commands for import: artifact=%q image=%q add=%s to=%s includePaths=%v excludePaths=%v: %q\n", importConfig.ArtifactName, importConfig.ImageName, importConfig.Add, importConfig.To, importConfig.IncludePaths, importConfig.ExcludePaths, command)
+
+	return command
+}
+
+func (srv *LocalDirServer) Shutdown(_ context.Context) error {
+	if err := os.RemoveAll(srv.HostDir); err != nil {
+		return fmt.Errorf("unable to remove %s: %s", srv.HostDir, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package import_server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/werf/werf/pkg/config"
+)
+
+func TestLocalDirServerGetCopyCommand(t *testing.T) {
+	srv := NewLocalDirServer("/tmp/import/rootfs")
+
+	if volumes := srv.GetVolumes(); len(volumes) != 1 || volumes[0] != fmt.Sprintf("/tmp/import/rootfs:%s:ro", srv.ContainerDir) {
+		t.Errorf("unexpected volumes %v", volumes)
+	}
+
+	command := srv.GetCopyCommand(context.Background(), &config.Import{
+		ArtifactExport: &config.ArtifactExport{ExportBase: &config.ExportBase{Add: "/app", To: "/opt/app", IncludePaths: []string{"bin"}, ExcludePaths: []string{"bin/tmp"}}},
+	})
+
+	for _, expected := range []string{
+		fmt.Sprintf(" -L %s/app)", srv.ContainerDir),
+		fmt.Sprintf("--filter='-/ %s/app/bin/tmp'", srv.ContainerDir),
+		fmt.Sprintf("--filter='+/ %s/app/bin/**'", srv.ContainerDir),
+		fmt.Sprintf("--filter='-/ %s/app/**'", srv.ContainerDir),
+		fmt.Sprintf(" %s/app$IMPORT_PATH_TRAILING_SLASH_OPTIONAL /opt/app", srv.ContainerDir),
+	} {
+		if !strings.Contains(command, expected) {
+			t.Errorf("expected command to contain %q:\n%s", expected, command)
+		}
+	}
+
+	if strings.Contains(command, "RSYNC_PASSWORD") {
+		t.Errorf("expected local copy command without the rsync daemon password:\n%s", command)
+	}
+}
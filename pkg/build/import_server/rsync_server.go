@@ -114,12 +114,25 @@ func (srv *RsyncServer) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-func (srv *RsyncServer) GetCopyCommand(ctx context.Context, importConfig *config.Import) string {
-	var args []string
+func (srv *RsyncServer) GetVolumes() []string {
+	return nil
+}
 
+func (srv *RsyncServer) GetCopyCommand(ctx context.Context, importConfig *config.Import) string {
 	rsyncImportPathSpec := fmt.Sprintf("rsync://%s@%s:%s/import/%s", srv.AuthUser, srv.IPAddress, srv.Port, importConfig.Add)
-	rsyncStatImportPathCommand := fmt.Sprintf("RSYNC_PASSWORD='%s' %s -L %s", srv.AuthPassword, stapel.RsyncBinPath(), rsyncImportPathSpec)
+	command := getRsyncCopyCommand(rsyncImportPathSpec, fmt.Sprintf("RSYNC_PASSWORD='%s' ", srv.AuthPassword), "/", importConfig)
+
+	logboek.Context(ctx).Debug().LogF("Rsync server copy commands for import: artifact=%q image=%q add=%s to=%s includePaths=%v excludePaths=%v: %q\n", importConfig.ArtifactName, importConfig.ImageName, importConfig.Add, importConfig.To, importConfig.IncludePaths, importConfig.ExcludePaths, command)
+
+	return command
+}
+
+// getRsyncCopyCommand returns the command copying the import path into the stage container,
+// the import path spec is either the rsync daemon url or the local path of the import source mounted into the sourceRootDir
+func getRsyncCopyCommand(importPathSpec, rsyncEnv, sourceRootDir string, importConfig *config.Import) string {
+	var args []string
 
+	rsyncStatImportPathCommand := fmt.Sprintf("%s%s -L %s", rsyncEnv, stapel.RsyncBinPath(), importPathSpec)
 	// save stat output to variable
 	args = append(args, fmt.Sprintf("statOutput=$(%s)", rsyncStatImportPathCommand))
 	// check command exit code from last subshell
@@ -140,7 +153,7 @@ func (srv *RsyncServer) GetCopyCommand(ctx context.Context, importConfig *config
 	if importConfig.Owner != "" || importConfig.Group != "" {
 		rsyncChownOption = fmt.Sprintf("--chown=%s:%s", importConfig.Owner, importConfig.Group)
 	}
-	rsyncCommand := fmt.Sprintf("RSYNC_PASSWORD='%s' %s --archive --links --inplace %s", srv.AuthPassword, stapel.RsyncBinPath(), rsyncChownOption)
+	rsyncCommand := fmt.Sprintf("%s%s --archive --links --inplace %s", rsyncEnv, stapel.RsyncBinPath(), rsyncChownOption)
 
 	if len(importConfig.IncludePaths) != 0 {
 		/**
@@ -151,11 +164,11 @@ func (srv *RsyncServer) GetCopyCommand(ctx context.Context, importConfig *config
 		        будет обрабатываться в пользу exclude, этот путь не скопируется.
 		*/
 		for _, p := range importConfig.ExcludePaths {
-			rsyncCommand += fmt.Sprintf(" --filter='-/ %s'", path.Join(importConfig.Add, p))
+			rsyncCommand += fmt.Sprintf(" --filter='-/ %s'", path.Join(sourceRootDir, importConfig.Add, p))
 		}
 
 		for _, p := range importConfig.IncludePaths {
-			targetPath := path.Join(importConfig.Add, p)
+			targetPath := path.Join(sourceRootDir, importConfig.Add, p)
 
 			// Генерируем разрешающее правило для каждого элемента пути
 			for _, pathPart := range descentPath(targetPath) {
@@ -174,22 +187,18 @@ func (srv *RsyncServer) GetCopyCommand(ctx context.Context, importConfig *config
 		}
 
 		// Все что не подошло по include — исключается
-		rsyncCommand += fmt.Sprintf(" --filter='-/ %s'", path.Join(importConfig.Add, "**"))
+		rsyncCommand += fmt.Sprintf(" --filter='-/ %s'", path.Join(sourceRootDir, importConfig.Add, "**"))
 	} else {
 		for _, p := range importConfig.ExcludePaths {
-			rsyncCommand += fmt.Sprintf(" --filter='-/ %s'", path.Join(importConfig.Add, p))
+			rsyncCommand += fmt.Sprintf(" --filter='-/ %s'", path.Join(sourceRootDir, importConfig.Add, p))
 		}
 	}
 
-	rsyncCommand += fmt.Sprintf(" %s$IMPORT_PATH_TRAILING_SLASH_OPTIONAL %s", rsyncImportPathSpec, importConfig.To)
+	rsyncCommand += fmt.Sprintf(" %s$IMPORT_PATH_TRAILING_SLASH_OPTIONAL %s", importPathSpec, importConfig.To)
 	// run rsync itself
 	args = append(args, rsyncCommand)
 
-	command := strings.Join(args, " && ")
-
-	logboek.Context(ctx).Debug().LogF("Rsync server copy commands for import: artifact=%q image=%q add=%s to=%s includePaths=%v excludePaths=%v: %q\n", importConfig.ArtifactName, importConfig.ImageName, importConfig.Add, importConfig.To, importConfig.IncludePaths, importConfig.ExcludePaths, command)
-
-	return command
+	return strings.Join(args, " && ")
 }
 
 func descentPath(filePath string) []string {
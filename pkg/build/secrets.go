@@ -0,0 +1,160 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/werf/werf/pkg/build/builder"
+	"github.com/werf/werf/pkg/config"
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/deploy/secrets_manager"
+	"github.com/werf/werf/pkg/util"
+	"github.com/werf/werf/pkg/werf"
+)
+
+// getImageBuildSecrets returns the image build secrets once per image (the same files are used for all platforms).
+// The secrets are read and written into the host files only when the stage using them is being built, the files are removed on the conveyor termination.
+func (c *Conveyor) getImageBuildSecrets(ctx context.Context, imageName string, secrets []*config.Secret) ([]*builder.BuildSecret, error) {
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+
+	c.getServiceRWMutex("BuildSecrets").Lock()
+	defer c.getServiceRWMutex("BuildSecrets").Unlock()
+
+	if buildSecrets, ok := c.buildSecrets[imageName]; ok {
+		return buildSecrets, nil
+	}
+
+	var buildSecrets []*builder.BuildSecret
+	for _, secret := range secrets {
+		secret := secret
+		buildSecrets = append(buildSecrets, builder.NewBuildSecret(secret.Id, secret.Version, func() (string, error) {
+			hostPath, err := c.writeBuildSecret(ctx, imageName, secret)
+			if err != nil {
+				return "", fmt.Errorf("unable to prepare image %s secret %q: %s", imageName, secret.Id, err)
+			}
+
+			return hostPath, nil
+		}))
+	}
+
+	c.buildSecrets[imageName] = buildSecrets
+
+	return buildSecrets, nil
+}
+
+func (c *Conveyor) writeBuildSecret(ctx context.Context, imageName string, secret *config.Secret) (string, error) {
+	data, err := c.readBuildSecret(ctx, secret)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret: %s", err)
+	}
+
+	imageSecretsDir, err := c.getImageBuildSecretsDir(imageName)
+	if err != nil {
+		return "", err
+	}
+
+	hostPath := filepath.Join(imageSecretsDir, secret.Id)
+	if err := ioutil.WriteFile(hostPath, data, 0400); err != nil {
+		return "", fmt.Errorf("unable to write secret: %s", err)
+	}
+
+	return hostPath, nil
+}
+
+func (c *Conveyor) getImageBuildSecretsDir(imageName string) (string, error) {
+	c.getServiceRWMutex("BuildSecretsDir").Lock()
+	defer c.getServiceRWMutex("BuildSecretsDir").Unlock()
+
+	if dir, ok := c.buildSecretsImageDirs[imageName]; ok {
+		return dir, nil
+	}
+
+	if c.buildSecretsDir == "" {
+		dir, err := createBuildSecretsDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to create build secrets dir: %s", err)
+		}
+		c.buildSecretsDir = dir
+
+		c.AppendOnTerminateFunc(func() error {
+			return os.RemoveAll(dir)
+		})
+	}
+
+	dir, err := ioutil.TempDir(c.buildSecretsDir, "image-")
+	if err != nil {
+		return "", fmt.Errorf("unable to create build secrets dir: %s", err)
+	}
+	c.buildSecretsImageDirs[imageName] = dir
+
+	return dir, nil
+}
+
+// readBuildSecret reads the secret value from the environment variable or the host file.
+// The src file is read directly from the file system bypassing giterminism: the secret files are not supposed to be committed into the project repository.
+func (c *Conveyor) readBuildSecret(ctx context.Context, secret *config.Secret) ([]byte, error) {
+	if secret.Env != "" {
+		value, ok := os.LookupEnv(secret.Env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", secret.Env)
+		}
+
+		return []byte(value), nil
+	}
+
+	path := secret.Src
+	if strings.HasPrefix(path, "~") {
+		path = util.ExpandPath(path)
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(c.projectDir, path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !secret.Encrypted {
+		return data, nil
+	}
+
+	encoder, err := secrets_manager.NewSecretsManager(secrets_manager.SecretsManagerOptions{}).GetYamlEncoder(ctx, c.projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return encoder.Decrypt(bytes.TrimSpace(data))
+}
+
+// checkDockerfileImageBuildSecretsSupported fails early if the Dockerfile image secrets cannot be used with docker build: werf disables BuildKit by default, but docker build --secret requires it
+func (c *Conveyor) checkDockerfileImageBuildSecretsSupported(imageName string, secrets []*config.Secret) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	if _, isDocker := c.ContainerRuntime.(*container_runtime.LocalDockerServerRuntime); isDocker && os.Getenv("DOCKER_BUILDKIT") != "1" {
+		return fmt.Errorf("image %s secrets require BuildKit: set DOCKER_BUILDKIT=1 environment variable to build the image with secrets", imageName)
+	}
+
+	return nil
+}
+
+// createBuildSecretsDir creates the directory in the memory backed file system if available
+func createBuildSecretsDir() (string, error) {
+	baseDir := werf.GetTmpDir()
+	if runtime.GOOS == "linux" {
+		if exist, err := util.DirExists("/dev/shm"); err == nil && exist {
+			baseDir = "/dev/shm"
+		}
+	}
+
+	return ioutil.TempDir(baseDir, "werf-build-secrets-")
+}
@@ -0,0 +1,128 @@
+package build
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/werf/werf/pkg/build/builder"
+	"github.com/werf/werf/pkg/config"
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/werf"
+)
+
+func newTestSecretsConveyor(t *testing.T) *Conveyor {
+	if err := werf.Init(t.TempDir(), t.TempDir()); err != nil {
+		t.Fatalf("unable to init werf: %s", err)
+	}
+
+	c := &Conveyor{
+		projectDir:            t.TempDir(),
+		serviceRWMutex:        map[string]*sync.RWMutex{},
+		buildSecrets:          map[string][]*builder.BuildSecret{},
+		buildSecretsImageDirs: map[string]string{},
+	}
+
+	t.Cleanup(func() {
+		if err := c.Terminate(context.Background()); err != nil {
+			t.Errorf("unable to terminate conveyor: %s", err)
+		}
+	})
+
+	return c
+}
+
+func TestGetImageBuildSecretsIsLazy(t *testing.T) {
+	c := newTestSecretsConveyor(t)
+
+	secrets := []*config.Secret{
+		{Id: "token", Env: "WERF_TEST_BUILD_SECRET_NOT_SET"},
+		{Id: "file", Src: "secret.txt", Version: "1"},
+	}
+
+	buildSecrets, err := c.getImageBuildSecrets(context.Background(), "image", secrets)
+	if err != nil {
+		t.Fatalf("expected the secrets not to be read before the build, got error: %s", err)
+	}
+
+	if c.buildSecretsDir != "" {
+		t.Errorf("expected the secrets dir not to be created before the build")
+	}
+
+	if len(buildSecrets) != 2 || buildSecrets[1].Version != "1" {
+		t.Fatalf("unexpected build secrets: %v", buildSecrets)
+	}
+
+	if _, err := buildSecrets[0].GetHostPath(); err == nil {
+		t.Errorf("expected error for the unset environment variable")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(c.projectDir, "secret.txt"), []byte("value"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hostPath, err := buildSecrets[1].GetHostPath()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(hostPath)
+	if err != nil {
+		t.Fatalf("unable to read secret host file: %s", err)
+	}
+
+	if string(data) != "value" {
+		t.Errorf("expected secret value %q, got %q", "value", string(data))
+	}
+
+	sameBuildSecrets, err := c.getImageBuildSecrets(context.Background(), "image", secrets)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if sameHostPath, _ := sameBuildSecrets[1].GetHostPath(); sameHostPath != hostPath {
+		t.Errorf("expected the secrets to be written once per image, got %q and %q", hostPath, sameHostPath)
+	}
+}
+
+func TestCheckDockerfileImageBuildSecretsSupported(t *testing.T) {
+	secrets := []*config.Secret{{Id: "token", Env: "TOKEN"}}
+
+	tests := []struct {
+		name             string
+		containerRuntime container_runtime.ContainerRuntime
+		dockerBuildkit   string
+		secrets          []*config.Secret
+		expectError      bool
+	}{
+		{name: "no secrets", containerRuntime: &container_runtime.LocalDockerServerRuntime{}},
+		{name: "docker without BuildKit", containerRuntime: &container_runtime.LocalDockerServerRuntime{}, secrets: secrets, expectError: true},
+		{name: "docker with disabled BuildKit", containerRuntime: &container_runtime.LocalDockerServerRuntime{}, dockerBuildkit: "0", secrets: secrets, expectError: true},
+		{name: "docker with BuildKit", containerRuntime: &container_runtime.LocalDockerServerRuntime{}, dockerBuildkit: "1", secrets: secrets},
+		{name: "buildah", containerRuntime: &container_runtime.BuildahRuntime{}, secrets: secrets},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dockerBuildkit != "" {
+				t.Setenv("DOCKER_BUILDKIT", tt.dockerBuildkit)
+			} else {
+				t.Setenv("DOCKER_BUILDKIT", "")
+				os.Unsetenv("DOCKER_BUILDKIT")
+			}
+
+			c := &Conveyor{ConveyorOptions: ConveyorOptions{}}
+			c.ContainerRuntime = tt.containerRuntime
+
+			err := c.checkDockerfileImageBuildSecretsSupported("image", tt.secrets)
+			if tt.expectError && err == nil {
+				t.Errorf("expected error")
+			} else if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
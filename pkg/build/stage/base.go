@@ -11,6 +11,7 @@ import (
 
 	"github.com/werf/logboek"
 
+	"github.com/werf/werf/pkg/build/builder"
 	"github.com/werf/werf/pkg/config"
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/image"
@@ -66,6 +67,7 @@ type NewBaseStageOptions struct {
 	ImageTmpDir      string
 	ContainerWerfDir string
 	ProjectName      string
+	Secrets          []*builder.BuildSecret
 }
 
 func newBaseStage(name StageName, options *NewBaseStageOptions) *BaseStage {
@@ -76,6 +78,7 @@ func newBaseStage(name StageName, options *NewBaseStageOptions) *BaseStage {
 	s.imageTmpDir = options.ImageTmpDir
 	s.containerWerfDir = options.ContainerWerfDir
 	s.projectName = options.ProjectName
+	s.secrets = options.Secrets
 	return s
 }
 
@@ -90,6 +93,7 @@ type BaseStage struct {
 	containerWerfDir string
 	configMounts     []*config.Mount
 	projectName      string
+	secrets          []*builder.BuildSecret
 }
 
 func (s *BaseStage) LogDetailedName() string {
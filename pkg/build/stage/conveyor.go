@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/werf/werf/pkg/build/import_server"
+	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/giterminism_manager"
 	"github.com/werf/werf/pkg/storage"
 )
@@ -24,8 +25,10 @@ type Conveyor interface {
 
 	GetImportServer(ctx context.Context, imageName, stageName string) (import_server.ImportServer, error)
 	GetLocalGitRepoVirtualMergeOptions() VirtualMergeOptions
+	GetLocalGitRepoHeadCommit() string
 
 	GiterminismManager() giterminism_manager.Interface
+	GetContainerRuntime() container_runtime.ContainerRuntime
 }
 
 type VirtualMergeOptions struct {
@@ -0,0 +1,125 @@
+package stage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+
+	"github.com/werf/werf/pkg/build/builder"
+	"github.com/werf/werf/pkg/build/digest_inputs"
+	"github.com/werf/werf/pkg/config"
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/giterminism_manager"
+	"github.com/werf/werf/pkg/util"
+)
+
+type digestInputsConveyor struct {
+	Conveyor
+}
+
+func (c *digestInputsConveyor) GetImageContentDigest(imageName string) string {
+	return "content-digest-of-" + imageName
+}
+
+func (c *digestInputsConveyor) GiterminismManager() giterminism_manager.Interface {
+	return nil
+}
+
+func TestFromStageDigestInputs(t *testing.T) {
+	s := &FromStage{
+		BaseStage: newBaseStage(From, &NewBaseStageOptions{ConfigMounts: []*config.Mount{
+			{From: "/host/cache/", To: "/var/cache/", Type: "custom_dir"},
+		}}),
+		baseImageRepoIdOrNone: "sha256:base",
+		cacheVersion:          "1",
+	}
+
+	for _, tc := range []struct {
+		name                         string
+		fromImageOrArtifactImageName string
+		expectedArgs                 []string
+	}{
+		{
+			name:         "base image",
+			expectedArgs: []string{"1", "sha256:base", "/host/cache", "/var/cache", "custom_dir", "alpine:3.13"},
+		},
+		{
+			name:                         "from image",
+			fromImageOrArtifactImageName: "backend",
+			expectedArgs:                 []string{"1", "sha256:base", "/host/cache", "/var/cache", "custom_dir", "content-digest-of-backend"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s.fromImageOrArtifactImageName = tc.fromImageOrArtifactImageName
+
+			inputs := &digest_inputs.Inputs{}
+			digest, err := s.GetDependencies(digest_inputs.NewContext(context.Background(), inputs), &digestInputsConveyor{}, container_runtime.NewStageImage(nil, "alpine:3.13", nil), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected := util.Sha256Hash(tc.expectedArgs...); digest != expected {
+				t.Errorf("expected digest %s, got %s", expected, digest)
+			}
+
+			if !reflect.DeepEqual(inputs.Args(), tc.expectedArgs) {
+				t.Errorf("expected recorded args %v, got %v", tc.expectedArgs, inputs.Args())
+			}
+		})
+	}
+}
+
+func TestDockerfileStageDigestInputs(t *testing.T) {
+	dockerfile := `FROM alpine AS base
+ENV A=1
+ONBUILD RUN echo onbuild
+FROM base
+RUN echo 2
+COPY --from=0 /a /b
+`
+
+	p, err := parser.Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerStages, _, err := instructions.Parse(p.AST)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := NewDockerStages(dockerStages, map[string]string{}, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newDockerfileStage(Dockerfile, NewDockerRunArgs("Dockerfile", "", ".", nil, nil, []string{"host:127.0.0.1"}, "", ""), ds, NewContextChecksum(nil), &NewBaseStageOptions{
+		Secrets: []*builder.BuildSecret{{Id: "npmrc", Version: "3"}, {Id: "token"}},
+	})
+
+	inputs := &digest_inputs.Inputs{}
+	digest, err := s.GetDependencies(digest_inputs.NewContext(context.Background(), inputs), &digestInputsConveyor{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseStageArgs := []string{"host:127.0.0.1", "alpine", "ENV A=1", "RUN echo onbuild"}
+	var expectedArgs []string
+	expectedArgs = append(expectedArgs, "host:127.0.0.1", "base", "RUN echo 2", "COPY --from=0 /a /b")
+	expectedArgs = append(expectedArgs, baseStageArgs...)
+	expectedArgs = append(expectedArgs, "RUN echo onbuild")
+	expectedArgs = append(expectedArgs, baseStageArgs...)
+	expectedArgs = append(expectedArgs, "secret npmrc version 3")
+
+	if expected := util.Sha256Hash(expectedArgs...); digest != expected {
+		t.Errorf("expected digest %s, got %s", expected, digest)
+	}
+
+	if !reflect.DeepEqual(inputs.Args(), expectedArgs) {
+		t.Errorf("expected recorded args:\n%q\ngot:\n%q", expectedArgs, inputs.Args())
+	}
+}
@@ -3,7 +3,9 @@ package stage
 import (
 	"context"
 	"sort"
+	"strings"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/config"
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/util"
@@ -30,9 +32,19 @@ type DockerInstructionsStage struct {
 	instructions *config.Docker
 }
 
-func (s *DockerInstructionsStage) GetDependencies(_ context.Context, _ Conveyor, _, _ container_runtime.ImageInterface) (string, error) {
+func (s *DockerInstructionsStage) GetDependencies(ctx context.Context, _ Conveyor, _, _ container_runtime.ImageInterface) (string, error) {
 	var args []string
 
+	digest_inputs.Record(ctx, "VOLUME", strings.Join(s.instructions.Volume, " "))
+	digest_inputs.Record(ctx, "EXPOSE", strings.Join(s.instructions.Expose, " "))
+	digest_inputs.Record(ctx, "ENV", strings.Join(mapToSortedArgs(s.instructions.Env), " "))
+	digest_inputs.Record(ctx, "LABEL", strings.Join(mapToSortedArgs(s.instructions.Label), " "))
+	digest_inputs.Record(ctx, "CMD", s.instructions.Cmd)
+	digest_inputs.Record(ctx, "ENTRYPOINT", s.instructions.Entrypoint)
+	digest_inputs.Record(ctx, "WORKDIR", s.instructions.Workdir)
+	digest_inputs.Record(ctx, "USER", s.instructions.User)
+	digest_inputs.Record(ctx, "HEALTHCHECK", s.instructions.HealthCheck)
+
 	args = append(args, s.instructions.Volume...)
 	args = append(args, s.instructions.Expose...)
 	args = append(args, mapToSortedArgs(s.instructions.Env)...)
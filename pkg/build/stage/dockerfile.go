@@ -17,6 +17,7 @@ import (
 
 	"github.com/werf/logboek"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/context_manager"
 	"github.com/werf/werf/pkg/docker_registry"
@@ -28,15 +29,32 @@ import (
 )
 
 func GenerateDockerfileStage(dockerRunArgs *DockerRunArgs, dockerStages *DockerStages, contextChecksum *ContextChecksum, baseStageOptions *NewBaseStageOptions) *DockerfileStage {
-	return newDockerfileStage(dockerRunArgs, dockerStages, contextChecksum, baseStageOptions)
+	return newDockerfileStage(Dockerfile, dockerRunArgs, dockerStages, contextChecksum, baseStageOptions)
 }
 
-func newDockerfileStage(dockerRunArgs *DockerRunArgs, dockerStages *DockerStages, contextChecksum *ContextChecksum, baseStageOptions *NewBaseStageOptions) *DockerfileStage {
+// GenerateStagedDockerfileStage returns the stage, which builds the specified named Dockerfile stage (the target if dockerStageName is empty).
+// The digest of the stage is based on the digests of dependencyStages (FROM or COPY --from) instead of the previous stage of the image, the images of dependencyStages are used as the build cache.
+// Every Dockerfile stage should be calculated with the own DockerStages, because the calculation of dependencies changes the stage args and envs.
+func GenerateStagedDockerfileStage(dockerStageName string, dependencyStages []*DockerfileStage, dockerRunArgs *DockerRunArgs, dockerStages *DockerStages, contextChecksum *ContextChecksum, baseStageOptions *NewBaseStageOptions) *DockerfileStage {
+	name := Dockerfile
+	if dockerStageName != "" {
+		name = StageName(fmt.Sprintf("%s-%s", Dockerfile, dockerStageName))
+	}
+
+	s := newDockerfileStage(name, dockerRunArgs, dockerStages, contextChecksum, baseStageOptions)
+	s.staged = true
+	s.dockerStageName = dockerStageName
+	s.dependencyStages = dependencyStages
+
+	return s
+}
+
+func newDockerfileStage(name StageName, dockerRunArgs *DockerRunArgs, dockerStages *DockerStages, contextChecksum *ContextChecksum, baseStageOptions *NewBaseStageOptions) *DockerfileStage {
 	s := &DockerfileStage{}
 	s.DockerRunArgs = dockerRunArgs
 	s.DockerStages = dockerStages
 	s.ContextChecksum = contextChecksum
-	s.BaseStage = newBaseStage(Dockerfile, baseStageOptions)
+	s.BaseStage = newBaseStage(name, baseStageOptions)
 
 	return s
 }
@@ -46,6 +64,20 @@ type DockerfileStage struct {
 	*DockerStages
 	*ContextChecksum
 	*BaseStage
+
+	staged           bool
+	dockerStageName  string
+	dependencyStages []*DockerfileStage
+}
+
+// IsStaged returns true for the stage of the staged Dockerfile image
+func (s *DockerfileStage) IsStaged() bool {
+	return s.staged
+}
+
+// GetDependencyStages returns the Dockerfile stages of the image, which the stage depends on, their images should be available locally to be used as the build cache
+func (s *DockerfileStage) GetDependencyStages() []*DockerfileStage {
+	return s.dependencyStages
 }
 
 func NewDockerRunArgs(dockerfilePath, target, context string, contextAddFiles []string, buildArgs map[string]interface{}, addHost []string, network, ssh string) *DockerRunArgs {
@@ -263,9 +295,7 @@ type dockerfileInstructionInterface interface {
 	Name() string
 }
 
-func (s *DockerfileStage) FetchDependencies(ctx context.Context, _ Conveyor, cr container_runtime.ContainerRuntime) error {
-	containerRuntime := cr.(*container_runtime.LocalDockerServerRuntime)
-
+func (s *DockerfileStage) FetchDependencies(ctx context.Context, _ Conveyor, containerRuntime container_runtime.ContainerRuntime) error {
 outerLoop:
 	for ind, stage := range s.dockerStages {
 		for relatedStageIndex, relatedStage := range s.dockerStages {
@@ -347,21 +377,22 @@ func isUnsupportedMediaTypeError(err error) bool {
 var imageNotExistLocally = errors.New("IMAGE_NOT_EXIST_LOCALLY")
 
 func (s *DockerfileStage) GetDependencies(ctx context.Context, c Conveyor, _, _ container_runtime.ImageInterface) (string, error) {
-	var stagesDependencies [][]string
-	var stagesOnBuildDependencies [][]string
+	// the dependencies of the docker stages are combined first and recorded only for the target stage, in the same order as hashed
+	var stagesDependencies [][]*digest_inputs.Input
+	var stagesOnBuildDependencies [][]*digest_inputs.Input
 
 	for ind, stage := range s.dockerStages {
-		var dependencies []string
-		var onBuildDependencies []string
+		var dependencies []*digest_inputs.Input
+		var onBuildDependencies []*digest_inputs.Input
 
-		dependencies = append(dependencies, s.addHost...)
+		dependencies = append(dependencies, &digest_inputs.Input{Name: fmt.Sprintf("docker stage %d add host", ind), Args: s.addHost})
 
 		resolvedBaseName, err := s.ShlexProcessWordWithMetaArgs(stage.BaseName)
 		if err != nil {
 			return "", err
 		}
 
-		dependencies = append(dependencies, resolvedBaseName)
+		dependencies = append(dependencies, &digest_inputs.Input{Name: fmt.Sprintf("docker stage %d base image", ind), Args: []string{resolvedBaseName}})
 
 		onBuildInstructions, ok := s.imageOnBuildInstructions[resolvedBaseName]
 		if ok {
@@ -371,7 +402,7 @@ func (s *DockerfileStage) GetDependencies(ctx context.Context, c Conveyor, _, _
 					return "", err
 				}
 
-				dependencies = append(dependencies, iOnBuildDependencies...)
+				dependencies = append(dependencies, &digest_inputs.Input{Name: fmt.Sprintf("docker stage %d base image ONBUILD %s", ind, instruction), Args: iOnBuildDependencies})
 			}
 		}
 
@@ -381,8 +412,8 @@ func (s *DockerfileStage) GetDependencies(ctx context.Context, c Conveyor, _, _
 				return "", err
 			}
 
-			dependencies = append(dependencies, cmdDependencies...)
-			onBuildDependencies = append(onBuildDependencies, cmdOnBuildDependencies...)
+			dependencies = append(dependencies, &digest_inputs.Input{Name: fmt.Sprintf("docker stage %d %s", ind, cmd), Args: cmdDependencies})
+			onBuildDependencies = append(onBuildDependencies, &digest_inputs.Input{Name: fmt.Sprintf("docker stage %d %s ONBUILD", ind, cmd), Args: cmdOnBuildDependencies})
 		}
 
 		stagesDependencies = append(stagesDependencies, dependencies)
@@ -414,7 +445,17 @@ func (s *DockerfileStage) GetDependencies(ctx context.Context, c Conveyor, _, _
 		}
 	}
 
-	dockerfileStageDependencies := stagesDependencies[s.dockerTargetStageIndex]
+	var dockerfileStageDependencies []string
+	for _, dependency := range stagesDependencies[s.dockerTargetStageIndex] {
+		dockerfileStageDependencies = digest_inputs.Append(ctx, dockerfileStageDependencies, dependency.Name, dependency.Args...)
+	}
+
+	// the secret values are not taken into account, only the versions if set
+	for _, secret := range s.secrets {
+		if secret.Version != "" {
+			dockerfileStageDependencies = digest_inputs.Append(ctx, dockerfileStageDependencies, fmt.Sprintf("secret %s version", secret.Id), fmt.Sprintf("secret %s version %s", secret.Id, secret.Version))
+		}
+	}
 
 	if dockerfileStageDependenciesDebug() {
 		logboek.Context(ctx).LogLn(dockerfileStageDependencies)
@@ -616,7 +657,22 @@ func (s *DockerfileStage) PrepareImage(ctx context.Context, c Conveyor, _, img c
 		return err
 	}
 
-	img.DockerfileImageBuilder().AppendBuildArgs(s.DockerBuildArgs()...)
+	dockerBuildArgs, err := s.DockerBuildArgs()
+	if err != nil {
+		return err
+	}
+	img.DockerfileImageBuilder().AppendBuildArgs(dockerBuildArgs...)
+
+	if s.staged {
+		// the built stage image should contain the cache metadata to be used by BuildKit with --cache-from
+		img.DockerfileImageBuilder().AppendBuildArgs("--build-arg=BUILDKIT_INLINE_CACHE=1")
+
+		for _, dependencyStage := range s.dependencyStages {
+			if dependencyStage.GetImage() != nil && dependencyStage.GetImage().GetStageDescription() != nil {
+				img.DockerfileImageBuilder().AppendBuildArgs(fmt.Sprintf("--cache-from=%s", dependencyStage.GetImage().Name()))
+			}
+		}
+	}
 	img.DockerfileImageBuilder().AppendBuildArgs(fmt.Sprintf("--label=%s=%s", image.WerfProjectRepoCommitLabel, c.GiterminismManager().HeadCommit()))
 	img.DockerfileImageBuilder().SetFilePathToStdin(archivePath)
 
@@ -662,14 +718,17 @@ func (s *DockerfileStage) prepareContextArchive(ctx context.Context, giterminism
 	return archivePath, nil
 }
 
-func (s *DockerfileStage) DockerBuildArgs() []string {
+// DockerBuildArgs returns the docker build options of the stage, the build secrets are written into the host files on the call
+func (s *DockerfileStage) DockerBuildArgs() ([]string, error) {
 	var result []string
 
 	if s.dockerfilePath != "" {
 		result = append(result, fmt.Sprintf("--file=%s", s.dockerfilePath))
 	}
 
-	if s.target != "" {
+	if s.dockerStageName != "" {
+		result = append(result, fmt.Sprintf("--target=%s", s.dockerStageName))
+	} else if s.target != "" {
 		result = append(result, fmt.Sprintf("--target=%s", s.target))
 	}
 
@@ -691,7 +750,16 @@ func (s *DockerfileStage) DockerBuildArgs() []string {
 		result = append(result, fmt.Sprintf("--ssh=%s", s.ssh))
 	}
 
-	return result
+	for _, secret := range s.secrets {
+		hostPath, err := secret.GetHostPath()
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, fmt.Sprintf("--secret=id=%s,src=%s", secret.Id, hostPath))
+	}
+
+	return result, nil
 }
 
 func (s *DockerfileStage) calculateFilesChecksum(ctx context.Context, giterminismManager giterminism_manager.Interface, wildcards []string, dockerfileLine string) (string, error) {
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/config"
 	"github.com/werf/werf/pkg/container_runtime"
 	imagePkg "github.com/werf/werf/pkg/image"
@@ -47,25 +48,25 @@ type FromStage struct {
 	cacheVersion                 string
 }
 
-func (s *FromStage) GetDependencies(_ context.Context, c Conveyor, prevImage, _ container_runtime.ImageInterface) (string, error) {
+func (s *FromStage) GetDependencies(ctx context.Context, c Conveyor, prevImage, _ container_runtime.ImageInterface) (string, error) {
 	var args []string
 
 	if s.cacheVersion != "" {
-		args = append(args, s.cacheVersion)
+		args = digest_inputs.Append(ctx, args, "fromCacheVersion", s.cacheVersion)
 	}
 
 	if s.baseImageRepoIdOrNone != "" {
-		args = append(args, s.baseImageRepoIdOrNone)
+		args = digest_inputs.Append(ctx, args, "base image repo id", s.baseImageRepoIdOrNone)
 	}
 
 	for _, mount := range s.configMounts {
-		args = append(args, filepath.ToSlash(filepath.Clean(mount.From)), path.Clean(mount.To), mount.Type)
+		args = digest_inputs.Append(ctx, args, fmt.Sprintf("mount %s", path.Clean(mount.To)), filepath.ToSlash(filepath.Clean(mount.From)), path.Clean(mount.To), mount.Type)
 	}
 
 	if s.fromImageOrArtifactImageName != "" {
-		args = append(args, c.GetImageContentDigest(s.fromImageOrArtifactImageName))
+		args = digest_inputs.Append(ctx, args, fmt.Sprintf("image %s content digest", s.fromImageOrArtifactImageName), c.GetImageContentDigest(s.fromImageOrArtifactImageName))
 	} else {
-		args = append(args, prevImage.Name())
+		args = digest_inputs.Append(ctx, args, "base image", prevImage.Name())
 	}
 
 	return util.Sha256Hash(args...), nil
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/git_repo"
 	"github.com/werf/werf/pkg/image"
@@ -56,6 +57,7 @@ func (s *GitArchiveStage) GetDependencies(ctx context.Context, c Conveyor, _, _
 		}
 
 		args = append(args, gitMapping.GetParamshash())
+		digest_inputs.Record(ctx, fmt.Sprintf("git mapping %s params checksum", gitMapping.Name), gitMapping.GetParamshash())
 	}
 
 	sort.Strings(args)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/image"
 	"github.com/werf/werf/pkg/util"
@@ -60,6 +61,7 @@ func (s *GitLatestPatchStage) GetDependencies(ctx context.Context, c Conveyor, _
 		}
 
 		args = append(args, patchContent)
+		digest_inputs.Record(ctx, fmt.Sprintf("git mapping %s patch", gitMapping.Name), patchContent)
 	}
 
 	return util.Sha256Hash(args...), nil
@@ -15,6 +15,7 @@ import (
 
 	"github.com/werf/logboek"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/git_repo"
 	"github.com/werf/werf/pkg/path_matcher"
@@ -116,7 +117,7 @@ func (gm *GitMapping) IsLocal() bool {
 	}
 }
 
-func (gm *GitMapping) getLatestCommit(ctx context.Context) (string, error) {
+func (gm *GitMapping) getLatestCommit(ctx context.Context, c Conveyor) (string, error) {
 	if gm.Commit != "" {
 		return gm.Commit, nil
 	}
@@ -129,6 +130,12 @@ func (gm *GitMapping) getLatestCommit(ctx context.Context) (string, error) {
 		return gm.GitRepo().LatestBranchCommit(ctx, gm.Branch)
 	}
 
+	if gm.LocalGitRepo != nil {
+		if headCommit := c.GetLocalGitRepoHeadCommit(); headCommit != "" {
+			return headCommit, nil
+		}
+	}
+
 	commit, err := gm.GitRepo().HeadCommit(ctx)
 	if err != nil {
 		return "", err
@@ -199,7 +206,7 @@ func (gm *GitMapping) ApplyPatchCommand(ctx context.Context, c Conveyor, prevBui
 func (gm *GitMapping) GetLatestCommitInfo(ctx context.Context, c Conveyor) (ImageCommitInfo, error) {
 	res := ImageCommitInfo{}
 
-	if commit, err := gm.getLatestCommit(ctx); err != nil {
+	if commit, err := gm.getLatestCommit(ctx, c); err != nil {
 		return ImageCommitInfo{}, err
 	} else {
 		res.Commit = commit
@@ -269,7 +276,7 @@ func (gm *GitMapping) GetBaseCommitForPrevBuiltImage(ctx context.Context, c Conv
 
 	var baseCommit string
 	if prevBuiltImageCommitInfo.VirtualMerge {
-		if latestCommit, err := gm.getLatestCommit(ctx); err != nil {
+		if latestCommit, err := gm.getLatestCommit(ctx, c); err != nil {
 			return "", err
 		} else if _, isLocal := gm.GitRepo().(*git_repo.Local); isLocal && c.GetLocalGitRepoVirtualMergeOptions().VirtualMerge && latestCommit == prevBuiltImageCommitInfo.Commit {
 			baseCommit = prevBuiltImageCommitInfo.Commit
@@ -622,6 +629,8 @@ func (gm *GitMapping) StageDependenciesChecksum(ctx context.Context, c Conveyor,
 		} else {
 			hash.Write([]byte(checksum))
 		}
+
+		digest_inputs.Record(ctx, fmt.Sprintf("git mapping %s stage dependency %s checksum", gm.Name, p), checksum)
 	}
 	checksum := fmt.Sprintf("%x", hash.Sum(nil))
 
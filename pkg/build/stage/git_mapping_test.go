@@ -0,0 +1,82 @@
+package stage
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/werf/werf/pkg/git_repo"
+	"github.com/werf/werf/pkg/giterminism_manager"
+)
+
+// headCommitConveyor panics on any Conveyor method except the local git repo options
+type headCommitConveyor struct {
+	Conveyor
+
+	localGitRepoHeadCommit string
+}
+
+func (c *headCommitConveyor) GetLocalGitRepoHeadCommit() string {
+	return c.localGitRepoHeadCommit
+}
+
+func (c *headCommitConveyor) GiterminismManager() giterminism_manager.Interface {
+	panic("giterminism manager should not be used to resolve the local git mapping commit")
+}
+
+func initTestGitRepo(t *testing.T) (*git_repo.Local, string) {
+	dir := t.TempDir()
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	git("init")
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "file")
+	git("commit", "-m", "initial")
+
+	localGitRepo, err := git_repo.OpenLocalRepo(context.Background(), "own", dir, git_repo.OpenLocalRepoOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return localGitRepo, git("rev-parse", "HEAD")
+}
+
+func TestGitMappingGetLatestCommit(t *testing.T) {
+	ctx := context.Background()
+	localGitRepo, headCommit := initTestGitRepo(t)
+	gm := &GitMapping{LocalGitRepo: localGitRepo}
+
+	if commit, err := gm.getLatestCommit(ctx, &headCommitConveyor{}); err != nil {
+		t.Fatal(err)
+	} else if commit != headCommit {
+		t.Errorf("expected local repo head commit %s, got %s", headCommit, commit)
+	}
+
+	baseCommit := strings.Repeat("a", 40)
+	if commit, err := gm.getLatestCommit(ctx, &headCommitConveyor{localGitRepoHeadCommit: baseCommit}); err != nil {
+		t.Fatal(err)
+	} else if commit != baseCommit {
+		t.Errorf("expected overridden head commit %s, got %s", baseCommit, commit)
+	}
+
+	gm.Commit = strings.Repeat("b", 40)
+	if commit, err := gm.getLatestCommit(ctx, &headCommitConveyor{localGitRepoHeadCommit: baseCommit}); err != nil {
+		t.Fatal(err)
+	} else if commit != gm.Commit {
+		t.Errorf("expected configured commit %s, got %s", gm.Commit, commit)
+	}
+}
@@ -11,9 +11,9 @@ import (
 
 	"github.com/werf/logboek"
 
+	"github.com/werf/werf/pkg/build/digest_inputs"
 	"github.com/werf/werf/pkg/config"
 	"github.com/werf/werf/pkg/container_runtime"
-	"github.com/werf/werf/pkg/docker"
 	imagePkg "github.com/werf/werf/pkg/image"
 	"github.com/werf/werf/pkg/stapel"
 	"github.com/werf/werf/pkg/storage"
@@ -67,6 +67,10 @@ func (s *ImportsStage) GetDependencies(ctx context.Context, c Conveyor, _, _ con
 		args = append(args, sourceChecksum)
 		args = append(args, elm.To)
 		args = append(args, elm.Group, elm.Owner)
+
+		digest_inputs.Record(ctx, fmt.Sprintf("import %d source checksum", ind), sourceChecksum)
+		digest_inputs.Record(ctx, fmt.Sprintf("import %d to", ind), elm.To)
+		digest_inputs.Record(ctx, fmt.Sprintf("import %d group and owner", ind), fmt.Sprintf("%s:%s", elm.Group, elm.Owner))
 	}
 
 	return util.Sha256Hash(args...), nil
@@ -82,6 +86,7 @@ func (s *ImportsStage) PrepareImage(ctx context.Context, c Conveyor, _, image co
 
 		command := srv.GetCopyCommand(ctx, elm)
 		image.Container().AddServiceRunCommands(command)
+		image.Container().RunOptions().AddVolume(srv.GetVolumes()...)
 
 		imageServiceCommitChangeOptions := image.Container().ServiceCommitChangeOptions()
 
@@ -134,11 +139,6 @@ func (s *ImportsStage) generateImportChecksum(ctx context.Context, c Conveyor, i
 	sourceImageDockerImageName := getSourceImageDockerImageName(c, importElm)
 	importSourceID := getImportSourceID(c, importElm)
 
-	stapelContainerName, err := stapel.GetOrCreateContainer(ctx)
-	if err != nil {
-		return "", err
-	}
-
 	importHostTmpDir := filepath.Join(s.imageTmpDir, string(s.Name()), "imports", importSourceID)
 	importContainerDir := s.containerWerfDir
 
@@ -152,23 +152,13 @@ func (s *ImportsStage) generateImportChecksum(ctx context.Context, c Conveyor, i
 		return "", fmt.Errorf("unable to create script: %s", err)
 	}
 
-	runArgs := []string{
-		"--rm",
-		"--user=0:0",
-		"--workdir=/",
-		fmt.Sprintf("--volumes-from=%s", stapelContainerName),
-		fmt.Sprintf("--volume=%s:%s", importHostTmpDir, importContainerDir),
-		fmt.Sprintf("--entrypoint=%s", stapel.BashBinPath()),
-		sourceImageDockerImageName,
-		importScriptContainerPath,
-	}
+	volumes := []string{fmt.Sprintf("%s:%s", importHostTmpDir, importContainerDir)}
 
 	if debugImportSourceChecksum() {
-		fmt.Println(runArgs)
+		fmt.Println(sourceImageDockerImageName, volumes, importScriptContainerPath)
 	}
 
-	if output, err := docker.CliRun_RecordedOutput(ctx, runArgs...); err != nil {
-		logboek.Context(ctx).Error().LogF("%s", output)
+	if err := c.GetContainerRuntime().RunStapelScript(ctx, sourceImageDockerImageName, volumes, importScriptContainerPath); err != nil {
 		return "", err
 	}
 
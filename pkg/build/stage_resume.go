@@ -0,0 +1,61 @@
+package build
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/container_runtime"
+	imagePkg "github.com/werf/werf/pkg/image"
+)
+
+// getUnstoredStageImageName returns the local name of the built stage image, which is not stored into the stages storage yet.
+// Such image is used instead of building the stage on the next run if the werf process has been interrupted or the store has been failed,
+// the expired images are removed by the host cleanup.
+func (phase *BuildPhase) getUnstoredStageImageName(stg stage.Interface) string {
+	return fmt.Sprintf("%s/%s:%s", imagePkg.UnstoredStageImageRepository, phase.Conveyor.projectName(), stg.GetDigest())
+}
+
+// markStageUnstored tags the built stage image until the image is stored into the stages storage
+func (phase *BuildPhase) markStageUnstored(ctx context.Context, stg stage.Interface) error {
+	if err := castToStageImage(stg.GetImage()).Tag(ctx, phase.getUnstoredStageImageName(stg)); err != nil {
+		return fmt.Errorf("unable to tag built image %s by name %s: %s", stg.GetImage().GetBuiltId(), phase.getUnstoredStageImageName(stg), err)
+	}
+
+	return nil
+}
+
+// unmarkStageUnstored removes only the tag of the stored stage image, the failure is not fatal
+func (phase *BuildPhase) unmarkStageUnstored(ctx context.Context, stg stage.Interface) {
+	unstoredStageImage := container_runtime.NewStageImage(nil, phase.getUnstoredStageImageName(stg), phase.Conveyor.ContainerRuntime)
+	if err := phase.Conveyor.ContainerRuntime.RemoveImage(ctx, &container_runtime.DockerImage{Image: unstoredStageImage}); err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: unable to remove tag %s: %s\n", phase.getUnstoredStageImageName(stg), err)
+	}
+}
+
+// resumeUnstoredStage uses the stage image, which has been built but not stored by the previous run
+func (phase *BuildPhase) resumeUnstoredStage(ctx context.Context, stg stage.Interface) (bool, error) {
+	unstoredStageImageName := phase.getUnstoredStageImageName(stg)
+
+	inspect, err := phase.Conveyor.ContainerRuntime.GetImageInspect(ctx, unstoredStageImageName)
+	if err != nil {
+		return false, fmt.Errorf("unable to inspect local image %s: %s", unstoredStageImageName, err)
+	} else if inspect == nil || inspect.Config == nil {
+		return false, nil
+	}
+
+	labels := inspect.Config.Labels
+	if labels[imagePkg.WerfStageDigestLabel] != stg.GetDigest() || labels[imagePkg.WerfCacheVersionLabel] != imagePkg.BuildCacheVersion {
+		return false, nil
+	}
+
+	logboek.Context(ctx).Default().LogFHighlight("Use unstored image %s built earlier for %s\n", unstoredStageImageName, stg.LogDetailedName())
+
+	if err := castToStageImage(stg.GetImage()).SetBuiltImage(ctx, inspect.ID); err != nil {
+		return false, fmt.Errorf("unable to use local image %s: %s", unstoredStageImageName, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,137 @@
+package build
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/build/stage"
+	"github.com/werf/werf/pkg/storage/manager"
+)
+
+const (
+	stageRetryFetch = "fetch"
+	stageRetryBuild = "build"
+	stageRetryStore = "store"
+
+	stageRetryBaseDelay = 5 * time.Second
+)
+
+// StageRetryOptions are the max attempts of the stage handling steps, only the transient errors are retried (see isRetryableStageError)
+type StageRetryOptions struct {
+	FetchAttempts int
+	BuildAttempts int
+	StoreAttempts int
+}
+
+func (opts StageRetryOptions) maxAttempts(step string) int {
+	switch step {
+	case stageRetryFetch:
+		return opts.FetchAttempts
+	case stageRetryBuild:
+		return opts.BuildAttempts
+	case stageRetryStore:
+		return opts.StoreAttempts
+	default:
+		return 1
+	}
+}
+
+// registryServerErrorRegexp matches the registry 5xx responses in the errors of the docker cli and the registry client
+var registryServerErrorRegexp = regexp.MustCompile(`(?i)(unexpected http status:? 5\d\d|status code:? 5\d\d|\b5\d\d (internal server error|bad gateway|service unavailable|gateway timeout)\b|unexpected status code 5\d\d)`)
+
+var retryableStageErrorSubstrings = []string{
+	// the docker daemon is not available
+	"cannot connect to the docker daemon",
+	"error during connect",
+	"is the docker daemon running",
+	// the network errors
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"net/http: request canceled",
+	"unexpected eof",
+	"use of closed network connection",
+	"no such host",
+	"toomanyrequests",
+}
+
+// lockLeaseLostErrorSubstrings are the errors of the lost lock lease (lockgate distributed locker), the lock should be reacquired before the retry
+var lockLeaseLostErrorSubstrings = []string{
+	"no existing lock lease found",
+	"lock already leased",
+}
+
+func isLockLeaseLostError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, substr := range lockLeaseLostErrorSubstrings {
+		if strings.Contains(msg, substr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isRetryableStageError returns true for the transient errors: registry 5xx, docker daemon unavailability, network errors and lost lock lease.
+// The failures of the user commands and the stages storage cache inconsistency (handled by the ConveyorWithRetryWrapper) are not retried.
+func isRetryableStageError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if manager.ShouldResetStagesStorageCache(err) {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	// the user command exited with the non-zero code
+	if strings.Contains(msg, "container run failed") && strings.Contains(msg, "code: ") {
+		return false
+	}
+
+	if registryServerErrorRegexp.MatchString(msg) || isLockLeaseLostError(err) {
+		return true
+	}
+
+	for _, substr := range retryableStageErrorSubstrings {
+		if strings.Contains(msg, substr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// doWithStageRetry runs the stage handling step and retries it on the transient errors with the growing delay, beforeRetryFunc receives the error of the failed attempt
+func (phase *BuildPhase) doWithStageRetry(ctx context.Context, stg stage.Interface, step string, f func() error, beforeRetryFunc func(err error) error) error {
+	maxAttempts := phase.StageRetryOptions.maxAttempts(step)
+
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= maxAttempts || !isRetryableStageError(err) {
+			return err
+		}
+
+		delay := time.Duration(attempt) * stageRetryBaseDelay
+		logboek.Context(ctx).Warn().LogF("WARNING: stage %s %s failed: %s\n", stg.LogDetailedName(), step, err)
+		logboek.Context(ctx).Warn().LogF("Retrying in %s (%d/%d) ...\n", delay, attempt, maxAttempts-1)
+		time.Sleep(delay)
+
+		if beforeRetryFunc != nil {
+			if err := beforeRetryFunc(err); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package build
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsRetryableStageError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil", err: nil, expected: false},
+		{name: "unknown error", err: errors.New("unable to parse werf.yaml"), expected: false},
+		{name: "user command failure", err: errors.New("container run failed with exit code: 1 (possibly connection refused in the output)"), expected: false},
+
+		{name: "docker cli registry 500", err: errors.New("received unexpected HTTP status: 500 Internal Server Error"), expected: true},
+		{name: "registry client status code 502", err: errors.New("GET https://registry.example.com/v2/: status code 502"), expected: true},
+		{name: "registry 503 service unavailable", err: errors.New("error parsing HTTP 503 Service Unavailable response body"), expected: true},
+		{name: "registry 504 gateway timeout", err: errors.New("unknown: 504 Gateway Timeout"), expected: true},
+		{name: "unexpected status code 500", err: errors.New("unexpected status code 500 Internal Server Error"), expected: true},
+		{name: "registry 404", err: errors.New("received unexpected HTTP status: 404 Not Found"), expected: false},
+		{name: "registry 401", err: errors.New("unexpected status code 401 Unauthorized"), expected: false},
+		{name: "digest with 5xx-like numbers", err: errors.New("manifest unknown: sha256:500502503"), expected: false},
+
+		{name: "docker daemon unavailable", err: errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?"), expected: true},
+		{name: "connection reset", err: errors.New("read tcp 10.0.0.1:443: read: connection reset by peer"), expected: true},
+		{name: "i/o timeout", err: errors.New("dial tcp: i/o timeout"), expected: true},
+		{name: "tls handshake timeout", err: errors.New("net/http: TLS handshake timeout"), expected: true},
+		{name: "unexpected eof", err: errors.New("unexpected EOF"), expected: true},
+		{name: "too many requests", err: errors.New("toomanyrequests: You have reached your pull rate limit"), expected: true},
+
+		{name: "lock lease lost", err: errors.New("no existing lock lease found"), expected: true},
+		{name: "lock already leased", err: errors.New("lock already leased by another owner"), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := isRetryableStageError(tt.err); result != tt.expected {
+				t.Errorf("expected %v for error %v, got %v", tt.expected, tt.err, result)
+			}
+		})
+	}
+}
+
+func TestRegistryServerErrorRegexp(t *testing.T) {
+	tests := []struct {
+		msg      string
+		expected bool
+	}{
+		{msg: "unexpected http status 500", expected: true},
+		{msg: "unexpected http status: 599", expected: true},
+		{msg: "status code 503", expected: true},
+		{msg: "status code: 500", expected: true},
+		{msg: "502 bad gateway", expected: true},
+		{msg: "unexpected status code 504", expected: true},
+		{msg: "unexpected http status 404", expected: false},
+		{msg: "status code 400", expected: false},
+		{msg: "1502 bad gateway", expected: false},
+		{msg: "500", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			if result := registryServerErrorRegexp.MatchString(tt.msg); result != tt.expected {
+				t.Errorf("expected %v for %q, got %v", tt.expected, tt.msg, result)
+			}
+		})
+	}
+}
+
+func TestIsLockLeaseLostError(t *testing.T) {
+	if !isLockLeaseLostError(errors.New("unable to store stage: No existing lock lease found")) {
+		t.Errorf("expected lock lease lost error")
+	}
+
+	if isLockLeaseLostError(errors.New("received unexpected HTTP status: 500 Internal Server Error")) {
+		t.Errorf("expected registry error not to be lock lease lost error")
+	}
+
+	if isLockLeaseLostError(nil) {
+		t.Errorf("expected nil not to be lock lease lost error")
+	}
+}
@@ -48,7 +48,7 @@ func (iterator *StagesIterator) OnImageStage(ctx context.Context, img *Image, st
 	}
 	logboek.Context(ctx).Debug().LogF("%s stage is empty: %v\n", stg.LogDetailedName(), isEmpty)
 
-	if stg.Name() != "from" && stg.Name() != "dockerfile" {
+	if stg.Name() != "from" && !isFirstDockerfileStage(img, stg) {
 		if iterator.PrevStage == nil {
 			panic(fmt.Sprintf("expected PrevStage to be set for image %q stage %s!", img.GetName(), stg.Name()))
 		}
@@ -78,3 +78,12 @@ func (iterator *StagesIterator) OnImageStage(ctx context.Context, img *Image, st
 
 	return nil
 }
+
+// isFirstDockerfileStage returns true for the only stage of the Dockerfile image or the first one of the staged Dockerfile image
+func isFirstDockerfileStage(img *Image, stg stage.Interface) bool {
+	if _, ok := stg.(*stage.DockerfileStage); !ok {
+		return false
+	}
+
+	return img.GetStages()[0] == stg
+}
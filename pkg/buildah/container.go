@@ -0,0 +1,65 @@
+package buildah
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CliFrom_RecordedOutput creates the working container from the local image and returns the container name
+func CliFrom_RecordedOutput(ctx context.Context, args ...string) (string, error) {
+	return cliRecordedOutput(ctx, append([]string{"from", "--pull-never"}, args...)...)
+}
+
+func CliRun_LiveOutput(ctx context.Context, args ...string) error {
+	return cliLiveOutput(ctx, append([]string{"run", fmt.Sprintf("--isolation=%s", isolation)}, args...)...)
+}
+
+func CliRun_RecordedOutput(ctx context.Context, args ...string) (string, error) {
+	return cliRecordedOutput(ctx, append([]string{"run", fmt.Sprintf("--isolation=%s", isolation)}, args...)...)
+}
+
+// CliRun_Interactive runs the command in the working container with the terminal attached, it is used for the introspection
+func CliRun_Interactive(ctx context.Context, args ...string) error {
+	cmdArgs := append([]string{"run", fmt.Sprintf("--isolation=%s", isolation), "--tty"}, args...)
+
+	cmd := newCliCmd(ctx, cmdArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("buildah run failed: %s", err)
+	}
+
+	return nil
+}
+
+func CliConfig(ctx context.Context, args ...string) error {
+	return cliWithAutoOutput(ctx, append([]string{"config"}, args...)...)
+}
+
+// CliCommit_RecordedOutput commits the working container and returns the image id
+func CliCommit_RecordedOutput(ctx context.Context, args ...string) (string, error) {
+	return cliRecordedOutput(ctx, append([]string{"commit", "--quiet", "--format=docker"}, args...)...)
+}
+
+func CliRm(ctx context.Context, args ...string) error {
+	return cliWithAutoOutput(ctx, append([]string{"rm"}, args...)...)
+}
+
+func ContainerExist(ctx context.Context, name string) (bool, error) {
+	output, err := cliRecordedOutput(ctx, "containers", "--all", "--noheading", "--format={{.ContainerName}}")
+	if err != nil {
+		return false, err
+	}
+
+	for _, containerName := range strings.Split(output, "\n") {
+		if strings.TrimSpace(containerName) == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,130 @@
+package buildah
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// imageInspect is a part of the buildah inspect output for the image type
+type imageInspect struct {
+	FromImage       string `json:"FromImage"`
+	FromImageID     string `json:"FromImageID"`
+	FromImageDigest string `json:"FromImageDigest"`
+	Docker          struct {
+		Parent       string            `json:"parent"`
+		Comment      string            `json:"comment"`
+		Created      time.Time         `json:"created"`
+		Author       string            `json:"author"`
+		Architecture string            `json:"architecture"`
+		OS           string            `json:"os"`
+		Size         int64             `json:"size"`
+		Config       *container.Config `json:"config"`
+	} `json:"Docker"`
+}
+
+func (inspect *imageInspect) toDockerImageInspect() *types.ImageInspect {
+	res := &types.ImageInspect{
+		ID:              inspect.FromImageID,
+		Parent:          inspect.Docker.Parent,
+		Comment:         inspect.Docker.Comment,
+		Author:          inspect.Docker.Author,
+		Architecture:    inspect.Docker.Architecture,
+		Os:              inspect.Docker.OS,
+		Size:            inspect.Docker.Size,
+		VirtualSize:     inspect.Docker.Size,
+		Config:          inspect.Docker.Config,
+		ContainerConfig: inspect.Docker.Config,
+	}
+
+	if !strings.HasPrefix(res.ID, "sha256:") {
+		res.ID = "sha256:" + res.ID
+	}
+
+	if !inspect.Docker.Created.IsZero() {
+		res.Created = inspect.Docker.Created.Format(time.RFC3339Nano)
+	}
+
+	if inspect.FromImage != "" {
+		res.RepoTags = []string{inspect.FromImage}
+
+		if inspect.FromImageDigest != "" {
+			repository := inspect.FromImage
+			if ind := strings.LastIndex(repository, ":"); ind > strings.LastIndex(repository, "/") {
+				repository = repository[:ind]
+			}
+
+			res.RepoDigests = []string{fmt.Sprintf("%s@%s", repository, inspect.FromImageDigest)}
+		}
+	}
+
+	return res
+}
+
+func parseImageInspect(data []byte) (*types.ImageInspect, error) {
+	inspect := &imageInspect{}
+	if err := json.Unmarshal(data, inspect); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal buildah inspect output: %s", err)
+	}
+
+	return inspect.toDockerImageInspect(), nil
+}
+
+// ImageInspect returns the docker compatible inspect of the image from the local containers-storage or nil if the image does not exist
+func ImageInspect(ctx context.Context, ref string) (*types.ImageInspect, error) {
+	output, err := cliRecordedOutput(ctx, "inspect", "--type=image", ref)
+	if err != nil {
+		if isImageNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return parseImageInspect([]byte(output))
+}
+
+func ImageExist(ctx context.Context, ref string) (bool, error) {
+	inspect, err := ImageInspect(ctx, ref)
+	if err != nil {
+		return false, err
+	}
+
+	return inspect != nil, nil
+}
+
+func isImageNotFoundError(err error) bool {
+	for _, msg := range []string{"image not known", "no such image", "identifier is not an image", "not found"} {
+		if strings.Contains(strings.ToLower(err.Error()), msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func CliPull(ctx context.Context, args ...string) error {
+	return cliWithAutoOutput(ctx, append([]string{"pull"}, args...)...)
+}
+
+// CliPush pushes the image from the local containers-storage to the destination, which can be a registry (docker://REF) or an OCI layout (oci:DIR:TAG)
+func CliPush(ctx context.Context, args ...string) error {
+	return cliWithAutoOutput(ctx, append([]string{"push"}, args...)...)
+}
+
+func CliTag(ctx context.Context, args ...string) error {
+	return cliWithAutoOutput(ctx, append([]string{"tag"}, args...)...)
+}
+
+func CliRmi(ctx context.Context, args ...string) error {
+	return cliWithAutoOutput(ctx, append([]string{"rmi"}, args...)...)
+}
+
+// CliBud_LiveOutput builds the image from the Dockerfile, the layers are not cached between builds, werf caches stages itself
+func CliBud_LiveOutput(ctx context.Context, args ...string) error {
+	return cliLiveOutput(ctx, append([]string{"bud", fmt.Sprintf("--isolation=%s", isolation), "--format=docker"}, args...)...)
+}
@@ -0,0 +1,41 @@
+package buildah
+
+import (
+	"testing"
+)
+
+func TestParseImageInspect(t *testing.T) {
+	data := []byte(`{
+	"Type": "buildah 0.0.1",
+	"FromImage": "registry.example.com/app:latest",
+	"FromImageID": "0123456789abcdef",
+	"FromImageDigest": "sha256:fedcba9876543210",
+	"Docker": {
+		"created": "2021-03-01T10:00:00.5Z",
+		"architecture": "amd64",
+		"os": "linux",
+		"config": {"Env": ["PATH=/bin"], "Labels": {"werf": "project"}, "OnBuild": ["RUN true"]}
+	}
+}`)
+
+	inspect, err := parseImageInspect(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inspect.ID != "sha256:0123456789abcdef" {
+		t.Errorf("unexpected id %q", inspect.ID)
+	}
+
+	if inspect.Created != "2021-03-01T10:00:00.5Z" {
+		t.Errorf("unexpected created %q", inspect.Created)
+	}
+
+	if len(inspect.RepoDigests) != 1 || inspect.RepoDigests[0] != "registry.example.com/app@sha256:fedcba9876543210" {
+		t.Errorf("unexpected repo digests %v", inspect.RepoDigests)
+	}
+
+	if inspect.Config == nil || inspect.Config.Labels["werf"] != "project" || len(inspect.Config.OnBuild) != 1 {
+		t.Errorf("unexpected config %+v", inspect.Config)
+	}
+}
@@ -0,0 +1,132 @@
+package buildah
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/werf/logboek"
+)
+
+const (
+	DefaultStorageDriver = "vfs"
+	DefaultIsolation     = "chroot"
+)
+
+var (
+	liveCliOutputEnabled bool
+
+	storageDriver string
+	storageRoot   string
+	runRoot       string
+	isolation     string
+)
+
+type Options struct {
+	// StorageDriver is the containers-storage driver, vfs does not require privileges and works inside an unprivileged pod
+	StorageDriver string
+	// StorageRoot and RunRoot override the default containers-storage locations
+	StorageRoot string
+	RunRoot     string
+	// Isolation is the isolation type of RUN instructions and stapel commands, chroot does not require user namespaces
+	Isolation string
+
+	Verbose, Debug bool
+}
+
+func Init(ctx context.Context, opts Options) error {
+	if _, err := exec.LookPath("buildah"); err != nil {
+		return fmt.Errorf("buildah binary not found: %s", err)
+	}
+
+	storageDriver = opts.StorageDriver
+	if storageDriver == "" {
+		storageDriver = DefaultStorageDriver
+	}
+
+	isolation = opts.Isolation
+	if isolation == "" {
+		isolation = DefaultIsolation
+	}
+
+	storageRoot = opts.StorageRoot
+	runRoot = opts.RunRoot
+
+	liveCliOutputEnabled = opts.Verbose || opts.Debug
+
+	if version, err := cliRecordedOutput(ctx, "version", "--json"); err != nil {
+		return fmt.Errorf("unable to get buildah version: %s", err)
+	} else {
+		logboek.Context(ctx).Debug().LogF("Buildah version: %s\n", version)
+	}
+
+	return nil
+}
+
+func globalArgs() []string {
+	var args []string
+
+	if storageDriver != "" {
+		args = append(args, fmt.Sprintf("--storage-driver=%s", storageDriver))
+	}
+
+	if storageRoot != "" {
+		args = append(args, fmt.Sprintf("--root=%s", storageRoot))
+	}
+
+	if runRoot != "" {
+		args = append(args, fmt.Sprintf("--runroot=%s", runRoot))
+	}
+
+	return args
+}
+
+func newCliCmd(ctx context.Context, args ...string) *exec.Cmd {
+	cmdArgs := append(globalArgs(), args...)
+
+	logboek.Context(ctx).Debug().LogF("Buildah command: buildah %s\n", strings.Join(cmdArgs, " "))
+
+	cmd := exec.CommandContext(ctx, "buildah", cmdArgs...)
+	cmd.Env = append(os.Environ(), "BUILDAH_ISOLATION="+isolation)
+
+	return cmd
+}
+
+func cliLiveOutput(ctx context.Context, args ...string) error {
+	cmd := newCliCmd(ctx, args...)
+	cmd.Stdout = logboek.Context(ctx).OutStream()
+	cmd.Stderr = logboek.Context(ctx).ErrStream()
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("buildah %s failed: %s", args[0], err)
+	}
+
+	return nil
+}
+
+func cliRecordedOutput(ctx context.Context, args ...string) (string, error) {
+	cmd := newCliCmd(ctx, args...)
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("buildah %s failed: %s\n%s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func cliWithAutoOutput(ctx context.Context, args ...string) error {
+	if liveCliOutputEnabled {
+		return cliLiveOutput(ctx, args...)
+	}
+
+	_, err := cliRecordedOutput(ctx, args...)
+	return err
+}
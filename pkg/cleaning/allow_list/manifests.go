@@ -0,0 +1,279 @@
+package allow_list
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+const helmReleaseSecretType = "helm.sh/release.v1"
+
+var gzipMagicHeader = []byte{0x1f, 0x8b, 0x08}
+
+// ImagesFromManifests returns the images used in the multi-document YAML or JSON manifests:
+// the containers of any workload, the rendered manifests of Helm releases stored in Secrets and ConfigMaps,
+// the image overrides and values of Argo CD Applications, Flux HelmReleases and Kustomizations
+func ImagesFromManifests(data []byte) ([]string, error) {
+	var images []string
+	for _, manifest := range releaseutil.SplitManifests(string(data)) {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal manifest: %s", err)
+		}
+
+		if obj == nil {
+			continue
+		}
+
+		objImages, err := imagesFromObject(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, objImages...)
+	}
+
+	return images, nil
+}
+
+func imagesFromObject(obj map[string]interface{}) ([]string, error) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	group := strings.Split(apiVersion, "/")[0]
+
+	switch {
+	case strings.HasSuffix(kind, "List"):
+		var images []string
+		for _, item := range getList(obj, "items") {
+			if itemObj, ok := item.(map[string]interface{}); ok {
+				itemImages, err := imagesFromObject(itemObj)
+				if err != nil {
+					return nil, err
+				}
+				images = append(images, itemImages...)
+			}
+		}
+		return images, nil
+	case kind == "Secret" && obj["type"] == helmReleaseSecretType:
+		return imagesFromHelmReleaseStorageObject(obj, true)
+	case kind == "ConfigMap" && getString(obj, "metadata", "labels", "owner") == "helm":
+		return imagesFromHelmReleaseStorageObject(obj, false)
+	case group == "argoproj.io" && (kind == "Application" || kind == "ApplicationSet"):
+		return imagesFromArgoCDApplication(obj)
+	case group == "helm.toolkit.fluxcd.io" && kind == "HelmRelease":
+		return stringValues(getValue(obj, "spec", "values")), nil
+	case (group == "kustomize.toolkit.fluxcd.io" || group == "kustomize.config.k8s.io") && kind == "Kustomization":
+		var images []string
+		if group == "kustomize.toolkit.fluxcd.io" {
+			images = kustomizeImages(getList(obj, "spec", "images"))
+		} else {
+			images = kustomizeImages(getList(obj, "images"))
+		}
+		return append(images, containersImages(obj)...), nil
+	default:
+		return containersImages(obj), nil
+	}
+}
+
+// imagesFromHelmReleaseStorageObject decodes the release stored by the Helm secrets or configmaps storage driver and returns the images of the release manifests
+func imagesFromHelmReleaseStorageObject(obj map[string]interface{}, isSecret bool) ([]string, error) {
+	name := getString(obj, "metadata", "name")
+
+	data := getString(obj, "data", "release")
+	if data == "" {
+		return nil, nil
+	}
+
+	if isSecret {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode helm release secret %q: %s", name, err)
+		}
+		data = string(decoded)
+	}
+
+	releaseData, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode helm release %q: %s", name, err)
+	}
+
+	if bytes.HasPrefix(releaseData, gzipMagicHeader) {
+		r, err := gzip.NewReader(bytes.NewReader(releaseData))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decompress helm release %q: %s", name, err)
+		}
+		releaseData, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decompress helm release %q: %s", name, err)
+		}
+	}
+
+	var release struct {
+		Manifest string `json:"manifest"`
+		Hooks    []struct {
+			Manifest string `json:"manifest"`
+		} `json:"hooks"`
+	}
+	if err := json.Unmarshal(releaseData, &release); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal helm release %q: %s", name, err)
+	}
+
+	manifests := []string{release.Manifest}
+	for _, hook := range release.Hooks {
+		manifests = append(manifests, hook.Manifest)
+	}
+
+	images, err := ImagesFromManifests([]byte(strings.Join(manifests, "\n---\n")))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get helm release %q images: %s", name, err)
+	}
+
+	return images, nil
+}
+
+// imagesFromArgoCDApplication returns the kustomize image overrides and all helm parameters and values of the application sources,
+// the values, which are not image references, are harmless since only the exact stage image names are matched
+func imagesFromArgoCDApplication(obj map[string]interface{}) ([]string, error) {
+	spec := getValue(obj, "spec")
+	if getString(obj, "kind") == "ApplicationSet" {
+		spec = getValue(obj, "spec", "template", "spec")
+	}
+
+	specMap, _ := spec.(map[string]interface{})
+	var sources []interface{}
+	if source := getValue(specMap, "source"); source != nil {
+		sources = append(sources, source)
+	}
+	sources = append(sources, getList(specMap, "sources")...)
+
+	var images []string
+	for _, source := range sources {
+		sourceMap, ok := source.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		images = append(images, kustomizeImages(getList(sourceMap, "kustomize", "images"))...)
+
+		for _, parameter := range getList(sourceMap, "helm", "parameters") {
+			if parameterMap, ok := parameter.(map[string]interface{}); ok {
+				images = append(images, getString(parameterMap, "value"))
+			}
+		}
+
+		if values := getString(sourceMap, "helm", "values"); values != "" {
+			var valuesObj interface{}
+			if err := yaml.Unmarshal([]byte(values), &valuesObj); err != nil {
+				return nil, fmt.Errorf("unable to unmarshal argo cd application %q helm values: %s", getString(obj, "metadata", "name"), err)
+			}
+			images = append(images, stringValues(valuesObj)...)
+		}
+
+		images = append(images, stringValues(getValue(sourceMap, "helm", "valuesObject"))...)
+	}
+
+	return images, nil
+}
+
+// kustomizeImages converts the kustomize image overrides (objects with name, newName, newTag and digest or argo cd strings [NAME=]IMAGE[:TAG]) to the image references
+func kustomizeImages(list []interface{}) []string {
+	var images []string
+	for _, elm := range list {
+		switch value := elm.(type) {
+		case string:
+			parts := strings.SplitN(value, "=", 2)
+			images = append(images, parts[len(parts)-1])
+		case map[string]interface{}:
+			name := getString(value, "newName")
+			if name == "" {
+				name = getString(value, "name")
+			}
+
+			if digest := getString(value, "digest"); digest != "" {
+				images = append(images, fmt.Sprintf("%s@%s", name, digest))
+			} else if tag := getString(value, "newTag"); tag != "" {
+				images = append(images, fmt.Sprintf("%s:%s", name, tag))
+			}
+		}
+	}
+
+	return images
+}
+
+// containersImages returns the images of the containers, init containers and ephemeral containers found at any level of the object
+func containersImages(value interface{}) []string {
+	var images []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elm := range v {
+			if key == "containers" || key == "initContainers" || key == "ephemeralContainers" {
+				if list, ok := elm.([]interface{}); ok {
+					for _, container := range list {
+						if containerMap, ok := container.(map[string]interface{}); ok {
+							if image := getString(containerMap, "image"); image != "" {
+								images = append(images, image)
+							}
+						}
+					}
+					continue
+				}
+			}
+
+			images = append(images, containersImages(elm)...)
+		}
+	case []interface{}:
+		for _, elm := range v {
+			images = append(images, containersImages(elm)...)
+		}
+	}
+
+	return images
+}
+
+func stringValues(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		values = append(values, v)
+	case map[string]interface{}:
+		for _, elm := range v {
+			values = append(values, stringValues(elm)...)
+		}
+	case []interface{}:
+		for _, elm := range v {
+			values = append(values, stringValues(elm)...)
+		}
+	}
+
+	return values
+}
+
+func getValue(obj interface{}, path ...string) interface{} {
+	value := obj
+	for _, key := range path {
+		valueMap, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = valueMap[key]
+	}
+
+	return value
+}
+
+func getString(obj interface{}, path ...string) string {
+	value, _ := getValue(obj, path...).(string)
+	return value
+}
+
+func getList(obj interface{}, path ...string) []interface{} {
+	value, _ := getValue(obj, path...).([]interface{})
+	return value
+}
@@ -0,0 +1,136 @@
+package allow_list
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func encodeTestHelmRelease(t *testing.T, manifest string) string {
+	data, err := json.Marshal(map[string]interface{}{"name": "app", "manifest": manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	helmEncoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+	return base64.StdEncoding.EncodeToString([]byte(helmEncoded))
+}
+
+func TestImagesFromManifests(t *testing.T) {
+	releaseManifest := `apiVersion: batch/v1
+kind: Job
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: registry.example.com/app:release-job
+`
+
+	manifests := fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: registry.example.com/app:init
+      containers:
+      - name: app
+        image: registry.example.com/app:deployment
+---
+apiVersion: v1
+kind: Secret
+type: helm.sh/release.v1
+metadata:
+  name: sh.helm.release.v1.app.v1
+data:
+  release: %s
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: app
+spec:
+  source:
+    kustomize:
+      images:
+      - app=registry.example.com/app:argocd-kustomize
+    helm:
+      parameters:
+      - name: image
+        value: registry.example.com/app:argocd-parameter
+      values: |
+        werf:
+          image:
+            app: registry.example.com/app:argocd-values
+---
+apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: app
+spec:
+  values:
+    image: registry.example.com/app:flux-values
+---
+apiVersion: kustomize.toolkit.fluxcd.io/v1beta1
+kind: Kustomization
+metadata:
+  name: app
+spec:
+  images:
+  - name: app
+    newName: registry.example.com/app
+    newTag: flux-kustomize
+`, encodeTestHelmRelease(t, releaseManifest))
+
+	images, err := ImagesFromManifests([]byte(manifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var appImages []string
+	for _, image := range images {
+		if strings.HasPrefix(image, "registry.example.com/app:") {
+			appImages = append(appImages, strings.TrimPrefix(image, "registry.example.com/app:"))
+		}
+	}
+	sort.Strings(appImages)
+
+	expected := "argocd-kustomize,argocd-parameter,argocd-values,deployment,flux-kustomize,flux-values,init,release-job"
+	if strings.Join(appImages, ",") != expected {
+		t.Errorf("expected images %s, got %s", expected, strings.Join(appImages, ","))
+	}
+}
+
+func TestParseImageList(t *testing.T) {
+	for _, data := range []string{
+		"# deployed images\nregistry.example.com/app:a\n\n  registry.example.com/app:b\n",
+		`["registry.example.com/app:a", "registry.example.com/app:b"]`,
+	} {
+		images, err := parseImageList([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Join(images, ",") != "registry.example.com/app:a,registry.example.com/app:b" {
+			t.Errorf("unexpected images %v parsed from %q", images, data)
+		}
+	}
+}
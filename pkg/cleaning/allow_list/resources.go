@@ -0,0 +1,204 @@
+package allow_list
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/werf/logboek"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ResourceImagesPaths defines the JSONPath expressions (kubectl syntax) to get the images from the resources of the kind.
+// The optional kind is skipped with a warning if the kind cannot be discovered or listing of the resources is forbidden
+type ResourceImagesPaths struct {
+	GroupVersionKind schema.GroupVersionKind
+	Paths            []string
+	Optional         bool
+}
+
+func (p *ResourceImagesPaths) String() string {
+	return fmt.Sprintf("%s=%s", p.GroupVersionKind.GroupVersion().WithKind(p.GroupVersionKind.Kind).String(), strings.Join(p.Paths, ","))
+}
+
+// DefaultResourceImagesPaths are the well-known custom resources, which reference the images directly (not by the built-in workloads).
+// The kinds are skipped if the cluster does not serve them or the user has no access to them
+var DefaultResourceImagesPaths = []*ResourceImagesPaths{
+	{
+		GroupVersionKind: schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+		Paths: []string{
+			"{.spec.template.spec.containers[*].image}",
+			"{.spec.template.spec.initContainers[*].image}",
+		},
+		Optional: true,
+	},
+	{
+		GroupVersionKind: schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"},
+		Paths: []string{
+			"{.spec.template.spec.containers[*].image}",
+			"{.spec.template.spec.initContainers[*].image}",
+		},
+		Optional: true,
+	},
+	{
+		GroupVersionKind: schema.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachine"},
+		Paths: []string{
+			"{.spec.template.spec.volumes[*].containerDisk.image}",
+		},
+		Optional: true,
+	},
+}
+
+// ParseResourceImagesPaths parses the values in the format APIVERSION/KIND=JSONPATH (e.g. argoproj.io/v1alpha1/Rollout={.spec.template.spec.containers[*].image}),
+// the paths of the same kind are merged
+func ParseResourceImagesPaths(values []string) ([]*ResourceImagesPaths, error) {
+	var result []*ResourceImagesPaths
+
+valuesLoop:
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid value %q: expected APIVERSION/KIND=JSONPATH", value)
+		}
+
+		ind := strings.LastIndex(parts[0], "/")
+		if ind == -1 || parts[0][ind+1:] == "" {
+			return nil, fmt.Errorf("invalid value %q: expected APIVERSION/KIND=JSONPATH", value)
+		}
+
+		groupVersion, err := schema.ParseGroupVersion(parts[0][:ind])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q: unable to parse api version: %s", value, err)
+		}
+		gvk := groupVersion.WithKind(parts[0][ind+1:])
+
+		path := normalizeJSONPath(parts[1])
+		if _, err := newJSONPath(path); err != nil {
+			return nil, fmt.Errorf("invalid value %q: %s", value, err)
+		}
+
+		for _, paths := range result {
+			if paths.GroupVersionKind == gvk {
+				paths.Paths = append(paths.Paths, path)
+				continue valuesLoop
+			}
+		}
+
+		result = append(result, &ResourceImagesPaths{GroupVersionKind: gvk, Paths: []string{path}})
+	}
+
+	return result, nil
+}
+
+// normalizeJSONPath allows the expression without the enclosing braces as kubectl does
+func normalizeJSONPath(path string) string {
+	if strings.HasPrefix(path, "{") {
+		return path
+	}
+
+	return fmt.Sprintf("{%s}", path)
+}
+
+func newJSONPath(path string) (*jsonpath.JSONPath, error) {
+	j := jsonpath.New("images").AllowMissingKeys(true)
+	if err := j.Parse(path); err != nil {
+		return nil, fmt.Errorf("unable to parse JSONPath %q: %s", path, err)
+	}
+
+	return j, nil
+}
+
+// ResourcesDeployedDockerImages returns the images of the resources found by the JSONPath expressions using the dynamic client
+func ResourcesDeployedDockerImages(ctx context.Context, kubernetesClient kubernetes.Interface, kubernetesDynamicClient dynamic.Interface, kubernetesNamespace string, resourcesImagesPaths []*ResourceImagesPaths) ([]string, error) {
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubernetesClient.Discovery()))
+
+	var deployedDockerImages []string
+	for _, resourceImagesPaths := range resourcesImagesPaths {
+		gvk := resourceImagesPaths.GroupVersionKind
+
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			if resourceImagesPaths.Optional {
+				logboek.Context(ctx).Warn().LogF("WARNING: Skipping %s resources: unable to discover resource: %s\n", gvk, err)
+				continue
+			}
+
+			return nil, fmt.Errorf("cannot get %s resource: %s", gvk, err)
+		}
+
+		images, err := getResourcesImages(ctx, kubernetesDynamicClient, mapping, kubernetesNamespace, resourceImagesPaths.Paths)
+		if err != nil {
+			if resourceImagesPaths.Optional && apierrors.IsForbidden(err) {
+				logboek.Context(ctx).Warn().LogF("WARNING: Skipping %s resources: %s\n", gvk, err)
+				continue
+			}
+
+			return nil, fmt.Errorf("cannot get %s images: %s", gvk, err)
+		}
+
+		deployedDockerImages = append(deployedDockerImages, images...)
+	}
+
+	return deployedDockerImages, nil
+}
+
+func getResourcesImages(ctx context.Context, kubernetesDynamicClient dynamic.Interface, mapping *meta.RESTMapping, kubernetesNamespace string, paths []string) ([]string, error) {
+	var resourceClient dynamic.ResourceInterface
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		resourceClient = kubernetesDynamicClient.Resource(mapping.Resource).Namespace(kubernetesNamespace)
+	} else {
+		resourceClient = kubernetesDynamicClient.Resource(mapping.Resource)
+	}
+
+	list, err := resourceClient.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, item := range list.Items {
+		itemImages, err := imagesByJSONPaths(item.Object, paths)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %s", item.GetNamespace(), item.GetName(), err)
+		}
+
+		images = append(images, itemImages...)
+	}
+
+	return images, nil
+}
+
+func imagesByJSONPaths(obj map[string]interface{}, paths []string) ([]string, error) {
+	var images []string
+	for _, path := range paths {
+		j, err := newJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		results, err := j.FindResults(obj)
+		if err != nil {
+			return nil, fmt.Errorf("unable to execute JSONPath %q: %s", path, err)
+		}
+
+		for _, result := range results {
+			for _, value := range result {
+				if image, ok := value.Interface().(string); ok && image != "" {
+					images = append(images, image)
+				}
+			}
+		}
+	}
+
+	return images, nil
+}
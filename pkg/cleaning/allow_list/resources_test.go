@@ -0,0 +1,202 @@
+package allow_list
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestParseResourceImagesPaths(t *testing.T) {
+	paths, err := ParseResourceImagesPaths([]string{
+		"mycompany.io/v1/App={.spec.components[*].image}",
+		"mycompany.io/v1/App=.spec.sidecar.image",
+		"v1/ConfigMap={.data.image}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 kinds, got %d: %v", len(paths), paths)
+	}
+
+	if expected := (schema.GroupVersionKind{Group: "mycompany.io", Version: "v1", Kind: "App"}); paths[0].GroupVersionKind != expected {
+		t.Errorf("expected %s, got %s", expected, paths[0].GroupVersionKind)
+	}
+	if got := strings.Join(paths[0].Paths, " "); got != "{.spec.components[*].image} {.spec.sidecar.image}" {
+		t.Errorf("unexpected paths %q", got)
+	}
+
+	if expected := (schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}); paths[1].GroupVersionKind != expected {
+		t.Errorf("expected %s, got %s", expected, paths[1].GroupVersionKind)
+	}
+
+	for _, value := range []string{
+		"App={.spec.image}",
+		"mycompany.io/v1/App",
+		"mycompany.io/v1/={.spec.image}",
+		"mycompany.io/v1/App={.spec.image",
+	} {
+		if _, err := ParseResourceImagesPaths([]string{value}); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestResourcesDeployedDockerImages(t *testing.T) {
+	rolloutGVR := schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+
+	kubernetesClient := fake.NewSimpleClientset()
+	kubernetesClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "argoproj.io/v1alpha1",
+			APIResources: []metav1.APIResource{{Name: "rollouts", Kind: "Rollout", Namespaced: true}},
+		},
+	}
+
+	rollout := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "production"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"initContainers": []interface{}{map[string]interface{}{"name": "migrate", "image": "registry.example.com/app:migrate"}},
+					"containers":     []interface{}{map[string]interface{}{"name": "app", "image": "registry.example.com/app:backend"}},
+				},
+			},
+		},
+	}}
+
+	dynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{rolloutGVR: "RolloutList"}, rollout)
+
+	// the kinds not served by the cluster (knative, kubevirt) are skipped
+	images, err := ResourcesDeployedDockerImages(context.Background(), kubernetesClient, dynamicClient, "", DefaultResourceImagesPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(images)
+	if got, expected := strings.Join(images, " "), "registry.example.com/app:backend registry.example.com/app:migrate"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	images, err = ResourcesDeployedDockerImages(context.Background(), kubernetesClient, dynamicClient, "staging", DefaultResourceImagesPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 0 {
+		t.Errorf("expected no images in the namespace, got %v", images)
+	}
+}
+
+type failingDiscoveryClientset struct {
+	*fake.Clientset
+}
+
+func (c *failingDiscoveryClientset) Discovery() discovery.DiscoveryInterface {
+	return &failingDiscovery{FakeDiscovery: c.Clientset.Discovery().(*fakediscovery.FakeDiscovery)}
+}
+
+type failingDiscovery struct {
+	*fakediscovery.FakeDiscovery
+}
+
+func (d *failingDiscovery) ServerGroups() (*metav1.APIGroupList, error) {
+	return nil, apierrors.NewForbidden(schema.GroupResource{}, "", errors.New("discovery is not allowed"))
+}
+
+func TestResourcesDeployedDockerImagesErrors(t *testing.T) {
+	rolloutGVR := schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+
+	userResourcesImagesPaths, err := ParseResourceImagesPaths([]string{"argoproj.io/v1alpha1/Rollout={.spec.template.spec.containers[*].image}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKubernetesClient := func() *fake.Clientset {
+		kubernetesClient := fake.NewSimpleClientset()
+		kubernetesClient.Resources = []*metav1.APIResourceList{
+			{
+				GroupVersion: "argoproj.io/v1alpha1",
+				APIResources: []metav1.APIResource{{Name: "rollouts", Kind: "Rollout", Namespaced: true}},
+			},
+		}
+
+		return kubernetesClient
+	}
+
+	newForbiddenDynamicClient := func() *fakedynamic.FakeDynamicClient {
+		dynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{rolloutGVR: "RolloutList"})
+		dynamicClient.PrependReactor("list", "rollouts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(rolloutGVR.GroupResource(), "", errors.New("list is not allowed"))
+		})
+
+		return dynamicClient
+	}
+
+	tests := []struct {
+		name                 string
+		kubernetesClient     func() kubernetes.Interface
+		resourcesImagesPaths []*ResourceImagesPaths
+		expectError          bool
+	}{
+		{
+			name:                 "default kind with forbidden list is skipped",
+			kubernetesClient:     func() kubernetes.Interface { return newKubernetesClient() },
+			resourcesImagesPaths: DefaultResourceImagesPaths,
+		},
+		{
+			name:                 "default kind with failed discovery is skipped",
+			kubernetesClient:     func() kubernetes.Interface { return &failingDiscoveryClientset{Clientset: newKubernetesClient()} },
+			resourcesImagesPaths: DefaultResourceImagesPaths,
+		},
+		{
+			name:                 "user-configured kind with forbidden list fails",
+			kubernetesClient:     func() kubernetes.Interface { return newKubernetesClient() },
+			resourcesImagesPaths: userResourcesImagesPaths,
+			expectError:          true,
+		},
+		{
+			name:                 "user-configured kind with failed discovery fails",
+			kubernetesClient:     func() kubernetes.Interface { return &failingDiscoveryClientset{Clientset: newKubernetesClient()} },
+			resourcesImagesPaths: userResourcesImagesPaths,
+			expectError:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := ResourcesDeployedDockerImages(context.Background(), tt.kubernetesClient(), newForbiddenDynamicClient(), "", tt.resourcesImagesPaths)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(images) != 0 {
+				t.Errorf("expected no images, got %v", images)
+			}
+		})
+	}
+}
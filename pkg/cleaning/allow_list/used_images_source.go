@@ -0,0 +1,264 @@
+package allow_list
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/werf/logboek"
+)
+
+// imageListRequestTimeout limits the http(s) request of the image list, the cleanup should not hang on the unavailable endpoint
+const imageListRequestTimeout = time.Minute
+
+// UsedImagesSource is the source of the images, which are in use outside of the reachable Kubernetes clusters and should be kept by the cleanup
+type UsedImagesSource interface {
+	String() string
+	UsedImages(ctx context.Context) ([]string, error)
+}
+
+func isManifestFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// ManifestsDirSource reads the rendered manifests or the exported Helm release secrets (kubectl get secret -l owner=helm -o yaml) from the directory recursively
+type ManifestsDirSource struct {
+	Dir string
+}
+
+func NewManifestsDirSource(dir string) *ManifestsDirSource {
+	return &ManifestsDirSource{Dir: dir}
+}
+
+func (source *ManifestsDirSource) String() string {
+	return fmt.Sprintf("manifests dir %s", source.Dir)
+}
+
+func (source *ManifestsDirSource) UsedImages(_ context.Context) ([]string, error) {
+	var images []string
+	if err := filepath.Walk(source.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !isManifestFile(path) {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", path, err)
+		}
+
+		fileImages, err := ImagesFromManifests(data)
+		if err != nil {
+			return fmt.Errorf("unable to get images from %s: %s", path, err)
+		}
+
+		images = append(images, fileImages...)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// ImageListSource reads the image references from the file or the http(s) endpoint.
+// The content is the JSON array of strings or the plain text with one reference per line, empty lines and lines starting with # are ignored
+type ImageListSource struct {
+	Address string
+}
+
+func NewImageListSource(address string) *ImageListSource {
+	return &ImageListSource{Address: address}
+}
+
+func (source *ImageListSource) String() string {
+	return fmt.Sprintf("image list %s", source.Address)
+}
+
+func (source *ImageListSource) UsedImages(ctx context.Context) ([]string, error) {
+	data, err := source.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseImageList(data)
+}
+
+func (source *ImageListSource) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(source.Address, "http://") && !strings.HasPrefix(source.Address, "https://") {
+		data, err := ioutil.ReadFile(source.Address)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", source.Address, err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.Address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request %s: %s", source.Address, err)
+	}
+
+	client := &http.Client{Timeout: imageListRequestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s: %s", source.Address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get %s: unexpected status %s", source.Address, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s response: %s", source.Address, err)
+	}
+
+	return data, nil
+}
+
+func parseImageList(data []byte) ([]string, error) {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		var images []string
+		if err := json.Unmarshal(trimmed, &images); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal image list: %s", err)
+		}
+		return images, nil
+	}
+
+	var images []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		images = append(images, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read image list: %s", err)
+	}
+
+	return images, nil
+}
+
+// GitRepoSource reads the manifests (Argo CD Applications, Flux HelmReleases and Kustomizations, plain manifests) from the git repository.
+// The address is the local repository path or the clone url with the optional reference: URL[#REF] (HEAD by default).
+// The repository can contain arbitrary yaml files (e.g. ci configuration or helm chart templates), such unparsable files are skipped with the warning,
+// in the strict mode the unparsable file fails the source as for the ManifestsDirSource
+type GitRepoSource struct {
+	Address string
+	Strict  bool
+}
+
+func NewGitRepoSource(address string, strict bool) *GitRepoSource {
+	return &GitRepoSource{Address: address, Strict: strict}
+}
+
+func (source *GitRepoSource) String() string {
+	return fmt.Sprintf("git repo %s", source.Address)
+}
+
+func (source *GitRepoSource) parseAddress() (string, string) {
+	parts := strings.SplitN(source.Address, "#", 2)
+	if len(parts) == 2 && parts[1] != "" {
+		return parts[0], parts[1]
+	}
+	return parts[0], "HEAD"
+}
+
+func (source *GitRepoSource) UsedImages(ctx context.Context) ([]string, error) {
+	url, ref := source.parseAddress()
+
+	var repository *git.Repository
+	if info, err := os.Stat(url); err == nil && info.IsDir() {
+		repository, err = git.PlainOpenWithOptions(url, &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			return nil, fmt.Errorf("unable to open git repo %s: %s", url, err)
+		}
+	} else {
+		repository, err = git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{URL: url, NoCheckout: true, Tags: git.NoTags})
+		if err != nil {
+			return nil, fmt.Errorf("unable to clone git repo %s: %s", url, err)
+		}
+	}
+
+	commitHash, err := repository.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		// the branches of the cloned repository are remote references
+		if remoteCommitHash, remoteErr := repository.ResolveRevision(plumbing.Revision("origin/" + ref)); remoteErr == nil {
+			commitHash = remoteCommitHash
+		} else {
+			return nil, fmt.Errorf("unable to resolve git repo %s reference %q: %s", url, ref, err)
+		}
+	}
+
+	commit, err := repository.CommitObject(*commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get git repo %s commit %s: %s", url, commitHash, err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get git repo %s commit %s tree: %s", url, commitHash, err)
+	}
+
+	var images []string
+	if err := tree.Files().ForEach(func(file *object.File) error {
+		if !isManifestFile(file.Name) {
+			return nil
+		}
+
+		reader, err := file.Reader()
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", file.Name, err)
+		}
+		defer reader.Close()
+
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", file.Name, err)
+		}
+
+		fileImages, err := ImagesFromManifests(data)
+		if err != nil {
+			if source.Strict {
+				return fmt.Errorf("unable to get images from %s: %s", file.Name, err)
+			}
+
+			logboek.Context(ctx).Warn().LogF("WARNING: Skipping %s in git repo %s: unable to get images: %s\n", file.Name, url, err)
+			return nil
+		}
+
+		images = append(images, fileImages...)
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to read git repo %s: %s", url, err)
+	}
+
+	return images, nil
+}
@@ -0,0 +1,102 @@
+package allow_list
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func initTestGitRepo(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	repository, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("unable to init git repo: %s", err)
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := worktree.Commit("init", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}}); err != nil {
+		t.Fatalf("unable to commit: %s", err)
+	}
+
+	return dir
+}
+
+func TestGitRepoSourceUnparsableFiles(t *testing.T) {
+	dir := initTestGitRepo(t, map[string]string{
+		"deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: registry.example.com/app:tag
+`,
+		"template.yaml": `{{ if .Values.enabled }}
+kind: ConfigMap
+{{ end }}
+`,
+	})
+
+	images, err := NewGitRepoSource(dir, false).UsedImages(context.Background())
+	if err != nil {
+		t.Fatalf("expected unparsable file to be skipped, got error: %s", err)
+	}
+
+	if !reflect.DeepEqual(images, []string{"registry.example.com/app:tag"}) {
+		t.Errorf("unexpected images: %v", images)
+	}
+
+	if _, err := NewGitRepoSource(dir, true).UsedImages(context.Background()); err == nil {
+		t.Errorf("expected error for unparsable file in strict mode")
+	}
+}
+
+func TestImageListSourceHttp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintln(w, `["registry.example.com/app:tag", "registry.example.com/app@sha256:digest"]`)
+	}))
+	defer server.Close()
+
+	images, err := NewImageListSource(server.URL + "/images").UsedImages(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(images, []string{"registry.example.com/app:tag", "registry.example.com/app@sha256:digest"}) {
+		t.Errorf("unexpected images: %v", images)
+	}
+
+	if _, err := NewImageListSource(server.URL + "/missing").UsedImages(context.Background()); err == nil {
+		t.Errorf("expected error for unexpected status")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/gookit/color"
 	"github.com/rodaine/table"
+	"k8s.io/client-go/dynamic"
 
 	"github.com/werf/kubedog/pkg/kube"
 	"github.com/werf/logboek"
@@ -31,10 +32,17 @@ type CleanupOptions struct {
 	LocalGit                                GitRepo
 	KubernetesContextClients                []*kube.ContextClient
 	KubernetesNamespaceRestrictionByContext map[string]string
+	KubernetesDynamicClientByContext        map[string]dynamic.Interface
+	ScanResourceImagesPaths                 []*allow_list.ResourceImagesPaths
 	WithoutKube                             bool
+	UsedImagesSources                       []allow_list.UsedImagesSource
 	GitHistoryBasedCleanupOptions           config.MetaCleanup
 	KeepStagesBuiltWithinLastNHours         uint64
 	DryRun                                  bool
+	ReportPath                              string
+	ReportFormat                            ReportFormat
+	CompactMetadataIndex                    bool
+	SkipArtifactsDeletion                   bool
 }
 
 func Cleanup(ctx context.Context, projectName string, storageManager *manager.StorageManager, storageLockManager storage.LockManager, options CleanupOptions) error {
@@ -51,9 +59,17 @@ func newCleanupManager(projectName string, storageManager *manager.StorageManage
 		LocalGit:                                options.LocalGit,
 		KubernetesContextClients:                options.KubernetesContextClients,
 		KubernetesNamespaceRestrictionByContext: options.KubernetesNamespaceRestrictionByContext,
+		KubernetesDynamicClientByContext:        options.KubernetesDynamicClientByContext,
+		ScanResourceImagesPaths:                 options.ScanResourceImagesPaths,
 		WithoutKube:                             options.WithoutKube,
+		UsedImagesSources:                       options.UsedImagesSources,
 		GitHistoryBasedCleanupOptions:           options.GitHistoryBasedCleanupOptions,
 		KeepStagesBuiltWithinLastNHours:         options.KeepStagesBuiltWithinLastNHours,
+		ReportPath:                              options.ReportPath,
+		ReportFormat:                            options.ReportFormat,
+		CompactMetadataIndex:                    options.CompactMetadataIndex,
+		SkipArtifactsDeletion:                   options.SkipArtifactsDeletion,
+		report:                                  newCleanupReport(projectName, options.DryRun),
 	}
 }
 
@@ -69,10 +85,19 @@ type cleanupManager struct {
 	LocalGit                                GitRepo
 	KubernetesContextClients                []*kube.ContextClient
 	KubernetesNamespaceRestrictionByContext map[string]string
+	KubernetesDynamicClientByContext        map[string]dynamic.Interface
+	ScanResourceImagesPaths                 []*allow_list.ResourceImagesPaths
 	WithoutKube                             bool
+	UsedImagesSources                       []allow_list.UsedImagesSource
 	GitHistoryBasedCleanupOptions           config.MetaCleanup
 	KeepStagesBuiltWithinLastNHours         uint64
 	DryRun                                  bool
+	ReportPath                              string
+	ReportFormat                            ReportFormat
+	CompactMetadataIndex                    bool
+	SkipArtifactsDeletion                   bool
+
+	report *CleanupReport
 }
 
 type GitRepo interface {
@@ -93,9 +118,27 @@ func (m *cleanupManager) init(ctx context.Context) error {
 		return err
 	}
 
+	m.initReport()
+
 	return nil
 }
 
+func (m *cleanupManager) initReport() {
+	commitsByImageByStageID := map[string]map[string][]string{}
+	for imageName, stageIDCommitList := range m.stageManager.GetImageStageIDCommitListToCleanup() {
+		for stageID, commitList := range stageIDCommitList {
+			if _, ok := commitsByImageByStageID[stageID]; !ok {
+				commitsByImageByStageID[stageID] = map[string][]string{}
+			}
+			commitsByImageByStageID[stageID][imageName] = commitList
+		}
+	}
+
+	for _, stageDesc := range m.stageManager.GetStageDescriptionList() {
+		m.report.AddStage(stageDesc, commitsByImageByStageID[stageDesc.Info.Tag])
+	}
+}
+
 func (m *cleanupManager) run(ctx context.Context) error {
 	if err := logboek.Context(ctx).LogProcess("Fetching manifests and metadata").DoError(func() error {
 		return m.init(ctx)
@@ -112,6 +155,14 @@ func (m *cleanupManager) run(ctx context.Context) error {
 			}
 		}
 
+		if len(m.UsedImagesSources) != 0 {
+			if err := logboek.Context(ctx).LogProcess("Skipping tags that are used according to the used images sources").DoError(func() error {
+				return m.skipStageIDsThatAreUsedInUsedImagesSources(ctx)
+			}); err != nil {
+				return err
+			}
+		}
+
 		if err := logboek.Context(ctx).LogProcess("Git history-based cleanup").DoError(func() error {
 			return m.gitHistoryBasedCleanup(ctx)
 		}); err != nil {
@@ -128,39 +179,139 @@ func (m *cleanupManager) run(ctx context.Context) error {
 		return err
 	}
 
+	if m.CompactMetadataIndex && !m.DryRun {
+		if err := m.compactMetadataIndex(ctx); err != nil {
+			return err
+		}
+	}
+
+	if m.ReportPath != "" {
+		m.report.finalize()
+		if err := m.report.WriteFile(m.ReportPath, m.ReportFormat); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (m *cleanupManager) compactMetadataIndex(ctx context.Context) error {
+	compactor, ok := m.StorageManager.StagesStorage.(storage.MetadataIndexCompactor)
+	if !ok {
+		logboek.Context(ctx).Warn().LogF("WARNING: Metadata index compaction skipped: not supported by the stages storage %s\n", m.StorageManager.StagesStorage.String())
+		return nil
+	}
+
+	return logboek.Context(ctx).LogProcess("Compacting metadata index").DoError(func() error {
+		return compactor.CompactMetadataIndex(ctx, m.ProjectName)
+	})
+}
+
 func (m *cleanupManager) skipStageIDsThatAreUsedInKubernetes(ctx context.Context) error {
 	deployedDockerImagesNames, err := m.deployedDockerImagesNames(ctx)
 	if err != nil {
 		return err
 	}
 
-	handledDeployedStages := map[string]bool{}
-Loop:
 	for _, stageID := range m.stageManager.GetStageIDList() {
 		dockerImageName := fmt.Sprintf("%s:%s", m.StorageManager.StagesStorage.String(), stageID)
-		for _, deployedDockerImageName := range deployedDockerImagesNames {
-			if deployedDockerImageName == dockerImageName {
-				if !handledDeployedStages[stageID] {
-					m.stageManager.MarkStageAsProtected(stageID)
-
-					logboek.Context(ctx).Default().LogFDetails("  tag: %s\n", stageID)
-					logboek.Context(ctx).LogOptionalLn()
-					handledDeployedStages[stageID] = true
-				}
+		if contextNames, ok := deployedDockerImagesNames[dockerImageName]; ok {
+			m.stageManager.MarkStageAsProtected(stageID)
 
-				continue Loop
+			for _, contextName := range contextNames {
+				m.report.AddKeepReason(stageID, CleanupReportKeepReason{Type: KeepReasonKubernetes, KubernetesContext: contextName})
 			}
+
+			logboek.Context(ctx).Default().LogFDetails("  tag: %s\n", stageID)
+			logboek.Context(ctx).LogOptionalLn()
 		}
 	}
 
 	return nil
 }
 
-func (m *cleanupManager) deployedDockerImagesNames(ctx context.Context) ([]string, error) {
-	var deployedDockerImagesNames []string
+func (m *cleanupManager) skipStageIDsThatAreUsedInUsedImagesSources(ctx context.Context) error {
+	usedDockerImagesNames := map[string][]string{}
+	for _, source := range m.UsedImagesSources {
+		if err := logboek.Context(ctx).LogProcessInline("Getting used docker images (%s)", source.String()).
+			DoError(func() error {
+				images, err := source.UsedImages(ctx)
+				if err != nil {
+					return fmt.Errorf("cannot get used images from %s: %s", source.String(), err)
+				}
+
+				for _, name := range images {
+					usedDockerImagesNames[name] = util.AddNewStringsToStringArray(usedDockerImagesNames[name], source.String())
+				}
+
+				return nil
+			}); err != nil {
+			return err
+		}
+	}
+
+	for stageID, sourceNames := range usedImagesSourceNamesByStageID(m.stageManager.GetStageDescriptionList(), m.StorageManager.StagesStorage.String(), usedDockerImagesNames) {
+		m.stageManager.MarkStageAsProtected(stageID)
+
+		for _, sourceName := range sourceNames {
+			m.report.AddKeepReason(stageID, CleanupReportKeepReason{Type: KeepReasonUsedImagesSource, UsedImagesSource: sourceName})
+		}
+
+		logboek.Context(ctx).Default().LogFDetails("  tag: %s\n", stageID)
+		logboek.Context(ctx).LogOptionalLn()
+	}
+
+	return nil
+}
+
+// usedImagesSourceNamesByStageID returns the names of the sources by the used stage ID.
+// The stage is used if it is referenced by the tag (REPO:STAGE_ID) or by the digest (REPO[:TAG]@DIGEST) of the stages storage repo.
+func usedImagesSourceNamesByStageID(stages []*image.StageDescription, stagesStorageRepo string, usedDockerImagesNames map[string][]string) map[string][]string {
+	sourceNamesByRepoDigest := map[string][]string{}
+	for name, sourceNames := range usedDockerImagesNames {
+		parts := strings.SplitN(name, "@", 2)
+		if len(parts) != 2 || trimReferenceTag(parts[0]) != stagesStorageRepo {
+			continue
+		}
+
+		sourceNamesByRepoDigest[parts[1]] = util.AddNewStringsToStringArray(sourceNamesByRepoDigest[parts[1]], sourceNames...)
+	}
+
+	result := map[string][]string{}
+	for _, stageDesc := range stages {
+		stageID := stageDesc.Info.Tag
+
+		var sourceNames []string
+		sourceNames = util.AddNewStringsToStringArray(sourceNames, usedDockerImagesNames[fmt.Sprintf("%s:%s", stagesStorageRepo, stageID)]...)
+
+		// the local image repo digest is REPO@DIGEST, the registry one is DIGEST
+		if repoDigest := stageDesc.Info.RepoDigest; repoDigest != "" {
+			if ind := strings.LastIndex(repoDigest, "@"); ind != -1 {
+				repoDigest = repoDigest[ind+1:]
+			}
+			sourceNames = util.AddNewStringsToStringArray(sourceNames, sourceNamesByRepoDigest[repoDigest]...)
+		}
+
+		if len(sourceNames) != 0 {
+			result[stageID] = sourceNames
+		}
+	}
+
+	return result
+}
+
+// trimReferenceTag returns the repository of the reference REPO[:TAG] (the registry port is not a tag)
+func trimReferenceTag(reference string) string {
+	if ind := strings.LastIndex(reference, ":"); ind != -1 && !strings.Contains(reference[ind:], "/") {
+		return reference[:ind]
+	}
+
+	return reference
+}
+
+// deployedDockerImagesNames returns deployed docker images names and names of the contexts where the images are deployed
+func (m *cleanupManager) deployedDockerImagesNames(ctx context.Context) (map[string][]string, error) {
+	deployedDockerImagesNames := map[string][]string{}
 	for _, contextClient := range m.KubernetesContextClients {
 		if err := logboek.Context(ctx).LogProcessInline("Getting deployed docker images (context %s)", contextClient.ContextName).
 			DoError(func() error {
@@ -169,7 +320,18 @@ func (m *cleanupManager) deployedDockerImagesNames(ctx context.Context) ([]strin
 					return fmt.Errorf("cannot get deployed imagesStageList: %s", err)
 				}
 
-				deployedDockerImagesNames = append(deployedDockerImagesNames, kubernetesClientDeployedDockerImagesNames...)
+				if dynamicClient, ok := m.KubernetesDynamicClientByContext[contextClient.ContextName]; ok && len(m.ScanResourceImagesPaths) != 0 {
+					resourcesDeployedDockerImagesNames, err := allow_list.ResourcesDeployedDockerImages(ctx, contextClient.Client, dynamicClient, m.KubernetesNamespaceRestrictionByContext[contextClient.ContextName], m.ScanResourceImagesPaths)
+					if err != nil {
+						return fmt.Errorf("cannot get deployed images of custom resources: %s", err)
+					}
+
+					kubernetesClientDeployedDockerImagesNames = append(kubernetesClientDeployedDockerImagesNames, resourcesDeployedDockerImagesNames...)
+				}
+
+				for _, name := range kubernetesClientDeployedDockerImagesNames {
+					deployedDockerImagesNames[name] = util.AddNewStringsToStringArray(deployedDockerImagesNames[name], contextClient.ContextName)
+				}
 
 				return nil
 			}); err != nil {
@@ -197,6 +359,7 @@ func (m *cleanupManager) gitHistoryBasedCleanup(ctx context.Context) error {
 	for imageName, stageIDCommitList := range m.stageManager.GetImageStageIDCommitListToCleanup() {
 		var reachedStageIDs []string
 		var hitStageIDCommitList map[string][]string
+		var stageIDReferences map[string][]*git_history_based_cleanup.ReferenceToScan
 		if err := logboek.Context(ctx).LogProcess(logging.ImageLogProcessName(imageName, false)).DoError(func() error {
 			if logboek.Context(ctx).Streams().Width() > 90 {
 				m.printStageIDCommitListTable(ctx, imageName)
@@ -204,7 +367,8 @@ func (m *cleanupManager) gitHistoryBasedCleanup(ctx context.Context) error {
 
 			if err := logboek.Context(ctx).LogProcess("Scanning git references history").DoError(func() error {
 				if countStageIDCommitList(stageIDCommitList) != 0 {
-					reachedStageIDs, hitStageIDCommitList, err = git_history_based_cleanup.ScanReferencesHistory(ctx, gitRepository, referencesToScan, stageIDCommitList)
+					imageReferencesToScan := git_history_based_cleanup.ReferencesToScanForImage(referencesToScan, imageName, m.getStagesLabels(stageIDCommitList))
+					reachedStageIDs, hitStageIDCommitList, stageIDReferences, err = git_history_based_cleanup.ScanReferencesHistory(ctx, gitRepository, imageReferencesToScan, stageIDCommitList)
 				} else {
 					logboek.Context(ctx).LogLn("Scanning stopped due to nothing to seek")
 				}
@@ -228,6 +392,7 @@ func (m *cleanupManager) gitHistoryBasedCleanup(ctx context.Context) error {
 
 			if len(reachedStageIDs) != 0 {
 				m.handleSavedStageIDs(ctx, reachedStageIDs)
+				m.reportReachedStageIDs(stageIDReferences)
 			}
 
 			if err := logboek.Context(ctx).LogProcess("Cleaning image metadata").DoError(func() error {
@@ -249,6 +414,18 @@ func (m *cleanupManager) gitHistoryBasedCleanup(ctx context.Context) error {
 	return nil
 }
 
+// getStagesLabels returns the labels of the stages for the imagesPerReference filter of the keep policies
+func (m *cleanupManager) getStagesLabels(stageIDCommitList map[string][]string) []map[string]string {
+	var stagesLabels []map[string]string
+	for _, stageDesc := range m.stageManager.GetStageDescriptionList() {
+		if _, ok := stageIDCommitList[stageDesc.Info.Tag]; ok && stageDesc.Info.Labels != nil {
+			stagesLabels = append(stagesLabels, stageDesc.Info.Labels)
+		}
+	}
+
+	return stagesLabels
+}
+
 func (m *cleanupManager) printStageIDCommitListTable(ctx context.Context, imageName string) {
 	if logboek.Context(ctx).Streams().ContentWidth() < 120 {
 		return
@@ -306,10 +483,24 @@ func (m *cleanupManager) handleSavedStageIDs(ctx context.Context, savedStageIDs
 	})
 }
 
+func (m *cleanupManager) reportReachedStageIDs(stageIDReferences map[string][]*git_history_based_cleanup.ReferenceToScan) {
+	for stageID, refs := range stageIDReferences {
+		for _, ref := range refs {
+			var keepPolicies []string
+			for _, policy := range ref.KeepPolicies {
+				keepPolicies = append(keepPolicies, policy.String())
+			}
+
+			m.report.AddKeepReason(stageID, CleanupReportKeepReason{Type: KeepReasonGitHistory, Reference: ref.Name().Short(), KeepPolicies: keepPolicies})
+		}
+	}
+}
+
 func (m *cleanupManager) deleteStages(ctx context.Context, stages []*image.StageDescription) error {
 	deleteStageOptions := manager.ForEachDeleteStageOptions{
 		DeleteImageOptions: storage.DeleteImageOptions{
-			RmiForce: false,
+			RmiForce:              false,
+			SkipArtifactsDeletion: m.SkipArtifactsDeletion,
 		},
 		FilterStagesAndProcessRelatedDataOptions: storage.FilterStagesAndProcessRelatedDataOptions{
 			SkipUsedImage:            true,
@@ -318,12 +509,17 @@ func (m *cleanupManager) deleteStages(ctx context.Context, stages []*image.Stage
 		},
 	}
 
-	return deleteStages(ctx, m.StorageManager, m.DryRun, deleteStageOptions, stages)
+	return deleteStages(ctx, m.StorageManager, m.DryRun, deleteStageOptions, stages, m.report)
 }
 
-func deleteStages(ctx context.Context, storageManager *manager.StorageManager, dryRun bool, deleteStageOptions manager.ForEachDeleteStageOptions, stages []*image.StageDescription) error {
+// deleteStages marks stages as deleted in the report if it is not nil
+func deleteStages(ctx context.Context, storageManager *manager.StorageManager, dryRun bool, deleteStageOptions manager.ForEachDeleteStageOptions, stages []*image.StageDescription, report *CleanupReport) error {
 	if dryRun {
 		for _, stageDesc := range stages {
+			if report != nil {
+				report.SetDeleted(stageDesc.Info.Tag, nil)
+			}
+
 			logboek.Context(ctx).Default().LogFDetails("  tag: %s\n", stageDesc.Info.Tag)
 			logboek.Context(ctx).LogOptionalLn()
 		}
@@ -331,6 +527,10 @@ func deleteStages(ctx context.Context, storageManager *manager.StorageManager, d
 	}
 
 	return storageManager.ForEachDeleteStage(ctx, deleteStageOptions, stages, func(ctx context.Context, stageDesc *image.StageDescription, err error) error {
+		if report != nil {
+			report.SetDeleted(stageDesc.Info.Tag, err)
+		}
+
 		if err != nil {
 			if err := handleDeletionError(err); err != nil {
 				return err
@@ -513,6 +713,7 @@ func (m *cleanupManager) cleanupUnusedStages(ctx context.Context) error {
 			var excludedSDListBySD []*image.StageDescription
 			stageDescriptionListToDelete, excludedSDListBySD = m.excludeStageAndRelativesByImageID(stageDescriptionListToDelete, sd.Info.ID)
 			excludedSDList = append(excludedSDList, excludedSDListBySD...)
+			m.reportRelatives(sd, excludedSDListBySD)
 		}
 
 		logboek.Context(ctx).Default().LogBlock("Saved stages (%d/%d)", len(excludedSDList), len(stageDescriptionList)).Do(func() {
@@ -532,6 +733,9 @@ func (m *cleanupManager) cleanupUnusedStages(ctx context.Context) error {
 					var excludedRelativesSDList []*image.StageDescription
 					stageDescriptionListToDelete, excludedRelativesSDList = m.excludeStageAndRelativesByImageID(stageDescriptionListToDelete, sd.Info.ID)
 					excludedSDList = append(excludedSDList, excludedRelativesSDList...)
+
+					m.report.AddKeepReason(sd.Info.Tag, CleanupReportKeepReason{Type: KeepReasonBuiltWithinLastNHours, Hours: m.KeepStagesBuiltWithinLastNHours})
+					m.reportRelatives(sd, excludedRelativesSDList)
 				}
 			}
 
@@ -565,6 +769,15 @@ func (m *cleanupManager) cleanupUnusedStages(ctx context.Context) error {
 	return nil
 }
 
+// reportRelatives adds keep reason for the parents and import sources of the kept stage
+func (m *cleanupManager) reportRelatives(keptSD *image.StageDescription, excludedSDList []*image.StageDescription) {
+	for _, excludedSD := range excludedSDList {
+		if excludedSD != keptSD {
+			m.report.AddKeepReason(excludedSD.Info.Tag, CleanupReportKeepReason{Type: KeepReasonRelative, Stage: keptSD.Info.Tag})
+		}
+	}
+}
+
 func (m *cleanupManager) initImportsMetadata(ctx context.Context, stageDescriptionList []*image.StageDescription) error {
 	m.checksumSourceImageIDs = map[string][]string{}
 
@@ -675,6 +888,13 @@ func (m *cleanupManager) excludeStageAndRelativesByStage(stages []*image.StageDe
 		}
 	}
 
+	// the manifest list keeps the stages of each platform-specific image
+	for _, platformImageID := range stage.Info.PlatformImageIDs {
+		var excludedPlatformStages []*image.StageDescription
+		stages, excludedPlatformStages = m.excludeStageAndRelativesByImageID(stages, platformImageID)
+		excludedStages = append(excludedStages, excludedPlatformStages...)
+	}
+
 	for label, checksum := range stage.Info.Labels {
 		if strings.HasPrefix(label, image.WerfImportChecksumLabelPrefix) {
 			sourceImageIDs, ok := m.checksumSourceImageIDs[checksum]
@@ -722,7 +942,10 @@ You should specify a token with the read:packages, write:packages, delete:packag
 Check --repo-github-token and --repo-github-token options.
 Read more details here https://werf.io/documentation/reference/working_with_docker_registries.html#github-packages`, err)
 	default:
-		if storage.IsImageDeletionFailedDueToUsingByContainerError(err) {
+		if docker_registry.IsUnsupportedDeletionError(err) {
+			// the deletion of the other images will fail the same way
+			return err
+		} else if storage.IsImageDeletionFailedDueToUsingByContainerError(err) {
 			return err
 		} else if strings.Contains(err.Error(), "UNAUTHORIZED") || strings.Contains(err.Error(), "UNSUPPORTED") {
 			return err
@@ -0,0 +1,101 @@
+package cleaning
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+func stageDescriptionTags(stages []*image.StageDescription) string {
+	var tags []string
+	for _, stage := range stages {
+		tags = append(tags, stage.Info.Tag)
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+func TestExcludeStageAndRelativesByStageKeepsEveryPlatformOfManifestList(t *testing.T) {
+	m := &cleanupManager{checksumSourceImageIDs: map[string][]string{}}
+
+	amd64Base := newTestStageDescription("amd64-base", "sha256:amd64-base", "sha256:from-amd64", 0)
+	amd64Final := newTestStageDescription("amd64-final", "sha256:amd64-final", "sha256:amd64-base", 0)
+	arm64Base := newTestStageDescription("arm64-base", "sha256:arm64-base", "sha256:from-arm64", 0)
+	arm64Final := newTestStageDescription("arm64-final", "sha256:arm64-final", "sha256:arm64-base", 0)
+	unrelated := newTestStageDescription("unrelated", "sha256:unrelated", "", 0)
+
+	// the manifest list is described by the first platform-specific image
+	manifestList := newTestStageDescription("manifest-list", "sha256:amd64-final", "sha256:amd64-base", 0)
+	manifestList.Info.PlatformImageIDs = []string{"sha256:amd64-final", "sha256:arm64-final"}
+
+	stages := []*image.StageDescription{amd64Base, amd64Final, arm64Base, arm64Final, unrelated, manifestList}
+
+	stages, excludedStages := m.excludeStageAndRelativesByStage(stages, manifestList)
+
+	if tags := stageDescriptionTags(excludedStages); tags != "amd64-base,amd64-final,arm64-base,arm64-final,manifest-list" {
+		t.Errorf("unexpected excluded stages: %s", tags)
+	}
+
+	if tags := stageDescriptionTags(stages); tags != "unrelated" {
+		t.Errorf("unexpected remaining stages: %s", tags)
+	}
+}
+
+func TestUsedImagesSourceNamesByStageID(t *testing.T) {
+	const repo = "registry.example.com:5000/project"
+
+	byTag := newTestStageDescription("digest1-1", "sha256:image1", "", 0)
+	byRegistryDigest := newTestStageDescription("digest2-2", "sha256:image2", "", 0)
+	byRegistryDigest.Info.RepoDigest = "sha256:manifest2"
+	byLocalDigest := newTestStageDescription("digest3-3", "sha256:image3", "", 0)
+	byLocalDigest.Info.RepoDigest = repo + "@sha256:manifest3"
+	otherRepoDigest := newTestStageDescription("digest4-4", "sha256:image4", "", 0)
+	otherRepoDigest.Info.RepoDigest = "sha256:manifest4"
+	unused := newTestStageDescription("digest5-5", "sha256:image5", "", 0)
+	unused.Info.RepoDigest = "sha256:manifest5"
+
+	usedDockerImagesNames := map[string][]string{
+		repo + ":digest1-1":                           {"image list a"},
+		repo + "@sha256:manifest2":                    {"git repo b"},
+		repo + ":digest3-3@sha256:manifest3":          {"manifests dir c", "image list a"},
+		"other.example.com/project@sha256:manifest4":  {"image list a"},
+		repo + ":digest5-5-other":                     {"image list a"},
+		"registry.example.com:5000/project/other:tag": {"image list a"},
+	}
+
+	result := usedImagesSourceNamesByStageID([]*image.StageDescription{byTag, byRegistryDigest, byLocalDigest, otherRepoDigest, unused}, repo, usedDockerImagesNames)
+
+	expected := map[string]string{
+		"digest1-1": "image list a",
+		"digest2-2": "git repo b",
+		"digest3-3": "image list a,manifests dir c",
+	}
+
+	if len(result) != len(expected) {
+		t.Fatalf("expected %d used stages, got %v", len(expected), result)
+	}
+
+	for stageID, sourceNames := range result {
+		sort.Strings(sourceNames)
+		if strings.Join(sourceNames, ",") != expected[stageID] {
+			t.Errorf("stage %s: expected sources %q, got %q", stageID, expected[stageID], strings.Join(sourceNames, ","))
+		}
+	}
+}
+
+func TestTrimReferenceTag(t *testing.T) {
+	tests := map[string]string{
+		"alpine":                             "alpine",
+		"alpine:3.14":                        "alpine",
+		"registry.example.com:5000/repo":     "registry.example.com:5000/repo",
+		"registry.example.com:5000/repo:tag": "registry.example.com:5000/repo",
+	}
+
+	for reference, expected := range tests {
+		if result := trimReferenceTag(reference); result != expected {
+			t.Errorf("%s: expected %q, got %q", reference, expected, result)
+		}
+	}
+}
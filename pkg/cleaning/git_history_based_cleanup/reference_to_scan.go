@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -21,6 +22,8 @@ type ReferenceToScan struct {
 	*plumbing.Reference
 	CreatedAt  time.Time
 	HeadCommit *object.Commit
+	// KeepPolicies are the keep policies which selected the reference
+	KeepPolicies []*config.MetaCleanupKeepPolicy
 	referenceScanOptions
 }
 
@@ -175,10 +178,12 @@ func ReferencesToScan(ctx context.Context, gitRepository *git.Repository, keepPo
 
 		if policy.References.BranchRegexp != nil {
 			policyRefs = selectBranchReferencesByRegexp(branchesRefs, policy.References.BranchRegexp)
+			policyRefs = selectReferencesBySemver(policyRefs, policy.References.Semver)
 			policyRefs = applyCleanupKeepPolicy(policyRefs, policy)
 			resultBranchesRefs = mergeReferences(resultBranchesRefs, policyRefs)
 		} else if policy.References.TagRegexp != nil {
 			policyRefs = selectTagReferencesByRegexp(tagsRefs, policy.References.TagRegexp)
+			policyRefs = selectReferencesBySemver(policyRefs, policy.References.Semver)
 			policyRefs = applyCleanupKeepPolicy(policyRefs, policy)
 			resultTagsRefs = mergeReferences(resultTagsRefs, policyRefs)
 		}
@@ -204,6 +209,34 @@ func ReferencesToScan(ctx context.Context, gitRepository *git.Repository, keepPo
 	return result, nil
 }
 
+// ReferencesToScanForImage returns the references with the keep policies which imagesPerReference filter matches the image.
+// The reference is skipped if none of its policies matches the image.
+func ReferencesToScanForImage(refs []*ReferenceToScan, imageName string, stagesLabels []map[string]string) []*ReferenceToScan {
+	var result []*ReferenceToScan
+	for _, ref := range refs {
+		var matchedPolicies []*config.MetaCleanupKeepPolicy
+		for _, policy := range ref.KeepPolicies {
+			if policy.ImagesPerReference.MatchImage(imageName, stagesLabels) {
+				matchedPolicies = append(matchedPolicies, policy)
+			}
+		}
+
+		if len(matchedPolicies) == 0 {
+			continue
+		} else if len(matchedPolicies) == len(ref.KeepPolicies) {
+			result = append(result, ref)
+			continue
+		}
+
+		imageRef := *ref
+		imageRef.KeepPolicies = matchedPolicies
+		imageRef.imagesCleanupKeepPolicy = matchedPolicies[len(matchedPolicies)-1].ImagesPerReference
+		result = append(result, &imageRef)
+	}
+
+	return result
+}
+
 func selectBranchReferencesByRegexp(branchesRefs []*ReferenceToScan, regexp *regexp.Regexp) []*ReferenceToScan {
 	var result []*ReferenceToScan
 
@@ -229,10 +262,49 @@ func selectTagReferencesByRegexp(tagsRefs []*ReferenceToScan, regexp *regexp.Reg
 	return result
 }
 
+// selectReferencesBySemver selects the references which short names (the last path segment for branches) are semantic versions satisfying the constraint,
+// only the highest versions are kept if the limit is set
+func selectReferencesBySemver(refs []*ReferenceToScan, semverSelector *config.MetaCleanupKeepPolicyReferencesSemver) []*ReferenceToScan {
+	if semverSelector == nil {
+		return refs
+	}
+
+	var result []*ReferenceToScan
+	versions := map[*ReferenceToScan]*semver.Version{}
+	for _, ref := range refs {
+		parts := strings.Split(ref.Name().Short(), "/")
+		version, err := semver.NewVersion(parts[len(parts)-1])
+		if err != nil {
+			continue
+		}
+
+		if semverSelector.Constraint != nil && !semverSelector.Constraint.Check(version) {
+			continue
+		}
+
+		versions[ref] = version
+		result = append(result, ref)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return versions[result[i]].GreaterThan(versions[result[j]])
+	})
+
+	if semverSelector.Highest != nil && len(result) > *semverSelector.Highest {
+		result = result[:*semverSelector.Highest]
+	}
+
+	return result
+}
+
 func applyCleanupKeepPolicy(refs []*ReferenceToScan, policy *config.MetaCleanupKeepPolicy) []*ReferenceToScan {
 	refs = applyReferencesLimit(refs, policy.References.Limit)
 	applyImagesPerReference(refs, policy.ImagesPerReference)
 
+	for _, ref := range refs {
+		ref.KeepPolicies = append(ref.KeepPolicies, policy)
+	}
+
 	return refs
 }
 
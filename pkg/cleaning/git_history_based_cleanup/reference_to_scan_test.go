@@ -0,0 +1,248 @@
+package git_history_based_cleanup
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/werf/werf/pkg/config"
+)
+
+func newTestTagReference(name string) *ReferenceToScan {
+	return &ReferenceToScan{Reference: plumbing.NewHashReference(plumbing.NewTagReferenceName(name), plumbing.ZeroHash)}
+}
+
+func newTestBranchReference(name string) *ReferenceToScan {
+	return &ReferenceToScan{Reference: plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", name), plumbing.ZeroHash)}
+}
+
+func referencesShortNames(refs []*ReferenceToScan) string {
+	var names []string
+	for _, ref := range refs {
+		names = append(names, ref.Name().Short())
+	}
+	return strings.Join(names, ",")
+}
+
+func newTestSemverSelector(t *testing.T, constraint string, highest *int) *config.MetaCleanupKeepPolicyReferencesSemver {
+	selector := &config.MetaCleanupKeepPolicyReferencesSemver{Highest: highest}
+	if constraint != "" {
+		c, err := semver.NewConstraint(constraint)
+		if err != nil {
+			t.Fatalf("unable to parse constraint %q: %s", constraint, err)
+		}
+		selector.Constraint = c
+		selector.ConstraintString = constraint
+	}
+
+	return selector
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestSelectReferencesBySemver(t *testing.T) {
+	tagRefs := []*ReferenceToScan{
+		newTestTagReference("v1.0.0"),
+		newTestTagReference("latest"),
+		newTestTagReference("v1.10.0"),
+		newTestTagReference("v2.0.0-rc.1"),
+		newTestTagReference("release-candidate"),
+		newTestTagReference("v1.2.0"),
+		newTestTagReference("1.2.3.4"),
+	}
+
+	branchRefs := []*ReferenceToScan{
+		newTestBranchReference("main"),
+		newTestBranchReference("release/1.5.0"),
+		newTestBranchReference("release/v1.4.1"),
+		newTestBranchReference("feature/new-ui"),
+	}
+
+	tests := []struct {
+		name       string
+		refs       []*ReferenceToScan
+		constraint string
+		highest    *int
+		expected   string
+	}{
+		{
+			name:     "non-semver references are skipped, versions are sorted in descending order",
+			refs:     tagRefs,
+			expected: "v2.0.0-rc.1,v1.10.0,v1.2.0,v1.0.0",
+		},
+		{
+			name:       "prereleases do not satisfy constraint without prerelease",
+			refs:       tagRefs,
+			constraint: ">= 1.2",
+			expected:   "v1.10.0,v1.2.0",
+		},
+		{
+			name:       "prereleases satisfy constraint with prerelease",
+			refs:       tagRefs,
+			constraint: ">= 2.0.0-0",
+			expected:   "v2.0.0-rc.1",
+		},
+		{
+			name:       "tilde constraint",
+			refs:       tagRefs,
+			constraint: "~1.0",
+			expected:   "v1.0.0",
+		},
+		{
+			name:     "highest limit",
+			refs:     tagRefs,
+			highest:  intPtr(2),
+			expected: "v2.0.0-rc.1,v1.10.0",
+		},
+		{
+			name:       "highest limit after constraint",
+			refs:       tagRefs,
+			constraint: "< 2",
+			highest:    intPtr(1),
+			expected:   "v1.10.0",
+		},
+		{
+			name:     "highest limit greater than the number of versions",
+			refs:     tagRefs,
+			highest:  intPtr(10),
+			expected: "v2.0.0-rc.1,v1.10.0,v1.2.0,v1.0.0",
+		},
+		{
+			name:     "zero highest limit",
+			refs:     tagRefs,
+			highest:  intPtr(0),
+			expected: "",
+		},
+		{
+			name:       "no versions satisfy constraint",
+			refs:       tagRefs,
+			constraint: ">= 3",
+			expected:   "",
+		},
+		{
+			name:     "last path segment of branch is version",
+			refs:     branchRefs,
+			expected: "origin/release/1.5.0,origin/release/v1.4.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := selectReferencesBySemver(tt.refs, newTestSemverSelector(t, tt.constraint, tt.highest))
+			if names := referencesShortNames(result); names != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestSelectReferencesBySemverWithoutSelector(t *testing.T) {
+	refs := []*ReferenceToScan{newTestTagReference("latest"), newTestTagReference("v1.0.0")}
+	if names := referencesShortNames(selectReferencesBySemver(refs, nil)); names != "latest,v1.0.0" {
+		t.Errorf("expected references to be returned as is, got %q", names)
+	}
+}
+
+func newTestKeepPolicy(imageRegexp string, labelRegexps map[string]string, last int) *config.MetaCleanupKeepPolicy {
+	policy := &config.MetaCleanupKeepPolicy{}
+	policy.ImagesPerReference.Last = intPtr(last)
+
+	if imageRegexp != "" {
+		policy.ImagesPerReference.ImageRegexp = regexp.MustCompile(imageRegexp)
+	}
+
+	if len(labelRegexps) != 0 {
+		policy.ImagesPerReference.LabelRegexps = map[string]*regexp.Regexp{}
+		for key, value := range labelRegexps {
+			policy.ImagesPerReference.LabelRegexps[key] = regexp.MustCompile(value)
+		}
+	}
+
+	return policy
+}
+
+func TestReferencesToScanForImage(t *testing.T) {
+	anyImagePolicy := newTestKeepPolicy("", nil, 1)
+	backendPolicy := newTestKeepPolicy("^backend$", nil, 2)
+	frontendPolicy := newTestKeepPolicy("^frontend$", nil, 3)
+	releaseLabelPolicy := newTestKeepPolicy("", map[string]string{"channel": "^stable$"}, 4)
+
+	allPoliciesRef := newTestTagReference("v1.0.0")
+	allPoliciesRef.KeepPolicies = []*config.MetaCleanupKeepPolicy{anyImagePolicy}
+	allPoliciesRef.imagesCleanupKeepPolicy = anyImagePolicy.ImagesPerReference
+
+	mixedRef := newTestTagReference("v2.0.0")
+	mixedRef.KeepPolicies = []*config.MetaCleanupKeepPolicy{backendPolicy, frontendPolicy}
+	mixedRef.imagesCleanupKeepPolicy = frontendPolicy.ImagesPerReference
+
+	frontendOnlyRef := newTestBranchReference("main")
+	frontendOnlyRef.KeepPolicies = []*config.MetaCleanupKeepPolicy{frontendPolicy}
+	frontendOnlyRef.imagesCleanupKeepPolicy = frontendPolicy.ImagesPerReference
+
+	labelRef := newTestBranchReference("stable")
+	labelRef.KeepPolicies = []*config.MetaCleanupKeepPolicy{releaseLabelPolicy}
+	labelRef.imagesCleanupKeepPolicy = releaseLabelPolicy.ImagesPerReference
+
+	refs := []*ReferenceToScan{allPoliciesRef, mixedRef, frontendOnlyRef, labelRef}
+
+	t.Run("image matches some policies of reference", func(t *testing.T) {
+		result := ReferencesToScanForImage(refs, "backend", []map[string]string{{"channel": "beta"}})
+		if names := referencesShortNames(result); names != "v1.0.0,v2.0.0" {
+			t.Fatalf("unexpected references %q", names)
+		}
+
+		if result[0] != allPoliciesRef {
+			t.Errorf("expected reference with all matched policies to be returned as is")
+		}
+
+		if result[1] == mixedRef {
+			t.Fatalf("expected reference with partially matched policies to be copied")
+		}
+
+		if len(result[1].KeepPolicies) != 1 || result[1].KeepPolicies[0] != backendPolicy {
+			t.Errorf("expected only backend policy, got %v", result[1].KeepPolicies)
+		}
+
+		if *result[1].imagesCleanupKeepPolicy.Last != 2 {
+			t.Errorf("expected images per reference of backend policy, got %d", *result[1].imagesCleanupKeepPolicy.Last)
+		}
+
+		if len(mixedRef.KeepPolicies) != 2 || *mixedRef.imagesCleanupKeepPolicy.Last != 3 {
+			t.Errorf("expected original reference not to be changed")
+		}
+	})
+
+	t.Run("image matches all policies of reference", func(t *testing.T) {
+		result := ReferencesToScanForImage(refs, "frontend", nil)
+		if names := referencesShortNames(result); names != "v1.0.0,v2.0.0,origin/main" {
+			t.Fatalf("unexpected references %q", names)
+		}
+
+		if result[0] != allPoliciesRef || result[2] != frontendOnlyRef {
+			t.Errorf("expected references with all matched policies to be returned as is")
+		}
+
+		if result[1] == mixedRef || len(result[1].KeepPolicies) != 1 || result[1].KeepPolicies[0] != frontendPolicy {
+			t.Errorf("expected reference with only frontend policy, got %v", result[1].KeepPolicies)
+		}
+	})
+
+	t.Run("image matches policy by stage labels", func(t *testing.T) {
+		result := ReferencesToScanForImage(refs, "worker", []map[string]string{{"channel": "beta"}, {"channel": "stable"}})
+		if names := referencesShortNames(result); names != "v1.0.0,origin/stable" {
+			t.Errorf("unexpected references %q", names)
+		}
+	})
+
+	t.Run("image matches no policies", func(t *testing.T) {
+		result := ReferencesToScanForImage([]*ReferenceToScan{mixedRef, frontendOnlyRef, labelRef}, "worker", nil)
+		if len(result) != 0 {
+			t.Errorf("expected no references, got %q", referencesShortNames(result))
+		}
+	})
+}
@@ -17,10 +17,12 @@ import (
 	"github.com/werf/werf/pkg/util"
 )
 
-func ScanReferencesHistory(ctx context.Context, gitRepository *git.Repository, refs []*ReferenceToScan, expectedStageIDCommitList map[string][]string) ([]string, map[string][]string, error) {
+// ScanReferencesHistory returns reached stage IDs, hit commits of the stage IDs and the references by which the stage IDs have been reached
+func ScanReferencesHistory(ctx context.Context, gitRepository *git.Repository, refs []*ReferenceToScan, expectedStageIDCommitList map[string][]string) ([]string, map[string][]string, map[string][]*ReferenceToScan, error) {
 	var reachedStageIDs []string
 	var stopCommitList []string
 	stageIDHitCommitList := map[string][]string{}
+	stageIDReferences := map[string][]*ReferenceToScan{}
 
 	for i := len(refs) - 1; i >= 0; i-- {
 		ref := refs[i]
@@ -46,6 +48,10 @@ func ScanReferencesHistory(ctx context.Context, gitRepository *git.Repository, r
 			stopCommitList = util.AddNewStringsToStringArray(stopCommitList, refStopCommitList...)
 			reachedStageIDs = util.AddNewStringsToStringArray(reachedStageIDs, refReachedStageIDs...)
 
+			for _, stageID := range refReachedStageIDs {
+				stageIDReferences[stageID] = append(stageIDReferences[stageID], ref)
+			}
+
 			for refStageID, refCommitList := range refStageIDHitCommitList {
 				hitCommitList, ok := stageIDHitCommitList[refStageID]
 				if !ok {
@@ -58,11 +64,11 @@ func ScanReferencesHistory(ctx context.Context, gitRepository *git.Repository, r
 
 			return nil
 		}); err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 	}
 
-	return reachedStageIDs, stageIDHitCommitList, nil
+	return reachedStageIDs, stageIDHitCommitList, stageIDReferences, nil
 }
 
 func applyImagesCleanupInPolicy(gitRepository *git.Repository, stageIDCommitList map[string][]string, in *time.Duration) map[string][]string {
@@ -0,0 +1,193 @@
+package cleaning
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+const (
+	ReportJSON ReportFormat = "json"
+	ReportYAML ReportFormat = "yaml"
+)
+
+type ReportFormat string
+
+const (
+	KeepReasonKubernetes            = "kubernetes"
+	KeepReasonGitHistory            = "git-history"
+	KeepReasonRelative              = "relative"
+	KeepReasonBuiltWithinLastNHours = "built-within-last-n-hours"
+	KeepReasonUsedImagesSource      = "used-images-source"
+)
+
+// CleanupReport describes every stage considered by the cleanup: why the stage has been kept or whether it has been deleted.
+// The report is also produced in the dry-run mode, deleted stages are the stages that would be deleted then.
+type CleanupReport struct {
+	mux sync.Mutex
+
+	Project string                `json:"project"`
+	DryRun  bool                  `json:"dryRun"`
+	Stages  []*CleanupReportStage `json:"stages"`
+	stages  map[string]*CleanupReportStage
+
+	// ReclaimedBytes is the sum of own sizes of the deleted stages.
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+	// ReclaimedBytesByImage is the sum of own sizes of the deleted stages, which have been related to the image by the image metadata.
+	ReclaimedBytesByImage map[string]int64 `json:"reclaimedBytesByImage"`
+}
+
+type CleanupReportStage struct {
+	Tag       string    `json:"tag"`
+	ImageID   string    `json:"imageID"`
+	ParentID  string    `json:"parentID,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+	// OwnSize is the stage size without the size of the parent stage, which is kept in the same repo.
+	OwnSize int64 `json:"ownSize"`
+
+	// CommitsByImage contains the commits of the image metadata records related to the stage.
+	CommitsByImage map[string][]string `json:"commitsByImage,omitempty"`
+
+	KeptBy        []CleanupReportKeepReason `json:"keptBy,omitempty"`
+	Deleted       bool                      `json:"deleted"`
+	DeletionError string                    `json:"deletionError,omitempty"`
+}
+
+type CleanupReportKeepReason struct {
+	Type string `json:"type"`
+
+	KubernetesContext string   `json:"kubernetesContext,omitempty"`
+	UsedImagesSource  string   `json:"usedImagesSource,omitempty"`
+	Reference         string   `json:"reference,omitempty"`
+	KeepPolicies      []string `json:"keepPolicies,omitempty"`
+	// Stage is a tag of the kept stage for which the stage is a parent or an import source.
+	Stage string `json:"stage,omitempty"`
+	Hours uint64 `json:"hours,omitempty"`
+}
+
+func newCleanupReport(projectName string, dryRun bool) *CleanupReport {
+	return &CleanupReport{
+		Project:               projectName,
+		DryRun:                dryRun,
+		stages:                map[string]*CleanupReportStage{},
+		ReclaimedBytesByImage: map[string]int64{},
+	}
+}
+
+func (report *CleanupReport) AddStage(stageDesc *image.StageDescription, commitsByImage map[string][]string) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	report.stages[stageDesc.Info.Tag] = &CleanupReportStage{
+		Tag:            stageDesc.Info.Tag,
+		ImageID:        stageDesc.Info.ID,
+		ParentID:       stageDesc.Info.ParentID,
+		CreatedAt:      stageDesc.Info.GetCreatedAt(),
+		Size:           stageDesc.Info.Size,
+		CommitsByImage: commitsByImage,
+	}
+}
+
+func (report *CleanupReport) AddKeepReason(tag string, reason CleanupReportKeepReason) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	if stage, ok := report.stages[tag]; ok {
+		stage.KeptBy = append(stage.KeptBy, reason)
+	}
+}
+
+func (report *CleanupReport) SetDeleted(tag string, deletionErr error) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	if stage, ok := report.stages[tag]; ok {
+		if deletionErr != nil {
+			stage.DeletionError = deletionErr.Error()
+		} else {
+			stage.Deleted = true
+		}
+	}
+}
+
+// finalize sorts stages and calculates own sizes and reclaimed bytes
+func (report *CleanupReport) finalize() {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	sizeByImageID := map[string]int64{}
+	for _, stage := range report.stages {
+		sizeByImageID[stage.ImageID] = stage.Size
+	}
+
+	report.Stages = nil
+	report.ReclaimedBytes = 0
+	report.ReclaimedBytesByImage = map[string]int64{}
+
+	for _, stage := range report.stages {
+		stage.OwnSize = stage.Size
+		if parentSize, ok := sizeByImageID[stage.ParentID]; ok && stage.ParentID != "" && stage.Size >= parentSize {
+			stage.OwnSize = stage.Size - parentSize
+		}
+
+		if stage.Deleted {
+			report.ReclaimedBytes += stage.OwnSize
+			for imageName := range stage.CommitsByImage {
+				report.ReclaimedBytesByImage[imageName] += stage.OwnSize
+			}
+		}
+
+		report.Stages = append(report.Stages, stage)
+	}
+
+	sort.Slice(report.Stages, func(i, j int) bool {
+		return report.Stages[i].Tag < report.Stages[j].Tag
+	})
+}
+
+func (report *CleanupReport) ToJsonData() ([]byte, error) {
+	report.mux.Lock()
+	defer report.mux.Unlock()
+
+	return json.MarshalIndent(report, "", "\t")
+}
+
+func (report *CleanupReport) ToYamlData() ([]byte, error) {
+	data, err := report.ToJsonData()
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.JSONToYAML(data)
+}
+
+func (report *CleanupReport) WriteFile(path string, format ReportFormat) error {
+	var data []byte
+	var err error
+	switch format {
+	case ReportJSON:
+		data, err = report.ToJsonData()
+	case ReportYAML:
+		data, err = report.ToYamlData()
+	default:
+		panic(fmt.Sprintf("unknown report format %q", format))
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to prepare report %s: %s", format, err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write report to %s: %s", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package cleaning
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+func newTestStageDescription(tag, id, parentID string, size int64) *image.StageDescription {
+	return &image.StageDescription{Info: &image.Info{Tag: tag, ID: id, ParentID: parentID, Size: size}}
+}
+
+func TestCleanupReport(t *testing.T) {
+	report := newCleanupReport("myproject", false)
+
+	report.AddStage(newTestStageDescription("base", "sha256:base", "sha256:from", 100), nil)
+	report.AddStage(newTestStageDescription("kept", "sha256:kept", "sha256:base", 150), map[string][]string{"app": {"commit1"}})
+	report.AddStage(newTestStageDescription("deleted-1", "sha256:deleted-1", "sha256:base", 130), map[string][]string{"app": {"commit2"}, "worker": {"commit2"}})
+	report.AddStage(newTestStageDescription("deleted-2", "sha256:deleted-2", "sha256:deleted-1", 200), map[string][]string{"app": {"commit3"}})
+	report.AddStage(newTestStageDescription("failed", "sha256:failed", "", 70), nil)
+
+	report.AddKeepReason("kept", CleanupReportKeepReason{Type: KeepReasonGitHistory, Reference: "origin/master"})
+	report.AddKeepReason("base", CleanupReportKeepReason{Type: KeepReasonRelative, Stage: "kept"})
+	report.AddKeepReason("unknown", CleanupReportKeepReason{Type: KeepReasonKubernetes})
+
+	report.SetDeleted("deleted-1", nil)
+	report.SetDeleted("deleted-2", nil)
+	report.SetDeleted("failed", errors.New("deletion failed"))
+
+	report.finalize()
+
+	var tags []string
+	for _, stage := range report.Stages {
+		tags = append(tags, stage.Tag)
+	}
+	if strings.Join(tags, ",") != "base,deleted-1,deleted-2,failed,kept" {
+		t.Errorf("unexpected stages order: %v", tags)
+	}
+
+	stages := map[string]*CleanupReportStage{}
+	for _, stage := range report.Stages {
+		stages[stage.Tag] = stage
+	}
+
+	for tag, expectedOwnSize := range map[string]int64{"base": 100, "kept": 50, "deleted-1": 30, "deleted-2": 70, "failed": 70} {
+		if stages[tag].OwnSize != expectedOwnSize {
+			t.Errorf("expected stage %s own size %d, got %d", tag, expectedOwnSize, stages[tag].OwnSize)
+		}
+	}
+
+	if len(stages["base"].KeptBy) != 1 || stages["base"].KeptBy[0].Stage != "kept" {
+		t.Errorf("unexpected keep reasons of the stage base: %v", stages["base"].KeptBy)
+	}
+
+	if stages["failed"].Deleted || stages["failed"].DeletionError != "deletion failed" {
+		t.Errorf("unexpected state of the failed stage: %+v", stages["failed"])
+	}
+
+	if report.ReclaimedBytes != 100 {
+		t.Errorf("expected 100 reclaimed bytes, got %d", report.ReclaimedBytes)
+	}
+
+	if report.ReclaimedBytesByImage["app"] != 100 || report.ReclaimedBytesByImage["worker"] != 30 {
+		t.Errorf("unexpected reclaimed bytes by image: %v", report.ReclaimedBytesByImage)
+	}
+
+	data, err := report.ToYamlData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "reclaimedBytes: 100") {
+		t.Errorf("unexpected yaml report:\n%s", data)
+	}
+}
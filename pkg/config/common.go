@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/werf/werf/pkg/util"
@@ -100,6 +101,24 @@ func InterfaceToStringArray(stringOrStringArray interface{}, configSection inter
 	}
 }
 
+var platformRegexp = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+func validatePlatforms(platforms []string, configSection interface{}, doc *doc) error {
+	platformsSet := map[string]bool{}
+	for _, platform := range platforms {
+		if !platformRegexp.MatchString(platform) {
+			return newDetailedConfigError(fmt.Sprintf("invalid platform `%s`: expected `OS/ARCH[/VARIANT]` (e.g. `linux/amd64` or `linux/arm64/v8`)!", platform), configSection, doc)
+		}
+
+		if platformsSet[platform] {
+			return newDetailedConfigError(fmt.Sprintf("duplicate platform `%s`!", platform), configSection, doc)
+		}
+		platformsSet[platform] = true
+	}
+
+	return nil
+}
+
 // Stack for setting parents in UnmarshalYAML calls
 // Set this to util.NewStack before yaml.Unmarshal
 var parentStack *util.Stack
@@ -0,0 +1,23 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = DescribeTable("validating platforms", func(platforms []string, expectedValid bool) {
+	err := validatePlatforms(platforms, nil, &doc{})
+	if expectedValid {
+		Ω(err).ShouldNot(HaveOccurred())
+	} else {
+		Ω(err).Should(HaveOccurred())
+	}
+},
+	Entry("no platforms", nil, true),
+	Entry("os and arch", []string{"linux/amd64", "linux/arm64"}, true),
+	Entry("os, arch and variant", []string{"linux/arm64/v8", "linux/arm/v7"}, true),
+	Entry("arch only", []string{"amd64"}, false),
+	Entry("extra part", []string{"linux/arm/v7/extra"}, false),
+	Entry("upper case", []string{"Linux/AMD64"}, false),
+	Entry("duplicate", []string{"linux/amd64", "linux/amd64"}, false),
+)
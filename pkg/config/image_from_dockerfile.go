@@ -16,8 +16,11 @@ type ImageFromDockerfile struct {
 	AddHost         []string
 	Network         string
 	SSH             string
+	Platform        []string
+	Staged          bool
+	Secrets         []*Secret
 
-	raw             *rawImageFromDockerfile
+	raw *rawImageFromDockerfile
 }
 
 func (c *ImageFromDockerfile) validate(giterminismManager giterminism_manager.Interface) error {
@@ -29,6 +32,10 @@ func (c *ImageFromDockerfile) validate(giterminismManager giterminism_manager.In
 		return newDetailedConfigError("`contextAddFiles: [PATH, ...]|PATH` each path should be relative to context!", nil, c.raw.doc)
 	}
 
+	if err := validatePlatforms(c.Platform, nil, c.raw.doc); err != nil {
+		return err
+	}
+
 	if len(c.ContextAddFiles) != 0 {
 		for _, contextAddFile := range c.ContextAddFiles {
 			if err := giterminismManager.Inspector().InspectConfigDockerfileContextAddFile(filepath.Join(c.Context, contextAddFile)); err != nil {
@@ -0,0 +1,20 @@
+package config
+
+const (
+	// DigestModeDefault is the stage digest based on the werf build cache version, the stage name and the previous stage digest
+	DigestModeDefault = "default"
+	// DigestModeContent is the stage digest based on the canonical serialization of the stage inputs and the parent stage content digest
+	DigestModeContent = "content"
+)
+
+type MetaBuild struct {
+	DigestMode *string
+}
+
+func (obj MetaBuild) GetDigestMode() string {
+	if obj.DigestMode != nil {
+		return *obj.DigestMode
+	} else {
+		return DigestModeDefault
+	}
+}
@@ -3,8 +3,11 @@ package config
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/Masterminds/semver"
 )
 
 type MetaCleanup struct {
@@ -31,6 +34,7 @@ func (p *MetaCleanupKeepPolicy) String() string {
 type MetaCleanupKeepPolicyReferences struct {
 	TagRegexp    *regexp.Regexp
 	BranchRegexp *regexp.Regexp
+	Semver       *MetaCleanupKeepPolicyReferencesSemver
 	Limit        *MetaCleanupKeepPolicyLimit
 }
 
@@ -43,6 +47,10 @@ func (c *MetaCleanupKeepPolicyReferences) String() string {
 		parts = append(parts, fmt.Sprintf("branch=%s", c.BranchRegexp.String()))
 	}
 
+	if c.Semver != nil {
+		parts = append(parts, fmt.Sprintf("semver={%s}", c.Semver.String()))
+	}
+
 	if c.Limit != nil {
 		parts = append(parts, fmt.Sprintf("limit={%s}", c.Limit.String()))
 	}
@@ -50,8 +58,86 @@ func (c *MetaCleanupKeepPolicyReferences) String() string {
 	return strings.Join(parts, " ")
 }
 
+// MetaCleanupKeepPolicyReferencesSemver selects the references which short names (the last path segment for branches) are semantic versions
+type MetaCleanupKeepPolicyReferencesSemver struct {
+	Constraint       *semver.Constraints
+	ConstraintString string
+	Highest          *int
+}
+
+func (c *MetaCleanupKeepPolicyReferencesSemver) String() string {
+	var parts []string
+
+	if c.Constraint != nil {
+		parts = append(parts, fmt.Sprintf("constraint=%q", c.ConstraintString))
+	}
+
+	if c.Highest != nil {
+		parts = append(parts, fmt.Sprintf("highest=%d", *c.Highest))
+	}
+
+	return strings.Join(parts, " ")
+}
+
 type MetaCleanupKeepPolicyImagesPerReference struct {
 	MetaCleanupKeepPolicyLimit
+	ImageRegexp  *regexp.Regexp
+	LabelRegexps map[string]*regexp.Regexp
+}
+
+func (c *MetaCleanupKeepPolicyImagesPerReference) String() string {
+	var parts []string
+
+	if limitPart := c.MetaCleanupKeepPolicyLimit.String(); limitPart != "" {
+		parts = append(parts, limitPart)
+	}
+
+	if c.ImageRegexp != nil {
+		parts = append(parts, fmt.Sprintf("image=%s", c.ImageRegexp.String()))
+	}
+
+	if len(c.LabelRegexps) != 0 {
+		var keys []string
+		for key := range c.LabelRegexps {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var labelParts []string
+		for _, key := range keys {
+			labelParts = append(labelParts, fmt.Sprintf("%s=%s", key, c.LabelRegexps[key].String()))
+		}
+
+		parts = append(parts, fmt.Sprintf("labels={%s}", strings.Join(labelParts, " ")))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// MatchImage checks the image name and the labels of the image stages, the policy without the image filter matches all images.
+// The labels match if any stage has all of them.
+func (c *MetaCleanupKeepPolicyImagesPerReference) MatchImage(imageName string, stagesLabels []map[string]string) bool {
+	if c.ImageRegexp != nil && !c.ImageRegexp.MatchString(imageName) {
+		return false
+	}
+
+	if len(c.LabelRegexps) == 0 {
+		return true
+	}
+
+stagesLoop:
+	for _, labels := range stagesLabels {
+		for key, regex := range c.LabelRegexps {
+			value, ok := labels[key]
+			if !ok || !regex.MatchString(value) {
+				continue stagesLoop
+			}
+		}
+
+		return true
+	}
+
+	return false
 }
 
 type MetaCleanupKeepPolicyLimit struct {
@@ -17,6 +17,9 @@ type rawImageFromDockerfile struct {
 	AddHost         interface{}            `yaml:"addHost,omitempty"`
 	Network         string                 `yaml:"network,omitempty"`
 	SSH             string                 `yaml:"ssh,omitempty"`
+	Platform        interface{}            `yaml:"platform,omitempty"`
+	Staged          bool                   `yaml:"staged,omitempty"`
+	RawSecret       []*rawSecret           `yaml:"secrets,omitempty"`
 
 	doc *doc `yaml:"-"` // parent
 
@@ -114,6 +117,20 @@ func (c *rawImageFromDockerfile) toImageFromDockerfileDirective(giterminismManag
 	image.Network = c.Network
 	image.SSH = c.SSH
 
+	if platform, err := InterfaceToStringArray(c.Platform, c, c.doc); err != nil {
+		return nil, err
+	} else {
+		image.Platform = platform
+	}
+
+	image.Staged = c.Staged
+
+	if secrets, err := rawSecretsToDirectives(c.RawSecret, c.doc); err != nil {
+		return nil, err
+	} else {
+		image.Secrets = secrets
+	}
+
 	image.raw = c
 
 	if err := image.validate(giterminismManager); err != nil {
@@ -13,6 +13,7 @@ type rawMeta struct {
 	Deploy             *rawMetaDeploy      `yaml:"deploy,omitempty"`
 	Cleanup            *rawMetaCleanup     `yaml:"cleanup,omitempty"`
 	GitWorktree        *rawMetaGitWorktree `yaml:"gitWorktree,omitempty"`
+	Build              *rawMetaBuild       `yaml:"build,omitempty"`
 
 	doc *doc `yaml:"-"` // parent
 
@@ -75,5 +76,9 @@ func (c *rawMeta) toMeta() *Meta {
 		meta.GitWorktree = c.GitWorktree.toMetaGitWorktree()
 	}
 
+	if c.Build != nil {
+		meta.Build = c.Build.toMetaBuild()
+	}
+
 	return meta
 }
@@ -0,0 +1,49 @@
+package config
+
+import "fmt"
+
+type rawMetaBuild struct {
+	DigestMode *string `yaml:"digestMode,omitempty"`
+
+	rawMeta *rawMeta
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+func (c *rawMetaBuild) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawMeta); ok {
+		c.rawMeta = parent
+	}
+
+	parentStack.Push(c)
+	type plain rawMetaBuild
+	err := unmarshal((*plain)(c))
+	parentStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	if err := checkOverflow(c.UnsupportedAttributes, nil, c.rawMeta.doc); err != nil {
+		return err
+	}
+
+	return c.validate()
+}
+
+func (c *rawMetaBuild) validate() error {
+	if c.DigestMode != nil {
+		switch *c.DigestMode {
+		case DigestModeDefault, DigestModeContent:
+		default:
+			return newDetailedConfigError(fmt.Sprintf("invalid digestMode %q: expected %q or %q", *c.DigestMode, DigestModeDefault, DigestModeContent), nil, c.rawMeta.doc)
+		}
+	}
+
+	return nil
+}
+
+func (c *rawMetaBuild) toMetaBuild() MetaBuild {
+	obj := MetaBuild{}
+	obj.DigestMode = c.DigestMode
+	return obj
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type metaBuildEntry struct {
+	digestMode         *string
+	expectedDigestMode string
+	expectedError      bool
+}
+
+var _ = DescribeTable("meta build digest mode", func(e metaBuildEntry) {
+	raw := rawMetaBuild{DigestMode: e.digestMode, rawMeta: &rawMeta{doc: &doc{}}}
+	err := raw.validate()
+	if e.expectedError {
+		Ω(err).Should(HaveOccurred())
+	} else {
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(raw.toMetaBuild().GetDigestMode()).Should(Equal(e.expectedDigestMode))
+	}
+},
+	Entry("not specified", metaBuildEntry{
+		expectedDigestMode: DigestModeDefault,
+	}),
+	Entry("default", metaBuildEntry{
+		digestMode:         stringPtr(DigestModeDefault),
+		expectedDigestMode: DigestModeDefault,
+	}),
+	Entry("content", metaBuildEntry{
+		digestMode:         stringPtr(DigestModeContent),
+		expectedDigestMode: DigestModeContent,
+	}),
+	Entry("unknown", metaBuildEntry{
+		digestMode:    stringPtr("stage"),
+		expectedError: true,
+	}))
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/Masterminds/semver"
 )
 
 type rawMetaCleanup struct {
@@ -23,9 +25,10 @@ type rawMetaCleanupKeepPolicy struct {
 }
 
 type rawMetaCleanupKeepPolicyReferences struct {
-	Tag    string                                   `yaml:"tag,omitempty"`
-	Branch string                                   `yaml:"branch,omitempty"`
-	Limit  *rawMetaCleanupKeepPolicyReferencesLimit `yaml:"limit,omitempty"`
+	Tag    string                                    `yaml:"tag,omitempty"`
+	Branch string                                    `yaml:"branch,omitempty"`
+	Semver *rawMetaCleanupKeepPolicyReferencesSemver `yaml:"semver,omitempty"`
+	Limit  *rawMetaCleanupKeepPolicyReferencesLimit  `yaml:"limit,omitempty"`
 
 	TagRegexp    *regexp.Regexp `yaml:"-"`
 	BranchRegexp *regexp.Regexp `yaml:"-"`
@@ -34,7 +37,29 @@ type rawMetaCleanupKeepPolicyReferences struct {
 	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
 }
 
-type rawMetaCleanupKeepPolicyImagesPerReference rawMetaCleanupKeepPolicyReferencesLimit
+type rawMetaCleanupKeepPolicyReferencesSemver struct {
+	Constraint *string `yaml:"constraint,omitempty"`
+	Highest    *int    `yaml:"highest,omitempty"`
+
+	constraints *semver.Constraints
+
+	rawMetaCleanup        *rawMetaCleanup
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+type rawMetaCleanupKeepPolicyImagesPerReference struct {
+	Last     *int              `yaml:"last,omitempty"`
+	In       *time.Duration    `yaml:"in,omitempty"`
+	Operator *string           `yaml:"operator,omitempty"`
+	Image    string            `yaml:"image,omitempty"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
+
+	ImageRegexp  *regexp.Regexp            `yaml:"-"`
+	LabelRegexps map[string]*regexp.Regexp `yaml:"-"`
+
+	rawMetaCleanup        *rawMetaCleanup
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
 
 type rawMetaCleanupKeepPolicyReferencesLimit struct {
 	Last     *int           `yaml:"last,omitempty"`
@@ -106,8 +131,8 @@ func (c *rawMetaCleanupKeepPolicyReferences) UnmarshalYAML(unmarshal func(interf
 		return err
 	}
 
-	if c.Tag == "" && c.Branch == "" {
-		return newDetailedConfigError("tag `tag: string|REGEX` or branch `branch: string|REGEX` required for cleanup keep policy!", c, c.rawMetaCleanup.rawMeta.doc)
+	if c.Tag == "" && c.Branch == "" && c.Semver == nil {
+		return newDetailedConfigError("tag `tag: string|REGEX`, branch `branch: string|REGEX` or semver `semver: {...}` required for cleanup keep policy!", c, c.rawMetaCleanup.rawMeta.doc)
 	} else if c.Tag != "" && c.Branch != "" {
 		return newDetailedConfigError("specify only tag `tag: string|REGEX` or branch `branch: string|REGEX` for cleanup keep policy!", c, c.rawMetaCleanup.rawMeta.doc)
 	}
@@ -119,13 +144,103 @@ func (c *rawMetaCleanupKeepPolicyReferences) UnmarshalYAML(unmarshal func(interf
 		}
 
 		c.BranchRegexp = regex
-	} else {
+	} else if c.Tag != "" {
 		regex, err := c.processRegexpString("tag", c.Tag)
 		if err != nil {
 			return err
 		}
 
 		c.TagRegexp = regex
+	} else { // semver tags
+		c.TagRegexp = regexp.MustCompile("^.*$")
+	}
+
+	return nil
+}
+
+func (c *rawMetaCleanupKeepPolicyReferencesSemver) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawMetaCleanupKeepPolicyReferences); ok {
+		c.rawMetaCleanup = parent.rawMetaCleanup
+	}
+
+	parentStack.Push(c)
+	type plain rawMetaCleanupKeepPolicyReferencesSemver
+	err := unmarshal((*plain)(c))
+	parentStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, c.rawMetaCleanup.rawMeta.doc); err != nil {
+		return err
+	}
+
+	return c.validate()
+}
+
+func (c *rawMetaCleanupKeepPolicyReferencesSemver) validate() error {
+	if c.Constraint != nil {
+		constraints, err := semver.NewConstraint(*c.Constraint)
+		if err != nil {
+			return newDetailedConfigError(fmt.Sprintf("invalid value %q for `constraint: string`: %s", *c.Constraint, err), c, c.rawMetaCleanup.rawMeta.doc)
+		}
+
+		c.constraints = constraints
+	}
+
+	if c.Highest != nil && *c.Highest < 1 {
+		return newDetailedConfigError(fmt.Sprintf("invalid value %d for `highest: int`: positive number expected!", *c.Highest), c, c.rawMetaCleanup.rawMeta.doc)
+	}
+
+	return nil
+}
+
+func (c *rawMetaCleanupKeepPolicyImagesPerReference) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawMetaCleanupKeepPolicy); ok {
+		c.rawMetaCleanup = parent.rawMetaCleanup
+	}
+
+	parentStack.Push(c)
+	type plain rawMetaCleanupKeepPolicyImagesPerReference
+	err := unmarshal((*plain)(c))
+	parentStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, c.rawMetaCleanup.rawMeta.doc); err != nil {
+		return err
+	}
+
+	return c.validate()
+}
+
+func (c *rawMetaCleanupKeepPolicyImagesPerReference) validate() error {
+	if c.Operator != nil {
+		if *c.Operator != "Or" && *c.Operator != "And" {
+			return newDetailedConfigError(fmt.Sprintf("unsupported value %q for `operator: Or|And`!", *c.Operator), c, c.rawMetaCleanup.rawMeta.doc)
+		}
+	}
+
+	if c.Image != "" {
+		regex, err := compileCleanupRegexpString(c.Image)
+		if err != nil {
+			return newDetailedConfigError(fmt.Sprintf("invalid value %q for `image: string|REGEX`!", c.Image), c, c.rawMetaCleanup.rawMeta.doc)
+		}
+
+		c.ImageRegexp = regex
+	}
+
+	for key, value := range c.Labels {
+		regex, err := compileCleanupRegexpString(value)
+		if err != nil {
+			return newDetailedConfigError(fmt.Sprintf("invalid value %q of label %q for `labels: map[string]string|REGEX`!", value, key), c, c.rawMetaCleanup.rawMeta.doc)
+		}
+
+		if c.LabelRegexps == nil {
+			c.LabelRegexps = map[string]*regexp.Regexp{}
+		}
+		c.LabelRegexps[key] = regex
 	}
 
 	return nil
@@ -161,6 +276,16 @@ func (c *rawMetaCleanupKeepPolicyReferencesLimit) UnmarshalYAML(unmarshal func(i
 }
 
 func (c *rawMetaCleanupKeepPolicyReferences) processRegexpString(name, configValue string) (*regexp.Regexp, error) {
+	regex, err := compileCleanupRegexpString(configValue)
+	if err != nil {
+		return nil, newDetailedConfigError(fmt.Sprintf("invalid value %q for `%s: string|REGEX`!", configValue, name), c, c.rawMetaCleanup.rawMeta.doc)
+	}
+
+	return regex, nil
+}
+
+// compileCleanupRegexpString compiles the value in the format string|/REGEX/, the string matches exactly
+func compileCleanupRegexpString(configValue string) (*regexp.Regexp, error) {
 	var value string
 	if strings.HasPrefix(configValue, "/") && strings.HasSuffix(configValue, "/") {
 		value = strings.TrimPrefix(configValue, "/")
@@ -169,13 +294,7 @@ func (c *rawMetaCleanupKeepPolicyReferences) processRegexpString(name, configVal
 		value = regexp.QuoteMeta(configValue)
 	}
 
-	expr := fmt.Sprintf("^%s$", value)
-	regex, err := regexp.Compile(expr)
-	if err != nil {
-		return nil, newDetailedConfigError(fmt.Sprintf("invalid value %q for `%s: string|REGEX`!", configValue, name), c, c.rawMetaCleanup.rawMeta.doc)
-	}
-
-	return regex, nil
+	return regexp.Compile(fmt.Sprintf("^%s$", value))
 }
 
 func (c *rawMetaCleanup) toMetaCleanup() MetaCleanup {
@@ -207,6 +326,10 @@ func (c *rawMetaCleanupKeepPolicyReferences) toMetaCleanupKeepPolicyReferences()
 	references.BranchRegexp = c.BranchRegexp
 	references.TagRegexp = c.TagRegexp
 
+	if c.Semver != nil {
+		references.Semver = c.Semver.toMetaCleanupKeepPolicyReferencesSemver()
+	}
+
 	if c.Limit != nil {
 		references.Limit = c.Limit.toMetaCleanupKeepPolicyLimit()
 	}
@@ -230,10 +353,22 @@ func (c *rawMetaCleanupKeepPolicyReferencesLimit) toMetaCleanupKeepPolicyLimit()
 	return limit
 }
 
+func (c *rawMetaCleanupKeepPolicyReferencesSemver) toMetaCleanupKeepPolicyReferencesSemver() *MetaCleanupKeepPolicyReferencesSemver {
+	obj := &MetaCleanupKeepPolicyReferencesSemver{}
+	obj.Constraint = c.constraints
+	if c.Constraint != nil {
+		obj.ConstraintString = *c.Constraint
+	}
+	obj.Highest = c.Highest
+	return obj
+}
+
 func (c *rawMetaCleanupKeepPolicyImagesPerReference) toMetaCleanupKeepPolicyImagesPerReference() MetaCleanupKeepPolicyImagesPerReference {
 	limit := MetaCleanupKeepPolicyImagesPerReference{}
 	limit.Last = c.Last
 	limit.In = c.In
+	limit.ImageRegexp = c.ImageRegexp
+	limit.LabelRegexps = c.LabelRegexps
 
 	if c.Operator != nil {
 		if *c.Operator == "And" {
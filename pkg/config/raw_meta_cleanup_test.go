@@ -0,0 +1,73 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type metaCleanupImagesPerReferenceEntry struct {
+	image         string
+	labels        map[string]string
+	imageName     string
+	stagesLabels  []map[string]string
+	expectedMatch bool
+	expectedError bool
+}
+
+var _ = DescribeTable("meta cleanup keep policy imagesPerReference filter", func(e metaCleanupImagesPerReferenceEntry) {
+	raw := rawMetaCleanupKeepPolicyImagesPerReference{Image: e.image, Labels: e.labels, rawMetaCleanup: &rawMetaCleanup{rawMeta: &rawMeta{doc: &doc{}}}}
+	err := raw.validate()
+	if e.expectedError {
+		Ω(err).Should(HaveOccurred())
+	} else {
+		Ω(err).ShouldNot(HaveOccurred())
+		imagesPerReference := raw.toMetaCleanupKeepPolicyImagesPerReference()
+		Ω(imagesPerReference.MatchImage(e.imageName, e.stagesLabels)).Should(Equal(e.expectedMatch))
+	}
+},
+	Entry("no filter", metaCleanupImagesPerReferenceEntry{
+		imageName:     "backend",
+		expectedMatch: true,
+	}),
+	Entry("image name", metaCleanupImagesPerReferenceEntry{
+		image:         "backend",
+		imageName:     "backend",
+		expectedMatch: true,
+	}),
+	Entry("image name does not match", metaCleanupImagesPerReferenceEntry{
+		image:         "backend",
+		imageName:     "backend-worker",
+		expectedMatch: false,
+	}),
+	Entry("image regexp", metaCleanupImagesPerReferenceEntry{
+		image:         "/^backend-.*/",
+		imageName:     "backend-worker",
+		expectedMatch: true,
+	}),
+	Entry("invalid image regexp", metaCleanupImagesPerReferenceEntry{
+		image:         "/(/",
+		expectedError: true,
+	}),
+	Entry("labels of the same stage", metaCleanupImagesPerReferenceEntry{
+		labels:        map[string]string{"team": "core", "tier": "/web|api/"},
+		imageName:     "backend",
+		stagesLabels:  []map[string]string{{"team": "core"}, {"team": "core", "tier": "api"}},
+		expectedMatch: true,
+	}),
+	Entry("labels of different stages", metaCleanupImagesPerReferenceEntry{
+		labels:        map[string]string{"team": "core", "tier": "api"},
+		imageName:     "backend",
+		stagesLabels:  []map[string]string{{"team": "core"}, {"tier": "api"}},
+		expectedMatch: false,
+	}),
+	Entry("image name and labels", metaCleanupImagesPerReferenceEntry{
+		image:         "frontend",
+		labels:        map[string]string{"team": "core"},
+		imageName:     "backend",
+		stagesLabels:  []map[string]string{{"team": "core"}},
+		expectedMatch: false,
+	}),
+	Entry("invalid label regexp", metaCleanupImagesPerReferenceEntry{
+		labels:        map[string]string{"team": "/[/"},
+		expectedError: true,
+	}))
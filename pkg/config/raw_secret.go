@@ -0,0 +1,67 @@
+package config
+
+type rawSecret struct {
+	Id        string `yaml:"id,omitempty"`
+	Env       string `yaml:"env,omitempty"`
+	Src       string `yaml:"src,omitempty"`
+	Encrypted bool   `yaml:"encrypted,omitempty"`
+	Version   string `yaml:"version,omitempty"`
+
+	doc *doc `yaml:"-"` // parent image doc
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+func (c *rawSecret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	switch parent := parentStack.Peek().(type) {
+	case *rawStapelImage:
+		c.doc = parent.doc
+	case *rawImageFromDockerfile:
+		c.doc = parent.doc
+	}
+
+	type plain rawSecret
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, c.doc); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *rawSecret) toDirective() (secret *Secret, err error) {
+	secret = &Secret{}
+	secret.Id = c.Id
+	secret.Env = c.Env
+	secret.Src = c.Src
+	secret.Encrypted = c.Encrypted
+	secret.Version = c.Version
+
+	secret.raw = c
+
+	if err := secret.validate(); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func rawSecretsToDirectives(rawSecrets []*rawSecret, doc *doc) ([]*Secret, error) {
+	var secrets []*Secret
+	for _, rawSecret := range rawSecrets {
+		if secret, err := rawSecret.toDirective(); err != nil {
+			return nil, err
+		} else {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	if err := validateSecrets(secrets, doc); err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
@@ -20,6 +20,8 @@ type rawStapelImage struct {
 	RawMount         []*rawMount  `yaml:"mount,omitempty"`
 	RawDocker        *rawDocker   `yaml:"docker,omitempty"`
 	RawImport        []*rawImport `yaml:"import,omitempty"`
+	RawSecret        []*rawSecret `yaml:"secrets,omitempty"`
+	Platform         interface{}  `yaml:"platform,omitempty"`
 
 	doc *doc `yaml:"-"` // parent
 
@@ -141,6 +143,12 @@ func (c *rawStapelImage) toStapelImageDirective(giterminismManager giterminism_m
 		}
 	}
 
+	if platform, err := InterfaceToStringArray(c.Platform, nil, c.doc); err != nil {
+		return nil, err
+	} else {
+		image.Platform = platform
+	}
+
 	if err := c.validateStapelImageDirective(image); err != nil {
 		return nil, err
 	}
@@ -195,6 +203,10 @@ func (c *rawStapelImage) validateStapelImageArtifactDirective(imageArtifact *Sta
 		return newDetailedConfigError("`docker` section is not supported for artifact!", nil, c.doc)
 	}
 
+	if c.Platform != nil {
+		return newDetailedConfigError("`platform` directive is not supported for artifact!", nil, c.doc)
+	}
+
 	if err := imageArtifact.validate(); err != nil {
 		return err
 	}
@@ -280,6 +292,12 @@ func (c *rawStapelImage) toBaseStapelImageBaseDirective(giterminismManager giter
 		}
 	}
 
+	if secrets, err := rawSecretsToDirectives(c.RawSecret, c.doc); err != nil {
+		return nil, err
+	} else {
+		imageBase.Secrets = secrets
+	}
+
 	imageBase.Git = &GitManager{}
 
 	imageBase.raw = c
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var secretIdRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Secret is available only during the build (/run/secrets/ID for stapel, docker build --secret for Dockerfile) and neither stored in the image nor taken into account in the stage digest.
+// The Version is the only value of the secret, which is taken into account in the stage digest.
+type Secret struct {
+	Id        string
+	Env       string
+	Src       string
+	Encrypted bool
+	Version   string
+
+	raw *rawSecret
+}
+
+func (c *Secret) validate() error {
+	if c.Id == "" || !secretIdRegexp.MatchString(c.Id) {
+		return newDetailedConfigError(fmt.Sprintf("invalid secret `id: %s`: letters, digits, dots, underscores and hyphens expected!", c.Id), c.raw, c.raw.doc)
+	}
+
+	if (c.Env == "") == (c.Src == "") {
+		return newDetailedConfigError("one and only one of `env: NAME` or `src: PATH` required for secret!", c.raw, c.raw.doc)
+	}
+
+	if c.Encrypted && c.Src == "" {
+		return newDetailedConfigError("`encrypted: true` can be used only with `src: PATH` for secret!", c.raw, c.raw.doc)
+	}
+
+	return nil
+}
+
+func validateSecrets(secrets []*Secret, doc *doc) error {
+	exist := map[string]bool{}
+	for _, secret := range secrets {
+		if exist[secret.Id] {
+			return newDetailedConfigError(fmt.Sprintf("duplicate secret `id: %s`!", secret.Id), nil, doc)
+		}
+		exist[secret.Id] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type secretEntry struct {
+	raw           rawSecret
+	expectedError bool
+}
+
+var _ = DescribeTable("validating secret", func(e secretEntry) {
+	e.raw.doc = &doc{}
+	_, err := e.raw.toDirective()
+	if e.expectedError {
+		Ω(err).Should(HaveOccurred())
+	} else {
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+},
+	Entry("env", secretEntry{
+		raw: rawSecret{Id: "token", Env: "TOKEN"},
+	}),
+	Entry("src with version", secretEntry{
+		raw: rawSecret{Id: "npmrc", Src: "~/.npmrc", Version: "1"},
+	}),
+	Entry("encrypted src", secretEntry{
+		raw: rawSecret{Id: "key", Src: ".werf/secrets/key", Encrypted: true},
+	}),
+	Entry("no id", secretEntry{
+		raw:           rawSecret{Env: "TOKEN"},
+		expectedError: true,
+	}),
+	Entry("invalid id", secretEntry{
+		raw:           rawSecret{Id: "../token", Env: "TOKEN"},
+		expectedError: true,
+	}),
+	Entry("env and src", secretEntry{
+		raw:           rawSecret{Id: "token", Env: "TOKEN", Src: "token"},
+		expectedError: true,
+	}),
+	Entry("encrypted env", secretEntry{
+		raw:           rawSecret{Id: "token", Env: "TOKEN", Encrypted: true},
+		expectedError: true,
+	}))
@@ -8,7 +8,8 @@ import (
 
 type StapelImage struct {
 	*StapelImageBase
-	Docker *Docker
+	Docker   *Docker
+	Platform []string
 }
 
 func (c *StapelImage) validate() error {
@@ -16,6 +17,10 @@ func (c *StapelImage) validate() error {
 		return newDetailedConfigError("can not use shell and ansible builders at the same time!", nil, c.StapelImageBase.raw.doc)
 	}
 
+	if err := validatePlatforms(c.Platform, nil, c.StapelImageBase.raw.doc); err != nil {
+		return err
+	}
+
 	if c.Name == "" {
 		logboek.Context(context.Background()).Warn().LogLn("DEPRECATION WARNING: Support for the nameless image, `image: ~`, will be removed in v1.3!")
 	}
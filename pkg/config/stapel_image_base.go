@@ -21,6 +21,7 @@ type StapelImageBase struct {
 	Ansible          *Ansible
 	Mount            []*Mount
 	Import           []*Import
+	Secrets          []*Secret
 
 	raw *rawStapelImage
 }
@@ -0,0 +1,150 @@
+package container_runtime
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+func extractTarArchive(archivePath, dir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return extractTar(f, dir)
+}
+
+// extractImageFilesystem writes the flattened filesystem of the image into the dir
+func extractImageFilesystem(img v1.Image, dir string) error {
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	return extractTar(rc, dir)
+}
+
+// extractTar extracts directories, regular files, symlinks and hardlinks of the tar stream into the dir,
+// the owners are preserved only when running as root, otherwise directories are kept writable for the current user
+func extractTar(r io.Reader, dir string) error {
+	dir = filepath.Clean(dir)
+	preserveOwners := os.Geteuid() == 0
+
+	type dirMode struct {
+		path string
+		mode os.FileMode
+	}
+	var dirModes []dirMode
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		path, err := archiveEntryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeDir {
+			if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+				return err
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, os.FileMode(header.Mode)|0700); err != nil {
+				return err
+			}
+
+			// directory permissions are set at the end, so that read-only directories do not prevent the extraction
+			mode := header.FileInfo().Mode().Perm()
+			if !preserveOwners {
+				mode |= 0700
+			}
+			dirModes = append(dirModes, dirMode{path: path, mode: mode})
+		case tar.TypeSymlink:
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			linkPath, err := archiveEntryPath(dir, header.Linkname)
+			if err != nil {
+				return err
+			}
+
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+
+			if err := os.Link(linkPath, path); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+
+			if err := func() error {
+				out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+				if err != nil {
+					return err
+				}
+				defer out.Close()
+
+				_, err = io.Copy(out, tr)
+				return err
+			}(); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+
+		if preserveOwners {
+			if err := os.Lchown(path, header.Uid, header.Gid); err != nil {
+				return err
+			}
+		}
+
+		// the mode is set after the owner, because chown resets the setuid and setgid bits
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+			mode := header.FileInfo().Mode()
+			if err := os.Chmod(path, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(dirModes) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirModes[i].path, dirModes[i].mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func archiveEntryPath(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	if path != dir && !strings.HasPrefix(path, dir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal archive entry path %q", name)
+	}
+
+	return path, nil
+}
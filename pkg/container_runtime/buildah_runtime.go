@@ -0,0 +1,590 @@
+package container_runtime
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/uuid"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/build/import_server"
+	"github.com/werf/werf/pkg/buildah"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/stapel"
+	"github.com/werf/werf/pkg/werf"
+)
+
+// BuildahRuntime builds images without a docker daemon and keeps them in the local containers-storage.
+// Stapel stages are built with buildah from/run/commit, the stapel toolchain is extracted from the stapel image into the local cache dir
+// and mounted into the stage containers instead of the volumes from the stapel docker container.
+type BuildahRuntime struct{}
+
+func (runtime *BuildahRuntime) GetImageInspect(ctx context.Context, ref string) (*types.ImageInspect, error) {
+	return buildah.ImageInspect(ctx, ref)
+}
+
+func (runtime *BuildahRuntime) PullImage(ctx context.Context, ref string) error {
+	if err := buildah.CliPull(ctx, ref); err != nil {
+		return fmt.Errorf("unable to pull image %s: %s", ref, err)
+	}
+
+	return nil
+}
+
+func (runtime *BuildahRuntime) RefreshImageObject(ctx context.Context, img Image) error {
+	dockerImage := img.(*DockerImage)
+
+	if inspect, err := runtime.GetImageInspect(ctx, dockerImage.Image.Name()); err != nil {
+		return err
+	} else {
+		dockerImage.Image.SetInspect(inspect)
+	}
+	return nil
+}
+
+func (runtime *BuildahRuntime) RenameImage(ctx context.Context, img Image, newImageName string, removeOldName bool) error {
+	dockerImage := img.(*DockerImage)
+
+	if err := logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Tagging image %s by name %s", dockerImage.Image.Name(), newImageName)).DoError(func() error {
+		if err := buildah.CliTag(ctx, dockerImage.Image.Name(), newImageName); err != nil {
+			return fmt.Errorf("unable to tag image %s by name %s: %s", dockerImage.Image.Name(), newImageName, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if removeOldName {
+		if err := logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Removing old image tag %s", dockerImage.Image.Name())).DoError(func() error {
+			return buildah.CliRmi(ctx, dockerImage.Image.Name())
+		}); err != nil {
+			return err
+		}
+	}
+
+	dockerImage.Image.SetName(newImageName)
+
+	return nil
+}
+
+func (runtime *BuildahRuntime) RemoveImage(ctx context.Context, img Image) error {
+	dockerImage := img.(*DockerImage)
+
+	return logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Removing image tag %s", dockerImage.Image.Name())).DoError(func() error {
+		return buildah.CliRmi(ctx, dockerImage.Image.Name())
+	})
+}
+
+func (runtime *BuildahRuntime) PullImageFromRegistry(ctx context.Context, img Image) error {
+	dockerImage := img.(*DockerImage)
+
+	if err := runtime.PullImage(ctx, dockerImage.Image.Name()); err != nil {
+		return err
+	}
+
+	if inspect, err := runtime.GetImageInspect(ctx, dockerImage.Image.Name()); err != nil {
+		return fmt.Errorf("unable to get inspect of image %s: %s", dockerImage.Image.Name(), err)
+	} else {
+		dockerImage.Image.SetInspect(inspect)
+	}
+
+	return nil
+}
+
+func (runtime *BuildahRuntime) PushImage(ctx context.Context, img Image) error {
+	dockerImage := img.(*DockerImage)
+
+	return logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Pushing %s", dockerImage.Image.Name())).DoError(func() error {
+		return buildah.CliPush(ctx, dockerImage.Image.Name(), fmt.Sprintf("docker://%s", dockerImage.Image.Name()))
+	})
+}
+
+func (runtime *BuildahRuntime) PushBuiltImage(ctx context.Context, img Image) error {
+	dockerImage := img.(*DockerImage)
+
+	if err := logboek.Context(ctx).Info().LogProcess(fmt.Sprintf("Tagging built image by name %s", dockerImage.Image.Name())).DoError(func() error {
+		if err := dockerImage.Image.TagBuiltImage(ctx); err != nil {
+			return fmt.Errorf("unable to tag built image by name %s: %s", dockerImage.Image.Name(), err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return runtime.PushImage(ctx, img)
+}
+
+// SaveImageToArchive writes the image in the docker save format, which is used by the s3 and OCI layout stages storages
+func (runtime *BuildahRuntime) SaveImageToArchive(ctx context.Context, ref, archivePath string) error {
+	if err := buildah.CliPush(ctx, ref, fmt.Sprintf("docker-archive:%s:%s", archivePath, ref)); err != nil {
+		return fmt.Errorf("unable to save image %s: %s", ref, err)
+	}
+
+	return nil
+}
+
+// LoadImageFromArchive imports the image from the archive in the docker save format by the reference stored in the archive
+func (runtime *BuildahRuntime) LoadImageFromArchive(ctx context.Context, archivePath string) error {
+	if err := buildah.CliPull(ctx, fmt.Sprintf("docker-archive:%s", archivePath)); err != nil {
+		return fmt.Errorf("unable to load image archive %s: %s", archivePath, err)
+	}
+
+	return nil
+}
+
+func (runtime *BuildahRuntime) TagImageByRef(ctx context.Context, ref, newRef string) error {
+	return buildah.CliTag(ctx, buildahImageRef(ref), newRef)
+}
+
+// PullImageWithRetries relies on the retries of buildah itself
+func (runtime *BuildahRuntime) PullImageWithRetries(ctx context.Context, ref string) error {
+	return runtime.PullImage(ctx, ref)
+}
+
+// PushImageWithRetries relies on the retries of buildah itself
+func (runtime *BuildahRuntime) PushImageWithRetries(ctx context.Context, ref string) error {
+	return buildah.CliPush(ctx, ref, fmt.Sprintf("docker://%s", ref))
+}
+
+func (runtime *BuildahRuntime) ForceRemoveImage(ctx context.Context, ref string) error {
+	return buildah.CliRmi(ctx, "--force", buildahImageRef(ref))
+}
+
+// BuildDockerfileImage passes the same arguments to buildah bud, which cannot read the build context archive from stdin,
+// so the archive is extracted into the temporary context dir
+func (runtime *BuildahRuntime) BuildDockerfileImage(ctx context.Context, buildArgs []string, contextArchivePath string) error {
+	contextDir := "."
+	if contextArchivePath != "" {
+		tmpDir, err := ioutil.TempDir(werf.GetTmpDir(), "werf-buildah-context-")
+		if err != nil {
+			return fmt.Errorf("unable to create tmp dir: %s", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if err := extractTarArchive(contextArchivePath, tmpDir); err != nil {
+			return fmt.Errorf("unable to extract build context archive %s: %s", contextArchivePath, err)
+		}
+
+		contextDir = tmpDir
+	}
+
+	budArgs := prepareBuildahBudArgs(buildArgs, contextDir)
+
+	if debugDockerRunCommand() {
+		fmt.Printf("Buildah run command:\nbuildah bud %s\n", strings.Join(budArgs, " "))
+	}
+
+	return buildah.CliBud_LiveOutput(ctx, budArgs...)
+}
+
+func prepareBuildahBudArgs(buildArgs []string, contextDir string) []string {
+	var args []string
+	for _, arg := range buildArgs {
+		// the dockerfile path is relative to the build context as in the docker build
+		if strings.HasPrefix(arg, "--file=") && !filepath.IsAbs(strings.TrimPrefix(arg, "--file=")) {
+			arg = fmt.Sprintf("--file=%s", filepath.Join(contextDir, strings.TrimPrefix(arg, "--file=")))
+		}
+		args = append(args, arg)
+	}
+
+	return append(args, contextDir)
+}
+
+// PrepareStapel extracts the stapel toolchain from the stapel image into the local cache dir once
+func (runtime *BuildahRuntime) PrepareStapel(ctx context.Context) error {
+	_, err := runtime.getStapelDir(ctx)
+	return err
+}
+
+func (runtime *BuildahRuntime) getStapelDir(ctx context.Context) (string, error) {
+	stapelDir := filepath.Join(werf.GetLocalCacheDir(), "stapel", strings.NewReplacer("/", "_", ":", "_").Replace(stapel.ImageName()))
+
+	lockName := fmt.Sprintf("stapel_dir.%s", stapel.ImageName())
+	if _, lock, err := werf.AcquireHostLock(ctx, lockName, lockgate.AcquireOptions{}); err != nil {
+		return "", fmt.Errorf("failed to lock %s: %s", lockName, err)
+	} else {
+		defer werf.ReleaseHostLock(lock)
+	}
+
+	if _, err := os.Stat(stapelDir); err == nil {
+		return stapelDir, nil
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("unable to access %s: %s", stapelDir, err)
+	}
+
+	if err := logboek.Context(ctx).Default().LogProcess("Preparing stapel %s", stapel.ImageName()).DoError(func() error {
+		if inspect, err := runtime.GetImageInspect(ctx, stapel.ImageName()); err != nil {
+			return err
+		} else if inspect == nil {
+			if err := runtime.PullImage(ctx, stapel.ImageName()); err != nil {
+				return err
+			}
+		}
+
+		tmpDir := stapelDir + ".tmp"
+		if err := os.RemoveAll(tmpDir); err != nil {
+			return fmt.Errorf("unable to remove %s: %s", tmpDir, err)
+		}
+
+		if err := runtime.exportImageFilesystem(ctx, stapel.ImageName(), tmpDir); err != nil {
+			return err
+		}
+
+		return os.Rename(tmpDir, stapelDir)
+	}); err != nil {
+		return "", fmt.Errorf("unable to prepare stapel dir %s: %s", stapelDir, err)
+	}
+
+	return stapelDir, nil
+}
+
+// exportImageFilesystem writes the flattened filesystem of the local image into the dir
+func (runtime *BuildahRuntime) exportImageFilesystem(ctx context.Context, ref, dir string) error {
+	tmpDir, err := ioutil.TempDir(werf.GetTmpDir(), "werf-buildah-export-")
+	if err != nil {
+		return fmt.Errorf("unable to create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, "image.tar")
+	if err := buildah.CliPush(ctx, buildahImageRef(ref), fmt.Sprintf("docker-archive:%s", archivePath)); err != nil {
+		return fmt.Errorf("unable to save image %s: %s", ref, err)
+	}
+
+	img, err := tarball.ImageFromPath(archivePath, nil)
+	if err != nil {
+		return fmt.Errorf("unable to read image %s archive: %s", ref, err)
+	}
+
+	if err := extractImageFilesystem(img, dir); err != nil {
+		return fmt.Errorf("unable to extract image %s filesystem: %s", ref, err)
+	}
+
+	return nil
+}
+
+func (runtime *BuildahRuntime) RunStageContainer(ctx context.Context, container *StageImageContainer) error {
+	stapelDir, err := runtime.getStapelDir(ctx)
+	if err != nil {
+		return err
+	}
+
+	runOptions, err := container.prepareRunOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	runArgs, err := prepareBuildahRunArgs(runOptions, stapelDir, container.columnsEnv(ctx))
+	if err != nil {
+		return err
+	}
+
+	if err := createVolumesHostDirs(runOptions.Volume); err != nil {
+		return err
+	}
+
+	if _, err := buildah.CliFrom_RecordedOutput(ctx, fmt.Sprintf("--name=%s", container.Name()), buildahImageRef(container.image.fromImage.GetID())); err != nil {
+		return fmt.Errorf("unable to create container %s: %s", container.Name(), err)
+	}
+
+	runArgs = append(runArgs, container.Name(), "--", stapel.BashBinPath(), "-ec", container.prepareRunCommand())
+
+	if debugDockerRunCommand() {
+		fmt.Printf("Buildah run command:\nbuildah run %s\n", strings.Join(runArgs, " "))
+
+		if len(container.prepareAllRunCommands()) != 0 {
+			fmt.Printf("Decoded command:\n%s\n", strings.Join(container.prepareAllRunCommands(), " && "))
+		}
+	}
+
+	if err := buildah.CliRun_LiveOutput(ctx, runArgs...); err != nil {
+		return fmt.Errorf("container run failed: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (runtime *BuildahRuntime) CommitStageContainer(ctx context.Context, container *StageImageContainer) (string, error) {
+	commitOptions, err := container.prepareCommitOptions(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if configArgs := prepareBuildahConfigArgs(commitOptions); len(configArgs) != 0 {
+		if err := buildah.CliConfig(ctx, append(configArgs, container.Name())...); err != nil {
+			return "", fmt.Errorf("unable to configure container %s: %s", container.Name(), err)
+		}
+	}
+
+	imageId, err := buildah.CliCommit_RecordedOutput(ctx, container.Name())
+	if err != nil {
+		return "", fmt.Errorf("unable to commit container %s: %s", container.Name(), err)
+	}
+
+	return imageId, nil
+}
+
+func (runtime *BuildahRuntime) RemoveStageContainer(ctx context.Context, containerName string, force bool) error {
+	if force {
+		if exist, err := buildah.ContainerExist(ctx, containerName); err != nil {
+			return fmt.Errorf("unable to check container %s existence: %s", containerName, err)
+		} else if !exist {
+			return nil
+		}
+	}
+
+	return buildah.CliRm(ctx, containerName)
+}
+
+func (runtime *BuildahRuntime) IntrospectStageContainer(ctx context.Context, container *StageImageContainer, imageId string) error {
+	stapelDir, err := runtime.getStapelDir(ctx)
+	if err != nil {
+		return err
+	}
+
+	runOptions, err := container.prepareRunOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	runArgs, err := prepareBuildahRunArgs(runOptions, stapelDir)
+	if err != nil {
+		return err
+	}
+
+	return runtime.withTemporaryContainer(ctx, imageId, func(containerName string) error {
+		if err := buildah.CliRun_Interactive(ctx, append(runArgs, containerName, "--", stapel.BashBinPath())...); err != nil {
+			// the exit code of the last command in the interactive shell is not the introspection error
+			if !strings.Contains(err.Error(), "exit status") {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (runtime *BuildahRuntime) RunStapelScript(ctx context.Context, ref string, volumes []string, scriptPath string) error {
+	stapelDir, err := runtime.getStapelDir(ctx)
+	if err != nil {
+		return err
+	}
+
+	runOptions := newStageContainerOptions()
+	runOptions.User = "0:0"
+	runOptions.Workdir = "/"
+	runOptions.VolumesFrom = []string{stapel.ContainerName()}
+	runOptions.Volume = volumes
+
+	runArgs, err := prepareBuildahRunArgs(runOptions, stapelDir)
+	if err != nil {
+		return err
+	}
+
+	if err := createVolumesHostDirs(volumes); err != nil {
+		return err
+	}
+
+	return runtime.withTemporaryContainer(ctx, ref, func(containerName string) error {
+		if output, err := buildah.CliRun_RecordedOutput(ctx, append(runArgs, containerName, "--", stapel.BashBinPath(), scriptPath)...); err != nil {
+			logboek.Context(ctx).Error().LogF("%s", output)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// RunImportServer exports the image filesystem into the tmpDir, which is mounted into the stage containers
+func (runtime *BuildahRuntime) RunImportServer(ctx context.Context, ref, tmpDir string) (import_server.ImportServer, error) {
+	hostDir := filepath.Join(tmpDir, "rootfs")
+	if err := runtime.exportImageFilesystem(ctx, ref, hostDir); err != nil {
+		return nil, err
+	}
+
+	return import_server.NewLocalDirServer(hostDir), nil
+}
+
+func (runtime *BuildahRuntime) withTemporaryContainer(ctx context.Context, ref string, f func(containerName string) error) error {
+	containerName := fmt.Sprintf("%s%s", image.StageContainerNamePrefix, uuid.New().String())
+	if _, err := buildah.CliFrom_RecordedOutput(ctx, fmt.Sprintf("--name=%s", containerName), buildahImageRef(ref)); err != nil {
+		return fmt.Errorf("unable to create container from image %s: %s", ref, err)
+	}
+
+	defer func() {
+		if err := buildah.CliRm(ctx, containerName); err != nil {
+			logboek.Context(ctx).Warn().LogF("WARNING: unable to remove container %s: %s\n", containerName, err)
+		}
+	}()
+
+	return f(containerName)
+}
+
+// prepareBuildahRunArgs converts the docker run options to the buildah run options,
+// the volumes from the stapel container are replaced with the stapel toolchain dir mount
+func prepareBuildahRunArgs(runOptions *StageImageContainerOptions, stapelDir string, envs ...string) ([]string, error) {
+	var args []string
+
+	for _, volume := range runOptions.Volume {
+		args = append(args, fmt.Sprintf("--volume=%s", volume))
+	}
+
+	var mountStapel bool
+	var stapelMountMode string
+	for _, volumesFrom := range runOptions.VolumesFrom {
+		parts := strings.SplitN(volumesFrom, ":", 2)
+		if parts[0] != stapel.ContainerName() {
+			return nil, fmt.Errorf("volumes from the container %q are not supported by the buildah container runtime", parts[0])
+		}
+
+		// the latest mode is used as in the docker run
+		mountStapel = true
+		stapelMountMode = ""
+		if len(parts) == 2 {
+			stapelMountMode = parts[1]
+		}
+	}
+
+	if mountStapel {
+		stapelVolume := fmt.Sprintf("%s:%s", filepath.Join(stapelDir, stapel.Volume()), stapel.Volume())
+		if stapelMountMode != "" {
+			stapelVolume += ":" + stapelMountMode
+		}
+		args = append(args, fmt.Sprintf("--volume=%s", stapelVolume))
+	}
+
+	for _, key := range sortedKeys(runOptions.Env) {
+		args = append(args, fmt.Sprintf("--env=%s=%s", key, runOptions.Env[key]))
+	}
+
+	for _, env := range envs {
+		args = append(args, fmt.Sprintf("--env=%s", env))
+	}
+
+	if runOptions.User != "" {
+		args = append(args, fmt.Sprintf("--user=%s", runOptions.User))
+	}
+
+	if runOptions.Workdir != "" {
+		args = append(args, fmt.Sprintf("--workingdir=%s", runOptions.Workdir))
+	}
+
+	return args, nil
+}
+
+// prepareBuildahConfigArgs converts the commit changes to the buildah config options,
+// the empty entrypoint and cmd are not set, because the working container does not inherit them from the stapel run
+func prepareBuildahConfigArgs(commitOptions *StageImageContainerOptions) []string {
+	var args []string
+
+	for _, volume := range commitOptions.Volume {
+		args = append(args, fmt.Sprintf("--volume=%s", volume))
+	}
+
+	for _, expose := range commitOptions.Expose {
+		args = append(args, fmt.Sprintf("--port=%s", expose))
+	}
+
+	for _, key := range sortedKeys(commitOptions.Env) {
+		args = append(args, fmt.Sprintf("--env=%s=%s", key, commitOptions.Env[key]))
+	}
+
+	for _, key := range sortedKeys(commitOptions.Label) {
+		args = append(args, fmt.Sprintf("--label=%s=%s", key, commitOptions.Label[key]))
+	}
+
+	if commitOptions.Workdir != "" {
+		args = append(args, fmt.Sprintf("--workingdir=%s", commitOptions.Workdir))
+	}
+
+	if commitOptions.User != "" {
+		args = append(args, fmt.Sprintf("--user=%s", commitOptions.User))
+	}
+
+	if commitOptions.Entrypoint != "" {
+		args = append(args, fmt.Sprintf("--entrypoint=%s", commitOptions.Entrypoint))
+	}
+
+	if commitOptions.Cmd != "" {
+		args = append(args, fmt.Sprintf("--cmd=%s", commitOptions.Cmd))
+	}
+
+	if commitOptions.HealthCheck != "" {
+		args = append(args, prepareBuildahHealthcheckArgs(commitOptions.HealthCheck)...)
+	}
+
+	return args
+}
+
+// prepareBuildahHealthcheckArgs converts the HEALTHCHECK instruction options (e.g. --interval=5s) to the separate buildah config options
+func prepareBuildahHealthcheckArgs(healthcheck string) []string {
+	var args []string
+
+	rest := strings.TrimSpace(healthcheck)
+	for strings.HasPrefix(rest, "--") {
+		parts := strings.SplitN(rest, " ", 2)
+		args = append(args, fmt.Sprintf("--healthcheck-%s", strings.TrimPrefix(parts[0], "--")))
+
+		rest = ""
+		if len(parts) == 2 {
+			rest = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if rest != "" {
+		args = append(args, fmt.Sprintf("--healthcheck=%s", rest))
+	}
+
+	return args
+}
+
+// createVolumesHostDirs creates missing host dirs of the volumes as the docker run does
+func createVolumesHostDirs(volumes []string) error {
+	for _, volume := range volumes {
+		hostPath := strings.SplitN(volume, ":", 2)[0]
+		if !filepath.IsAbs(hostPath) {
+			continue
+		}
+
+		if _, err := os.Stat(hostPath); os.IsNotExist(err) {
+			if err := os.MkdirAll(hostPath, os.ModePerm); err != nil {
+				return fmt.Errorf("unable to create volume host dir %s: %s", hostPath, err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("unable to access volume host path %s: %s", hostPath, err)
+		}
+	}
+
+	return nil
+}
+
+// buildahImageRef trims the digest algorithm of the image id, buildah resolves the local images by the hex ids
+func buildahImageRef(ref string) string {
+	if id := strings.TrimPrefix(ref, "sha256:"); id != ref && len(id) == 64 {
+		return id
+	}
+
+	return ref
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (runtime *BuildahRuntime) String() string {
+	return "buildah"
+}
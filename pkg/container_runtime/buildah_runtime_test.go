@@ -0,0 +1,206 @@
+package container_runtime
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/werf/werf/pkg/stapel"
+)
+
+func TestPrepareBuildahRunArgs(t *testing.T) {
+	runOptions := newStageContainerOptions()
+	runOptions.Workdir = "/"
+	runOptions.User = "0:0"
+	runOptions.AddVolume("/host/tmp:/.werf/tmp:rw")
+	runOptions.AddVolumeFrom(stapel.ContainerName(), stapel.ContainerName()+":ro")
+	runOptions.AddEnv(map[string]string{"B": "2", "A": "1"})
+
+	args, err := prepareBuildahRunArgs(runOptions, "/cache/stapel", "COLUMNS=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"--volume=/host/tmp:/.werf/tmp:rw",
+		"--volume=/cache/stapel/.werf/stapel:/.werf/stapel:ro",
+		"--env=A=1",
+		"--env=B=2",
+		"--env=COLUMNS=100",
+		"--user=0:0",
+		"--workingdir=/",
+	}
+
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args:\n%v\ngot:\n%v", expected, args)
+	}
+
+	runOptions.AddVolumeFrom("other")
+	if _, err := prepareBuildahRunArgs(runOptions, "/cache/stapel"); err == nil {
+		t.Errorf("expected error for the volumes from the container other than stapel")
+	}
+}
+
+func TestPrepareBuildahConfigArgs(t *testing.T) {
+	commitOptions := newStageContainerOptions()
+	commitOptions.AddVolume("/data")
+	commitOptions.AddExpose("80/tcp")
+	commitOptions.AddEnv(map[string]string{"PATH": "/bin"})
+	commitOptions.AddLabel(map[string]string{"werf-stage-digest": "digest", "app": "web"})
+	commitOptions.AddWorkdir("/app")
+	commitOptions.AddUser("app")
+	commitOptions.AddEntrypoint(`["/entrypoint.sh"]`)
+	commitOptions.AddCmd(`["run"]`)
+	commitOptions.AddHealthCheck("--interval=5s --retries=3 CMD curl -f http://localhost/")
+
+	expected := []string{
+		"--volume=/data",
+		"--port=80/tcp",
+		"--env=PATH=/bin",
+		"--label=app=web",
+		"--label=werf-stage-digest=digest",
+		"--workingdir=/app",
+		"--user=app",
+		`--entrypoint=["/entrypoint.sh"]`,
+		`--cmd=["run"]`,
+		"--healthcheck-interval=5s",
+		"--healthcheck-retries=3",
+		"--healthcheck=CMD curl -f http://localhost/",
+	}
+
+	if args := prepareBuildahConfigArgs(commitOptions); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args:\n%v\ngot:\n%v", expected, args)
+	}
+
+	if args := prepareBuildahConfigArgs(newStageContainerOptions()); len(args) != 0 {
+		t.Errorf("expected empty entrypoint and cmd not to be configured, got %v", args)
+	}
+}
+
+func TestPrepareBuildahBudArgs(t *testing.T) {
+	args := prepareBuildahBudArgs([]string{"--file=docker/Dockerfile", "--file=/abs/Dockerfile", "--target=app"}, "/tmp/context")
+
+	expected := []string{"--file=/tmp/context/docker/Dockerfile", "--file=/abs/Dockerfile", "--target=app", "/tmp/context"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args %v, got %v", expected, args)
+	}
+}
+
+func TestBuildahImageRef(t *testing.T) {
+	id := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	for ref, expected := range map[string]string{
+		"sha256:" + id:     id,
+		id:                 id,
+		"sha256:short":     "sha256:short",
+		"registry/app:tag": "registry/app:tag",
+		"app@sha256:" + id: "app@sha256:" + id,
+	} {
+		if got := buildahImageRef(ref); got != expected {
+			t.Errorf("%s: expected %s, got %s", ref, expected, got)
+		}
+	}
+}
+
+type testTarEntry struct {
+	header  tar.Header
+	content string
+}
+
+func newTestLayer(t *testing.T, entries ...testTarEntry) v1.Layer {
+	buf := bytes.Buffer{}
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.content))
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return layer
+}
+
+func TestExtractImageFilesystem(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image,
+		newTestLayer(t,
+			testTarEntry{header: tar.Header{Name: ".werf/stapel/bin/", Typeflag: tar.TypeDir, Mode: 0755}},
+			testTarEntry{header: tar.Header{Name: ".werf/stapel/bin/bash", Typeflag: tar.TypeReg, Mode: 0755}, content: "bash"},
+			testTarEntry{header: tar.Header{Name: ".werf/stapel/bin/sh", Typeflag: tar.TypeSymlink, Linkname: "bash"}},
+			testTarEntry{header: tar.Header{Name: ".werf/stapel/bin/rbash", Typeflag: tar.TypeLink, Linkname: ".werf/stapel/bin/bash"}},
+			testTarEntry{header: tar.Header{Name: "removed", Typeflag: tar.TypeReg, Mode: 0644}, content: "removed"},
+		),
+		newTestLayer(t,
+			testTarEntry{header: tar.Header{Name: ".wh.removed", Typeflag: tar.TypeReg, Mode: 0644}},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := extractImageFilesystem(img, dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	bashPath := filepath.Join(dir, ".werf/stapel/bin/bash")
+	if data, err := ioutil.ReadFile(bashPath); err != nil || string(data) != "bash" {
+		t.Errorf("expected bash file content, got %q: %v", data, err)
+	}
+
+	if info, err := os.Stat(bashPath); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("expected executable bash file, got %v: %v", info, err)
+	}
+
+	if link, err := os.Readlink(filepath.Join(dir, ".werf/stapel/bin/sh")); err != nil || link != "bash" {
+		t.Errorf("expected symlink to bash, got %q: %v", link, err)
+	}
+
+	bashInfo, _ := os.Stat(bashPath)
+	if info, err := os.Stat(filepath.Join(dir, ".werf/stapel/bin/rbash")); err != nil || !os.SameFile(info, bashInfo) {
+		t.Errorf("expected hardlink to bash: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "removed")); !os.IsNotExist(err) {
+		t.Errorf("expected file removed by the upper layer not to be extracted, got %v", err)
+	}
+}
+
+func TestExtractTarIllegalPath(t *testing.T) {
+	buf := bytes.Buffer{}
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+
+	if err := extractTar(&buf, t.TempDir()); err == nil {
+		t.Errorf("expected error for the entry outside of the dir")
+	}
+}
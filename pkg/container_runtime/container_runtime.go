@@ -3,26 +3,67 @@ package container_runtime
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 
 	"github.com/werf/logboek"
 
+	"github.com/werf/werf/pkg/build/import_server"
 	"github.com/werf/werf/pkg/docker"
+	"github.com/werf/werf/pkg/stapel"
 )
 
 type ContainerRuntime interface {
+	// GetImageInspect returns nil if the image does not exist locally
+	GetImageInspect(ctx context.Context, ref string) (*types.ImageInspect, error)
+	PullImage(ctx context.Context, ref string) error
 	RefreshImageObject(ctx context.Context, img Image) error
 	PullImageFromRegistry(ctx context.Context, img Image) error
+	PushImage(ctx context.Context, img Image) error
+	// PushBuiltImage tags the image built by the current process by the image name and pushes it
+	PushBuiltImage(ctx context.Context, img Image) error
 	RenameImage(ctx context.Context, img Image, newImageName string, removeOldName bool) error
 	RemoveImage(ctx context.Context, img Image) error
 	String() string
+
+	// TagImageByRef, PullImageWithRetries and PushImageWithRetries work with the stage images by references,
+	// the registry operations are retried on the transient errors
+	TagImageByRef(ctx context.Context, ref, newRef string) error
+	PullImageWithRetries(ctx context.Context, ref string) error
+	PushImageWithRetries(ctx context.Context, ref string) error
+	// ForceRemoveImage removes the image by the reference even if the image has other tags
+	ForceRemoveImage(ctx context.Context, ref string) error
+
+	// SaveImageToArchive and LoadImageFromArchive use the docker save format, which is used by the s3 and OCI layout stages storages
+	SaveImageToArchive(ctx context.Context, ref, archivePath string) error
+	// LoadImageFromArchive imports the image by the reference stored in the archive
+	LoadImageFromArchive(ctx context.Context, archivePath string) error
+
+	// BuildDockerfileImage builds the image with the docker build args, the build context is read from the archive if specified
+	BuildDockerfileImage(ctx context.Context, buildArgs []string, contextArchivePath string) error
+
+	// PrepareStapel makes the stapel toolchain available for the stage containers
+	PrepareStapel(ctx context.Context) error
+	// RunStageContainer runs the commands of the stapel stage container based on the from image
+	RunStageContainer(ctx context.Context, container *StageImageContainer) error
+	// CommitStageContainer applies the commit changes of the stapel stage container and returns the built image id
+	CommitStageContainer(ctx context.Context, container *StageImageContainer) (string, error)
+	// RemoveStageContainer removes the stapel stage container, with force the running container is killed and a missing container is ignored
+	RemoveStageContainer(ctx context.Context, containerName string, force bool) error
+	// IntrospectStageContainer runs the interactive stapel bash in the temporary container based on the image with the run options of the stage container
+	IntrospectStageContainer(ctx context.Context, container *StageImageContainer, imageId string) error
+	// RunStapelScript runs the script by the stapel bash in the temporary container based on the image
+	RunStapelScript(ctx context.Context, ref string, volumes []string, scriptPath string) error
+	// RunImportServer serves the filesystem of the image for the import copy commands of the stage containers
+	RunImportServer(ctx context.Context, ref, tmpDir string) (import_server.ImportServer, error)
 }
 
 type LocalDockerServerRuntime struct{}
 
-// GetImageInspect only available for LocalDockerServerRuntime
 func (runtime *LocalDockerServerRuntime) GetImageInspect(ctx context.Context, ref string) (*types.ImageInspect, error) {
 	inspect, err := docker.ImageInspect(ctx, ref)
 	if client.IsErrNotFound(err) {
@@ -31,7 +72,6 @@ func (runtime *LocalDockerServerRuntime) GetImageInspect(ctx context.Context, re
 	return inspect, err
 }
 
-// PullImage only available for LocalDockerServerRuntime
 func (runtime *LocalDockerServerRuntime) PullImage(ctx context.Context, ref string) error {
 	if err := docker.CliPull(ctx, ref); err != nil {
 		return fmt.Errorf("unable to pull image %s: %s", ref, err)
@@ -122,7 +162,6 @@ func (runtime *LocalDockerServerRuntime) PushImage(ctx context.Context, img Imag
 	return nil
 }
 
-// PushBuiltImage is only available for LocalDockerServerRuntime
 func (runtime *LocalDockerServerRuntime) PushBuiltImage(ctx context.Context, img Image) error {
 	dockerImage := img.(*DockerImage)
 
@@ -144,7 +183,7 @@ func (runtime *LocalDockerServerRuntime) PushBuiltImage(ctx context.Context, img
 	return nil
 }
 
-// TagBuiltImageByName is only available for LocalDockerServerRuntime
+// TagImageByName is only available for LocalDockerServerRuntime
 func (runtime *LocalDockerServerRuntime) TagImageByName(ctx context.Context, img Image) error {
 	dockerImage := img.(*DockerImage)
 
@@ -161,6 +200,192 @@ func (runtime *LocalDockerServerRuntime) TagImageByName(ctx context.Context, img
 	return nil
 }
 
+func (runtime *LocalDockerServerRuntime) TagImageByRef(ctx context.Context, ref, newRef string) error {
+	return docker.CliTag(ctx, ref, newRef)
+}
+
+func (runtime *LocalDockerServerRuntime) PullImageWithRetries(ctx context.Context, ref string) error {
+	return docker.CliPullWithRetries(ctx, ref)
+}
+
+func (runtime *LocalDockerServerRuntime) PushImageWithRetries(ctx context.Context, ref string) error {
+	return docker.CliPushWithRetries(ctx, ref)
+}
+
+func (runtime *LocalDockerServerRuntime) ForceRemoveImage(ctx context.Context, ref string) error {
+	return docker.CliRmi(ctx, ref, "--force")
+}
+
+func (runtime *LocalDockerServerRuntime) SaveImageToArchive(ctx context.Context, ref, archivePath string) error {
+	if err := func() error {
+		rc, err := docker.ImageSave(ctx, ref)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		f, err := os.Create(archivePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(f, rc)
+		return err
+	}(); err != nil {
+		return fmt.Errorf("unable to save image %s: %s", ref, err)
+	}
+
+	return nil
+}
+
+func (runtime *LocalDockerServerRuntime) LoadImageFromArchive(ctx context.Context, archivePath string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("unable to open image archive %s: %s", archivePath, err)
+	}
+	defer f.Close()
+
+	if err := docker.ImageLoad(ctx, f); err != nil {
+		return fmt.Errorf("unable to load image archive %s: %s", archivePath, err)
+	}
+
+	return nil
+}
+
+func (runtime *LocalDockerServerRuntime) BuildDockerfileImage(ctx context.Context, buildArgs []string, contextArchivePath string) error {
+	if contextArchivePath != "" {
+		buildArgs = append(buildArgs, "-")
+
+		f, err := os.Open(contextArchivePath)
+		if err != nil {
+			return fmt.Errorf("unable to open file: %s", err)
+		}
+		defer f.Close()
+
+		if debugDockerRunCommand() {
+			fmt.Printf("Docker run command:\ndocker build %s < %s\n", strings.Join(buildArgs, " "), contextArchivePath)
+		}
+
+		return docker.CliBuild_LiveOutputWithCustomIn(ctx, f, buildArgs...)
+	}
+
+	if debugDockerRunCommand() {
+		fmt.Printf("Docker run command:\ndocker build %s\n", strings.Join(buildArgs, " "))
+	}
+
+	return docker.CliBuild_LiveOutput(ctx, buildArgs...)
+}
+
+func (runtime *LocalDockerServerRuntime) PrepareStapel(ctx context.Context) error {
+	if _, err := stapel.GetOrCreateContainer(ctx); err != nil {
+		return fmt.Errorf("get or create stapel container failed: %s", err)
+	}
+
+	return nil
+}
+
+func (runtime *LocalDockerServerRuntime) RunStageContainer(ctx context.Context, container *StageImageContainer) error {
+	if err := runtime.PrepareStapel(ctx); err != nil {
+		return err
+	}
+
+	runArgs, err := container.prepareDockerRunArgs(ctx)
+	if err != nil {
+		return err
+	}
+
+	if debugDockerRunCommand() {
+		fmt.Printf("Docker run command:\ndocker run %s\n", strings.Join(runArgs, " "))
+
+		if len(container.prepareAllRunCommands()) != 0 {
+			fmt.Printf("Decoded command:\n%s\n", strings.Join(container.prepareAllRunCommands(), " && "))
+		}
+	}
+
+	if err := docker.CliRun_LiveOutput(ctx, runArgs...); err != nil {
+		return fmt.Errorf("container run failed: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (runtime *LocalDockerServerRuntime) CommitStageContainer(ctx context.Context, container *StageImageContainer) (string, error) {
+	commitChanges, err := container.prepareCommitChanges(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	commitOptions := types.ContainerCommitOptions{Changes: commitChanges}
+	return docker.ContainerCommit(ctx, container.Name(), commitOptions)
+}
+
+func (runtime *LocalDockerServerRuntime) RemoveStageContainer(ctx context.Context, containerName string, force bool) error {
+	if err := docker.ContainerRemove(ctx, containerName, types.ContainerRemoveOptions{Force: force}); err != nil {
+		if force && client.IsErrNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (runtime *LocalDockerServerRuntime) IntrospectStageContainer(ctx context.Context, container *StageImageContainer, imageId string) error {
+	if err := runtime.PrepareStapel(ctx); err != nil {
+		return err
+	}
+
+	runArgs, err := container.prepareDockerIntrospectArgs(ctx, imageId)
+	if err != nil {
+		return err
+	}
+
+	if err := docker.CliRun_LiveOutput(ctx, runArgs...); err != nil {
+		if !strings.Contains(err.Error(), "Code: ") || IsStartContainerErr(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (runtime *LocalDockerServerRuntime) RunStapelScript(ctx context.Context, ref string, volumes []string, scriptPath string) error {
+	stapelContainerName, err := stapel.GetOrCreateContainer(ctx)
+	if err != nil {
+		return err
+	}
+
+	runArgs := []string{
+		"--rm",
+		"--user=0:0",
+		"--workdir=/",
+		fmt.Sprintf("--volumes-from=%s", stapelContainerName),
+	}
+
+	for _, volume := range volumes {
+		runArgs = append(runArgs, fmt.Sprintf("--volume=%s", volume))
+	}
+
+	runArgs = append(runArgs, fmt.Sprintf("--entrypoint=%s", stapel.BashBinPath()), ref, scriptPath)
+
+	if output, err := docker.CliRun_RecordedOutput(ctx, runArgs...); err != nil {
+		logboek.Context(ctx).Error().LogF("%s", output)
+		return err
+	}
+
+	return nil
+}
+
+func (runtime *LocalDockerServerRuntime) RunImportServer(ctx context.Context, ref, tmpDir string) (import_server.ImportServer, error) {
+	srv, err := import_server.RunRsyncServer(ctx, ref, tmpDir)
+	if srv == nil {
+		return nil, err
+	}
+
+	return srv, err
+}
+
 func (runtime *LocalDockerServerRuntime) String() string {
 	return "local-docker-server"
 }
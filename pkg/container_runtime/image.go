@@ -5,3 +5,14 @@ type Image interface{}
 type DockerImage struct {
 	Image ImageInterface
 }
+
+// ManifestListImage combines the platform-specific stage images of the multi-platform image
+type ManifestListImage struct {
+	Name      string
+	Manifests []ManifestListImageEntry
+}
+
+type ManifestListImageEntry struct {
+	Platform  string
+	ImageName string
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/werf/lockgate"
 	"github.com/werf/werf/pkg/werf"
@@ -13,7 +14,6 @@ import (
 
 	"github.com/werf/logboek"
 
-	"github.com/werf/werf/pkg/docker"
 	"github.com/werf/werf/pkg/image"
 )
 
@@ -23,11 +23,20 @@ type StageImage struct {
 	container              *StageImageContainer
 	buildImage             *buildImage
 	dockerfileImageBuilder *DockerfileImageBuilder
+
+	buildStepTimings []*BuildStepTiming
+}
+
+// BuildStepTiming is the duration of the stage image build step (docker build, container run or commit)
+type BuildStepTiming struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
 }
 
-func NewStageImage(fromImage *StageImage, name string, localDockerServerRuntime *LocalDockerServerRuntime) *StageImage {
+func NewStageImage(fromImage *StageImage, name string, containerRuntime ContainerRuntime) *StageImage {
 	stage := &StageImage{}
-	stage.baseImage = newBaseImage(name, localDockerServerRuntime)
+	stage.baseImage = newBaseImage(name, containerRuntime)
 	stage.fromImage = fromImage
 	stage.container = newStageImageContainer(stage)
 	return stage
@@ -55,9 +64,11 @@ func (i *StageImage) GetID() string {
 
 func (i *StageImage) Build(ctx context.Context, options BuildOptions) error {
 	if i.dockerfileImageBuilder != nil {
+		buildStart := time.Now()
 		if err := i.dockerfileImageBuilder.Build(ctx); err != nil {
 			return err
 		}
+		i.addBuildStepTiming("docker-build", buildStart)
 	} else {
 		containerLockName := ContainerLockName(i.container.Name())
 		if _, lock, err := werf.AcquireHostLock(ctx, containerLockName, lockgate.AcquireOptions{}); err != nil {
@@ -66,19 +77,7 @@ func (i *StageImage) Build(ctx context.Context, options BuildOptions) error {
 			defer werf.ReleaseHostLock(lock)
 		}
 
-		if debugDockerRunCommand() {
-			runArgs, err := i.container.prepareRunArgs(ctx)
-			if err != nil {
-				return err
-			}
-
-			fmt.Printf("Docker run command:\ndocker run %s\n", strings.Join(runArgs, " "))
-
-			if len(i.container.prepareAllRunCommands()) != 0 {
-				fmt.Printf("Decoded command:\n%s\n", strings.Join(i.container.prepareAllRunCommands(), " && "))
-			}
-		}
-
+		runStart := time.Now()
 		if containerRunErr := i.container.run(ctx); containerRunErr != nil {
 			if strings.HasPrefix(containerRunErr.Error(), "container run failed") {
 				if options.IntrospectBeforeError {
@@ -110,17 +109,24 @@ func (i *StageImage) Build(ctx context.Context, options BuildOptions) error {
 
 			return containerRunErr
 		}
+		i.addBuildStepTiming("run", runStart)
 
+		commitStart := time.Now()
 		if err := i.Commit(ctx); err != nil {
 			return err
 		}
+		i.addBuildStepTiming("commit", commitStart)
 
 		if err := i.container.rm(ctx); err != nil {
 			return err
 		}
 	}
 
-	if inspect, err := i.LocalDockerServerRuntime.GetImageInspect(ctx, i.MustGetBuiltId()); err != nil {
+	return i.setBuiltImageStageDescription(ctx)
+}
+
+func (i *StageImage) setBuiltImageStageDescription(ctx context.Context) error {
+	if inspect, err := i.ContainerRuntime.GetImageInspect(ctx, i.MustGetBuiltId()); err != nil {
 		return err
 	} else {
 		i.SetInspect(inspect)
@@ -133,13 +139,37 @@ func (i *StageImage) Build(ctx context.Context, options BuildOptions) error {
 	return nil
 }
 
+// SetBuiltImage uses the local image built earlier (e.g. by the interrupted werf process) instead of building
+func (i *StageImage) SetBuiltImage(ctx context.Context, builtId string) error {
+	i.buildImage = newBuildImage(builtId, i.ContainerRuntime)
+	return i.setBuiltImageStageDescription(ctx)
+}
+
+// CleanupFailedBuild removes the build container left by the failed build to allow the build retry
+func (i *StageImage) CleanupFailedBuild(ctx context.Context) error {
+	if i.dockerfileImageBuilder != nil {
+		return nil
+	}
+
+	return i.ContainerRuntime.RemoveStageContainer(ctx, i.container.Name(), true)
+}
+
+func (i *StageImage) addBuildStepTiming(name string, start time.Time) {
+	i.buildStepTimings = append(i.buildStepTimings, &BuildStepTiming{Name: name, Start: start, Duration: time.Since(start)})
+}
+
+// GetBuildStepTimings returns the durations of the build steps of the image built by the current process
+func (i *StageImage) GetBuildStepTimings() []*BuildStepTiming {
+	return i.buildStepTimings
+}
+
 func (i *StageImage) Commit(ctx context.Context) error {
 	builtId, err := i.container.commit(ctx)
 	if err != nil {
 		return err
 	}
 
-	i.buildImage = newBuildImage(builtId, i.LocalDockerServerRuntime)
+	i.buildImage = newBuildImage(builtId, i.ContainerRuntime)
 
 	return nil
 }
@@ -185,25 +215,29 @@ func (i *StageImage) MustGetBuiltId() string {
 }
 
 func (i *StageImage) GetBuiltId() string {
-	if i.dockerfileImageBuilder != nil {
-		return i.dockerfileImageBuilder.GetBuiltId()
-	} else if i.buildImage != nil {
+	if i.buildImage != nil {
 		return i.buildImage.Name()
+	} else if i.dockerfileImageBuilder != nil {
+		return i.dockerfileImageBuilder.GetBuiltId()
 	} else {
 		return ""
 	}
 }
 
 func (i *StageImage) TagBuiltImage(ctx context.Context) error {
-	return docker.CliTag(ctx, i.MustGetBuiltId(), i.name)
+	return i.tag(ctx, i.MustGetBuiltId(), i.name)
 }
 
 func (i *StageImage) Tag(ctx context.Context, name string) error {
-	return docker.CliTag(ctx, i.GetID(), name)
+	return i.tag(ctx, i.GetID(), name)
+}
+
+func (i *StageImage) tag(ctx context.Context, ref, newRef string) error {
+	return i.ContainerRuntime.TagImageByRef(ctx, ref, newRef)
 }
 
 func (i *StageImage) Pull(ctx context.Context) error {
-	if err := docker.CliPullWithRetries(ctx, i.name); err != nil {
+	if err := i.ContainerRuntime.PullImageWithRetries(ctx, i.name); err != nil {
 		return err
 	}
 
@@ -213,12 +247,12 @@ func (i *StageImage) Pull(ctx context.Context) error {
 }
 
 func (i *StageImage) Push(ctx context.Context) error {
-	return docker.CliPushWithRetries(ctx, i.name)
+	return i.ContainerRuntime.PushImageWithRetries(ctx, i.name)
 }
 
 func (i *StageImage) DockerfileImageBuilder() *DockerfileImageBuilder {
 	if i.dockerfileImageBuilder == nil {
-		i.dockerfileImageBuilder = NewDockerfileImageBuilder()
+		i.dockerfileImageBuilder = NewDockerfileImageBuilder(i.ContainerRuntime)
 	}
 	return i.dockerfileImageBuilder
 }
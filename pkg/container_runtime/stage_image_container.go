@@ -8,10 +8,7 @@ import (
 
 	"github.com/werf/werf/pkg/image"
 
-	"github.com/docker/docker/api/types"
-
 	"github.com/werf/logboek"
-	"github.com/werf/werf/pkg/docker"
 	"github.com/werf/werf/pkg/stapel"
 	"github.com/werf/werf/pkg/util"
 )
@@ -68,7 +65,7 @@ func (c *StageImageContainer) ServiceCommitChangeOptions() ContainerOptions {
 	return c.serviceCommitChangeOptions
 }
 
-func (c *StageImageContainer) prepareRunArgs(ctx context.Context) ([]string, error) {
+func (c *StageImageContainer) prepareDockerRunArgs(ctx context.Context) ([]string, error) {
 	var args []string
 	args = append(args, fmt.Sprintf("--name=%s", c.name))
 
@@ -82,8 +79,7 @@ func (c *StageImageContainer) prepareRunArgs(ctx context.Context) ([]string, err
 		return nil, err
 	}
 
-	setColumnsEnv := fmt.Sprintf("--env=COLUMNS=%d", logboek.Context(ctx).Streams().ContentWidth())
-	runArgs = append(runArgs, setColumnsEnv)
+	runArgs = append(runArgs, fmt.Sprintf("--env=%s", c.columnsEnv(ctx)))
 
 	fromImageId := c.image.fromImage.GetID()
 
@@ -95,6 +91,10 @@ func (c *StageImageContainer) prepareRunArgs(ctx context.Context) ([]string, err
 	return args, nil
 }
 
+func (c *StageImageContainer) columnsEnv(ctx context.Context) string {
+	return fmt.Sprintf("COLUMNS=%d", logboek.Context(ctx).Streams().ContentWidth())
+}
+
 func (c *StageImageContainer) prepareRunCommand() string {
 	return ShelloutPack(strings.Join(c.prepareRunCommands(), " && "))
 }
@@ -125,29 +125,12 @@ func ShelloutPack(command string) string {
 	return fmt.Sprintf("eval $(echo %s | %s --decode)", base64.StdEncoding.EncodeToString([]byte(command)), stapel.Base64BinPath())
 }
 
-func (c *StageImageContainer) prepareIntrospectBeforeArgs(ctx context.Context) ([]string, error) {
+func (c *StageImageContainer) prepareDockerIntrospectArgs(ctx context.Context, imageId string) ([]string, error) {
 	args, err := c.prepareIntrospectArgsBase(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	fromImageId := c.image.fromImage.GetID()
-
-	args = append(args, fromImageId)
-	args = append(args, "-ec")
-	args = append(args, stapel.BashBinPath())
-
-	return args, nil
-}
-
-func (c *StageImageContainer) prepareIntrospectArgs(ctx context.Context) ([]string, error) {
-	args, err := c.prepareIntrospectArgsBase(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	imageId := c.image.GetID()
-
 	args = append(args, imageId)
 	args = append(args, "-ec")
 	args = append(args, stapel.BashBinPath())
@@ -187,13 +170,7 @@ func (c *StageImageContainer) prepareServiceRunOptions(ctx context.Context) (*St
 	serviceRunOptions.Workdir = "/"
 	serviceRunOptions.Entrypoint = stapel.BashBinPath()
 	serviceRunOptions.User = "0:0"
-
-	stapelContainerName, err := stapel.GetOrCreateContainer(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	serviceRunOptions.VolumesFrom = []string{stapelContainerName}
+	serviceRunOptions.VolumesFrom = []string{stapel.ContainerName()}
 
 	return serviceRunOptions, nil
 }
@@ -255,46 +232,15 @@ func (c *StageImageContainer) prepareInheritedCommitOptions(ctx context.Context)
 }
 
 func (c *StageImageContainer) run(ctx context.Context) error {
-	runArgs, err := c.prepareRunArgs(ctx)
-	if err != nil {
-		return err
-	}
-
-	if err := docker.CliRun_LiveOutput(ctx, runArgs...); err != nil {
-		return fmt.Errorf("container run failed: %s", err.Error())
-	}
-
-	return nil
+	return c.image.ContainerRuntime.RunStageContainer(ctx, c)
 }
 
 func (c *StageImageContainer) introspect(ctx context.Context) error {
-	runArgs, err := c.prepareIntrospectArgs(ctx)
-	if err != nil {
-		return err
-	}
-
-	if err := docker.CliRun_LiveOutput(ctx, runArgs...); err != nil {
-		if !strings.Contains(err.Error(), "Code: ") || IsStartContainerErr(err) {
-			return err
-		}
-	}
-
-	return nil
+	return c.image.ContainerRuntime.IntrospectStageContainer(ctx, c, c.image.GetID())
 }
 
 func (c *StageImageContainer) introspectBefore(ctx context.Context) error {
-	runArgs, err := c.prepareIntrospectBeforeArgs(ctx)
-	if err != nil {
-		return err
-	}
-
-	if err := docker.CliRun_LiveOutput(ctx, runArgs...); err != nil {
-		if !strings.Contains(err.Error(), "Code: ") || IsStartContainerErr(err) {
-			return err
-		}
-	}
-
-	return nil
+	return c.image.ContainerRuntime.IntrospectStageContainer(ctx, c, c.image.fromImage.GetID())
 }
 
 // https://docs.docker.com/engine/reference/run/#exit-status
@@ -309,20 +255,9 @@ func IsStartContainerErr(err error) bool {
 }
 
 func (c *StageImageContainer) commit(ctx context.Context) (string, error) {
-	commitChanges, err := c.prepareCommitChanges(ctx)
-	if err != nil {
-		return "", err
-	}
-
-	commitOptions := types.ContainerCommitOptions{Changes: commitChanges}
-	id, err := docker.ContainerCommit(ctx, c.name, commitOptions)
-	if err != nil {
-		return "", err
-	}
-
-	return id, nil
+	return c.image.ContainerRuntime.CommitStageContainer(ctx, c)
 }
 
 func (c *StageImageContainer) rm(ctx context.Context) error {
-	return docker.ContainerRemove(ctx, c.name, types.ContainerRemoveOptions{})
+	return c.image.ContainerRuntime.RemoveStageContainer(ctx, c.name, false)
 }
@@ -0,0 +1,138 @@
+package container_runtime
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/werf/werf/pkg/werf"
+)
+
+// recordingRuntime records the calls of the container runtime methods used by the stage image
+type recordingRuntime struct {
+	ContainerRuntime
+
+	calls []string
+}
+
+func (runtime *recordingRuntime) GetImageInspect(_ context.Context, ref string) (*types.ImageInspect, error) {
+	return &types.ImageInspect{ID: ref, Created: "2021-03-01T10:00:00Z", Config: &container.Config{}}, nil
+}
+
+func (runtime *recordingRuntime) RunStageContainer(_ context.Context, container *StageImageContainer) error {
+	runtime.calls = append(runtime.calls, "run "+container.Name())
+	return nil
+}
+
+func (runtime *recordingRuntime) CommitStageContainer(_ context.Context, container *StageImageContainer) (string, error) {
+	runtime.calls = append(runtime.calls, "commit "+container.Name())
+	return "built-id", nil
+}
+
+func (runtime *recordingRuntime) RemoveStageContainer(_ context.Context, containerName string, force bool) error {
+	if force {
+		runtime.calls = append(runtime.calls, "force rm "+containerName)
+	} else {
+		runtime.calls = append(runtime.calls, "rm "+containerName)
+	}
+	return nil
+}
+
+func (runtime *recordingRuntime) TagImageByRef(_ context.Context, ref, newRef string) error {
+	runtime.calls = append(runtime.calls, "tag "+ref+" "+newRef)
+	return nil
+}
+
+func (runtime *recordingRuntime) PullImageWithRetries(_ context.Context, ref string) error {
+	runtime.calls = append(runtime.calls, "pull "+ref)
+	return nil
+}
+
+func (runtime *recordingRuntime) PushImageWithRetries(_ context.Context, ref string) error {
+	runtime.calls = append(runtime.calls, "push "+ref)
+	return nil
+}
+
+func (runtime *recordingRuntime) BuildDockerfileImage(_ context.Context, _ []string, _ string) error {
+	runtime.calls = append(runtime.calls, "build dockerfile")
+	return nil
+}
+
+func (runtime *recordingRuntime) ForceRemoveImage(_ context.Context, ref string) error {
+	runtime.calls = append(runtime.calls, "force rmi "+ref)
+	return nil
+}
+
+func TestStageImageUsesContainerRuntime(t *testing.T) {
+	ctx := context.Background()
+
+	if err := werf.Init(t.TempDir(), t.TempDir()); err != nil {
+		t.Fatalf("unable to init werf: %s", err)
+	}
+
+	runtime := &recordingRuntime{}
+	fromImage := NewStageImage(nil, "from", runtime)
+	img := NewStageImage(fromImage, "registry/project:digest", runtime)
+	containerName := img.Container().Name()
+
+	if err := img.Build(ctx, BuildOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := img.TagBuiltImage(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := img.Push(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := img.Pull(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := img.CleanupFailedBuild(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"run " + containerName,
+		"commit " + containerName,
+		"rm " + containerName,
+		"tag built-id registry/project:digest",
+		"push registry/project:digest",
+		"pull registry/project:digest",
+		"force rm " + containerName,
+	}
+
+	if !reflect.DeepEqual(runtime.calls, expected) {
+		t.Errorf("expected calls:\n%v\ngot:\n%v", expected, runtime.calls)
+	}
+}
+
+func TestDockerfileImageBuilderUsesContainerRuntime(t *testing.T) {
+	ctx := context.Background()
+
+	runtime := &recordingRuntime{}
+	builder := NewDockerfileImageBuilder(runtime)
+
+	if err := builder.Cleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.Build(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.Cleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"build dockerfile", "force rmi " + builder.GetBuiltId()}
+	if !reflect.DeepEqual(runtime.calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, runtime.calls)
+	}
+}
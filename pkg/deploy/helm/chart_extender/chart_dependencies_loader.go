@@ -18,6 +18,7 @@ import (
 	"helm.sh/helm/v3/pkg/cli"
 
 	"github.com/pkg/errors"
+	"github.com/werf/werf/pkg/storage/lrumeta"
 	"github.com/werf/werf/pkg/werf"
 	"helm.sh/helm/v3/pkg/chart"
 	"sigs.k8s.io/yaml"
@@ -27,8 +28,14 @@ import (
 	"helm.sh/helm/v3/pkg/chart/loader"
 )
 
+const ChartDependenciesCacheVersion = "1"
+
+func GetChartDependenciesCacheRootDir() string {
+	return filepath.Join(werf.GetLocalCacheDir(), "helm_chart_dependencies")
+}
+
 func GetChartDependenciesCacheDir(lockChecksum string) string {
-	return filepath.Join(werf.GetLocalCacheDir(), "helm_chart_dependencies", "1", lockChecksum)
+	return filepath.Join(GetChartDependenciesCacheRootDir(), ChartDependenciesCacheVersion, lockChecksum)
 }
 
 func LoadMetadata(files []*chart.ChartExtenderBufferedFile) (*chart.Metadata, error) {
@@ -62,7 +69,9 @@ func LoadMetadata(files []*chart.ChartExtenderBufferedFile) (*chart.Metadata, er
 	return metadata, nil
 }
 
-func GetPreparedChartDependenciesDir(ctx context.Context, conf *ChartDependenciesConfiguration, helmEnvSettings *cli.EnvSettings, registryClientHandle *helm_v3.RegistryClientHandle, buildChartDependenciesOpts command_helpers.BuildChartDependenciesOptions) (string, error) {
+// GetPreparedChartDependenciesDir builds the chart dependencies if they are not cached yet and returns the dependencies dir
+// with the shared lock held, which prevents the host cleanup from removing the dir while it is used: the caller should release the lock
+func GetPreparedChartDependenciesDir(ctx context.Context, conf *ChartDependenciesConfiguration, helmEnvSettings *cli.EnvSettings, registryClientHandle *helm_v3.RegistryClientHandle, buildChartDependenciesOpts command_helpers.BuildChartDependenciesOptions) (string, lockgate.LockHandle, error) {
 	var lockFileData []byte
 	if conf.ChartLockFile != nil {
 		lockFileData = conf.ChartLockFile.Data
@@ -72,7 +81,14 @@ func GetPreparedChartDependenciesDir(ctx context.Context, conf *ChartDependencie
 
 	depsDir := GetChartDependenciesCacheDir(util.Sha256Hash(string(lockFileData)))
 
-	if _, err := os.Stat(depsDir); os.IsNotExist(err) {
+	lock, exists, err := lockExistingChartDependenciesDir(ctx, depsDir)
+	if err != nil {
+		return "", lockgate.LockHandle{}, err
+	}
+
+	if exists {
+		logboek.Context(ctx).Default().LogF("Using cached chart dependencies directory: %s\n", depsDir)
+	} else {
 		if err := logboek.Context(ctx).Default().LogProcess("Building chart dependencies").DoError(func() error {
 			logboek.Context(ctx).Default().LogF("Using chart dependencies directory: %s\n", depsDir)
 			if _, lock, err := werf.AcquireHostLock(ctx, depsDir, lockgate.AcquireOptions{}); err != nil {
@@ -81,6 +97,13 @@ func GetPreparedChartDependenciesDir(ctx context.Context, conf *ChartDependencie
 				defer werf.ReleaseHostLock(lock)
 			}
 
+			// the dependencies might be built by another werf process while waiting for the lock
+			if _, err := os.Stat(depsDir); err == nil {
+				return nil
+			} else if !os.IsNotExist(err) {
+				return fmt.Errorf("error accessing %q: %s", depsDir, err)
+			}
+
 			tmpDepsDir := fmt.Sprintf("%s.tmp.%s", depsDir, uuid.NewV4().String())
 
 			buildChartDependenciesOpts.LoadOptions = &loader.LoadOptions{
@@ -98,15 +121,43 @@ func GetPreparedChartDependenciesDir(ctx context.Context, conf *ChartDependencie
 
 			return nil
 		}); err != nil {
-			return "", err
+			return "", lockgate.LockHandle{}, err
 		}
+
+		lock, exists, err = lockExistingChartDependenciesDir(ctx, depsDir)
+		if err != nil {
+			return "", lockgate.LockHandle{}, err
+		}
+
+		if !exists {
+			return "", lockgate.LockHandle{}, fmt.Errorf("chart dependencies directory %q has been removed after building", depsDir)
+		}
+	}
+
+	if err := lrumeta.CommonLRUPathsCache.AccessPath(ctx, depsDir); err != nil {
+		werf.ReleaseHostLock(lock)
+		return "", lockgate.LockHandle{}, fmt.Errorf("error tracking chart dependencies directory %q access: %s", depsDir, err)
+	}
+
+	return depsDir, lock, nil
+}
+
+// lockExistingChartDependenciesDir acquires the shared lock of the dependencies dir, the lock is released if the dir does not exist
+func lockExistingChartDependenciesDir(ctx context.Context, depsDir string) (lockgate.LockHandle, bool, error) {
+	_, lock, err := werf.AcquireHostLock(ctx, depsDir, lockgate.AcquireOptions{Shared: true})
+	if err != nil {
+		return lockgate.LockHandle{}, false, fmt.Errorf("error acquiring lock for %q: %s", depsDir, err)
+	}
+
+	if _, err := os.Stat(depsDir); os.IsNotExist(err) {
+		werf.ReleaseHostLock(lock)
+		return lockgate.LockHandle{}, false, nil
 	} else if err != nil {
-		return "", fmt.Errorf("error accessing %q: %s", depsDir, err)
-	} else {
-		logboek.Context(ctx).Default().LogF("Using cached chart dependencies directory: %s\n", depsDir)
+		werf.ReleaseHostLock(lock)
+		return lockgate.LockHandle{}, false, fmt.Errorf("error accessing %q: %s", depsDir, err)
 	}
 
-	return depsDir, nil
+	return lock, true, nil
 }
 
 type ChartDependenciesConfiguration struct {
@@ -171,11 +222,12 @@ func LoadChartDependencies(ctx context.Context, loadedFiles []*chart.ChartExtend
 		return loadedFiles, nil
 	}
 
-	depsDir, err := GetPreparedChartDependenciesDir(ctx, conf, helmEnvSettings, registryClientHandle, buildChartDependenciesOpts)
+	depsDir, lock, err := GetPreparedChartDependenciesDir(ctx, conf, helmEnvSettings, registryClientHandle, buildChartDependenciesOpts)
 	if err != nil {
 		return nil, fmt.Errorf("error preparing chart dependencies: %s", err)
 	}
 	localFiles, err := loader.GetFilesFromLocalFilesystem(depsDir)
+	werf.ReleaseHostLock(lock)
 	if err != nil {
 		return nil, err
 	}
@@ -9,3 +9,7 @@ import (
 func Info(ctx context.Context) (types.Info, error) {
 	return apiCli(ctx).Info(ctx)
 }
+
+func DiskUsage(ctx context.Context) (types.DiskUsage, error) {
+	return apiCli(ctx).DiskUsage(ctx)
+}
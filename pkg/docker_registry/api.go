@@ -88,15 +88,28 @@ func (api *api) GetRepoImageConfigFile(_ context.Context, reference string) (*v1
 	return imageInfo.ConfigFile()
 }
 
-func (api *api) GetRepoImage(_ context.Context, reference string) (*image.Info, error) {
-	imageInfo, _, err := api.image(reference)
+func (api *api) GetRepoImage(ctx context.Context, reference string) (*image.Info, error) {
+	ref, err := name.ParseReference(reference, api.parseReferenceOptions()...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("parsing reference %q: %v", reference, err)
 	}
 
-	digest, err := imageInfo.Digest()
+	desc, err := remote.Get(ref, api.remoteOptions(ctx)...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("reading image %q: %v", ref, err)
+	}
+
+	// the repo digest of the manifest list is the digest of the manifest list itself
+	digest := desc.Digest
+
+	imageInfo, err := descriptorImage(desc)
+	if err != nil {
+		return nil, fmt.Errorf("reading image %q: %v", ref, err)
+	}
+
+	platformImageIDs, err := descriptorPlatformImageIDs(desc)
+	if err != nil {
+		return nil, fmt.Errorf("reading image %q platform images: %v", ref, err)
 	}
 
 	manifest, err := imageInfo.Manifest()
@@ -136,6 +149,8 @@ func (api *api) GetRepoImage(_ context.Context, reference string) (*image.Info,
 		ParentID:   configFile.Config.Image,
 		Labels:     configFile.Config.Labels,
 		Size:       totalSize,
+
+		PlatformImageIDs: platformImageIDs,
 	}
 
 	repoImage.SetCreatedAtUnix(configFile.Created.Unix())
@@ -226,6 +241,71 @@ func (api *api) pushImage(_ context.Context, reference string, opts *PushImageOp
 	return nil
 }
 
+// GetRepoImageObject returns the lazy image object, blobs are read from the registry on demand.
+func (api *api) GetRepoImageObject(ctx context.Context, reference string) (v1.Image, error) {
+	ref, err := name.ParseReference(reference, api.parseReferenceOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	img, err := remote.Image(ref, api.remoteOptions(ctx)...)
+	if err != nil {
+		return nil, fmt.Errorf("reading image %q: %v", ref, err)
+	}
+
+	return img, nil
+}
+
+func (api *api) WriteRepoImageObject(ctx context.Context, reference string, img v1.Image) error {
+	ref, err := name.ParseReference(reference, api.parseReferenceOptions()...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	if err := remote.Write(ref, img, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithTransport(api.getHttpTransport()), remote.WithContext(ctx)); err != nil {
+		return fmt.Errorf("write to the remote %s have failed: %s", ref.String(), err)
+	}
+
+	return nil
+}
+
+// GetRepoImageIndexObject returns the lazy image index object, nil is returned if the reference is not an image index.
+func (api *api) GetRepoImageIndexObject(ctx context.Context, reference string) (v1.ImageIndex, error) {
+	ref, err := name.ParseReference(reference, api.parseReferenceOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	desc, err := remote.Get(ref, api.remoteOptions(ctx)...)
+	if err != nil {
+		return nil, fmt.Errorf("reading image %q: %v", ref, err)
+	}
+
+	if !desc.MediaType.IsIndex() {
+		return nil, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("reading image index %q: %v", ref, err)
+	}
+
+	return idx, nil
+}
+
+func (api *api) WriteRepoImageIndexObject(ctx context.Context, reference string, idx v1.ImageIndex) error {
+	ref, err := name.ParseReference(reference, api.parseReferenceOptions()...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	if err := remote.WriteIndex(ref, idx, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithTransport(api.getHttpTransport()), remote.WithContext(ctx)); err != nil {
+		return fmt.Errorf("write to the remote %s have failed: %s", ref.String(), err)
+	}
+
+	return nil
+}
+
 func (api *api) image(reference string) (v1.Image, name.Reference, error) {
 	ref, err := name.ParseReference(reference, api.parseReferenceOptions()...)
 	if err != nil {
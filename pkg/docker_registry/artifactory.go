@@ -0,0 +1,122 @@
+package docker_registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+const ArtifactoryImplementationName = "artifactory"
+
+type ArtifactoryNotFoundError apiError
+
+var artifactoryPatterns = []string{"^.*\\.jfrog\\.io$", "^artifactory\\..*"}
+
+// artifactory expects the repository path method of the docker access: HOSTNAME/REPOSITORY_KEY/IMAGE
+type artifactory struct {
+	*defaultImplementation
+	artifactoryApi
+	artifactoryCredentials
+}
+
+type artifactoryOptions struct {
+	defaultImplementationOptions
+	artifactoryCredentials
+}
+
+type artifactoryCredentials struct {
+	username string
+	password string
+}
+
+func newArtifactory(options artifactoryOptions) (*artifactory, error) {
+	d, err := newDefaultImplementation(options.defaultImplementationOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	artifactory := &artifactory{
+		defaultImplementation:  d,
+		artifactoryApi:         newArtifactoryApi(),
+		artifactoryCredentials: options.artifactoryCredentials,
+	}
+
+	return artifactory, nil
+}
+
+func (r *artifactory) Tags(ctx context.Context, reference string) ([]string, error) {
+	scheme, hostname, repositoryKey, imageName, err := r.parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, resp, err := r.artifactoryApi.GetTags(ctx, scheme, hostname, repositoryKey, imageName, r.username, r.password)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return []string{}, nil
+		}
+
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (r *artifactory) DeleteRepoImage(ctx context.Context, repoImage *image.Info) error {
+	scheme, hostname, repositoryKey, imageName, err := r.parseReference(repoImage.Repository)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.artifactoryApi.DeleteTag(ctx, scheme, hostname, repositoryKey, imageName, repoImage.Tag, r.username, r.password)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return ArtifactoryNotFoundError{error: err}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *artifactory) DeleteRepo(ctx context.Context, reference string) error {
+	scheme, hostname, repositoryKey, imageName, err := r.parseReference(reference)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.artifactoryApi.DeleteRepository(ctx, scheme, hostname, repositoryKey, imageName, r.username, r.password)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return ArtifactoryNotFoundError{error: err}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *artifactory) String() string {
+	return ArtifactoryImplementationName
+}
+
+func (r *artifactory) parseReference(reference string) (string, string, string, string, error) {
+	parsedReference, err := name.NewRepository(reference, r.parseReferenceOptions()...)
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	parts := strings.SplitN(parsedReference.RepositoryStr(), "/", 2)
+	if len(parts) != 2 {
+		return "", "", "", "", fmt.Errorf("unexpected reference %s: expected HOSTNAME/REPOSITORY_KEY/IMAGE", reference)
+	}
+
+	return parsedReference.Registry.Scheme(), parsedReference.RegistryStr(), parts[0], parts[1], nil
+}
@@ -0,0 +1,77 @@
+package docker_registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+type artifactoryApi struct{}
+
+func newArtifactoryApi() artifactoryApi {
+	return artifactoryApi{}
+}
+
+func (api *artifactoryApi) GetTags(ctx context.Context, scheme, hostname, repositoryKey, imageName, username, password string) ([]string, *http.Response, error) {
+	u, err := url.Parse(scheme + "://" + hostname + "/artifactory/api/docker/")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u.Path = path.Join(u.Path, repositoryKey, "v2", imageName, "tags", "list")
+
+	resp, respBody, err := doRequest(ctx, http.MethodGet, u.String(), nil, doRequestOptions{
+		Headers: map[string]string{
+			"Accept": "application/json",
+		},
+		BasicAuth: doRequestBasicAuth{
+			username: username,
+			password: password,
+		},
+		AcceptedCodes: []int{http.StatusOK},
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+
+	respJson := &struct {
+		Tags []string `json:"tags"`
+	}{}
+
+	if err := json.Unmarshal(respBody, respJson); err != nil {
+		return nil, resp, fmt.Errorf("unexpected body %s", string(respBody))
+	}
+
+	return respJson.Tags, resp, nil
+}
+
+// DeleteTag deletes the tag folder, the manifest and layers are kept while they are referenced by other tags
+func (api *artifactoryApi) DeleteTag(ctx context.Context, scheme, hostname, repositoryKey, imageName, tag, username, password string) (*http.Response, error) {
+	return api.deleteItem(ctx, scheme, hostname, path.Join(repositoryKey, imageName, tag), username, password)
+}
+
+func (api *artifactoryApi) DeleteRepository(ctx context.Context, scheme, hostname, repositoryKey, imageName, username, password string) (*http.Response, error) {
+	return api.deleteItem(ctx, scheme, hostname, path.Join(repositoryKey, imageName), username, password)
+}
+
+func (api *artifactoryApi) deleteItem(ctx context.Context, scheme, hostname, itemPath, username, password string) (*http.Response, error) {
+	u, err := url.Parse(scheme + "://" + hostname + "/artifactory/")
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = path.Join(u.Path, itemPath)
+
+	resp, _, err := doRequest(ctx, http.MethodDelete, u.String(), nil, doRequestOptions{
+		BasicAuth: doRequestBasicAuth{
+			username: username,
+			password: password,
+		},
+		AcceptedCodes: []int{http.StatusOK, http.StatusAccepted, http.StatusNoContent},
+	})
+
+	return resp, err
+}
@@ -0,0 +1,238 @@
+package docker_registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/util"
+)
+
+const (
+	capabilitiesCacheTTL = 24 * time.Hour
+
+	capabilitiesProbeTag = "werf-capabilities-probe"
+)
+
+// capabilitiesCacheDir is set by Init, the probed capabilities are only kept in memory if the dir is not set
+var capabilitiesCacheDir string
+
+var (
+	capabilitiesByRepository    = map[string]*Capabilities{}
+	probeErrorByRepository      = map[string]error{}
+	capabilitiesByRepositoryMux sync.Mutex
+)
+
+// Capabilities describes the optional parts of the OCI Distribution API supported by the registry for the repository
+// (registries may have different settings for different repositories, e.g. the deletion can be enabled per project).
+type Capabilities struct {
+	Registry       string    `json:"registry"`
+	Repository     string    `json:"repository"`
+	ManifestDelete bool      `json:"manifestDelete"`
+	TagDelete      bool      `json:"tagDelete"`
+	Catalog        bool      `json:"catalog"`
+	Referrers      bool      `json:"referrers"`
+	ProbedAt       time.Time `json:"probedAt"`
+}
+
+const unsupportedDeletionErrorMessage = "supports neither manifest nor tag deletion"
+
+type UnsupportedDeletionError struct {
+	Registry   string
+	Repository string
+}
+
+func (err UnsupportedDeletionError) Error() string {
+	return fmt.Sprintf("container registry %s %s for the repository %s: "+
+		"enable deletion in the registry settings (e.g. REGISTRY_STORAGE_DELETE_ENABLED=true for the Docker Registry) "+
+		"or specify the registry implementation explicitly with the --repo-container-registry option (supported implementations: %v); "+
+		"to probe the registry again remove %s",
+		err.Registry, unsupportedDeletionErrorMessage, err.Repository, ImplementationList(), capabilitiesCachePath(err.Repository))
+}
+
+// IsUnsupportedDeletionError also detects the error wrapped by the callers
+func IsUnsupportedDeletionError(err error) bool {
+	if _, ok := err.(UnsupportedDeletionError); ok {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), unsupportedDeletionErrorMessage)
+}
+
+// GetCapabilities probes the registry for the repository (without any changes in the registry) and caches the result for capabilitiesCacheTTL.
+// The probe error is cached in memory, so that the failed registry is not probed again by the same werf process.
+func (api *api) GetCapabilities(ctx context.Context, reference string) (*Capabilities, error) {
+	repo, err := name.NewRepository(reference, api.newRepositoryOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing repo %q: %v", reference, err)
+	}
+
+	capabilitiesByRepositoryMux.Lock()
+	defer capabilitiesByRepositoryMux.Unlock()
+
+	repository := repo.Name()
+
+	if capabilities, ok := capabilitiesByRepository[repository]; ok {
+		return capabilities, nil
+	}
+
+	if err, ok := probeErrorByRepository[repository]; ok {
+		return nil, err
+	}
+
+	if capabilities, err := readCapabilitiesCache(repository); err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: Unable to read container registry %s capabilities cache: %s\n", repository, err)
+	} else if capabilities != nil {
+		capabilitiesByRepository[repository] = capabilities
+		return capabilities, nil
+	}
+
+	capabilities, err := api.probeCapabilities(ctx, repo)
+	if err != nil {
+		probeErrorByRepository[repository] = fmt.Errorf("unable to probe container registry capabilities for the repository %s: %s", repository, err)
+		return nil, probeErrorByRepository[repository]
+	}
+
+	logboek.Context(ctx).Debug().LogF("-- Container registry capabilities for the repository %s: %#v\n", repository, capabilities)
+
+	capabilitiesByRepository[repository] = capabilities
+	if err := writeCapabilitiesCache(capabilities); err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: Unable to write container registry capabilities cache for the repository %s: %s\n", repository, err)
+	}
+
+	return capabilities, nil
+}
+
+func (api *api) probeCapabilities(ctx context.Context, repo name.Repository) (*Capabilities, error) {
+	capabilities := &Capabilities{Registry: repo.RegistryStr(), Repository: repo.Name(), ProbedAt: time.Now()}
+
+	client, err := api.registryHttpClient(ctx, repo, transport.DeleteScope)
+	if err != nil {
+		return nil, err
+	}
+
+	// the probe references do not exist, so that the registry responds with 404 if the deletion is supported
+	probeDigest := "sha256:" + util.Sha256Hash(capabilitiesProbeTag)
+
+	if capabilities.ManifestDelete, err = probeDeletion(ctx, client, repo, probeDigest); err != nil {
+		return nil, err
+	}
+
+	if capabilities.TagDelete, err = probeDeletion(ctx, client, repo, capabilitiesProbeTag); err != nil {
+		return nil, err
+	}
+
+	if _, capabilities.Referrers, err = api.getReferrersByAPI(ctx, repo, probeDigest); err != nil {
+		return nil, err
+	}
+
+	capabilities.Catalog = api.probeCatalog(ctx, repo)
+
+	return capabilities, nil
+}
+
+func probeDeletion(ctx context.Context, client *http.Client, repo name.Repository, reference string) (bool, error) {
+	url := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", repo.Registry.Scheme(), repo.RegistryStr(), repo.RepositoryStr(), reference)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("error requesting url %q: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNotFound:
+		return true, nil
+	case http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return false, nil
+	default:
+		return false, transport.CheckError(resp, http.StatusAccepted)
+	}
+}
+
+func (api *api) probeCatalog(ctx context.Context, repo name.Repository) bool {
+	auth, err := authn.DefaultKeychain.Resolve(repo.Registry)
+	if err != nil {
+		return false
+	}
+
+	tr, err := transport.NewWithContext(ctx, repo.Registry, auth, api.getHttpTransport(), []string{repo.Registry.Scope(transport.CatalogScope)})
+	if err != nil {
+		return false
+	}
+
+	url := fmt.Sprintf("%s://%s/v2/_catalog?n=1", repo.Registry.Scheme(), repo.RegistryStr())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK
+}
+
+func capabilitiesCachePath(repository string) string {
+	return filepath.Join(capabilitiesCacheDir, util.Sha256Hash(repository)+".json")
+}
+
+func readCapabilitiesCache(repository string) (*Capabilities, error) {
+	if capabilitiesCacheDir == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(capabilitiesCachePath(repository))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	capabilities := &Capabilities{}
+	if err := json.Unmarshal(data, capabilities); err != nil {
+		return nil, err
+	}
+
+	if capabilities.Repository != repository || time.Since(capabilities.ProbedAt) > capabilitiesCacheTTL {
+		return nil, nil
+	}
+
+	return capabilities, nil
+}
+
+func writeCapabilitiesCache(capabilities *Capabilities) error {
+	if capabilitiesCacheDir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(capabilities)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(capabilitiesCacheDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(capabilitiesCachePath(capabilities.Repository), data, 0644)
+}
@@ -0,0 +1,189 @@
+package docker_registry_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/werf/werf/pkg/docker_registry"
+	"github.com/werf/werf/pkg/image"
+)
+
+type capabilitiesEntry struct {
+	manifestDeleteStatus int
+	tagDeleteStatus      int
+	catalogStatus        int
+	referrersStatus      int
+
+	expectedCapabilities    docker_registry.Capabilities
+	expectedDeleteReference string
+}
+
+var _ = DescribeTable("container registry capabilities probing", func(entry capabilitiesEntry) {
+	ctx := context.Background()
+
+	var mux sync.Mutex
+	var deletedReferences []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		switch {
+		case req.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case req.URL.Path == "/v2/_catalog":
+			w.WriteHeader(entry.catalogStatus)
+		case strings.Contains(req.URL.Path, "/referrers/"):
+			w.WriteHeader(entry.referrersStatus)
+			_, _ = w.Write([]byte(`{"schemaVersion":2,"manifests":[]}`))
+		case req.Method == http.MethodDelete:
+			reference := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+
+			status := entry.tagDeleteStatus
+			if strings.HasPrefix(reference, "sha256:") {
+				status = entry.manifestDeleteStatus
+			}
+
+			if status == http.StatusNotFound && (reference == "mytag" || reference == "sha256:"+strings.Repeat("1", 64)) {
+				deletedReferences = append(deletedReferences, reference)
+				status = http.StatusAccepted
+			}
+
+			w.WriteHeader(status)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	repo := strings.TrimPrefix(server.URL, "http://") + "/test/repo"
+
+	dockerRegistry, err := docker_registry.NewDockerRegistry(repo, docker_registry.DefaultImplementationName, docker_registry.DockerRegistryOptions{InsecureRegistry: true})
+	Ω(err).ShouldNot(HaveOccurred())
+
+	capabilities, err := dockerRegistry.GetCapabilities(ctx, repo)
+	Ω(err).ShouldNot(HaveOccurred())
+	Ω(capabilities.ManifestDelete).Should(Equal(entry.expectedCapabilities.ManifestDelete))
+	Ω(capabilities.TagDelete).Should(Equal(entry.expectedCapabilities.TagDelete))
+	Ω(capabilities.Catalog).Should(Equal(entry.expectedCapabilities.Catalog))
+	Ω(capabilities.Referrers).Should(Equal(entry.expectedCapabilities.Referrers))
+
+	err = dockerRegistry.DeleteRepoImage(ctx, &image.Info{
+		Repository: repo,
+		Tag:        "mytag",
+		RepoDigest: "sha256:" + strings.Repeat("1", 64),
+	})
+
+	if entry.expectedDeleteReference == "" {
+		Ω(docker_registry.IsUnsupportedDeletionError(err)).Should(BeTrue(), "unexpected error: %v", err)
+		Ω(deletedReferences).Should(BeEmpty())
+	} else {
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(deletedReferences).Should(Equal([]string{entry.expectedDeleteReference}))
+	}
+},
+	Entry("manifest and tag deletion", capabilitiesEntry{
+		manifestDeleteStatus:    http.StatusNotFound,
+		tagDeleteStatus:         http.StatusNotFound,
+		catalogStatus:           http.StatusOK,
+		referrersStatus:         http.StatusOK,
+		expectedCapabilities:    docker_registry.Capabilities{ManifestDelete: true, TagDelete: true, Catalog: true, Referrers: true},
+		expectedDeleteReference: "sha256:" + strings.Repeat("1", 64),
+	}),
+	Entry("tag deletion only", capabilitiesEntry{
+		manifestDeleteStatus:    http.StatusMethodNotAllowed,
+		tagDeleteStatus:         http.StatusNotFound,
+		catalogStatus:           http.StatusUnauthorized,
+		referrersStatus:         http.StatusNotFound,
+		expectedCapabilities:    docker_registry.Capabilities{TagDelete: true},
+		expectedDeleteReference: "mytag",
+	}),
+	Entry("deletion is not supported", capabilitiesEntry{
+		manifestDeleteStatus: http.StatusMethodNotAllowed,
+		tagDeleteStatus:      http.StatusBadRequest,
+		catalogStatus:        http.StatusOK,
+		referrersStatus:      http.StatusMethodNotAllowed,
+		expectedCapabilities: docker_registry.Capabilities{Catalog: true},
+	}),
+)
+
+var _ = Describe("container registry capabilities cache", func() {
+	It("should be kept per repository", func() {
+		ctx := context.Background()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case req.URL.Path == "/v2/":
+				w.WriteHeader(http.StatusOK)
+			case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/v2/deletable/"):
+				w.WriteHeader(http.StatusNotFound)
+			case req.Method == http.MethodDelete:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		host := strings.TrimPrefix(server.URL, "http://")
+
+		dockerRegistry, err := docker_registry.NewDockerRegistry(host+"/deletable/repo", docker_registry.DefaultImplementationName, docker_registry.DockerRegistryOptions{InsecureRegistry: true})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		capabilities, err := dockerRegistry.GetCapabilities(ctx, host+"/deletable/repo")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(capabilities.ManifestDelete).Should(BeTrue())
+
+		capabilities, err = dockerRegistry.GetCapabilities(ctx, host+"/protected/repo")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(capabilities.ManifestDelete).Should(BeFalse())
+		Ω(capabilities.TagDelete).Should(BeFalse())
+
+		err = dockerRegistry.DeleteRepoImage(ctx, &image.Info{Repository: host + "/protected/repo", Tag: "mytag"})
+		Ω(docker_registry.IsUnsupportedDeletionError(err)).Should(BeTrue(), "unexpected error: %v", err)
+		Ω(docker_registry.IsUnsupportedDeletionError(fmt.Errorf("unable to remove repo image: %s", err))).Should(BeTrue())
+	})
+
+	It("should keep the probe error", func() {
+		ctx := context.Background()
+
+		var mux sync.Mutex
+		var probeRequests int
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mux.Lock()
+			defer mux.Unlock()
+
+			switch {
+			case req.URL.Path == "/v2/":
+				w.WriteHeader(http.StatusOK)
+			case req.Method == http.MethodDelete:
+				probeRequests++
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		repo := strings.TrimPrefix(server.URL, "http://") + "/test/repo"
+
+		dockerRegistry, err := docker_registry.NewDockerRegistry(repo, docker_registry.DefaultImplementationName, docker_registry.DockerRegistryOptions{InsecureRegistry: true})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			_, err := dockerRegistry.GetCapabilities(ctx, repo)
+			Ω(err).Should(HaveOccurred())
+		}
+
+		Ω(probeRequests).Should(Equal(1))
+	})
+})
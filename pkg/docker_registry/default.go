@@ -32,9 +32,24 @@ func (r *defaultImplementation) DeleteRepo(_ context.Context, _ string) error {
 	return fmt.Errorf("method is not implemented")
 }
 
-func (r *defaultImplementation) DeleteRepoImage(_ context.Context, repoImage *image.Info) error {
-	reference := strings.Join([]string{repoImage.Repository, repoImage.RepoDigest}, "@")
-	return r.api.deleteImageByReference(reference)
+// DeleteRepoImage selects the deletion strategy by the probed registry capabilities:
+// the manifest is deleted by digest if possible, otherwise only the tag is deleted.
+func (r *defaultImplementation) DeleteRepoImage(ctx context.Context, repoImage *image.Info) error {
+	capabilities, err := r.api.GetCapabilities(ctx, repoImage.Repository)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case capabilities.ManifestDelete:
+		reference := strings.Join([]string{repoImage.Repository, repoImage.RepoDigest}, "@")
+		return r.api.deleteImageByReference(reference)
+	case capabilities.TagDelete && repoImage.Tag != "":
+		reference := strings.Join([]string{repoImage.Repository, repoImage.Tag}, ":")
+		return r.api.deleteImageByReference(reference)
+	default:
+		return UnsupportedDeletionError{Registry: capabilities.Registry, Repository: capabilities.Repository}
+	}
 }
 
 func (r *defaultImplementation) String() string {
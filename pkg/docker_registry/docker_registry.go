@@ -8,6 +8,7 @@ import (
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 
 	"github.com/werf/werf/pkg/image"
 )
@@ -21,6 +22,16 @@ type DockerRegistry interface {
 	IsRepoImageExists(ctx context.Context, reference string) (bool, error)
 	DeleteRepoImage(ctx context.Context, repoImage *image.Info) error
 	PushImage(ctx context.Context, reference string, opts *PushImageOptions) error
+	GetRepoImageObject(ctx context.Context, reference string) (v1.Image, error)
+	WriteRepoImageObject(ctx context.Context, reference string, img v1.Image) error
+	GetRepoImageIndexObject(ctx context.Context, reference string) (v1.ImageIndex, error)
+	WriteRepoImageIndexObject(ctx context.Context, reference string, idx v1.ImageIndex) error
+	PushManifestList(ctx context.Context, reference string, entries []ManifestListEntry) error
+	GetRepoImagePlatformDigest(ctx context.Context, reference, platform string) (string, error)
+	PushArtifact(ctx context.Context, subjectReference string, opts PushArtifactOptions) (string, error)
+	GetReferrers(ctx context.Context, subjectReference string) ([]*Referrer, error)
+	RemoveReferrer(ctx context.Context, subjectReference string, referrer *Referrer) error
+	GetCapabilities(ctx context.Context, reference string) (*Capabilities, error)
 
 	String() string
 }
@@ -39,6 +50,21 @@ type DockerRegistryOptions struct {
 	HarborUsername        string
 	HarborPassword        string
 	QuayToken             string
+	ArtifactoryUsername   string
+	ArtifactoryPassword   string
+	NexusUsername         string
+	NexusPassword         string
+	YandexCrToken         string
+}
+
+func (o *DockerRegistryOptions) artifactoryOptions() artifactoryOptions {
+	return artifactoryOptions{
+		defaultImplementationOptions: o.defaultOptions(),
+		artifactoryCredentials: artifactoryCredentials{
+			username: o.ArtifactoryUsername,
+			password: o.ArtifactoryPassword,
+		},
+	}
 }
 
 func (o *DockerRegistryOptions) awsEcrOptions() awsEcrOptions {
@@ -95,6 +121,16 @@ func (o *DockerRegistryOptions) harborOptions() harborOptions {
 	}
 }
 
+func (o *DockerRegistryOptions) nexusOptions() nexusOptions {
+	return nexusOptions{
+		defaultImplementationOptions: o.defaultOptions(),
+		nexusCredentials: nexusCredentials{
+			username: o.NexusUsername,
+			password: o.NexusPassword,
+		},
+	}
+}
+
 func (o *DockerRegistryOptions) quayOptions() quayOptions {
 	return quayOptions{
 		defaultImplementationOptions: o.defaultOptions(),
@@ -104,6 +140,15 @@ func (o *DockerRegistryOptions) quayOptions() quayOptions {
 	}
 }
 
+func (o *DockerRegistryOptions) yandexCrOptions() yandexCrOptions {
+	return yandexCrOptions{
+		defaultImplementationOptions: o.defaultOptions(),
+		yandexCrCredentials: yandexCrCredentials{
+			token: o.YandexCrToken,
+		},
+	}
+}
+
 func (o *DockerRegistryOptions) defaultOptions() defaultImplementationOptions {
 	return defaultImplementationOptions{apiOptions{
 		InsecureRegistry:      o.InsecureRegistry,
@@ -113,6 +158,8 @@ func (o *DockerRegistryOptions) defaultOptions() defaultImplementationOptions {
 
 func NewDockerRegistry(repositoryAddress string, implementation string, options DockerRegistryOptions) (DockerRegistry, error) {
 	switch implementation {
+	case ArtifactoryImplementationName:
+		return newArtifactory(options.artifactoryOptions())
 	case AwsEcrImplementationName:
 		return newAwsEcr(options.awsEcrOptions())
 	case AzureCrImplementationName:
@@ -127,8 +174,12 @@ func NewDockerRegistry(repositoryAddress string, implementation string, options
 		return newGitLabRegistry(options.gitLabRegistryOptions())
 	case HarborImplementationName:
 		return newHarbor(options.harborOptions())
+	case NexusImplementationName:
+		return newNexus(options.nexusOptions())
 	case QuayImplementationName:
 		return newQuay(options.quayOptions())
+	case YandexCrImplementationName:
+		return newYandexCr(options.yandexCrOptions())
 	case DefaultImplementationName:
 		return newDefaultImplementation(options.defaultOptions())
 	default:
@@ -176,6 +227,10 @@ func detectImplementation(accountOrRepositoryAddress string) (string, error) {
 		name     string
 		patterns []string
 	}{
+		{
+			name:     ArtifactoryImplementationName,
+			patterns: artifactoryPatterns,
+		},
 		{
 			name:     AwsEcrImplementationName,
 			patterns: awsEcrPatterns,
@@ -204,10 +259,18 @@ func detectImplementation(accountOrRepositoryAddress string) (string, error) {
 			name:     HarborImplementationName,
 			patterns: harborPatterns,
 		},
+		{
+			name:     NexusImplementationName,
+			patterns: nexusPatterns,
+		},
 		{
 			name:     QuayImplementationName,
 			patterns: quayPatterns,
 		},
+		{
+			name:     YandexCrImplementationName,
+			patterns: yandexCrPatterns,
+		},
 	} {
 		for _, pattern := range service.patterns {
 			matched, err := regexp.MatchString(pattern, parsedResource.RegistryStr())
@@ -226,6 +289,7 @@ func detectImplementation(accountOrRepositoryAddress string) (string, error) {
 
 func ImplementationList() []string {
 	return []string{
+		ArtifactoryImplementationName,
 		AwsEcrImplementationName,
 		AzureCrImplementationName,
 		DefaultImplementationName,
@@ -234,6 +298,8 @@ func ImplementationList() []string {
 		GitHubPackagesImplementationName,
 		GitLabRegistryImplementationName,
 		HarborImplementationName,
+		NexusImplementationName,
 		QuayImplementationName,
+		YandexCrImplementationName,
 	}
 }
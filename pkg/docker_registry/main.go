@@ -4,10 +4,13 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/google/go-containerregistry/pkg/logs"
 
 	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/werf"
 )
 
 var generic *api
@@ -28,6 +31,8 @@ func Init(ctx context.Context, insecureRegistry, skipTlsVerifyRegistry bool) err
 		logs.Debug.SetOutput(ioutil.Discard)
 	}
 
+	capabilitiesCacheDir = filepath.Join(werf.GetLocalCacheDir(), "docker_registry", "capabilities", "1")
+
 	generic = newAPI(apiOptions{
 		InsecureRegistry:      insecureRegistry,
 		SkipTlsVerifyRegistry: skipTlsVerifyRegistry,
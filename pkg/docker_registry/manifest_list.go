@@ -0,0 +1,203 @@
+package docker_registry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ManifestListEntry is the platform-specific image of the manifest list, the image must be stored in the same repository as the manifest list.
+type ManifestListEntry struct {
+	Platform  string
+	Reference string
+}
+
+// ParsePlatform parses the platform in the OS/ARCH[/VARIANT] format.
+func ParsePlatform(platform string) (v1.Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v1.Platform{}, fmt.Errorf("invalid platform %q: expected OS/ARCH[/VARIANT]", platform)
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return v1.Platform{}, fmt.Errorf("invalid platform %q: expected OS/ARCH[/VARIANT]", platform)
+		}
+	}
+
+	res := v1.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		res.Variant = parts[2]
+	}
+
+	return res, nil
+}
+
+func isPlatformMatched(platform, expected v1.Platform) bool {
+	return platform.OS == expected.OS && platform.Architecture == expected.Architecture && (expected.Variant == "" || platform.Variant == expected.Variant)
+}
+
+// PushManifestList writes the docker manifest list combining the platform-specific images by the reference.
+func (api *api) PushManifestList(ctx context.Context, reference string, entries []ManifestListEntry) error {
+	ref, err := name.ParseReference(reference, api.parseReferenceOptions()...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	var addendums []mutate.IndexAddendum
+	for _, entry := range entries {
+		platform, err := ParsePlatform(entry.Platform)
+		if err != nil {
+			return err
+		}
+
+		entryRef, err := name.ParseReference(entry.Reference, api.parseReferenceOptions()...)
+		if err != nil {
+			return fmt.Errorf("parsing reference %q: %v", entry.Reference, err)
+		}
+
+		desc, err := remote.Get(entryRef, api.remoteOptions(ctx)...)
+		if err != nil {
+			return fmt.Errorf("reading image %q: %v", entryRef, err)
+		}
+
+		img, err := desc.Image()
+		if err != nil {
+			return fmt.Errorf("reading image %q: %v", entryRef, err)
+		}
+
+		addendums = append(addendums, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &platform},
+		})
+	}
+
+	index := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.DockerManifestList), addendums...)
+
+	if err := remote.WriteIndex(ref, index, api.remoteOptions(ctx)...); err != nil {
+		return fmt.Errorf("write to the remote %s have failed: %s", ref.String(), err)
+	}
+
+	return nil
+}
+
+// GetRepoImagePlatformDigest returns the digest of the platform-specific image: the manifest list is resolved to the matching manifest,
+// the platform of a single-platform image is checked by the image config.
+func (api *api) GetRepoImagePlatformDigest(ctx context.Context, reference, platform string) (string, error) {
+	expectedPlatform, err := ParsePlatform(platform)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := name.ParseReference(reference, api.parseReferenceOptions()...)
+	if err != nil {
+		return "", fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	desc, err := remote.Get(ref, api.remoteOptions(ctx)...)
+	if err != nil {
+		return "", fmt.Errorf("reading image %q: %v", ref, err)
+	}
+
+	switch desc.MediaType {
+	case types.DockerManifestList, types.OCIImageIndex:
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return "", err
+		}
+
+		indexManifest, err := index.IndexManifest()
+		if err != nil {
+			return "", err
+		}
+
+		for _, manifest := range indexManifest.Manifests {
+			if manifest.Platform != nil && isPlatformMatched(*manifest.Platform, expectedPlatform) {
+				return manifest.Digest.String(), nil
+			}
+		}
+	default:
+		img, err := desc.Image()
+		if err != nil {
+			return "", err
+		}
+
+		configFile, err := img.ConfigFile()
+		if err != nil {
+			return "", err
+		}
+
+		// the variant is not available in the image config
+		if configFile.OS == expectedPlatform.OS && configFile.Architecture == expectedPlatform.Architecture {
+			return desc.Digest.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("image %s does not support platform %s", reference, platform)
+}
+
+// descriptorImage returns the image by the descriptor, the manifest list is resolved to the first platform-specific image.
+func descriptorImage(desc *remote.Descriptor) (v1.Image, error) {
+	switch desc.MediaType {
+	case types.DockerManifestList, types.OCIImageIndex:
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+
+		indexManifest, err := index.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(indexManifest.Manifests) == 0 {
+			return nil, fmt.Errorf("manifest list %s is empty", desc.Digest)
+		}
+
+		return index.Image(indexManifest.Manifests[0].Digest)
+	default:
+		return desc.Image()
+	}
+}
+
+// descriptorPlatformImageIDs returns the image IDs of the platform-specific images of the manifest list or nil for the image.
+func descriptorPlatformImageIDs(desc *remote.Descriptor) ([]string, error) {
+	switch desc.MediaType {
+	case types.DockerManifestList, types.OCIImageIndex:
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+
+		indexManifest, err := index.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+
+		var res []string
+		for _, manifest := range indexManifest.Manifests {
+			img, err := index.Image(manifest.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			configName, err := img.ConfigName()
+			if err != nil {
+				return nil, err
+			}
+
+			res = append(res, configName.String())
+		}
+
+		return res, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,96 @@
+package docker_registry_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/werf/werf/pkg/docker_registry"
+)
+
+var _ = Describe("Manifest list", func() {
+	It("should combine platform-specific images and resolve them by platform", func() {
+		ctx := context.Background()
+
+		server := httptest.NewServer(registry.New())
+		defer server.Close()
+
+		repo := strings.TrimPrefix(server.URL, "http://") + "/project"
+
+		pushPlatformImage := func(tag, os, arch string) string {
+			img, err := random.Image(1024, 1)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			configFile, err := img.ConfigFile()
+			Ω(err).ShouldNot(HaveOccurred())
+			configFile.OS = os
+			configFile.Architecture = arch
+
+			img, err = mutate.ConfigFile(img, configFile)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			ref, err := name.ParseReference(repo + ":" + tag)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(remote.Write(ref, img)).Should(Succeed())
+
+			digest, err := img.Digest()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return digest.String()
+		}
+
+		amd64Digest := pushPlatformImage("amd64", "linux", "amd64")
+		arm64Digest := pushPlatformImage("arm64", "linux", "arm64")
+
+		dockerRegistry, err := docker_registry.NewDockerRegistry(repo, docker_registry.DefaultImplementationName, docker_registry.DockerRegistryOptions{InsecureRegistry: true})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(dockerRegistry.PushManifestList(ctx, repo+":multiplatform", []docker_registry.ManifestListEntry{
+			{Platform: "linux/amd64", Reference: repo + ":amd64"},
+			{Platform: "linux/arm64/v8", Reference: repo + "@" + arm64Digest},
+		})).Should(Succeed())
+
+		info, err := dockerRegistry.GetRepoImage(ctx, repo+":multiplatform")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(info.Tag).Should(Equal("multiplatform"))
+		Ω(info.RepoDigest).ShouldNot(BeElementOf(amd64Digest, arm64Digest))
+
+		amd64Info, err := dockerRegistry.GetRepoImage(ctx, repo+":amd64")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(amd64Info.PlatformImageIDs).Should(BeEmpty())
+
+		arm64Info, err := dockerRegistry.GetRepoImage(ctx, repo+":arm64")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(info.ID).Should(Equal(amd64Info.ID))
+		Ω(info.PlatformImageIDs).Should(Equal([]string{amd64Info.ID, arm64Info.ID}))
+
+		Ω(dockerRegistry.GetRepoImagePlatformDigest(ctx, repo+":multiplatform", "linux/amd64")).Should(Equal(amd64Digest))
+		Ω(dockerRegistry.GetRepoImagePlatformDigest(ctx, repo+":multiplatform", "linux/arm64")).Should(Equal(arm64Digest))
+		Ω(dockerRegistry.GetRepoImagePlatformDigest(ctx, repo+":arm64", "linux/arm64")).Should(Equal(arm64Digest))
+
+		_, err = dockerRegistry.GetRepoImagePlatformDigest(ctx, repo+":multiplatform", "linux/arm/v7")
+		Ω(err).Should(HaveOccurred())
+
+		_, err = dockerRegistry.GetRepoImagePlatformDigest(ctx, repo+":amd64", "linux/arm64")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should parse platforms", func() {
+		Ω(docker_registry.ParsePlatform("linux/arm64/v8")).Should(Equal(v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}))
+
+		for _, platform := range []string{"linux", "linux/", "linux/arm/v7/extra", "/amd64"} {
+			_, err := docker_registry.ParsePlatform(platform)
+			Ω(err).Should(HaveOccurred(), platform)
+		}
+	})
+})
@@ -0,0 +1,142 @@
+package docker_registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+const NexusImplementationName = "nexus"
+
+type NexusNotFoundError apiError
+
+var nexusPatterns = []string{"^nexus\\..*"}
+
+// nexus expects the path based routing of the docker repository: HOSTNAME/REPOSITORY/IMAGE
+type nexus struct {
+	*defaultImplementation
+	nexusApi
+	nexusCredentials
+}
+
+type nexusOptions struct {
+	defaultImplementationOptions
+	nexusCredentials
+}
+
+type nexusCredentials struct {
+	username string
+	password string
+}
+
+func newNexus(options nexusOptions) (*nexus, error) {
+	d, err := newDefaultImplementation(options.defaultImplementationOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	nexus := &nexus{
+		defaultImplementation: d,
+		nexusApi:              newNexusApi(),
+		nexusCredentials:      options.nexusCredentials,
+	}
+
+	return nexus, nil
+}
+
+func (r *nexus) Tags(ctx context.Context, reference string) ([]string, error) {
+	components, err := r.searchComponents(ctx, reference, "")
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for _, component := range components {
+		tags = append(tags, component.Version)
+	}
+
+	return tags, nil
+}
+
+func (r *nexus) DeleteRepoImage(ctx context.Context, repoImage *image.Info) error {
+	components, err := r.searchComponents(ctx, repoImage.Repository, repoImage.Tag)
+	if err != nil {
+		return err
+	}
+
+	if len(components) == 0 {
+		return NexusNotFoundError{error: fmt.Errorf("component %s:%s not found", repoImage.Repository, repoImage.Tag)}
+	}
+
+	return r.deleteComponents(ctx, repoImage.Repository, components)
+}
+
+func (r *nexus) DeleteRepo(ctx context.Context, reference string) error {
+	components, err := r.searchComponents(ctx, reference, "")
+	if err != nil {
+		return err
+	}
+
+	return r.deleteComponents(ctx, reference, components)
+}
+
+func (r *nexus) searchComponents(ctx context.Context, reference, tag string) ([]nexusComponent, error) {
+	scheme, hostname, repository, imageName, err := r.parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	components, resp, err := r.nexusApi.SearchComponents(ctx, scheme, hostname, repository, imageName, tag, r.username, r.password)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, NexusNotFoundError{error: err}
+		}
+
+		return nil, err
+	}
+
+	return components, nil
+}
+
+func (r *nexus) deleteComponents(ctx context.Context, reference string, components []nexusComponent) error {
+	scheme, hostname, _, _, err := r.parseReference(reference)
+	if err != nil {
+		return err
+	}
+
+	for _, component := range components {
+		resp, err := r.nexusApi.DeleteComponent(ctx, scheme, hostname, component.Id, r.username, r.password)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				continue
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *nexus) String() string {
+	return NexusImplementationName
+}
+
+func (r *nexus) parseReference(reference string) (string, string, string, string, error) {
+	parsedReference, err := name.NewRepository(reference, r.parseReferenceOptions()...)
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	parts := strings.SplitN(parsedReference.RepositoryStr(), "/", 2)
+	if len(parts) != 2 {
+		return "", "", "", "", fmt.Errorf("unexpected reference %s: expected HOSTNAME/REPOSITORY/IMAGE", reference)
+	}
+
+	return parsedReference.Registry.Scheme(), parsedReference.RegistryStr(), parts[0], parts[1], nil
+}
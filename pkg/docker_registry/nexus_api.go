@@ -0,0 +1,101 @@
+package docker_registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+type nexusApi struct{}
+
+type nexusComponent struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func newNexusApi() nexusApi {
+	return nexusApi{}
+}
+
+// SearchComponents returns all docker components (tags) of the image, or the component of the specified tag only
+func (api *nexusApi) SearchComponents(ctx context.Context, scheme, hostname, repository, imageName, tag, username, password string) ([]nexusComponent, *http.Response, error) {
+	var components []nexusComponent
+	var continuationToken string
+
+	for {
+		u, err := url.Parse(scheme + "://" + hostname + "/service/rest/v1/search")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		query := u.Query()
+		query.Set("repository", repository)
+		query.Set("format", "docker")
+		query.Set("name", imageName)
+		if tag != "" {
+			query.Set("version", tag)
+		}
+		if continuationToken != "" {
+			query.Set("continuationToken", continuationToken)
+		}
+		u.RawQuery = query.Encode()
+
+		resp, respBody, err := doRequest(ctx, http.MethodGet, u.String(), nil, doRequestOptions{
+			Headers: map[string]string{
+				"Accept": "application/json",
+			},
+			BasicAuth: doRequestBasicAuth{
+				username: username,
+				password: password,
+			},
+			AcceptedCodes: []int{http.StatusOK},
+		})
+		if err != nil {
+			return nil, resp, err
+		}
+
+		respJson := &struct {
+			Items             []nexusComponent `json:"items"`
+			ContinuationToken string           `json:"continuationToken"`
+		}{}
+
+		if err := json.Unmarshal(respBody, respJson); err != nil {
+			return nil, resp, fmt.Errorf("unexpected body %s", string(respBody))
+		}
+
+		for _, component := range respJson.Items {
+			// the search by name is not exact
+			if component.Name == imageName {
+				components = append(components, component)
+			}
+		}
+
+		if respJson.ContinuationToken == "" {
+			return components, resp, nil
+		}
+		continuationToken = respJson.ContinuationToken
+	}
+}
+
+func (api *nexusApi) DeleteComponent(ctx context.Context, scheme, hostname, componentId, username, password string) (*http.Response, error) {
+	u, err := url.Parse(scheme + "://" + hostname + "/service/rest/v1/components")
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = path.Join(u.Path, componentId)
+
+	resp, _, err := doRequest(ctx, http.MethodDelete, u.String(), nil, doRequestOptions{
+		BasicAuth: doRequestBasicAuth{
+			username: username,
+			password: password,
+		},
+		AcceptedCodes: []int{http.StatusOK, http.StatusNoContent},
+	})
+
+	return resp, err
+}
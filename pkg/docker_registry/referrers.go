@@ -0,0 +1,514 @@
+package docker_registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+const (
+	OCIEmptyConfigMediaType = "application/vnd.oci.empty.v1+json"
+	ociEmptyConfigData      = "{}"
+)
+
+// PushArtifactOptions describes an OCI artifact (a signature, an SBOM, etc.), which is pushed as an OCI image manifest
+// with the subject field referencing the manifest of an image.
+type PushArtifactOptions struct {
+	ArtifactType string
+	Annotations  map[string]string
+	Blobs        []ArtifactBlob
+}
+
+type ArtifactBlob struct {
+	MediaType   string
+	Data        []byte
+	Annotations map[string]string
+}
+
+// Referrer is a descriptor of the OCI artifact, which references an image manifest.
+type Referrer struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type ociArtifactManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Subject       *ociDescriptor    `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndexManifest struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	MediaType     string     `json:"mediaType"`
+	Manifests     []Referrer `json:"manifests"`
+}
+
+// PushArtifact pushes the artifact referencing the subject image and returns the digest of the artifact manifest.
+// If the registry does not support the referrers API, the artifact is also added into the index tagged by the referrers tag schema (sha256-<hex>).
+func (api *api) PushArtifact(ctx context.Context, subjectReference string, opts PushArtifactOptions) (string, error) {
+	subjectRef, err := name.ParseReference(subjectReference, api.parseReferenceOptions()...)
+	if err != nil {
+		return "", fmt.Errorf("parsing reference %q: %v", subjectReference, err)
+	}
+
+	subject, err := remote.Head(subjectRef, api.remoteOptions(ctx)...)
+	if err != nil {
+		return "", fmt.Errorf("unable to get subject %s descriptor: %s", subjectReference, err)
+	}
+
+	img, err := newArtifactImage(opts, &ociDescriptor{
+		MediaType: string(subject.MediaType),
+		Digest:    subject.Digest.String(),
+		Size:      subject.Size,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to prepare artifact: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+
+	artifactRef := subjectRef.Context().Digest(digest.String())
+	if err := remote.Write(artifactRef, img, api.remoteOptions(ctx)...); err != nil {
+		return "", fmt.Errorf("write to the remote %s have failed: %s", artifactRef.String(), err)
+	}
+
+	if capabilities, err := api.GetCapabilities(ctx, subjectRef.Context().Name()); err != nil {
+		return "", err
+	} else if !capabilities.Referrers {
+		referrer := Referrer{
+			MediaType:    string(types.OCIManifestSchema1),
+			ArtifactType: opts.ArtifactType,
+			Digest:       digest.String(),
+			Size:         int64(len(img.rawManifest)),
+			Annotations:  opts.Annotations,
+		}
+
+		if err := api.updateReferrersTagSchemaIndex(ctx, subjectRef.Context(), subject.Digest.String(), func(referrers []Referrer) []Referrer {
+			for _, r := range referrers {
+				if r.Digest == referrer.Digest {
+					return referrers
+				}
+			}
+			return append(referrers, referrer)
+		}); err != nil {
+			return "", err
+		}
+	}
+
+	return digest.String(), nil
+}
+
+// GetReferrers returns the artifacts referencing the subject image using the referrers API or the referrers tag schema fallback,
+// the method is selected by the probed registry capabilities.
+func (api *api) GetReferrers(ctx context.Context, subjectReference string) ([]*Referrer, error) {
+	repo, subjectDigest, err := api.resolveSubject(ctx, subjectReference)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities, err := api.GetCapabilities(ctx, repo.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var referrers []Referrer
+	if capabilities.Referrers {
+		var supported bool
+		if referrers, supported, err = api.getReferrersByAPI(ctx, repo, subjectDigest); err != nil {
+			return nil, err
+		} else if !supported {
+			return nil, fmt.Errorf("container registry %s does not support the referrers API anymore: to probe the registry again remove %s", capabilities.Registry, capabilitiesCachePath(capabilities.Repository))
+		}
+	} else {
+		index, _, err := api.getReferrersTagSchemaIndex(ctx, repo, subjectDigest)
+		if err != nil {
+			return nil, err
+		}
+		referrers = index.Manifests
+	}
+
+	var res []*Referrer
+	for i := range referrers {
+		res = append(res, &referrers[i])
+	}
+
+	return res, nil
+}
+
+// RemoveReferrer removes the artifact from the referrers tag schema index of the subject (if the index exists).
+// The artifact manifest itself is not deleted, use DeleteArtifact to delete the artifact completely.
+func (api *api) RemoveReferrer(ctx context.Context, subjectReference string, referrer *Referrer) error {
+	repo, subjectDigest, err := api.resolveSubject(ctx, subjectReference)
+	if err != nil {
+		return err
+	}
+
+	_, exists, err := api.getReferrersTagSchemaIndex(ctx, repo, subjectDigest)
+	if err != nil {
+		return err
+	} else if !exists {
+		return nil
+	}
+
+	return api.updateReferrersTagSchemaIndex(ctx, repo, subjectDigest, func(referrers []Referrer) []Referrer {
+		var res []Referrer
+		for _, r := range referrers {
+			if r.Digest != referrer.Digest {
+				res = append(res, r)
+			}
+		}
+		return res
+	})
+}
+
+// DeleteArtifact deletes the artifact manifest by digest with the deletion method of the registry implementation
+// and removes the artifact from the referrers tag schema index of the subject.
+func DeleteArtifact(ctx context.Context, dockerRegistry DockerRegistry, subjectReference string, referrer *Referrer) error {
+	var repository string
+	if parts := strings.SplitN(subjectReference, "@", 2); len(parts) == 2 {
+		repository = parts[0]
+	} else {
+		repository, _ = image.ParseRepositoryAndTag(subjectReference)
+	}
+
+	if err := dockerRegistry.DeleteRepoImage(ctx, &image.Info{
+		Name:       strings.Join([]string{repository, referrer.Digest}, "@"),
+		Repository: repository,
+		RepoDigest: referrer.Digest,
+	}); err != nil && !IsManifestUnknownError(err) {
+		return fmt.Errorf("unable to delete artifact %s@%s: %s", repository, referrer.Digest, err)
+	}
+
+	return dockerRegistry.RemoveReferrer(ctx, subjectReference, referrer)
+}
+
+func (api *api) resolveSubject(ctx context.Context, subjectReference string) (name.Repository, string, error) {
+	subjectRef, err := name.ParseReference(subjectReference, api.parseReferenceOptions()...)
+	if err != nil {
+		return name.Repository{}, "", fmt.Errorf("parsing reference %q: %v", subjectReference, err)
+	}
+
+	if digestRef, ok := subjectRef.(name.Digest); ok {
+		return subjectRef.Context(), digestRef.DigestStr(), nil
+	}
+
+	subject, err := remote.Head(subjectRef, api.remoteOptions(ctx)...)
+	if err != nil {
+		return name.Repository{}, "", fmt.Errorf("unable to get subject %s descriptor: %s", subjectReference, err)
+	}
+
+	return subjectRef.Context(), subject.Digest.String(), nil
+}
+
+// getReferrersByAPI returns false if the registry does not support the referrers API
+func (api *api) getReferrersByAPI(ctx context.Context, repo name.Repository, subjectDigest string) ([]Referrer, bool, error) {
+	client, err := api.registryHttpClient(ctx, repo, transport.PullScope)
+	if err != nil {
+		return nil, false, err
+	}
+
+	url := fmt.Sprintf("%s://%s/v2/%s/referrers/%s", repo.Registry.Scheme(), repo.RegistryStr(), repo.RepositoryStr(), subjectDigest)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", string(types.OCIImageIndex))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("error requesting url %q: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, false, nil
+	case http.StatusOK:
+	default:
+		return nil, false, transport.CheckError(resp, http.StatusOK)
+	}
+
+	var index ociIndexManifest
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, false, fmt.Errorf("unable to unmarshal referrers index by url %q: %s", url, err)
+	}
+
+	return index.Manifests, true, nil
+}
+
+func referrersTagSchemaTag(subjectDigest string) string {
+	return strings.Replace(subjectDigest, ":", "-", 1)
+}
+
+func (api *api) getReferrersTagSchemaIndex(ctx context.Context, repo name.Repository, subjectDigest string) (*ociIndexManifest, bool, error) {
+	desc, err := remote.Get(repo.Tag(referrersTagSchemaTag(subjectDigest)), api.remoteOptions(ctx)...)
+	if err != nil {
+		if IsManifestUnknownError(err) || IsNameUnknownError(err) {
+			return &ociIndexManifest{}, false, nil
+		}
+		return nil, false, fmt.Errorf("unable to get referrers index of %s: %s", subjectDigest, err)
+	}
+
+	var index ociIndexManifest
+	if err := json.Unmarshal(desc.Manifest, &index); err != nil {
+		return nil, false, fmt.Errorf("unable to unmarshal referrers index of %s: %s", subjectDigest, err)
+	}
+
+	return &index, true, nil
+}
+
+// updateReferrersTagSchemaIndex replaces the referrers tag schema index with the updated one, the empty index is deleted
+func (api *api) updateReferrersTagSchemaIndex(ctx context.Context, repo name.Repository, subjectDigest string, updateFunc func([]Referrer) []Referrer) error {
+	index, exists, err := api.getReferrersTagSchemaIndex(ctx, repo, subjectDigest)
+	if err != nil {
+		return err
+	}
+
+	referrers := updateFunc(index.Manifests)
+	tag := repo.Tag(referrersTagSchemaTag(subjectDigest))
+
+	if len(referrers) == 0 {
+		if !exists {
+			return nil
+		}
+
+		desc, err := remote.Head(tag, api.remoteOptions(ctx)...)
+		if err != nil {
+			return fmt.Errorf("unable to get referrers index %s descriptor: %s", tag.String(), err)
+		}
+		return api.deleteImageByReference(repo.Digest(desc.Digest.String()).String())
+	}
+
+	data, err := json.Marshal(ociIndexManifest{
+		SchemaVersion: 2,
+		MediaType:     string(types.OCIImageIndex),
+		Manifests:     referrers,
+	})
+	if err != nil {
+		return err
+	}
+
+	client, err := api.registryHttpClient(ctx, repo, transport.PushScope)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", repo.Registry.Scheme(), repo.RegistryStr(), repo.RepositoryStr(), tag.TagStr())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(types.OCIImageIndex))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error requesting url %q: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusOK, http.StatusCreated, http.StatusAccepted); err != nil {
+		return fmt.Errorf("unable to put referrers index %s: %s", tag.String(), err)
+	}
+
+	return nil
+}
+
+func (api *api) registryHttpClient(ctx context.Context, repo name.Repository, action string) (*http.Client, error) {
+	auth, err := authn.DefaultKeychain.Resolve(repo)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve auth for %s: %s", repo.String(), err)
+	}
+
+	tr, err := transport.NewWithContext(ctx, repo.Registry, auth, api.getHttpTransport(), []string{repo.Scope(action)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: tr}, nil
+}
+
+func (api *api) remoteOptions(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+		remote.WithTransport(api.getHttpTransport()),
+		remote.WithContext(ctx),
+	}
+}
+
+// NewArtifactImage returns the OCI artifact without subject, which can be written with WriteRepoImageObject.
+func NewArtifactImage(opts PushArtifactOptions) (v1.Image, error) {
+	return newArtifactImage(opts, nil)
+}
+
+// artifactImage is the minimal v1.Image implementation to push the artifact manifest with remote.Write
+type artifactImage struct {
+	rawManifest []byte
+	layers      []v1.Layer
+}
+
+func newArtifactImage(opts PushArtifactOptions, subject *ociDescriptor) (*artifactImage, error) {
+	configDigest, configSize, err := v1.SHA256(strings.NewReader(ociEmptyConfigData))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := ociArtifactManifest{
+		SchemaVersion: 2,
+		MediaType:     string(types.OCIManifestSchema1),
+		ArtifactType:  opts.ArtifactType,
+		Config: ociDescriptor{
+			MediaType: OCIEmptyConfigMediaType,
+			Digest:    configDigest.String(),
+			Size:      configSize,
+		},
+		Layers:      []ociDescriptor{},
+		Subject:     subject,
+		Annotations: opts.Annotations,
+	}
+
+	img := &artifactImage{}
+	for _, blob := range opts.Blobs {
+		layer, err := newArtifactLayer(blob.MediaType, blob.Data)
+		if err != nil {
+			return nil, err
+		}
+		img.layers = append(img.layers, layer)
+
+		manifest.Layers = append(manifest.Layers, ociDescriptor{
+			MediaType:   blob.MediaType,
+			Digest:      layer.digest.String(),
+			Size:        int64(len(blob.Data)),
+			Annotations: blob.Annotations,
+		})
+	}
+
+	if img.rawManifest, err = json.Marshal(manifest); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+func (img *artifactImage) Layers() ([]v1.Layer, error) {
+	return img.layers, nil
+}
+
+func (img *artifactImage) MediaType() (types.MediaType, error) {
+	return types.OCIManifestSchema1, nil
+}
+
+func (img *artifactImage) Size() (int64, error) {
+	return int64(len(img.rawManifest)), nil
+}
+
+func (img *artifactImage) ConfigName() (v1.Hash, error) {
+	h, _, err := v1.SHA256(strings.NewReader(ociEmptyConfigData))
+	return h, err
+}
+
+func (img *artifactImage) ConfigFile() (*v1.ConfigFile, error) {
+	return &v1.ConfigFile{}, nil
+}
+
+func (img *artifactImage) RawConfigFile() ([]byte, error) {
+	return []byte(ociEmptyConfigData), nil
+}
+
+func (img *artifactImage) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(img.rawManifest))
+	return h, err
+}
+
+func (img *artifactImage) Manifest() (*v1.Manifest, error) {
+	return v1.ParseManifest(bytes.NewReader(img.rawManifest))
+}
+
+func (img *artifactImage) RawManifest() ([]byte, error) {
+	return img.rawManifest, nil
+}
+
+func (img *artifactImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	for _, layer := range img.layers {
+		if digest, _ := layer.Digest(); digest == h {
+			return layer, nil
+		}
+	}
+
+	return nil, fmt.Errorf("layer %s not found", h.String())
+}
+
+func (img *artifactImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	return img.LayerByDigest(h)
+}
+
+// artifactLayer is the blob of the artifact, the blob is not compressed, so that digest and diff id are equal
+type artifactLayer struct {
+	mediaType types.MediaType
+	data      []byte
+	digest    v1.Hash
+}
+
+func newArtifactLayer(mediaType string, data []byte) (*artifactLayer, error) {
+	digest, _, err := v1.SHA256(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &artifactLayer{mediaType: types.MediaType(mediaType), data: data, digest: digest}, nil
+}
+
+func (layer *artifactLayer) Digest() (v1.Hash, error) {
+	return layer.digest, nil
+}
+
+func (layer *artifactLayer) DiffID() (v1.Hash, error) {
+	return layer.digest, nil
+}
+
+func (layer *artifactLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(layer.data)), nil
+}
+
+func (layer *artifactLayer) Uncompressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(layer.data)), nil
+}
+
+func (layer *artifactLayer) Size() (int64, error) {
+	return int64(len(layer.data)), nil
+}
+
+func (layer *artifactLayer) MediaType() (types.MediaType, error) {
+	return layer.mediaType, nil
+}
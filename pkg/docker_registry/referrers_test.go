@@ -0,0 +1,198 @@
+package docker_registry_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/werf/werf/pkg/docker_registry"
+	"github.com/werf/werf/pkg/image"
+)
+
+// testRegistry extends the in-memory registry with manifests deletion and (optionally) the referrers API
+type testRegistry struct {
+	handler            http.Handler
+	referrersSupported bool
+
+	mux       sync.Mutex
+	deleted   map[string]bool
+	referrers map[string][]docker_registry.Referrer
+}
+
+func newTestRegistry(referrersSupported bool) *testRegistry {
+	return &testRegistry{
+		handler:            registry.New(),
+		referrersSupported: referrersSupported,
+		deleted:            map[string]bool{},
+		referrers:          map[string][]docker_registry.Referrer{},
+	}
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if strings.Contains(req.URL.Path, "/referrers/") {
+		if !r.referrersSupported {
+			http.NotFound(w, req)
+			return
+		}
+
+		subjectDigest := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+		manifests := []docker_registry.Referrer{}
+		for _, referrer := range r.referrers[subjectDigest] {
+			if !r.deleted[referrer.Digest] {
+				manifests = append(manifests, referrer)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"schemaVersion": 2, "manifests": manifests})
+		return
+	}
+
+	if !strings.Contains(req.URL.Path, "/manifests/") {
+		r.handler.ServeHTTP(w, req)
+		return
+	}
+
+	reference := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+
+	switch req.Method {
+	case http.MethodDelete:
+		r.deleted[reference] = true
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(req.Body)
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+		var manifest struct {
+			MediaType    string `json:"mediaType"`
+			ArtifactType string `json:"artifactType"`
+			Subject      *struct {
+				Digest string `json:"digest"`
+			} `json:"subject"`
+		}
+		if err := json.Unmarshal(data, &manifest); err == nil && manifest.Subject != nil {
+			r.referrers[manifest.Subject.Digest] = append(r.referrers[manifest.Subject.Digest], docker_registry.Referrer{
+				MediaType:    manifest.MediaType,
+				ArtifactType: manifest.ArtifactType,
+				Digest:       reference,
+				Size:         int64(len(data)),
+			})
+		}
+
+		rec := httptest.NewRecorder()
+		r.handler.ServeHTTP(rec, req)
+		delete(r.deleted, rec.Header().Get("Docker-Content-Digest"))
+		copyRecordedResponse(w, rec)
+	default:
+		rec := httptest.NewRecorder()
+		r.handler.ServeHTTP(rec, req)
+		if r.deleted[reference] || r.deleted[rec.Header().Get("Docker-Content-Digest")] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`)
+			return
+		}
+		copyRecordedResponse(w, rec)
+	}
+}
+
+// deletionRecorder checks that the artifacts are deleted with the deletion method of the registry implementation
+type deletionRecorder struct {
+	docker_registry.DockerRegistry
+	deletedDigests []string
+}
+
+func (r *deletionRecorder) DeleteRepoImage(ctx context.Context, repoImage *image.Info) error {
+	r.deletedDigests = append(r.deletedDigests, repoImage.RepoDigest)
+	return r.DockerRegistry.DeleteRepoImage(ctx, repoImage)
+}
+
+func copyRecordedResponse(w http.ResponseWriter, rec *httptest.ResponseRecorder) {
+	for key, values := range rec.Header() {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
+
+var _ = Describe("OCI artifacts referencing an image", func() {
+	for _, referrersSupported := range []bool{true, false} {
+		referrersSupported := referrersSupported
+
+		mode := "the referrers tag schema fallback"
+		if referrersSupported {
+			mode = "the referrers API"
+		}
+
+		It(fmt.Sprintf("should be pushed, listed and deleted using %s", mode), func() {
+			ctx := context.Background()
+
+			server := httptest.NewServer(newTestRegistry(referrersSupported))
+			defer server.Close()
+
+			repo := strings.TrimPrefix(server.URL, "http://") + "/test/repo"
+
+			img, err := random.Image(128, 1)
+			Ω(err).ShouldNot(HaveOccurred())
+			ref, err := name.ParseReference(repo+":subject", name.Insecure)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(remote.Write(ref, img)).Should(Succeed())
+
+			dockerRegistry, err := docker_registry.NewDockerRegistry(repo, docker_registry.DefaultImplementationName, docker_registry.DockerRegistryOptions{InsecureRegistry: true})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			referrers, err := dockerRegistry.GetReferrers(ctx, repo+":subject")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(referrers).Should(BeEmpty())
+
+			var digests []string
+			for _, artifactType := range []string{"application/vnd.dev.cosign.artifact.sig.v1+json", "application/spdx+json"} {
+				digest, err := dockerRegistry.PushArtifact(ctx, repo+":subject", docker_registry.PushArtifactOptions{
+					ArtifactType: artifactType,
+					Blobs:        []docker_registry.ArtifactBlob{{MediaType: artifactType, Data: []byte(artifactType)}},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+				digests = append(digests, digest)
+			}
+
+			referrers, err = dockerRegistry.GetReferrers(ctx, repo+":subject")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(referrers).Should(HaveLen(2))
+			Ω(referrers[0].Digest).Should(Equal(digests[0]))
+			Ω(referrers[0].ArtifactType).Should(Equal("application/vnd.dev.cosign.artifact.sig.v1+json"))
+			Ω(referrers[1].Digest).Should(Equal(digests[1]))
+
+			recorder := &deletionRecorder{DockerRegistry: dockerRegistry}
+			for _, referrer := range referrers {
+				Ω(docker_registry.DeleteArtifact(ctx, recorder, repo+":subject", referrer)).Should(Succeed())
+			}
+			Ω(recorder.deletedDigests).Should(Equal(digests))
+
+			referrers, err = dockerRegistry.GetReferrers(ctx, repo+":subject")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(referrers).Should(BeEmpty())
+
+			for _, digest := range digests {
+				exists, err := dockerRegistry.IsRepoImageExists(ctx, repo+"@"+digest)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(exists).Should(BeFalse())
+			}
+		})
+	}
+})
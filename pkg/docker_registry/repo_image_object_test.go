@@ -0,0 +1,71 @@
+package docker_registry_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/werf/werf/pkg/docker_registry"
+)
+
+var _ = Describe("Repo image object", func() {
+	It("should be read concurrently from the registry with skipped TLS verification without changing the default transport", func() {
+		ctx := context.Background()
+
+		server := httptest.NewTLSServer(registry.New())
+		defer server.Close()
+
+		repo := strings.TrimPrefix(server.URL, "https://") + "/project"
+
+		dockerRegistry, err := docker_registry.NewDockerRegistry(repo, docker_registry.DefaultImplementationName, docker_registry.DockerRegistryOptions{SkipTlsVerifyRegistry: true})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		img, err := random.Image(1024, 1)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(dockerRegistry.WriteRepoImageObject(ctx, repo+":image", img)).Should(Succeed())
+
+		expectedDigest, err := img.Digest()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		defaultTransport := http.DefaultTransport
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				repoImg, err := dockerRegistry.GetRepoImageObject(ctx, repo+":image")
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				digest, err := repoImg.Digest()
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				Ω(digest).Should(Equal(expectedDigest))
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		Ω(http.DefaultTransport).Should(BeIdenticalTo(defaultTransport))
+	})
+})
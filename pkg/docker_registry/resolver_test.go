@@ -22,6 +22,10 @@ var _ = DescribeTable("resolve implementation name", func(entry entry) {
 		imagesRepoAddress: "123456789012.dkr.ecr.test.amazonaws.com/repo",
 		expectation:       "ecr",
 	}),
+	Entry("artifactory", entry{
+		imagesRepoAddress: "company.jfrog.io/docker-local/repo",
+		expectation:       "artifactory",
+	}),
 	Entry("acr", entry{
 		imagesRepoAddress: "test.azurecr.io/repo",
 		expectation:       "acr",
@@ -46,8 +50,16 @@ var _ = DescribeTable("resolve implementation name", func(entry entry) {
 		imagesRepoAddress: "harbor.company.com/project/repo",
 		expectation:       "harbor",
 	}),
+	Entry("nexus", entry{
+		imagesRepoAddress: "nexus.company.com/docker-hosted/repo",
+		expectation:       "nexus",
+	}),
 	Entry("quay", entry{
 		imagesRepoAddress: "quay.io/account/repo",
 		expectation:       "quay",
 	}),
+	Entry("yandex", entry{
+		imagesRepoAddress: "cr.yandex/registry-id/repo",
+		expectation:       "yandex",
+	}),
 )
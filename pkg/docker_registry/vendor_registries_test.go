@@ -0,0 +1,140 @@
+package docker_registry_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/werf/werf/pkg/docker_registry"
+	"github.com/werf/werf/pkg/image"
+)
+
+var _ = Describe("Artifactory", func() {
+	It("should list and delete tags using the REST API", func() {
+		ctx := context.Background()
+
+		var mux sync.Mutex
+		tags := []string{"tag-1", "tag-2"}
+		var deletedPaths []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mux.Lock()
+			defer mux.Unlock()
+
+			if username, password, _ := req.BasicAuth(); username != "user" || password != "password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			switch {
+			case req.Method == http.MethodGet && req.URL.Path == "/artifactory/api/docker/docker-local/v2/group/app/tags/list":
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "group/app", "tags": tags})
+			case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/artifactory/api/docker/"):
+				w.WriteHeader(http.StatusNotFound)
+			case req.Method == http.MethodDelete:
+				deletedPaths = append(deletedPaths, req.URL.Path)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		defer server.Close()
+
+		repo := strings.TrimPrefix(server.URL, "http://") + "/docker-local/group/app"
+
+		dockerRegistry, err := docker_registry.NewDockerRegistry(repo, docker_registry.ArtifactoryImplementationName, docker_registry.DockerRegistryOptions{
+			InsecureRegistry:    true,
+			ArtifactoryUsername: "user",
+			ArtifactoryPassword: "password",
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(dockerRegistry.Tags(ctx, repo)).Should(Equal(tags))
+		Ω(dockerRegistry.Tags(ctx, strings.TrimPrefix(server.URL, "http://")+"/docker-local/unknown")).Should(BeEmpty())
+
+		Ω(dockerRegistry.DeleteRepoImage(ctx, &image.Info{Repository: repo, Tag: "tag-1"})).Should(Succeed())
+		Ω(dockerRegistry.DeleteRepo(ctx, repo)).Should(Succeed())
+		Ω(deletedPaths).Should(Equal([]string{"/artifactory/docker-local/group/app/tag-1", "/artifactory/docker-local/group/app"}))
+	})
+})
+
+var _ = Describe("Nexus", func() {
+	It("should list and delete components using the REST API", func() {
+		ctx := context.Background()
+
+		var mux sync.Mutex
+		var deletedComponents []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mux.Lock()
+			defer mux.Unlock()
+
+			if username, password, _ := req.BasicAuth(); username != "user" || password != "password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			switch {
+			case req.Method == http.MethodGet && req.URL.Path == "/service/rest/v1/search":
+				query := req.URL.Query()
+				Ω(query.Get("repository")).Should(Equal("docker-hosted"))
+				Ω(query.Get("format")).Should(Equal("docker"))
+
+				items := []map[string]string{
+					{"id": "id-1", "name": "app", "version": "tag-1"},
+					{"id": "id-2", "name": "app", "version": "tag-2"},
+					{"id": "id-3", "name": "app", "version": "tag-3"},
+					{"id": "id-4", "name": "app-other", "version": "tag-1"},
+				}
+
+				var res []map[string]string
+				for _, item := range items {
+					if version := query.Get("version"); version == "" || version == item["version"] {
+						res = append(res, item)
+					}
+				}
+
+				// the first page contains two items
+				switch query.Get("continuationToken") {
+				case "":
+					if len(res) > 2 {
+						_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": res[:2], "continuationToken": "next"})
+						return
+					}
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": res})
+				case "next":
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": res[2:]})
+				}
+			case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/service/rest/v1/components/"):
+				deletedComponents = append(deletedComponents, strings.TrimPrefix(req.URL.Path, "/service/rest/v1/components/"))
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		defer server.Close()
+
+		repo := strings.TrimPrefix(server.URL, "http://") + "/docker-hosted/app"
+
+		dockerRegistry, err := docker_registry.NewDockerRegistry(repo, docker_registry.NexusImplementationName, docker_registry.DockerRegistryOptions{
+			InsecureRegistry: true,
+			NexusUsername:    "user",
+			NexusPassword:    "password",
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(dockerRegistry.Tags(ctx, repo)).Should(Equal([]string{"tag-1", "tag-2", "tag-3"}))
+
+		Ω(dockerRegistry.DeleteRepoImage(ctx, &image.Info{Repository: repo, Tag: "tag-2"})).Should(Succeed())
+		Ω(deletedComponents).Should(Equal([]string{"id-2"}))
+
+		Ω(dockerRegistry.DeleteRepo(ctx, repo)).Should(Succeed())
+		Ω(deletedComponents).Should(Equal([]string{"id-2", "id-1", "id-2", "id-3"}))
+	})
+})
@@ -0,0 +1,200 @@
+package docker_registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+const YandexCrImplementationName = "yandex"
+
+type YandexCrNotFoundError apiError
+
+var yandexCrPatterns = []string{"^cr\\.yandex$", "^cr\\.cloud\\.yandex\\.net$"}
+
+// yandexCr expects references in the form cr.yandex/REGISTRY_ID/REPOSITORY
+type yandexCr struct {
+	*defaultImplementation
+	yandexCrApi
+	yandexCrCredentials
+
+	// imageIdByDigestByRepository is filled by the listing of the repository images, so that the cleanup deletes images without the listing for each deletion
+	imageIdByDigestByRepository    map[string]map[string]string
+	imageIdByDigestByRepositoryMux sync.Mutex
+}
+
+type yandexCrOptions struct {
+	defaultImplementationOptions
+	yandexCrCredentials
+}
+
+type yandexCrCredentials struct {
+	token string
+}
+
+func newYandexCr(options yandexCrOptions) (*yandexCr, error) {
+	d, err := newDefaultImplementation(options.defaultImplementationOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	yandexCr := &yandexCr{
+		defaultImplementation:       d,
+		yandexCrApi:                 newYandexCrApi(),
+		yandexCrCredentials:         options.yandexCrCredentials,
+		imageIdByDigestByRepository: map[string]map[string]string{},
+	}
+
+	return yandexCr, nil
+}
+
+func (r *yandexCr) Tags(ctx context.Context, reference string) ([]string, error) {
+	images, err := r.listImages(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for _, img := range images {
+		tags = append(tags, img.Tags...)
+	}
+
+	return tags, nil
+}
+
+// DeleteRepoImage deletes the image by digest with all its tags, the API does not support deletion of a single tag.
+// The image id is taken from the cached listing of the repository, the repository is listed again only for an unknown digest
+func (r *yandexCr) DeleteRepoImage(ctx context.Context, repoImage *image.Info) error {
+	imageId, err := r.getImageIdByDigest(ctx, repoImage.Repository, repoImage.RepoDigest)
+	if err != nil {
+		return err
+	}
+
+	if imageId == "" {
+		return YandexCrNotFoundError{error: fmt.Errorf("image %s@%s not found", repoImage.Repository, repoImage.RepoDigest)}
+	}
+
+	if err := r.deleteImage(ctx, yandexCrImage{Id: imageId, Digest: repoImage.RepoDigest}); err != nil {
+		return err
+	}
+
+	r.forgetImage(repoImage.Repository, repoImage.RepoDigest)
+
+	return nil
+}
+
+func (r *yandexCr) DeleteRepo(ctx context.Context, reference string) error {
+	images, err := r.listImages(ctx, reference)
+	if err != nil {
+		return err
+	}
+
+	for _, img := range images {
+		if err := r.deleteImage(ctx, img); err != nil {
+			return err
+		}
+
+		r.forgetImage(reference, img.Digest)
+	}
+
+	return nil
+}
+
+func (r *yandexCr) getImageIdByDigest(ctx context.Context, reference, digest string) (string, error) {
+	r.imageIdByDigestByRepositoryMux.Lock()
+	imageIdByDigest, isListed := r.imageIdByDigestByRepository[reference]
+	imageId := imageIdByDigest[digest]
+	r.imageIdByDigestByRepositoryMux.Unlock()
+
+	if imageId != "" {
+		return imageId, nil
+	}
+
+	if isListed {
+		// the image may be pushed after the listing
+		r.imageIdByDigestByRepositoryMux.Lock()
+		delete(r.imageIdByDigestByRepository, reference)
+		r.imageIdByDigestByRepositoryMux.Unlock()
+	}
+
+	if _, err := r.listImages(ctx, reference); err != nil {
+		return "", err
+	}
+
+	r.imageIdByDigestByRepositoryMux.Lock()
+	defer r.imageIdByDigestByRepositoryMux.Unlock()
+
+	return r.imageIdByDigestByRepository[reference][digest], nil
+}
+
+func (r *yandexCr) forgetImage(reference, digest string) {
+	r.imageIdByDigestByRepositoryMux.Lock()
+	defer r.imageIdByDigestByRepositoryMux.Unlock()
+
+	delete(r.imageIdByDigestByRepository[reference], digest)
+}
+
+func (r *yandexCr) listImages(ctx context.Context, reference string) ([]yandexCrImage, error) {
+	registryId, repositoryName, err := r.parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	images, resp, err := r.yandexCrApi.ListImages(ctx, registryId, repositoryName, r.token)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, YandexCrNotFoundError{error: err}
+		}
+
+		return nil, err
+	}
+
+	imageIdByDigest := map[string]string{}
+	for _, img := range images {
+		imageIdByDigest[img.Digest] = img.Id
+	}
+
+	r.imageIdByDigestByRepositoryMux.Lock()
+	r.imageIdByDigestByRepository[reference] = imageIdByDigest
+	r.imageIdByDigestByRepositoryMux.Unlock()
+
+	return images, nil
+}
+
+func (r *yandexCr) deleteImage(ctx context.Context, img yandexCrImage) error {
+	resp, err := r.yandexCrApi.DeleteImage(ctx, img.Id, r.token)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return YandexCrNotFoundError{error: err}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *yandexCr) String() string {
+	return YandexCrImplementationName
+}
+
+func (r *yandexCr) parseReference(reference string) (string, string, error) {
+	parsedReference, err := name.NewRepository(reference, r.parseReferenceOptions()...)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.SplitN(parsedReference.RepositoryStr(), "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("unexpected reference %s: expected cr.yandex/REGISTRY_ID/REPOSITORY", reference)
+	}
+
+	// the repository name includes the registry id
+	return parts[0], parsedReference.RepositoryStr(), nil
+}
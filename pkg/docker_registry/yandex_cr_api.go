@@ -0,0 +1,96 @@
+package docker_registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+const yandexCrAPIUrl = "https://container-registry.api.cloud.yandex.net/container-registry/v1"
+
+type yandexCrApi struct {
+	url string
+}
+
+type yandexCrImage struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Digest string   `json:"digest"`
+	Tags   []string `json:"tags"`
+}
+
+func newYandexCrApi() yandexCrApi {
+	return yandexCrApi{url: yandexCrAPIUrl}
+}
+
+func (api *yandexCrApi) ListImages(ctx context.Context, registryId, repositoryName, token string) ([]yandexCrImage, *http.Response, error) {
+	var images []yandexCrImage
+	var pageToken string
+
+	for {
+		u, err := url.Parse(api.url)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		u.Path = path.Join(u.Path, "images")
+
+		query := u.Query()
+		query.Set("registryId", registryId)
+		query.Set("repositoryName", repositoryName)
+		query.Set("pageSize", "1000")
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		u.RawQuery = query.Encode()
+
+		resp, respBody, err := doRequest(ctx, http.MethodGet, u.String(), nil, doRequestOptions{
+			Headers: map[string]string{
+				"Accept":        "application/json",
+				"Authorization": fmt.Sprintf("Bearer %s", token),
+			},
+			AcceptedCodes: []int{http.StatusOK},
+		})
+		if err != nil {
+			return nil, resp, err
+		}
+
+		respJson := &struct {
+			Images        []yandexCrImage `json:"images"`
+			NextPageToken string          `json:"nextPageToken"`
+		}{}
+
+		if err := json.Unmarshal(respBody, respJson); err != nil {
+			return nil, resp, fmt.Errorf("unexpected body %s", string(respBody))
+		}
+
+		images = append(images, respJson.Images...)
+
+		if respJson.NextPageToken == "" {
+			return images, resp, nil
+		}
+		pageToken = respJson.NextPageToken
+	}
+}
+
+func (api *yandexCrApi) DeleteImage(ctx context.Context, imageId, token string) (*http.Response, error) {
+	u, err := url.Parse(api.url)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = path.Join(u.Path, "images", imageId)
+
+	resp, _, err := doRequest(ctx, http.MethodDelete, u.String(), nil, doRequestOptions{
+		Headers: map[string]string{
+			"Accept":        "application/json",
+			"Authorization": fmt.Sprintf("Bearer %s", token),
+		},
+		AcceptedCodes: []int{http.StatusOK, http.StatusAccepted, http.StatusNoContent},
+	})
+
+	return resp, err
+}
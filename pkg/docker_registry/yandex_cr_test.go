@@ -0,0 +1,81 @@
+package docker_registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+var _ = Describe("Yandex Container Registry", func() {
+	It("should list tags and delete images using the REST API", func() {
+		ctx := context.Background()
+
+		var mux sync.Mutex
+		var deletedImages []string
+		var listRequests int
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mux.Lock()
+			defer mux.Unlock()
+
+			if req.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			switch {
+			case req.Method == http.MethodGet && req.URL.Path == "/container-registry/v1/images":
+				Ω(req.URL.Query().Get("repositoryName")).Should(Equal("crp123/app"))
+				listRequests++
+
+				if req.URL.Query().Get("pageToken") == "" {
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"images":        []yandexCrImage{{Id: "id-1", Digest: "sha256:1", Tags: []string{"tag-1", "tag-2"}}},
+						"nextPageToken": "next",
+					})
+				} else {
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"images": []yandexCrImage{{Id: "id-2", Digest: "sha256:2", Tags: []string{"tag-3"}}},
+					})
+				}
+			case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/container-registry/v1/images/"):
+				deletedImages = append(deletedImages, strings.TrimPrefix(req.URL.Path, "/container-registry/v1/images/"))
+				_, _ = w.Write([]byte(`{"id":"operation-id","done":false}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		defer server.Close()
+
+		registry, err := newYandexCr(yandexCrOptions{yandexCrCredentials: yandexCrCredentials{token: "token"}})
+		Ω(err).ShouldNot(HaveOccurred())
+		registry.yandexCrApi.url = server.URL + "/container-registry/v1"
+
+		Ω(registry.Tags(ctx, "cr.yandex/crp123/app")).Should(Equal([]string{"tag-1", "tag-2", "tag-3"}))
+
+		Ω(listRequests).Should(Equal(2))
+
+		// the listing is reused for the deletion
+		Ω(registry.DeleteRepoImage(ctx, &image.Info{Repository: "cr.yandex/crp123/app", RepoDigest: "sha256:2"})).Should(Succeed())
+		Ω(registry.DeleteRepoImage(ctx, &image.Info{Repository: "cr.yandex/crp123/app", RepoDigest: "sha256:1"})).Should(Succeed())
+		Ω(deletedImages).Should(Equal([]string{"id-2", "id-1"}))
+		Ω(listRequests).Should(Equal(2))
+
+		// the repository is listed again for the unknown digest
+		err = registry.DeleteRepoImage(ctx, &image.Info{Repository: "cr.yandex/crp123/app", RepoDigest: "sha256:3"})
+		Ω(err).Should(BeAssignableToTypeOf(YandexCrNotFoundError{}))
+		Ω(listRequests).Should(Equal(4))
+		deletedImages = nil
+
+		Ω(registry.DeleteRepo(ctx, "cr.yandex/crp123/app")).Should(Succeed())
+		Ω(deletedImages).Should(Equal([]string{"id-1", "id-2"}))
+	})
+})
@@ -39,7 +39,9 @@ func getBytesToFree(vu volumeutils.VolumeUsage, targetVolumeUsagePercentage floa
 	return uint64((float64(vu.TotalBytes) / 100.0) * allowedVolumeUsageToFree)
 }
 
-func RunGC(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsageMarginPercentage float64) error {
+// RunGC removes the old cache versions and the least recently used git data entries if the local cache volume usage exceeds the allowed percentage,
+// onRemoveFunc is called for each removed entry (optional)
+func RunGC(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsageMarginPercentage float64, onRemoveFunc func(entry GitDataEntry)) error {
 	if lock, err := lockGC(ctx, false); err != nil {
 		return err
 	} else {
@@ -145,6 +147,39 @@ func RunGC(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsage
 		logboek.Context(ctx).Default().LogF("Needed to free: %s\n", utils.RedF("%s", humanize.Bytes(bytesToFree)))
 	})
 
+	gitDataEntries, err := GetExistingGitDataEntries()
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(GitDataLruSort(gitDataEntries))
+
+	var freedBytes uint64
+	for _, entry := range gitDataEntries {
+		for _, path := range entry.GetPaths() {
+			logboek.Context(ctx).LogF("Removing %s\n", path)
+
+			if err := RemovePathWithEmptyParentDirsInsideScope(werf.GetLocalCacheDir(), path); err != nil {
+				return fmt.Errorf("unable to remove %q: %s", path, err)
+			}
+		}
+
+		freedBytes += entry.GetSize()
+
+		if onRemoveFunc != nil {
+			onRemoveFunc(entry)
+		}
+
+		if freedBytes >= bytesToFree {
+			break
+		}
+	}
+
+	return nil
+}
+
+// GetExistingGitDataEntries returns the git repos, worktrees, archives and patches of the current cache versions
+func GetExistingGitDataEntries() ([]GitDataEntry, error) {
 	var gitDataEntries []GitDataEntry
 
 	{
@@ -152,7 +187,7 @@ func RunGC(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsage
 
 		entries, err := GetExistingGitRepos(cacheVersionRoot)
 		if err != nil {
-			return fmt.Errorf("error getting existing git repos from %q: %s", cacheVersionRoot, err)
+			return nil, fmt.Errorf("error getting existing git repos from %q: %s", cacheVersionRoot, err)
 		}
 
 		for _, entry := range entries {
@@ -165,7 +200,7 @@ func RunGC(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsage
 
 		entries, err := GetExistingGitWorktrees(cacheVersionRoot)
 		if err != nil {
-			return fmt.Errorf("error getting existing git repos from %q: %s", cacheVersionRoot, err)
+			return nil, fmt.Errorf("error getting existing git repos from %q: %s", cacheVersionRoot, err)
 		}
 
 		for _, entry := range entries {
@@ -178,7 +213,7 @@ func RunGC(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsage
 
 		entries, err := GetExistingGitArchives(cacheVersionRoot)
 		if err != nil {
-			return fmt.Errorf("error getting existing git repos from %q: %s", cacheVersionRoot, err)
+			return nil, fmt.Errorf("error getting existing git repos from %q: %s", cacheVersionRoot, err)
 		}
 
 		for _, entry := range entries {
@@ -191,7 +226,7 @@ func RunGC(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsage
 
 		entries, err := GetExistingGitPatches(cacheVersionRoot)
 		if err != nil {
-			return fmt.Errorf("error getting existing git repos from %q: %s", cacheVersionRoot, err)
+			return nil, fmt.Errorf("error getting existing git repos from %q: %s", cacheVersionRoot, err)
 		}
 
 		for _, entry := range entries {
@@ -199,26 +234,7 @@ func RunGC(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsage
 		}
 	}
 
-	sort.Sort(GitDataLruSort(gitDataEntries))
-
-	var freedBytes uint64
-	for _, entry := range gitDataEntries {
-		for _, path := range entry.GetPaths() {
-			logboek.Context(ctx).LogF("Removing %s\n", path)
-
-			if err := RemovePathWithEmptyParentDirsInsideScope(werf.GetLocalCacheDir(), path); err != nil {
-				return fmt.Errorf("unable to remove %q: %s", path, err)
-			}
-		}
-
-		freedBytes += entry.GetSize()
-
-		if freedBytes >= bytesToFree {
-			break
-		}
-	}
-
-	return nil
+	return gitDataEntries, nil
 }
 
 func RemovePathWithEmptyParentDirsInsideScope(scopeDir, path string) error {
@@ -285,6 +301,11 @@ WipeCacheDirs:
 	return nil
 }
 
+// LockGC acquires the git data lock: the exclusive lock is required to remove the git data entries
+func LockGC(ctx context.Context, shared bool) (lockgate.LockHandle, error) {
+	return lockGC(ctx, shared)
+}
+
 func lockGC(ctx context.Context, shared bool) (lockgate.LockHandle, error) {
 	_, handle, err := werf.AcquireHostLock(ctx, "git_data_manager", lockgate.AcquireOptions{Shared: shared})
 	return handle, err
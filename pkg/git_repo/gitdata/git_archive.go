@@ -11,12 +11,17 @@ import (
 )
 
 type GitArchiveDesc struct {
+	RepoID       string
 	MetadataPath string
 	ArchivePath  string
 	Metadata     *ArchiveMetadata
 	Size         uint64
 }
 
+func (entry *GitArchiveDesc) GetRepoID() string {
+	return entry.RepoID
+}
+
 func (entry *GitArchiveDesc) GetPaths() []string {
 	return []string{entry.MetadataPath, entry.ArchivePath}
 }
@@ -84,7 +89,7 @@ func GetExistingGitArchives(cacheVersionRoot string) ([]*GitArchiveDesc, error)
 					continue
 				}
 
-				desc := &GitArchiveDesc{MetadataPath: path}
+				desc := &GitArchiveDesc{RepoID: filepath.Base(repoArchivesRootDir), MetadataPath: path}
 				res = append(res, desc)
 
 				if data, err := ioutil.ReadFile(path); err != nil {
@@ -3,6 +3,8 @@ package gitdata
 import "time"
 
 type GitDataEntry interface {
+	// GetRepoID returns the ID of the git repo the entry belongs to
+	GetRepoID() string
 	GetPaths() []string
 	GetSize() uint64
 	GetLastAccessAt() time.Time
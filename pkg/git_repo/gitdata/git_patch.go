@@ -11,12 +11,17 @@ import (
 )
 
 type GitPatchDesc struct {
+	RepoID       string
 	MetadataPath string
 	PatchPath    string
 	Metadata     *PatchMetadata
 	Size         uint64
 }
 
+func (entry *GitPatchDesc) GetRepoID() string {
+	return entry.RepoID
+}
+
 func (entry *GitPatchDesc) GetPaths() []string {
 	return []string{entry.MetadataPath, entry.PatchPath}
 }
@@ -84,7 +89,7 @@ func GetExistingGitPatches(cacheVersionRoot string) ([]*GitPatchDesc, error) {
 					continue
 				}
 
-				desc := &GitPatchDesc{MetadataPath: path}
+				desc := &GitPatchDesc{RepoID: filepath.Base(repoPatchesRootDir), MetadataPath: path}
 				res = append(res, desc)
 
 				if data, err := ioutil.ReadFile(path); err != nil {
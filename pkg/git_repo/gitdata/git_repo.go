@@ -12,11 +12,16 @@ import (
 )
 
 type GitRepoDesc struct {
+	RepoID       string
 	Path         string
 	LastAccessAt time.Time
 	Size         uint64
 }
 
+func (entry *GitRepoDesc) GetRepoID() string {
+	return entry.RepoID
+}
+
 func (entry *GitRepoDesc) GetPaths() []string {
 	return []string{entry.Path}
 }
@@ -64,6 +69,7 @@ func GetExistingGitRepos(cacheVersionRoot string) ([]*GitRepoDesc, error) {
 		}
 
 		res = append(res, &GitRepoDesc{
+			RepoID:       finfo.Name(),
 			Path:         repoPath,
 			Size:         size,
 			LastAccessAt: lastAccessAt,
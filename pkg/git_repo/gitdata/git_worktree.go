@@ -12,11 +12,16 @@ import (
 )
 
 type GitWorktreeDesc struct {
+	RepoID       string
 	Path         string
 	LastAccessAt time.Time
 	Size         uint64
 }
 
+func (entry *GitWorktreeDesc) GetRepoID() string {
+	return entry.RepoID
+}
+
 func (entry *GitWorktreeDesc) GetPaths() []string {
 	return []string{entry.Path}
 }
@@ -65,6 +70,7 @@ func GetExistingGitWorktrees(cacheVersionRoot string) ([]*GitWorktreeDesc, error
 			}
 
 			res = append(res, &GitWorktreeDesc{
+				RepoID:       finfo.Name(),
 				Path:         worktreePath,
 				Size:         size,
 				LastAccessAt: lastAccessAt,
@@ -0,0 +1,107 @@
+package gitdata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/werf/lockgate"
+
+	"github.com/werf/werf/pkg/werf"
+)
+
+const GitRepoProjectsCacheVersion = "1"
+
+// GitRepoProjectsRecord is the list of the projects which use the git data of the repo
+type GitRepoProjectsRecord struct {
+	RepoID   string
+	Projects []string
+}
+
+func GetGitRepoProjectsCacheRootDir() string {
+	return filepath.Join(werf.GetLocalCacheDir(), "git_repo_projects")
+}
+
+// RecordRepoProject records the project which uses the git data of the repo,
+// the host cleanup attributes the git data of the repo to the project only if there are no other projects using the repo
+func RecordRepoProject(ctx context.Context, repoID, projectName string) error {
+	if _, lock, err := werf.AcquireHostLock(ctx, fmt.Sprintf("git_repo_projects.%s", repoID), lockgate.AcquireOptions{}); err != nil {
+		return fmt.Errorf("error acquiring git repo %s projects lock: %s", repoID, err)
+	} else {
+		defer werf.ReleaseHostLock(lock)
+	}
+
+	record, err := readRepoProjectsRecord(repoID)
+	if err != nil {
+		return err
+	}
+
+	if record == nil {
+		record = &GitRepoProjectsRecord{RepoID: repoID}
+	}
+
+	for _, name := range record.Projects {
+		if name == projectName {
+			return nil
+		}
+	}
+
+	record.Projects = append(record.Projects, projectName)
+	sort.Strings(record.Projects)
+
+	path := getRepoProjectsRecordPath(repoID)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create dir %q: %s", filepath.Dir(path), err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshalling json: %s", err)
+	}
+
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing %q: %s", path, err)
+	}
+
+	return nil
+}
+
+// GetRepoProjects returns the projects which use the git data of the repo (empty if not recorded)
+func GetRepoProjects(repoID string) ([]string, error) {
+	record, err := readRepoProjectsRecord(repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		return nil, nil
+	}
+
+	return record.Projects, nil
+}
+
+func readRepoProjectsRecord(repoID string) (*GitRepoProjectsRecord, error) {
+	path := getRepoProjectsRecordPath(repoID)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %q: %s", path, err)
+	}
+
+	record := &GitRepoProjectsRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("error unmarshalling json from %q: %s", path, err)
+	}
+
+	return record, nil
+}
+
+func getRepoProjectsRecordPath(repoID string) string {
+	return filepath.Join(GetGitRepoProjectsCacheRootDir(), GitRepoProjectsCacheVersion, fmt.Sprintf("%s.json", repoID))
+}
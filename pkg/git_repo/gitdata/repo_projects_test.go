@@ -0,0 +1,54 @@
+package gitdata
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/werf/werf/pkg/werf"
+)
+
+func TestRecordRepoProject(t *testing.T) {
+	if err := werf.Init(t.TempDir(), t.TempDir()); err != nil {
+		t.Fatalf("unable to init werf: %s", err)
+	}
+
+	ctx := context.Background()
+
+	projects, err := GetRepoProjects("repo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(projects) != 0 {
+		t.Errorf("expected no projects for the repo not recorded, got %v", projects)
+	}
+
+	for _, projectName := range []string{"frontend", "backend", "frontend"} {
+		if err := RecordRepoProject(ctx, "repo", projectName); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if err := RecordRepoProject(ctx, "other-repo", "backend"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	projects, err = GetRepoProjects("repo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected := []string{"backend", "frontend"}; !reflect.DeepEqual(projects, expected) {
+		t.Errorf("expected %v, got %v", expected, projects)
+	}
+
+	projects, err = GetRepoProjects("other-repo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected := []string{"backend"}; !reflect.DeepEqual(projects, expected) {
+		t.Errorf("expected %v, got %v", expected, projects)
+	}
+}
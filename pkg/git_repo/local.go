@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 
 	"github.com/werf/logboek"
@@ -80,7 +81,7 @@ func OpenLocalRepo(ctx context.Context, name, workTreeDir string, opts OpenLocal
 			context.Background(),
 			l.GitDir,
 			l.WorkTreeDir,
-			l.getRepoWorkTreeCacheDir(l.getRepoID()),
+			l.getRepoWorkTreeCacheDir(l.GetRepoID()),
 			l.headCommit,
 			true_git.SyncSourceWorktreeWithServiceWorktreeBranchOptions{
 				OnlyStagedChanges: opts.ServiceHeadCommitOptions.WithStagedChangesOnly,
@@ -208,7 +209,7 @@ func (repo *Local) IsShallowClone() (bool, error) {
 }
 
 func (repo *Local) CreateDetachedMergeCommit(ctx context.Context, fromCommit, toCommit string) (string, error) {
-	return repo.createDetachedMergeCommit(ctx, repo.GitDir, repo.WorkTreeDir, repo.getRepoWorkTreeCacheDir(repo.getRepoID()), fromCommit, toCommit)
+	return repo.createDetachedMergeCommit(ctx, repo.GitDir, repo.WorkTreeDir, repo.getRepoWorkTreeCacheDir(repo.GetRepoID()), fromCommit, toCommit)
 }
 
 func (repo *Local) GetMergeCommitParents(_ context.Context, commit string) ([]string, error) {
@@ -247,12 +248,30 @@ func (repo *Local) HeadCommit(_ context.Context) (string, error) {
 	return repo.headCommit, nil
 }
 
+// ResolveCommit returns the commit hash of the revision (branch, tag, abbreviated commit, etc.)
+func (repo *Local) ResolveCommit(_ context.Context, rev string) (string, error) {
+	var commit string
+	if err := repo.withNonThreadSafeRepository(func(repository *git.Repository) error {
+		hash, err := repository.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return err
+		}
+
+		commit = hash.String()
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("unable to resolve revision %q: %s", rev, err)
+	}
+
+	return commit, nil
+}
+
 func (repo *Local) GetOrCreatePatch(ctx context.Context, opts PatchOptions) (Patch, error) {
-	return repo.getOrCreatePatch(ctx, repo.WorkTreeDir, repo.GitDir, repo.getRepoID(), repo.getRepoWorkTreeCacheDir(repo.getRepoID()), opts)
+	return repo.getOrCreatePatch(ctx, repo.WorkTreeDir, repo.GitDir, repo.GetRepoID(), repo.getRepoWorkTreeCacheDir(repo.GetRepoID()), opts)
 }
 
 func (repo *Local) GetOrCreateArchive(ctx context.Context, opts ArchiveOptions) (Archive, error) {
-	return repo.getOrCreateArchive(ctx, repo.WorkTreeDir, repo.GitDir, repo.getRepoID(), repo.getRepoWorkTreeCacheDir(repo.getRepoID()), opts)
+	return repo.getOrCreateArchive(ctx, repo.WorkTreeDir, repo.GitDir, repo.GetRepoID(), repo.getRepoWorkTreeCacheDir(repo.GetRepoID()), opts)
 }
 
 func (repo *Local) GetOrCreateChecksum(ctx context.Context, opts ChecksumOptions) (checksum string, err error) {
@@ -285,7 +304,8 @@ func (repo *Local) RemoteBranchesList(_ context.Context) ([]string, error) {
 	return repo.remoteBranchesList(repo.WorkTreeDir)
 }
 
-func (repo *Local) getRepoID() string {
+// GetRepoID returns the ID of the repo, which is used to store the git data of the repo in the local cache
+func (repo *Local) GetRepoID() string {
 	absPath, err := filepath.Abs(repo.WorkTreeDir)
 	if err != nil {
 		panic(err) // stupid interface of filepath.Abs
@@ -969,7 +989,7 @@ func (repo *Local) yieldRepositoryBackedByWorkTree(ctx context.Context, commit s
 			defer werf.ReleaseHostLock(lock)
 		}
 
-		return true_git.WithWorkTree(ctx, repo.GitDir, repo.getRepoWorkTreeCacheDir(repo.getRepoID()), commit, true_git.WithWorkTreeOptions{HasSubmodules: hasSubmodules}, func(preparedWorkTreeDir string) error {
+		return true_git.WithWorkTree(ctx, repo.GitDir, repo.getRepoWorkTreeCacheDir(repo.GetRepoID()), commit, true_git.WithWorkTreeOptions{HasSubmodules: hasSubmodules}, func(preparedWorkTreeDir string) error {
 			repositoryWithPreparedWorktree, err := true_git.GitOpenWithCustomWorktreeDir(repo.GitDir, preparedWorkTreeDir)
 			if err != nil {
 				return err
@@ -50,7 +50,7 @@ func (repo *Remote) ValidateEndpoint() error {
 }
 
 func (repo *Remote) CreateDetachedMergeCommit(ctx context.Context, fromCommit, toCommit string) (string, error) {
-	return repo.createDetachedMergeCommit(ctx, repo.GetClonePath(), repo.GetClonePath(), repo.getWorkTreeCacheDir(repo.getRepoID()), fromCommit, toCommit)
+	return repo.createDetachedMergeCommit(ctx, repo.GetClonePath(), repo.GetClonePath(), repo.getWorkTreeCacheDir(repo.GetRepoID()), fromCommit, toCommit)
 }
 
 func (repo *Remote) GetMergeCommitParents(_ context.Context, commit string) ([]string, error) {
@@ -66,7 +66,7 @@ func (repo *Remote) getFilesystemRelativePathByEndpoint() string {
 }
 
 func (repo *Remote) GetClonePath() string {
-	return filepath.Join(GetGitRepoCacheDir(), repo.getRepoID())
+	return filepath.Join(GetGitRepoCacheDir(), repo.GetRepoID())
 }
 
 func (repo *Remote) RemoteOriginUrl() (string, error) {
@@ -309,11 +309,11 @@ func (repo *Remote) TagCommit(ctx context.Context, tag string) (string, error) {
 }
 
 func (repo *Remote) GetOrCreatePatch(ctx context.Context, opts PatchOptions) (Patch, error) {
-	return repo.getOrCreatePatch(ctx, repo.GetClonePath(), repo.GetClonePath(), repo.getRepoID(), repo.getWorkTreeCacheDir(repo.getRepoID()), opts)
+	return repo.getOrCreatePatch(ctx, repo.GetClonePath(), repo.GetClonePath(), repo.GetRepoID(), repo.getWorkTreeCacheDir(repo.GetRepoID()), opts)
 }
 
 func (repo *Remote) GetOrCreateArchive(ctx context.Context, opts ArchiveOptions) (Archive, error) {
-	return repo.getOrCreateArchive(ctx, repo.GetClonePath(), repo.GetClonePath(), repo.getRepoID(), repo.getWorkTreeCacheDir(repo.getRepoID()), opts)
+	return repo.getOrCreateArchive(ctx, repo.GetClonePath(), repo.GetClonePath(), repo.GetRepoID(), repo.getWorkTreeCacheDir(repo.GetRepoID()), opts)
 }
 
 func (repo *Remote) GetOrCreateChecksum(ctx context.Context, opts ChecksumOptions) (checksum string, err error) {
@@ -329,7 +329,8 @@ func (repo *Remote) IsCommitExists(ctx context.Context, commit string) (bool, er
 	return repo.isCommitExists(ctx, repo.GetClonePath(), repo.GetClonePath(), commit)
 }
 
-func (repo *Remote) getRepoID() string {
+// GetRepoID returns the ID of the repo, which is used to store the clone and the git data of the repo in the local cache
+func (repo *Remote) GetRepoID() string {
 	return util.Sha256Hash(repo.getFilesystemRelativePathByEndpoint())
 }
 
@@ -377,7 +378,7 @@ func (repo *Remote) yieldRepositoryBackedByWorkTree(ctx context.Context, commit
 		return err
 	}
 
-	return true_git.WithWorkTree(ctx, repo.GetClonePath(), repo.getWorkTreeCacheDir(repo.getRepoID()), commit, true_git.WithWorkTreeOptions{HasSubmodules: hasSubmodules}, func(preparedWorkTreeDir string) error {
+	return true_git.WithWorkTree(ctx, repo.GetClonePath(), repo.getWorkTreeCacheDir(repo.GetRepoID()), commit, true_git.WithWorkTreeOptions{HasSubmodules: hasSubmodules}, func(preparedWorkTreeDir string) error {
 		repositoryWithPreparedWorktree, err := true_git.GitOpenWithCustomWorktreeDir(repo.GetClonePath(), preparedWorkTreeDir)
 		if err != nil {
 			return err
@@ -0,0 +1,56 @@
+package host_cleaning
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/werf"
+)
+
+const DefaultDaemonInterval = 5 * time.Minute
+
+// RunHostCleanupDaemon runs the host cleanup with the interval until the context is done or the process receives SIGINT or SIGTERM.
+// The failed iteration does not stop the daemon, only one daemon can run on the host
+func RunHostCleanupDaemon(ctx context.Context, options HostCleanupOptions, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid daemon interval %s: positive duration expected", interval)
+	}
+
+	isAcquired, lock, err := werf.AcquireHostLock(ctx, "host_cleanup_daemon", lockgate.AcquireOptions{NonBlocking: true})
+	if err != nil {
+		return fmt.Errorf("unable to acquire host cleanup daemon lock: %s", err)
+	} else if !isAcquired {
+		return fmt.Errorf("host cleanup daemon is already running on this host")
+	}
+	defer werf.ReleaseHostLock(lock)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for iteration := 1; ; iteration++ {
+		if err := logboek.Context(ctx).Default().LogProcess("Running host cleanup (iteration %d)", iteration).DoError(func() error {
+			return RunHostCleanup(ctx, options)
+		}); err != nil {
+			logboek.Context(ctx).Warn().LogF("WARNING: host cleanup failed: %s\n", err)
+		}
+
+		logboek.Context(ctx).Default().LogF("Next host cleanup in %s\n", interval)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig := <-signals:
+			logboek.Context(ctx).Default().LogF("Received %s: stopping host cleanup daemon\n", sig)
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
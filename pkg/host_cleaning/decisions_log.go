@@ -0,0 +1,76 @@
+package host_cleaning
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/werf/logboek"
+)
+
+const (
+	DecisionStorageDocker     = "docker"
+	DecisionStorageLocalCache = "local-cache"
+
+	DecisionRemove = "remove"
+	DecisionKeep   = "keep"
+	DecisionSkip   = "skip"
+
+	DecisionReasonProjectQuotaExceeded   = "project-quota-exceeded"
+	DecisionReasonWithinProjectQuota     = "within-project-quota"
+	DecisionReasonVolumeUsageExceeded    = "volume-usage-exceeded"
+	DecisionReasonLocalCacheSizeExceeded = "local-cache-size-exceeded"
+	DecisionReasonLocked                 = "locked"
+	DecisionReasonRemovalFailed          = "removal-failed"
+	DecisionReasonUnstoredStageExpired   = "unstored-stage-expired"
+)
+
+// HostCleanupDecision is the record of the decisions log: the removal or the skip of the image or the local cache entry,
+// or the project usage summary of the docker images and the local cache (the storage and the object are empty)
+type HostCleanupDecision struct {
+	Time       time.Time  `json:"time"`
+	Storage    string     `json:"storage,omitempty"`
+	Project    string     `json:"project,omitempty"`
+	Object     string     `json:"object,omitempty"`
+	Bytes      uint64     `json:"bytes"`
+	QuotaBytes uint64     `json:"quotaBytes,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	Decision   string     `json:"decision"`
+	Reason     string     `json:"reason"`
+	DryRun     bool       `json:"dryRun,omitempty"`
+}
+
+// DecisionsLog writes the host cleanup decisions as JSON lines, nil DecisionsLog discards the decisions
+type DecisionsLog struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+func NewDecisionsLog(w io.Writer) *DecisionsLog {
+	return &DecisionsLog{w: w}
+}
+
+func (l *DecisionsLog) Record(ctx context.Context, decision HostCleanupDecision) {
+	if l == nil {
+		return
+	}
+
+	if decision.Time.IsZero() {
+		decision.Time = time.Now()
+	}
+
+	data, err := json.Marshal(decision)
+	if err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: unable to marshal host cleanup decision: %s\n", err)
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: unable to write host cleanup decision: %s\n", err)
+	}
+}
@@ -3,6 +3,7 @@ package host_cleaning
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/werf/logboek"
@@ -24,10 +25,19 @@ type HostCleanupOptions struct {
 	AllowedDockerStorageVolumeUsageMarginPercentage *uint
 	AllowedLocalCacheVolumeUsagePercentage          *uint
 	AllowedLocalCacheVolumeUsageMarginPercentage    *uint
+	// AllowedLocalCacheSize limits the total size of the git data, manifests and helm chart dependencies caches (no limit if zero)
+	AllowedLocalCacheSize uint64
+
+	// ProjectQuotas limit the docker storage and the local cache used by each project, the least recently used data of the project is removed first
+	ProjectQuotas ProjectQuotas
+	// DecisionsLog records the removals and the skips made by the host cleanup (optional)
+	DecisionsLog *DecisionsLog
 
 	DryRun                  bool
 	Force                   bool
 	DockerServerStoragePath string
+	// SkipLocalDockerServer should be set when the local docker server is not used (e.g. by the buildah container runtime)
+	SkipLocalDockerServer bool
 }
 
 func getOptionValueOrDefault(optionValue *uint, defaultValue float64) float64 {
@@ -56,6 +66,7 @@ func RunAutoHostCleanup(ctx context.Context, options HostCleanupOptions) error {
 		logboek.Context(ctx).Default().LogFDetails(" - old unused files from werf caches (which are stored in the ~/.werf/local_cache);\n")
 		logboek.Context(ctx).Default().LogFDetails(" - old temporary service files /tmp/werf-project-data-* and /tmp/werf-config-render-*;\n")
 		logboek.Context(ctx).Default().LogFDetails(" - least recently used werf images;\n")
+		logboek.Context(ctx).Default().LogFDetails(" - stage images, which have been built but not stored into the repo by the interrupted builds;\n")
 		logboek.Context(ctx).Default().LogLn()
 		logboek.Context(ctx).Default().LogFDetails("NOTE: Werf-host-cleanup procedure of v1.2 werf version will not cleanup --stages-storage=:local stages of v1.1 werf version, because this is primary stages storage data, and it can only be cleaned by the regular per-project werf-cleanup command with git-history based algorithm.\n")
 		logboek.Context(ctx).Default().LogLn()
@@ -84,7 +95,17 @@ func RunHostCleanup(ctx context.Context, options HostCleanupOptions) error {
 	allowedDockerStorageVolumeUsageMarginPercentage := getOptionValueOrDefault(options.AllowedDockerStorageVolumeUsageMarginPercentage, DefaultAllowedDockerStorageVolumeUsageMarginPercentage)
 
 	if err := logboek.Context(ctx).Default().LogProcess("Running GC for git data").DoError(func() error {
-		if err := gitdata.RunGC(ctx, allowedLocalCacheVolumeUsagePercentage, allowedLocalCacheVolumeUsageMarginPercentage); err != nil {
+		if err := gitdata.RunGC(ctx, allowedLocalCacheVolumeUsagePercentage, allowedLocalCacheVolumeUsageMarginPercentage, func(entry gitdata.GitDataEntry) {
+			lastAccessAt := entry.GetLastAccessAt()
+			options.DecisionsLog.Record(ctx, HostCleanupDecision{
+				Storage:    DecisionStorageLocalCache,
+				Object:     strings.Join(entry.GetPaths(), ","),
+				Bytes:      entry.GetSize(),
+				LastUsedAt: &lastAccessAt,
+				Decision:   DecisionRemove,
+				Reason:     DecisionReasonVolumeUsageExceeded,
+			})
+		}); err != nil {
 			return fmt.Errorf("git repo GC failed: %s", err)
 		}
 		return nil
@@ -92,13 +113,46 @@ func RunHostCleanup(ctx context.Context, options HostCleanupOptions) error {
 		return err
 	}
 
+	if err := logboek.Context(ctx).Default().LogProcess("Running GC for local cache").DoError(func() error {
+		if err := RunGCForLocalCache(ctx, options.AllowedLocalCacheSize, options.DecisionsLog, options.DryRun); err != nil {
+			return fmt.Errorf("local cache GC failed: %s", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if !options.ProjectQuotas.IsEmpty() {
+		if err := logboek.Context(ctx).Default().LogProcess("Running project quotas GC").DoError(func() error {
+			if err := RunProjectQuotasGC(ctx, options.ProjectQuotas, options.DecisionsLog, options.SkipLocalDockerServer, options.Force, options.DryRun); err != nil {
+				return fmt.Errorf("project quotas GC failed: %s", err)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if options.SkipLocalDockerServer {
+		return nil
+	}
+
+	if err := logboek.Context(ctx).Default().LogProcess("Running GC for unstored stage images").DoError(func() error {
+		if err := RunGCForUnstoredStageImages(ctx, options.DecisionsLog, options.DryRun); err != nil {
+			return fmt.Errorf("unstored stage images GC failed: %s", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
 	dockerServerStoragePath, err := getDockerServerStoragePath(ctx, options.DockerServerStoragePath)
 	if err != nil {
 		return fmt.Errorf("error getting local docker server storage path: %s", err)
 	}
 
 	return logboek.Context(ctx).Default().LogProcess("Running GC for local docker server").DoError(func() error {
-		if err := RunGCForLocalDockerServer(ctx, allowedDockerStorageVolumeUsagePercentage, allowedDockerStorageVolumeUsageMarginPercentage, dockerServerStoragePath, options.Force, options.DryRun); err != nil {
+		if err := RunGCForLocalDockerServer(ctx, allowedDockerStorageVolumeUsagePercentage, allowedDockerStorageVolumeUsageMarginPercentage, dockerServerStoragePath, options.DecisionsLog, options.Force, options.DryRun); err != nil {
 			return fmt.Errorf("local docker server GC failed: %s", err)
 		}
 		return nil
@@ -134,6 +188,10 @@ func ShouldRunAutoHostCleanup(ctx context.Context, options HostCleanupOptions) (
 		return true, nil
 	}
 
+	if options.SkipLocalDockerServer {
+		return false, nil
+	}
+
 	dockerServerStoragePath, err := getDockerServerStoragePath(ctx, options.DockerServerStoragePath)
 	if err != nil {
 		return false, fmt.Errorf("error getting local docker server storage path: %s", err)
@@ -0,0 +1,393 @@
+package host_cleaning
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/werf/kubedog/pkg/utils"
+	"github.com/werf/lockgate"
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/deploy/helm/chart_extender"
+	"github.com/werf/werf/pkg/git_repo/gitdata"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage/lrumeta"
+	"github.com/werf/werf/pkg/volumeutils"
+	"github.com/werf/werf/pkg/werf"
+)
+
+const (
+	LocalCacheTypeGitRepos              = "git-repos"
+	LocalCacheTypeGitWorktrees          = "git-worktrees"
+	LocalCacheTypeGitArchives           = "git-archives"
+	LocalCacheTypeGitPatches            = "git-patches"
+	LocalCacheTypeManifests             = "manifests"
+	LocalCacheTypeHelmChartDependencies = "helm-chart-dependencies"
+)
+
+// LocalCacheEntry is the entry of the werf local cache which is removed by the host cleanup as a whole.
+// The project is known only for the entries of the single project (e.g. manifests of the project images,
+// git data of the repo used only by the project), other entries are shared
+type LocalCacheEntry struct {
+	Type         string
+	Project      string
+	Paths        []string
+	Size         uint64
+	LastAccessAt time.Time
+
+	manifestCacheEntry *image.ManifestCacheEntry
+}
+
+// GetLocalCacheEntries returns the entries of the git data, manifests and helm chart dependencies caches.
+// The git data lock should be held by the caller
+func GetLocalCacheEntries(ctx context.Context) ([]*LocalCacheEntry, error) {
+	var res []*LocalCacheEntry
+
+	gitDataEntries, err := gitdata.GetExistingGitDataEntries()
+	if err != nil {
+		return nil, fmt.Errorf("error getting git data entries: %s", err)
+	}
+
+	projectsByRepoID := map[string][]string{}
+	for _, gitDataEntry := range gitDataEntries {
+		repoID := gitDataEntry.GetRepoID()
+		if _, ok := projectsByRepoID[repoID]; !ok {
+			projects, err := gitdata.GetRepoProjects(repoID)
+			if err != nil {
+				return nil, fmt.Errorf("error getting git repo %s projects: %s", repoID, err)
+			}
+			projectsByRepoID[repoID] = projects
+		}
+
+		var projectName string
+		if projects := projectsByRepoID[repoID]; len(projects) == 1 {
+			projectName = projects[0]
+		}
+
+		var entryType string
+		switch gitDataEntry.(type) {
+		case *gitdata.GitRepoDesc:
+			entryType = LocalCacheTypeGitRepos
+		case *gitdata.GitWorktreeDesc:
+			entryType = LocalCacheTypeGitWorktrees
+		case *gitdata.GitArchiveDesc:
+			entryType = LocalCacheTypeGitArchives
+		case *gitdata.GitPatchDesc:
+			entryType = LocalCacheTypeGitPatches
+		default:
+			panic(fmt.Sprintf("unexpected git data entry %T", gitDataEntry))
+		}
+
+		res = append(res, &LocalCacheEntry{
+			Type:         entryType,
+			Project:      projectName,
+			Paths:        gitDataEntry.GetPaths(),
+			Size:         gitDataEntry.GetSize(),
+			LastAccessAt: gitDataEntry.GetLastAccessAt(),
+		})
+	}
+
+	manifestCacheEntries, err := image.CommonManifestCache.GetEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting manifest cache entries: %s", err)
+	}
+
+	for _, manifestCacheEntry := range manifestCacheEntries {
+		res = append(res, &LocalCacheEntry{
+			Type:               LocalCacheTypeManifests,
+			Project:            manifestCacheEntry.Labels[image.WerfLabel],
+			Paths:              []string{manifestCacheEntry.Path},
+			Size:               manifestCacheEntry.Size,
+			LastAccessAt:       manifestCacheEntry.LastAccessAt,
+			manifestCacheEntry: manifestCacheEntry,
+		})
+	}
+
+	chartDependenciesEntries, err := getChartDependenciesCacheEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting helm chart dependencies cache entries: %s", err)
+	}
+	res = append(res, chartDependenciesEntries...)
+
+	return res, nil
+}
+
+func getChartDependenciesCacheEntries(ctx context.Context) ([]*LocalCacheEntry, error) {
+	cacheVersionRoot := filepath.Join(chart_extender.GetChartDependenciesCacheRootDir(), chart_extender.ChartDependenciesCacheVersion)
+
+	if _, err := os.Stat(cacheVersionRoot); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error accessing dir %q: %s", cacheVersionRoot, err)
+	}
+
+	files, err := ioutil.ReadDir(cacheVersionRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dir %q: %s", cacheVersionRoot, err)
+	}
+
+	var res []*LocalCacheEntry
+	for _, finfo := range files {
+		// skip the dependencies being built at the moment
+		if !finfo.IsDir() || strings.Contains(finfo.Name(), ".tmp.") {
+			continue
+		}
+
+		depsDir := filepath.Join(cacheVersionRoot, finfo.Name())
+
+		size, err := volumeutils.DirSizeBytes(depsDir)
+		if err != nil {
+			return nil, fmt.Errorf("error getting dir %q size: %s", depsDir, err)
+		}
+
+		// the access of the dependencies prepared before the tracking was introduced is unknown
+		lastAccessAt := finfo.ModTime()
+		if lrumeta.CommonLRUPathsCache != nil {
+			t, err := lrumeta.CommonLRUPathsCache.GetPathLastAccessTime(ctx, depsDir)
+			if err != nil {
+				return nil, fmt.Errorf("error getting last access time of %q: %s", depsDir, err)
+			}
+
+			if !t.IsZero() {
+				lastAccessAt = t
+			}
+		}
+
+		res = append(res, &LocalCacheEntry{
+			Type:         LocalCacheTypeHelmChartDependencies,
+			Paths:        []string{depsDir},
+			Size:         size,
+			LastAccessAt: lastAccessAt,
+		})
+	}
+
+	return res, nil
+}
+
+// RunGCForLocalCache removes the old versions of the manifests and helm chart dependencies caches and,
+// if the allowed size is specified, the least recently used local cache entries until the local cache size becomes below the allowed size
+func RunGCForLocalCache(ctx context.Context, allowedSize uint64, decisionsLog *DecisionsLog, dryRun bool) error {
+	lock, err := gitdata.LockGC(ctx, false)
+	if err != nil {
+		return fmt.Errorf("unable to acquire git data lock: %s", err)
+	}
+	defer werf.ReleaseHostLock(lock)
+
+	if !dryRun {
+		for cacheRoot, keepCacheVersion := range map[string]string{
+			filepath.Join(werf.GetLocalCacheDir(), "manifests"): image.ManifestCacheVersion,
+			chart_extender.GetChartDependenciesCacheRootDir():   chart_extender.ChartDependenciesCacheVersion,
+			filepath.Join(werf.GetLocalCacheDir(), "lru_paths"): lrumeta.LRUPathsCacheVersion,
+			gitdata.GetGitRepoProjectsCacheRootDir():            gitdata.GitRepoProjectsCacheVersion,
+		} {
+			if err := wipeOldCacheVersions(cacheRoot, keepCacheVersion, time.Now()); err != nil {
+				return fmt.Errorf("unable to wipe old cache dirs in %q: %s", cacheRoot, err)
+			}
+		}
+	}
+
+	if allowedSize == 0 {
+		return nil
+	}
+
+	entries, err := GetLocalCacheEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	var totalSize uint64
+	for _, entry := range entries {
+		totalSize += entry.Size
+	}
+
+	if totalSize <= allowedSize {
+		logboek.Context(ctx).Default().LogBlock("Local cache size check").Do(func() {
+			logboek.Context(ctx).Default().LogF("Werf local cache dir: %s\n", werf.GetLocalCacheDir())
+			logboek.Context(ctx).Default().LogF("Allowed local cache size: %s <= %s — %s\n", utils.GreenF("%s", humanize.Bytes(totalSize)), utils.BlueF("%s", humanize.Bytes(allowedSize)), utils.GreenF("OK"))
+		})
+
+		return nil
+	}
+
+	bytesToFree := totalSize - allowedSize
+
+	logboek.Context(ctx).Default().LogBlock("Local cache size check").Do(func() {
+		logboek.Context(ctx).Default().LogF("Werf local cache dir: %s\n", werf.GetLocalCacheDir())
+		logboek.Context(ctx).Default().LogF("Allowed local cache size exceeded: %s > %s — %s\n", utils.RedF("%s", humanize.Bytes(totalSize)), utils.YellowF("%s", humanize.Bytes(allowedSize)), utils.RedF("HIGH LOCAL CACHE SIZE"))
+		logboek.Context(ctx).Default().LogF("Needed to free: %s\n", utils.RedF("%s", humanize.Bytes(bytesToFree)))
+	})
+
+	freedBytes, freedEntriesCount, err := freeLocalCache(entries, bytesToFree, func(entry *LocalCacheEntry) (bool, error) {
+		return removeLocalCacheEntry(ctx, entry, DecisionReasonLocalCacheSizeExceeded, decisionsLog, dryRun)
+	})
+	if err != nil {
+		return err
+	}
+
+	logboek.Context(ctx).Default().LogF("Freed local cache entries: %s\n", utils.GreenF("%d (~ %s)", freedEntriesCount, humanize.Bytes(freedBytes)))
+
+	return nil
+}
+
+// freeLocalCache removes the least recently used entries until the specified bytes are freed,
+// the entries which have not been removed (e.g. locked) are skipped
+func freeLocalCache(entries []*LocalCacheEntry, bytesToFree uint64, removeEntryFunc func(entry *LocalCacheEntry) (bool, error)) (uint64, int, error) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastAccessAt.Before(entries[j].LastAccessAt)
+	})
+
+	var freedBytes uint64
+	var freedEntriesCount int
+	for _, entry := range entries {
+		if freedBytes >= bytesToFree {
+			break
+		}
+
+		removed, err := removeEntryFunc(entry)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if removed {
+			freedBytes += entry.Size
+			freedEntriesCount++
+		}
+	}
+
+	return freedBytes, freedEntriesCount, nil
+}
+
+// removeLocalCacheEntry removes the entry, the helm chart dependencies are skipped if they are being built or loaded by another werf process
+func removeLocalCacheEntry(ctx context.Context, entry *LocalCacheEntry, reason string, decisionsLog *DecisionsLog, dryRun bool) (bool, error) {
+	lastAccessAt := entry.LastAccessAt
+	decision := HostCleanupDecision{
+		Storage:    DecisionStorageLocalCache,
+		Project:    entry.Project,
+		Object:     strings.Join(entry.Paths, ","),
+		Bytes:      entry.Size,
+		LastUsedAt: &lastAccessAt,
+		DryRun:     dryRun,
+	}
+
+	if entry.Type == LocalCacheTypeHelmChartDependencies {
+		depsDir := entry.Paths[0]
+
+		isAcquired, lock, err := werf.AcquireHostLock(ctx, depsDir, lockgate.AcquireOptions{NonBlocking: true})
+		if err != nil {
+			return false, fmt.Errorf("error locking %q: %s", depsDir, err)
+		}
+
+		if !isAcquired {
+			logboek.Context(ctx).Default().LogFDetails("Chart dependencies %q are locked at the moment: skip removal\n", depsDir)
+
+			decision.Decision = DecisionSkip
+			decision.Reason = DecisionReasonLocked
+			decisionsLog.Record(ctx, decision)
+
+			return false, nil
+		}
+		defer werf.ReleaseHostLock(lock)
+	}
+
+	for _, path := range entry.Paths {
+		logboek.Context(ctx).Default().LogF("Removing %s\n", path)
+	}
+
+	if !dryRun {
+		switch entry.Type {
+		case LocalCacheTypeManifests:
+			if err := image.CommonManifestCache.RemoveEntry(ctx, entry.manifestCacheEntry); err != nil {
+				return false, err
+			}
+		default:
+			for _, path := range entry.Paths {
+				if err := gitdata.RemovePathWithEmptyParentDirsInsideScope(werf.GetLocalCacheDir(), path); err != nil {
+					return false, fmt.Errorf("unable to remove %q: %s", path, err)
+				}
+			}
+		}
+
+		if entry.Type == LocalCacheTypeHelmChartDependencies && lrumeta.CommonLRUPathsCache != nil {
+			if err := lrumeta.CommonLRUPathsCache.ForgetPath(ctx, entry.Paths[0]); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	decision.Decision = DecisionRemove
+	decision.Reason = reason
+	decisionsLog.Record(ctx, decision)
+
+	return true, nil
+}
+
+// oldCacheVersionKeepPeriod is the period the old cache version is kept after the last modification,
+// since the werf processes of the previous versions running on the host might still use it
+const oldCacheVersionKeepPeriod = 3 * 24 * time.Hour
+
+// wipeOldCacheVersions removes the old cache versions, which have not been modified during the keep period
+func wipeOldCacheVersions(cacheRootDir, keepCacheVersion string, now time.Time) error {
+	if _, err := os.Stat(cacheRootDir); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error accessing %q: %s", cacheRootDir, err)
+	}
+
+	files, err := ioutil.ReadDir(cacheRootDir)
+	if err != nil {
+		return fmt.Errorf("error reading dir %q: %s", cacheRootDir, err)
+	}
+
+	for _, finfo := range files {
+		if finfo.Name() == keepCacheVersion {
+			continue
+		}
+
+		path := filepath.Join(cacheRootDir, finfo.Name())
+
+		lastModifiedAt, err := getLastModificationTime(path)
+		if err != nil {
+			return err
+		}
+
+		if now.Sub(lastModifiedAt) <= oldCacheVersionKeepPeriod {
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("unable to remove %q: %s", path, err)
+		}
+	}
+
+	return nil
+}
+
+// getLastModificationTime returns the latest modification time of the path and the files inside
+func getLastModificationTime(path string) (time.Time, error) {
+	var res time.Time
+	if err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error accessing %q: %s", path, err)
+		}
+
+		if info.ModTime().After(res) {
+			res = info.ModTime()
+		}
+
+		return nil
+	}); err != nil {
+		return time.Time{}, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,190 @@
+package host_cleaning
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/werf/werf/pkg/deploy/helm/chart_extender"
+	"github.com/werf/werf/pkg/git_repo"
+	"github.com/werf/werf/pkg/git_repo/gitdata"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/util/timestamps"
+	"github.com/werf/werf/pkg/werf"
+)
+
+func TestFreeLocalCache(t *testing.T) {
+	now := time.Now()
+
+	newEntries := func() []*LocalCacheEntry {
+		return []*LocalCacheEntry{
+			{Paths: []string{"recent"}, Size: 10, LastAccessAt: now},
+			{Paths: []string{"oldest"}, Size: 10, LastAccessAt: now.Add(-3 * time.Hour)},
+			{Paths: []string{"locked"}, Size: 10, LastAccessAt: now.Add(-2 * time.Hour)},
+			{Paths: []string{"old"}, Size: 10, LastAccessAt: now.Add(-time.Hour)},
+		}
+	}
+
+	var removed []string
+	removeEntryFunc := func(entry *LocalCacheEntry) (bool, error) {
+		if entry.Paths[0] == "locked" {
+			return false, nil
+		}
+		removed = append(removed, entry.Paths[0])
+		return true, nil
+	}
+
+	freedBytes, freedEntriesCount, err := freeLocalCache(newEntries(), 15, removeEntryFunc)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected := []string{"oldest", "old"}; !reflect.DeepEqual(removed, expected) {
+		t.Errorf("expected least recently used entries %v to be removed skipping the locked one, got %v", expected, removed)
+	}
+
+	if freedBytes != 20 || freedEntriesCount != 2 {
+		t.Errorf("expected 20 bytes of 2 entries to be freed, got %d bytes of %d entries", freedBytes, freedEntriesCount)
+	}
+
+	removed = nil
+	if _, _, err := freeLocalCache(newEntries(), 0, removeEntryFunc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(removed) != 0 {
+		t.Errorf("expected nothing to be removed, got %v", removed)
+	}
+
+	if _, _, err := freeLocalCache(newEntries(), 15, func(entry *LocalCacheEntry) (bool, error) {
+		return false, errors.New("error")
+	}); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestWipeOldCacheVersions(t *testing.T) {
+	now := time.Now()
+	cacheRootDir := t.TempDir()
+
+	for version, modifiedAt := range map[string]time.Time{
+		"1": now.Add(-oldCacheVersionKeepPeriod - time.Hour),
+		"2": now.Add(-time.Hour),
+		"3": now.Add(-oldCacheVersionKeepPeriod - time.Hour),
+	} {
+		dir := filepath.Join(cacheRootDir, version)
+		file := filepath.Join(dir, "data")
+
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, path := range []string{file, dir} {
+			if err := os.Chtimes(path, modifiedAt, modifiedAt); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := wipeOldCacheVersions(cacheRootDir, "3", now); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for version, expectExist := range map[string]bool{
+		"1": false,
+		"2": true,
+		"3": true,
+	} {
+		_, err := os.Stat(filepath.Join(cacheRootDir, version))
+		if exist := err == nil; exist != expectExist {
+			t.Errorf("version %s: expected exist %v, got %v", version, expectExist, exist)
+		}
+	}
+
+	if err := wipeOldCacheVersions(filepath.Join(cacheRootDir, "no-such-dir"), "3", now); err != nil {
+		t.Errorf("unexpected error for not existing dir: %s", err)
+	}
+}
+
+func TestGetLocalCacheEntries(t *testing.T) {
+	ctx := context.Background()
+
+	if err := werf.Init(t.TempDir(), t.TempDir()); err != nil {
+		t.Fatalf("unable to init werf: %s", err)
+	}
+
+	if err := image.Init(); err != nil {
+		t.Fatalf("unable to init image: %s", err)
+	}
+
+	lastAccessAt := time.Unix(time.Now().Unix(), 0)
+	gitReposDir := filepath.Join(werf.GetLocalCacheDir(), "git_repos", git_repo.GitReposCacheVersion)
+	for _, repoID := range []string{"single", "shared", "unknown"} {
+		repoDir := filepath.Join(gitReposDir, repoID)
+		if err := os.MkdirAll(repoDir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := timestamps.WriteTimestampFile(filepath.Join(repoDir, "last_access_at"), lastAccessAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for repoID, projects := range map[string][]string{
+		"single": {"frontend"},
+		"shared": {"frontend", "backend"},
+	} {
+		for _, projectName := range projects {
+			if err := gitdata.RecordRepoProject(ctx, repoID, projectName); err != nil {
+				t.Fatalf("unable to record repo project: %s", err)
+			}
+		}
+	}
+
+	chartDependenciesDir := filepath.Join(chart_extender.GetChartDependenciesCacheRootDir(), chart_extender.ChartDependenciesCacheVersion)
+	for _, name := range []string{"deps", "deps.tmp.1"} {
+		if err := os.MkdirAll(filepath.Join(chartDependenciesDir, name), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := GetLocalCacheEntries(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	projectByPath := map[string]string{}
+	typeByPath := map[string]string{}
+	for _, entry := range entries {
+		projectByPath[entry.Paths[0]] = entry.Project
+		typeByPath[entry.Paths[0]] = entry.Type
+
+		if entry.Type == LocalCacheTypeGitRepos && !entry.LastAccessAt.Equal(lastAccessAt) {
+			t.Errorf("%s: expected last access %s, got %s", entry.Paths[0], lastAccessAt, entry.LastAccessAt)
+		}
+	}
+
+	expectedProjectByPath := map[string]string{
+		filepath.Join(gitReposDir, "single"):        "frontend",
+		filepath.Join(gitReposDir, "shared"):        "",
+		filepath.Join(gitReposDir, "unknown"):       "",
+		filepath.Join(chartDependenciesDir, "deps"): "",
+	}
+
+	if !reflect.DeepEqual(projectByPath, expectedProjectByPath) {
+		t.Errorf("expected entries projects %v, got %v", expectedProjectByPath, projectByPath)
+	}
+
+	if entryType := typeByPath[filepath.Join(chartDependenciesDir, "deps")]; entryType != LocalCacheTypeHelmChartDependencies {
+		t.Errorf("expected chart dependencies entry type, got %q", entryType)
+	}
+}
@@ -109,6 +109,21 @@ func GetLocalDockerServerStorageCheck(ctx context.Context, dockerServerStoragePa
 	}
 	res.VolumeUsage = vu
 
+	imagesDescs, totalImagesBytes, err := GetLocalDockerServerWerfImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res.ImagesDescs = imagesDescs
+	res.TotalImagesBytes = totalImagesBytes
+
+	return res, nil
+}
+
+// GetLocalDockerServerWerfImages returns the werf images, which can be removed by the host cleanup, sorted by the last access time (least recently used first)
+func GetLocalDockerServerWerfImages(ctx context.Context) ([]*LocalImageDesc, uint64, error) {
+	var imagesDescs []*LocalImageDesc
+	var totalImagesBytes uint64
+
 	var images []types.ImageSummary
 
 	{
@@ -118,7 +133,7 @@ func GetLocalDockerServerStorageCheck(ctx context.Context, dockerServerStoragePa
 
 		imgs, err := docker.Images(ctx, types.ImageListOptions{Filters: filterSet})
 		if err != nil {
-			return nil, fmt.Errorf("unable to get werf docker images: %s", err)
+			return nil, 0, fmt.Errorf("unable to get werf docker images: %s", err)
 		}
 		images = append(images, imgs...)
 	}
@@ -130,7 +145,7 @@ func GetLocalDockerServerStorageCheck(ctx context.Context, dockerServerStoragePa
 
 		imgs, err := docker.Images(ctx, types.ImageListOptions{Filters: filterSet})
 		if err != nil {
-			return nil, fmt.Errorf("unable to get werf v1.1 legacy docker images: %s", err)
+			return nil, 0, fmt.Errorf("unable to get werf v1.1 legacy docker images: %s", err)
 		}
 
 	ExcludeLocalV1_1StagesStorage:
@@ -151,7 +166,7 @@ func GetLocalDockerServerStorageCheck(ctx context.Context, dockerServerStoragePa
 
 		t, err := werf.GetWerfLastRunAtV1_1(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("error getting v1.1 last run timestamp: %s", err)
+			return nil, 0, fmt.Errorf("error getting v1.1 last run timestamp: %s", err)
 		}
 
 		// No werf v1.1 runs on this host.
@@ -172,7 +187,7 @@ func GetLocalDockerServerStorageCheck(ctx context.Context, dockerServerStoragePa
 
 			imgs, err := docker.Images(ctx, types.ImageListOptions{Filters: filterSet})
 			if err != nil {
-				return nil, fmt.Errorf("unable to get werf service images: %s", err)
+				return nil, 0, fmt.Errorf("unable to get werf service images: %s", err)
 			}
 
 			for _, img := range imgs {
@@ -187,12 +202,21 @@ func GetLocalDockerServerStorageCheck(ctx context.Context, dockerServerStoragePa
 		}
 	}
 
+	sharedSizeByImageID, err := getImagesSharedSizeByID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
 CreateImagesDescs:
 	for _, imageSummary := range images {
+		if sharedSize, ok := sharedSizeByImageID[imageSummary.ID]; ok {
+			imageSummary.SharedSize = sharedSize
+		}
+
 		data, _ := json.Marshal(imageSummary)
 		logboek.Context(ctx).Debug().LogF("Image summary:\n%s\n---\n", data)
 
-		res.TotalImagesBytes += uint64(imageSummary.VirtualSize - imageSummary.SharedSize)
+		totalImagesBytes += getImageSummaryBytes(imageSummary)
 
 		lastUsedAt := time.Unix(imageSummary.Created, 0)
 
@@ -205,7 +229,7 @@ CreateImagesDescs:
 
 			lastRecentlyUsedAt, err := lrumeta.CommonLRUImagesCache.GetImageLastAccessTime(ctx, ref)
 			if err != nil {
-				return nil, fmt.Errorf("error accessing last recently used images cache: %s", err)
+				return nil, 0, fmt.Errorf("error accessing last recently used images cache: %s", err)
 			}
 
 			if lastRecentlyUsedAt.IsZero() {
@@ -220,15 +244,41 @@ CreateImagesDescs:
 			ImageSummary: imageSummary,
 			LastUsedAt:   lastUsedAt,
 		}
-		res.ImagesDescs = append(res.ImagesDescs, desc)
+		imagesDescs = append(imagesDescs, desc)
+	}
+
+	sort.Sort(ImagesLruSort(imagesDescs))
+
+	return imagesDescs, totalImagesBytes, nil
+}
+
+// getImagesSharedSizeByID returns the size of the layers shared with other images by the image ID.
+// The image list does not calculate the shared size (it is -1), but the disk usage does
+func getImagesSharedSizeByID(ctx context.Context) (map[string]int64, error) {
+	diskUsage, err := docker.DiskUsage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get docker disk usage: %s", err)
 	}
 
-	sort.Sort(ImagesLruSort(res.ImagesDescs))
+	res := map[string]int64{}
+	for _, imageSummary := range diskUsage.Images {
+		res[imageSummary.ID] = imageSummary.SharedSize
+	}
 
 	return res, nil
 }
 
-func RunGCForLocalDockerServer(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsageMarginPercentage float64, dockerServerStoragePath string, force, dryRun bool) error {
+// getImageSummaryBytes returns the size of the image layers not shared with other images, i.e. the bytes freed by the image removal.
+// The whole image size is returned if the shared size is unknown
+func getImageSummaryBytes(imageSummary types.ImageSummary) uint64 {
+	if imageSummary.SharedSize < 0 {
+		return uint64(imageSummary.VirtualSize)
+	}
+
+	return uint64(imageSummary.VirtualSize - imageSummary.SharedSize)
+}
+
+func RunGCForLocalDockerServer(ctx context.Context, allowedVolumeUsagePercentage, allowedVolumeUsageMarginPercentage float64, dockerServerStoragePath string, decisionsLog *DecisionsLog, force, dryRun bool) error {
 	if dockerServerStoragePath == "" {
 		return nil
 	}
@@ -275,6 +325,16 @@ func RunGCForLocalDockerServer(ctx context.Context, allowedVolumeUsagePercentage
 				for _, desc := range checkResult.ImagesDescs {
 					imageRemovalFailed := false
 
+					lastUsedAt := desc.LastUsedAt
+					decision := HostCleanupDecision{
+						Storage:    DecisionStorageDocker,
+						Project:    getLocalImageProjectName(desc),
+						Object:     strings.Join(desc.ImageSummary.RepoTags, ","),
+						Bytes:      getLocalImageBytes(desc),
+						LastUsedAt: &lastUsedAt,
+						DryRun:     dryRun,
+					}
+
 					for _, ref := range desc.ImageSummary.RepoTags {
 						var args []string
 
@@ -290,6 +350,11 @@ func RunGCForLocalDockerServer(ctx context.Context, allowedVolumeUsagePercentage
 
 							if !isLocked {
 								logboek.Context(ctx).Default().LogFDetails("Image %q is locked at the moment: skip removal\n", ref)
+
+								decision.Decision = DecisionSkip
+								decision.Reason = DecisionReasonLocked
+								decisionsLog.Record(ctx, decision)
+
 								continue DeleteImages
 							}
 
@@ -314,9 +379,16 @@ func RunGCForLocalDockerServer(ctx context.Context, allowedVolumeUsagePercentage
 					}
 
 					if !imageRemovalFailed {
-						freedBytes += uint64(desc.ImageSummary.VirtualSize - desc.ImageSummary.SharedSize)
+						freedBytes += getLocalImageBytes(desc)
 						freedImagesCount++
+
+						decision.Decision = DecisionRemove
+						decision.Reason = DecisionReasonVolumeUsageExceeded
+					} else {
+						decision.Decision = DecisionSkip
+						decision.Reason = DecisionReasonRemovalFailed
 					}
+					decisionsLog.Record(ctx, decision)
 
 					if freedImagesCount < MinImagesToDelete {
 						continue
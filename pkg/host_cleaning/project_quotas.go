@@ -0,0 +1,317 @@
+package host_cleaning
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/werf/kubedog/pkg/utils"
+	"github.com/werf/lockgate"
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/docker"
+	"github.com/werf/werf/pkg/git_repo/gitdata"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/werf"
+)
+
+// ProjectQuotas limit the local docker server storage and the local cache used by each project
+// (the project is taken from the werf label of the image or the manifest).
+// Zero quota means no limit
+type ProjectQuotas struct {
+	DefaultBytes   uint64
+	BytesByProject map[string]uint64
+}
+
+func (q ProjectQuotas) IsEmpty() bool {
+	return q.DefaultBytes == 0 && len(q.BytesByProject) == 0
+}
+
+func (q ProjectQuotas) GetQuotaBytes(projectName string) uint64 {
+	if bytes, ok := q.BytesByProject[projectName]; ok {
+		return bytes
+	}
+
+	return q.DefaultBytes
+}
+
+// ParseProjectQuotas parses the default quota and the project quotas in the format PROJECT=SIZE, the size is in bytes or with the unit (e.g. 20GB, 512MiB)
+func ParseProjectQuotas(defaultQuota string, projectQuotas []string) (ProjectQuotas, error) {
+	res := ProjectQuotas{BytesByProject: map[string]uint64{}}
+
+	if defaultQuota != "" {
+		bytes, err := humanize.ParseBytes(defaultQuota)
+		if err != nil {
+			return ProjectQuotas{}, fmt.Errorf("invalid default project quota %q: %s", defaultQuota, err)
+		}
+		res.DefaultBytes = bytes
+	}
+
+	for _, value := range projectQuotas {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return ProjectQuotas{}, fmt.Errorf("invalid project quota %q: expected PROJECT=SIZE", value)
+		}
+
+		bytes, err := humanize.ParseBytes(parts[1])
+		if err != nil {
+			return ProjectQuotas{}, fmt.Errorf("invalid project quota %q: %s", value, err)
+		}
+		res.BytesByProject[parts[0]] = bytes
+	}
+
+	return res, nil
+}
+
+func getLocalImageProjectName(desc *LocalImageDesc) string {
+	return desc.ImageSummary.Labels[image.WerfLabel]
+}
+
+func getLocalImageBytes(desc *LocalImageDesc) uint64 {
+	return getImageSummaryBytes(desc.ImageSummary)
+}
+
+// projectUsageItem is the docker image or the local cache entry of the project
+type projectUsageItem struct {
+	imageDesc       *LocalImageDesc
+	localCacheEntry *LocalCacheEntry
+}
+
+func (item *projectUsageItem) getBytes() uint64 {
+	if item.imageDesc != nil {
+		return getLocalImageBytes(item.imageDesc)
+	}
+
+	return item.localCacheEntry.Size
+}
+
+func (item *projectUsageItem) getLastUsedAt() time.Time {
+	if item.imageDesc != nil {
+		return item.imageDesc.LastUsedAt
+	}
+
+	return item.localCacheEntry.LastAccessAt
+}
+
+type projectUsage struct {
+	ProjectName string
+	Bytes       uint64
+	QuotaBytes  uint64
+	// Items are sorted by the last usage time (least recently used first)
+	Items []*projectUsageItem
+}
+
+func (u *projectUsage) IsQuotaExceeded() bool {
+	return u.QuotaBytes != 0 && u.Bytes > u.QuotaBytes
+}
+
+// getProjectsUsage groups the docker images and the local cache entries by the project, the shared data without the project is skipped
+func getProjectsUsage(imagesDescs []*LocalImageDesc, localCacheEntries []*LocalCacheEntry, quotas ProjectQuotas) []*projectUsage {
+	usageByProject := map[string]*projectUsage{}
+	addItem := func(projectName string, item *projectUsageItem) {
+		if projectName == "" {
+			return
+		}
+
+		usage, ok := usageByProject[projectName]
+		if !ok {
+			usage = &projectUsage{ProjectName: projectName, QuotaBytes: quotas.GetQuotaBytes(projectName)}
+			usageByProject[projectName] = usage
+		}
+
+		usage.Items = append(usage.Items, item)
+		usage.Bytes += item.getBytes()
+	}
+
+	for _, desc := range imagesDescs {
+		addItem(getLocalImageProjectName(desc), &projectUsageItem{imageDesc: desc})
+	}
+
+	for _, entry := range localCacheEntries {
+		addItem(entry.Project, &projectUsageItem{localCacheEntry: entry})
+	}
+
+	var res []*projectUsage
+	for _, usage := range usageByProject {
+		sort.SliceStable(usage.Items, func(i, j int) bool {
+			return usage.Items[i].getLastUsedAt().Before(usage.Items[j].getLastUsedAt())
+		})
+
+		res = append(res, usage)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ProjectName < res[j].ProjectName
+	})
+
+	return res
+}
+
+// freeProjectQuota removes the least recently used items of the project until the project usage becomes below the quota,
+// the items which have not been removed (e.g. locked) are skipped
+func freeProjectQuota(usage *projectUsage, removeItemFunc func(item *projectUsageItem) (bool, error)) (uint64, int, error) {
+	var freedBytes uint64
+	var freedItemsCount int
+	for _, item := range usage.Items {
+		if usage.Bytes-freedBytes <= usage.QuotaBytes {
+			break
+		}
+
+		removed, err := removeItemFunc(item)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if removed {
+			freedBytes += item.getBytes()
+			freedItemsCount++
+		}
+	}
+
+	return freedBytes, freedItemsCount, nil
+}
+
+// RunProjectQuotasGC removes the least recently used werf images and local cache entries of each project which exceeds the quota
+// until the project usage becomes below the quota
+func RunProjectQuotasGC(ctx context.Context, quotas ProjectQuotas, decisionsLog *DecisionsLog, skipLocalDockerServer, force, dryRun bool) error {
+	var imagesDescs []*LocalImageDesc
+	if !skipLocalDockerServer {
+		descs, _, err := GetLocalDockerServerWerfImages(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting local docker server werf images: %s", err)
+		}
+		imagesDescs = descs
+	}
+
+	lock, err := gitdata.LockGC(ctx, false)
+	if err != nil {
+		return fmt.Errorf("unable to acquire git data lock: %s", err)
+	}
+	defer werf.ReleaseHostLock(lock)
+
+	localCacheEntries, err := GetLocalCacheEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, usage := range getProjectsUsage(imagesDescs, localCacheEntries, quotas) {
+		if !usage.IsQuotaExceeded() {
+			decisionsLog.Record(ctx, HostCleanupDecision{
+				Project:    usage.ProjectName,
+				Bytes:      usage.Bytes,
+				QuotaBytes: usage.QuotaBytes,
+				Decision:   DecisionKeep,
+				Reason:     DecisionReasonWithinProjectQuota,
+				DryRun:     dryRun,
+			})
+
+			continue
+		}
+
+		decisionsLog.Record(ctx, HostCleanupDecision{
+			Project:    usage.ProjectName,
+			Bytes:      usage.Bytes,
+			QuotaBytes: usage.QuotaBytes,
+			Decision:   DecisionRemove,
+			Reason:     DecisionReasonProjectQuotaExceeded,
+			DryRun:     dryRun,
+		})
+
+		if err := logboek.Context(ctx).Default().LogProcess("Running cleanup for least recently used data of project %s", usage.ProjectName).DoError(func() error {
+			logboek.Context(ctx).Default().LogF("Project usage: %s > %s — %s\n", utils.RedF("%s", humanize.Bytes(usage.Bytes)), utils.YellowF("%s", humanize.Bytes(usage.QuotaBytes)), utils.RedF("QUOTA EXCEEDED"))
+
+			freedBytes, freedItemsCount, err := freeProjectQuota(usage, func(item *projectUsageItem) (bool, error) {
+				if item.imageDesc != nil {
+					return removeLocalImage(ctx, item.imageDesc, DecisionReasonProjectQuotaExceeded, decisionsLog, force, dryRun)
+				}
+
+				return removeLocalCacheEntry(ctx, item.localCacheEntry, DecisionReasonProjectQuotaExceeded, decisionsLog, dryRun)
+			})
+			if err != nil {
+				return err
+			}
+
+			logboek.Context(ctx).Default().LogF("Freed images and local cache entries: %s\n", utils.GreenF("%d (~ %s)", freedItemsCount, humanize.Bytes(freedBytes)))
+
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeLocalImage removes all tags of the image, the image is skipped if any tag is locked by another werf process
+func removeLocalImage(ctx context.Context, desc *LocalImageDesc, reason string, decisionsLog *DecisionsLog, force, dryRun bool) (bool, error) {
+	lastUsedAt := desc.LastUsedAt
+	decision := HostCleanupDecision{
+		Storage:    DecisionStorageDocker,
+		Project:    getLocalImageProjectName(desc),
+		Object:     strings.Join(desc.ImageSummary.RepoTags, ","),
+		Bytes:      getLocalImageBytes(desc),
+		LastUsedAt: &lastUsedAt,
+		DryRun:     dryRun,
+	}
+
+	var acquiredHostLocks []lockgate.LockHandle
+	defer func() {
+		for _, lock := range acquiredHostLocks {
+			_ = werf.ReleaseHostLock(lock)
+		}
+	}()
+
+	for _, ref := range desc.ImageSummary.RepoTags {
+		lockName := container_runtime.ImageLockName(ref)
+
+		isLocked, lock, err := werf.AcquireHostLock(ctx, lockName, lockgate.AcquireOptions{NonBlocking: true})
+		if err != nil {
+			return false, fmt.Errorf("error locking image %q: %s", lockName, err)
+		}
+
+		if !isLocked {
+			logboek.Context(ctx).Default().LogFDetails("Image %q is locked at the moment: skip removal\n", ref)
+
+			decision.Decision = DecisionSkip
+			decision.Reason = DecisionReasonLocked
+			decisionsLog.Record(ctx, decision)
+
+			return false, nil
+		}
+
+		acquiredHostLocks = append(acquiredHostLocks, lock)
+	}
+
+	for _, ref := range desc.ImageSummary.RepoTags {
+		args := []string{ref}
+		if force {
+			args = append(args, "--force")
+		}
+
+		logboek.Context(ctx).Default().LogF("Removing %s\n", ref)
+		if dryRun {
+			continue
+		}
+
+		if err := docker.CliRmi(ctx, args...); err != nil {
+			logboek.Context(ctx).Warn().LogF("failed to remove local docker image %q: %s\n", ref, err)
+
+			decision.Decision = DecisionSkip
+			decision.Reason = DecisionReasonRemovalFailed
+			decisionsLog.Record(ctx, decision)
+
+			return false, nil
+		}
+	}
+
+	decision.Decision = DecisionRemove
+	decision.Reason = reason
+	decisionsLog.Record(ctx, decision)
+
+	return true, nil
+}
@@ -0,0 +1,217 @@
+package host_cleaning
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+func TestParseProjectQuotas(t *testing.T) {
+	quotas, err := ParseProjectQuotas("10GB", []string{"monolith=100GB", "small=512MiB", "raw=1000"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if quotas.DefaultBytes != 10*1000*1000*1000 {
+		t.Errorf("unexpected default quota %d", quotas.DefaultBytes)
+	}
+
+	for projectName, expected := range map[string]uint64{
+		"monolith": 100 * 1000 * 1000 * 1000,
+		"small":    512 * 1024 * 1024,
+		"raw":      1000,
+		"other":    10 * 1000 * 1000 * 1000,
+	} {
+		if bytes := quotas.GetQuotaBytes(projectName); bytes != expected {
+			t.Errorf("project %s: expected quota %d, got %d", projectName, expected, bytes)
+		}
+	}
+
+	for _, value := range []string{"monolith", "=10GB", "monolith=", "monolith=ten"} {
+		if _, err := ParseProjectQuotas("", []string{value}); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+
+	if _, err := ParseProjectQuotas("ten", nil); err == nil {
+		t.Errorf("expected error for invalid default quota")
+	}
+}
+
+func TestProjectQuotasWithoutDefault(t *testing.T) {
+	quotas, err := ParseProjectQuotas("", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !quotas.IsEmpty() {
+		t.Errorf("expected empty quotas")
+	}
+
+	quotas, err = ParseProjectQuotas("", []string{"monolith=1GB"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if quotas.IsEmpty() {
+		t.Errorf("expected non-empty quotas")
+	}
+
+	if bytes := quotas.GetQuotaBytes("other"); bytes != 0 {
+		t.Errorf("expected no quota for the project not specified, got %d", bytes)
+	}
+}
+
+func TestGetImageSummaryBytes(t *testing.T) {
+	if bytes := getImageSummaryBytes(types.ImageSummary{VirtualSize: 100, SharedSize: 30}); bytes != 70 {
+		t.Errorf("expected size without the shared layers, got %d", bytes)
+	}
+
+	if bytes := getImageSummaryBytes(types.ImageSummary{VirtualSize: 100, SharedSize: -1}); bytes != 100 {
+		t.Errorf("expected whole size for the unknown shared size, got %d", bytes)
+	}
+}
+
+func newTestLocalImageDesc(id, projectName string, bytes int64, lastUsedAt time.Time) *LocalImageDesc {
+	return &LocalImageDesc{
+		ImageSummary: types.ImageSummary{
+			ID:          id,
+			Labels:      map[string]string{image.WerfLabel: projectName},
+			VirtualSize: bytes,
+		},
+		LastUsedAt: lastUsedAt,
+	}
+}
+
+func projectUsageItemsNames(items []*projectUsageItem) string {
+	var names []string
+	for _, item := range items {
+		if item.imageDesc != nil {
+			names = append(names, item.imageDesc.ImageSummary.ID)
+		} else {
+			names = append(names, strings.Join(item.localCacheEntry.Paths, ","))
+		}
+	}
+
+	return strings.Join(names, " ")
+}
+
+func TestGetProjectsUsage(t *testing.T) {
+	now := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	imagesDescs := []*LocalImageDesc{
+		newTestLocalImageDesc("backend-new", "backend", 300, now),
+		newTestLocalImageDesc("backend-old", "backend", 200, now.Add(-3*time.Hour)),
+		newTestLocalImageDesc("frontend", "frontend", 100, now.Add(-time.Hour)),
+		newTestLocalImageDesc("without-project", "", 1000, now.Add(-5*time.Hour)),
+	}
+
+	localCacheEntries := []*LocalCacheEntry{
+		{Type: LocalCacheTypeManifests, Project: "backend", Paths: []string{"backend-manifest"}, Size: 50, LastAccessAt: now.Add(-2 * time.Hour)},
+		{Type: LocalCacheTypeGitRepos, Paths: []string{"shared-git-repo"}, Size: 5000, LastAccessAt: now.Add(-4 * time.Hour)},
+	}
+
+	quotas := ProjectQuotas{DefaultBytes: 400, BytesByProject: map[string]uint64{"frontend": 0}}
+
+	usages := getProjectsUsage(imagesDescs, localCacheEntries, quotas)
+	if len(usages) != 2 {
+		t.Fatalf("expected 2 projects, got %d", len(usages))
+	}
+
+	backend, frontend := usages[0], usages[1]
+
+	if backend.ProjectName != "backend" || backend.Bytes != 550 || backend.QuotaBytes != 400 || !backend.IsQuotaExceeded() {
+		t.Errorf("unexpected backend usage: %+v", backend)
+	}
+
+	if names := projectUsageItemsNames(backend.Items); names != "backend-old backend-manifest backend-new" {
+		t.Errorf("expected backend items sorted by the last usage, got %q", names)
+	}
+
+	if frontend.ProjectName != "frontend" || frontend.Bytes != 100 || frontend.QuotaBytes != 0 || frontend.IsQuotaExceeded() {
+		t.Errorf("unexpected frontend usage: %+v", frontend)
+	}
+}
+
+func TestFreeProjectQuota(t *testing.T) {
+	now := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	newUsage := func() *projectUsage {
+		return getProjectsUsage([]*LocalImageDesc{
+			newTestLocalImageDesc("image-1", "project", 100, now.Add(-4*time.Hour)),
+			newTestLocalImageDesc("image-2", "project", 100, now.Add(-2*time.Hour)),
+			newTestLocalImageDesc("image-3", "project", 100, now),
+		}, []*LocalCacheEntry{
+			{Type: LocalCacheTypeManifests, Project: "project", Paths: []string{"manifest"}, Size: 50, LastAccessAt: now.Add(-3 * time.Hour)},
+		}, ProjectQuotas{DefaultBytes: 200})[0]
+	}
+
+	tests := []struct {
+		name                  string
+		lockedItems           []string
+		expectedRemovedItems  string
+		expectedFreedBytes    uint64
+		expectedFreedItemsNum int
+	}{
+		{
+			name:                  "least recently used items are removed until the usage becomes below the quota",
+			expectedRemovedItems:  "image-1 manifest",
+			expectedFreedBytes:    150,
+			expectedFreedItemsNum: 2,
+		},
+		{
+			name:                  "locked items are skipped",
+			lockedItems:           []string{"image-1"},
+			expectedRemovedItems:  "manifest image-2",
+			expectedFreedBytes:    150,
+			expectedFreedItemsNum: 2,
+		},
+		{
+			name:                  "quota cannot be reached",
+			lockedItems:           []string{"image-1", "image-2", "image-3"},
+			expectedRemovedItems:  "manifest",
+			expectedFreedBytes:    50,
+			expectedFreedItemsNum: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var removedItems []*projectUsageItem
+			freedBytes, freedItemsNum, err := freeProjectQuota(newUsage(), func(item *projectUsageItem) (bool, error) {
+				for _, name := range tt.lockedItems {
+					if item.imageDesc != nil && item.imageDesc.ImageSummary.ID == name {
+						return false, nil
+					}
+				}
+
+				removedItems = append(removedItems, item)
+				return true, nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if names := projectUsageItemsNames(removedItems); names != tt.expectedRemovedItems {
+				t.Errorf("expected removed items %q, got %q", tt.expectedRemovedItems, names)
+			}
+
+			if freedBytes != tt.expectedFreedBytes || freedItemsNum != tt.expectedFreedItemsNum {
+				t.Errorf("expected %d items (%d bytes) to be freed, got %d items (%d bytes)", tt.expectedFreedItemsNum, tt.expectedFreedBytes, freedItemsNum, freedBytes)
+			}
+		})
+	}
+
+	t.Run("removal error", func(t *testing.T) {
+		if _, _, err := freeProjectQuota(newUsage(), func(item *projectUsageItem) (bool, error) {
+			return false, errors.New("error")
+		}); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package host_cleaning
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+// unstoredStageImagesMaxAge is the age of the unstored stage image, after which the image is not expected to be resumed by the next build
+const unstoredStageImagesMaxAge = 24 * time.Hour
+
+// RunGCForUnstoredStageImages removes the tags of the stage images, which have been built but not stored into the repo by the interrupted or failed builds.
+// The images used by the containers are skipped.
+func RunGCForUnstoredStageImages(ctx context.Context, decisionsLog *DecisionsLog, dryRun bool) error {
+	filterSet := filters.NewArgs()
+	filterSet.Add("reference", fmt.Sprintf("%s/*", image.UnstoredStageImageRepository))
+
+	images, err := werfImagesByFilterSet(ctx, filterSet)
+	if err != nil {
+		return fmt.Errorf("unable to get unstored stage images: %s", err)
+	}
+
+	images = selectExpiredUnstoredStageImages(images, time.Now())
+	if len(images) == 0 {
+		return nil
+	}
+
+	options := CommonOptions{SkipUsedImages: true, DryRun: dryRun}
+	images, err = processUsedImages(ctx, images, options)
+	if err != nil {
+		return err
+	}
+
+	var references []string
+	for _, img := range images {
+		lastUsedAt := time.Unix(img.Created, 0)
+		for _, ref := range img.RepoTags {
+			project, isUnstoredStageRef := parseUnstoredStageImageReference(ref)
+			if !isUnstoredStageRef {
+				continue
+			}
+
+			references = append(references, ref)
+			decisionsLog.Record(ctx, HostCleanupDecision{
+				Storage:    DecisionStorageDocker,
+				Project:    project,
+				Object:     ref,
+				LastUsedAt: &lastUsedAt,
+				Decision:   DecisionRemove,
+				Reason:     DecisionReasonUnstoredStageExpired,
+				DryRun:     dryRun,
+			})
+		}
+	}
+
+	return imageReferencesRemove(ctx, references, options)
+}
+
+func selectExpiredUnstoredStageImages(images []types.ImageSummary, now time.Time) []types.ImageSummary {
+	var result []types.ImageSummary
+	for _, img := range images {
+		if now.Sub(time.Unix(img.Created, 0)) >= unstoredStageImagesMaxAge {
+			result = append(result, img)
+		}
+	}
+
+	return result
+}
+
+// parseUnstoredStageImageReference returns the project of the werf-unstored-stage/<project>:<digest> reference
+func parseUnstoredStageImageReference(ref string) (string, bool) {
+	prefix := image.UnstoredStageImageRepository + "/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", false
+	}
+
+	project := strings.TrimPrefix(ref, prefix)
+	if ind := strings.LastIndex(project, ":"); ind != -1 {
+		project = project[:ind]
+	}
+
+	return project, true
+}
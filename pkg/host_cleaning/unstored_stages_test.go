@@ -0,0 +1,45 @@
+package host_cleaning
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestSelectExpiredUnstoredStageImages(t *testing.T) {
+	now := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	images := []types.ImageSummary{
+		{ID: "fresh", Created: now.Add(-time.Hour).Unix()},
+		{ID: "expired", Created: now.Add(-unstoredStageImagesMaxAge).Unix()},
+		{ID: "old", Created: now.Add(-7 * 24 * time.Hour).Unix()},
+	}
+
+	result := selectExpiredUnstoredStageImages(images, now)
+	if len(result) != 2 || result[0].ID != "expired" || result[1].ID != "old" {
+		t.Errorf("unexpected expired images: %v", result)
+	}
+}
+
+func TestParseUnstoredStageImageReference(t *testing.T) {
+	tests := []struct {
+		ref             string
+		expectedProject string
+		expectedOk      bool
+	}{
+		{ref: "werf-unstored-stage/project:a1b2c3", expectedProject: "project", expectedOk: true},
+		{ref: "werf-unstored-stage/my-project:digest", expectedProject: "my-project", expectedOk: true},
+		{ref: "registry.example.com/project:a1b2c3", expectedOk: false},
+		{ref: "werf-managed-images/project:latest", expectedOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			project, ok := parseUnstoredStageImageReference(tt.ref)
+			if ok != tt.expectedOk || project != tt.expectedProject {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tt.expectedProject, tt.expectedOk, project, ok)
+			}
+		})
+	}
+}
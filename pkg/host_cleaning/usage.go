@@ -0,0 +1,200 @@
+package host_cleaning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/werf/werf/pkg/git_repo/gitdata"
+	"github.com/werf/werf/pkg/volumeutils"
+	"github.com/werf/werf/pkg/werf"
+)
+
+const (
+	UsageTypeDockerImages   = "docker-images"
+	UsageTypeBuildDirMounts = "build-dir-mounts"
+)
+
+// usageTypesOrder defines the order of the report records
+var usageTypesOrder = []string{
+	UsageTypeDockerImages,
+	LocalCacheTypeGitRepos,
+	LocalCacheTypeGitWorktrees,
+	LocalCacheTypeGitArchives,
+	LocalCacheTypeGitPatches,
+	LocalCacheTypeManifests,
+	LocalCacheTypeHelmChartDependencies,
+	UsageTypeBuildDirMounts,
+}
+
+// HostUsageRecord is the usage of the cache type by the project, the empty project means the data shared between the projects
+type HostUsageRecord struct {
+	Type         string     `json:"type"`
+	Project      string     `json:"project,omitempty"`
+	Entries      int        `json:"entries"`
+	Bytes        uint64     `json:"bytes"`
+	LastAccessAt *time.Time `json:"lastAccessAt,omitempty"`
+}
+
+type HostUsageReport struct {
+	Records    []*HostUsageRecord `json:"records"`
+	TotalBytes uint64             `json:"totalBytes"`
+}
+
+type HostUsageOptions struct {
+	// SkipDockerImages should be set when the local docker server is not available
+	SkipDockerImages bool
+}
+
+// GetHostUsageReport calculates the usage of the werf images in the local docker server, the local cache and the build_dir mounts
+func GetHostUsageReport(ctx context.Context, options HostUsageOptions) (*HostUsageReport, error) {
+	report := &HostUsageReport{Records: []*HostUsageRecord{}}
+
+	if !options.SkipDockerImages {
+		imagesDescs, _, err := GetLocalDockerServerWerfImages(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting local docker server werf images: %s", err)
+		}
+
+		for _, desc := range imagesDescs {
+			report.add(UsageTypeDockerImages, getLocalImageProjectName(desc), getLocalImageBytes(desc), desc.LastUsedAt)
+		}
+	}
+
+	if err := func() error {
+		lock, err := gitdata.LockGC(ctx, true)
+		if err != nil {
+			return fmt.Errorf("unable to acquire git data lock: %s", err)
+		}
+		defer werf.ReleaseHostLock(lock)
+
+		entries, err := GetLocalCacheEntries(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			report.add(entry.Type, entry.Project, entry.Size, entry.LastAccessAt)
+		}
+
+		return nil
+	}(); err != nil {
+		return nil, err
+	}
+
+	mountsDir := filepath.Join(werf.GetSharedContextDir(), "mounts", "projects")
+	if _, err := os.Stat(mountsDir); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error accessing dir %q: %s", mountsDir, err)
+	} else if err == nil {
+		files, err := ioutil.ReadDir(mountsDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading dir %q: %s", mountsDir, err)
+		}
+
+		for _, finfo := range files {
+			if !finfo.IsDir() {
+				continue
+			}
+
+			projectMountsDir := filepath.Join(mountsDir, finfo.Name())
+			size, err := volumeutils.DirSizeBytes(projectMountsDir)
+			if err != nil {
+				return nil, fmt.Errorf("error getting dir %q size: %s", projectMountsDir, err)
+			}
+
+			report.add(UsageTypeBuildDirMounts, finfo.Name(), size, time.Time{})
+		}
+	}
+
+	report.sortRecords()
+
+	return report, nil
+}
+
+func (report *HostUsageReport) add(usageType, projectName string, bytes uint64, lastAccessAt time.Time) {
+	var record *HostUsageRecord
+	for _, r := range report.Records {
+		if r.Type == usageType && r.Project == projectName {
+			record = r
+			break
+		}
+	}
+
+	if record == nil {
+		record = &HostUsageRecord{Type: usageType, Project: projectName}
+		report.Records = append(report.Records, record)
+	}
+
+	record.Entries++
+	record.Bytes += bytes
+	report.TotalBytes += bytes
+
+	if !lastAccessAt.IsZero() && (record.LastAccessAt == nil || lastAccessAt.After(*record.LastAccessAt)) {
+		t := lastAccessAt
+		record.LastAccessAt = &t
+	}
+}
+
+func (report *HostUsageReport) sortRecords() {
+	typeIndex := func(usageType string) int {
+		for ind, t := range usageTypesOrder {
+			if t == usageType {
+				return ind
+			}
+		}
+		return len(usageTypesOrder)
+	}
+
+	sort.SliceStable(report.Records, func(i, j int) bool {
+		if report.Records[i].Type != report.Records[j].Type {
+			return typeIndex(report.Records[i].Type) < typeIndex(report.Records[j].Type)
+		}
+		return report.Records[i].Project < report.Records[j].Project
+	})
+}
+
+func (report *HostUsageReport) ToJsonData() ([]byte, error) {
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, []byte("\n")...)
+
+	return data, nil
+}
+
+// ToTextData prints the report as a table, the shared data is printed with the dash instead of the project
+func (report *HostUsageReport) ToTextData() []byte {
+	buf := bytes.NewBuffer([]byte{})
+
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "TYPE\tPROJECT\tENTRIES\tSIZE\tLAST ACCESS\n")
+
+	for _, record := range report.Records {
+		projectName := record.Project
+		if projectName == "" {
+			projectName = "-"
+		}
+
+		lastAccess := "-"
+		if record.LastAccessAt != nil {
+			lastAccess = humanize.Time(*record.LastAccessAt)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", record.Type, projectName, record.Entries, humanize.Bytes(record.Bytes), lastAccess)
+	}
+
+	fmt.Fprintf(w, "TOTAL\t\t\t%s\t\n", humanize.Bytes(report.TotalBytes))
+	_ = w.Flush()
+
+	return buf.Bytes()
+}
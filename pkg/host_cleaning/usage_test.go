@@ -0,0 +1,78 @@
+package host_cleaning
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostUsageReport(t *testing.T) {
+	now := time.Now()
+
+	report := &HostUsageReport{Records: []*HostUsageRecord{}}
+	report.add(UsageTypeBuildDirMounts, "", 5, time.Time{})
+	report.add(LocalCacheTypeManifests, "frontend", 10, now.Add(-time.Hour))
+	report.add(UsageTypeDockerImages, "frontend", 100, now.Add(-2*time.Hour))
+	report.add(LocalCacheTypeManifests, "frontend", 20, now)
+	report.add(UsageTypeDockerImages, "backend", 200, now.Add(-time.Hour))
+	report.add(LocalCacheTypeGitRepos, "", 1000, now)
+	report.sortRecords()
+
+	expected := []HostUsageRecord{
+		{Type: UsageTypeDockerImages, Project: "backend", Entries: 1, Bytes: 200},
+		{Type: UsageTypeDockerImages, Project: "frontend", Entries: 1, Bytes: 100},
+		{Type: LocalCacheTypeGitRepos, Project: "", Entries: 1, Bytes: 1000},
+		{Type: LocalCacheTypeManifests, Project: "frontend", Entries: 2, Bytes: 30},
+		{Type: UsageTypeBuildDirMounts, Project: "", Entries: 1, Bytes: 5},
+	}
+
+	if len(report.Records) != len(expected) {
+		t.Fatalf("expected %d records, got %d", len(expected), len(report.Records))
+	}
+
+	for ind, record := range report.Records {
+		if record.Type != expected[ind].Type || record.Project != expected[ind].Project || record.Entries != expected[ind].Entries || record.Bytes != expected[ind].Bytes {
+			t.Errorf("record %d: expected %+v, got %+v", ind, expected[ind], *record)
+		}
+	}
+
+	if report.TotalBytes != 1335 {
+		t.Errorf("expected total 1335 bytes, got %d", report.TotalBytes)
+	}
+
+	if lastAccessAt := report.Records[3].LastAccessAt; lastAccessAt == nil || !lastAccessAt.Equal(now) {
+		t.Errorf("expected the latest access of the entries, got %v", lastAccessAt)
+	}
+
+	if lastAccessAt := report.Records[4].LastAccessAt; lastAccessAt != nil {
+		t.Errorf("expected unknown last access, got %v", lastAccessAt)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(report.ToTextData())), "\n")
+	if len(lines) != len(expected)+2 {
+		t.Fatalf("expected header, %d records and total lines, got:\n%s", len(expected), strings.Join(lines, "\n"))
+	}
+
+	if fields := strings.Fields(lines[3]); fields[0] != LocalCacheTypeGitRepos || fields[1] != "-" {
+		t.Errorf("expected shared data to be printed with the dash, got %q", lines[3])
+	}
+
+	if fields := strings.Fields(lines[len(lines)-1]); fields[0] != "TOTAL" || fields[1]+" "+fields[2] != "1.3 kB" {
+		t.Errorf("unexpected total line %q", lines[len(lines)-1])
+	}
+
+	data, err := report.ToJsonData()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	parsedReport := &HostUsageReport{}
+	if err := json.Unmarshal(data, parsedReport); err != nil {
+		t.Fatalf("unable to unmarshal report: %s\n%s", err, data)
+	}
+
+	if len(parsedReport.Records) != len(expected) || parsedReport.TotalBytes != report.TotalBytes {
+		t.Errorf("unexpected report %s", data)
+	}
+}
@@ -23,4 +23,7 @@ const (
 	BuildCacheVersion = "1.2"
 
 	StageContainerNamePrefix = "werf.build."
+
+	// UnstoredStageImageRepository is the local repository of the built stage images, which are not stored into the stages storage yet
+	UnstoredStageImageRepository = "werf-unstored-stage"
 )
@@ -21,6 +21,10 @@ type Info struct {
 	Labels            map[string]string `json:"labels"`
 	Size              int64             `json:"size"`
 	CreatedAtUnixNano int64             `json:"createdAtUnixNano"`
+
+	// PlatformImageIDs are the IDs of the platform-specific images of the manifest list,
+	// the other fields of the manifest list describe the first platform-specific image
+	PlatformImageIDs []string `json:"platformImageIDs,omitempty"`
 }
 
 func (info *Info) SetCreatedAtUnix(seconds int64) {
@@ -18,7 +18,7 @@ import (
 )
 
 const (
-	ManifestCacheVersion = "4"
+	ManifestCacheVersion = "5"
 )
 
 type ManifestCache struct {
@@ -78,6 +78,85 @@ func (cache *ManifestCache) StoreImageInfo(ctx context.Context, storageName stri
 	return cache.writeRecord(storageName, record)
 }
 
+// ManifestCacheEntry is the manifest cache record file of the image in the storage
+type ManifestCacheEntry struct {
+	Path         string
+	StorageName  string
+	ImageName    string
+	Labels       map[string]string
+	Size         uint64
+	LastAccessAt time.Time
+}
+
+// GetEntries returns the records of all storages, the invalid records are skipped
+func (cache *ManifestCache) GetEntries(ctx context.Context) ([]*ManifestCacheEntry, error) {
+	if _, err := os.Stat(cache.CacheDir); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error accessing %s: %s", cache.CacheDir, err)
+	}
+
+	storageDirs, err := ioutil.ReadDir(cache.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dir %s: %s", cache.CacheDir, err)
+	}
+
+	var res []*ManifestCacheEntry
+	for _, storageDir := range storageDirs {
+		if !storageDir.IsDir() {
+			continue
+		}
+
+		storageDirPath := filepath.Join(cache.CacheDir, storageDir.Name())
+		files, err := ioutil.ReadDir(storageDirPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading dir %s: %s", storageDirPath, err)
+		}
+
+		for _, finfo := range files {
+			filePath := filepath.Join(storageDirPath, finfo.Name())
+
+			dataBytes, err := ioutil.ReadFile(filePath)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("error reading %s: %s", filePath, err)
+			}
+
+			record := &ManifestCacheRecord{}
+			if err := json.Unmarshal(dataBytes, record); err != nil || record.Info == nil {
+				logboek.Context(ctx).Debug().LogF("-- ManifestCache.GetEntries skip invalid record %s\n", filePath)
+				continue
+			}
+
+			res = append(res, &ManifestCacheEntry{
+				Path:         filePath,
+				StorageName:  storageDir.Name(),
+				ImageName:    record.Info.Name,
+				Labels:       record.Info.Labels,
+				Size:         uint64(finfo.Size()),
+				LastAccessAt: time.Unix(record.AccessTimestamp, 0),
+			})
+		}
+	}
+
+	return res, nil
+}
+
+func (cache *ManifestCache) RemoveEntry(ctx context.Context, entry *ManifestCacheEntry) error {
+	if lock, err := cache.lock(ctx, entry.StorageName, entry.ImageName); err != nil {
+		return err
+	} else {
+		defer cache.unlock(lock)
+	}
+
+	if err := os.RemoveAll(entry.Path); err != nil {
+		return fmt.Errorf("unable to remove %s: %s", entry.Path, err)
+	}
+
+	return nil
+}
+
 func (cache *ManifestCache) readRecord(ctx context.Context, storageName, imageName string) (*ManifestCacheRecord, error) {
 	filePath := cache.constructFilePathForImage(storageName, imageName)
 
@@ -0,0 +1,100 @@
+package image
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/werf/werf/pkg/werf"
+)
+
+func TestManifestCacheGetEntries(t *testing.T) {
+	if err := werf.Init(t.TempDir(), t.TempDir()); err != nil {
+		t.Fatalf("unable to init werf: %s", err)
+	}
+
+	ctx := context.Background()
+	cache := NewManifestCache(filepath.Join(t.TempDir(), "manifests", ManifestCacheVersion))
+
+	entries, err := cache.GetEntries(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("expected no entries in the cache not created yet, got %v", entries)
+	}
+
+	before := time.Now().Add(-time.Second)
+
+	for _, info := range []*Info{
+		{Name: "registry.example.com/project:backend", Labels: map[string]string{WerfLabel: "project"}},
+		{Name: "registry.example.com/project:frontend", Labels: map[string]string{WerfLabel: "project"}},
+	} {
+		if err := cache.StoreImageInfo(ctx, "registry.example.com/project", info); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if err := cache.StoreImageInfo(ctx, "registry.example.com/other", &Info{Name: "registry.example.com/other:image"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	storageDir := filepath.Dir(cache.constructFilePathForImage("registry.example.com/other", "image"))
+	if err := ioutil.WriteFile(filepath.Join(storageDir, "invalid"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cache.CacheDir, "not-a-storage-dir"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = cache.GetEntries(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ImageName < entries[j].ImageName
+	})
+
+	if entries[0].ImageName != "registry.example.com/other:image" || entries[0].Labels[WerfLabel] != "" {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+
+	if entries[1].ImageName != "registry.example.com/project:backend" || entries[1].Labels[WerfLabel] != "project" {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+
+	for _, entry := range entries {
+		info, err := os.Stat(entry.Path)
+		if err != nil {
+			t.Fatalf("unable to stat entry path: %s", err)
+		}
+
+		if entry.Size != uint64(info.Size()) {
+			t.Errorf("expected size %d, got %d", info.Size(), entry.Size)
+		}
+
+		if entry.LastAccessAt.Before(before) {
+			t.Errorf("expected last access time after %s, got %s", before, entry.LastAccessAt)
+		}
+	}
+
+	if err := cache.RemoveEntry(ctx, entries[1]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if info, err := cache.GetImageInfo(ctx, "registry.example.com/project", "registry.example.com/project:backend"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if info != nil {
+		t.Errorf("expected removed entry not to be found")
+	}
+}
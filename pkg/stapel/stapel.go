@@ -43,6 +43,17 @@ func getContainer() container {
 	}
 }
 
+// ContainerName is the name of the container with the stapel volume, the container runtime mounts the stapel toolchain
+// instead of the volumes from this container if the runtime does not use the docker server
+func ContainerName() string {
+	return getContainer().Name
+}
+
+// Volume is the path of the stapel toolchain in the stapel image and in the stage containers
+func Volume() string {
+	return getContainer().Volume
+}
+
 func GetOrCreateContainer(ctx context.Context) (string, error) {
 	container := getContainer()
 
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+const BoltStagesStorageCacheBucket = "stages-storage-cache"
+
+// BoltStagesStorageCache stores stages in the embedded bolt database: stages-storage-cache/NAMESPACE/PROJECT bucket with the digest as a key.
+// Namespace allows to keep independent caches in the single database file (synchronization server uses client id as a namespace).
+type BoltStagesStorageCache struct {
+	DB        *bolt.DB
+	Namespace string
+}
+
+func NewBoltStagesStorageCache(db *bolt.DB, namespace string) *BoltStagesStorageCache {
+	return &BoltStagesStorageCache{DB: db, Namespace: namespace}
+}
+
+func (cache *BoltStagesStorageCache) String() string {
+	return fmt.Sprintf("bolt %s/%s/%s", cache.DB.Path(), BoltStagesStorageCacheBucket, cache.Namespace)
+}
+
+func (cache *BoltStagesStorageCache) GetAllStages(ctx context.Context, projectName string) (bool, []image.StageID, error) {
+	var found bool
+	var res []image.StageID
+
+	if err := cache.DB.View(func(tx *bolt.Tx) error {
+		bucket := cache.projectBucket(tx, projectName)
+		if bucket == nil {
+			return nil
+		}
+
+		found = true
+		return bucket.ForEach(func(digest, data []byte) error {
+			if stages, ok := cache.unmarshalRecord(ctx, projectName, string(digest), data); ok {
+				res = append(res, stages...)
+			}
+			return nil
+		})
+	}); err != nil {
+		return false, nil, fmt.Errorf("unable to get all stages of project %s from %s: %s", projectName, cache.String(), err)
+	}
+
+	return found, res, nil
+}
+
+func (cache *BoltStagesStorageCache) DeleteAllStages(_ context.Context, projectName string) error {
+	if err := cache.DB.Update(func(tx *bolt.Tx) error {
+		namespaceBucket := cache.namespaceBucket(tx)
+		if namespaceBucket == nil || namespaceBucket.Bucket([]byte(projectName)) == nil {
+			return nil
+		}
+		return namespaceBucket.DeleteBucket([]byte(projectName))
+	}); err != nil {
+		return fmt.Errorf("unable to delete all stages of project %s from %s: %s", projectName, cache.String(), err)
+	}
+
+	return nil
+}
+
+func (cache *BoltStagesStorageCache) GetStagesByDigest(ctx context.Context, projectName, digest string) (bool, []image.StageID, error) {
+	var data []byte
+
+	if err := cache.DB.View(func(tx *bolt.Tx) error {
+		if bucket := cache.projectBucket(tx, projectName); bucket != nil {
+			if value := bucket.Get([]byte(digest)); value != nil {
+				// value is only valid during the transaction
+				data = append([]byte{}, value...)
+			}
+		}
+		return nil
+	}); err != nil {
+		return false, nil, fmt.Errorf("unable to get stages by digest %s of project %s from %s: %s", digest, projectName, cache.String(), err)
+	}
+
+	if data == nil {
+		return false, nil, nil
+	}
+
+	stages, ok := cache.unmarshalRecord(ctx, projectName, digest, data)
+	return ok, stages, nil
+}
+
+func (cache *BoltStagesStorageCache) StoreStagesByDigest(_ context.Context, projectName, digest string, stages []image.StageID) error {
+	data, err := json.Marshal(StagesStorageCacheRecord{Stages: stages})
+	if err != nil {
+		return err
+	}
+
+	if err := cache.DB.Update(func(tx *bolt.Tx) error {
+		rootBucket, err := tx.CreateBucketIfNotExists([]byte(BoltStagesStorageCacheBucket))
+		if err != nil {
+			return err
+		}
+
+		namespaceBucket, err := rootBucket.CreateBucketIfNotExists([]byte(cache.Namespace))
+		if err != nil {
+			return err
+		}
+
+		bucket, err := namespaceBucket.CreateBucketIfNotExists([]byte(projectName))
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(digest), data)
+	}); err != nil {
+		return fmt.Errorf("unable to store stages by digest %s of project %s into %s: %s", digest, projectName, cache.String(), err)
+	}
+
+	return nil
+}
+
+func (cache *BoltStagesStorageCache) DeleteStagesByDigest(_ context.Context, projectName, digest string) error {
+	if err := cache.DB.Update(func(tx *bolt.Tx) error {
+		if bucket := cache.projectBucket(tx, projectName); bucket != nil {
+			return bucket.Delete([]byte(digest))
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to delete stages by digest %s of project %s from %s: %s", digest, projectName, cache.String(), err)
+	}
+
+	return nil
+}
+
+func (cache *BoltStagesStorageCache) namespaceBucket(tx *bolt.Tx) *bolt.Bucket {
+	rootBucket := tx.Bucket([]byte(BoltStagesStorageCacheBucket))
+	if rootBucket == nil {
+		return nil
+	}
+	return rootBucket.Bucket([]byte(cache.Namespace))
+}
+
+func (cache *BoltStagesStorageCache) projectBucket(tx *bolt.Tx, projectName string) *bolt.Bucket {
+	namespaceBucket := cache.namespaceBucket(tx)
+	if namespaceBucket == nil {
+		return nil
+	}
+	return namespaceBucket.Bucket([]byte(projectName))
+}
+
+func (cache *BoltStagesStorageCache) unmarshalRecord(ctx context.Context, projectName, digest string, data []byte) ([]image.StageID, bool) {
+	res := &StagesStorageCacheRecord{}
+	if err := json.Unmarshal(data, res); err != nil {
+		logboek.Context(ctx).Error().LogF("Error unmarshalling json of project %s digest %s from %s: %s: will ignore cache\n", projectName, digest, cache.String(), err)
+		return nil, false
+	}
+
+	return res.Stages, true
+}
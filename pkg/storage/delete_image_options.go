@@ -2,6 +2,8 @@ package storage
 
 type DeleteImageOptions struct {
 	RmiForce bool
+	// SkipArtifactsDeletion disables the lookup and deletion of OCI artifacts attached to the stage in the repo
+	SkipArtifactsDeletion bool
 }
 
 type FilterStagesAndProcessRelatedDataOptions struct {
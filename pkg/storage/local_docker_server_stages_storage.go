@@ -140,6 +140,10 @@ func (storage *LocalDockerServerStagesStorage) FetchImage(_ context.Context, _ c
 }
 
 func (storage *LocalDockerServerStagesStorage) StoreImage(ctx context.Context, img container_runtime.Image) error {
+	if _, ok := img.(*container_runtime.ManifestListImage); ok {
+		return errMultiPlatformImagesNotSupported(storage)
+	}
+
 	return storage.LocalDockerServerRuntime.TagImageByName(ctx, img)
 }
 
@@ -21,6 +21,7 @@ var CommonLRUImagesCache *LRUImagesCache
 
 func Init() error {
 	CommonLRUImagesCache = NewLRUImagesCache(filepath.Join(werf.GetLocalCacheDir(), "lru_images", LRUImagesCacheVersion))
+	CommonLRUPathsCache = NewLRUPathsCache(filepath.Join(werf.GetLocalCacheDir(), "lru_paths", LRUPathsCacheVersion))
 	return nil
 }
 
@@ -0,0 +1,157 @@
+package lrumeta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/logboek"
+	"github.com/werf/werf/pkg/util"
+	"github.com/werf/werf/pkg/werf"
+)
+
+const LRUPathsCacheVersion = "1"
+
+var CommonLRUPathsCache *LRUPathsCache
+
+// LRUPathsCache tracks the access time of the local cache paths, which do not store the access time themselves (e.g. helm chart dependencies)
+type LRUPathsCache struct {
+	CacheDir string
+}
+
+type LRUPathsCacheRecord struct {
+	AccessTimestampNanosec int64
+	Path                   string
+}
+
+func NewLRUPathsCache(cacheDir string) *LRUPathsCache {
+	return &LRUPathsCache{CacheDir: cacheDir}
+}
+
+// AccessPath updates the access time of the path, nil cache (lrumeta is not initialized by the command) does not track the access
+func (cache *LRUPathsCache) AccessPath(ctx context.Context, path string) error {
+	if cache == nil {
+		return nil
+	}
+
+	logProcess := logboek.Context(ctx).Debug().LogProcess("-- LRUPathsCache.AccessPath %s", path)
+	logProcess.Start()
+	defer logProcess.End()
+
+	if lock, err := cache.lock(ctx, path); err != nil {
+		return err
+	} else {
+		defer cache.unlock(lock)
+	}
+
+	record := &LRUPathsCacheRecord{
+		AccessTimestampNanosec: time.Now().UnixNano(),
+		Path:                   path,
+	}
+
+	return cache.writeRecord(record)
+}
+
+// GetPathLastAccessTime returns zero time if the access of the path has not been tracked
+func (cache *LRUPathsCache) GetPathLastAccessTime(ctx context.Context, path string) (time.Time, error) {
+	logProcess := logboek.Context(ctx).Debug().LogProcess("-- LRUPathsCache.GetPathLastAccessTime %s", path)
+	logProcess.Start()
+	defer logProcess.End()
+
+	if lock, err := cache.lock(ctx, path); err != nil {
+		return time.Time{}, err
+	} else {
+		defer cache.unlock(lock)
+	}
+
+	record, err := cache.readRecord(ctx, path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if record == nil {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(record.AccessTimestampNanosec/1_000_000_000, record.AccessTimestampNanosec%1_000_000_000), nil
+}
+
+// ForgetPath removes the record of the path, should be called when the path is removed
+func (cache *LRUPathsCache) ForgetPath(ctx context.Context, path string) error {
+	if lock, err := cache.lock(ctx, path); err != nil {
+		return err
+	} else {
+		defer cache.unlock(lock)
+	}
+
+	filePath := cache.constructFilePathForPath(path)
+	if err := os.RemoveAll(filePath); err != nil {
+		return fmt.Errorf("unable to remove %s: %s", filePath, err)
+	}
+
+	return nil
+}
+
+func (cache *LRUPathsCache) readRecord(ctx context.Context, path string) (*LRUPathsCacheRecord, error) {
+	filePath := cache.constructFilePathForPath(path)
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error accessing %s: %s", filePath, err)
+	}
+
+	if dataBytes, err := ioutil.ReadFile(filePath); err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", filePath, err)
+	} else {
+		record := &LRUPathsCacheRecord{}
+		if err := json.Unmarshal(dataBytes, record); err != nil {
+			logboek.Context(ctx).Error().LogF("WARNING: invalid lru paths cache json record in file %s: %s: resetting record\n", filePath, err)
+			return nil, nil
+		}
+		return record, nil
+	}
+}
+
+func (cache *LRUPathsCache) writeRecord(record *LRUPathsCacheRecord) error {
+	filePath := cache.constructFilePathForPath(record.Path)
+
+	dirPath := filepath.Dir(filePath)
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating dir %s: %s", dirPath, err)
+	}
+
+	if dataBytes, err := json.Marshal(record); err != nil {
+		return fmt.Errorf("error marshalling json: %s", err)
+	} else {
+		if err := ioutil.WriteFile(filePath, append(dataBytes, []byte("\n")...), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %s", filePath, err)
+		}
+		return nil
+	}
+}
+
+func (cache *LRUPathsCache) constructFilePathForPath(path string) string {
+	return filepath.Join(cache.CacheDir, util.Sha256Hash(path))
+}
+
+func (cache *LRUPathsCache) lock(ctx context.Context, path string) (lockgate.LockHandle, error) {
+	lockName := fmt.Sprintf("lru_paths_cache.%s", path)
+	if _, lock, err := werf.AcquireHostLock(ctx, lockName, lockgate.AcquireOptions{}); err != nil {
+		return lockgate.LockHandle{}, fmt.Errorf("cannot acquire %s host lock: %s", lockName, err)
+	} else {
+		return lock, nil
+	}
+}
+
+func (cache *LRUPathsCache) unlock(lock lockgate.LockHandle) error {
+	if err := werf.ReleaseHostLock(lock); err != nil {
+		return fmt.Errorf("cannot release %s host lock: %s", lock.LockName, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package lrumeta
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/werf/werf/pkg/werf"
+)
+
+func TestLRUPathsCache(t *testing.T) {
+	if err := werf.Init(t.TempDir(), t.TempDir()); err != nil {
+		t.Fatalf("unable to init werf: %s", err)
+	}
+
+	ctx := context.Background()
+	cache := NewLRUPathsCache(filepath.Join(t.TempDir(), "lru_paths", LRUPathsCacheVersion))
+	path := filepath.Join(werf.GetLocalCacheDir(), "helm_chart_dependencies", "1", "deps")
+
+	lastAccessAt, err := cache.GetPathLastAccessTime(ctx, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !lastAccessAt.IsZero() {
+		t.Errorf("expected zero time for the path not accessed, got %s", lastAccessAt)
+	}
+
+	before := time.Now()
+	if err := cache.AccessPath(ctx, path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	lastAccessAt, err = cache.GetPathLastAccessTime(ctx, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if lastAccessAt.Before(before) || lastAccessAt.After(time.Now()) {
+		t.Errorf("expected access time between %s and now, got %s", before, lastAccessAt)
+	}
+
+	otherLastAccessAt, err := cache.GetPathLastAccessTime(ctx, path+"-other")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !otherLastAccessAt.IsZero() {
+		t.Errorf("expected the access time to be tracked by the path, got %s for the other path", otherLastAccessAt)
+	}
+
+	if err := cache.ForgetPath(ctx, path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	lastAccessAt, err = cache.GetPathLastAccessTime(ctx, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !lastAccessAt.IsZero() {
+		t.Errorf("expected zero time for the forgotten path, got %s", lastAccessAt)
+	}
+}
+
+func TestLRUPathsCacheNotInitialized(t *testing.T) {
+	var cache *LRUPathsCache
+	if err := cache.AccessPath(context.Background(), "/path"); err != nil {
+		t.Errorf("expected nil cache not to track the access, got error: %s", err)
+	}
+}
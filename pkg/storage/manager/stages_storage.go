@@ -44,6 +44,9 @@ type StagesStorageManager struct {
 
 	SecondaryStagesStorageList []storage.StagesStorage
 
+	// CacheStagesStorageList are the read-only stages storages, which stages are used without copying into the primary stages storage until the stage image is needed
+	CacheStagesStorageList []storage.StagesStorage
+
 	// These will be released automatically when current process exits
 	SharedHostImagesLocks []lockgate.LockHandle
 }
@@ -278,7 +281,7 @@ func (m *StagesStorageManager) GetStagesByDigestFromStagesStorage(ctx context.Co
 }
 
 func (m *StagesStorageManager) CopySuitableByDigestStage(ctx context.Context, stageDesc *image.StageDescription, sourceStagesStorage, destinationStagesStorage storage.StagesStorage, containerRuntime container_runtime.ContainerRuntime) (*image.StageDescription, error) {
-	img := container_runtime.NewStageImage(nil, stageDesc.Info.Name, containerRuntime.(*container_runtime.LocalDockerServerRuntime))
+	img := container_runtime.NewStageImage(nil, stageDesc.Info.Name, containerRuntime)
 
 	logboek.Context(ctx).Info().LogF("Fetching %s\n", img.Name())
 	if err := sourceStagesStorage.FetchImage(ctx, &container_runtime.DockerImage{Image: img}); err != nil {
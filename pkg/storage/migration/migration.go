@@ -0,0 +1,326 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage"
+	"github.com/werf/werf/pkg/util/parallel"
+)
+
+type MigrateOptions struct {
+	MaxNumberOfWorkers int
+}
+
+// Migrate copies stages, managed images, images metadata, imports metadata and client ID records
+// from one stages storage into another without the container runtime.
+// Already existing destination records are skipped, so an interrupted migration can be resumed by running it again.
+func Migrate(ctx context.Context, projectName string, fromStagesStorage, toStagesStorage storage.StagesStorage, options MigrateOptions) error {
+	fromAccessor, ok := fromStagesStorage.(storage.StageImageAccessor)
+	if !ok {
+		return fmt.Errorf("unable to migrate from %s: stages storage does not support direct stage images access", fromStagesStorage.String())
+	}
+
+	toAccessor, ok := toStagesStorage.(storage.StageImageAccessor)
+	if !ok {
+		return fmt.Errorf("unable to migrate to %s: stages storage does not support direct stage images access", toStagesStorage.String())
+	}
+
+	return (&migrationManager{
+		ProjectName:        projectName,
+		FromStagesStorage:  fromStagesStorage,
+		ToStagesStorage:    toStagesStorage,
+		FromAccessor:       fromAccessor,
+		ToAccessor:         toAccessor,
+		MaxNumberOfWorkers: options.MaxNumberOfWorkers,
+	}).run(ctx)
+}
+
+type migrationManager struct {
+	ProjectName        string
+	FromStagesStorage  storage.StagesStorage
+	ToStagesStorage    storage.StagesStorage
+	FromAccessor       storage.StageImageAccessor
+	ToAccessor         storage.StageImageAccessor
+	MaxNumberOfWorkers int
+}
+
+func (m *migrationManager) run(ctx context.Context) error {
+	if err := logboek.Context(ctx).Default().LogProcess("Migrating stages").DoError(func() error {
+		return m.migrateStages(ctx)
+	}); err != nil {
+		return err
+	}
+
+	var managedImages []string
+	if err := logboek.Context(ctx).Default().LogProcess("Migrating managed images").DoError(func() error {
+		var err error
+		managedImages, err = m.migrateManagedImages(ctx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := logboek.Context(ctx).Default().LogProcess("Migrating images metadata").DoError(func() error {
+		return m.migrateImagesMetadata(ctx, managedImages)
+	}); err != nil {
+		return err
+	}
+
+	if err := logboek.Context(ctx).Default().LogProcess("Migrating imports metadata").DoError(func() error {
+		return m.migrateImportsMetadata(ctx)
+	}); err != nil {
+		return err
+	}
+
+	return logboek.Context(ctx).Default().LogProcess("Migrating client ID records").DoError(func() error {
+		return m.migrateClientIDRecords(ctx)
+	})
+}
+
+func (m *migrationManager) migrateStages(ctx context.Context) error {
+	stageIDs, err := m.FromStagesStorage.GetStagesIDs(ctx, m.ProjectName)
+	if err != nil {
+		return fmt.Errorf("unable to get stages of %s: %s", m.FromStagesStorage.String(), err)
+	}
+
+	existingStageIDs, err := m.ToStagesStorage.GetStagesIDs(ctx, m.ProjectName)
+	if err != nil {
+		return fmt.Errorf("unable to get stages of %s: %s", m.ToStagesStorage.String(), err)
+	}
+
+	existing := map[string]bool{}
+	for _, stageID := range existingStageIDs {
+		existing[stageID.String()] = true
+	}
+
+	var tasks []image.StageID
+	for _, stageID := range stageIDs {
+		if !existing[stageID.String()] {
+			tasks = append(tasks, stageID)
+		}
+	}
+
+	logboek.Context(ctx).Default().LogF("Found %d stages, %d already migrated\n", len(stageIDs), len(stageIDs)-len(tasks))
+
+	return parallel.DoTasks(ctx, len(tasks), parallel.DoTasksOptions{
+		MaxNumberOfWorkers: m.MaxNumberOfWorkers,
+	}, func(ctx context.Context, taskId int) error {
+		return m.migrateStage(ctx, tasks[taskId])
+	})
+}
+
+func (m *migrationManager) migrateStage(ctx context.Context, stageID image.StageID) error {
+	// rejected and broken stages are not migrated
+	if stageDesc, err := m.FromStagesStorage.GetStageDescription(ctx, m.ProjectName, stageID.Digest, stageID.UniqueID); err == storage.ErrBrokenImage || (err == nil && stageDesc == nil) {
+		logboek.Context(ctx).Warn().LogF("Skipping stage %s: stage is rejected or broken in %s\n", stageID.String(), m.FromStagesStorage.String())
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get stage %s description: %s", stageID.String(), err)
+	}
+
+	// multi-platform stages are copied as the image indexes, reading them as images would flatten them to the single platform
+	if fromIndexAccessor, ok := m.FromStagesStorage.(storage.StageIndexAccessor); ok {
+		idx, err := fromIndexAccessor.GetStageIndex(ctx, m.ProjectName, stageID)
+		if err != nil {
+			return fmt.Errorf("unable to get stage %s image index: %s", stageID.String(), err)
+		} else if idx != nil {
+			return m.migrateStageIndex(ctx, stageID, idx)
+		}
+	}
+
+	img, err := m.FromAccessor.GetStageImage(ctx, m.ProjectName, stageID)
+	if err != nil {
+		return fmt.Errorf("unable to get stage %s image: %s", stageID.String(), err)
+	} else if img == nil {
+		logboek.Context(ctx).Warn().LogF("Skipping stage %s: stage not found in %s\n", stageID.String(), m.FromStagesStorage.String())
+		return nil
+	}
+
+	return logboek.Context(ctx).Default().LogProcess("Copying stage %s", stageID.String()).DoError(func() error {
+		if err := m.ToAccessor.PutStageImage(ctx, m.ProjectName, stageID, img); err != nil {
+			return fmt.Errorf("unable to put stage %s image: %s", stageID.String(), err)
+		}
+		return nil
+	})
+}
+
+func (m *migrationManager) migrateStageIndex(ctx context.Context, stageID image.StageID, idx v1.ImageIndex) error {
+	toIndexAccessor, ok := m.ToStagesStorage.(storage.StageIndexAccessor)
+	if !ok {
+		return fmt.Errorf("unable to migrate multi-platform stage %s: %s does not support image indexes", stageID.String(), m.ToStagesStorage.String())
+	}
+
+	return logboek.Context(ctx).Default().LogProcess("Copying multi-platform stage %s", stageID.String()).DoError(func() error {
+		if err := toIndexAccessor.PutStageIndex(ctx, m.ProjectName, stageID, idx); err != nil {
+			return fmt.Errorf("unable to put stage %s image index: %s", stageID.String(), err)
+		}
+		return nil
+	})
+}
+
+func (m *migrationManager) migrateManagedImages(ctx context.Context) ([]string, error) {
+	managedImages, err := m.FromStagesStorage.GetManagedImages(ctx, m.ProjectName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get managed images of %s: %s", m.FromStagesStorage.String(), err)
+	}
+
+	existingManagedImages, err := m.ToStagesStorage.GetManagedImages(ctx, m.ProjectName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get managed images of %s: %s", m.ToStagesStorage.String(), err)
+	}
+
+	existing := map[string]bool{}
+	for _, managedImage := range existingManagedImages {
+		existing[managedImage] = true
+	}
+
+	var tasks []string
+	for _, managedImage := range managedImages {
+		if !existing[managedImage] {
+			tasks = append(tasks, managedImage)
+		}
+	}
+
+	return managedImages, parallel.DoTasks(ctx, len(tasks), parallel.DoTasksOptions{
+		MaxNumberOfWorkers: m.MaxNumberOfWorkers,
+	}, func(ctx context.Context, taskId int) error {
+		managedImage := tasks[taskId]
+		if err := m.ToStagesStorage.AddManagedImage(ctx, m.ProjectName, managedImage); err != nil {
+			return fmt.Errorf("unable to add managed image %q: %s", managedImage, err)
+		}
+		return nil
+	})
+}
+
+type imageMetadataTask struct {
+	imageName string
+	commit    string
+	stageID   string
+}
+
+func (m *migrationManager) migrateImagesMetadata(ctx context.Context, managedImages []string) error {
+	imageMetadataByImageName, notManagedImageMetadataByImageNameID, err := m.FromStagesStorage.GetAllAndGroupImageMetadataByImageName(ctx, m.ProjectName, managedImages)
+	if err != nil {
+		return fmt.Errorf("unable to get images metadata of %s: %s", m.FromStagesStorage.String(), err)
+	}
+
+	existingImageMetadataByImageName, _, err := m.ToStagesStorage.GetAllAndGroupImageMetadataByImageName(ctx, m.ProjectName, managedImages)
+	if err != nil {
+		return fmt.Errorf("unable to get images metadata of %s: %s", m.ToStagesStorage.String(), err)
+	}
+
+	// Image metadata records keep only the image name ID, so that the records of not managed images cannot be recreated.
+	// Such records are only removed by the cleanup, so nothing is lost.
+	for imageNameID := range notManagedImageMetadataByImageNameID {
+		logboek.Context(ctx).Warn().LogF("Skipping metadata of not managed image %s\n", imageNameID)
+	}
+
+	var tasks []imageMetadataTask
+	for imageName, stageIDCommitList := range imageMetadataByImageName {
+		for stageID, commitList := range stageIDCommitList {
+			existing := map[string]bool{}
+			for _, commit := range existingImageMetadataByImageName[imageName][stageID] {
+				existing[commit] = true
+			}
+
+			for _, commit := range commitList {
+				if !existing[commit] {
+					tasks = append(tasks, imageMetadataTask{imageName: imageName, commit: commit, stageID: stageID})
+				}
+			}
+		}
+	}
+
+	return parallel.DoTasks(ctx, len(tasks), parallel.DoTasksOptions{
+		MaxNumberOfWorkers: m.MaxNumberOfWorkers,
+	}, func(ctx context.Context, taskId int) error {
+		task := tasks[taskId]
+		if err := m.ToStagesStorage.PutImageMetadata(ctx, m.ProjectName, task.imageName, task.commit, task.stageID); err != nil {
+			return fmt.Errorf("unable to put image %q metadata: %s", task.imageName, err)
+		}
+		return nil
+	})
+}
+
+func (m *migrationManager) migrateImportsMetadata(ctx context.Context) error {
+	ids, err := m.FromStagesStorage.GetImportMetadataIDs(ctx, m.ProjectName)
+	if err != nil {
+		return fmt.Errorf("unable to get imports metadata of %s: %s", m.FromStagesStorage.String(), err)
+	}
+
+	existingIDs, err := m.ToStagesStorage.GetImportMetadataIDs(ctx, m.ProjectName)
+	if err != nil {
+		return fmt.Errorf("unable to get imports metadata of %s: %s", m.ToStagesStorage.String(), err)
+	}
+
+	existing := map[string]bool{}
+	for _, id := range existingIDs {
+		existing[id] = true
+	}
+
+	var tasks []string
+	for _, id := range ids {
+		if !existing[id] {
+			tasks = append(tasks, id)
+		}
+	}
+
+	return parallel.DoTasks(ctx, len(tasks), parallel.DoTasksOptions{
+		MaxNumberOfWorkers: m.MaxNumberOfWorkers,
+	}, func(ctx context.Context, taskId int) error {
+		id := tasks[taskId]
+
+		metadata, err := m.FromStagesStorage.GetImportMetadata(ctx, m.ProjectName, id)
+		if err != nil {
+			return fmt.Errorf("unable to get import metadata %s: %s", id, err)
+		} else if metadata == nil {
+			return nil
+		}
+
+		if err := m.ToStagesStorage.PutImportMetadata(ctx, m.ProjectName, metadata); err != nil {
+			return fmt.Errorf("unable to put import metadata %s: %s", id, err)
+		}
+
+		return nil
+	})
+}
+
+func (m *migrationManager) migrateClientIDRecords(ctx context.Context) error {
+	records, err := m.FromStagesStorage.GetClientIDRecords(ctx, m.ProjectName)
+	if err != nil {
+		return fmt.Errorf("unable to get client ID records of %s: %s", m.FromStagesStorage.String(), err)
+	}
+
+	existingRecords, err := m.ToStagesStorage.GetClientIDRecords(ctx, m.ProjectName)
+	if err != nil {
+		return fmt.Errorf("unable to get client ID records of %s: %s", m.ToStagesStorage.String(), err)
+	}
+
+	existing := map[string]bool{}
+	for _, rec := range existingRecords {
+		existing[rec.String()] = true
+	}
+
+	var tasks []*storage.ClientIDRecord
+	for _, rec := range records {
+		if !existing[rec.String()] {
+			tasks = append(tasks, rec)
+		}
+	}
+
+	return parallel.DoTasks(ctx, len(tasks), parallel.DoTasksOptions{
+		MaxNumberOfWorkers: m.MaxNumberOfWorkers,
+	}, func(ctx context.Context, taskId int) error {
+		rec := tasks[taskId]
+		if err := m.ToStagesStorage.PostClientIDRecord(ctx, m.ProjectName, rec); err != nil {
+			return fmt.Errorf("unable to post client ID record %s: %s", rec.String(), err)
+		}
+		return nil
+	})
+}
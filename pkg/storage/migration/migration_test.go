@@ -0,0 +1,206 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/werf/werf/pkg/docker_registry"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage"
+)
+
+func newTestOCILayoutStagesStorage(t *testing.T) *storage.OCILayoutStagesStorage {
+	dir, err := ioutil.TempDir("", "werf-migration-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	stagesStorage, err := storage.NewOCILayoutStagesStorage(storage.OCILayoutStorageAddressPrefix+dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stagesStorage
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	from, to := newTestOCILayoutStagesStorage(t), newTestOCILayoutStagesStorage(t)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stageID := image.StageID{Digest: strings.Repeat("a", 56), UniqueID: 1611836746968}
+	rejectedStageID := image.StageID{Digest: strings.Repeat("b", 56), UniqueID: 1611836746969}
+	for _, id := range []image.StageID{stageID, rejectedStageID} {
+		if err := from.PutStageImage(ctx, "myproject", id, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := from.RejectStage(ctx, "myproject", rejectedStageID.Digest, rejectedStageID.UniqueID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := from.AddManagedImage(ctx, "myproject", "backend"); err != nil {
+		t.Fatal(err)
+	}
+	if err := from.PutImageMetadata(ctx, "myproject", "backend", "commit1", stageID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := from.PutImportMetadata(ctx, "myproject", &storage.ImportMetadata{ImportSourceID: "import1", SourceImageID: "sha256:source", Checksum: "checksum"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := from.PostClientIDRecord(ctx, "myproject", &storage.ClientIDRecord{ClientID: "client1", TimestampMillisec: 1611836746968}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second run should skip everything that is already migrated
+	for i := 0; i < 2; i++ {
+		if err := Migrate(ctx, "myproject", from, to, MigrateOptions{MaxNumberOfWorkers: 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ids, err := to.GetStagesIDs(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 1 || ids[0] != stageID {
+		t.Errorf("expected only not rejected stage to be migrated, got %v", ids)
+	}
+
+	if desc, err := to.GetStageDescription(ctx, "myproject", stageID.Digest, stageID.UniqueID); err != nil {
+		t.Fatal(err)
+	} else if configName, _ := img.ConfigName(); desc == nil || desc.Info.ID != configName.String() {
+		t.Errorf("unexpected migrated stage description %#v", desc)
+	}
+
+	if images, err := to.GetManagedImages(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(images) != 1 || images[0] != "backend" {
+		t.Errorf("unexpected managed images %v", images)
+	}
+
+	if exists, err := to.IsImageMetadataExist(ctx, "myproject", "backend", "commit1", stageID.String()); err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		t.Errorf("expected image metadata to be migrated")
+	}
+
+	if metadata, err := to.GetImportMetadata(ctx, "myproject", "import1"); err != nil {
+		t.Fatal(err)
+	} else if metadata == nil || metadata.SourceImageID != "sha256:source" {
+		t.Errorf("unexpected import metadata %#v", metadata)
+	}
+
+	if records, err := to.GetClientIDRecords(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].ClientID != "client1" {
+		t.Errorf("unexpected client id records %v", records)
+	}
+}
+
+// tagsListRegistry extends the in-memory registry with the tags list
+type tagsListRegistry struct {
+	handler http.Handler
+
+	mux  sync.Mutex
+	tags []string
+}
+
+func (r *tagsListRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if strings.HasSuffix(req.URL.Path, "/tags/list") {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"tags": r.tags})
+		return
+	}
+
+	if reference := path.Base(req.URL.Path); req.Method == http.MethodPut && strings.Contains(req.URL.Path, "/manifests/") && !strings.HasPrefix(reference, "sha256:") {
+		r.tags = append(r.tags, reference)
+	}
+
+	r.handler.ServeHTTP(w, req)
+}
+
+func newTestRepoStagesStorage(t *testing.T) *storage.RepoStagesStorage {
+	server := httptest.NewServer(&tagsListRegistry{handler: registry.New(), tags: []string{}})
+	t.Cleanup(server.Close)
+
+	stagesStorage, err := storage.NewRepoStagesStorage(strings.TrimPrefix(server.URL, "http://")+"/project", nil, storage.RepoStagesStorageOptions{
+		ContainerRegistry:     docker_registry.DefaultImplementationName,
+		DockerRegistryOptions: docker_registry.DockerRegistryOptions{InsecureRegistry: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stagesStorage
+}
+
+func TestMigrateMultiPlatformStage(t *testing.T) {
+	ctx := context.Background()
+	from := newTestRepoStagesStorage(t)
+
+	var addendums []mutate.IndexAddendum
+	for _, arch := range []string{"amd64", "arm64"} {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addendums = append(addendums, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: arch}},
+		})
+	}
+	idx := mutate.AppendManifests(empty.Index, addendums...)
+
+	stageID := image.StageID{Digest: strings.Repeat("c", 56), UniqueID: 1611836746970}
+	if err := from.PutStageIndex(ctx, "myproject", stageID, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedDigest, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to := newTestRepoStagesStorage(t)
+	if err := Migrate(ctx, "myproject", from, to, MigrateOptions{MaxNumberOfWorkers: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	migratedIdx, err := to.GetStageIndex(ctx, "myproject", stageID)
+	if err != nil {
+		t.Fatal(err)
+	} else if migratedIdx == nil {
+		t.Fatalf("expected stage to be migrated as the image index")
+	}
+
+	if digest, err := migratedIdx.Digest(); err != nil {
+		t.Fatal(err)
+	} else if digest != expectedDigest {
+		t.Errorf("expected migrated index digest %s, got %s", expectedDigest, digest)
+	}
+
+	if err := Migrate(ctx, "myproject", from, newTestOCILayoutStagesStorage(t), MigrateOptions{MaxNumberOfWorkers: 1}); err == nil || !strings.Contains(err.Error(), "does not support image indexes") {
+		t.Errorf("expected image indexes not supported error, got: %v", err)
+	}
+}
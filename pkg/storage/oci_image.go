@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/werf"
+)
+
+const (
+	ociLayoutFileContent  = `{"imageLayoutVersion": "1.0.0"}`
+	ociImageRefAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// saveLocalImage exports the local image of the container runtime into the tmpDir and returns it as an OCI image.
+// Returned image is valid until tmpDir is removed.
+func saveLocalImage(ctx context.Context, containerRuntime container_runtime.ContainerRuntime, ref, tmpDir string) (v1.Image, error) {
+	tag, err := name.NewTag(ref, name.WeakValidation)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse reference %q: %s", ref, err)
+	}
+
+	archivePath := filepath.Join(tmpDir, "image.tar")
+	if err := containerRuntime.SaveImageToArchive(ctx, ref, archivePath); err != nil {
+		return nil, err
+	}
+
+	return tarball.ImageFromPath(archivePath, &tag)
+}
+
+// loadLocalImage imports the OCI image into the local storage of the container runtime by the specified reference.
+func loadLocalImage(ctx context.Context, containerRuntime container_runtime.ContainerRuntime, ref string, img v1.Image) error {
+	tag, err := name.NewTag(ref, name.WeakValidation)
+	if err != nil {
+		return fmt.Errorf("unable to parse reference %q: %s", ref, err)
+	}
+
+	tmpDir, err := ioutil.TempDir(werf.GetTmpDir(), "werf-load-image-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, "image.tar")
+	if err := tarball.WriteToFile(archivePath, tag, img); err != nil {
+		return fmt.Errorf("unable to write image %s archive: %s", ref, err)
+	}
+
+	return containerRuntime.LoadImageFromArchive(ctx, archivePath)
+}
+
+func newInfoFromOCIImage(ref string, img v1.Image) (*image.Info, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var totalSize int64
+	for _, l := range manifest.Layers {
+		totalSize += l.Size
+	}
+
+	repository, tag := image.ParseRepositoryAndTag(ref)
+
+	info := &image.Info{
+		Name:       ref,
+		Repository: repository,
+		Tag:        tag,
+		ID:         manifest.Config.Digest.String(),
+		ParentID:   configFile.Config.Image,
+		Labels:     configFile.Config.Labels,
+		Size:       totalSize,
+	}
+	info.SetCreatedAtUnixNano(configFile.Created.UnixNano())
+
+	return info, nil
+}
+
+// listOCIImageBlobs returns digests of the manifest, the config and the layers of the image.
+func listOCIImageBlobs(img v1.Image) ([]v1.Hash, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := []v1.Hash{digest, manifest.Config.Digest}
+	for _, l := range manifest.Layers {
+		blobs = append(blobs, l.Digest)
+	}
+
+	return blobs, nil
+}
+
+// forEachOCIImageBlob calls f for the layers, the config and the manifest of the image, in that order,
+// so that the manifest is written only after all blobs it refers to.
+func forEachOCIImageBlob(img v1.Image, f func(hash v1.Hash, opener func() (io.ReadCloser, error)) error) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range layers {
+		hash, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+
+		if err := f(hash, layer.Compressed); err != nil {
+			return err
+		}
+	}
+
+	configName, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+
+	if err := f(configName, rawBlobOpener(img.RawConfigFile)); err != nil {
+		return err
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+
+	return f(digest, rawBlobOpener(img.RawManifest))
+}
+
+func rawBlobOpener(rawFunc func() ([]byte, error)) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		data, err := rawFunc()
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+type ociBlobOpener func(hash v1.Hash) (io.ReadCloser, error)
+
+// newOCIImageFromBlobs constructs an image by the manifest descriptor, blobs are read lazily with the opener.
+func newOCIImageFromBlobs(descriptor v1.Descriptor, opener ociBlobOpener) (v1.Image, error) {
+	return partial.CompressedToImage(&blobsImage{descriptor: descriptor, opener: opener})
+}
+
+// blobsImage implements partial.CompressedImageCore.
+type blobsImage struct {
+	descriptor v1.Descriptor
+	opener     ociBlobOpener
+
+	rawManifest []byte
+}
+
+func (i *blobsImage) MediaType() (types.MediaType, error) {
+	return i.descriptor.MediaType, nil
+}
+
+func (i *blobsImage) RawManifest() ([]byte, error) {
+	if i.rawManifest != nil {
+		return i.rawManifest, nil
+	}
+
+	data, err := i.readBlob(i.descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+	i.rawManifest = data
+
+	return data, nil
+}
+
+func (i *blobsImage) RawConfigFile() ([]byte, error) {
+	manifest, err := partial.Manifest(i)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.readBlob(manifest.Config.Digest)
+}
+
+func (i *blobsImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	manifest, err := partial.Manifest(i)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range manifest.Layers {
+		if desc.Digest == h {
+			return &blobsLayer{descriptor: desc, opener: i.opener}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("layer %s not found in the image manifest", h)
+}
+
+func (i *blobsImage) readBlob(hash v1.Hash) ([]byte, error) {
+	rc, err := i.opener(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// blobsLayer implements partial.CompressedLayer.
+type blobsLayer struct {
+	descriptor v1.Descriptor
+	opener     ociBlobOpener
+}
+
+func (l *blobsLayer) Digest() (v1.Hash, error) {
+	return l.descriptor.Digest, nil
+}
+
+func (l *blobsLayer) Compressed() (io.ReadCloser, error) {
+	return l.opener(l.descriptor.Digest)
+}
+
+func (l *blobsLayer) Size() (int64, error) {
+	return l.descriptor.Size, nil
+}
+
+func (l *blobsLayer) MediaType() (types.MediaType, error) {
+	return l.descriptor.MediaType, nil
+}
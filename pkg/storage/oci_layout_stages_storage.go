@@ -0,0 +1,786 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/file_locker"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/docker_registry/container_registry_extensions"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/werf"
+)
+
+const (
+	OCILayoutStorageAddressPrefix = "oci-layout://"
+
+	OCILayout_IndexFile     = "index.json"
+	OCILayout_LayoutFile    = "oci-layout"
+	OCILayout_BlobsDir      = "blobs"
+	OCILayout_ServiceDir    = ".werf"
+	OCILayout_IndexLockName = "index"
+
+	// Blobs that were written recently are never garbage collected:
+	// a concurrent StoreImage may have written the blobs but not yet registered the image in the index.
+	OCILayout_BlobGCGracePeriod = time.Hour
+)
+
+func IsOCILayoutStagesStorageAddress(address string) bool {
+	return strings.HasPrefix(address, OCILayoutStorageAddressPrefix)
+}
+
+// OCILayoutStagesStorage keeps stages in an OCI image layout directory on the local disk or on a network filesystem.
+// Every stage and every werf record (managed image, image metadata, import metadata, client ID) is an image in the layout index,
+// named by org.opencontainers.image.ref.name annotation the same way as the corresponding RepoStagesStorage tag.
+// Records are manifest-only images that keep their data in labels.
+type OCILayoutStagesStorage struct {
+	StorageAddress string
+	LayoutDir      string
+
+	ContainerRuntime container_runtime.ContainerRuntime
+
+	locker            lockgate.Locker
+	blobGCGracePeriod time.Duration
+}
+
+func NewOCILayoutStagesStorage(address string, containerRuntime container_runtime.ContainerRuntime) (*OCILayoutStagesStorage, error) {
+	layoutDir := strings.TrimPrefix(address, OCILayoutStorageAddressPrefix)
+	if layoutDir == "" {
+		return nil, fmt.Errorf("bad oci-layout address %q: expected %sPATH", address, OCILayoutStorageAddressPrefix)
+	}
+
+	locker, err := file_locker.NewFileLocker(filepath.Join(layoutDir, OCILayout_ServiceDir, "locks"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create locker for %s: %s", layoutDir, err)
+	}
+
+	return &OCILayoutStagesStorage{
+		StorageAddress:    address,
+		LayoutDir:         layoutDir,
+		ContainerRuntime:  containerRuntime,
+		locker:            locker,
+		blobGCGracePeriod: OCILayout_BlobGCGracePeriod,
+	}, nil
+}
+
+func (storage *OCILayoutStagesStorage) ConstructStageImageName(projectName, digest string, uniqueID int64) string {
+	return fmt.Sprintf(LocalStage_ImageFormat, projectName, digest, uniqueID)
+}
+
+func (storage *OCILayoutStagesStorage) GetStagesIDs(ctx context.Context, _ string) ([]image.StageID, error) {
+	tags, err := storage.tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []image.StageID
+	for _, tag := range tags {
+		if len(tag) != 70 || len(strings.Split(tag, "-")) != 2 {
+			continue
+		}
+
+		if digest, uniqueID, err := getDigestAndUniqueIDFromRepoStageImageTag(tag); err != nil {
+			if isUnexpectedTagFormatError(err) {
+				logboek.Context(ctx).Debug().LogLn(err.Error())
+				continue
+			}
+			return nil, err
+		} else {
+			res = append(res, image.StageID{Digest: digest, UniqueID: uniqueID})
+		}
+	}
+
+	return res, nil
+}
+
+func (storage *OCILayoutStagesStorage) GetStagesIDsByDigest(ctx context.Context, _, digest string) ([]image.StageID, error) {
+	tags, err := storage.tags()
+	if err != nil {
+		return nil, err
+	}
+
+	rejected := map[string]bool{}
+	for _, tag := range tags {
+		if strings.HasSuffix(tag, RepoRejectedStageImageRecord_ImageTagSuffix) {
+			rejected[strings.TrimSuffix(tag, RepoRejectedStageImageRecord_ImageTagSuffix)] = true
+		}
+	}
+
+	var res []image.StageID
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, digest+"-") || strings.HasSuffix(tag, RepoRejectedStageImageRecord_ImageTagSuffix) {
+			continue
+		}
+
+		if rejected[tag] {
+			logboek.Context(ctx).Info().LogF("Discarding rejected stage %q\n", tag)
+			continue
+		}
+
+		if _, uniqueID, err := getDigestAndUniqueIDFromRepoStageImageTag(tag); err != nil {
+			if isUnexpectedTagFormatError(err) {
+				logboek.Context(ctx).Debug().LogLn(err.Error())
+				continue
+			}
+			return nil, err
+		} else {
+			res = append(res, image.StageID{Digest: digest, UniqueID: uniqueID})
+		}
+	}
+
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.GetStagesIDsByDigest result for %q: %#v\n", digest, res)
+
+	return res, nil
+}
+
+func (storage *OCILayoutStagesStorage) GetStageDescription(ctx context.Context, projectName, digest string, uniqueID int64) (*image.StageDescription, error) {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.GetStageDescription %s %s %d\n", projectName, digest, uniqueID)
+
+	stageID := image.StageID{Digest: digest, UniqueID: uniqueID}
+
+	index, err := storage.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	if findOCILayoutDescriptor(index, stageID.String()+RepoRejectedStageImageRecord_ImageTagSuffix) != nil {
+		logboek.Context(ctx).Info().LogF("Stage digest %s uniqueID %d image is rejected: ignore stage image\n", digest, uniqueID)
+		return nil, nil
+	}
+
+	desc := findOCILayoutDescriptor(index, stageID.String())
+	if desc == nil {
+		return nil, nil
+	}
+
+	info, err := newInfoFromOCIImage(storage.ConstructStageImageName(projectName, digest, uniqueID), storage.image(*desc))
+	if os.IsNotExist(err) {
+		return nil, ErrBrokenImage
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to inspect stage %s in %s: %s", stageID.String(), storage.String(), err)
+	}
+
+	return &image.StageDescription{StageID: &stageID, Info: info}, nil
+}
+
+func (storage *OCILayoutStagesStorage) DeleteStage(ctx context.Context, stageDescription *image.StageDescription, _ DeleteImageOptions) error {
+	tag := stageDescription.StageID.String()
+	return storage.deleteTags(ctx, tag, tag+RepoRejectedStageImageRecord_ImageTagSuffix)
+}
+
+func (storage *OCILayoutStagesStorage) RejectStage(ctx context.Context, projectName, digest string, uniqueID int64) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.RejectStage %s %s %d\n", projectName, digest, uniqueID)
+
+	tag := image.StageID{Digest: digest, UniqueID: uniqueID}.String() + RepoRejectedStageImageRecord_ImageTagSuffix
+	if err := storage.putRecord(ctx, tag, map[string]string{image.WerfLabel: projectName}); err != nil {
+		return err
+	}
+
+	logboek.Context(ctx).Info().LogF("Rejected stage by digest %s uniqueID %d\n", digest, uniqueID)
+
+	return nil
+}
+
+func (storage *OCILayoutStagesStorage) FilterStagesAndProcessRelatedData(_ context.Context, stageDescriptions []*image.StageDescription, _ FilterStagesAndProcessRelatedDataOptions) ([]*image.StageDescription, error) {
+	return stageDescriptions, nil
+}
+
+func (storage *OCILayoutStagesStorage) FetchImage(ctx context.Context, img container_runtime.Image) error {
+	dockerImage := img.(*container_runtime.DockerImage)
+
+	_, tag := image.ParseRepositoryAndTag(dockerImage.Image.Name())
+
+	index, err := storage.readIndex()
+	if err != nil {
+		return err
+	}
+
+	desc := findOCILayoutDescriptor(index, tag)
+	if desc == nil {
+		return fmt.Errorf("stage %s not found in %s", tag, storage.String())
+	}
+
+	if err := logboek.Context(ctx).Info().LogProcess("Loading %s from %s", dockerImage.Image.Name(), storage.String()).DoError(func() error {
+		return loadLocalImage(ctx, storage.ContainerRuntime, dockerImage.Image.Name(), storage.image(*desc))
+	}); err != nil {
+		if os.IsNotExist(err) {
+			return ErrBrokenImage
+		}
+		return err
+	}
+
+	return storage.ContainerRuntime.RefreshImageObject(ctx, img)
+}
+
+func (storage *OCILayoutStagesStorage) StoreImage(ctx context.Context, img container_runtime.Image) error {
+	if _, ok := img.(*container_runtime.ManifestListImage); ok {
+		return errMultiPlatformImagesNotSupported(storage)
+	}
+
+	dockerImage := img.(*container_runtime.DockerImage)
+
+	if dockerImage.Image.GetBuiltId() != "" {
+		if err := dockerImage.Image.TagBuiltImage(ctx); err != nil {
+			return fmt.Errorf("unable to tag built image by name %s: %s", dockerImage.Image.Name(), err)
+		}
+	}
+
+	_, tag := image.ParseRepositoryAndTag(dockerImage.Image.Name())
+
+	tmpDir, err := ioutil.TempDir(werf.GetTmpDir(), "werf-oci-layout-stage-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	return logboek.Context(ctx).Info().LogProcess("Storing %s into %s", dockerImage.Image.Name(), storage.String()).DoError(func() error {
+		ociImage, err := saveLocalImage(ctx, storage.ContainerRuntime, dockerImage.Image.Name(), tmpDir)
+		if err != nil {
+			return err
+		}
+
+		return storage.putImage(ctx, tag, ociImage)
+	})
+}
+
+func (storage *OCILayoutStagesStorage) ShouldFetchImage(ctx context.Context, img container_runtime.Image) (bool, error) {
+	dockerImage := img.(*container_runtime.DockerImage)
+
+	if inspect, err := storage.ContainerRuntime.GetImageInspect(ctx, dockerImage.Image.Name()); err != nil {
+		return false, fmt.Errorf("unable to get inspect for image %s: %s", dockerImage.Image.Name(), err)
+	} else if inspect != nil {
+		dockerImage.Image.SetInspect(inspect)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (storage *OCILayoutStagesStorage) CreateRepo(_ context.Context) error {
+	if err := os.MkdirAll(filepath.Join(storage.LayoutDir, OCILayout_BlobsDir), os.ModePerm); err != nil {
+		return err
+	}
+
+	layoutFile := filepath.Join(storage.LayoutDir, OCILayout_LayoutFile)
+	if _, err := os.Stat(layoutFile); os.IsNotExist(err) {
+		return writeFileAtomically(layoutFile, []byte(ociLayoutFileContent))
+	} else {
+		return err
+	}
+}
+
+func (storage *OCILayoutStagesStorage) DeleteRepo(_ context.Context) error {
+	for _, name := range []string{OCILayout_IndexFile, OCILayout_LayoutFile, OCILayout_BlobsDir} {
+		if err := os.RemoveAll(filepath.Join(storage.LayoutDir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (storage *OCILayoutStagesStorage) AddManagedImage(ctx context.Context, projectName, imageName string) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.AddManagedImage %s %s\n", projectName, imageName)
+
+	if validateImageName(imageName) != nil {
+		return nil
+	}
+
+	tag := RepoManagedImageRecord_ImageTagPrefix + slugImageNameAsDockerImageTag(imageName)
+	if exists, err := storage.isTagExist(tag); err != nil || exists {
+		return err
+	}
+
+	return storage.putRecord(ctx, tag, map[string]string{image.WerfLabel: projectName})
+}
+
+func (storage *OCILayoutStagesStorage) RmManagedImage(ctx context.Context, projectName, imageName string) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.RmManagedImage %s %s\n", projectName, imageName)
+
+	return storage.deleteTags(ctx, RepoManagedImageRecord_ImageTagPrefix+slugImageNameAsDockerImageTag(imageName))
+}
+
+func (storage *OCILayoutStagesStorage) GetManagedImages(ctx context.Context, projectName string) ([]string, error) {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.GetManagedImages %s\n", projectName)
+
+	tags, err := storage.tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, RepoManagedImageRecord_ImageTagPrefix) {
+			continue
+		}
+
+		managedImageName := unslugDockerImageTagAsImageName(strings.TrimPrefix(tag, RepoManagedImageRecord_ImageTagPrefix))
+
+		if validateImageName(managedImageName) != nil {
+			continue
+		}
+
+		res = append(res, managedImageName)
+	}
+
+	return res, nil
+}
+
+func (storage *OCILayoutStagesStorage) PutImageMetadata(ctx context.Context, projectName, imageName, commit, stageID string) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.PutImageMetadata %s %s %s %s\n", projectName, imageName, commit, stageID)
+
+	tag := fmt.Sprintf(RepoImageMetadataByCommitRecord_TagFormat, imageNameID(imageName), commit, stageID)
+	if err := storage.putRecord(ctx, tag, map[string]string{image.WerfLabel: projectName}); err != nil {
+		return err
+	}
+
+	logboek.Context(ctx).Info().LogF("Put image %s commit %s stage ID %s\n", imageName, commit, stageID)
+
+	return nil
+}
+
+func (storage *OCILayoutStagesStorage) RmImageMetadata(ctx context.Context, projectName, imageNameOrID, commit, stageID string) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.RmImageMetadata %s %s %s %s\n", projectName, imageNameOrID, commit, stageID)
+
+	if err := storage.deleteTags(ctx,
+		fmt.Sprintf(RepoImageMetadataByCommitRecord_TagFormat, imageNameID(imageNameOrID), commit, stageID),
+		fmt.Sprintf(RepoImageMetadataByCommitRecord_TagFormat, imageNameOrID, commit, stageID),
+	); err != nil {
+		return err
+	}
+
+	logboek.Context(ctx).Info().LogF("Removed image %s commit %s stage ID %s\n", imageNameOrID, commit, stageID)
+
+	return nil
+}
+
+func (storage *OCILayoutStagesStorage) IsImageMetadataExist(ctx context.Context, projectName, imageName, commit, stageID string) (bool, error) {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.IsImageMetadataExist %s %s %s %s\n", projectName, imageName, commit, stageID)
+
+	return storage.isTagExist(fmt.Sprintf(RepoImageMetadataByCommitRecord_TagFormat, imageNameID(imageName), commit, stageID))
+}
+
+func (storage *OCILayoutStagesStorage) GetAllAndGroupImageMetadataByImageName(ctx context.Context, projectName string, imageNameList []string) (map[string]map[string][]string, map[string]map[string][]string, error) {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.GetAllAndGroupImageMetadataByImageName %s %v\n", projectName, imageNameList)
+
+	tags, err := storage.tags()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return groupImageMetadataTagsByImageName(ctx, imageNameList, tags, RepoImageMetadataByCommitRecord_ImageTagPrefix)
+}
+
+func (storage *OCILayoutStagesStorage) GetImportMetadata(ctx context.Context, _, id string) (*ImportMetadata, error) {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.GetImportMetadata %s\n", id)
+
+	labels, err := storage.getRecordLabels(RepoImportMetadata_ImageTagPrefix + id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get import metadata %s: %s", id, err)
+	} else if labels == nil {
+		return nil, nil
+	}
+
+	return newImportMetadataFromLabels(labels), nil
+}
+
+func (storage *OCILayoutStagesStorage) PutImportMetadata(ctx context.Context, projectName string, metadata *ImportMetadata) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.PutImportMetadata %v\n", metadata)
+
+	labels := metadata.ToLabels()
+	labels[image.WerfLabel] = projectName
+
+	return storage.putRecord(ctx, RepoImportMetadata_ImageTagPrefix+metadata.ImportSourceID, labels)
+}
+
+func (storage *OCILayoutStagesStorage) RmImportMetadata(ctx context.Context, _, id string) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.RmImportMetadata %s\n", id)
+
+	return storage.deleteTags(ctx, RepoImportMetadata_ImageTagPrefix+id)
+}
+
+func (storage *OCILayoutStagesStorage) GetImportMetadataIDs(ctx context.Context, _ string) ([]string, error) {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.GetImportMetadataIDs\n")
+
+	tags, err := storage.tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, RepoImportMetadata_ImageTagPrefix) {
+			continue
+		}
+
+		ids = append(ids, getImportMetadataIDFromRepoTag(tag))
+	}
+
+	return ids, nil
+}
+
+func (storage *OCILayoutStagesStorage) GetClientIDRecords(ctx context.Context, projectName string) ([]*ClientIDRecord, error) {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.GetClientIDRecords for project %s\n", projectName)
+
+	tags, err := storage.tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*ClientIDRecord
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, RepoClientIDRecrod_ImageTagPrefix) {
+			continue
+		}
+
+		if rec := parseClientIDRecordTag(tag); rec != nil {
+			res = append(res, rec)
+		}
+	}
+
+	return res, nil
+}
+
+func (storage *OCILayoutStagesStorage) PostClientIDRecord(ctx context.Context, projectName string, rec *ClientIDRecord) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.PostClientID %s for project %s\n", rec.ClientID, projectName)
+
+	tag := fmt.Sprintf("%s%s-%d", RepoClientIDRecrod_ImageTagPrefix, rec.ClientID, rec.TimestampMillisec)
+	if exists, err := storage.isTagExist(tag); err != nil || exists {
+		return err
+	}
+
+	if err := storage.putRecord(ctx, tag, map[string]string{image.WerfLabel: projectName}); err != nil {
+		return err
+	}
+
+	logboek.Context(ctx).Info().LogF("Posted new clientID %q for project %s\n", rec.ClientID, projectName)
+
+	return nil
+}
+
+func (storage *OCILayoutStagesStorage) String() string {
+	return storage.StorageAddress
+}
+
+func (storage *OCILayoutStagesStorage) Address() string {
+	return storage.StorageAddress
+}
+
+func (storage *OCILayoutStagesStorage) GetStageImage(_ context.Context, _ string, stageID image.StageID) (v1.Image, error) {
+	index, err := storage.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	desc := findOCILayoutDescriptor(index, stageID.String())
+	if desc == nil {
+		return nil, nil
+	}
+
+	return storage.image(*desc), nil
+}
+
+func (storage *OCILayoutStagesStorage) PutStageImage(ctx context.Context, _ string, stageID image.StageID, img v1.Image) error {
+	return storage.putImage(ctx, stageID.String(), img)
+}
+
+func (storage *OCILayoutStagesStorage) putRecord(ctx context.Context, tag string, labels map[string]string) error {
+	logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.putRecord %s\n", tag)
+
+	if err := storage.putImage(ctx, tag, container_registry_extensions.NewManifestOnlyImage(labels)); err != nil {
+		return fmt.Errorf("unable to put record %s: %s", tag, err)
+	}
+
+	return nil
+}
+
+// getRecordLabels returns nil if the record does not exist.
+func (storage *OCILayoutStagesStorage) getRecordLabels(tag string) (map[string]string, error) {
+	index, err := storage.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	desc := findOCILayoutDescriptor(index, tag)
+	if desc == nil {
+		return nil, nil
+	}
+
+	configFile, err := storage.image(*desc).ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	labels := configFile.Config.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	return labels, nil
+}
+
+func (storage *OCILayoutStagesStorage) putImage(ctx context.Context, tag string, img v1.Image) error {
+	if err := storage.CreateRepo(ctx); err != nil {
+		return err
+	}
+
+	if err := forEachOCIImageBlob(img, storage.writeBlob); err != nil {
+		return err
+	}
+
+	desc, err := partial.Descriptor(img)
+	if err != nil {
+		return err
+	}
+	desc.Annotations = map[string]string{ociImageRefAnnotation: tag}
+
+	return storage.updateIndex(ctx, func(index *v1.IndexManifest) error {
+		index.Manifests = append(excludeOCILayoutDescriptors(index.Manifests, tag), *desc)
+		return nil
+	})
+}
+
+// deleteTags removes images from the index and deletes the blobs that are no longer referenced.
+func (storage *OCILayoutStagesStorage) deleteTags(ctx context.Context, tags ...string) error {
+	return storage.updateIndex(ctx, func(index *v1.IndexManifest) error {
+		var deleted []v1.Descriptor
+		for _, tag := range tags {
+			if desc := findOCILayoutDescriptor(index, tag); desc != nil {
+				deleted = append(deleted, *desc)
+			}
+			index.Manifests = excludeOCILayoutDescriptors(index.Manifests, tag)
+		}
+
+		if len(deleted) == 0 {
+			return nil
+		}
+
+		return storage.deleteUnreferencedBlobs(ctx, index, deleted)
+	})
+}
+
+func (storage *OCILayoutStagesStorage) deleteUnreferencedBlobs(ctx context.Context, index *v1.IndexManifest, deleted []v1.Descriptor) error {
+	candidates := map[v1.Hash]bool{}
+	for _, desc := range deleted {
+		blobs, err := listOCIImageBlobs(storage.image(desc))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, blob := range blobs {
+			candidates[blob] = true
+		}
+	}
+
+	for _, desc := range index.Manifests {
+		blobs, err := listOCIImageBlobs(storage.image(desc))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, blob := range blobs {
+			delete(candidates, blob)
+		}
+	}
+
+	for blob := range candidates {
+		blobPath := storage.blobPath(blob)
+
+		stat, err := os.Stat(blobPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if time.Since(stat.ModTime()) < storage.blobGCGracePeriod {
+			continue
+		}
+
+		logboek.Context(ctx).Debug().LogF("-- OCILayoutStagesStorage.deleteUnreferencedBlobs %s\n", blob)
+		if err := os.Remove(blobPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (storage *OCILayoutStagesStorage) image(desc v1.Descriptor) v1.Image {
+	img, err := newOCIImageFromBlobs(desc, storage.openBlob)
+	if err != nil {
+		// partial.CompressedToImage never fails for a non-nil core
+		panic(fmt.Sprintf("unexpected error: %s", err))
+	}
+
+	return img
+}
+
+func (storage *OCILayoutStagesStorage) blobPath(hash v1.Hash) string {
+	return filepath.Join(storage.LayoutDir, OCILayout_BlobsDir, hash.Algorithm, hash.Hex)
+}
+
+func (storage *OCILayoutStagesStorage) openBlob(hash v1.Hash) (io.ReadCloser, error) {
+	return os.Open(storage.blobPath(hash))
+}
+
+func (storage *OCILayoutStagesStorage) writeBlob(hash v1.Hash, opener func() (io.ReadCloser, error)) error {
+	blobPath := storage.blobPath(hash)
+
+	if _, err := os.Stat(blobPath); err == nil {
+		// protect existing blob from the concurrent garbage collection
+		now := time.Now()
+		return os.Chtimes(blobPath, now, now)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(blobPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	rc, err := opener()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(blobPath), ".tmp-"+hash.Hex)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := io.Copy(tmpFile, rc); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("unable to write blob %s: %s", hash, err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), blobPath)
+}
+
+func (storage *OCILayoutStagesStorage) tags() ([]string, error) {
+	index, err := storage.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, desc := range index.Manifests {
+		if tag, ok := desc.Annotations[ociImageRefAnnotation]; ok {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+func (storage *OCILayoutStagesStorage) isTagExist(tag string) (bool, error) {
+	index, err := storage.readIndex()
+	if err != nil {
+		return false, err
+	}
+
+	return findOCILayoutDescriptor(index, tag) != nil, nil
+}
+
+func (storage *OCILayoutStagesStorage) readIndex() (*v1.IndexManifest, error) {
+	indexFile := filepath.Join(storage.LayoutDir, OCILayout_IndexFile)
+
+	f, err := os.Open(indexFile)
+	if os.IsNotExist(err) {
+		return &v1.IndexManifest{SchemaVersion: 2, MediaType: types.OCIImageIndex}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	index, err := v1.ParseIndexManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", indexFile, err)
+	}
+
+	return index, nil
+}
+
+func (storage *OCILayoutStagesStorage) updateIndex(ctx context.Context, f func(index *v1.IndexManifest) error) error {
+	return lockgate.WithAcquire(storage.locker, OCILayout_IndexLockName, werf.SetupLockerDefaultOptions(ctx, lockgate.AcquireOptions{}), func(_ bool) error {
+		index, err := storage.readIndex()
+		if err != nil {
+			return err
+		}
+
+		if err := f(index); err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(index, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		return writeFileAtomically(filepath.Join(storage.LayoutDir, OCILayout_IndexFile), data)
+	})
+}
+
+func findOCILayoutDescriptor(index *v1.IndexManifest, tag string) *v1.Descriptor {
+	for i := range index.Manifests {
+		if index.Manifests[i].Annotations[ociImageRefAnnotation] == tag {
+			return &index.Manifests[i]
+		}
+	}
+
+	return nil
+}
+
+func excludeOCILayoutDescriptors(descs []v1.Descriptor, tag string) []v1.Descriptor {
+	var res []v1.Descriptor
+	for _, desc := range descs {
+		if desc.Annotations[ociImageRefAnnotation] != tag {
+			res = append(res, desc)
+		}
+	}
+
+	return res
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+func newTestOCILayoutStagesStorage(t *testing.T) *OCILayoutStagesStorage {
+	dir, err := ioutil.TempDir("", "werf-oci-layout-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	storage, err := NewOCILayoutStagesStorage(OCILayoutStorageAddressPrefix+dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.blobGCGracePeriod = 0
+
+	return storage
+}
+
+func listTestOCILayoutBlobs(t *testing.T, storage *OCILayoutStagesStorage) []string {
+	var blobs []string
+	if err := filepath.Walk(filepath.Join(storage.LayoutDir, OCILayout_BlobsDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			blobs = append(blobs, path)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return blobs
+}
+
+func TestOCILayoutStagesStorage_Records(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestOCILayoutStagesStorage(t)
+
+	if err := storage.AddManagedImage(ctx, "myproject", "backend"); err != nil {
+		t.Fatal(err)
+	}
+	if images, err := storage.GetManagedImages(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(images) != 1 || images[0] != "backend" {
+		t.Errorf("unexpected managed images %v", images)
+	}
+
+	if err := storage.PutImageMetadata(ctx, "myproject", "backend", "commit1", "stage1"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := storage.IsImageMetadataExist(ctx, "myproject", "backend", "commit1", "stage1"); err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		t.Errorf("expected image metadata to exist")
+	}
+
+	metadata := &ImportMetadata{ImportSourceID: "import1", SourceImageID: "sha256:source", Checksum: "checksum"}
+	if err := storage.PutImportMetadata(ctx, "myproject", metadata); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := storage.GetImportMetadata(ctx, "myproject", "import1"); err != nil {
+		t.Fatal(err)
+	} else if got == nil || *got != *metadata {
+		t.Errorf("unexpected import metadata %#v", got)
+	}
+
+	if err := storage.PostClientIDRecord(ctx, "myproject", &ClientIDRecord{ClientID: "client1", TimestampMillisec: 1611836746968}); err != nil {
+		t.Fatal(err)
+	}
+	if records, err := storage.GetClientIDRecords(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].ClientID != "client1" || records[0].TimestampMillisec != 1611836746968 {
+		t.Errorf("unexpected client id records %v", records)
+	}
+
+	if err := storage.RmManagedImage(ctx, "myproject", "backend"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.RmImageMetadata(ctx, "myproject", "backend", "commit1", "stage1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.RmImportMetadata(ctx, "myproject", "import1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids, err := storage.GetImportMetadataIDs(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 0 {
+		t.Errorf("expected no import metadata, got %v", ids)
+	}
+	if exists, err := storage.IsImageMetadataExist(ctx, "myproject", "backend", "commit1", "stage1"); err != nil {
+		t.Fatal(err)
+	} else if exists {
+		t.Errorf("expected image metadata to be removed")
+	}
+}
+
+func TestOCILayoutStagesStorage_Stages(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestOCILayoutStagesStorage(t)
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := strings.Repeat("a", 56)
+	firstStageID := image.StageID{Digest: digest, UniqueID: 1611836746968}
+	secondStageID := image.StageID{Digest: digest, UniqueID: 1611836746969}
+
+	for _, stageID := range []image.StageID{firstStageID, secondStageID} {
+		if err := storage.putImage(ctx, stageID.String(), img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(storage.LayoutDir, OCILayout_LayoutFile)); err != nil {
+		t.Errorf("expected oci-layout file to be created: %s", err)
+	}
+
+	if ids, err := storage.GetStagesIDs(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 2 {
+		t.Errorf("expected 2 stages, got %v", ids)
+	}
+
+	stageDesc, err := storage.GetStageDescription(ctx, "myproject", digest, firstStageID.UniqueID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configName, _ := img.ConfigName()
+	if stageDesc == nil || stageDesc.Info.ID != configName.String() {
+		t.Fatalf("unexpected stage description: %#v", stageDesc)
+	}
+
+	if err := storage.RejectStage(ctx, "myproject", digest, secondStageID.UniqueID); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := storage.GetStagesIDsByDigest(ctx, "myproject", digest); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 1 || ids[0].UniqueID != firstStageID.UniqueID {
+		t.Errorf("expected only not rejected stage, got %v", ids)
+	}
+
+	stageBlobs := len(listTestOCILayoutBlobs(t, storage))
+
+	if err := storage.DeleteStage(ctx, stageDesc, DeleteImageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if blobs := listTestOCILayoutBlobs(t, storage); len(blobs) != stageBlobs {
+		t.Errorf("expected blobs to be kept while referenced by another stage, got %v", blobs)
+	}
+
+	secondStage := *stageDesc
+	secondStage.StageID = &secondStageID
+	if err := storage.DeleteStage(ctx, &secondStage, DeleteImageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if blobs := listTestOCILayoutBlobs(t, storage); len(blobs) != 0 {
+		t.Errorf("expected unreferenced blobs to be deleted, got %v", blobs)
+	}
+	if ids, err := storage.GetStagesIDs(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 0 {
+		t.Errorf("expected no stages, got %v", ids)
+	}
+}
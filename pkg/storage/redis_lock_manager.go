@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/google/uuid"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker"
+
+	"github.com/werf/werf/pkg/werf/locker_with_retry"
+)
+
+func NewRedisLockManager(ctx context.Context, client *redis.Client) *GenericLockManager {
+	locker := distributed_locker.NewDistributedLocker(NewRedisLockerBackend(client))
+	lockerWithRetry := locker_with_retry.NewLockerWithRetry(ctx, locker, locker_with_retry.LockerWithRetryOptions{MaxAcquireAttempts: 10, MaxReleaseAttempts: 10})
+	return NewGenericLockManager(lockerWithRetry)
+}
+
+var (
+	redisRenewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	redisReleaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// RedisLockerBackend implements distributed_locker.DistributedLockerBackend:
+// every lock is a single redis key with the lease UUID as a value and the lease TTL as an expiration,
+// so that the lock of the crashed process is released automatically.
+type RedisLockerBackend struct {
+	Client   *redis.Client
+	LeaseTTL time.Duration
+}
+
+func NewRedisLockerBackend(client *redis.Client) *RedisLockerBackend {
+	return &RedisLockerBackend{
+		Client:   client,
+		LeaseTTL: distributed_locker.DistributedLockLeaseTTLSeconds * time.Second,
+	}
+}
+
+func (backend *RedisLockerBackend) Acquire(lockName string, opts distributed_locker.AcquireOptions) (lockgate.LockHandle, error) {
+	if opts.Shared {
+		return lockgate.LockHandle{}, fmt.Errorf("shared locks are not supported by the redis locker")
+	}
+
+	handle := lockgate.LockHandle{UUID: uuid.New().String(), LockName: lockName}
+
+	if acquired, err := backend.Client.SetNX(redisLockKey(lockName), handle.UUID, backend.LeaseTTL).Result(); err != nil {
+		return lockgate.LockHandle{}, fmt.Errorf("unable to acquire lock %q: %s", lockName, err)
+	} else if !acquired {
+		return lockgate.LockHandle{}, distributed_locker.ErrShouldWait
+	}
+
+	return handle, nil
+}
+
+func (backend *RedisLockerBackend) RenewLease(handle lockgate.LockHandle) error {
+	return backend.runLeaseScript(redisRenewLeaseScript, handle, backend.LeaseTTL.Milliseconds())
+}
+
+func (backend *RedisLockerBackend) Release(handle lockgate.LockHandle) error {
+	return backend.runLeaseScript(redisReleaseLeaseScript, handle)
+}
+
+func (backend *RedisLockerBackend) runLeaseScript(script *redis.Script, handle lockgate.LockHandle, args ...interface{}) error {
+	res, err := script.Run(backend.Client, []string{redisLockKey(handle.LockName)}, append([]interface{}{handle.UUID}, args...)...).Int()
+	if err != nil {
+		return fmt.Errorf("unable to update lock %q lease: %s", handle.LockName, err)
+	} else if res == 0 {
+		return distributed_locker.ErrNoExistingLockLeaseFound
+	}
+
+	return nil
+}
+
+func redisLockKey(lockName string) string {
+	return fmt.Sprintf("werf:lock:%s", lockName)
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v7"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+// RedisStagesStorageCache stores stages of each project in a single redis hash with the digest as a field,
+// so that every digest record is changed atomically without additional locking.
+type RedisStagesStorageCache struct {
+	Client *redis.Client
+}
+
+func NewRedisStagesStorageCache(client *redis.Client) *RedisStagesStorageCache {
+	return &RedisStagesStorageCache{Client: client}
+}
+
+func (cache *RedisStagesStorageCache) String() string {
+	return fmt.Sprintf("redis %s/%d", cache.Client.Options().Addr, cache.Client.Options().DB)
+}
+
+func (cache *RedisStagesStorageCache) GetAllStages(ctx context.Context, projectName string) (bool, []image.StageID, error) {
+	key := redisStagesStorageCacheKey(projectName)
+
+	records, err := cache.Client.WithContext(ctx).HGetAll(key).Result()
+	if err != nil {
+		return false, nil, fmt.Errorf("unable to get %s: %s", key, err)
+	} else if len(records) == 0 {
+		return false, nil, nil
+	}
+
+	var res []image.StageID
+	for digest, data := range records {
+		if stages, ok := cache.unmarshalRecord(ctx, key, digest, data); ok {
+			res = append(res, stages...)
+		}
+	}
+
+	return true, res, nil
+}
+
+func (cache *RedisStagesStorageCache) DeleteAllStages(ctx context.Context, projectName string) error {
+	key := redisStagesStorageCacheKey(projectName)
+
+	if err := cache.Client.WithContext(ctx).Del(key).Err(); err != nil {
+		return fmt.Errorf("unable to delete %s: %s", key, err)
+	}
+
+	return nil
+}
+
+func (cache *RedisStagesStorageCache) GetStagesByDigest(ctx context.Context, projectName, digest string) (bool, []image.StageID, error) {
+	key := redisStagesStorageCacheKey(projectName)
+
+	data, err := cache.Client.WithContext(ctx).HGet(key, digest).Result()
+	if err == redis.Nil {
+		return false, nil, nil
+	} else if err != nil {
+		return false, nil, fmt.Errorf("unable to get %s field %s: %s", key, digest, err)
+	}
+
+	stages, ok := cache.unmarshalRecord(ctx, key, digest, data)
+	return ok, stages, nil
+}
+
+func (cache *RedisStagesStorageCache) StoreStagesByDigest(ctx context.Context, projectName, digest string, stages []image.StageID) error {
+	key := redisStagesStorageCacheKey(projectName)
+
+	data, err := json.Marshal(StagesStorageCacheRecord{Stages: stages})
+	if err != nil {
+		return err
+	}
+
+	if err := cache.Client.WithContext(ctx).HSet(key, digest, data).Err(); err != nil {
+		return fmt.Errorf("unable to set %s field %s: %s", key, digest, err)
+	}
+
+	return nil
+}
+
+func (cache *RedisStagesStorageCache) DeleteStagesByDigest(ctx context.Context, projectName, digest string) error {
+	key := redisStagesStorageCacheKey(projectName)
+
+	if err := cache.Client.WithContext(ctx).HDel(key, digest).Err(); err != nil {
+		return fmt.Errorf("unable to delete %s field %s: %s", key, digest, err)
+	}
+
+	return nil
+}
+
+func (cache *RedisStagesStorageCache) unmarshalRecord(ctx context.Context, key, digest, data string) ([]image.StageID, bool) {
+	res := &StagesStorageCacheRecord{}
+	if err := json.Unmarshal([]byte(data), res); err != nil {
+		logboek.Context(ctx).Error().LogF("Error unmarshalling json from %s field %s: %s: will ignore cache\n", key, digest, err)
+		return nil, false
+	}
+
+	return res.Stages, true
+}
+
+func redisStagesStorageCacheKey(projectName string) string {
+	return fmt.Sprintf("werf:%s:stages-storage-cache", projectName)
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	"github.com/werf/lockgate/pkg/distributed_locker"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+func newTestRedisClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client, server
+}
+
+func TestRedisStagesStorageCache(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestRedisClient(t)
+	cache := NewRedisStagesStorageCache(client)
+
+	if found, _, err := cache.GetAllStages(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if found {
+		t.Errorf("expected empty cache")
+	}
+
+	stagesA := []image.StageID{{Digest: "a", UniqueID: 1}, {Digest: "a", UniqueID: 2}}
+	stagesB := []image.StageID{{Digest: "b", UniqueID: 3}}
+
+	for digest, stages := range map[string][]image.StageID{"a": stagesA, "b": stagesB} {
+		if err := cache.StoreStagesByDigest(ctx, "myproject", digest, stages); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if found, stages, err := cache.GetStagesByDigest(ctx, "myproject", "a"); err != nil {
+		t.Fatal(err)
+	} else if !found || len(stages) != 2 || stages[1] != stagesA[1] {
+		t.Errorf("unexpected stages %v", stages)
+	}
+
+	if found, stages, err := cache.GetAllStages(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if !found || len(stages) != 3 {
+		t.Errorf("unexpected stages %v", stages)
+	}
+
+	if found, _, err := cache.GetAllStages(ctx, "otherproject"); err != nil {
+		t.Fatal(err)
+	} else if found {
+		t.Errorf("expected cache of another project to be empty")
+	}
+
+	if err := cache.DeleteStagesByDigest(ctx, "myproject", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if found, _, err := cache.GetStagesByDigest(ctx, "myproject", "a"); err != nil {
+		t.Fatal(err)
+	} else if found {
+		t.Errorf("expected stages by digest to be deleted")
+	}
+
+	if err := cache.DeleteAllStages(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	}
+	if found, _, err := cache.GetAllStages(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if found {
+		t.Errorf("expected all stages to be deleted")
+	}
+}
+
+func TestRedisLockerBackend(t *testing.T) {
+	client, server := newTestRedisClient(t)
+	backend := NewRedisLockerBackend(client)
+
+	handle, err := backend.Acquire("myproject.digest", distributed_locker.AcquireOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Acquire("myproject.digest", distributed_locker.AcquireOptions{}); !distributed_locker.IsErrShouldWait(err) {
+		t.Errorf("expected should wait error, got %v", err)
+	}
+
+	if _, err := backend.Acquire("myproject.digest", distributed_locker.AcquireOptions{Shared: true}); err == nil {
+		t.Errorf("expected shared locks to be rejected")
+	}
+
+	if err := backend.RenewLease(handle); err != nil {
+		t.Fatal(err)
+	}
+
+	// the lease of the crashed process expires
+	server.FastForward(backend.LeaseTTL + time.Second)
+
+	if err := backend.RenewLease(handle); !distributed_locker.IsErrNoExistingLockLeaseFound(err) {
+		t.Errorf("expected lost lease error, got %v", err)
+	}
+
+	newHandle, err := backend.Acquire("myproject.digest", distributed_locker.AcquireOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.Release(handle); !distributed_locker.IsErrNoExistingLockLeaseFound(err) {
+		t.Errorf("expected the expired lease not to release the new one, got %v", err)
+	}
+
+	if err := backend.Release(newHandle); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Acquire("myproject.digest", distributed_locker.AcquireOptions{}); err != nil {
+		t.Errorf("expected released lock to be acquired, got %v", err)
+	}
+}
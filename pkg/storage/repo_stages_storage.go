@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"strings"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
 	"github.com/werf/logboek"
 
 	"github.com/werf/werf/pkg/container_runtime"
@@ -57,6 +59,8 @@ type RepoStagesStorage struct {
 	RepoAddress      string
 	DockerRegistry   docker_registry.DockerRegistry
 	ContainerRuntime container_runtime.ContainerRuntime
+
+	metadataIndexCache repoMetadataIndexCache
 }
 
 type RepoStagesStorageOptions struct {
@@ -115,7 +119,11 @@ func (storage *RepoStagesStorage) GetStagesIDs(ctx context.Context, _ string) ([
 	}
 }
 
-func (storage *RepoStagesStorage) DeleteStage(ctx context.Context, stageDescription *image.StageDescription, _ DeleteImageOptions) error {
+func (storage *RepoStagesStorage) DeleteStage(ctx context.Context, stageDescription *image.StageDescription, options DeleteImageOptions) error {
+	if !options.SkipArtifactsDeletion {
+		storage.deleteStageArtifacts(ctx, stageDescription)
+	}
+
 	if err := storage.DockerRegistry.DeleteRepoImage(ctx, stageDescription.Info); err != nil {
 		return fmt.Errorf("unable to remove repo image %s: %s", stageDescription.Info.Name, err)
 	}
@@ -134,6 +142,29 @@ func (storage *RepoStagesStorage) DeleteStage(ctx context.Context, stageDescript
 	return nil
 }
 
+// deleteStageArtifacts deletes OCI artifacts (signatures, SBOMs, etc.) attached to the stage manifest.
+// The artifacts deletion does not prevent the stage deletion, so that all errors are only reported as warnings
+func (storage *RepoStagesStorage) deleteStageArtifacts(ctx context.Context, stageDescription *image.StageDescription) {
+	subjectReference := stageDescription.Info.Name
+	if stageDescription.Info.RepoDigest != "" {
+		subjectReference = strings.Join([]string{stageDescription.Info.Repository, stageDescription.Info.RepoDigest}, "@")
+	}
+
+	referrers, err := storage.DockerRegistry.GetReferrers(ctx, subjectReference)
+	if err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: Unable to get artifacts attached to the stage %s: %s\n", stageDescription.Info.Name, err)
+		return
+	}
+
+	for _, referrer := range referrers {
+		logboek.Context(ctx).Debug().LogF("-- RepoStagesStorage.DeleteStage deleting artifact %s (%s) attached to %s\n", referrer.Digest, referrer.ArtifactType, subjectReference)
+
+		if err := docker_registry.DeleteArtifact(ctx, storage.DockerRegistry, subjectReference, referrer); err != nil {
+			logboek.Context(ctx).Warn().LogF("WARNING: Unable to remove artifact %s attached to the stage %s: %s\n", referrer.Digest, stageDescription.Info.Name, err)
+		}
+	}
+}
+
 func makeRepoRejectedStageImageRecord(repoAddress, digest string, uniqueID int64) string {
 	return fmt.Sprintf(RepoRejectedStageImageRecord_ImageNameFormat, repoAddress, digest, uniqueID)
 }
@@ -352,56 +383,94 @@ func (storage *RepoStagesStorage) GetManagedImages(ctx context.Context, projectN
 }
 
 func (storage *RepoStagesStorage) FetchImage(ctx context.Context, img container_runtime.Image) error {
-	switch containerRuntime := storage.ContainerRuntime.(type) {
-	case *container_runtime.LocalDockerServerRuntime:
-		if err := containerRuntime.PullImageFromRegistry(ctx, img); err != nil {
-			if strings.HasSuffix(err.Error(), "unknown blob") {
-				return ErrBrokenImage
-			}
-			return err
+	if err := storage.ContainerRuntime.PullImageFromRegistry(ctx, img); err != nil {
+		if strings.HasSuffix(err.Error(), "unknown blob") {
+			return ErrBrokenImage
 		}
-
-		return nil
-	default:
-		// TODO: case *container_runtime.LocalHostRuntime:
-		panic("not implemented")
+		return err
 	}
+
+	return nil
 }
 
 func (storage *RepoStagesStorage) StoreImage(ctx context.Context, img container_runtime.Image) error {
-	switch containerRuntime := storage.ContainerRuntime.(type) {
-	case *container_runtime.LocalDockerServerRuntime:
-		dockerImage := img.(*container_runtime.DockerImage)
-
-		if dockerImage.Image.GetBuiltId() != "" {
-			return containerRuntime.PushBuiltImage(ctx, img)
-		} else {
-			return containerRuntime.PushImage(ctx, img)
+	if manifestList, ok := img.(*container_runtime.ManifestListImage); ok {
+		var entries []docker_registry.ManifestListEntry
+		for _, manifest := range manifestList.Manifests {
+			entries = append(entries, docker_registry.ManifestListEntry{Platform: manifest.Platform, Reference: manifest.ImageName})
 		}
 
-	default:
-		// TODO: case *container_runtime.LocalHostRuntime:
-		panic("not implemented")
+		return logboek.Context(ctx).Info().LogProcess("Storing manifest list %s", manifestList.Name).DoError(func() error {
+			return storage.DockerRegistry.PushManifestList(ctx, manifestList.Name, entries)
+		})
+	}
+
+	dockerImage := img.(*container_runtime.DockerImage)
+
+	if dockerImage.Image.GetBuiltId() != "" {
+		return storage.ContainerRuntime.PushBuiltImage(ctx, img)
+	} else {
+		return storage.ContainerRuntime.PushImage(ctx, img)
 	}
 }
 
-func (storage *RepoStagesStorage) ShouldFetchImage(ctx context.Context, img container_runtime.Image) (bool, error) {
-	switch containerRuntime := storage.ContainerRuntime.(type) {
-	case *container_runtime.LocalDockerServerRuntime:
+func (storage *RepoStagesStorage) GetStageImage(ctx context.Context, projectName string, stageID image.StageID) (v1.Image, error) {
+	stageImageName := storage.ConstructStageImageName(projectName, stageID.Digest, stageID.UniqueID)
+
+	img, err := storage.DockerRegistry.GetRepoImageObject(ctx, stageImageName)
+	if docker_registry.IsManifestUnknownError(err) || docker_registry.IsNameUnknownError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get repo image %s: %s", stageImageName, err)
+	}
 
-		dockerImage := img.(*container_runtime.DockerImage)
+	return img, nil
+}
 
-		if inspect, err := containerRuntime.GetImageInspect(ctx, dockerImage.Image.Name()); err != nil {
-			return false, fmt.Errorf("unable to get inspect for image %s: %s", dockerImage.Image.Name(), err)
-		} else if inspect != nil {
-			dockerImage.Image.SetInspect(inspect)
-			return false, nil
-		}
+func (storage *RepoStagesStorage) PutStageImage(ctx context.Context, projectName string, stageID image.StageID, img v1.Image) error {
+	stageImageName := storage.ConstructStageImageName(projectName, stageID.Digest, stageID.UniqueID)
 
-		return true, nil
-	default:
-		panic("not implemented")
+	if err := storage.DockerRegistry.WriteRepoImageObject(ctx, stageImageName, img); err != nil {
+		return fmt.Errorf("unable to write repo image %s: %s", stageImageName, err)
 	}
+
+	return nil
+}
+
+func (storage *RepoStagesStorage) GetStageIndex(ctx context.Context, projectName string, stageID image.StageID) (v1.ImageIndex, error) {
+	stageImageName := storage.ConstructStageImageName(projectName, stageID.Digest, stageID.UniqueID)
+
+	idx, err := storage.DockerRegistry.GetRepoImageIndexObject(ctx, stageImageName)
+	if docker_registry.IsManifestUnknownError(err) || docker_registry.IsNameUnknownError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get repo image index %s: %s", stageImageName, err)
+	}
+
+	return idx, nil
+}
+
+func (storage *RepoStagesStorage) PutStageIndex(ctx context.Context, projectName string, stageID image.StageID, idx v1.ImageIndex) error {
+	stageImageName := storage.ConstructStageImageName(projectName, stageID.Digest, stageID.UniqueID)
+
+	if err := storage.DockerRegistry.WriteRepoImageIndexObject(ctx, stageImageName, idx); err != nil {
+		return fmt.Errorf("unable to write repo image index %s: %s", stageImageName, err)
+	}
+
+	return nil
+}
+
+func (storage *RepoStagesStorage) ShouldFetchImage(ctx context.Context, img container_runtime.Image) (bool, error) {
+	dockerImage := img.(*container_runtime.DockerImage)
+
+	if inspect, err := storage.ContainerRuntime.GetImageInspect(ctx, dockerImage.Image.Name()); err != nil {
+		return false, fmt.Errorf("unable to get inspect for image %s: %s", dockerImage.Image.Name(), err)
+	} else if inspect != nil {
+		dockerImage.Image.SetInspect(inspect)
+		return false, nil
+	}
+
+	return true, nil
 }
 
 func (storage *RepoStagesStorage) PutImageMetadata(ctx context.Context, projectName, imageName, commit, stageID string) error {
@@ -481,6 +550,17 @@ func (storage *RepoStagesStorage) GetAllAndGroupImageMetadataByImageName(ctx con
 func (storage *RepoStagesStorage) GetImportMetadata(ctx context.Context, _, id string) (*ImportMetadata, error) {
 	logboek.Context(ctx).Debug().LogF("-- RepoStagesStorage.GetImportMetadata %s\n", id)
 
+	// the index has been read by the previous GetImportMetadataIDs call, the records missing in the index are inspected by the tags
+	if index := storage.metadataIndexCache.get(); index != nil {
+		if metadata, ok := index.ImportMetadata[id]; ok {
+			return metadata, nil
+		}
+	}
+
+	return storage.getImportMetadataByTag(ctx, id)
+}
+
+func (storage *RepoStagesStorage) getImportMetadataByTag(ctx context.Context, id string) (*ImportMetadata, error) {
 	fullImageName := makeRepoImportMetadataName(storage.RepoAddress, id)
 	logboek.Context(ctx).Debug().LogF("-- RepoStagesStorage.GetImportMetadata full image name: %s\n", fullImageName)
 
@@ -535,6 +615,9 @@ func (storage *RepoStagesStorage) RmImportMetadata(ctx context.Context, _, id st
 func (storage *RepoStagesStorage) GetImportMetadataIDs(ctx context.Context, _ string) ([]string, error) {
 	logboek.Context(ctx).Debug().LogF("-- RepoStagesStorage.GetImportMetadataIDs\n")
 
+	// the index is used by the following GetImportMetadata calls
+	storage.loadMetadataIndexHint(ctx)
+
 	tags, err := storage.DockerRegistry.Tags(ctx, storage.RepoAddress)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get repo %s tags: %s", storage.RepoAddress, err)
@@ -685,20 +768,10 @@ func (storage *RepoStagesStorage) GetClientIDRecords(ctx context.Context, projec
 				continue
 			}
 
-			tagWithoutPrefix := strings.TrimPrefix(tag, RepoClientIDRecrod_ImageTagPrefix)
-			dataParts := strings.SplitN(util.Reverse(tagWithoutPrefix), "-", 2)
-			if len(dataParts) != 2 {
+			rec := parseClientIDRecordTag(tag)
+			if rec == nil {
 				continue
 			}
-
-			clientID, timestampMillisecStr := util.Reverse(dataParts[1]), util.Reverse(dataParts[0])
-
-			timestampMillisec, err := strconv.ParseInt(timestampMillisecStr, 10, 64)
-			if err != nil {
-				continue
-			}
-
-			rec := &ClientIDRecord{ClientID: clientID, TimestampMillisec: timestampMillisec}
 			res = append(res, rec)
 
 			logboek.Context(ctx).Debug().LogF("-- RepoStagesStorage.GetClientIDRecords got clientID record: %s\n", rec)
@@ -708,6 +781,23 @@ func (storage *RepoStagesStorage) GetClientIDRecords(ctx context.Context, projec
 	return res, nil
 }
 
+func parseClientIDRecordTag(tag string) *ClientIDRecord {
+	tagWithoutPrefix := strings.TrimPrefix(tag, RepoClientIDRecrod_ImageTagPrefix)
+	dataParts := strings.SplitN(util.Reverse(tagWithoutPrefix), "-", 2)
+	if len(dataParts) != 2 {
+		return nil
+	}
+
+	clientID, timestampMillisecStr := util.Reverse(dataParts[1]), util.Reverse(dataParts[0])
+
+	timestampMillisec, err := strconv.ParseInt(timestampMillisecStr, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &ClientIDRecord{ClientID: clientID, TimestampMillisec: timestampMillisec}
+}
+
 func (storage *RepoStagesStorage) PostClientIDRecord(ctx context.Context, projectName string, rec *ClientIDRecord) error {
 	logboek.Context(ctx).Debug().LogF("-- RepoStagesStorage.PostClientID %s for project %s\n", rec.ClientID, projectName)
 
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/docker_registry"
+)
+
+const (
+	RepoMetadataIndex_ImageTag     = "metadata-index"
+	RepoMetadataIndex_ArtifactType = "application/vnd.werf.metadata-index.v1"
+	RepoMetadataIndex_MediaType    = "application/vnd.werf.metadata-index.v1+json"
+)
+
+// repoMetadataIndex is the compacted copy of the import metadata records, which are kept as separate tags.
+// The index is only a hint, which is created by CompactMetadataIndex and is never updated by writers:
+// the records are always listed by the tags (including the records of werf versions not supporting the index),
+// the index only saves the inspection of the tags of the listed records, the records missing in the index are inspected as usual.
+type repoMetadataIndex struct {
+	ImportMetadata map[string]*ImportMetadata `json:"importMetadata"`
+}
+
+func newRepoMetadataIndex() *repoMetadataIndex {
+	return &repoMetadataIndex{ImportMetadata: map[string]*ImportMetadata{}}
+}
+
+type repoMetadataIndexCache struct {
+	mux   sync.Mutex
+	index *repoMetadataIndex
+}
+
+func (cache *repoMetadataIndexCache) get() *repoMetadataIndex {
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+	return cache.index
+}
+
+func (cache *repoMetadataIndexCache) set(index *repoMetadataIndex) {
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+	cache.index = index
+}
+
+func makeRepoMetadataIndexName(repoAddress string) string {
+	return strings.Join([]string{repoAddress, RepoMetadataIndex_ImageTag}, ":")
+}
+
+// loadMetadataIndexHint reads the index into the cache, the index is only a hint, so that the invalid index is ignored
+func (storage *RepoStagesStorage) loadMetadataIndexHint(ctx context.Context) {
+	if _, err := storage.readMetadataIndex(ctx); err != nil {
+		logboek.Context(ctx).Warn().LogF("WARNING: Unable to read metadata index %s, the metadata tags will be inspected: %s\n", makeRepoMetadataIndexName(storage.RepoAddress), err)
+		storage.metadataIndexCache.set(nil)
+	}
+}
+
+// readMetadataIndex returns nil if the index does not exist
+func (storage *RepoStagesStorage) readMetadataIndex(ctx context.Context) (*repoMetadataIndex, error) {
+	indexName := makeRepoMetadataIndexName(storage.RepoAddress)
+
+	info, err := storage.DockerRegistry.TryGetRepoImage(ctx, indexName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get repo image %s: %s", indexName, err)
+	} else if info == nil {
+		storage.metadataIndexCache.set(nil)
+		return nil, nil
+	}
+
+	img, err := storage.DockerRegistry.GetRepoImageObject(ctx, strings.Join([]string{info.Repository, info.RepoDigest}, "@"))
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(layers) != 1 {
+		return nil, fmt.Errorf("unexpected metadata index %s: expected 1 blob, got %d", indexName, len(layers))
+	}
+
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read metadata index %s: %s", indexName, err)
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read metadata index %s: %s", indexName, err)
+	}
+
+	index := newRepoMetadataIndex()
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal metadata index %s: %s", indexName, err)
+	}
+
+	storage.metadataIndexCache.set(index)
+
+	return index, nil
+}
+
+func (storage *RepoStagesStorage) writeMetadataIndex(ctx context.Context, index *repoMetadataIndex) error {
+	indexName := makeRepoMetadataIndexName(storage.RepoAddress)
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	img, err := docker_registry.NewArtifactImage(docker_registry.PushArtifactOptions{
+		ArtifactType: RepoMetadataIndex_ArtifactType,
+		Blobs:        []docker_registry.ArtifactBlob{{MediaType: RepoMetadataIndex_MediaType, Data: data}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := storage.DockerRegistry.WriteRepoImageObject(ctx, indexName, img); err != nil {
+		return fmt.Errorf("unable to write metadata index %s: %s", indexName, err)
+	}
+
+	storage.metadataIndexCache.set(index)
+
+	return nil
+}
+
+func (storage *RepoStagesStorage) deleteMetadataIndex(ctx context.Context) error {
+	indexName := makeRepoMetadataIndexName(storage.RepoAddress)
+
+	if info, err := storage.DockerRegistry.TryGetRepoImage(ctx, indexName); err != nil {
+		return fmt.Errorf("unable to get repo image %s: %s", indexName, err)
+	} else if info != nil {
+		if err := storage.DockerRegistry.DeleteRepoImage(ctx, info); err != nil {
+			return fmt.Errorf("unable to remove metadata index %s: %s", indexName, err)
+		}
+	}
+
+	storage.metadataIndexCache.set(nil)
+
+	return nil
+}
+
+// CompactMetadataIndex rebuilds the index from the import metadata tags, the tags are kept as the source of truth.
+// The concurrent compactions and the records written after the compaction do not break readers, because the index is only a hint.
+func (storage *RepoStagesStorage) CompactMetadataIndex(ctx context.Context, projectName string) error {
+	logboek.Context(ctx).Debug().LogF("-- RepoStagesStorage.CompactMetadataIndex %s\n", projectName)
+
+	storage.loadMetadataIndexHint(ctx)
+	currentIndex := storage.metadataIndexCache.get()
+
+	tags, err := storage.DockerRegistry.Tags(ctx, storage.RepoAddress)
+	if err != nil {
+		return fmt.Errorf("unable to get repo %s tags: %s", storage.RepoAddress, err)
+	}
+
+	index := newRepoMetadataIndex()
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, RepoImportMetadata_ImageTagPrefix) {
+			continue
+		}
+
+		id := getImportMetadataIDFromRepoTag(tag)
+
+		if currentIndex != nil {
+			if metadata, ok := currentIndex.ImportMetadata[id]; ok {
+				index.ImportMetadata[id] = metadata
+				continue
+			}
+		}
+
+		metadata, err := storage.getImportMetadataByTag(ctx, id)
+		if err != nil {
+			return err
+		} else if metadata != nil {
+			index.ImportMetadata[id] = metadata
+		}
+	}
+
+	if err := storage.writeMetadataIndex(ctx, index); err != nil {
+		return err
+	}
+
+	logboek.Context(ctx).Info().LogF("Compacted metadata index %s: %d import metadata records\n", makeRepoMetadataIndexName(storage.RepoAddress), len(index.ImportMetadata))
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	"github.com/werf/werf/pkg/docker_registry"
+)
+
+// testRegistry extends the in-memory registry with the tags list and manifests deletion
+type testRegistry struct {
+	handler http.Handler
+
+	mux         sync.Mutex
+	digestByTag map[string]string
+	deleted     map[string]bool
+	blockedTags map[string]bool
+}
+
+func (r *testRegistry) getTagDigest(tag string) string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.digestByTag[tag]
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if strings.HasSuffix(req.URL.Path, "/tags/list") {
+		tags := []string{}
+		for tag := range r.digestByTag {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"tags": tags})
+		return
+	}
+
+	if !strings.Contains(req.URL.Path, "/manifests/") {
+		r.handler.ServeHTTP(w, req)
+		return
+	}
+
+	reference := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+
+	switch req.Method {
+	case http.MethodDelete:
+		r.deleteReference(reference)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		rec := httptest.NewRecorder()
+		r.handler.ServeHTTP(rec, req)
+
+		digest := rec.Header().Get("Docker-Content-Digest")
+		delete(r.deleted, digest)
+		delete(r.deleted, reference)
+		if !strings.HasPrefix(reference, "sha256:") {
+			r.digestByTag[reference] = digest
+		}
+
+		copyRecordedResponse(w, rec)
+	default:
+		if r.blockedTags[reference] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if r.deleted[reference] {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`)
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		r.handler.ServeHTTP(rec, req)
+		copyRecordedResponse(w, rec)
+	}
+}
+
+func (r *testRegistry) deleteReference(reference string) {
+	r.deleted[reference] = true
+
+	for tag, digest := range r.digestByTag {
+		if tag == reference || digest == reference {
+			delete(r.digestByTag, tag)
+			r.deleted[tag] = true
+		}
+	}
+}
+
+func copyRecordedResponse(w http.ResponseWriter, rec *httptest.ResponseRecorder) {
+	for key, values := range rec.Header() {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
+
+func newTestRepoStagesStorage(t *testing.T) (*RepoStagesStorage, *testRegistry) {
+	testRegistry := &testRegistry{handler: registry.New(), digestByTag: map[string]string{}, deleted: map[string]bool{}}
+
+	server := httptest.NewServer(testRegistry)
+	t.Cleanup(server.Close)
+
+	repoAddress := strings.TrimPrefix(server.URL, "http://") + "/project"
+
+	storage, err := NewRepoStagesStorage(repoAddress, nil, RepoStagesStorageOptions{
+		ContainerRegistry:     docker_registry.DefaultImplementationName,
+		DockerRegistryOptions: docker_registry.DockerRegistryOptions{InsecureRegistry: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storage, testRegistry
+}
+
+func TestRepoStagesStorageMetadataIndex(t *testing.T) {
+	ctx := context.Background()
+	storage, testRegistry := newTestRepoStagesStorage(t)
+
+	if err := storage.PutImageMetadata(ctx, "project", "app", "commit-1", "stage-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.PutImportMetadata(ctx, "project", &ImportMetadata{ImportSourceID: "import-1", SourceImageID: "image-1", Checksum: "checksum-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.PostClientIDRecord(ctx, "project", &ClientIDRecord{ClientID: "client", TimestampMillisec: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index is created by the compaction only
+	if index, err := storage.readMetadataIndex(ctx); err != nil {
+		t.Fatal(err)
+	} else if index != nil {
+		t.Fatalf("unexpected index before compaction: %+v", index)
+	}
+
+	if err := storage.CompactMetadataIndex(ctx, "project"); err != nil {
+		t.Fatal(err)
+	}
+
+	indexDigest := testRegistry.getTagDigest(RepoMetadataIndex_ImageTag)
+	if indexDigest == "" {
+		t.Fatal("expected metadata index to be written")
+	}
+
+	// writers do not update the index
+	if err := storage.PutImageMetadata(ctx, "project", "app", "commit-2", "stage-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.PutImportMetadata(ctx, "project", &ImportMetadata{ImportSourceID: "import-2", SourceImageID: "image-2", Checksum: "checksum-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.RmImportMetadata(ctx, "project", "import-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.RmImageMetadata(ctx, "project", "app", "commit-1", "stage-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if digest := testRegistry.getTagDigest(RepoMetadataIndex_ImageTag); digest != indexDigest {
+		t.Errorf("expected metadata index not to be changed by writers")
+	}
+
+	// the records are listed by the tags, the stale index records are ignored
+	imageMetadata, _, err := storage.GetAllAndGroupImageMetadataByImageName(ctx, "project", []string{"app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]map[string][]string{"app": {"stage-2": {"commit-2"}}}; !reflect.DeepEqual(imageMetadata, expected) {
+		t.Errorf("expected image metadata %v, got %v", expected, imageMetadata)
+	}
+
+	ids, err := storage.GetImportMetadataIDs(ctx, "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"import-2"}) {
+		t.Errorf("unexpected import metadata ids %v", ids)
+	}
+
+	// the record missing in the index is inspected by the tag
+	if metadata, err := storage.GetImportMetadata(ctx, "project", "import-2"); err != nil {
+		t.Fatal(err)
+	} else if metadata == nil || metadata.Checksum != "checksum-2" {
+		t.Errorf("unexpected import metadata %+v", metadata)
+	}
+
+	records, err := storage.GetClientIDRecords(ctx, "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || *records[0] != (ClientIDRecord{ClientID: "client", TimestampMillisec: 1}) {
+		t.Errorf("unexpected client id records %v", records)
+	}
+
+	// the indexed record is not inspected by the tag
+	if err := storage.CompactMetadataIndex(ctx, "project"); err != nil {
+		t.Fatal(err)
+	}
+
+	importMetadataTag := strings.TrimPrefix(makeRepoImportMetadataName(storage.RepoAddress, "import-2"), storage.RepoAddress+":")
+	testRegistry.mux.Lock()
+	testRegistry.blockedTags = map[string]bool{importMetadataTag: true}
+	testRegistry.mux.Unlock()
+
+	if _, err := storage.GetImportMetadataIDs(ctx, "project"); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := storage.GetImportMetadata(ctx, "project", "import-2"); err != nil {
+		t.Fatal(err)
+	} else if metadata == nil || metadata.Checksum != "checksum-2" {
+		t.Errorf("unexpected import metadata %+v", metadata)
+	}
+
+	// readers fall back to the tags without the index
+	testRegistry.mux.Lock()
+	testRegistry.blockedTags = nil
+	testRegistry.mux.Unlock()
+
+	if err := storage.deleteMetadataIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.GetImportMetadataIDs(ctx, "project"); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := storage.GetImportMetadata(ctx, "project", "import-2"); err != nil {
+		t.Fatal(err)
+	} else if metadata == nil || metadata.Checksum != "checksum-2" {
+		t.Errorf("unexpected import metadata %+v", metadata)
+	}
+}
@@ -0,0 +1,830 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/werf/logboek"
+
+	"github.com/werf/werf/pkg/container_runtime"
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/werf"
+)
+
+const (
+	S3StorageAddressPrefix = "s3://"
+
+	S3OCILayout_Key     = "oci-layout"
+	S3Blob_KeyFormat    = "blobs/%s/%s"
+	S3BlobRef_KeyFormat = "blob-refs/%s/%s/%s"
+	S3Stage_KeyPrefix   = "stages/"
+	S3Stage_KeyFormat   = "stages/%s-%d"
+	S3Record_KeyPrefix  = "records/"
+	S3Record_KeyFormat  = "records/%s"
+	S3DefaultRegion     = "us-east-1"
+)
+
+func IsS3StagesStorageAddress(address string) bool {
+	return strings.HasPrefix(address, S3StorageAddressPrefix)
+}
+
+// ParseS3StagesStorageAddress parses address in the form s3://BUCKET[/PREFIX].
+func ParseS3StagesStorageAddress(address string) (string, string, error) {
+	if !IsS3StagesStorageAddress(address) {
+		return "", "", fmt.Errorf("bad s3 address %q: expected %sBUCKET[/PREFIX]", address, S3StorageAddressPrefix)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(address, S3StorageAddressPrefix), "/", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("bad s3 address %q: bucket name required", address)
+	}
+
+	var prefix string
+	if len(parts) == 2 {
+		prefix = strings.Trim(parts[1], "/")
+	}
+
+	return parts[0], prefix, nil
+}
+
+// S3StagesStorage keeps stages in an S3-compatible bucket as an OCI image layout:
+// blobs are shared between all stages, each stage is an OCI index object under the stages/ prefix.
+// Managed images, image metadata, import metadata and client ID records are kept under the records/ prefix
+// and named the same way as the corresponding RepoStagesStorage tags.
+type S3StagesStorage struct {
+	StorageAddress string
+	Bucket         string
+	Prefix         string
+
+	ContainerRuntime container_runtime.ContainerRuntime
+
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+type S3StagesStorageOptions struct {
+	Endpoint string
+	Region   string
+}
+
+func NewS3StagesStorage(address string, containerRuntime container_runtime.ContainerRuntime, options S3StagesStorageOptions) (*S3StagesStorage, error) {
+	bucket, prefix, err := ParseS3StagesStorageAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	region := options.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = S3DefaultRegion
+	}
+
+	awsConfig := aws.NewConfig().WithRegion(region)
+	if options.Endpoint != "" {
+		// S3-compatible storages such as MinIO do not support virtual-hosted–style requests by default
+		awsConfig = awsConfig.WithEndpoint(options.Endpoint).WithS3ForcePathStyle(true)
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create s3 session: %s", err)
+	}
+
+	client := s3.New(sess)
+
+	return &S3StagesStorage{
+		StorageAddress:   address,
+		Bucket:           bucket,
+		Prefix:           prefix,
+		ContainerRuntime: containerRuntime,
+		client:           client,
+		uploader:         s3manager.NewUploaderWithClient(client),
+	}, nil
+}
+
+func (storage *S3StagesStorage) ConstructStageImageName(projectName, digest string, uniqueID int64) string {
+	return fmt.Sprintf(LocalStage_ImageFormat, projectName, digest, uniqueID)
+}
+
+func (storage *S3StagesStorage) GetStagesIDs(ctx context.Context, _ string) ([]image.StageID, error) {
+	keys, err := storage.listObjects(ctx, S3Stage_KeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list stages in %s: %s", storage.String(), err)
+	}
+
+	var res []image.StageID
+	for _, key := range keys {
+		tag := strings.TrimPrefix(key, S3Stage_KeyPrefix)
+		if len(tag) != 70 || len(strings.Split(tag, "-")) != 2 {
+			continue
+		}
+
+		if digest, uniqueID, err := getDigestAndUniqueIDFromRepoStageImageTag(tag); err != nil {
+			if isUnexpectedTagFormatError(err) {
+				logboek.Context(ctx).Debug().LogLn(err.Error())
+				continue
+			}
+			return nil, err
+		} else {
+			res = append(res, image.StageID{Digest: digest, UniqueID: uniqueID})
+		}
+	}
+
+	return res, nil
+}
+
+func (storage *S3StagesStorage) GetStagesIDsByDigest(ctx context.Context, _, digest string) ([]image.StageID, error) {
+	keys, err := storage.listObjects(ctx, S3Stage_KeyPrefix+digest+"-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list stages in %s: %s", storage.String(), err)
+	}
+
+	rejected := map[string]bool{}
+	for _, key := range keys {
+		if strings.HasSuffix(key, RepoRejectedStageImageRecord_ImageTagSuffix) {
+			rejected[strings.TrimSuffix(key, RepoRejectedStageImageRecord_ImageTagSuffix)] = true
+		}
+	}
+
+	var res []image.StageID
+	for _, key := range keys {
+		if strings.HasSuffix(key, RepoRejectedStageImageRecord_ImageTagSuffix) {
+			continue
+		}
+
+		if rejected[key] {
+			logboek.Context(ctx).Info().LogF("Discarding rejected stage %q\n", key)
+			continue
+		}
+
+		if _, uniqueID, err := getDigestAndUniqueIDFromRepoStageImageTag(strings.TrimPrefix(key, S3Stage_KeyPrefix)); err != nil {
+			if isUnexpectedTagFormatError(err) {
+				logboek.Context(ctx).Debug().LogLn(err.Error())
+				continue
+			}
+			return nil, err
+		} else {
+			res = append(res, image.StageID{Digest: digest, UniqueID: uniqueID})
+		}
+	}
+
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.GetStagesIDsByDigest result for %q: %#v\n", digest, res)
+
+	return res, nil
+}
+
+func (storage *S3StagesStorage) GetStageDescription(ctx context.Context, projectName, digest string, uniqueID int64) (*image.StageDescription, error) {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.GetStageDescription %s %s %d\n", projectName, digest, uniqueID)
+
+	if isRejected, err := storage.isObjectExist(ctx, makeS3RejectedStageKey(digest, uniqueID)); err != nil {
+		return nil, err
+	} else if isRejected {
+		logboek.Context(ctx).Info().LogF("Stage digest %s uniqueID %d image is rejected: ignore stage image\n", digest, uniqueID)
+		return nil, nil
+	}
+
+	img, err := storage.getStageImage(ctx, digest, uniqueID)
+	if err != nil {
+		return nil, err
+	} else if img == nil {
+		return nil, nil
+	}
+
+	info, err := newInfoFromOCIImage(storage.ConstructStageImageName(projectName, digest, uniqueID), img)
+	if isS3NotFoundError(err) {
+		return nil, ErrBrokenImage
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to inspect stage %s-%d in %s: %s", digest, uniqueID, storage.String(), err)
+	}
+
+	return &image.StageDescription{
+		StageID: &image.StageID{Digest: digest, UniqueID: uniqueID},
+		Info:    info,
+	}, nil
+}
+
+func (storage *S3StagesStorage) DeleteStage(ctx context.Context, stageDescription *image.StageDescription, _ DeleteImageOptions) error {
+	digest, uniqueID := stageDescription.StageID.Digest, stageDescription.StageID.UniqueID
+	stageKey := makeS3StageKey(digest, uniqueID)
+
+	var blobs []v1.Hash
+	if img, err := storage.getStageImage(ctx, digest, uniqueID); err != nil {
+		return err
+	} else if img != nil {
+		if blobs, err = listOCIImageBlobs(img); err != nil && !isS3NotFoundError(err) {
+			return fmt.Errorf("unable to list stage %s blobs: %s", stageKey, err)
+		}
+	}
+
+	for _, key := range []string{stageKey, makeS3RejectedStageKey(digest, uniqueID)} {
+		if err := storage.deleteObject(ctx, key); err != nil {
+			return fmt.Errorf("unable to delete %s: %s", key, err)
+		}
+	}
+
+	return storage.releaseBlobs(ctx, stageDescription.StageID.String(), blobs)
+}
+
+func (storage *S3StagesStorage) RejectStage(ctx context.Context, projectName, digest string, uniqueID int64) error {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.RejectStage %s %s %d\n", projectName, digest, uniqueID)
+
+	if err := storage.putObject(ctx, makeS3RejectedStageKey(digest, uniqueID), bytes.NewReader(nil)); err != nil {
+		return fmt.Errorf("unable to put rejected stage record: %s", err)
+	}
+
+	logboek.Context(ctx).Info().LogF("Rejected stage by digest %s uniqueID %d\n", digest, uniqueID)
+
+	return nil
+}
+
+func (storage *S3StagesStorage) FilterStagesAndProcessRelatedData(_ context.Context, stageDescriptions []*image.StageDescription, _ FilterStagesAndProcessRelatedDataOptions) ([]*image.StageDescription, error) {
+	return stageDescriptions, nil
+}
+
+func (storage *S3StagesStorage) FetchImage(ctx context.Context, img container_runtime.Image) error {
+	dockerImage := img.(*container_runtime.DockerImage)
+
+	_, tag := image.ParseRepositoryAndTag(dockerImage.Image.Name())
+	digest, uniqueID, err := getDigestAndUniqueIDFromRepoStageImageTag(tag)
+	if err != nil {
+		return fmt.Errorf("unable to parse stage image name %q: %s", dockerImage.Image.Name(), err)
+	}
+
+	ociImage, err := storage.getStageImage(ctx, digest, uniqueID)
+	if err != nil {
+		return err
+	} else if ociImage == nil {
+		return fmt.Errorf("stage %s not found in %s", tag, storage.String())
+	}
+
+	if err := logboek.Context(ctx).Info().LogProcess("Loading %s from %s", dockerImage.Image.Name(), storage.String()).DoError(func() error {
+		return loadLocalImage(ctx, storage.ContainerRuntime, dockerImage.Image.Name(), ociImage)
+	}); err != nil {
+		if isS3NotFoundError(err) {
+			return ErrBrokenImage
+		}
+		return err
+	}
+
+	return storage.ContainerRuntime.RefreshImageObject(ctx, img)
+}
+
+func (storage *S3StagesStorage) StoreImage(ctx context.Context, img container_runtime.Image) error {
+	if _, ok := img.(*container_runtime.ManifestListImage); ok {
+		return errMultiPlatformImagesNotSupported(storage)
+	}
+
+	dockerImage := img.(*container_runtime.DockerImage)
+
+	if dockerImage.Image.GetBuiltId() != "" {
+		if err := dockerImage.Image.TagBuiltImage(ctx); err != nil {
+			return fmt.Errorf("unable to tag built image by name %s: %s", dockerImage.Image.Name(), err)
+		}
+	}
+
+	_, tag := image.ParseRepositoryAndTag(dockerImage.Image.Name())
+	digest, uniqueID, err := getDigestAndUniqueIDFromRepoStageImageTag(tag)
+	if err != nil {
+		return fmt.Errorf("unable to parse stage image name %q: %s", dockerImage.Image.Name(), err)
+	}
+
+	tmpDir, err := ioutil.TempDir(werf.GetTmpDir(), "werf-s3-stage-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	return logboek.Context(ctx).Info().LogProcess("Storing %s into %s", dockerImage.Image.Name(), storage.String()).DoError(func() error {
+		ociImage, err := saveLocalImage(ctx, storage.ContainerRuntime, dockerImage.Image.Name(), tmpDir)
+		if err != nil {
+			return err
+		}
+
+		return storage.putStageImage(ctx, digest, uniqueID, ociImage)
+	})
+}
+
+func (storage *S3StagesStorage) ShouldFetchImage(ctx context.Context, img container_runtime.Image) (bool, error) {
+	dockerImage := img.(*container_runtime.DockerImage)
+
+	if inspect, err := storage.ContainerRuntime.GetImageInspect(ctx, dockerImage.Image.Name()); err != nil {
+		return false, fmt.Errorf("unable to get inspect for image %s: %s", dockerImage.Image.Name(), err)
+	} else if inspect != nil {
+		dockerImage.Image.SetInspect(inspect)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (storage *S3StagesStorage) CreateRepo(ctx context.Context) error {
+	if exists, err := storage.isObjectExist(ctx, S3OCILayout_Key); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	return storage.putObject(ctx, S3OCILayout_Key, strings.NewReader(ociLayoutFileContent))
+}
+
+func (storage *S3StagesStorage) DeleteRepo(ctx context.Context) error {
+	keys, err := storage.listObjects(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := storage.deleteObject(ctx, key); err != nil {
+			return fmt.Errorf("unable to delete %s: %s", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (storage *S3StagesStorage) AddManagedImage(ctx context.Context, projectName, imageName string) error {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.AddManagedImage %s %s\n", projectName, imageName)
+
+	if validateImageName(imageName) != nil {
+		return nil
+	}
+
+	return storage.putRecord(ctx, RepoManagedImageRecord_ImageTagPrefix+slugImageNameAsDockerImageTag(imageName), nil)
+}
+
+func (storage *S3StagesStorage) RmManagedImage(ctx context.Context, projectName, imageName string) error {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.RmManagedImage %s %s\n", projectName, imageName)
+
+	return storage.rmRecord(ctx, RepoManagedImageRecord_ImageTagPrefix+slugImageNameAsDockerImageTag(imageName))
+}
+
+func (storage *S3StagesStorage) GetManagedImages(ctx context.Context, projectName string) ([]string, error) {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.GetManagedImages %s\n", projectName)
+
+	tags, err := storage.listRecords(ctx, RepoManagedImageRecord_ImageTagPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, tag := range tags {
+		managedImageName := unslugDockerImageTagAsImageName(strings.TrimPrefix(tag, RepoManagedImageRecord_ImageTagPrefix))
+
+		if validateImageName(managedImageName) != nil {
+			continue
+		}
+
+		res = append(res, managedImageName)
+	}
+
+	return res, nil
+}
+
+func (storage *S3StagesStorage) PutImageMetadata(ctx context.Context, projectName, imageName, commit, stageID string) error {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.PutImageMetadata %s %s %s %s\n", projectName, imageName, commit, stageID)
+
+	if err := storage.putRecord(ctx, fmt.Sprintf(RepoImageMetadataByCommitRecord_TagFormat, imageNameID(imageName), commit, stageID), nil); err != nil {
+		return err
+	}
+
+	logboek.Context(ctx).Info().LogF("Put image %s commit %s stage ID %s\n", imageName, commit, stageID)
+
+	return nil
+}
+
+func (storage *S3StagesStorage) RmImageMetadata(ctx context.Context, projectName, imageNameOrID, commit, stageID string) error {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.RmImageMetadata %s %s %s %s\n", projectName, imageNameOrID, commit, stageID)
+
+	for _, tag := range []string{
+		fmt.Sprintf(RepoImageMetadataByCommitRecord_TagFormat, imageNameID(imageNameOrID), commit, stageID),
+		fmt.Sprintf(RepoImageMetadataByCommitRecord_TagFormat, imageNameOrID, commit, stageID),
+	} {
+		if err := storage.rmRecord(ctx, tag); err != nil {
+			return err
+		}
+	}
+
+	logboek.Context(ctx).Info().LogF("Removed image %s commit %s stage ID %s\n", imageNameOrID, commit, stageID)
+
+	return nil
+}
+
+func (storage *S3StagesStorage) IsImageMetadataExist(ctx context.Context, projectName, imageName, commit, stageID string) (bool, error) {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.IsImageMetadataExist %s %s %s %s\n", projectName, imageName, commit, stageID)
+
+	return storage.isObjectExist(ctx, makeS3RecordKey(fmt.Sprintf(RepoImageMetadataByCommitRecord_TagFormat, imageNameID(imageName), commit, stageID)))
+}
+
+func (storage *S3StagesStorage) GetAllAndGroupImageMetadataByImageName(ctx context.Context, projectName string, imageNameList []string) (map[string]map[string][]string, map[string]map[string][]string, error) {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.GetAllAndGroupImageMetadataByImageName %s %v\n", projectName, imageNameList)
+
+	tags, err := storage.listRecords(ctx, RepoImageMetadataByCommitRecord_ImageTagPrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return groupImageMetadataTagsByImageName(ctx, imageNameList, tags, RepoImageMetadataByCommitRecord_ImageTagPrefix)
+}
+
+func (storage *S3StagesStorage) GetImportMetadata(ctx context.Context, _, id string) (*ImportMetadata, error) {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.GetImportMetadata %s\n", id)
+
+	data, err := storage.getObject(ctx, makeS3RecordKey(RepoImportMetadata_ImageTagPrefix+id))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get import metadata %s: %s", id, err)
+	} else if data == nil {
+		return nil, nil
+	}
+
+	labels := map[string]string{}
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal import metadata %s: %s", id, err)
+	}
+
+	return newImportMetadataFromLabels(labels), nil
+}
+
+func (storage *S3StagesStorage) PutImportMetadata(ctx context.Context, projectName string, metadata *ImportMetadata) error {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.PutImportMetadata %v\n", metadata)
+
+	labels := metadata.ToLabels()
+	labels[image.WerfLabel] = projectName
+
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+
+	return storage.putRecord(ctx, RepoImportMetadata_ImageTagPrefix+metadata.ImportSourceID, data)
+}
+
+func (storage *S3StagesStorage) RmImportMetadata(ctx context.Context, _, id string) error {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.RmImportMetadata %s\n", id)
+
+	return storage.rmRecord(ctx, RepoImportMetadata_ImageTagPrefix+id)
+}
+
+func (storage *S3StagesStorage) GetImportMetadataIDs(ctx context.Context, _ string) ([]string, error) {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.GetImportMetadataIDs\n")
+
+	tags, err := storage.listRecords(ctx, RepoImportMetadata_ImageTagPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, tag := range tags {
+		ids = append(ids, getImportMetadataIDFromRepoTag(tag))
+	}
+
+	return ids, nil
+}
+
+func (storage *S3StagesStorage) GetClientIDRecords(ctx context.Context, projectName string) ([]*ClientIDRecord, error) {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.GetClientIDRecords for project %s\n", projectName)
+
+	tags, err := storage.listRecords(ctx, RepoClientIDRecrod_ImageTagPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*ClientIDRecord
+	for _, tag := range tags {
+		if rec := parseClientIDRecordTag(tag); rec != nil {
+			res = append(res, rec)
+		}
+	}
+
+	return res, nil
+}
+
+func (storage *S3StagesStorage) PostClientIDRecord(ctx context.Context, projectName string, rec *ClientIDRecord) error {
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.PostClientID %s for project %s\n", rec.ClientID, projectName)
+
+	if err := storage.putRecord(ctx, fmt.Sprintf("%s%s-%d", RepoClientIDRecrod_ImageTagPrefix, rec.ClientID, rec.TimestampMillisec), nil); err != nil {
+		return err
+	}
+
+	logboek.Context(ctx).Info().LogF("Posted new clientID %q for project %s\n", rec.ClientID, projectName)
+
+	return nil
+}
+
+func (storage *S3StagesStorage) String() string {
+	return storage.StorageAddress
+}
+
+func (storage *S3StagesStorage) Address() string {
+	return storage.StorageAddress
+}
+
+func (storage *S3StagesStorage) GetStageImage(ctx context.Context, _ string, stageID image.StageID) (v1.Image, error) {
+	return storage.getStageImage(ctx, stageID.Digest, stageID.UniqueID)
+}
+
+func (storage *S3StagesStorage) PutStageImage(ctx context.Context, _ string, stageID image.StageID, img v1.Image) error {
+	return storage.putStageImage(ctx, stageID.Digest, stageID.UniqueID, img)
+}
+
+func (storage *S3StagesStorage) putStageImage(ctx context.Context, digest string, uniqueID int64, img v1.Image) error {
+	if err := storage.CreateRepo(ctx); err != nil {
+		return err
+	}
+
+	stageID := image.StageID{Digest: digest, UniqueID: uniqueID}.String()
+
+	blobs, err := listOCIImageBlobs(img)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: blob reference should be registered before the blob itself, see releaseBlobs
+	for _, blob := range blobs {
+		if err := storage.putObject(ctx, makeS3BlobRefKey(blob, stageID), bytes.NewReader(nil)); err != nil {
+			return fmt.Errorf("unable to put blob %s reference: %s", blob, err)
+		}
+	}
+
+	if err := forEachOCIImageBlob(img, func(hash v1.Hash, opener func() (io.ReadCloser, error)) error {
+		return storage.putBlob(ctx, hash, opener)
+	}); err != nil {
+		return err
+	}
+
+	desc, err := partial.Descriptor(img)
+	if err != nil {
+		return err
+	}
+	desc.Annotations = map[string]string{ociImageRefAnnotation: stageID}
+
+	index := &v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests:     []v1.Descriptor{*desc},
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	return storage.putObject(ctx, makeS3StageKey(digest, uniqueID), bytes.NewReader(data))
+}
+
+// getStageImage returns nil if the stage does not exist.
+func (storage *S3StagesStorage) getStageImage(ctx context.Context, digest string, uniqueID int64) (v1.Image, error) {
+	stageKey := makeS3StageKey(digest, uniqueID)
+
+	data, err := storage.getObject(ctx, stageKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s: %s", stageKey, err)
+	} else if data == nil {
+		return nil, nil
+	}
+
+	index, err := v1.ParseIndexManifest(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", stageKey, err)
+	}
+
+	if len(index.Manifests) == 0 {
+		return nil, ErrBrokenImage
+	}
+
+	return newOCIImageFromBlobs(index.Manifests[0], func(hash v1.Hash) (io.ReadCloser, error) {
+		return storage.openObject(ctx, makeS3BlobKey(hash))
+	})
+}
+
+func (storage *S3StagesStorage) putBlob(ctx context.Context, hash v1.Hash, opener func() (io.ReadCloser, error)) error {
+	key := makeS3BlobKey(hash)
+	if exists, err := storage.isObjectExist(ctx, key); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	rc, err := opener()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := storage.putObject(ctx, key, rc); err != nil {
+		return fmt.Errorf("unable to put blob %s: %s", hash, err)
+	}
+
+	return nil
+}
+
+// releaseBlobs deletes stage references to the blobs and deletes blobs that are not referenced by any other stage.
+func (storage *S3StagesStorage) releaseBlobs(ctx context.Context, stageID string, blobs []v1.Hash) error {
+	for _, blob := range blobs {
+		if err := storage.deleteObject(ctx, makeS3BlobRefKey(blob, stageID)); err != nil {
+			return fmt.Errorf("unable to delete blob %s reference: %s", blob, err)
+		}
+
+		refs, err := storage.listObjects(ctx, path.Dir(makeS3BlobRefKey(blob, stageID))+"/")
+		if err != nil {
+			return fmt.Errorf("unable to list blob %s references: %s", blob, err)
+		}
+
+		if len(refs) > 0 {
+			continue
+		}
+
+		logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.releaseBlobs deleting unreferenced blob %s\n", blob)
+		if err := storage.deleteObject(ctx, makeS3BlobKey(blob)); err != nil {
+			return fmt.Errorf("unable to delete blob %s: %s", blob, err)
+		}
+	}
+
+	return nil
+}
+
+func (storage *S3StagesStorage) putRecord(ctx context.Context, tag string, data []byte) error {
+	key := makeS3RecordKey(tag)
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.putRecord %s\n", key)
+
+	if err := storage.putObject(ctx, key, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("unable to put record %s: %s", key, err)
+	}
+
+	return nil
+}
+
+func (storage *S3StagesStorage) rmRecord(ctx context.Context, tag string) error {
+	key := makeS3RecordKey(tag)
+	logboek.Context(ctx).Debug().LogF("-- S3StagesStorage.rmRecord %s\n", key)
+
+	if err := storage.deleteObject(ctx, key); err != nil {
+		return fmt.Errorf("unable to delete record %s: %s", key, err)
+	}
+
+	return nil
+}
+
+func (storage *S3StagesStorage) listRecords(ctx context.Context, tagPrefix string) ([]string, error) {
+	keys, err := storage.listObjects(ctx, makeS3RecordKey(tagPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list records in %s: %s", storage.String(), err)
+	}
+
+	var tags []string
+	for _, key := range keys {
+		tags = append(tags, strings.TrimPrefix(key, S3Record_KeyPrefix))
+	}
+
+	return tags, nil
+}
+
+func (storage *S3StagesStorage) objectKey(key string) string {
+	if storage.Prefix == "" {
+		return key
+	}
+	return path.Join(storage.Prefix, key)
+}
+
+func (storage *S3StagesStorage) putObject(ctx context.Context, key string, body io.Reader) error {
+	_, err := storage.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(storage.Bucket),
+		Key:    aws.String(storage.objectKey(key)),
+		Body:   body,
+	})
+	return err
+}
+
+// getObject returns nil if the object does not exist.
+func (storage *S3StagesStorage) getObject(ctx context.Context, key string) ([]byte, error) {
+	rc, err := storage.openObject(ctx, key)
+	if isS3NotFoundError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+func (storage *S3StagesStorage) openObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := storage.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(storage.Bucket),
+		Key:    aws.String(storage.objectKey(key)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
+
+func (storage *S3StagesStorage) isObjectExist(ctx context.Context, key string) (bool, error) {
+	_, err := storage.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(storage.Bucket),
+		Key:    aws.String(storage.objectKey(key)),
+	})
+	if isS3NotFoundError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to check existence of %s: %s", key, err)
+	}
+
+	return true, nil
+}
+
+func (storage *S3StagesStorage) deleteObject(ctx context.Context, key string) error {
+	_, err := storage.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(storage.Bucket),
+		Key:    aws.String(storage.objectKey(key)),
+	})
+	if isS3NotFoundError(err) {
+		return nil
+	}
+
+	return err
+}
+
+// listObjects returns keys relative to the storage prefix.
+func (storage *S3StagesStorage) listObjects(ctx context.Context, keyPrefix string) ([]string, error) {
+	fullPrefix := storage.objectKey(keyPrefix)
+	if strings.HasSuffix(keyPrefix, "/") && !strings.HasSuffix(fullPrefix, "/") {
+		fullPrefix += "/"
+	}
+
+	var res []string
+	if err := storage.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(storage.Bucket),
+		Prefix: aws.String(fullPrefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+			if storage.Prefix != "" {
+				key = strings.TrimPrefix(key, storage.Prefix+"/")
+			}
+			res = append(res, key)
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func isS3NotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == 404 {
+		return true
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+
+	return false
+}
+
+func makeS3StageKey(digest string, uniqueID int64) string {
+	return fmt.Sprintf(S3Stage_KeyFormat, digest, uniqueID)
+}
+
+func makeS3RejectedStageKey(digest string, uniqueID int64) string {
+	return makeS3StageKey(digest, uniqueID) + RepoRejectedStageImageRecord_ImageTagSuffix
+}
+
+func makeS3BlobKey(hash v1.Hash) string {
+	return fmt.Sprintf(S3Blob_KeyFormat, hash.Algorithm, hash.Hex)
+}
+
+func makeS3BlobRefKey(hash v1.Hash, stageID string) string {
+	return fmt.Sprintf(S3BlobRef_KeyFormat, hash.Algorithm, hash.Hex, stageID)
+}
+
+func makeS3RecordKey(tag string) string {
+	return fmt.Sprintf(S3Record_KeyFormat, tag)
+}
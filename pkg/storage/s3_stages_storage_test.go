@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/werf/werf/pkg/image"
+)
+
+// fakeS3Server is an in-process path-style S3 server that supports only the subset of the API used by S3StagesStorage.
+type fakeS3Server struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+type fakeS3ListBucketResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string   `xml:"Name"`
+	Prefix      string   `xml:"Prefix"`
+	KeyCount    int      `xml:"KeyCount"`
+	IsTruncated bool     `xml:"IsTruncated"`
+	Contents    []struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+func (s *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+
+	if len(parts) == 1 || parts[1] == "" {
+		if r.Method != http.MethodGet || r.URL.Query().Get("list-type") != "2" {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		prefix := r.URL.Query().Get("prefix")
+		res := fakeS3ListBucketResult{Name: bucket, Prefix: prefix}
+
+		var keys []string
+		for key := range s.objects {
+			if strings.HasPrefix(key, bucket+"/"+prefix) {
+				keys = append(keys, strings.TrimPrefix(key, bucket+"/"))
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			res.Contents = append(res.Contents, struct {
+				Key  string `xml:"Key"`
+				Size int    `xml:"Size"`
+			}{Key: key, Size: len(s.objects[bucket+"/"+key])})
+		}
+		res.KeyCount = len(res.Contents)
+
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(res)
+		return
+	}
+
+	key := bucket + "/" + parts[1]
+
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		s.objects[key] = data
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (s *fakeS3Server) keysWithPrefix(prefix string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var res []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+func newTestS3StagesStorage(t *testing.T) (*S3StagesStorage, *fakeS3Server) {
+	fake := &fakeS3Server{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	for name, value := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "test",
+		"AWS_SECRET_ACCESS_KEY": "test",
+	} {
+		oldValue, isSet := os.LookupEnv(name)
+		os.Setenv(name, value)
+		t.Cleanup(func() {
+			if isSet {
+				os.Setenv(name, oldValue)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+
+	storage, err := NewS3StagesStorage("s3://werf-stages/myproject", nil, S3StagesStorageOptions{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storage, fake
+}
+
+func TestParseS3StagesStorageAddress(t *testing.T) {
+	for _, tc := range []struct {
+		address        string
+		expectedBucket string
+		expectedPrefix string
+		expectedErr    bool
+	}{
+		{address: "s3://bucket", expectedBucket: "bucket"},
+		{address: "s3://bucket/", expectedBucket: "bucket"},
+		{address: "s3://bucket/prefix/sub/", expectedBucket: "bucket", expectedPrefix: "prefix/sub"},
+		{address: "s3://", expectedErr: true},
+		{address: "registry.example.com/project", expectedErr: true},
+	} {
+		bucket, prefix, err := ParseS3StagesStorageAddress(tc.address)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.address)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.address, err)
+		} else if bucket != tc.expectedBucket || prefix != tc.expectedPrefix {
+			t.Errorf("%s: expected bucket %q prefix %q, got bucket %q prefix %q", tc.address, tc.expectedBucket, tc.expectedPrefix, bucket, prefix)
+		}
+	}
+}
+
+func TestS3StagesStorage_Records(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := newTestS3StagesStorage(t)
+
+	if err := storage.AddManagedImage(ctx, "myproject", "backend/api"); err != nil {
+		t.Fatal(err)
+	}
+	if managedImages, err := storage.GetManagedImages(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(managedImages) != 1 || managedImages[0] != "backend/api" {
+		t.Errorf("unexpected managed images: %v", managedImages)
+	}
+	if err := storage.RmManagedImage(ctx, "myproject", "backend/api"); err != nil {
+		t.Fatal(err)
+	}
+	if managedImages, err := storage.GetManagedImages(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(managedImages) != 0 {
+		t.Errorf("expected no managed images, got %v", managedImages)
+	}
+
+	if err := storage.PutImageMetadata(ctx, "myproject", "backend/api", "commit1", "stage1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.PutImageMetadata(ctx, "myproject", "frontend", "commit2", "stage2"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := storage.IsImageMetadataExist(ctx, "myproject", "backend/api", "commit1", "stage1"); err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		t.Errorf("expected image metadata to exist")
+	}
+
+	managed, notManaged, err := storage.GetAllAndGroupImageMetadataByImageName(ctx, "myproject", []string{"backend/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commits := managed["backend/api"]["stage1"]; len(commits) != 1 || commits[0] != "commit1" {
+		t.Errorf("unexpected managed image metadata: %v", managed)
+	}
+	if commits := notManaged[imageNameID("frontend")]["stage2"]; len(commits) != 1 || commits[0] != "commit2" {
+		t.Errorf("unexpected not managed image metadata: %v", notManaged)
+	}
+
+	if err := storage.RmImageMetadata(ctx, "myproject", imageNameID("frontend"), "commit2", "stage2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, notManaged, err := storage.GetAllAndGroupImageMetadataByImageName(ctx, "myproject", nil); err != nil {
+		t.Fatal(err)
+	} else if _, ok := notManaged[imageNameID("frontend")]; ok {
+		t.Errorf("expected frontend image metadata to be removed: %v", notManaged)
+	}
+
+	importMetadata := &ImportMetadata{ImportSourceID: "import-id", SourceImageID: "sha256:source", Checksum: "checksum"}
+	if err := storage.PutImportMetadata(ctx, "myproject", importMetadata); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := storage.GetImportMetadata(ctx, "myproject", "import-id"); err != nil {
+		t.Fatal(err)
+	} else if got == nil || *got != *importMetadata {
+		t.Errorf("expected import metadata %v, got %v", importMetadata, got)
+	}
+	if ids, err := storage.GetImportMetadataIDs(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 1 || ids[0] != "import-id" {
+		t.Errorf("unexpected import metadata ids: %v", ids)
+	}
+	if err := storage.RmImportMetadata(ctx, "myproject", "import-id"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := storage.GetImportMetadata(ctx, "myproject", "import-id"); err != nil {
+		t.Fatal(err)
+	} else if got != nil {
+		t.Errorf("expected import metadata to be removed, got %v", got)
+	}
+
+	if err := storage.PostClientIDRecord(ctx, "myproject", &ClientIDRecord{ClientID: "client-a", TimestampMillisec: 1611836746968}); err != nil {
+		t.Fatal(err)
+	}
+	if records, err := storage.GetClientIDRecords(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].ClientID != "client-a" || records[0].TimestampMillisec != 1611836746968 {
+		t.Errorf("unexpected client id records: %v", records)
+	}
+}
+
+func TestS3StagesStorage_Stages(t *testing.T) {
+	ctx := context.Background()
+	storage, fake := newTestS3StagesStorage(t)
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := strings.Repeat("a", 56)
+	firstStageUniqueID, secondStageUniqueID := int64(1611836746968), int64(1611836746969)
+
+	for _, uniqueID := range []int64{firstStageUniqueID, secondStageUniqueID} {
+		if err := storage.putStageImage(ctx, digest, uniqueID, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ids, err := storage.GetStagesIDs(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 2 {
+		t.Errorf("expected 2 stages, got %v", ids)
+	}
+
+	stageDesc, err := storage.GetStageDescription(ctx, "myproject", digest, firstStageUniqueID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configName, _ := img.ConfigName()
+	if stageDesc == nil || stageDesc.Info.ID != configName.String() {
+		t.Fatalf("unexpected stage description: %#v", stageDesc)
+	}
+	if stageDesc.Info.Name != fmt.Sprintf("myproject:%s-%d", digest, firstStageUniqueID) {
+		t.Errorf("unexpected stage image name %q", stageDesc.Info.Name)
+	}
+
+	if err := storage.RejectStage(ctx, "myproject", digest, secondStageUniqueID); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := storage.GetStagesIDsByDigest(ctx, "myproject", digest); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 1 || ids[0].UniqueID != firstStageUniqueID {
+		t.Errorf("expected only not rejected stage, got %v", ids)
+	}
+
+	blobsPrefix := "werf-stages/myproject/blobs/"
+	blobs := fake.keysWithPrefix(blobsPrefix)
+	if len(blobs) != 4 {
+		t.Fatalf("expected manifest, config and 2 layer blobs, got %v", blobs)
+	}
+
+	if err := storage.DeleteStage(ctx, stageDesc, DeleteImageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if blobs := fake.keysWithPrefix(blobsPrefix); len(blobs) != 4 {
+		t.Errorf("expected blobs to be kept while referenced by another stage, got %v", blobs)
+	}
+
+	secondStageDesc, err := storage.GetStageDescription(ctx, "myproject", digest, secondStageUniqueID)
+	if err != nil {
+		t.Fatal(err)
+	} else if secondStageDesc != nil {
+		t.Errorf("expected rejected stage description to be nil")
+	}
+
+	secondStage := *stageDesc
+	secondStage.StageID = &image.StageID{Digest: digest, UniqueID: secondStageUniqueID}
+	if err := storage.DeleteStage(ctx, &secondStage, DeleteImageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if blobs := fake.keysWithPrefix(blobsPrefix); len(blobs) != 0 {
+		t.Errorf("expected unreferenced blobs to be deleted, got %v", blobs)
+	}
+	if ids, err := storage.GetStagesIDs(ctx, "myproject"); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 0 {
+		t.Errorf("expected no stages, got %v", ids)
+	}
+}
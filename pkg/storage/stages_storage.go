@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
 	"github.com/werf/werf/pkg/container_runtime"
 	"github.com/werf/werf/pkg/image"
 )
@@ -61,6 +63,28 @@ type StagesStorage interface {
 	Address() string
 }
 
+// StageImageAccessor is implemented by the stages storages which are able to read and write stage images directly,
+// without the container runtime (used to copy stages between storages).
+type StageImageAccessor interface {
+	// GetStageImage returns nil if the stage does not exist
+	GetStageImage(ctx context.Context, projectName string, stageID image.StageID) (v1.Image, error)
+	PutStageImage(ctx context.Context, projectName string, stageID image.StageID, img v1.Image) error
+}
+
+// StageIndexAccessor is implemented by the stages storages which are able to read and write multi-platform stages,
+// stored as the image indexes, directly (used to copy stages between storages without flattening them).
+type StageIndexAccessor interface {
+	// GetStageIndex returns nil if the stage does not exist or it is not an image index
+	GetStageIndex(ctx context.Context, projectName string, stageID image.StageID) (v1.ImageIndex, error)
+	PutStageIndex(ctx context.Context, projectName string, stageID image.StageID, idx v1.ImageIndex) error
+}
+
+// MetadataIndexCompactor is implemented by the stages storages which are able to keep the metadata records in the single compacted index.
+type MetadataIndexCompactor interface {
+	// CompactMetadataIndex rebuilds the index from the metadata records
+	CompactMetadataIndex(ctx context.Context, projectName string) error
+}
+
 type ClientIDRecord struct {
 	ClientID          string
 	TimestampMillisec int64
@@ -76,12 +100,35 @@ type ImageMetadata struct {
 
 type StagesStorageOptions struct {
 	RepoStagesStorageOptions
+	S3StagesStorageOptions
 }
 
 func NewStagesStorage(stagesStorageAddress string, containerRuntime container_runtime.ContainerRuntime, options StagesStorageOptions) (StagesStorage, error) {
 	if stagesStorageAddress == LocalStorageAddress {
-		return NewLocalDockerServerStagesStorage(containerRuntime.(*container_runtime.LocalDockerServerRuntime)), nil
+		localDockerServerRuntime, ok := containerRuntime.(*container_runtime.LocalDockerServerRuntime)
+		if !ok {
+			return nil, fmt.Errorf("local stages storage is not supported by the %s container runtime, specify the repo", containerRuntime.String())
+		}
+		return NewLocalDockerServerStagesStorage(localDockerServerRuntime), nil
+	} else if IsS3StagesStorageAddress(stagesStorageAddress) {
+		return NewS3StagesStorage(stagesStorageAddress, containerRuntime, options.S3StagesStorageOptions)
+	} else if IsOCILayoutStagesStorageAddress(stagesStorageAddress) {
+		return NewOCILayoutStagesStorage(stagesStorageAddress, containerRuntime)
 	} else { // Docker registry based stages storage
 		return NewRepoStagesStorage(stagesStorageAddress, containerRuntime, options.RepoStagesStorageOptions)
 	}
 }
+
+// ValidateMultiPlatformImagesSupport returns an error if the stages storage is not able to store the manifest lists of multi-platform images
+func ValidateMultiPlatformImagesSupport(storage StagesStorage) error {
+	switch storage.(type) {
+	case *LocalDockerServerStagesStorage, *S3StagesStorage, *OCILayoutStagesStorage:
+		return errMultiPlatformImagesNotSupported(storage)
+	}
+
+	return nil
+}
+
+func errMultiPlatformImagesNotSupported(storage StagesStorage) error {
+	return fmt.Errorf("multi-platform images are not supported by %s: the container registry is required (use --repo param)", storage.String())
+}
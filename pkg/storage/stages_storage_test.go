@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/werf/werf/pkg/container_runtime"
+)
+
+func TestNewStagesStorageLocalRequiresLocalDockerServerRuntime(t *testing.T) {
+	if _, err := NewStagesStorage(LocalStorageAddress, &container_runtime.LocalDockerServerRuntime{}, StagesStorageOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := NewStagesStorage(LocalStorageAddress, &container_runtime.BuildahRuntime{}, StagesStorageOptions{})
+	if err == nil || !strings.Contains(err.Error(), "not supported by the buildah container runtime") {
+		t.Fatalf("expected unsupported runtime error, got: %v", err)
+	}
+}
+
+func TestValidateMultiPlatformImagesSupport(t *testing.T) {
+	for _, stagesStorage := range []StagesStorage{
+		&LocalDockerServerStagesStorage{},
+		&S3StagesStorage{StorageAddress: "s3://bucket/stages"},
+		&OCILayoutStagesStorage{StorageAddress: "oci:/var/lib/stages"},
+	} {
+		err := ValidateMultiPlatformImagesSupport(stagesStorage)
+		if err == nil || !strings.Contains(err.Error(), "multi-platform images are not supported by "+stagesStorage.String()) {
+			t.Errorf("%s: expected multi-platform images not supported error, got: %v", stagesStorage.String(), err)
+		}
+	}
+
+	if err := ValidateMultiPlatformImagesSupport(&RepoStagesStorage{RepoAddress: "registry.example.com/project"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
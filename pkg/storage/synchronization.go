@@ -3,10 +3,13 @@ package storage
 import (
 	"errors"
 	"strings"
+
+	"github.com/go-redis/redis/v7"
 )
 
 var (
 	ErrBadKubernetesSynchronizationAddress = errors.New("bad kubernetes synchronization address")
+	ErrBadRedisSynchronizationAddress      = errors.New("bad redis synchronization address")
 )
 
 type KubernetesSynchronizationParams struct {
@@ -50,3 +53,16 @@ func ParseKubernetesSynchronization(address string) (*KubernetesSynchronizationP
 
 	return res, nil
 }
+
+func IsRedisSynchronization(address string) bool {
+	return strings.HasPrefix(address, "redis://") || strings.HasPrefix(address, "rediss://")
+}
+
+// ParseRedisSynchronization parses redis[s]://[:PASSWORD@]HOST[:PORT][/DB] address.
+func ParseRedisSynchronization(address string) (*redis.Options, error) {
+	if !IsRedisSynchronization(address) {
+		return nil, ErrBadRedisSynchronizationAddress
+	}
+
+	return redis.ParseURL(address)
+}
@@ -0,0 +1,146 @@
+package synchronization_server
+
+import (
+	"fmt"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+const BoltLocksBucket = "locks"
+
+// BoltOptimisticLockingStore is an in-memory optimistic locking store, which writes through every accepted value
+// into the locks/NAMESPACE bucket of the embedded bolt database and loads saved values on creation.
+// Lock leases survive the synchronization server restart this way: clients keep renewing their leases after the restart.
+type BoltOptimisticLockingStore struct {
+	*optimistic_locking_store.InMemoryStore
+
+	DB        *bolt.DB
+	Namespace string
+
+	// serializes the writes, so that the in-memory value is restored only if it has not been changed by another write
+	mux sync.Mutex
+}
+
+func NewBoltOptimisticLockingStore(db *bolt.DB, namespace string) (*BoltOptimisticLockingStore, error) {
+	store := &BoltOptimisticLockingStore{
+		InMemoryStore: optimistic_locking_store.NewInMemoryStore(),
+		DB:            db,
+		Namespace:     namespace,
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("unable to load locks/%s from %s: %s", namespace, db.Path(), err)
+	}
+
+	return store, nil
+}
+
+// GetValue returns the copy of the saved value, so that the changes made by the caller do not get into memory before the value is saved
+func (store *BoltOptimisticLockingStore) GetValue(key string) (*optimistic_locking_store.Value, error) {
+	value, err := store.InMemoryStore.GetValue(key)
+	if err != nil {
+		return nil, err
+	}
+
+	valueCopy := *value
+	return &valueCopy, nil
+}
+
+// PutValue saves the value into the database and memory in the same transaction:
+// the transaction is rolled back if the record version has been changed, the in-memory value is restored if the transaction fails
+func (store *BoltOptimisticLockingStore) PutValue(key string, value *optimistic_locking_store.Value) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	store.InMemoryStore.Mux.Lock()
+	prevValue, hasPrevValue := store.InMemoryStore.Values[key]
+	store.InMemoryStore.Mux.Unlock()
+
+	var isPutInMemory bool
+	if err := store.DB.Update(func(tx *bolt.Tx) error {
+		bucket, err := store.createBucketIfNotExists(tx)
+		if err != nil {
+			return err
+		}
+
+		if err := bucket.Put([]byte(key), []byte(value.Data)); err != nil {
+			return err
+		}
+
+		if err := store.InMemoryStore.PutValue(key, value); err != nil {
+			return err
+		}
+		isPutInMemory = true
+
+		return nil
+	}); err != nil {
+		if isPutInMemory {
+			store.InMemoryStore.Mux.Lock()
+			if hasPrevValue {
+				store.InMemoryStore.Values[key] = prevValue
+			} else {
+				delete(store.InMemoryStore.Values, key)
+			}
+			store.InMemoryStore.Mux.Unlock()
+		}
+
+		// the version change error is checked by the distributed locker as is
+		if optimistic_locking_store.IsErrRecordVersionChanged(err) {
+			return err
+		}
+
+		return fmt.Errorf("unable to save key %s into locks/%s of %s: %s", key, store.Namespace, store.DB.Path(), err)
+	}
+
+	return nil
+}
+
+func (store *BoltOptimisticLockingStore) load() error {
+	values := map[string]string{}
+
+	if err := store.DB.View(func(tx *bolt.Tx) error {
+		rootBucket := tx.Bucket([]byte(BoltLocksBucket))
+		if rootBucket == nil {
+			return nil
+		}
+
+		bucket := rootBucket.Bucket([]byte(store.Namespace))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(key, data []byte) error {
+			values[string(key)] = string(data)
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+
+	// Values could only be created by the in-memory store itself (version metadata is private),
+	// so every saved value is put as the next version of the newly created record.
+	for key, data := range values {
+		value, err := store.InMemoryStore.GetValue(key)
+		if err != nil {
+			return err
+		}
+
+		value.Data = data
+		if err := store.InMemoryStore.PutValue(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (store *BoltOptimisticLockingStore) createBucketIfNotExists(tx *bolt.Tx) (*bolt.Bucket, error) {
+	rootBucket, err := tx.CreateBucketIfNotExists([]byte(BoltLocksBucket))
+	if err != nil {
+		return nil, err
+	}
+	return rootBucket.CreateBucketIfNotExists([]byte(store.Namespace))
+}
@@ -0,0 +1,97 @@
+package synchronization_server
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/werf/lockgate/pkg/distributed_locker/optimistic_locking_store"
+)
+
+func TestBoltOptimisticLockingStoreVersionChanged(t *testing.T) {
+	dbPath := filepath.Join(newTestTmpDir(t), "database.db")
+	db := openTestDB(t, dbPath)
+	defer db.Close()
+
+	store, err := NewBoltOptimisticLockingStore(db, "myclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := store.GetValue("mylock")
+	second, _ := store.GetValue("mylock")
+
+	first.Data = "first"
+	if err := store.PutValue("mylock", first); err != nil {
+		t.Fatal(err)
+	}
+
+	second.Data = "second"
+	if err := store.PutValue("mylock", second); !optimistic_locking_store.IsErrRecordVersionChanged(err) {
+		t.Fatalf("expected record version changed error, got %v", err)
+	}
+
+	if value, _ := store.GetValue("mylock"); value.Data != "first" {
+		t.Errorf("expected in-memory value %q, got %q", "first", value.Data)
+	}
+
+	reloadedStore, err := NewBoltOptimisticLockingStore(db, "myclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := reloadedStore.GetValue("mylock"); value.Data != "first" {
+		t.Errorf("expected saved value %q, got %q", "first", value.Data)
+	}
+}
+
+func TestBoltOptimisticLockingStoreFailedWrite(t *testing.T) {
+	dbPath := filepath.Join(newTestTmpDir(t), "database.db")
+	db := openTestDB(t, dbPath)
+
+	store, err := NewBoltOptimisticLockingStore(db, "myclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, _ := store.GetValue("mylock")
+	value.Data = "saved"
+	if err := store.PutValue("mylock", value); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	value, _ = store.GetValue("mylock")
+	value.Data = "not saved"
+	if err := store.PutValue("mylock", value); err == nil {
+		t.Fatalf("expected error writing into closed database")
+	}
+
+	if value, _ := store.GetValue("mylock"); value.Data != "saved" {
+		t.Errorf("expected in-memory value not to be changed by the failed write, got %q", value.Data)
+	}
+
+	newValue, _ := store.GetValue("newlock")
+	newValue.Data = "not saved"
+	if err := store.PutValue("newlock", newValue); err == nil {
+		t.Fatalf("expected error writing into closed database")
+	}
+
+	if value, _ := store.GetValue("newlock"); value.Data != "" {
+		t.Errorf("expected new in-memory value not to be created by the failed write, got %q", value.Data)
+	}
+
+	db = openTestDB(t, dbPath)
+	defer db.Close()
+
+	reloadedStore, err := NewBoltOptimisticLockingStore(db, "myclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := reloadedStore.GetValue("mylock"); value.Data != "saved" {
+		t.Errorf("expected saved value %q, got %q", "saved", value.Data)
+	}
+}
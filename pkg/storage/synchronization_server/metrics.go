@@ -0,0 +1,168 @@
+package synchronization_server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker"
+
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage"
+)
+
+const ActiveClientPeriod = 5 * time.Minute
+
+type serverMetrics struct {
+	Registry *prometheus.Registry
+
+	LockWaitSeconds       prometheus.Histogram
+	StagesStorageCacheOps *prometheus.CounterVec
+
+	mux                   sync.Mutex
+	lastRequestByClientID map[string]time.Time
+}
+
+func newServerMetrics() *serverMetrics {
+	metrics := &serverMetrics{
+		Registry: prometheus.NewRegistry(),
+		LockWaitSeconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "werf_synchronization_server_lock_wait_seconds",
+			Help:    "Time spent by clients waiting for the lock until it has been acquired.",
+			Buckets: []float64{0, 1, 5, 15, 30, 60, 120, 300, 600, 1800},
+		}),
+		StagesStorageCacheOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "werf_synchronization_server_stages_storage_cache_requests_total",
+			Help: "Number of stages storage cache get requests by result (hit or miss).",
+		}, []string{"operation", "result"}),
+		lastRequestByClientID: make(map[string]time.Time),
+	}
+
+	metrics.Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		metrics.LockWaitSeconds,
+		metrics.StagesStorageCacheOps,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "werf_synchronization_server_active_clients",
+			Help: "Number of client ids with requests during the last 5 minutes.",
+		}, func() float64 { return float64(metrics.countActiveClients()) }),
+	)
+
+	return metrics
+}
+
+func (metrics *serverMetrics) registerClientRequest(clientID string) {
+	metrics.mux.Lock()
+	defer metrics.mux.Unlock()
+	metrics.lastRequestByClientID[clientID] = time.Now()
+}
+
+func (metrics *serverMetrics) countActiveClients() int {
+	metrics.mux.Lock()
+	defer metrics.mux.Unlock()
+
+	var count int
+	for clientID, lastRequest := range metrics.lastRequestByClientID {
+		if time.Since(lastRequest) > ActiveClientPeriod {
+			delete(metrics.lastRequestByClientID, clientID)
+			continue
+		}
+		count++
+	}
+
+	return count
+}
+
+// metricsDistributedLockerBackend measures the lock wait time as a time between the first acquire attempt,
+// which has been told to wait, and the successful acquire of the same lock.
+// Clients poll the backend every DistributedLockPollRetryPeriodSeconds while waiting,
+// so waiting is considered abandoned if there were no attempts during the lease TTL.
+type metricsDistributedLockerBackend struct {
+	distributed_locker.DistributedLockerBackend
+	metrics *serverMetrics
+
+	mux     sync.Mutex
+	waiting map[string]*lockWaiting
+}
+
+type lockWaiting struct {
+	Since       time.Time
+	LastAttempt time.Time
+}
+
+func newMetricsDistributedLockerBackend(backend distributed_locker.DistributedLockerBackend, metrics *serverMetrics) *metricsDistributedLockerBackend {
+	return &metricsDistributedLockerBackend{
+		DistributedLockerBackend: backend,
+		metrics:                  metrics,
+		waiting:                  make(map[string]*lockWaiting),
+	}
+}
+
+func (backend *metricsDistributedLockerBackend) Acquire(lockName string, opts distributed_locker.AcquireOptions) (lockgate.LockHandle, error) {
+	handle, err := backend.DistributedLockerBackend.Acquire(lockName, opts)
+
+	backend.mux.Lock()
+	defer backend.mux.Unlock()
+
+	now := time.Now()
+	waiting, hasKey := backend.waiting[lockName]
+	if hasKey && now.Sub(waiting.LastAttempt) > distributed_locker.DistributedLockLeaseTTLSeconds*time.Second {
+		hasKey = false
+	}
+
+	switch {
+	case distributed_locker.IsErrShouldWait(err):
+		if !hasKey {
+			waiting = &lockWaiting{Since: now}
+			backend.waiting[lockName] = waiting
+		}
+		waiting.LastAttempt = now
+	case err == nil:
+		if hasKey {
+			backend.metrics.LockWaitSeconds.Observe(now.Sub(waiting.Since).Seconds())
+		} else {
+			backend.metrics.LockWaitSeconds.Observe(0)
+		}
+		delete(backend.waiting, lockName)
+	}
+
+	return handle, err
+}
+
+type metricsStagesStorageCache struct {
+	storage.StagesStorageCache
+	metrics *serverMetrics
+}
+
+func newMetricsStagesStorageCache(cache storage.StagesStorageCache, metrics *serverMetrics) *metricsStagesStorageCache {
+	return &metricsStagesStorageCache{StagesStorageCache: cache, metrics: metrics}
+}
+
+func (cache *metricsStagesStorageCache) GetAllStages(ctx context.Context, projectName string) (bool, []image.StageID, error) {
+	found, stages, err := cache.StagesStorageCache.GetAllStages(ctx, projectName)
+	cache.observe("get-all-stages", found, err)
+	return found, stages, err
+}
+
+func (cache *metricsStagesStorageCache) GetStagesByDigest(ctx context.Context, projectName, digest string) (bool, []image.StageID, error) {
+	found, stages, err := cache.StagesStorageCache.GetStagesByDigest(ctx, projectName, digest)
+	cache.observe("get-stages-by-digest", found, err)
+	return found, stages, err
+}
+
+func (cache *metricsStagesStorageCache) observe(operation string, found bool, err error) {
+	if err != nil {
+		return
+	}
+
+	result := "miss"
+	if found {
+		result = "hit"
+	}
+
+	cache.metrics.StagesStorageCacheOps.WithLabelValues(operation, result).Inc()
+}
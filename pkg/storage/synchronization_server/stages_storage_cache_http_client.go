@@ -8,10 +8,10 @@ import (
 	"github.com/werf/werf/pkg/image"
 )
 
-func NewStagesStorageCacheHttpClient(url string) *StagesStorageCacheHttpClient {
+func NewStagesStorageCacheHttpClient(url, token string) *StagesStorageCacheHttpClient {
 	return &StagesStorageCacheHttpClient{
 		URL:        url,
-		HttpClient: &http.Client{},
+		HttpClient: NewHttpClient(token),
 	}
 }
 
@@ -10,10 +10,10 @@ type SynchronizationClient struct {
 	URL        string
 }
 
-func NewSynchronizationClient(url string) *SynchronizationClient {
+func NewSynchronizationClient(url, token string) *SynchronizationClient {
 	return &SynchronizationClient{
 		URL:        url,
-		HttpClient: &http.Client{},
+		HttpClient: NewHttpClient(token),
 	}
 }
 
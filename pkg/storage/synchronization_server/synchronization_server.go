@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/werf/werf/pkg/util"
 
@@ -17,8 +18,13 @@ import (
 	"github.com/werf/werf/pkg/storage"
 )
 
-func RunSynchronizationServer(_ context.Context, ip, port string, distributedLockerBackendFactoryFunc func(clientID string) (distributed_locker.DistributedLockerBackend, error), stagesStorageCacheFactoryFunc func(clientID string) (storage.StagesStorageCache, error)) error {
-	handler := NewSynchronizationServerHandler(distributedLockerBackendFactoryFunc, stagesStorageCacheFactoryFunc)
+type SynchronizationServerOptions struct {
+	// Authenticator enables bearer token auth of all requests
+	Authenticator *TokenAuthenticator
+}
+
+func RunSynchronizationServer(_ context.Context, ip, port string, distributedLockerBackendFactoryFunc func(clientID string) (distributed_locker.DistributedLockerBackend, error), stagesStorageCacheFactoryFunc func(clientID string) (storage.StagesStorageCache, error), options SynchronizationServerOptions) error {
+	handler := NewSynchronizationServerHandler(distributedLockerBackendFactoryFunc, stagesStorageCacheFactoryFunc, options)
 	return http.ListenAndServe(fmt.Sprintf("%s:%s", ip, port), handler)
 }
 
@@ -27,24 +33,52 @@ type SynchronizationServerHandler struct {
 
 	DistributedLockerBackendFactoryFunc func(clientID string) (distributed_locker.DistributedLockerBackend, error)
 	StagesStorageCacheFactoryFunc       func(clientID string) (storage.StagesStorageCache, error)
+	Authenticator                       *TokenAuthenticator
 
 	mux                             sync.Mutex
 	SynchronizationServerByClientID map[string]*SynchronizationServerHandlerByClientID
+
+	metrics *serverMetrics
 }
 
-func NewSynchronizationServerHandler(distributedLockerBackendFactoryFunc func(clientID string) (distributed_locker.DistributedLockerBackend, error), stagesStorageCacheFactoryFunc func(requestID string) (storage.StagesStorageCache, error)) *SynchronizationServerHandler {
+func NewSynchronizationServerHandler(distributedLockerBackendFactoryFunc func(clientID string) (distributed_locker.DistributedLockerBackend, error), stagesStorageCacheFactoryFunc func(requestID string) (storage.StagesStorageCache, error), options SynchronizationServerOptions) *SynchronizationServerHandler {
 	srv := &SynchronizationServerHandler{
 		ServeMux:                            http.NewServeMux(),
 		DistributedLockerBackendFactoryFunc: distributedLockerBackendFactoryFunc,
 		StagesStorageCacheFactoryFunc:       stagesStorageCacheFactoryFunc,
+		Authenticator:                       options.Authenticator,
 		SynchronizationServerByClientID:     make(map[string]*SynchronizationServerHandlerByClientID),
+		metrics:                             newServerMetrics(),
 	}
 	srv.HandleFunc("/health", srv.handleHealth)
 	srv.HandleFunc("/new-client-id", srv.handleNewClientID)
+	srv.Handle("/metrics", promhttp.HandlerFor(srv.metrics.Registry, promhttp.HandlerOpts{}))
 	srv.HandleFunc("/", srv.handleRequestByClientID)
 	return srv
 }
 
+func (server *SynchronizationServerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if server.Authenticator != nil {
+		grant := server.Authenticator.Authenticate(GetBearerToken(r))
+		if grant == nil {
+			http.Error(w, "Unauthorized: missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), tokenGrantContextKey{}, grant))
+	}
+
+	server.ServeMux.ServeHTTP(w, r)
+}
+
+type tokenGrantContextKey struct{}
+
+// getTokenGrant returns nil if the auth is disabled
+func getTokenGrant(r *http.Request) *TokenGrant {
+	grant, _ := r.Context().Value(tokenGrantContextKey{}).(*TokenGrant)
+	return grant
+}
+
 type HealthRequest struct {
 	Echo string `json:"echo"`
 }
@@ -77,7 +111,13 @@ func (server *SynchronizationServerHandler) handleNewClientID(w http.ResponseWri
 	var response NewClientIDResponse
 	HandleRequest(w, r, &request, &response, func() {
 		logboek.Debug().LogF("SynchronizationServerHandler -- NewClientID request %#v\n", request)
-		response.ClientID = uuid.New().String()
+
+		// the token bound to the client IDs may only use these client IDs
+		if grant := getTokenGrant(r); grant != nil && !grant.AnyClientID {
+			response.ClientID = grant.ClientIDs[0]
+		} else {
+			response.ClientID = uuid.New().String()
+		}
 		logboek.Debug().LogF("SynchronizationServerHandler -- NewClientID response %#v\n", response)
 	})
 }
@@ -119,6 +159,13 @@ func (server *SynchronizationServerHandler) handleRequestByClientID(w http.Respo
 		return
 	}
 
+	if grant := getTokenGrant(r); grant != nil && !grant.IsClientIDAllowed(clientID) {
+		http.Error(w, fmt.Sprintf("Forbidden: bearer token is not allowed for clientID %q", clientID), http.StatusForbidden)
+		return
+	}
+
+	server.metrics.registerClientRequest(clientID)
+
 	if clientServer, err := server.getOrCreateHandlerByClientID(clientID); err != nil {
 		http.Error(w, fmt.Sprintf("Internal error: %s", err), http.StatusInternalServerError)
 		return
@@ -144,7 +191,7 @@ func (server *SynchronizationServerHandler) getOrCreateHandlerByClientID(clientI
 			return nil, fmt.Errorf("unable to create stages storage cache for clientID %q: %s", clientID, err)
 		}
 
-		handler := NewSynchronizationServerHandlerByClientID(clientID, distributedLockerBackend, stagesStorageCache)
+		handler := NewSynchronizationServerHandlerByClientID(clientID, newMetricsDistributedLockerBackend(distributedLockerBackend, server.metrics), newMetricsStagesStorageCache(stagesStorageCache, server.metrics))
 		server.SynchronizationServerByClientID[clientID] = handler
 
 		logboek.Debug().LogF("SynchronizationServerHandler -- Created new synchronization server handler by clientID %q: %v\n", clientID, handler)
@@ -0,0 +1,270 @@
+package synchronization_server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/werf/lockgate/pkg/distributed_locker"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/werf/werf/pkg/image"
+	"github.com/werf/werf/pkg/storage"
+)
+
+func openTestDB(t *testing.T, path string) *bolt.DB {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestServer(t *testing.T, db *bolt.DB, options SynchronizationServerOptions) *httptest.Server {
+	handler := NewSynchronizationServerHandler(func(clientID string) (distributed_locker.DistributedLockerBackend, error) {
+		store, err := NewBoltOptimisticLockingStore(db, clientID)
+		if err != nil {
+			return nil, err
+		}
+		return distributed_locker.NewOptimisticLockingStorageBasedBackend(store), nil
+	}, func(clientID string) (storage.StagesStorageCache, error) {
+		return storage.NewBoltStagesStorageCache(db, clientID), nil
+	}, options)
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTestTmpDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "werf-synchronization-server-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestSynchronizationServerPersistence(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(newTestTmpDir(t), "database.db")
+
+	db := openTestDB(t, dbPath)
+	server := newTestServer(t, db, SynchronizationServerOptions{})
+
+	cache := NewStagesStorageCacheHttpClient(server.URL+"/myclient/stages-storage-cache", "")
+	stages := []image.StageID{{Digest: "a", UniqueID: 1}}
+	if err := cache.StoreStagesByDigest(ctx, "myproject", "a", stages); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := distributed_locker.NewHttpBackend(server.URL + "/myclient/locker")
+	handle, err := backend.Acquire("mylock", distributed_locker.AcquireOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, dbPath)
+	defer db.Close()
+	server = newTestServer(t, db, SynchronizationServerOptions{})
+
+	cache = NewStagesStorageCacheHttpClient(server.URL+"/myclient/stages-storage-cache", "")
+	if found, gotStages, err := cache.GetStagesByDigest(ctx, "myproject", "a"); err != nil {
+		t.Fatal(err)
+	} else if !found || len(gotStages) != 1 || gotStages[0] != stages[0] {
+		t.Errorf("unexpected stages after restart: %v", gotStages)
+	}
+
+	backend = distributed_locker.NewHttpBackend(server.URL + "/myclient/locker")
+	if _, err := backend.Acquire("mylock", distributed_locker.AcquireOptions{}); !distributed_locker.IsErrShouldWait(err) {
+		t.Errorf("expected lock to be held after restart, got %v", err)
+	}
+	if err := backend.RenewLease(handle); err != nil {
+		t.Errorf("unable to renew lease after restart: %s", err)
+	}
+	if err := backend.Release(handle); err != nil {
+		t.Errorf("unable to release lock after restart: %s", err)
+	}
+}
+
+func TestSynchronizationServerAuth(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, filepath.Join(newTestTmpDir(t), "database.db"))
+	defer db.Close()
+
+	authenticator, err := NewTokenAuthenticator([]AuthToken{
+		{Token: "token-1", ClientIDs: []string{"myclient"}},
+		{Token: "token-2", ClientIDs: []string{"otherclient", "myclient"}},
+		{Token: "admin-token", ClientIDs: []string{AnyClientID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer(t, db, SynchronizationServerOptions{Authenticator: authenticator})
+	url := server.URL + "/myclient/stages-storage-cache"
+
+	for _, token := range []string{"", "unknown-token"} {
+		if _, _, err := NewStagesStorageCacheHttpClient(url, token).GetAllStages(ctx, "myproject"); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("expected unauthorized error with token %q, got %v", token, err)
+		}
+		if _, err := NewSynchronizationClient(server.URL, token).NewClientID(); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("expected unauthorized new client id error with token %q, got %v", token, err)
+		}
+	}
+
+	for _, token := range []string{"token-1", "token-2", "admin-token"} {
+		if _, _, err := NewStagesStorageCacheHttpClient(url, token).GetAllStages(ctx, "myproject"); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+
+	for token, expectedClientID := range map[string]string{"token-1": "myclient", "token-2": "otherclient"} {
+		if clientID, err := NewSynchronizationClient(server.URL, token).NewClientID(); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if clientID != expectedClientID {
+			t.Errorf("expected client id %q bound to token %q, got %q", expectedClientID, token, clientID)
+		}
+	}
+
+	if clientID, err := NewSynchronizationClient(server.URL, "admin-token").NewClientID(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if clientID == "" || clientID == "myclient" || clientID == "otherclient" {
+		t.Errorf("expected new random client id for admin token, got %q", clientID)
+	}
+
+	for path, token := range map[string]string{"/locker/": "token-1", "/stages-storage-cache/v1/": "token-1"} {
+		// the token of one client cannot access the data of another client
+		resp, err := NewHttpClient(token).Post(server.URL+"/otherclient"+path, "application/json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected token %q to be forbidden for %s of otherclient, got status %d", token, path, resp.StatusCode)
+		}
+	}
+
+	if _, _, err := NewStagesStorageCacheHttpClient(server.URL+"/otherclient/stages-storage-cache", "token-1").GetAllStages(ctx, "myproject"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected forbidden error for another client, got %v", err)
+	}
+
+	if _, err := distributed_locker.NewHttpBackend(server.URL+"/otherclient/locker").Acquire("mylock", distributed_locker.AcquireOptions{}); err == nil {
+		t.Errorf("expected lock of another client to require auth")
+	}
+
+	for _, path := range []string{"/metrics", "/health"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected %s to require auth, got status %d", path, resp.StatusCode)
+		}
+
+		resp, err = NewHttpClient("token-1").Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			t.Errorf("expected %s to accept provisioned token", path)
+		}
+	}
+}
+
+func TestNewTokenAuthenticatorRequiresTokens(t *testing.T) {
+	if _, err := NewTokenAuthenticator(nil); err == nil {
+		t.Errorf("expected error without provisioned tokens")
+	}
+
+	if _, err := NewTokenAuthenticator([]AuthToken{{Token: "token-1"}}); err == nil {
+		t.Errorf("expected error for the token without client ids")
+	}
+
+	tokensFile := filepath.Join(newTestTmpDir(t), "tokens")
+	if err := ioutil.WriteFile(tokensFile, []byte("# ci runners\ntoken-1 myclient\n\n  token-2  otherclient myclient \nadmin-token *\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := ReadAuthTokensFile(tokensFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []AuthToken{
+		{Token: "token-1", ClientIDs: []string{"myclient"}},
+		{Token: "token-2", ClientIDs: []string{"otherclient", "myclient"}},
+		{Token: "admin-token", ClientIDs: []string{AnyClientID}},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("expected tokens %v, got %v", expected, tokens)
+	}
+
+	if err := ioutil.WriteFile(tokensFile, []byte("token-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadAuthTokensFile(tokensFile); err == nil {
+		t.Errorf("expected error for the token without client ids")
+	}
+}
+
+func TestSynchronizationServerMetrics(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, filepath.Join(newTestTmpDir(t), "database.db"))
+	defer db.Close()
+
+	server := newTestServer(t, db, SynchronizationServerOptions{})
+
+	cache := NewStagesStorageCacheHttpClient(server.URL+"/myclient/stages-storage-cache", "")
+	if err := cache.StoreStagesByDigest(ctx, "myproject", "a", []image.StageID{{Digest: "a", UniqueID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, digest := range []string{"a", "a", "b"} {
+		if _, _, err := cache.GetStagesByDigest(ctx, "myproject", digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend := distributed_locker.NewHttpBackend(server.URL + "/otherclient/locker")
+	if _, err := backend.Acquire("mylock", distributed_locker.AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`werf_synchronization_server_stages_storage_cache_requests_total{operation="get-stages-by-digest",result="hit"} 2`,
+		`werf_synchronization_server_stages_storage_cache_requests_total{operation="get-stages-by-digest",result="miss"} 1`,
+		`werf_synchronization_server_lock_wait_seconds_count 1`,
+		`werf_synchronization_server_active_clients 2`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", expected, data)
+		}
+	}
+}
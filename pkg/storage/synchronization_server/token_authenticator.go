@@ -0,0 +1,157 @@
+package synchronization_server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// AnyClientID allows the token to be used with any client ID (e.g. by the administrator).
+const AnyClientID = "*"
+
+// AuthToken is the bearer token provisioned by the server administrator along with the client IDs the token may be used with.
+type AuthToken struct {
+	Token     string
+	ClientIDs []string
+}
+
+// TokenGrant is the set of client IDs the authenticated request may access.
+type TokenGrant struct {
+	ClientIDs   []string
+	AnyClientID bool
+}
+
+func (grant *TokenGrant) IsClientIDAllowed(clientID string) bool {
+	if grant.AnyClientID {
+		return true
+	}
+
+	for _, id := range grant.ClientIDs {
+		if id == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+type provisionedToken struct {
+	TokenHash []byte
+	Grant     *TokenGrant
+}
+
+// TokenAuthenticator checks bearer tokens of the requests against the tokens provisioned by the server administrator.
+// Only the token hashes are kept in memory.
+type TokenAuthenticator struct {
+	tokens []*provisionedToken
+}
+
+func NewTokenAuthenticator(tokens []AuthToken) (*TokenAuthenticator, error) {
+	authenticator := &TokenAuthenticator{}
+
+	for _, token := range tokens {
+		if token.Token == "" {
+			continue
+		}
+
+		if len(token.ClientIDs) == 0 {
+			return nil, fmt.Errorf("no client IDs specified for the token")
+		}
+
+		grant := &TokenGrant{}
+		for _, clientID := range token.ClientIDs {
+			if clientID == AnyClientID {
+				grant.AnyClientID = true
+			} else {
+				grant.ClientIDs = append(grant.ClientIDs, clientID)
+			}
+		}
+
+		tokenHash := sha256.Sum256([]byte(token.Token))
+		authenticator.tokens = append(authenticator.tokens, &provisionedToken{TokenHash: tokenHash[:], Grant: grant})
+	}
+
+	if len(authenticator.tokens) == 0 {
+		return nil, fmt.Errorf("no auth tokens provisioned")
+	}
+
+	return authenticator, nil
+}
+
+// ReadAuthTokensFile reads the tokens file: one token per line followed by the space separated client IDs the token may be used with
+// (or * for any client ID), empty lines and lines starting with # are ignored
+func ReadAuthTokensFile(path string) ([]AuthToken, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read auth tokens file %s: %s", path, err)
+	}
+
+	var tokens []AuthToken
+	for ind, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("bad auth tokens file %s line %d: expected token followed by client IDs or %s", path, ind+1, AnyClientID)
+		}
+
+		tokens = append(tokens, AuthToken{Token: fields[0], ClientIDs: fields[1:]})
+	}
+
+	return tokens, nil
+}
+
+// Authenticate returns the grant of the provisioned token or nil if the token is not provisioned
+func (authenticator *TokenAuthenticator) Authenticate(token string) *TokenGrant {
+	if token == "" {
+		return nil
+	}
+
+	tokenHash := sha256.Sum256([]byte(token))
+
+	var grant *TokenGrant
+	for _, provisionedToken := range authenticator.tokens {
+		// check all provisioned tokens to not leak the matched one through the response time
+		if subtle.ConstantTimeCompare(provisionedToken.TokenHash, tokenHash[:]) == 1 {
+			grant = provisionedToken.Grant
+		}
+	}
+
+	return grant
+}
+
+func GetBearerToken(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+}
+
+// NewHttpClient returns the http client, which sends the specified bearer token with every request (if not empty).
+func NewHttpClient(token string) *http.Client {
+	if token == "" {
+		return &http.Client{}
+	}
+
+	return &http.Client{
+		Transport: &bearerTokenTransport{Token: token, Base: http.DefaultTransport},
+	}
+}
+
+type bearerTokenTransport struct {
+	Token string
+	Base  http.RoundTripper
+}
+
+func (transport *bearerTokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	req := r.Clone(r.Context())
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", transport.Token))
+	return transport.Base.RoundTrip(req)
+}
@@ -50,3 +50,15 @@ func checkKubernetesSynchronization(t *testing.T, address string, expected *Kube
 		}
 	}
 }
+
+func TestParseRedisSynchronization(t *testing.T) {
+	if options, err := ParseRedisSynchronization("kubernetes://werf-synchronization"); err != ErrBadRedisSynchronizationAddress {
+		t.Errorf("unexpected parse response: options=%v err=%v", options, err)
+	}
+
+	if options, err := ParseRedisSynchronization("redis://:secret@redis.example.com:6380/2"); err != nil {
+		t.Error(err)
+	} else if options.Addr != "redis.example.com:6380" || options.Password != "secret" || options.DB != 2 {
+		t.Errorf("unexpected redis options %#v", options)
+	}
+}